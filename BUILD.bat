@@ -1,11 +1,19 @@
 @echo off
 echo Building DbBridge...
-go build -o dbbridge.exe ./cmd/dbbridge
+
+if "%VERSION%"=="" set VERSION=dev
+for /f %%i in ('git rev-parse --short HEAD 2^>nul') do set COMMIT=%%i
+if "%COMMIT%"=="" set COMMIT=unknown
+for /f %%i in ('powershell -NoProfile -Command "(Get-Date).ToUniversalTime().ToString('yyyy-MM-ddTHH:mm:ssZ')"') do set BUILD_DATE=%%i
+
+set LDFLAGS=-X dbbridge/internal/buildinfo.Version=%VERSION% -X dbbridge/internal/buildinfo.Commit=%COMMIT% -X dbbridge/internal/buildinfo.BuildDate=%BUILD_DATE%
+
+go build -ldflags "%LDFLAGS%" -o dbbridge.exe ./cmd/dbbridge
 if %errorlevel% neq 0 (
     echo Build Failed!
     exit /b %errorlevel%
 )
-echo Build Success! dbbridge.exe created.
+echo Build Success! dbbridge.exe created (%VERSION% %COMMIT%).
 echo.
 echo To run: dbbridge.exe
 pause
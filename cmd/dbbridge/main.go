@@ -2,16 +2,23 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"dbbridge/internal/api"
+	"dbbridge/internal/buildinfo"
 	"dbbridge/internal/config"
+	"dbbridge/internal/core"
 	"dbbridge/internal/data"
 	"dbbridge/internal/logger"
+	"dbbridge/internal/redis"
 	"dbbridge/internal/service"
+	"expvar"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -23,6 +30,8 @@ import (
 	_ "github.com/denisenkom/go-mssqldb"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
+	_ "github.com/sijms/go-ora/v2"
+	_ "github.com/snowflakedb/gosnowflake"
 	_ "modernc.org/sqlite"
 )
 
@@ -30,9 +39,22 @@ func main() {
 	// Check for CLI subcommands
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
+		case "--demo":
+			os.Setenv("DEMO_MODE", "true")
+			startServer()
+			return
+		case "seed":
+			handleSeed(os.Args[2:])
+			return
 		case "reset-password":
 			handleResetPassword(os.Args[2:])
 			return
+		case "config":
+			handleConfig(os.Args[2:])
+			return
+		case "encrypt-metadata":
+			handleEncryptMetadata()
+			return
 		case "install":
 			installService()
 			return
@@ -45,6 +67,9 @@ func main() {
 		case "stop":
 			stopService()
 			return
+		case "version", "--version", "-v":
+			fmt.Println(buildinfo.String())
+			return
 		case "help", "--help", "-h":
 			printHelp()
 			return
@@ -70,14 +95,46 @@ func printHelp() {
 	fmt.Println()
 	fmt.Println("Usage:")
 	fmt.Println("  dbbridge                         Start the server (foreground)")
+	fmt.Println("  dbbridge --demo                  Start with a throwaway sample database (DEMO_MODE=true)")
 	fmt.Println("  dbbridge install                 Install as Windows Service")
 	fmt.Println("  dbbridge uninstall               Remove Windows Service")
 	fmt.Println("  dbbridge start                   Start the Windows Service")
 	fmt.Println("  dbbridge stop                    Stop the Windows Service")
 	fmt.Println("  dbbridge reset-password -u <user>  Reset user password (interactive)")
+	fmt.Println("  dbbridge config check            Validate configuration without starting")
+	fmt.Println("  dbbridge seed [-sample <path>]   Add the demo connection, queries and API key")
+	fmt.Println("  dbbridge encrypt-metadata        Encrypt plaintext rows of the METADATA_ENCRYPT column groups")
+	fmt.Println("  dbbridge version                 Show version and build info")
 	fmt.Println("  dbbridge help                    Show this help")
 }
 
+func handleConfig(args []string) {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Println("Usage: dbbridge config check")
+		os.Exit(1)
+	}
+
+	cfg, err := config.LoadForCheck()
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	issues := cfg.Validate()
+	printConfigIssues(issues)
+	if config.HasFatal(issues) {
+		os.Exit(1)
+	}
+	fmt.Println("Configuration OK.")
+}
+
+// printConfigIssues prints all validation problems together so they can be fixed in one go
+func printConfigIssues(issues []config.Issue) {
+	for _, issue := range issues {
+		fmt.Println(issue.String())
+	}
+}
+
 func handleResetPassword(args []string) {
 	fs := flag.NewFlagSet("reset-password", flag.ExitOnError)
 	username := fs.String("u", "", "Username to reset")
@@ -117,6 +174,16 @@ func handleResetPassword(args []string) {
 	}
 
 	// Initialize minimal dependencies
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	// The password is hashed with the configured Argon2id cost
+	if issues := cfg.Validate(); config.HasFatal(issues) {
+		printConfigIssues(issues)
+		os.Exit(1)
+	}
 	db, err := data.InitDB()
 	if err != nil {
 		fmt.Printf("Failed to init database: %v\n", err)
@@ -127,6 +194,7 @@ func handleResetPassword(args []string) {
 	userRepo := data.NewUserRepo(db)
 	apiKeyRepo := data.NewApiKeyRepo(db)
 	authSvc := service.NewAuthService(userRepo, apiKeyRepo)
+	authSvc.SetPasswordHasher(passwordHasher(cfg))
 
 	err = authSvc.ResetPassword(*username, password)
 	if err != nil {
@@ -137,6 +205,126 @@ func handleResetPassword(args []string) {
 	fmt.Printf("Password for user '%s' has been reset successfully.\n", *username)
 }
 
+func handleSeed(args []string) {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	samplePath := fs.String("sample", "", "Sample SQLite database to create (default: demo-sample.db next to dbbridge.db)")
+	fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	dbPath, err := data.DBPath()
+	if err != nil {
+		fmt.Printf("Failed to locate database: %v\n", err)
+		os.Exit(1)
+	}
+	if *samplePath == "" {
+		*samplePath = filepath.Join(filepath.Dir(dbPath), "demo-sample.db")
+	}
+
+	db, err := data.OpenDB(dbPath)
+	if err != nil {
+		fmt.Printf("Failed to init database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	result, err := newDemoSeeder(db, cfg).Seed(context.Background(), service.DemoOptions{SamplePath: *samplePath})
+	if err != nil {
+		fmt.Printf("Failed to seed demo data: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Demo connection: %s (%s)\n", result.ConnectionName, *samplePath)
+	if len(result.Queries) == 0 {
+		fmt.Println("Demo queries: already present")
+	} else {
+		fmt.Printf("Demo queries created: %s\n", strings.Join(result.Queries, ", "))
+	}
+	if result.APIKey != "" {
+		fmt.Printf("Demo API key (shown once): %s\n", result.APIKey)
+	} else if hasUsers, _ := service.NewAuthService(data.NewUserRepo(db), data.NewApiKeyRepo(db)).HasUsers(); !hasUsers {
+		fmt.Println("No admin user yet: complete /setup, then run 'dbbridge seed' again for a demo API key.")
+	} else {
+		fmt.Println("Demo API key: already created (revoke it on the API Keys page to get a new one)")
+	}
+}
+
+func newDemoSeeder(db *sql.DB, cfg *config.Config) *service.DemoSeeder {
+	cryptoSvc, err := service.NewEncryptionService(cfg.DbBridgeKey)
+	if err != nil {
+		fmt.Printf("Failed to init crypto service: %v\n", err)
+		os.Exit(1)
+	}
+	metadataCipher := data.NewMetadataCipher(cryptoSvc, cfg.MetadataEncrypt)
+	userRepo := data.NewUserRepo(db)
+	apiKeyRepo := data.NewApiKeyRepo(db)
+	apiKeyRepo.SetCipher(metadataCipher)
+	queryRepo := data.NewQueryRepo(db)
+	queryRepo.SetCipher(metadataCipher)
+	authSvc := service.NewAuthService(userRepo, apiKeyRepo)
+	authSvc.SetPasswordHasher(passwordHasher(cfg))
+	return service.NewDemoSeeder(data.NewConnectionRepo(db), queryRepo, userRepo, apiKeyRepo, authSvc, cryptoSvc)
+}
+
+// passwordHasher hashes new passwords with the configured Argon2id cost
+func passwordHasher(cfg *config.Config) service.PasswordHasher {
+	return service.NewArgon2idHasher(service.Argon2idParams{
+		Memory:      uint32(cfg.Argon2MemoryKB),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	})
+}
+
+// handleEncryptMetadata encrypts the rows of the METADATA_ENCRYPT groups
+// written while they were not listed. Encrypted rows are skipped, so it can
+// run again, e.g. after adding a group.
+func handleEncryptMetadata() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if len(cfg.MetadataEncrypt) == 0 {
+		fmt.Printf("METADATA_ENCRYPT is empty: list the column groups to encrypt (%s)\n", strings.Join(core.EncryptGroups, ", "))
+		os.Exit(1)
+	}
+	issues := cfg.Validate()
+	printConfigIssues(issues)
+	if config.HasFatal(issues) {
+		os.Exit(1)
+	}
+	cryptoSvc, err := service.NewEncryptionService(cfg.DbBridgeKey)
+	if err != nil {
+		fmt.Printf("Failed to init crypto service: %v\n", err)
+		os.Exit(1)
+	}
+	dbPath, err := data.DBPath()
+	if err != nil {
+		fmt.Printf("Failed to locate database: %v\n", err)
+		os.Exit(1)
+	}
+	db, err := data.OpenDB(dbPath)
+	if err != nil {
+		fmt.Printf("Failed to init database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	counts, err := data.EncryptMetadata(db, data.NewMetadataCipher(cryptoSvc, cfg.MetadataEncrypt))
+	for _, group := range core.EncryptGroups {
+		if n, ok := counts[group]; ok {
+			fmt.Printf("%s: %d rows encrypted\n", group, n)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Failed to encrypt metadata: %v\n", err)
+		os.Exit(1)
+	}
+}
+
 func startServer() {
 	// 1. Load Config
 	cfg, err := config.Load()
@@ -145,24 +333,63 @@ func startServer() {
 		os.Exit(1)
 	}
 
+	issues := cfg.Validate()
+	printConfigIssues(issues)
+	if config.HasFatal(issues) {
+		fmt.Println("Invalid configuration, fix the errors above and restart. Run 'dbbridge config check' to re-validate.")
+		os.Exit(1)
+	}
+
 	// 2. Initialize Logger
 	logDir := "logs"
 	if err := logger.Init(logDir); err != nil {
 		fmt.Printf("Failed to init logger: %v\n", err)
 		os.Exit(1)
 	}
-	logger.Info.Println("Starting DbBridge...")
+	logger.Info.Printf("Starting %s", buildinfo.String())
+	logger.SetLevel(cfg.LogLevel)
 
-	// 3. Initialize DB
-	db, err := data.InitDB()
+	// Handlers read the config through the store so SIGHUP / POST /admin/reload take effect live
+	cfgStore := config.NewStore(cfg)
+
+	// 3. Initialize DB (demo mode runs on a throwaway database in a temp dir)
+	dbPath, err := data.DBPath()
+	if err != nil {
+		logger.Error.Fatalf("Failed to locate database: %v", err)
+	}
+	if cfg.DemoMode {
+		demoDir, err := os.MkdirTemp("", "dbbridge-demo-")
+		if err != nil {
+			logger.Error.Fatalf("Failed to create demo directory: %v", err)
+		}
+		defer os.RemoveAll(demoDir)
+		dbPath = filepath.Join(demoDir, "dbbridge.db")
+	}
+	db, err := data.OpenDB(dbPath)
 	if err != nil {
 		logger.Error.Fatalf("Failed to init database: %v", err)
 	}
 	defer db.Close()
 
-	// 4. Initialize Repos
-	connRepo := data.NewConnectionRepo(db)
-	queryRepo := data.NewQueryRepo(db)
+	if cfg.DemoMode {
+		result, err := newDemoSeeder(db, cfg).Seed(context.Background(), service.DemoOptions{
+			SamplePath:  filepath.Join(filepath.Dir(dbPath), "demo-sample.db"),
+			APIKey:      service.DemoAPIKey,
+			CreateAdmin: true,
+		})
+		if err != nil {
+			logger.Error.Fatalf("Failed to seed demo data: %v", err)
+		}
+		logger.Info.Printf("DEMO MODE: data is discarded on exit. Sign in as %s / %s, API key: %s",
+			service.DemoUsername, service.DemoPassword, result.APIKey)
+	}
+
+	// 4. Initialize Repos. Their writes count as changes of the API docs,
+	// which are cached until then
+	docsGeneration := &service.Generation{}
+	connRepo := service.TrackConnections(data.NewConnectionRepo(db), docsGeneration)
+	queryStore := data.NewQueryRepo(db)
+	queryRepo := service.TrackQueries(queryStore, docsGeneration)
 
 	// 5. Initialize Services
 	cryptoSvc, err := service.NewEncryptionService(cfg.DbBridgeKey)
@@ -173,40 +400,279 @@ func startServer() {
 	userRepo := data.NewUserRepo(db)
 	apiKeyRepo := data.NewApiKeyRepo(db)
 	authSvc := service.NewAuthService(userRepo, apiKeyRepo)
+	authSvc.SetPasswordHasher(passwordHasher(cfg))
 	auditRepo := data.NewAuditRepo(db)
-	queryExecutor := service.NewQueryExecutor(connRepo, queryRepo, auditRepo, cryptoSvc)
+
+	// Sensitive metadata columns are encrypted at rest per METADATA_ENCRYPT
+	metadataCipher := data.NewMetadataCipher(cryptoSvc, cfg.MetadataEncrypt)
+	queryStore.SetCipher(metadataCipher)
+	apiKeyRepo.SetCipher(metadataCipher)
+	auditRepo.SetCipher(metadataCipher)
+
+	// Runtime settings from the admin page override the env-derived config
+	settingsSvc := service.NewSettingsService(data.NewSettingsRepo(db), auditRepo, cryptoSvc, func(key string) string {
+		return cfgStore.Get().Setting(key)
+	})
+	auditRepo.SetRetention(func() int { return settingsSvc.Int("AUDIT_RETENTION_ROWS") })
+	queryExecutor := service.NewQueryExecutor(connRepo, queryRepo, auditRepo, cryptoSvc, settingsSvc)
+	// Execution audit entries are written off the request path; Close at
+	// shutdown writes the ones still queued
+	auditWriter := service.NewAuditWriter(auditRepo, cfg.AuditWriteQueueSize, cfg.AuditWriteWorkers)
+	queryExecutor.SetAuditWriter(auditWriter)
+	expvar.Publish("audit_writer", expvar.Func(func() interface{} { return auditWriter.Status() }))
+	// API requests answered with an error status, written in batches off the
+	// request path
+	accessRepo := data.NewAccessEventRepo(db)
+	accessLog := service.NewAccessLog(accessRepo, cfg.AuditWriteQueueSize,
+		func() time.Duration {
+			return time.Duration(settingsSvc.Int("ACCESS_EVENT_RETENTION_HOURS")) * time.Hour
+		})
+	expvar.Publish("access_events", expvar.Func(func() interface{} { return accessLog.Status() }))
 
 	// 6. Initialize Handlers
-	webHandler := api.NewWebHandler(connRepo, queryRepo, auditRepo, userRepo, apiKeyRepo, authSvc, cryptoSvc, cfg)
+	webHandler := api.NewWebHandler(os.DirFS("web/templates"), connRepo, queryRepo, auditRepo, userRepo, apiKeyRepo, authSvc, cryptoSvc, cfgStore, settingsSvc)
 	authHandler := api.NewAuthHandler(authSvc, cfg.DbBridgeKey, webHandler.GetTemplates())
+	authHandler.SetAuditor(service.NewAdminAuditor(auditRepo))
+
+	docHandler := api.NewDocHandler(queryRepo, connRepo, cfgStore)
+	docHandler.SetTemplates(webHandler.GetTemplates())
+	docHandler.SetGeneration(docsGeneration)
+	webHandler.SetDocs(docHandler)
+	apiHandler := api.NewHandler(queryExecutor, docHandler, authSvc, auditRepo, cfgStore)
+	apiHandler.SetSettings(settingsSvc)
+	contractLog := service.NewContractLog(data.NewContractRepo(db), queryRepo, connRepo)
+	apiHandler.SetContractLog(contractLog)
+	webHandler.SetContractLog(contractLog)
+	apiHandler.SetIdempotency(data.NewIdempotencyRepo(db))
+	// Daily requests per API key, written in batches and read back on start
+	quota := service.NewDailyQuota(data.NewQuotaRepo(db),
+		func() int { return settingsSvc.Int("API_DAILY_QUOTA") },
+		func() string { return settingsSvc.Get("QUOTA_TIMEZONE") })
+	if err := quota.Load(time.Now()); err != nil {
+		logger.Error.Printf("Failed to load API quota usage: %v", err)
+	}
+	apiHandler.SetQuota(quota)
+	detailRepo := data.NewExecutionDetailRepo(db)
+	detailRepo.SetCipher(metadataCipher)
+	queryExecutor.SetDetailRepo(detailRepo)
+	webHandler.SetDetailRepo(detailRepo)
+
+	// Vault secrets for vault:path#field references in connection strings (optional)
+	if cfg.VaultAddr != "" {
+		secrets := service.NewSecretResolver(service.VaultConfig{
+			Addr:      cfg.VaultAddr,
+			Token:     cfg.VaultToken,
+			RoleID:    cfg.VaultRoleID,
+			SecretID:  cfg.VaultSecretID,
+			Namespace: cfg.VaultNamespace,
+			CacheTTL:  time.Duration(cfg.VaultCacheSeconds) * time.Second,
+		})
+		queryExecutor.SetSecretResolver(secrets)
+		webHandler.SetSecretResolver(secrets)
+		logger.Info.Printf("Resolving vault: connection string references from %s", cfg.VaultAddr)
+	}
 
-	docHandler := api.NewDocHandler(queryRepo, connRepo)
-	apiHandler := api.NewHandler(queryExecutor, docHandler, authSvc)
+	// SQLite connections may only open existing files under SQLITE_BASE_DIR (optional)
+	sqlitePolicy := service.SQLiteFilePolicy{BaseDir: cfg.SQLiteBaseDir, ReadOnly: cfg.SQLiteReadOnly}
+	queryExecutor.SetSQLitePolicy(sqlitePolicy)
+	webHandler.SetSQLitePolicy(sqlitePolicy)
+
+	// Fault injection for resilience testing, opt-in via CHAOS_MODE=true
+	var chaos *service.Chaos
+	if cfg.ChaosMode {
+		chaos = service.NewChaos()
+		queryExecutor.SetChaos(chaos)
+		logger.Info.Println("CHAOS_MODE is on: faults can be injected into connections, never use it in production")
+	}
 
 	// 7. Start Server
+	api.ApplyTrustedProxies(cfg)
 	r := chi.NewRouter()
 	r.Use(api.LoggingMiddleware)
+	if cfg.ServerHeader {
+		r.Use(api.ServerHeaderMiddleware)
+	}
 
 	// Rate Limiters
-	loginLimiter := api.NewRateLimiter(5, 3) // 5 req/min, burst 3 (brute force protection)
-	apiLimiter := api.NewRateLimiter(60, 10) // 60 req/min, burst 10
+	newLimiter := func(name string, ratePerMinute, burst int) *api.RateLimiter {
+		return api.NewRateLimiter(name, float64(ratePerMinute), burst)
+	}
+	if cfg.RateLimitBackend == "redis" {
+		// Shared buckets so every instance behind the load balancer enforces one quota
+		redisClient, err := redis.NewClient(cfg.RedisURL)
+		if err != nil {
+			logger.Error.Fatalf("Failed to init redis rate limiter: %v", err)
+		}
+		if _, err := redisClient.Do("PING"); err != nil {
+			logger.Error.Printf("Redis not reachable, rate limiting fails open until it is: %v", err)
+		}
+		newLimiter = func(name string, ratePerMinute, burst int) *api.RateLimiter {
+			store := api.NewRedisLimiterStore(redisClient, "dbbridge:ratelimit:"+name+":")
+			return api.NewRateLimiterWithStore(name, float64(ratePerMinute), burst, store)
+		}
+		logger.Info.Println("Rate limiting backend: redis")
+	}
+	loginLimiter := newLimiter("login", cfg.LoginRateLimit, cfg.LoginRateBurst) // default 5 req/min, burst 3 (brute force protection)
+	adminLimiter := newLimiter("admin", cfg.AdminRateLimit, cfg.AdminRateBurst) // default 300 req/min, burst 50
+	apiLimiter := newLimiter("api", cfg.APIRateLimit, cfg.APIRateBurst)         // default 60 req/min, burst 10
+	embedLimiter := newLimiter("embed", cfg.EmbedRateLimit, cfg.EmbedRateBurst) // per embed token, default 30 req/min, burst 10
+
+	exemptions := api.NewRateLimitExemptions(authHandler.HasAdminSession)
+	exemptions.Apply(cfg)
+	for _, l := range []*api.RateLimiter{loginLimiter, adminLimiter, apiLimiter} {
+		l.SetExemptions(exemptions)
+	}
+	// Background workers (audit forwarding, mailer) stop after the HTTP server
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Audit forwarding to a SIEM (optional). Entries still queued at shutdown are
+	// re-sent from the database on the next start thanks to the persistent cursor.
+	var auditForwarder *service.AuditForwarder
+	if cfg.AuditSink != "" {
+		sink, err := service.NewAuditSink(cfg.AuditSink, cfg.AuditSinkTarget, cfg.AuditSinkToken)
+		if err != nil {
+			logger.Error.Fatalf("Failed to init audit sink: %v", err)
+		}
+		auditForwarder = service.NewAuditForwarder(auditRepo, sink, cfg.AuditQueueSize, cfg.AuditBatchSize)
+		auditRepo.Subscribe(auditForwarder.Queue(), auditForwarder.OnDrop)
+		go auditForwarder.Run(bgCtx)
+		expvar.Publish("audit_forwarder", expvar.Func(func() interface{} { return auditForwarder.Status() }))
+		logger.Info.Printf("Forwarding audit logs to %s sink %s", sink.Kind(), sink.Target())
+	}
+	// Email notifications
+	mailerConfig := func() service.MailerConfig {
+		return service.MailerConfig{
+			Host:     settingsSvc.Get("SMTP_HOST"),
+			Port:     settingsSvc.Int("SMTP_PORT"),
+			TLSMode:  settingsSvc.Get("SMTP_TLS"),
+			Username: settingsSvc.Get("SMTP_USERNAME"),
+			Password: settingsSvc.Get("SMTP_PASSWORD"),
+			From:     settingsSvc.Get("SMTP_FROM"),
+			To:       settingsSvc.List("NOTIFY_EMAIL_TO"),
+			Throttle: time.Duration(settingsSvc.Int("NOTIFY_THROTTLE_MINUTES")) * time.Minute,
+			Locale:   settingsSvc.Get("DEFAULT_LOCALE"),
+		}
+	}
+	mailer := service.NewMailer(mailerConfig())
+	go mailer.Run(bgCtx)
+	go service.NewWarnDigest(auditRepo, mailer).Run(bgCtx)
+	orphanJanitor := service.NewOrphanJanitor(data.NewOrphanRepo(db), auditRepo, func() bool { return settingsSvc.Get("ORPHAN_CLEANUP") == "true" })
+	go orphanJanitor.Run(bgCtx)
+	inactiveKeys := service.NewInactiveKeyJanitor(apiKeyRepo, auditRepo,
+		func() bool { return settingsSvc.Get("INACTIVE_KEY_DISABLE") == "true" },
+		func() int { return settingsSvc.Int("INACTIVE_KEY_DAYS") })
+	inactiveKeys.SetMailer(mailer)
+	go inactiveKeys.Run(bgCtx)
+	// Hourly usage of connections, kept past the audit retention
+	usageStats := service.NewUsageStats(data.NewUsageRepo(db))
+	webHandler.SetUsageStats(usageStats)
+	go usageStats.Run(bgCtx)
+	// The metadata database itself: restored backups are reopened, locks and
+	// missing files reported on /readyz and the admin pages
+	dbHealth := data.NewDBHealth(db, dbPath)
+	webHandler.GetTemplates().SetMetadataHealth(dbHealth.Status)
+	go dbHealth.Run(bgCtx)
+	healthMonitor := service.NewHealthMonitor(connRepo, queryExecutor, settingsSvc)
+	healthMonitor.SetMailer(mailer)
+	webHandler.SetHealthMonitor(healthMonitor)
+	go healthMonitor.Run(bgCtx)
+	go accessLog.Run(bgCtx)
+	go quota.Run(bgCtx)
+	// Background exports of large results to files, deleted once they expire
+	exports := service.NewExportService(queryExecutor, cfg.ExportDir, cfg.ExportWorkers,
+		func() time.Duration { return time.Duration(settingsSvc.Int("EXPORT_RETENTION_HOURS")) * time.Hour },
+		func() int64 { return int64(settingsSvc.Int("EXPORT_MAX_MB")) << 20 },
+		func() time.Duration { return time.Duration(settingsSvc.Int("EXPORT_TIMEOUT_MINUTES")) * time.Minute })
+	go exports.Run(bgCtx)
+	apiHandler.SetExports(exports, authHandler.SessionUserID)
+	exportHandler := api.NewExportHandler(exports)
+	// Snapshot paging keeps results in memory until they are idle too long
+	snapshots := service.NewSnapshotStore(queryExecutor,
+		func() int { return settingsSvc.Int("SNAPSHOT_MAX_ROWS") },
+		func() time.Duration { return time.Duration(settingsSvc.Int("SNAPSHOT_IDLE_MINUTES")) * time.Minute },
+		func() time.Duration { return time.Duration(settingsSvc.Int("QUERY_TIMEOUT_SECONDS")) * time.Second })
+	snapshots.SetLimits(func() int { return settingsSvc.Int("SNAPSHOT_MAX_PER_KEY") },
+		func() int { return settingsSvc.Int("SNAPSHOT_MAX_OPEN") })
+	go snapshots.Run(bgCtx)
+	apiHandler.SetSnapshots(snapshots)
+	statusHandler := api.NewStatusHandler(webHandler.GetTemplates(), healthMonitor, settingsSvc)
+	statusHandler.SetMetadataHealth(dbHealth.Status)
+	orphanHandler := api.NewOrphanHandler(webHandler.GetTemplates(), orphanJanitor, authHandler.SessionUserID)
+	settingsHandler := api.NewSettingsHandler(webHandler.GetTemplates(), settingsSvc, mailer, authHandler.SessionUserID)
+
+	auditForwardHandler := api.NewAuditForwardHandler(webHandler.GetTemplates(), auditForwarder)
+	accessEventsHandler := api.NewAccessEventsHandler(webHandler.GetTemplates(), accessRepo, accessLog)
+
+	rateLimitHandler := api.NewRateLimitHandler(webHandler.GetTemplates(), exemptions, loginLimiter, adminLimiter, apiLimiter, embedLimiter)
+
+	embeds := service.NewEmbedService(data.NewEmbedTokenRepo(db), queryExecutor, cfg.DbBridgeKey)
+	webHandler.SetEmbeds(embeds)
+	embedHandler := api.NewEmbedHandler(embeds, webHandler.GetTemplates(), embedLimiter)
+
+	// Runtime settings (env defaults or admin page overrides) applied to live components
+	applySettings := func() {
+		loginLimiter.SetLimits(float64(settingsSvc.Int("LOGIN_RATE_LIMIT")), settingsSvc.Int("LOGIN_RATE_BURST"))
+		adminLimiter.SetLimits(float64(settingsSvc.Int("ADMIN_RATE_LIMIT")), settingsSvc.Int("ADMIN_RATE_BURST"))
+		apiLimiter.SetLimits(float64(settingsSvc.Int("API_RATE_LIMIT")), settingsSvc.Int("API_RATE_BURST"))
+		embedLimiter.SetLimits(float64(settingsSvc.Int("EMBED_RATE_LIMIT")), settingsSvc.Int("EMBED_RATE_BURST"))
+		mailer.Configure(mailerConfig())
+	}
+	applySettings()
+	settingsSvc.OnChange(applySettings)
+
+	// Apply reloadable settings to live components
+	cfgStore.OnReload(func(c *config.Config) {
+		logger.SetLevel(c.LogLevel)
+		api.ApplyTrustedProxies(c)
+		exemptions.Apply(c)
+		applySettings()
+	})
 
 	// Public Routes
+	r.Get("/", authHandler.Root)
 	r.Get("/setup", authHandler.SetupPage)
 	r.Post("/setup", authHandler.DoSetup)
 	r.Get("/login", authHandler.LoginPage)
 	r.With(loginLimiter.Middleware).Post("/login", authHandler.DoLogin)
 	r.Get("/logout", authHandler.Logout)
+	statusHandler.RegisterRoutes(r)
+	embedHandler.RegisterRoutes(r)
 
 	// Protected Admin Routes
 	r.Group(func(r chi.Router) {
+		r.Use(adminLimiter.Middleware)
 		r.Use(authHandler.AdminMiddleware)
 		webHandler.RegisterRoutes(r)
+		rateLimitHandler.RegisterRoutes(r)
+		auditForwardHandler.RegisterRoutes(r)
+		accessEventsHandler.RegisterRoutes(r)
+		settingsHandler.RegisterRoutes(r)
+		orphanHandler.RegisterRoutes(r)
+		exportHandler.RegisterRoutes(r)
+
+		// Debug endpoints (pprof, runtime stats) are opt-in via DEBUG_ENDPOINTS=true
+		if cfg.DebugEndpoints {
+			debugHandler := api.NewDebugHandler(db, webHandler.GetTemplates())
+			debugHandler.RegisterRoutes(r)
+			logger.Info.Println("Debug endpoints enabled at /admin/debug")
+		}
+		if chaos != nil {
+			api.NewChaosHandler(chaos).RegisterRoutes(r)
+			logger.Info.Println("Fault injection enabled at /admin/debug/chaos")
+		}
 	})
 
 	// Public API (Protected by API Key + Rate Limiter)
 	r.Route("/api", func(r chi.Router) {
+		r.Use(api.AccessEventMiddleware(accessLog))
 		r.Use(apiLimiter.MiddlewareByAPIKey)
+		// Admin JSON API: an admin session or an admin API key
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(api.LoggingMiddleware)
+			r.Use(apiHandler.AdminAPIMiddleware(authHandler.SessionUserID))
+			webHandler.RegisterAdminAPIRoutes(r)
+		})
 		r.Mount("/", apiHandler.Routes())
 	})
 
@@ -222,9 +688,33 @@ func startServer() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
+	// SIGHUP reloads the configuration (on Windows use POST /admin/reload instead)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			result, err := cfgStore.Reload()
+			if err != nil {
+				logger.Error.Printf("Config reload failed: %v", err)
+				continue
+			}
+			for _, w := range result.Warnings {
+				logger.Info.Printf("Config: %s", w)
+			}
+			logger.Info.Printf("SIGHUP: %s", result)
+		}
+	}()
+
 	go func() {
-		logger.Info.Printf("Server listening on port %d", cfg.Port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.TLSCertFile != "" {
+			logger.Info.Printf("Server listening on port %d (HTTPS)", cfg.Port)
+			err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			logger.Info.Printf("Server listening on port %d", cfg.Port)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error.Fatalf("Server startup failed: %v", err)
 		}
 	}()
@@ -238,5 +728,10 @@ func startServer() {
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Error.Printf("Server shutdown error: %v", err)
 	}
+	exports.Close()
+	auditWriter.Close()
+	accessLog.Close()
+	quota.Close()
+	stopBackground()
 	logger.Info.Println("Server stopped")
 }
@@ -0,0 +1,46 @@
+// Command embed runs dbbridge queries inside another program with package
+// bridge, on a database the program opens itself.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"dbbridge/pkg/bridge"
+	"fmt"
+	"log"
+
+	_ "modernc.org/sqlite"
+)
+
+func main() {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer TEXT, total REAL);
+		INSERT INTO orders VALUES (1, 'acme', 10.5), (2, 'globex', 7), (3, 'acme', 3)`); err != nil {
+		log.Fatal(err)
+	}
+
+	x, err := bridge.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := x.Attach("shop", "sqlite", db); err != nil {
+		log.Fatal(err)
+	}
+	if err := x.AddQuery("orders-by-customer",
+		"SELECT id, total FROM orders WHERE customer = {customer} {order_by:id(id,total):asc} {pagination}"); err != nil {
+		log.Fatal(err)
+	}
+
+	result, err := x.Execute(context.Background(), "shop", "orders-by-customer", map[string]interface{}{"customer": "acme"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, row := range result.Data {
+		fmt.Printf("order %v: %v\n", row["id"], row["total"])
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bytes"
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// accessBodyCapture is how much of an error response is kept to read its
+	// code and message
+	accessBodyCapture = 1024
+	// accessMessageLen caps the message stored with an access event
+	accessMessageLen = 200
+	accessPageSize   = 100
+)
+
+// AccessEventMiddleware records the requests answered with a non-2xx status
+// in log. Successful requests only pay for the status check.
+func AccessEventMiddleware(log *service.AccessLog) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			aw := &accessWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(aw, r)
+			if aw.status >= 200 && aw.status < 300 {
+				return
+			}
+			ev := &core.AccessEvent{
+				Timestamp:  start,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Status:     aw.status,
+				ClientIP:   extractIP(r),
+				DurationMs: time.Since(start).Milliseconds(),
+			}
+			if key := r.Header.Get("X-API-Key"); len(key) >= 8 {
+				ev.KeyPrefix = key[:8]
+			}
+			ev.Code, ev.Message = accessError(aw.status, aw.Header().Get("Content-Type"), aw.body.Bytes())
+			log.Record(ev)
+		})
+	}
+}
+
+// accessWriter keeps the status and, for error statuses, the start of the
+// body
+type accessWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *accessWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	if (w.status < 200 || w.status >= 300) && w.body.Len() < accessBodyCapture {
+		w.body.Write(b[:min(len(b), accessBodyCapture-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *accessWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *accessWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// accessError reads the code and message of an error body: the "code" and
+// "error" of JSON ones, the first line of text ones. Without a code it is
+// the status text in snake case, e.g. too_many_requests.
+func accessError(status int, contentType string, body []byte) (code, message string) {
+	if strings.HasPrefix(contentType, "application/json") {
+		var e struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		json.Unmarshal(body, &e)
+		code, message = e.Code, e.Error
+	} else {
+		message, _, _ = strings.Cut(string(body), "\n")
+	}
+	message = strings.TrimSpace(message)
+	if len(message) > accessMessageLen {
+		message = message[:accessMessageLen]
+		for !utf8.ValidString(message) {
+			message = message[:len(message)-1]
+		}
+	}
+	if code == "" {
+		code = strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	}
+	return code, message
+}
+
+// AccessEventsHandler serves the access events page, under Logs
+type AccessEventsHandler struct {
+	templates *Templates
+	repo      core.AccessEventRepository
+	log       *service.AccessLog
+}
+
+func NewAccessEventsHandler(templates *Templates, repo core.AccessEventRepository, log *service.AccessLog) *AccessEventsHandler {
+	return &AccessEventsHandler{templates: templates, repo: repo, log: log}
+}
+
+// List shows the newest access events matching the filter form. The status
+// filter takes a code (429) or a class (4xx).
+func (h *AccessEventsHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := core.AccessEventFilter{
+		Path:      strings.TrimSpace(q.Get("path")),
+		KeyPrefix: strings.TrimSpace(q.Get("key")),
+		ClientIP:  strings.TrimSpace(q.Get("ip")),
+		Code:      strings.TrimSpace(q.Get("code")),
+	}
+	status := strings.ToLower(strings.TrimSpace(q.Get("status")))
+	if class, ok := strings.CutSuffix(status, "xx"); ok {
+		if n, err := strconv.Atoi(class); err == nil {
+			filter.MinStatus, filter.MaxStatus = n*100, n*100+99
+		}
+	} else if n, err := strconv.Atoi(status); err == nil {
+		filter.MinStatus, filter.MaxStatus = n, n
+	}
+	beforeID, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+
+	events, err := h.repo.List(filter, accessPageSize, beforeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var older int64
+	if len(events) == accessPageSize {
+		older = events[len(events)-1].ID
+	}
+	q.Del("before")
+	h.templates.Page(w, r, "access_events.html", map[string]interface{}{
+		"Title":  "Access Events",
+		"Events": events,
+		"Status": status,
+		"Filter": filter,
+		"Query":  template.URL(q.Encode()),
+		"Paged":  beforeID != 0,
+		"Older":  older,
+		"Counts": h.log.Status(),
+	})
+}
+
+func (h *AccessEventsHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/admin/logs/access", h.List)
+}
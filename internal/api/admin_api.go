@@ -0,0 +1,182 @@
+package api
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxAdminAPIBody bounds the JSON body of an admin API request
+const maxAdminAPIBody = 1 << 20
+
+// adminQueryInput is the body of POST and PUT /api/admin/queries: the fields
+// of the query form. Omitted fields are empty, so queries are inactive
+// unless is_active is sent.
+type adminQueryInput struct {
+	Slug                 string     `json:"slug"`
+	Description          string     `json:"description"`
+	SQLText              string     `json:"sql_text"`
+	ParamsConfig         string     `json:"params_config"`
+	IsActive             bool       `json:"is_active"`
+	ResultMode           string     `json:"result_mode"`
+	ShapeConfig          string     `json:"shape_config"`
+	XMLRoot              string     `json:"xml_root"`
+	ResponseConfig       string     `json:"response_config"`
+	ExecWindow           string     `json:"exec_window"`
+	SkipSchemaCheck      bool       `json:"skip_schema_check"`
+	WarnDurationMs       int        `json:"warn_duration_ms"`
+	WarnRows             int        `json:"warn_rows"`
+	RecordExample        bool       `json:"record_example"`
+	DebugCapture         bool       `json:"debug_capture"`
+	DebugCaptureValues   bool       `json:"debug_capture_values"`
+	Confidential         bool       `json:"confidential"`
+	AllowedConnectionIDs []int64    `json:"allowed_connection_ids"`
+	DeprecatedAt         *time.Time `json:"deprecated_at"`
+	SunsetAt             *time.Time `json:"sunset_at"`
+	SupersededBy         string     `json:"superseded_by"`
+	SunsetMessage        string     `json:"sunset_message"`
+}
+
+// RegisterAdminAPIRoutes adds the admin JSON API, mounted under /api/admin
+// behind Handler.AdminAPIMiddleware. Its writes are audited like the admin
+// UI's, with the admin API key that acted if any.
+func (h *WebHandler) RegisterAdminAPIRoutes(r chi.Router) {
+	r.Get("/connections", h.APIListConnections)
+	r.Get("/connections/{id}/heatmap", h.ConnectionHeatmap)
+	r.Get("/queries", h.APIListQueries)
+	r.Post("/queries", h.APISaveQuery)
+	r.Get("/queries/{id}", h.APIGetQuery)
+	r.Put("/queries/{id}", h.APISaveQuery)
+	r.Delete("/queries/{id}", h.APIDeleteQuery)
+	r.Get("/queries/{id}/impact", h.QueryImpact)
+}
+
+// APIListConnections answers the connections, without their secrets
+func (h *WebHandler) APIListConnections(w http.ResponseWriter, r *http.Request) {
+	conns, err := h.connRepo.GetAll()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"connections": conns})
+}
+
+func (h *WebHandler) APIListQueries(w http.ResponseWriter, r *http.Request) {
+	queries, err := h.queryRepo.GetAll()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"queries": queries})
+}
+
+func (h *WebHandler) APIGetQuery(w http.ResponseWriter, r *http.Request) {
+	q, ok := h.apiQuery(w, r)
+	if !ok {
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, q)
+}
+
+// APISaveQuery creates a query (POST) or replaces the {id} one (PUT) with the
+// validation of the query form; field errors answer 422 with "fields"
+func (h *WebHandler) APISaveQuery(w http.ResponseWriter, r *http.Request) {
+	var id int64
+	if chi.URLParam(r, "id") != "" {
+		existing, ok := h.apiQuery(w, r)
+		if !ok {
+			return
+		}
+		id = existing.ID
+	}
+	var in adminQueryInput
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminAPIBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	q := &core.SavedQuery{
+		ID:                   id,
+		Slug:                 core.Slugify(in.Slug),
+		Description:          in.Description,
+		SQLText:              in.SQLText,
+		ParamsConfig:         strings.TrimSpace(in.ParamsConfig),
+		IsActive:             in.IsActive,
+		ResultMode:           core.NormalizeResultMode(in.ResultMode),
+		ShapeConfig:          strings.TrimSpace(in.ShapeConfig),
+		XMLRoot:              strings.TrimSpace(in.XMLRoot),
+		ResponseConfig:       strings.TrimSpace(in.ResponseConfig),
+		ExecWindow:           strings.TrimSpace(in.ExecWindow),
+		SkipSchemaCheck:      in.SkipSchemaCheck,
+		WarnDurationMs:       in.WarnDurationMs,
+		WarnRows:             in.WarnRows,
+		RecordExample:        in.RecordExample,
+		DebugCapture:         in.DebugCapture,
+		DebugCaptureValues:   in.DebugCapture && in.DebugCaptureValues,
+		Confidential:         in.Confidential,
+		AllowedConnectionIDs: in.AllowedConnectionIDs,
+		DeprecatedAt:         in.DeprecatedAt,
+		SunsetAt:             in.SunsetAt,
+		SupersededBy:         core.Slugify(in.SupersededBy),
+		SunsetMessage:        strings.TrimSpace(in.SunsetMessage),
+	}
+	if errs := h.validateQuery(r, q, in.Slug); len(errs) > 0 {
+		writeAdminJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"error": "invalid query", "fields": errs})
+		return
+	}
+	if _, err := h.storeQuery(r, q); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if id == 0 {
+		status = http.StatusCreated
+		w.Header().Set("Location", "/api/admin/queries/"+strconv.FormatInt(q.ID, 10))
+	}
+	saved, err := h.queryRepo.GetByID(q.ID)
+	if err != nil {
+		saved = q
+	}
+	writeAdminJSON(w, status, saved)
+}
+
+func (h *WebHandler) APIDeleteQuery(w http.ResponseWriter, r *http.Request) {
+	before, ok := h.apiQuery(w, r)
+	if !ok {
+		return
+	}
+	if err := h.queryRepo.Delete(before.ID); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.record(r, service.AdminEvent{Type: core.EventQueryDelete, Target: "query " + before.Slug,
+		Changes: h.queryChanges(before, nil)})
+	h.recordContract(before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiQuery returns the {id} query; without one it has answered 404
+func (h *WebHandler) apiQuery(w http.ResponseWriter, r *http.Request) (*core.SavedQuery, bool) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	q, err := h.queryRepo.GetByID(id)
+	if err != nil || q == nil {
+		writeJSONError(w, http.StatusNotFound, "query not found")
+		return nil, false
+	}
+	return q, true
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,1272 @@
+package api_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"dbbridge/internal/api"
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"dbbridge/internal/testutil"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestExecuteQueryAPI(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, _ := env.CreateAPIKey(user.ID)
+	conn := env.CreateSQLiteConnection("shop",
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer TEXT)`,
+		`INSERT INTO orders VALUES (1, 'acme'), (2, 'globex')`)
+	env.CreateQuery("orders", "SELECT id FROM orders WHERE customer = {customer}", conn.ID)
+
+	tests := []struct {
+		name       string
+		key        string
+		path       string
+		body       string
+		wantStatus int    // 0 for any error status
+		wantBody   string // a substring of the response
+	}{
+		{"no key", "", "/api/shop/orders", `{"customer":"acme"}`, http.StatusUnauthorized, "Missing X-API-Key"},
+		{"bad key", "wrong", "/api/shop/orders", `{"customer":"acme"}`, http.StatusUnauthorized, "Invalid X-API-Key"},
+		{"success", key, "/api/shop/orders", `{"customer":"acme"}`, http.StatusOK, `"data":[{"id":1}]`},
+		{"missing parameter", key, "/api/shop/orders", `{}`, 0, "missing parameters: customer"},
+		{"unknown query", key, "/api/shop/nope", `{}`, 0, "query not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := srv.CallAPI(t, tt.key, tt.path, tt.body)
+			body, _ := io.ReadAll(resp.Body)
+			status := resp.StatusCode
+			if tt.wantStatus == 0 && status >= 400 {
+				status = 0
+			}
+			if status != tt.wantStatus || !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("%d %s, want %d with %q", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+
+	resp := srv.CallAPI(t, key, "/api/shop/orders", `{"customer":"globex"}`)
+	var result struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Data) != 1 || result.Data[0]["id"] != float64(2) {
+		t.Errorf("data = %v", result.Data)
+	}
+}
+
+func TestAdminSignIn(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	srv.Env.CreateUser("admin", "s3cret")
+
+	resp, err := srv.Client().Get(srv.URL + "/admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/login" {
+		t.Errorf("signed out: %d -> %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	resp, err = srv.SignIn(t, "admin", "s3cret").Get(srv.URL + "/admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `data-nav="dashboard"`) ||
+		!strings.Contains(string(body), `<p class="user">admin</p>`) {
+		t.Errorf("signed in: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestValidateConnection(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	srv.Env.CreateUser("admin", "s3cret")
+	client := srv.SignIn(t, "admin", "s3cret")
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+		wantBody   string
+	}{
+		{"valid", url.Values{"driver": {"postgres"}, "connection_string": {"host=db.local user=app password=x9"}},
+			http.StatusOK, `{"findings":[],"valid":true}`},
+		{"port", url.Values{"driver": {"mysql"}, "connection_string": {"app:x9@tcp(db.local:33o6)/sales"}},
+			http.StatusOK, `"field":"port"`},
+		{"no driver", url.Values{"connection_string": {"host=db.local"}}, http.StatusBadRequest, "Driver is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.PostForm(srv.URL+"/admin/connections/validate", tt.form)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus || !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("%d %s, want %d with %s", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestTestStoredConnection(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	srv.Env.CreateUser("admin", "s3cret")
+	client := srv.SignIn(t, "admin", "s3cret")
+	conn := srv.Env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER)`)
+	id := strconv.FormatInt(conn.ID, 10)
+
+	post := func(path string, form url.Values) (*http.Response, string) {
+		t.Helper()
+		resp, err := client.PostForm(srv.URL+path, form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	// A blank string tests the saved one without sending it back
+	resp, body := post("/admin/connections/test", url.Values{"driver": {"sqlite"}, "id": {id}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-DbBridge-Connection-Source") != "stored" ||
+		!strings.Contains(body, "saved connection string") {
+		t.Errorf("stored: %d %q", resp.StatusCode, body)
+	}
+	stored, _ := srv.Env.Crypto.Decrypt(conn.ConnectionStringEnc)
+	if strings.Contains(body, stored) {
+		t.Errorf("test answered the saved string: %q", body)
+	}
+	resp, _ = post("/admin/connections/test", url.Values{"driver": {"sqlite"}, "id": {"999"}})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown connection: %d, want 400", resp.StatusCode)
+	}
+
+	// Revealing answers the string and is audited
+	resp, body = post("/admin/connections/reveal", url.Values{"id": {id}})
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"connection_string"`) {
+		t.Errorf("reveal: %d %q", resp.StatusCode, body)
+	}
+	logs, err := srv.Env.Audit.ListRecent(10, "connection", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].EventType != core.EventConnectionReveal || logs[0].ConnectionID != conn.ID {
+		t.Errorf("audit = %+v, want one reveal of the connection", logs)
+	}
+}
+
+func TestAdminAPI(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	dataKey, _ := env.CreateAPIKey(user.ID)
+	tomorrow := time.Now().Add(24 * time.Hour)
+	adminKey, admin, err := env.Auth.GenerateApiKeyKind(user.ID, "provisioning", core.ApiKeyKindAdmin, &tomorrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER)`)
+	env.CreateQuery("orders", "SELECT id FROM orders", conn.ID)
+
+	call := func(client *http.Client, key, method, path, body string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp, string(b)
+	}
+	newQuery := fmt.Sprintf(`{"slug": "Daily Totals", "sql_text": "SELECT COUNT(*) AS n FROM orders", "is_active": true, "allowed_connection_ids": [%d]}`, conn.ID)
+
+	if resp, body := call(http.DefaultClient, dataKey, "POST", "/api/admin/queries", newQuery); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("data key: %d %s, want 403", resp.StatusCode, body)
+	}
+	if resp, _ := call(http.DefaultClient, "", "GET", "/api/admin/queries", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no key: %d, want 401", resp.StatusCode)
+	}
+	// Admin keys run no queries unless scoped
+	if resp := srv.CallAPI(t, adminKey, "/api/shop/orders", "{}"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("admin key on a query: %d, want 403", resp.StatusCode)
+	}
+
+	resp, body := call(http.DefaultClient, adminKey, "POST", "/api/admin/queries", newQuery)
+	var created core.SavedQuery
+	json.Unmarshal([]byte(body), &created)
+	if resp.StatusCode != http.StatusCreated || created.Slug != "daily-totals" || created.UpdatedBy != "api key "+admin.KeyPrefix+"..." {
+		t.Fatalf("create: %d %s", resp.StatusCode, body)
+	}
+	if resp := srv.CallAPI(t, dataKey, "/api/shop/daily-totals", "{}"); resp.StatusCode != http.StatusOK {
+		t.Errorf("created query: %d, want 200", resp.StatusCode)
+	}
+	logs, err := env.Audit.ListRecent(10, "query", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].EventType != core.EventQueryCreate || logs[0].ApiKeyID == nil || *logs[0].ApiKeyID != admin.ID {
+		t.Errorf("audit = %+v, want the create by the admin key", logs)
+	}
+
+	path := "/api/admin/queries/" + strconv.FormatInt(created.ID, 10)
+	if resp, body := call(http.DefaultClient, adminKey, "PUT", path, `{"slug": "daily-totals", "sql_text": ""}`); resp.StatusCode != http.StatusUnprocessableEntity ||
+		!strings.Contains(body, `"sql_text"`) {
+		t.Errorf("invalid update: %d %s, want 422 with the field", resp.StatusCode, body)
+	}
+
+	// A signed-in session works too, with JSON bodies only
+	client := srv.SignIn(t, "admin", "s3cret")
+	if resp, body := call(client, "", "GET", path, ""); resp.StatusCode != http.StatusOK || !strings.Contains(body, `"daily-totals"`) {
+		t.Errorf("session get: %d %s", resp.StatusCode, body)
+	}
+	if resp, err := client.PostForm(srv.URL+"/api/admin/queries", url.Values{"slug": {"x"}}); err != nil || resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("form post: %v %v, want 415", resp.StatusCode, err)
+	}
+	if resp, _ := call(client, "", "DELETE", path, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("delete: %d, want 204", resp.StatusCode)
+	}
+	if resp, _ := call(client, "", "GET", path, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleted query: %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestExportAPI(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, _ := env.CreateAPIKey(user.ID)
+	otherKey, _ := env.CreateAPIKey(user.ID)
+	conn := env.CreateSQLiteConnection("shop",
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer TEXT)`,
+		`INSERT INTO orders VALUES (1, 'acme'), (2, 'globex')`)
+	env.CreateQuery("orders", "SELECT id, customer FROM orders ORDER BY id", conn.ID)
+
+	get := func(key, path string, header ...string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		req.Header.Set("X-API-Key", key)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := srv.CallAPI(t, key, "/api/shop/orders/export?format=xml", `{}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("xml export: %d, want 400", resp.StatusCode)
+	}
+
+	resp := srv.CallAPI(t, key, "/api/shop/orders/export?format=csv", `{}`)
+	var job struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		Rows   int    `json:"rows"`
+	}
+	json.NewDecoder(resp.Body).Decode(&job)
+	if resp.StatusCode != http.StatusAccepted || job.ID == "" || resp.Header.Get("Location") != "/api/jobs/"+job.ID {
+		t.Fatalf("start: %d %+v, Location %q", resp.StatusCode, job, resp.Header.Get("Location"))
+	}
+	for deadline := time.Now().Add(5 * time.Second); job.Status != "done"; {
+		if job.Status == "failed" || time.Now().After(deadline) {
+			t.Fatalf("export did not finish: %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+		json.NewDecoder(get(key, "/api/jobs/"+job.ID).Body).Decode(&job)
+	}
+	if job.Rows != 2 {
+		t.Errorf("rows = %d, want 2", job.Rows)
+	}
+
+	resp = get(key, "/api/jobs/"+job.ID+"/download")
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("download: %d: %v", resp.StatusCode, err)
+	}
+	body, _ := io.ReadAll(gz)
+	if want := "id,customer\n1,acme\n2,globex\n"; string(body) != want {
+		t.Errorf("download = %q, want %q", body, want)
+	}
+	if got := resp.Header.Get("Content-Disposition"); got != `attachment; filename="orders.csv.gz"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	if resp := get(key, "/api/jobs/"+job.ID+"/download", "Range", "bytes=0-3"); resp.StatusCode != http.StatusPartialContent ||
+		resp.ContentLength != 4 {
+		t.Errorf("range: %d, %d bytes", resp.StatusCode, resp.ContentLength)
+	}
+	if resp := get(otherKey, "/api/jobs/"+job.ID+"/download"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("other key: %d, want 404", resp.StatusCode)
+	}
+	tomorrow := time.Now().Add(24 * time.Hour)
+	adminKey, _, err := env.Auth.GenerateApiKeyKind(user.ID, "ops", core.ApiKeyKindAdmin, &tomorrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := get(adminKey, "/api/jobs/"+job.ID+"/download"); resp.StatusCode != http.StatusOK {
+		t.Errorf("admin key: %d, want 200", resp.StatusCode)
+	}
+	if resp := get(adminKey, "/api/jobs/"+job.ID); resp.StatusCode != http.StatusOK {
+		t.Errorf("admin key status: %d, want 200", resp.StatusCode)
+	}
+
+	admin := srv.SignIn(t, "admin", "s3cret")
+	resp, err = admin.Get(srv.URL + "/api/jobs/" + job.ID + "/download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("admin session on the job route: %d, want 200", resp.StatusCode)
+	}
+
+	resp, err = admin.Get(srv.URL + "/admin/exports/" + job.ID + "/download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("admin download: %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestSnapshotPagingAPI(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, _ := env.CreateAPIKey(user.ID)
+	conn := env.CreateSQLiteConnection("shop",
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY)`,
+		`INSERT INTO orders VALUES (1), (2), (3)`)
+	env.CreateQuery("orders", "SELECT id FROM orders ORDER BY id", conn.ID)
+
+	type page struct {
+		Data []map[string]interface{} `json:"data"`
+		Meta struct {
+			Total     int    `json:"total"`
+			NextToken string `json:"next_token"`
+		} `json:"meta"`
+	}
+	resp := srv.CallAPI(t, key, "/api/shop/orders?snapshot=true&chunk_size=2", `{}`)
+	var first page
+	json.NewDecoder(resp.Body).Decode(&first)
+	if resp.StatusCode != http.StatusOK || len(first.Data) != 2 || first.Meta.Total != 3 || first.Meta.NextToken == "" {
+		t.Fatalf("first page: %d %+v", resp.StatusCode, first)
+	}
+
+	get := func(token string) *http.Response {
+		req, _ := http.NewRequest("GET", srv.URL+"/api/snapshots/"+token, nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	var second page
+	json.NewDecoder(get(first.Meta.NextToken).Body).Decode(&second)
+	if len(second.Data) != 1 || second.Data[0]["id"] != float64(3) || second.Meta.NextToken != "" {
+		t.Errorf("second page: %+v", second)
+	}
+
+	resp = get("0123.0")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusGone || !strings.Contains(string(body), `"code":"snapshot_expired"`) {
+		t.Errorf("expired token: %d %s", resp.StatusCode, body)
+	}
+
+	// SNAPSHOT_MAX_PER_KEY is 3 and the first one is still open
+	for i := 0; i < 2; i++ {
+		if resp := srv.CallAPI(t, key, "/api/shop/orders?snapshot=true", `{}`); resp.StatusCode != http.StatusOK {
+			t.Fatalf("snapshot %d: %d", i+2, resp.StatusCode)
+		}
+	}
+	resp = srv.CallAPI(t, key, "/api/shop/orders?snapshot=true", `{}`)
+	body, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusTooManyRequests || !strings.Contains(string(body), `"code":"snapshot_limit"`) {
+		t.Errorf("snapshot over the per-key limit: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestQueryLifecycleAPI(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, _ := env.CreateAPIKey(user.ID)
+	conn := env.CreateSQLiteConnection("shop",
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY)`,
+		`INSERT INTO orders VALUES (1)`)
+	env.CreateQuery("orders-v2", "SELECT id FROM orders", conn.ID)
+	q := env.CreateQuery("orders", "SELECT id FROM orders", conn.ID)
+
+	yesterday := time.Now().AddDate(0, 0, -1)
+	nextMonth := time.Now().AddDate(0, 1, 0)
+	q.DeprecatedAt, q.SunsetAt, q.SupersededBy = &yesterday, &nextMonth, "orders-v2"
+	if err := env.Queries.Update(q); err != nil {
+		t.Fatal(err)
+	}
+	resp := srv.CallAPI(t, key, "/api/shop/orders", `{}`)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"deprecated"`) {
+		t.Fatalf("deprecated query: %d %s", resp.StatusCode, body)
+	}
+	if got, want := resp.Header.Get("Deprecation"), "@"+strconv.FormatInt(yesterday.Unix(), 10); got != want {
+		t.Errorf("Deprecation = %q, want %q", got, want)
+	}
+	if resp.Header.Get("Sunset") != nextMonth.UTC().Format(http.TimeFormat) {
+		t.Errorf("Sunset = %q", resp.Header.Get("Sunset"))
+	}
+	if got := resp.Header.Get("Link"); got != `</api/shop/orders-v2>; rel="successor-version"` {
+		t.Errorf("Link = %q", got)
+	}
+
+	q.SunsetAt = &yesterday
+	if err := env.Queries.Update(q); err != nil {
+		t.Fatal(err)
+	}
+	resp = srv.CallAPI(t, key, "/api/shop/orders", `{}`)
+	var gone map[string]string
+	json.NewDecoder(resp.Body).Decode(&gone)
+	if resp.StatusCode != http.StatusGone || gone["code"] != "query_sunset" || gone["superseded_by"] != "orders-v2" {
+		t.Errorf("sunset query: %d %v", resp.StatusCode, gone)
+	}
+}
+
+func TestRenamedQueryAPI(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, _ := env.CreateAPIKey(user.ID)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER)`)
+	q := env.CreateQuery("orders", "SELECT id FROM orders", conn.ID)
+	client := srv.SignIn(t, "admin", "s3cret")
+	save := func(method, path, slug string) (int, string) {
+		t.Helper()
+		body := fmt.Sprintf(`{"slug": %q, "sql_text": "SELECT id FROM orders", "is_active": true, "allowed_connection_ids": [%d]}`, slug, conn.ID)
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	queryPath := "/api/admin/queries/" + strconv.FormatInt(q.ID, 10)
+	if status, body := save("PUT", queryPath, "order-list"); status != http.StatusOK {
+		t.Fatalf("rename: %d %s", status, body)
+	}
+
+	resp := srv.CallAPI(t, key, "/api/shop/orders", `{}`)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Deprecation") == "" ||
+		resp.Header.Get("Link") != `</api/shop/order-list>; rel="successor-version"` {
+		t.Errorf("old slug: %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp := srv.CallAPI(t, key, "/api/shop/order-list", `{}`); resp.StatusCode != http.StatusOK || resp.Header.Get("Deprecation") != "" {
+		t.Errorf("new slug: %d %v", resp.StatusCode, resp.Header)
+	}
+	if status, body := save("POST", "/api/admin/queries", "orders"); status != http.StatusUnprocessableEntity || !strings.Contains(body, "orders-2") {
+		t.Errorf("new query on the old slug: %d %s, want 422 suggesting orders-2", status, body)
+	}
+
+	resp, err := client.PostForm(srv.URL+"/admin/queries/"+strconv.FormatInt(q.ID, 10)+"/aliases/retire", url.Values{"alias": {"orders"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp := srv.CallAPI(t, key, "/api/shop/orders", `{}`); resp.StatusCode == http.StatusOK {
+		t.Error("retired slug still answers")
+	}
+	if status, body := save("POST", "/api/admin/queries", "orders"); status != http.StatusCreated {
+		t.Errorf("new query on the retired slug: %d %s", status, body)
+	}
+}
+
+func TestAccessEvents(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, _ := env.CreateAPIKey(user.ID)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER)`)
+	env.CreateQuery("orders", "SELECT id FROM orders", conn.ID)
+
+	srv.CallAPI(t, key, "/api/shop/orders", `{}`)
+	srv.CallAPI(t, "dbb_not-a-real-key", "/api/shop/orders", `{}`)
+	srv.CallAPI(t, key, "/api/shop/orders/export/nope", `{}`)
+	srv.Access.Close()
+
+	events, err := env.Access.List(core.AccessEventFilter{}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("events = %+v, want the bad key and the unknown route only", events)
+	}
+	notFound, badKey := events[0], events[1]
+	if badKey.Status != http.StatusUnauthorized || badKey.KeyPrefix != "dbb_not-" || badKey.Code != "unauthorized" ||
+		badKey.Message != "Invalid X-API-Key" || badKey.Path != "/api/shop/orders" || badKey.ClientIP == "" {
+		t.Errorf("bad key event = %+v", badKey)
+	}
+	if notFound.Status != http.StatusNotFound || notFound.Code != "not_found" || notFound.KeyPrefix != key[:8] {
+		t.Errorf("unknown route event = %+v", notFound)
+	}
+
+	client := srv.SignIn(t, "admin", "s3cret")
+	resp, err := client.Get(srv.URL + "/admin/logs/access?status=4xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("access events page: %d", resp.StatusCode)
+	}
+}
+
+func TestConnectionHeatmap(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, _ := env.CreateAPIKey(user.ID)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER)`)
+	env.CreateQuery("orders", "SELECT id FROM orders", conn.ID)
+	for i := 0; i < 3; i++ {
+		srv.CallAPI(t, key, "/api/shop/orders", `{}`)
+	}
+	client := srv.SignIn(t, "admin", "s3cret")
+	path := srv.URL + "/admin/stats/connections/" + strconv.FormatInt(conn.ID, 10) + "/heatmap"
+
+	resp, err := client.Get(path + "?weeks=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var heatmap struct {
+		Total      int64      `json:"total"`
+		Executions [][]int64  `json:"executions"`
+		Days       []struct{} `json:"days"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&heatmap); err != nil {
+		t.Fatal(err)
+	}
+	var cells int64
+	for _, day := range heatmap.Executions {
+		for _, n := range day {
+			cells += n
+		}
+	}
+	if resp.StatusCode != http.StatusOK || heatmap.Total != 3 || cells != 3 || len(heatmap.Executions) != 7 || len(heatmap.Days) != 14 {
+		t.Errorf("heatmap: %d %+v", resp.StatusCode, heatmap)
+	}
+
+	if resp, err := client.Get(path + "?weeks=100"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("weeks=100: %v %v, want 400", resp.StatusCode, err)
+	}
+}
+
+func TestParamSourcesAPI(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, _ := env.CreateAPIKey(user.ID)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER, tenant TEXT, status TEXT);
+		INSERT INTO orders VALUES (1, 'acme', 'open'), (2, 'acme', 'paid'), (2, 'other', 'open')`)
+	q := env.CreateQuery("orders", "SELECT id, status FROM orders WHERE id = {id} AND tenant = {tenant} AND status = {status:open}", conn.ID)
+	q.ParamsConfig = `{"id": {"type": "integer", "in": "path"}, "tenant": {"in": "header", "header": "X-Tenant"}, "status": {"in": "query"}}`
+	if err := env.Queries.Update(q); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(path, body string) (int, []map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set("X-Tenant", "acme")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out.Data
+	}
+	// The header and path win over the body
+	if status, rows := call("/api/shop/orders/2?status=paid", `{"tenant": "other", "id": 1}`); status != http.StatusOK || len(rows) != 1 || rows[0]["status"] != "paid" {
+		t.Errorf("sourced params: %d %v, want the paid order 2 of acme", status, rows)
+	}
+	if status, rows := call("/api/shop/orders/1", `{}`); status != http.StatusOK || len(rows) != 1 {
+		t.Errorf("default status: %d %v", status, rows)
+	}
+	other := env.CreateQuery("all-orders", "SELECT id FROM orders", conn.ID)
+	if status, _ := call("/api/shop/"+other.Slug+"/1", `{}`); status != http.StatusNotFound {
+		t.Errorf("path segment on a query without a path param = %d, want 404", status)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/docs/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+		} `json:"paths"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		t.Fatal(err)
+	}
+	op, ok := spec.Paths["/api/shop/orders/{id}"]["post"]
+	if !ok {
+		t.Fatalf("no path parameter in the spec paths: %v", spec.Paths)
+	}
+	in := map[string]string{}
+	for _, p := range op.Parameters {
+		in[p.Name] = p.In
+	}
+	if in["id"] != "path" || in["X-Tenant"] != "header" || in["status"] != "query" {
+		t.Errorf("spec parameters = %v", in)
+	}
+}
+
+func TestDisabledDriverConnections(t *testing.T) {
+	srv := testutil.NewTestServer(t) // SQLite is the only enabled driver
+	env := srv.Env
+	env.CreateUser("admin", "s3cret")
+	client := srv.SignIn(t, "admin", "s3cret")
+	save := func(form url.Values) {
+		t.Helper()
+		resp, err := client.PostForm(srv.URL+"/admin/connections/save", form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	save(url.Values{"name": {"pg"}, "driver": {"postgres"}, "connection_string": {"host=db.local user=app"}})
+	if _, err := env.Connections.GetByName("pg"); err == nil {
+		t.Error("new connection on a disabled driver was saved")
+	}
+	save(url.Values{"name": {"files"}, "driver": {"sqlite"}, "connection_string": {testutil.MemoryDSN("files")}})
+	if _, err := env.Connections.GetByName("files"); err != nil {
+		t.Errorf("new sqlite connection not saved: %v", err)
+	}
+
+	// Connections saved before the driver was disabled can still be edited
+	legacy := env.CreateConnection("legacy", "postgres", "host=db.local user=app")
+	save(url.Values{"id": {strconv.FormatInt(legacy.ID, 10)}, "name": {"legacy"}, "driver": {"postgres"},
+		"environment": {"prod"}})
+	if c, err := env.Connections.GetByID(legacy.ID); err != nil || c.Environment != "prod" {
+		t.Errorf("edit of a connection on a disabled driver: %+v, %v", c, err)
+	}
+}
+
+func TestEmbedTokenAPI(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	env.CreateUser("admin", "s3cret")
+	client := srv.SignIn(t, "admin", "s3cret")
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER PRIMARY KEY, region TEXT)`,
+		`INSERT INTO orders (region) VALUES ('EU'), ('EU'), ('EU'), ('US')`)
+	q := env.CreateQuery("orders", "SELECT id, region FROM orders WHERE region = {region} ORDER BY id", conn.ID)
+
+	resp, err := client.PostForm(fmt.Sprintf("%s/admin/queries/%d/embeds", srv.URL, q.ID), url.Values{
+		"embed_connection_id": {strconv.FormatInt(conn.ID, 10)},
+		"embed_label":         {"EU orders"},
+		"embed_row_cap":       {"2"},
+		"embed_params":        {`{"region": "EU"}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	tokens, _ := env.Embeds.ListByQuery(q.ID)
+	if len(tokens) != 1 || tokens[0].RowCap != 2 || tokens[0].Label != "EU orders" {
+		t.Fatalf("tokens = %+v", tokens)
+	}
+	embed := srv.URL + "/embed/" + service.NewEmbedService(env.Embeds, srv.Executor, testutil.Key).Token(&tokens[0])
+
+	get := func(u string, json bool) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", u, nil)
+		if json {
+			req.Header.Set("Accept", "application/json")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// The token fixes the parameters; the URL's are ignored
+	resp = get(embed+"?region=US", true)
+	var body struct {
+		Columns []string                 `json:"columns"`
+		Data    []map[string]interface{} `json:"data"`
+		Capped  bool                     `json:"capped"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || len(body.Data) != 2 || body.Data[0]["region"] != "EU" || !body.Capped {
+		t.Errorf("embed JSON = %d %+v", resp.StatusCode, body)
+	}
+	if resp = get(embed, false); resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Security-Policy") == "" {
+		t.Errorf("embed page = %d, CSP %q", resp.StatusCode, resp.Header.Get("Content-Security-Policy"))
+	}
+	if resp = get(embed+"x", false); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("tampered token = %d, want 404", resp.StatusCode)
+	}
+
+	resp, err = client.PostForm(fmt.Sprintf("%s/admin/queries/%d/embeds/%d/revoke", srv.URL, q.ID, tokens[0].ID), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp = get(embed, true); resp.StatusCode != http.StatusGone {
+		t.Errorf("revoked token = %d, want 410", resp.StatusCode)
+	}
+	logs, _ := env.Audit.GetRecent(1)
+	if len(logs) != 1 || logs[0].Mode != "embed" || logs[0].ErrorMessage == "" {
+		t.Errorf("audit entry of the revoked hit = %+v", logs)
+	}
+}
+
+func TestResponseSchemaCapture(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, _ := env.CreateAPIKey(user.ID)
+	client := srv.SignIn(t, "admin", "s3cret")
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER PRIMARY KEY, total REAL, placed_at DATETIME)`,
+		`INSERT INTO orders (total, placed_at) VALUES (9.5, '2026-01-02 10:00:00')`)
+	q := env.CreateQuery("orders", "SELECT id, total, placed_at FROM orders", conn.ID)
+
+	resp, err := client.PostForm(fmt.Sprintf("%s/admin/queries/%d/schema", srv.URL, q.ID), url.Values{
+		"action": {"capture"}, "schema_connection_id": {strconv.FormatInt(conn.ID, 10)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(srv.URL + "/api/docs/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema struct {
+						Properties struct {
+							Data struct {
+								Items struct {
+									Properties map[string]struct {
+										Type   string `json:"type"`
+										Format string `json:"format"`
+									} `json:"properties"`
+								} `json:"items"`
+							} `json:"data"`
+						} `json:"properties"`
+					} `json:"schema"`
+				} `json:"content"`
+			} `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		t.Fatal(err)
+	}
+	props := spec.Paths["/api/shop/orders"]["post"].Responses["200"].Content["application/json"].Schema.Properties.Data.Items.Properties
+	if props["id"].Type != "integer" || props["total"].Type != "number" || props["placed_at"].Format != "date-time" {
+		t.Errorf("row properties = %+v", props)
+	}
+
+	// A column added since the capture is a drift
+	q.SQLText = "SELECT id, total, placed_at, 1 AS extra FROM orders"
+	if err := env.Queries.Update(q); err != nil {
+		t.Fatal(err)
+	}
+	resp = srv.CallAPI(t, key, "/api/shop/orders", `{}`)
+	var body struct {
+		Warnings []string `json:"warnings"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if !slices.Contains(body.Warnings, "schema_drift") {
+		t.Errorf("warnings = %v, want schema_drift", body.Warnings)
+	}
+}
+
+func TestProtectedConnectionTestRun(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	env.CreateUser("admin", "s3cret")
+	client := srv.SignIn(t, "admin", "s3cret")
+	conn := env.CreateSQLiteConnection("prod", `CREATE TABLE orders (id INTEGER PRIMARY KEY)`,
+		`INSERT INTO orders (id) WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 150) SELECT i FROM n`)
+	conn.Protected = true
+	if err := env.Connections.Update(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(sqlText, confirm string) (int, map[string]interface{}) {
+		t.Helper()
+		body, _ := json.Marshal(map[string]interface{}{"connection_id": conn.ID, "sql_text": sqlText, "confirm_connection": confirm})
+		resp, err := client.Post(srv.URL+"/admin/queries/run", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	lastEvent := func() core.AuditLog {
+		t.Helper()
+		logs, _ := env.Audit.GetRecent(1)
+		if len(logs) != 1 {
+			t.Fatal("no audit entry")
+		}
+		return logs[0]
+	}
+
+	status, out := run("SELECT id FROM orders", "")
+	if data, _ := out["data"].([]interface{}); status != http.StatusOK || len(data) != 100 {
+		t.Errorf("read: status %d, %d rows, want the guardrail's 100", status, len(data))
+	}
+	if status, out = run("DELETE FROM orders", ""); status != http.StatusForbidden || out["code"] != "confirm_connection" {
+		t.Errorf("write: status %d, %v, want a name confirmation", status, out)
+	}
+	if status, _ = run("DELETE FROM orders WHERE id > 140", "prd"); status != http.StatusForbidden {
+		t.Errorf("wrong name: status %d", status)
+	}
+	if ev := lastEvent(); ev.EventType != core.EventConnectionGuardOverride || ev.Status != service.DeniedStatus {
+		t.Errorf("wrong name audited as %s %s", ev.EventType, ev.Status)
+	}
+	if status, out = run("DELETE FROM orders WHERE id > 140", "prod"); status != http.StatusOK {
+		t.Errorf("confirmed write: status %d, %v", status, out)
+	}
+	if ev := lastEvent(); ev.EventType != "" {
+		t.Errorf("latest entry %s, want the write's execution", ev.EventType)
+	}
+	logs, _ := env.Audit.GetRecent(2)
+	if ev := logs[1]; ev.EventType != core.EventConnectionGuardOverride || ev.Status != service.AdminStatus ||
+		!strings.Contains(ev.Params, "DELETE FROM orders") {
+		t.Errorf("override audited as %+v", ev)
+	}
+	if _, out = run("SELECT COUNT(*) AS n FROM orders", ""); fmt.Sprint(out["data"]) != "[map[n:140]]" {
+		t.Errorf("rows after the confirmed write = %v", out["data"])
+	}
+	// The name only unlocks writes: the row cap still applies
+	status, out = run("SELECT id FROM orders", "prod")
+	if data, _ := out["data"].([]interface{}); status != http.StatusOK || len(data) != 100 {
+		t.Errorf("confirmed read: status %d, %d rows, want the guardrail's 100", status, len(data))
+	}
+}
+
+func TestOpenAPISpecCache(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	env.CreateUser("admin", "s3cret")
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER PRIMARY KEY)`)
+	env.CreateQuery("orders", "SELECT id FROM orders", conn.ID)
+
+	get := func(etag string) (int, string, string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL+"/api/docs/openapi.json", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("ETag"), string(body)
+	}
+	// Edits rebuild the spec in the background, so it is polled for them
+	await := func(what string, done func(body string) bool) string {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if _, etag, body := get(""); done(body) {
+				return etag
+			}
+		}
+		t.Fatalf("the spec never showed %s", what)
+		return ""
+	}
+
+	status, etag, body := get("")
+	if status != http.StatusOK || etag == "" || !strings.Contains(body, "/api/shop/orders") {
+		t.Fatalf("spec = %d, ETag %q", status, etag)
+	}
+	if status, again, body := get(etag); status != http.StatusNotModified || again != etag || body != "" {
+		t.Errorf("revalidation = %d, ETag %q, %d bytes; want 304", status, again, len(body))
+	}
+
+	q := env.CreateQuery("customers", "SELECT 1 AS id", conn.ID)
+	created := await("the new query", func(body string) bool { return strings.Contains(body, "/api/shop/customers") })
+	if created == etag {
+		t.Error("the ETag did not change with the spec")
+	}
+	if status, _, _ := get(etag); status != http.StatusOK {
+		t.Errorf("revalidating the old ETag = %d, want 200", status)
+	}
+
+	q.Description = "Customers by region"
+	if err := env.Queries.Update(q); err != nil {
+		t.Fatal(err)
+	}
+	await("the edited description", func(body string) bool { return strings.Contains(body, "Customers by region") })
+	if err := env.Queries.Delete(q.ID); err != nil {
+		t.Fatal(err)
+	}
+	await("the query deleted", func(body string) bool { return !strings.Contains(body, "/api/shop/customers") })
+	conn.IsActive = false
+	if err := env.Connections.Update(conn); err != nil {
+		t.Fatal(err)
+	}
+	await("the connection deactivated", func(body string) bool { return !strings.Contains(body, "/api/shop/orders") })
+
+	client := srv.SignIn(t, "admin", "s3cret")
+	resp, err := client.PostForm(srv.URL+"/admin/docs/rebuild", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	logs, _ := env.Audit.GetRecent(1)
+	if len(logs) != 1 || logs[0].EventType != core.EventDocsRebuild || logs[0].Status != service.AdminStatus {
+		t.Errorf("rebuild audited as %+v", logs)
+	}
+}
+
+func TestChaosEndpoints(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, _ := env.CreateAPIKey(user.ID)
+	conn := env.CreateSQLiteConnection("erp")
+
+	// Off unless CHAOS_MODE is set, and never part of the public API
+	if resp, _ := srv.SignIn(t, "admin", "s3cret").Get(srv.URL + "/admin/debug/chaos"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("without CHAOS_MODE = %d, want 404", resp.StatusCode)
+	}
+	if resp := srv.CallAPI(t, key, "/api/admin/debug/chaos", `{"connection_id": 1, "fail_pings": 1}`); resp.StatusCode == http.StatusOK {
+		t.Error("faults set through the API")
+	}
+
+	chaos := service.NewChaos()
+	r := chi.NewRouter()
+	api.NewChaosHandler(chaos).RegisterRoutes(r)
+	do := func(method, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/debug/chaos", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := fmt.Sprintf(`{"connection_id": %d, "fail_pings": 3, "latency_ms": 20}`, conn.ID)
+	if rec := do("POST", "application/x-www-form-urlencoded", body); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("form post = %d, want 415", rec.Code)
+	}
+	if rec := do("POST", "application/json", `{"connection_id": 1, "latency_ms": -5}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative latency = %d, want 400", rec.Code)
+	}
+	if rec := do("POST", "application/json", body); rec.Code != http.StatusOK {
+		t.Fatalf("set fault = %d: %s", rec.Code, rec.Body)
+	}
+	if faults := chaos.Faults(); len(faults) != 1 || faults[0].FailPings != 3 || faults[0].LatencyMs != 20 {
+		t.Errorf("faults = %+v", faults)
+	}
+	var listed struct{ Faults []service.ChaosFault }
+	json.NewDecoder(do("GET", "", "").Body).Decode(&listed)
+	if len(listed.Faults) != 1 || listed.Faults[0].ConnectionID != conn.ID {
+		t.Errorf("listed faults = %+v", listed.Faults)
+	}
+	do("DELETE", "", "")
+	if faults := chaos.Faults(); len(faults) != 0 {
+		t.Errorf("faults after reset = %+v", faults)
+	}
+}
+
+func TestQueryImpact(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	env.CreateUser("admin", "s3cret")
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER)`)
+	q := env.CreateQuery("orders", "SELECT id FROM orders", conn.ID)
+	boundary := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	for i := 0; i < 25; i++ {
+		before := core.AuditLog{Timestamp: boundary.Add(-time.Duration(i+1) * time.Minute), ConnectionID: conn.ID, QueryID: q.ID, DurationMs: 10, Status: "SUCCESS"}
+		after := core.AuditLog{Timestamp: boundary.Add(time.Duration(i+1) * time.Minute), ConnectionID: conn.ID, QueryID: q.ID, DurationMs: 30, Status: "SUCCESS"}
+		if i < 5 {
+			after.Status = "ERROR"
+		}
+		env.Audit.Create(&before)
+		env.Audit.Create(&after)
+	}
+	client := srv.SignIn(t, "admin", "s3cret")
+	path := fmt.Sprintf("%s/admin/queries/%d/impact", srv.URL, q.ID)
+
+	resp, err := client.Get(path + "?window=6h&at=" + url.QueryEscape(boundary.Format(time.RFC3339)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var impact service.QueryImpact
+	json.NewDecoder(resp.Body).Decode(&impact)
+	if resp.StatusCode != http.StatusOK || !impact.Enough || impact.Window != "6h" ||
+		impact.Before.Executions != 25 || impact.After.Errors != 5 || impact.After.ErrorRate != 20 ||
+		impact.ErrorRateChange != 20 || impact.P95ChangeMs != 20 {
+		t.Errorf("impact: %d %+v", resp.StatusCode, impact)
+	}
+
+	// The last edit is the default boundary, with nothing run since
+	resp, err = client.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	impact = service.QueryImpact{}
+	json.NewDecoder(resp.Body).Decode(&impact)
+	if resp.StatusCode != http.StatusOK || impact.Enough || impact.After.Executions != 0 {
+		t.Errorf("since the last edit: %d %+v, want not enough data", resp.StatusCode, impact)
+	}
+	if resp, err := client.Get(path + "?window=90d"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("window=90d: %v %v, want 400", resp.StatusCode, err)
+	}
+}
+
+func TestDailyQuota(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, apiKey := env.CreateAPIKey(user.ID)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER)`)
+	env.CreateQuery("orders", "SELECT id FROM orders", conn.ID)
+	if err := srv.Settings.Update(user.ID, []service.SettingChange{{Key: "API_DAILY_QUOTA", Value: "3"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two requests were used before a restart
+	day := time.Now().Format("2006-01-02")
+	if err := env.Quota.Add([]core.QuotaUsage{{ApiKeyID: apiKey.ID, Day: day, Requests: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Quota.Load(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := srv.CallAPI(t, key, "/api/shop/orders", `{}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("last request of the day = %d", resp.StatusCode)
+	}
+	resp := srv.CallAPI(t, key, "/api/shop/orders", `{}`)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("past the quota = %d, want 429", resp.StatusCode)
+	}
+	retry, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if retry < 1 || retry > 24*60*60 {
+		t.Errorf("Retry-After = %q, want the seconds until midnight", resp.Header.Get("Retry-After"))
+	}
+	var body struct{ Code string }
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body.Code != "quota_exceeded" {
+		t.Errorf("code = %q", body.Code)
+	}
+
+	srv.Quota.Close()
+	if counts, _ := env.Quota.Day(day); counts[apiKey.ID] != 3 {
+		t.Errorf("stored requests = %d, want 3", counts[apiKey.ID])
+	}
+}
+
+func TestResponseEnvelope(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, apiKey := env.CreateAPIKey(user.ID)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER); INSERT INTO orders VALUES (1)`)
+	env.CreateQuery("orders", "SELECT id FROM orders", conn.ID)
+
+	call := func(path, accept string) (string, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(`{}`))
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set("Content-Type", "application/json")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: %d %v", path, resp.StatusCode, body)
+		}
+		return resp.Header.Get("X-DbBridge-Envelope"), body
+	}
+
+	if envelope, body := call("/api/shop/orders", ""); envelope != "v2" || body["meta"] == nil {
+		t.Errorf("new key: %s %v, want v2", envelope, body)
+	}
+
+	// The admin switches the key to v1 on the API keys page
+	client := srv.SignIn(t, "admin", "s3cret")
+	resp, err := client.PostForm(srv.URL+"/admin/api-keys/envelope", url.Values{"id": {strconv.FormatInt(apiKey.ID, 10)}, "envelope": {"v1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("set envelope = %d", resp.StatusCode)
+	}
+	if logs, _ := env.Audit.ListRecent(10, "api_key", 0, 0); len(logs) != 1 || logs[0].EventType != core.EventAPIKeyEnvelope {
+		t.Errorf("audited %+v, want the envelope change", logs)
+	}
+
+	envelope, body := call("/api/shop/orders", "")
+	if envelope != "v1" || body["success"] != true || body["meta"] != nil {
+		t.Errorf("v1 key: %s %v", envelope, body)
+	}
+	if data, _ := body["data"].([]interface{}); len(data) != 1 {
+		t.Errorf("v1 data = %v", body["data"])
+	}
+	if envelope, body := call("/api/v2/shop/orders", ""); envelope != "v2" || body["meta"] == nil {
+		t.Errorf("/api/v2 on a v1 key: %s %v", envelope, body)
+	}
+	if envelope, _ := call("/api/shop/orders", "application/json; profile=v2"); envelope != "v2" {
+		t.Errorf("Accept profile=v2 on a v1 key: %s", envelope)
+	}
+}
+
+func TestReenableInactiveKey(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	key, apiKey := env.CreateAPIKey(user.ID)
+	_, revoked := env.CreateAPIKey(user.ID)
+	env.APIKeys.Revoke(revoked.ID)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER)`)
+	env.CreateQuery("orders", "SELECT id FROM orders", conn.ID)
+
+	janitor := service.NewInactiveKeyJanitor(env.APIKeys, env.Audit, func() bool { return true }, func() int { return 90 })
+	if disabled, err := janitor.Disable(time.Now().AddDate(0, 0, 91)); err != nil || len(disabled) != 1 {
+		t.Fatalf("disabled %+v, %v; want the unused key", disabled, err)
+	}
+	if resp := srv.CallAPI(t, key, "/api/shop/orders", `{}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("auto-disabled key = %d, want 401", resp.StatusCode)
+	}
+
+	client := srv.SignIn(t, "admin", "s3cret")
+	reenable := func(id int64) {
+		t.Helper()
+		resp, err := client.PostForm(srv.URL+"/admin/api-keys/reenable", url.Values{"id": {strconv.FormatInt(id, 10)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	reenable(revoked.ID)
+	reenable(apiKey.ID)
+
+	keys, _ := env.APIKeys.List()
+	for _, k := range keys {
+		switch k.ID {
+		case revoked.ID:
+			if k.IsActive {
+				t.Error("a revoked key was re-enabled")
+			}
+		case apiKey.ID:
+			if !k.IsActive || k.DisabledReason != "" || k.ReenabledAt == nil {
+				t.Errorf("re-enabled key = %+v", k)
+			}
+		}
+	}
+	if resp := srv.CallAPI(t, key, "/api/shop/orders", `{}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("re-enabled key = %d, want 200", resp.StatusCode)
+	}
+	logs, _ := env.Audit.ListRecent(10, "api_key", 0, 0)
+	var events []string
+	for _, l := range logs {
+		events = append(events, l.EventType)
+	}
+	if got := strings.Join(events, ","); got != "api_key.reenable,api_key.auto_disable" {
+		t.Errorf("audited %s", got)
+	}
+}
+
+func TestPasswordChangeFromBcrypt(t *testing.T) {
+	srv := testutil.NewTestServer(t)
+	env := srv.Env
+	user := env.CreateUser("admin", "s3cret")
+	client := srv.SignIn(t, "admin", "s3cret")
+
+	// A hash from before Argon2id, as if the account had not signed in since
+	legacy, err := service.BcryptHasher{Cost: bcrypt.MinCost}.Hash("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.PasswordHash = legacy
+	if err := env.Users.Update(user); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.PostForm(srv.URL+"/admin/profile", url.Values{
+		"current_password": {"s3cret"}, "new_password": {"n3w-secret"}, "confirm_password": {"n3w-secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	stored, _ := env.Users.GetUserByUsername("admin")
+	if !strings.HasPrefix(stored.PasswordHash, "$argon2id$") {
+		t.Fatalf("hash after the change = %q, want argon2id", stored.PasswordHash)
+	}
+	if _, err := env.Auth.Authenticate("admin", "n3w-secret"); err != nil {
+		t.Errorf("new password refused: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"dbbridge/internal/service"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AuditForwardHandler shows the audit sink configuration and delivery status.
+// forwarder is nil when AUDIT_SINK is not set.
+type AuditForwardHandler struct {
+	templates *Templates
+	forwarder *service.AuditForwarder
+}
+
+func NewAuditForwardHandler(templates *Templates, forwarder *service.AuditForwarder) *AuditForwardHandler {
+	return &AuditForwardHandler{
+		templates: templates,
+		forwarder: forwarder,
+	}
+}
+
+func (h *AuditForwardHandler) StatusPage(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{
+		"Title":   "Audit Forwarding",
+		"Enabled": h.forwarder != nil,
+	}
+	if h.forwarder != nil {
+		data["Status"] = h.forwarder.Status()
+	}
+	h.templates.Page(w, r, "audit_forwarding.html", data)
+}
+
+func (h *AuditForwardHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/admin/audit-forwarding", h.StatusPage)
+}
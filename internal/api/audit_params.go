@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// auditParamLimit is how many characters of a parameter value the audit
+// pages show; GET /admin/logs/{id}/params has the rest
+const auditParamLimit = 200
+
+// auditParam is a parameter of an audit entry as shown on the audit pages
+type auditParam struct {
+	Name      string // "" for params that are not a JSON object
+	Value     string
+	Truncated bool
+}
+
+// formatAuditParams parses the params JSON of an audit entry into its
+// parameters by name. Strings show unquoted; arrays, such as the values of
+// an IN list, and objects are indented. Values are cut at limit characters,
+// limit 0 keeping them whole. Params that do not parse show as one value.
+func formatAuditParams(raw string, limit int) []auditParam {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &values); err != nil || values == nil {
+		if strings.TrimSpace(raw) == "" {
+			return nil
+		}
+		return []auditParam{truncateParam("", raw, limit)}
+	}
+	params := make([]auditParam, 0, len(values))
+	for name, v := range values {
+		params = append(params, truncateParam(name, paramValueText(v), limit))
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return params
+}
+
+func paramValueText(v json.RawMessage) string {
+	var s string
+	if json.Unmarshal(v, &s) == nil {
+		return s
+	}
+	var value interface{}
+	if json.Unmarshal(v, &value) != nil {
+		return string(v)
+	}
+	switch value.(type) {
+	case []interface{}, map[string]interface{}:
+		b, _ := json.MarshalIndent(value, "", "  ")
+		return string(b)
+	}
+	return string(v)
+}
+
+func truncateParam(name, value string, limit int) auditParam {
+	p := auditParam{Name: name, Value: value}
+	if runes := []rune(value); limit > 0 && len(runes) > limit {
+		p.Value, p.Truncated = string(runes[:limit])+"…", true
+	}
+	return p
+}
+
+// AuditEntryParams serves the parameters of the {id} audit entry whole, as
+// plain text: the ?name parameter's value, or every parameter
+func (h *WebHandler) AuditEntryParams(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	entry, err := h.auditRepo.GetByID(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	params := formatAuditParams(entry.Params, 0)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.URL.Query().Has("name") {
+		for _, p := range params {
+			if p.Name == r.URL.Query().Get("name") {
+				w.Write([]byte(p.Value))
+				return
+			}
+		}
+		http.NotFound(w, r)
+		return
+	}
+	var b strings.Builder
+	for _, p := range params {
+		if p.Name != "" {
+			b.WriteString(p.Name + ": ")
+		}
+		b.WriteString(p.Value + "\n")
+	}
+	w.Write([]byte(b.String()))
+}
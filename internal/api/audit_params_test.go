@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/sessions"
+)
+
+func TestFormatAuditParams(t *testing.T) {
+	params := formatAuditParams(`{"status": "open", "ids": [1, 2], "note": "abcdefghijklmnopqrstu"}`, 20)
+	if len(params) != 3 || params[0].Name != "ids" || params[1].Name != "note" || params[2].Name != "status" {
+		t.Fatalf("params = %+v, want ids, note, status", params)
+	}
+	if params[0].Value != "[\n  1,\n  2\n]" || params[0].Truncated {
+		t.Errorf("array = %q, want it indented", params[0].Value)
+	}
+	if params[1].Value != "abcdefghijklmnopqrst…" || !params[1].Truncated {
+		t.Errorf("long value = %q, want it cut at 20", params[1].Value)
+	}
+	if params[2].Value != "open" {
+		t.Errorf("string = %q, want it unquoted", params[2].Value)
+	}
+	if p := formatAuditParams("not json", 0); len(p) != 1 || p[0].Name != "" || p[0].Value != "not json" {
+		t.Errorf("raw params = %+v", p)
+	}
+	if p := formatAuditParams("", 0); p != nil {
+		t.Errorf("empty params = %+v, want none", p)
+	}
+}
+
+func TestAuditParamsPages(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	tmpl, err := NewTemplates("../../web/templates/*.html", templateFuncs(nil, nil), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit := data.NewAuditRepo(db)
+	h := &WebHandler{auditRepo: audit, userRepo: data.NewUserRepo(db), templates: tmpl, sessionStore: store}
+
+	long := strings.Repeat("x", auditParamLimit+50)
+	entry := &core.AuditLog{Timestamp: time.Now(), Status: "SUCCESS", QueryID: 1, ConnectionID: 1,
+		Params: `{"name": "<script>alert(1)</script>", "blob": "` + long + `"}`}
+	if err := audit.Create(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.HandleAuditLogs(w, httptest.NewRequest("GET", "/admin/logs", nil))
+	body := w.Body.String()
+	if strings.Contains(body, "<script>alert") || !strings.Contains(body, "&lt;script&gt;") {
+		t.Error("audit log page does not escape parameter values")
+	}
+	if strings.Contains(body, long) {
+		t.Error("audit log page shows a long value whole")
+	}
+
+	params := func(query string) (int, string) {
+		req := httptest.NewRequest("GET", "/admin/logs/1/params"+query, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", strconv.FormatInt(entry.ID, 10))
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		h.AuditEntryParams(w, req)
+		return w.Code, w.Body.String()
+	}
+	if status, body := params("?name=blob"); status != http.StatusOK || body != long {
+		t.Errorf("full value = %d %q", status, body)
+	}
+	if status, body := params(""); status != http.StatusOK || !strings.Contains(body, "name: <script>") {
+		t.Errorf("all params = %d %q", status, body)
+	}
+	if status, _ := params("?name=missing"); status != http.StatusNotFound {
+		t.Errorf("unknown param = %d, want 404", status)
+	}
+}
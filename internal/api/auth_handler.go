@@ -1,8 +1,9 @@
 package api
 
 import (
+	"context"
+	"dbbridge/internal/core"
 	"dbbridge/internal/service"
-	"html/template"
 	"net/http"
 
 	"github.com/gorilla/sessions"
@@ -11,10 +12,16 @@ import (
 type AuthHandler struct {
 	authSvc   *service.AuthService
 	store     *sessions.CookieStore
-	templates *template.Template
+	templates *Templates
+	events    *service.AdminAuditor // nil = sign-ins are not audited
 }
 
-func NewAuthHandler(authSvc *service.AuthService, sessionKey string, templates *template.Template) *AuthHandler {
+// SetAuditor records setup, sign-ins and sign-outs as admin events
+func (h *AuthHandler) SetAuditor(a *service.AdminAuditor) {
+	h.events = a
+}
+
+func NewAuthHandler(authSvc *service.AuthService, sessionKey string, templates *Templates) *AuthHandler {
 	// Use DBBRIDGE_KEY for session encryption too
 	store := sessions.NewCookieStore([]byte(sessionKey))
 	store.Options = &sessions.Options{
@@ -31,26 +38,67 @@ func NewAuthHandler(authSvc *service.AuthService, sessionKey string, templates *
 	}
 }
 
-func (h *AuthHandler) SetupPage(w http.ResponseWriter, r *http.Request) {
-	hasUsers, _ := h.authSvc.HasUsers()
-	if hasUsers {
+// Root sends visitors to the first page that applies: setup on a fresh
+// install, login without a session, otherwise the dashboard
+func (h *AuthHandler) Root(w http.ResponseWriter, r *http.Request) {
+	hasUsers, err := h.authSvc.HasUsers()
+	switch {
+	case err != nil:
+		http.Error(w, "Failed to check setup state", http.StatusInternalServerError)
+	case !hasUsers:
+		http.Redirect(w, r, "/setup", http.StatusFound)
+	case !h.HasAdminSession(r):
 		http.Redirect(w, r, "/login", http.StatusFound)
+	default:
+		http.Redirect(w, r, "/admin", http.StatusFound)
+	}
+}
+
+// setupDone answers 404 once the first admin exists, since setup is then
+// gone for good, and reports whether it answered the request
+func (h *AuthHandler) setupDone(w http.ResponseWriter, r *http.Request) bool {
+	hasUsers, err := h.authSvc.HasUsers()
+	if err != nil {
+		http.Error(w, "Failed to check setup state", http.StatusInternalServerError)
+		return true
+	}
+	if hasUsers {
+		http.NotFound(w, r)
+	}
+	return hasUsers
+}
+
+func (h *AuthHandler) SetupPage(w http.ResponseWriter, r *http.Request) {
+	if h.setupDone(w, r) {
 		return
 	}
-	h.render(w, "setup.html", nil)
+	h.render(w, r, "setup.html", nil)
 }
 
 func (h *AuthHandler) DoSetup(w http.ResponseWriter, r *http.Request) {
+	if h.setupDone(w, r) {
+		return
+	}
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 
 	err := h.authSvc.SetupAdmin(username, password)
 	if err != nil {
-		h.render(w, "setup.html", map[string]interface{}{"Error": err.Error()})
+		h.render(w, r, "setup.html", map[string]interface{}{"Error": err.Error()})
 		return
 	}
+	h.events.Record(service.AdminEvent{Type: core.EventUserCreate, Target: "user " + username, ClientIP: extractIP(r),
+		Changes: service.AuditChanges{"username": {New: username}}})
 
-	http.Redirect(w, r, "/login", http.StatusFound)
+	// The new admin is signed in and continues with the setup wizard
+	user, err := h.authSvc.Authenticate(username, password)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	h.events.Record(service.AdminEvent{Type: core.EventLogin, UserID: user.ID, Target: "user " + user.Username, ClientIP: extractIP(r)})
+	h.startSession(w, r, user, map[interface{}]interface{}{wizardKey: true})
+	http.Redirect(w, r, "/admin/welcome", http.StatusFound)
 }
 
 func (h *AuthHandler) LoginPage(w http.ResponseWriter, r *http.Request) {
@@ -59,7 +107,7 @@ func (h *AuthHandler) LoginPage(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/setup", http.StatusFound)
 		return
 	}
-	h.render(w, "login.html", nil)
+	h.render(w, r, "login.html", nil)
 }
 
 func (h *AuthHandler) DoLogin(w http.ResponseWriter, r *http.Request) {
@@ -68,26 +116,55 @@ func (h *AuthHandler) DoLogin(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.authSvc.Authenticate(username, password)
 	if err != nil {
-		h.render(w, "login.html", map[string]interface{}{"Error": "Invalid username or password"})
+		h.events.Record(service.AdminEvent{Type: core.EventLogin, Target: "user " + username, ClientIP: extractIP(r),
+			Denied: true, Error: "invalid username or password"})
+		h.render(w, r, "login.html", map[string]interface{}{"Error": h.templates.T(r, "login.invalid")})
 		return
 	}
+	h.events.Record(service.AdminEvent{Type: core.EventLogin, UserID: user.ID, Target: "user " + user.Username, ClientIP: extractIP(r)})
 
-	// Set Session
+	h.startSession(w, r, user, nil)
+	http.Redirect(w, r, "/admin", http.StatusFound)
+}
+
+// startSession signs user in, with extra session values if any
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, user *core.User, extra map[interface{}]interface{}) {
 	session, _ := h.store.Get(r, "dbbridge-session")
 	session.Values["user_id"] = user.ID
 	session.Values["username"] = user.Username
+	session.Values["locale"] = user.Locale
+	session.Values["role"] = RoleAdmin
+	for k, v := range extra {
+		session.Values[k] = v
+	}
 	session.Save(r, w)
-
-	http.Redirect(w, r, "/admin", http.StatusFound)
 }
 
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.store.Get(r, "dbbridge-session")
+	if userID, ok := session.Values["user_id"].(int64); ok && userID != 0 {
+		username, _ := session.Values["username"].(string)
+		h.events.Record(service.AdminEvent{Type: core.EventLogout, UserID: userID, Target: "user " + username, ClientIP: extractIP(r)})
+	}
 	session.Options.MaxAge = -1
 	session.Save(r, w)
 	http.Redirect(w, r, "/login", http.StatusFound)
 }
 
+// HasAdminSession reports whether the request carries a logged-in admin session
+func (h *AuthHandler) HasAdminSession(r *http.Request) bool {
+	session, _ := h.store.Get(r, "dbbridge-session")
+	userID, ok := session.Values["user_id"].(int64)
+	return ok && userID != 0
+}
+
+// SessionUserID returns the logged-in admin's user ID, 0 without a session
+func (h *AuthHandler) SessionUserID(r *http.Request) int64 {
+	session, _ := h.store.Get(r, "dbbridge-session")
+	userID, _ := session.Values["user_id"].(int64)
+	return userID
+}
+
 // Middleware to protect admin routes
 func (h *AuthHandler) AdminMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -98,7 +175,8 @@ func (h *AuthHandler) AdminMiddleware(next http.Handler) http.Handler {
 		// }
 
 		session, _ := h.store.Get(r, "dbbridge-session")
-		if auth, ok := session.Values["user_id"].(int64); !ok || auth == 0 {
+		userID, ok := session.Values["user_id"].(int64)
+		if !ok || userID == 0 {
 			// Check if setup is needed
 			hasUsers, _ := h.authSvc.HasUsers()
 			if !hasUsers && r.URL.Path != "/setup" {
@@ -110,18 +188,20 @@ func (h *AuthHandler) AdminMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		// Test runs from the admin UI are audited under the signed-in user
+		ctx := context.WithValue(r.Context(), core.ContextKeyUserID, userID)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (h *AuthHandler) render(w http.ResponseWriter, tmplName string, data interface{}) {
+func (h *AuthHandler) render(w http.ResponseWriter, r *http.Request, tmplName string, data interface{}) {
 	if h.templates == nil {
 		http.Error(w, "AuthTemplates not loaded", http.StatusInternalServerError)
 		return
 	}
 
 	// Create a new template executor for these standalone pages if not part of main layout
-	err := h.templates.ExecuteTemplate(w, tmplName, data)
+	err := h.templates.Render(w, r, tmplName, data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
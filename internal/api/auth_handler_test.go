@@ -0,0 +1,62 @@
+package api
+
+import (
+	"dbbridge/internal/data"
+	"dbbridge/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthHandlerRootAndSetup(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	authSvc := service.NewAuthService(data.NewUserRepo(db), data.NewApiKeyRepo(db))
+	h := NewAuthHandler(authSvc, "0123456789abcdef0123456789abcdef", nil)
+
+	get := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		switch path {
+		case "/":
+			h.Root(w, req)
+		case "/setup":
+			h.SetupPage(w, req)
+		}
+		return w
+	}
+	expectRedirect := func(name string, w *httptest.ResponseRecorder, to string) {
+		t.Helper()
+		if w.Code != http.StatusFound || w.Header().Get("Location") != to {
+			t.Errorf("%s: %d -> %q, want redirect to %s", name, w.Code, w.Header().Get("Location"), to)
+		}
+	}
+
+	expectRedirect("fresh install", get("/"), "/setup")
+
+	if err := authSvc.SetupAdmin("admin", "secret-password"); err != nil {
+		t.Fatal(err)
+	}
+	expectRedirect("no session", get("/"), "/login")
+	if w := get("/setup"); w.Code != http.StatusNotFound {
+		t.Errorf("setup after completion = %d, want 404", w.Code)
+	}
+
+	// Sign in the way DoLogin does
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	session, _ := h.store.Get(req, "dbbridge-session")
+	session.Values["user_id"] = int64(1)
+	session.Values["username"] = "admin"
+	if err := session.Save(req, rec); err != nil {
+		t.Fatal(err)
+	}
+	expectRedirect("signed in", get("/", rec.Result().Cookies()...), "/admin")
+}
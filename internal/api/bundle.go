@@ -0,0 +1,223 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"dbbridge/internal/config"
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of a zip bundle: entries per request and executions run at once
+const (
+	maxBundleEntries  = 50
+	bundleConcurrency = 4
+)
+
+// bundleEntry is one query result of a zip bundle
+type bundleEntry struct {
+	Connection string                 `json:"connection"`
+	Query      string                 `json:"query"`
+	Params     map[string]interface{} `json:"params"`
+	Format     string                 `json:"format"` // a registered output format; default json
+}
+
+// validateBundle checks entries and fills in the default format
+func validateBundle(entries []bundleEntry) error {
+	if len(entries) == 0 {
+		return fmt.Errorf("no entries")
+	}
+	if len(entries) > maxBundleEntries {
+		return fmt.Errorf("too many entries: %d (at most %d)", len(entries), maxBundleEntries)
+	}
+	for i := range entries {
+		e := &entries[i]
+		if e.Connection == "" || e.Query == "" {
+			return fmt.Errorf("entry %d: connection and query are required", i+1)
+		}
+		e.Format = strings.ToLower(e.Format)
+		if e.Format == "" {
+			e.Format = "json"
+		}
+		if formatByName(e.Format) == nil {
+			return fmt.Errorf("entry %d: %w", i+1, &FormatError{Requested: strconv.Quote(e.Format)})
+		}
+	}
+	return nil
+}
+
+// writeBundle runs the entries, bundleConcurrency at a time, and streams a
+// zip with a <slug>.<ext> file per entry. A failed entry becomes a
+// <slug>.error.txt file, as do the entries past maxBytes of results.
+// Executions audit as usual; MAX_ROWS bounds each result.
+func writeBundle(ctx context.Context, w http.ResponseWriter, exec *service.QueryExecutor, settings *service.SettingsService, entries []bundleEntry, maxBytes int64) {
+	type outcome struct {
+		data []byte
+		err  error
+	}
+	results := make([]chan outcome, len(entries))
+	sem := make(chan struct{}, bundleConcurrency)
+	for i, e := range entries {
+		results[i] = make(chan outcome, 1)
+		go func(e bundleEntry, out chan<- outcome) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			data, err := runBundleEntry(ctx, exec, settings, e)
+			out <- outcome{data, err}
+		}(e, results[i])
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="bundle-%s.zip"`, time.Now().Format("20060102-150405")))
+	zw := zip.NewWriter(w)
+	defer zw.Close()
+
+	names := make(map[string]bool)
+	var total int64
+	for i, e := range entries {
+		res := <-results[i]
+		if res.err == nil && total+int64(len(res.data)) > maxBytes {
+			res.err = fmt.Errorf("skipped: the bundle reached its size limit of %d MB", maxBytes>>20)
+		}
+		ext, content := e.Format, res.data
+		if res.err != nil {
+			ext, content = "error.txt", []byte(service.ErrorDetail(res.err)+"\n")
+		} else {
+			total += int64(len(res.data))
+		}
+		f, err := zw.Create(bundleFileName(names, core.Slugify(e.Query), ext))
+		if err != nil {
+			return
+		}
+		if _, err := f.Write(content); err != nil {
+			return // the client went away
+		}
+		if fl, ok := w.(http.Flusher); ok {
+			zw.Flush()
+			fl.Flush()
+		}
+	}
+}
+
+// bundleFileName returns <slug>.<ext>, numbered when the bundle already has it
+func bundleFileName(names map[string]bool, slug, ext string) string {
+	name := slug + "." + ext
+	for n := 2; names[name]; n++ {
+		name = fmt.Sprintf("%s-%d.%s", slug, n, ext)
+	}
+	names[name] = true
+	return name
+}
+
+// runBundleEntry executes an entry and encodes its result in the entry's format
+func runBundleEntry(ctx context.Context, exec *service.QueryExecutor, settings *service.SettingsService, e bundleEntry) ([]byte, error) {
+	if settings != nil {
+		if m := settings.Maintenance(); m.Blocks(e.Connection) {
+			return nil, fmt.Errorf("%s", m.Message)
+		}
+	}
+	params := e.Params
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+	result, err := exec.ExecuteByName(ctx, e.Connection, e.Query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := newBufferedResponse()
+	formatByName(e.Format).Write(buf, result)
+	if buf.status != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(buf.body.Bytes(), &body)
+		return nil, fmt.Errorf("%s", body.Error)
+	}
+	return buf.body.Bytes(), nil
+}
+
+// encodeCSV writes the flat rows with a header of the column names. NULLs are
+// empty fields; shaping and result modes only apply to JSON.
+func encodeCSV(w io.Writer, result *service.ExecutionResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(result.Meta.Columns); err != nil {
+		return err
+	}
+	keys := result.Meta.RowKeys()
+	record := make([]string, len(keys))
+	for _, row := range result.Data {
+		for i, key := range keys {
+			record[i] = ""
+			if v := row[key]; v != nil {
+				record[i] = textValue(v)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// bundleMaxBytes is the BUNDLE_MAX_MB setting in bytes
+func bundleMaxBytes(settings *service.SettingsService, cfg *config.Config) int64 {
+	mb := cfg.BundleMaxMB
+	if settings != nil {
+		mb = settings.Int("BUNDLE_MAX_MB")
+	}
+	return int64(max(mb, 1)) << 20
+}
+
+// Bundle answers POST /api/bundle {"entries": [{"connection", "query",
+// "params", "format"}, ...]} with a zip of the results, see writeBundle
+func (h *Handler) Bundle(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Entries []bundleEntry `json:"entries"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateBundle(req.Entries); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeBundle(r.Context(), w, h.executor, h.settings, req.Entries, bundleMaxBytes(h.settings, h.config.Get()))
+}
+
+// BundlePage shows the admin form for downloading a zip bundle of results
+func (h *WebHandler) BundlePage(w http.ResponseWriter, r *http.Request) {
+	conns, _ := h.connRepo.GetAll()
+	queries, _ := h.queryRepo.GetAll()
+	h.render(w, r, "bundle.html", map[string]interface{}{
+		"Title":       "Download Bundle",
+		"Connections": conns,
+		"Queries":     queries,
+	})
+}
+
+// DownloadBundle streams the zip bundle of the posted entries, a JSON list
+// in the entries form field
+func (h *WebHandler) DownloadBundle(w http.ResponseWriter, r *http.Request) {
+	var entries []bundleEntry
+	err := json.Unmarshal([]byte(r.FormValue("entries")), &entries)
+	if err == nil {
+		err = validateBundle(entries)
+	}
+	if err != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.bundle_invalid", err.Error()))
+		http.Redirect(w, r, "/admin/bundle", http.StatusFound)
+		return
+	}
+	writeBundle(r.Context(), w, h.executor, h.settings, entries, bundleMaxBytes(h.settings, h.config.Get()))
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"bytes"
+	"dbbridge/internal/service"
+	"testing"
+)
+
+func TestValidateBundle(t *testing.T) {
+	entries := []bundleEntry{{Connection: "main", Query: "orders"}, {Connection: "main", Query: "users", Format: "CSV"}}
+	if err := validateBundle(entries); err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Format != "json" || entries[1].Format != "csv" {
+		t.Errorf("formats = %q, %q, want json, csv", entries[0].Format, entries[1].Format)
+	}
+
+	for _, bad := range [][]bundleEntry{
+		nil,
+		{{Connection: "main"}},
+		{{Connection: "main", Query: "orders", Format: "xlsx"}},
+		make([]bundleEntry, maxBundleEntries+1),
+	} {
+		if err := validateBundle(bad); err == nil {
+			t.Errorf("validateBundle(%d entries) accepted", len(bad))
+		}
+	}
+}
+
+func TestBundleFileName(t *testing.T) {
+	names := make(map[string]bool)
+	for _, want := range []string{"orders.csv", "orders-2.csv", "orders.json", "orders-3.csv"} {
+		ext := "csv"
+		if want == "orders.json" {
+			ext = "json"
+		}
+		if got := bundleFileName(names, "orders", ext); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestEncodeCSV(t *testing.T) {
+	result := &service.ExecutionResult{
+		Meta: service.MetaInfo{Columns: []string{"id", "note"}},
+		Data: []map[string]interface{}{
+			{"id": int64(1), "note": "a, \"b\""},
+			{"id": int64(2), "note": nil},
+		},
+	}
+	var buf bytes.Buffer
+	if err := encodeCSV(&buf, result); err != nil {
+		t.Fatal(err)
+	}
+	want := "id,note\n1,\"a, \"\"b\"\"\"\n2,\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"dbbridge/internal/logger"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ChaosHandler configures the faults injected into connections for
+// resilience testing. Routes are only registered when CHAOS_MODE=true and
+// must sit behind AdminMiddleware; the public API never reaches them.
+type ChaosHandler struct {
+	chaos *service.Chaos
+}
+
+func NewChaosHandler(chaos *service.Chaos) *ChaosHandler {
+	return &ChaosHandler{chaos: chaos}
+}
+
+// ListFaults returns the injected faults as JSON
+func (h *ChaosHandler) ListFaults(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"faults": h.chaos.Faults()})
+}
+
+// SetFault replaces a connection's fault, given as a JSON service.ChaosFault.
+// A fault injecting nothing clears it.
+func (h *ChaosHandler) SetFault(w http.ResponseWriter, r *http.Request) {
+	// A JSON body cannot be posted cross-site without a preflight
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+	var f service.ChaosFault
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := h.chaos.Set(f); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	logger.Info.Printf("Chaos: connection %d fault set to %+v", f.ConnectionID, f)
+	h.ListFaults(w, r)
+}
+
+// ResetFaults clears every fault
+func (h *ChaosHandler) ResetFaults(w http.ResponseWriter, r *http.Request) {
+	h.chaos.Reset()
+	logger.Info.Println("Chaos: faults cleared")
+	h.ListFaults(w, r)
+}
+
+// RegisterRoutes mounts the fault endpoints under /admin/debug/chaos
+func (h *ChaosHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/admin/debug/chaos", h.ListFaults)
+	r.Post("/admin/debug/chaos", h.SetFault)
+	r.Delete("/admin/debug/chaos", h.ResetFaults)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"dbbridge/internal/config"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// trustedProxies holds the parsed TRUSTED_PROXIES list, swapped on config reload
+var trustedProxies atomic.Pointer[[]*net.IPNet]
+
+// ApplyTrustedProxies updates the peers whose forwarding headers are believed
+func ApplyTrustedProxies(cfg *config.Config) {
+	nets, _ := config.ParseCIDRList(cfg.TrustedProxies)
+	trustedProxies.Store(&nets)
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	nets := trustedProxies.Load()
+	if nets == nil || ip == nil {
+		return false
+	}
+	for _, n := range *nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractIP gets the client IP from the request. Forwarding headers are only
+// honoured when the direct peer is a trusted proxy; X-Forwarded-For is walked
+// from the right so a client cannot prepend a spoofed address.
+func extractIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !isTrustedProxy(net.ParseIP(remote)) {
+		return remote
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			ip := net.ParseIP(hop)
+			if ip == nil {
+				break
+			}
+			if !isTrustedProxy(ip) || i == 0 {
+				return hop
+			}
+		}
+	}
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(xri) != nil {
+		return xri
+	}
+	return remote
+}
+
+// splitCIDRs splits a stored comma/whitespace separated allowlist
+func splitCIDRs(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+}
+
+// ipAllowed reports whether ip falls in one of the ranges. An empty list allows everything.
+func ipAllowed(ip string, cidrs []*net.IPNet) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, c := range cidrs {
+		if c.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"dbbridge/internal/config"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtractIP(t *testing.T) {
+	ApplyTrustedProxies(&config.Config{TrustedProxies: []string{"10.0.0.0/8"}})
+	defer ApplyTrustedProxies(&config.Config{})
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"direct client", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"untrusted peer cannot spoof", "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:5000", "198.51.100.1", "198.51.100.1"},
+		{"prepended spoof ignored", "10.0.0.2:5000", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:5000", "198.51.100.1, 10.0.0.3", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := extractIP(r); got != tt.want {
+				t.Errorf("extractIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPAllowed(t *testing.T) {
+	nets, err := config.ParseCIDRList(splitCIDRs("192.168.1.0/24, 203.0.113.9"))
+	if err != nil {
+		t.Fatalf("ParseCIDRList() error = %v", err)
+	}
+	if !ipAllowed("192.168.1.50", nets) || !ipAllowed("203.0.113.9", nets) {
+		t.Errorf("ip inside allowlist rejected")
+	}
+	if ipAllowed("203.0.113.10", nets) {
+		t.Errorf("ip outside allowlist allowed")
+	}
+	if !ipAllowed("203.0.113.10", nil) {
+		t.Errorf("empty allowlist must allow everything")
+	}
+}
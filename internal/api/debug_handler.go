@@ -0,0 +1,102 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// processStart is used to report uptime in the runtime stats
+var processStart = time.Now()
+
+// DebugHandler exposes pprof profiles and runtime stats for diagnosing production issues.
+// Routes are only registered when DEBUG_ENDPOINTS=true and must sit behind AdminMiddleware.
+type DebugHandler struct {
+	db        *sql.DB
+	templates *Templates
+}
+
+func NewDebugHandler(db *sql.DB, templates *Templates) *DebugHandler {
+	return &DebugHandler{
+		db:        db,
+		templates: templates,
+	}
+}
+
+// DebugPage renders the admin page linking to the profiles
+func (h *DebugHandler) DebugPage(w http.ResponseWriter, r *http.Request) {
+	h.templates.Page(w, r, "debug.html", map[string]interface{}{
+		"Title": "Debug",
+	})
+}
+
+// RuntimeStats returns goroutine, heap, GC and metadata DB pool stats as JSON
+func (h *DebugHandler) RuntimeStats(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	var lastGC string
+	if mem.LastGC > 0 {
+		lastGC = time.Unix(0, int64(mem.LastGC)).Format(time.RFC3339)
+	}
+
+	stats := map[string]interface{}{
+		"go_version":     runtime.Version(),
+		"num_cpu":        runtime.NumCPU(),
+		"goroutines":     runtime.NumGoroutine(),
+		"uptime_seconds": int64(time.Since(processStart).Seconds()),
+		"heap": map[string]interface{}{
+			"alloc_bytes":       mem.HeapAlloc,
+			"sys_bytes":         mem.HeapSys,
+			"idle_bytes":        mem.HeapIdle,
+			"inuse_bytes":       mem.HeapInuse,
+			"objects":           mem.HeapObjects,
+			"total_alloc_bytes": mem.TotalAlloc,
+			"sys_total_bytes":   mem.Sys,
+		},
+		"gc": map[string]interface{}{
+			"num_gc":         mem.NumGC,
+			"pause_total_ns": mem.PauseTotalNs,
+			"last_gc":        lastGC,
+			"next_gc_bytes":  mem.NextGC,
+		},
+	}
+
+	if h.db != nil {
+		dbStats := h.db.Stats()
+		stats["metadata_db_pool"] = map[string]interface{}{
+			"open_connections": dbStats.OpenConnections,
+			"in_use":           dbStats.InUse,
+			"idle":             dbStats.Idle,
+			"wait_count":       dbStats.WaitCount,
+			"wait_duration_ms": dbStats.WaitDuration.Milliseconds(),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// RegisterRoutes mounts the debug endpoints under /admin/debug
+func (h *DebugHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/admin/debug", h.DebugPage)
+	r.Get("/admin/debug/stats", h.RuntimeStats)
+	r.Get("/admin/debug/vars", expvar.Handler().ServeHTTP)
+
+	// pprof.Index only resolves named profiles under /debug/pprof/, so map them explicitly
+	r.Get("/admin/debug/pprof/", pprof.Index)
+	r.Get("/admin/debug/pprof/cmdline", pprof.Cmdline)
+	r.Get("/admin/debug/pprof/profile", pprof.Profile)
+	r.Get("/admin/debug/pprof/symbol", pprof.Symbol)
+	r.Post("/admin/debug/pprof/symbol", pprof.Symbol)
+	r.Get("/admin/debug/pprof/trace", pprof.Trace)
+	r.Get("/admin/debug/pprof/{profile}", func(w http.ResponseWriter, r *http.Request) {
+		pprof.Handler(chi.URLParam(r, "profile")).ServeHTTP(w, r)
+	})
+}
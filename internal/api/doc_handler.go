@@ -1,26 +1,58 @@
 package api
 
 import (
+	"bytes"
+	"dbbridge/internal/buildinfo"
+	"dbbridge/internal/config"
 	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"dbbridge/internal/service"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 type DocHandler struct {
-	queryRepo core.QueryRepository
-	connRepo  core.ConnectionRepository
-	parser    *core.SQLParser
+	queryRepo  core.QueryRepository
+	connRepo   core.ConnectionRepository
+	config     *config.Store
+	templates  *Templates          // per-query pages, nil = not served
+	generation *service.Generation // nil = the spec is built on every request
+
+	mu       sync.Mutex
+	specs    map[specVariant]*cachedSpec
+	building map[specVariant]bool
 }
 
-func NewDocHandler(queryRepo core.QueryRepository, connRepo core.ConnectionRepository) *DocHandler {
+func NewDocHandler(queryRepo core.QueryRepository, connRepo core.ConnectionRepository, cfgStore *config.Store) *DocHandler {
 	return &DocHandler{
 		queryRepo: queryRepo,
 		connRepo:  connRepo,
-		parser:    core.NewSQLParser(),
+		config:    cfgStore,
+		specs:     make(map[specVariant]*cachedSpec),
+		building:  make(map[specVariant]bool),
+	}
+}
+
+// SetTemplates enables the per-query documentation pages
+func (h *DocHandler) SetTemplates(t *Templates) {
+	h.templates = t
+}
+
+// baseURL returns BASE_URL when configured, otherwise the URL the request came in on
+func baseURL(cfgStore *config.Store, r *http.Request) string {
+	if base := cfgStore.Get().BaseURL; base != "" {
+		return base
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
 	}
+	return scheme + "://" + r.Host
 }
 
 func (h *DocHandler) ServeSwaggerUI(w http.ResponseWriter, r *http.Request) {
@@ -51,21 +83,56 @@ func (h *DocHandler) ServeSwaggerUI(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(html))
 }
 
+// GetOpenAPISpec answers the OpenAPI spec of the active queries, from the
+// spec cache when there is one, with an ETag so clients revalidate for free
 func (h *DocHandler) GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
-	queries, err := h.queryRepo.GetAll()
+	spec, err := h.spec(specVariant{groupByEnv: r.URL.Query().Get("group") == "environment", base: baseURL(h.config, r)})
 	if err != nil {
-		http.Error(w, "Failed to list queries", http.StatusInternalServerError)
+		logger.Error.Printf("OpenAPI spec: %v", err)
+		http.Error(w, "Failed to build the API docs", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", spec.etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), spec.etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec.body)
+}
+
+// buildSpec builds the OpenAPI spec of a variant from the repositories
+func (h *DocHandler) buildSpec(v specVariant) ([]byte, error) {
+	queries, err := h.queryRepo.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queries: %w", err)
+	}
 
 	connections, err := h.connRepo.GetAll()
 	if err != nil {
-		http.Error(w, "Failed to list connections", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to list connections: %w", err)
+	}
+
+	// With ?group=environment, a query's connection in an environment is
+	// documented as /api/env/{environment}/{slug}, tagged by the environment,
+	// when it is the query's only connection there
+	groupByEnv := v.groupByEnv
+	envConns := make(map[string]int) // environment/slug -> active connections
+	for _, conn := range connections {
+		if !conn.IsActive || conn.Environment == "" {
+			continue
+		}
+		for _, q := range queries {
+			if allowsConnection(&q, conn.ID) {
+				envConns[conn.Environment+"/"+q.Slug]++
+			}
+		}
 	}
 
 	// Build Paths
 	paths := make(map[string]interface{})
+	now := time.Now()
 
 	for _, conn := range connections {
 		if !conn.IsActive {
@@ -75,6 +142,13 @@ func (h *DocHandler) GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 		// Group by Connection Name (Tag)
 		connSlug := core.Slugify(conn.Name)
 
+		// Connection strings stay encrypted here, so an ODBC connection without
+		// an explicit dialect is documented with the generic syntax
+		dialect, err := core.DialectFor(conn.Dialect, conn.Driver, "")
+		if err != nil {
+			dialect = &core.GenericDialect{}
+		}
+
 		for _, q := range queries {
 			// Check if query is allowed for this connection
 			allowed := false
@@ -89,9 +163,11 @@ func (h *DocHandler) GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 			}
 
 			pathKey := fmt.Sprintf("/api/%s/%s", connSlug, q.Slug)
-
-			// Parse Params
-			parseRes := h.parser.Parse(q.SQLText, nil)
+			tag := conn.Name
+			if groupByEnv && envConns[conn.Environment+"/"+q.Slug] == 1 {
+				pathKey = fmt.Sprintf("/api/env/%s/%s", conn.Environment, q.Slug)
+				tag = conn.Environment
+			}
 
 			properties := make(map[string]interface{})
 			exampleBody := make(map[string]interface{})
@@ -110,24 +186,42 @@ func (h *DocHandler) GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 				hasOrderBy = true
 			}
 
-			for _, param := range parseRes.ParamNames {
-				// Exclude system variables: pagination, select, endselect, order_by
-				lower := strings.ToLower(param)
-				if lower == "pagination" || lower == "select" || lower == "endselect" || lower == "order_by" {
-					if lower == "pagination" {
-						hasPagination = true
+			// Parameters from the SQL, typed and described by the params_config;
+			// those not taken from the body are parameter objects
+			var required []string
+			var sourced []map[string]interface{}
+			for _, p := range service.QueryParams(&q) {
+				switch p.Name {
+				case "page", "per_page", "order_by", "order_direction":
+					continue // documented below
+				}
+				if p.In != "" {
+					sourced = append(sourced, paramObject(p))
+					if p.In == service.ParamInPath {
+						pathKey += "/{" + p.Name + "}"
 					}
 					continue
 				}
+				properties[p.Name] = paramSchema(p)
+				exampleBody[p.Name] = p.Sample()
+				if p.Required {
+					required = append(required, p.Name)
+				}
+			}
 
-				properties[param] = map[string]string{"type": "string"}
-				exampleBody[param] = "value"
+			bodySchema := map[string]interface{}{"type": "object", "properties": properties}
+			if len(required) > 0 {
+				bodySchema["required"] = required
 			}
 
 			// Add Pagination params if {pagination} is present
 			if hasPagination {
 				properties["page"] = map[string]interface{}{"type": "integer", "default": 1}
-				properties["per_page"] = map[string]interface{}{"type": "integer", "default": 50}
+				properties["per_page"] = map[string]interface{}{
+					"type":        "integer",
+					"default":     50,
+					"description": fmt.Sprintf("Rows per page, applied as `%s` for page 1 (%s dialect)", dialect.PaginationClause(50, 0), dialect.Name()),
+				}
 			}
 
 			// Add Order By params if {order_by} is present
@@ -138,18 +232,109 @@ func (h *DocHandler) GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 				exampleBody["order_direction"] = "asc"
 			}
 
+			// The shape of data depends on the query's shaping config and result
+			// mode, its columns on the captured response schema, if any
+			rowSchema := map[string]interface{}{"type": "object"}
+			captured, _ := service.ParseResponseSchema(q.ResponseSchema)
+			var columns map[string]interface{}
+			if captured != nil {
+				columns = captured.Properties()
+				rowSchema = capturedRowSchema(captured, columns)
+			}
+			if shape, err := service.ParseShapeConfig(q.ShapeConfig); err == nil && shape != nil {
+				rowSchema = shapedRowSchema(shape, columns)
+			}
+			dataSchema := map[string]interface{}{
+				"type":        "array",
+				"description": "Array of result rows",
+				"items":       rowSchema,
+			}
+			canBeEmpty := false // object/scalar queries answer 404 when there are no rows
+			switch q.ResultMode {
+			case core.ResultModeObject:
+				dataSchema = rowSchema
+				if d, ok := rowSchema["description"].(string); ok && captured != nil {
+					dataSchema["description"] = "The first result row. " + d
+				} else {
+					dataSchema["description"] = "The first result row"
+				}
+				canBeEmpty = true
+			case core.ResultModeScalar:
+				dataSchema = map[string]interface{}{
+					"description": "First column of the first result row",
+					"nullable":    true,
+				}
+				if captured != nil && len(captured.Columns) > 0 {
+					if typ := captured.Columns[0].Type; typ != "" {
+						dataSchema["type"] = typ
+					}
+				}
+				canBeEmpty = true
+			}
+
+			// A response config adds headers and can answer an empty result
+			// with 204 or 404 in any result mode
+			headers := executionHeaders
+			emptyStatus := 0
+			if cfg, err := service.ParseResponseConfig(q.ResponseConfig); err == nil && cfg != nil {
+				emptyStatus = cfg.EmptyStatus
+				if len(cfg.Headers) > 0 {
+					headers = make(map[string]interface{}, len(executionHeaders)+len(cfg.Headers))
+					for name, h := range executionHeaders {
+						headers[name] = h
+					}
+					for name, value := range cfg.Headers {
+						headers[http.CanonicalHeaderKey(name)] = map[string]interface{}{
+							"description": "Set by the query's response config",
+							"schema":      map[string]interface{}{"type": "string", "example": value},
+						}
+					}
+				}
+			}
+
+			xmlRoot := q.XMLRoot
+			if xmlRoot == "" {
+				xmlRoot = defaultXMLRoot
+			}
+			xmlContent := map[string]interface{}{
+				"schema": map[string]interface{}{
+					"type":        "string",
+					"description": "With format=xml: <" + xmlRoot + "> holding one <row> per result row, NULLs as xsi:nil",
+				},
+				"example": "<" + xmlRoot + " xmlns:xsi=\"http://www.w3.org/2001/XMLSchema-instance\">\n  <row><id>1</id><note xsi:nil=\"true\"/></row>\n</" + xmlRoot + ">",
+			}
+
+			// A recorded test run replaces the generated request example
+			example, _ := service.ParseQueryExample(q.Example)
+			if example != nil {
+				exampleBody = example.Params
+			}
+
 			operation := map[string]interface{}{
 				"summary":     q.Slug,
 				"description": q.Description,
-				"tags":        []string{conn.Name},
+				"tags":        []string{tag},
+				"parameters": []map[string]interface{}{
+					{
+						"name":        "count_only",
+						"in":          "query",
+						"required":    false,
+						"description": "Return only `{\"count\": N}`, the number of rows the query matches (pagination ignored, no rows fetched)",
+						"schema":      map[string]interface{}{"type": "boolean", "default": false},
+					},
+					{
+						"name":        "format",
+						"in":          "query",
+						"required":    false,
+						"description": "Response format, taking precedence over the Accept header. `xml`, `csv` and `ndjson` return the flat rows (shaping and result mode apply to JSON only)",
+						"schema":      map[string]interface{}{"type": "string", "enum": formatNames(), "default": "json"},
+					},
+				},
 				"requestBody": map[string]interface{}{
 					"required": true,
 					"content": map[string]interface{}{
 						"application/json": map[string]interface{}{
-							"schema": map[string]interface{}{
-								"type":       "object",
-								"properties": properties,
-							},
+							"schema":  bodySchema,
 							"example": exampleBody,
 						},
 					},
@@ -157,17 +342,22 @@ func (h *DocHandler) GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 				"responses": map[string]interface{}{
 					"200": map[string]interface{}{
 						"description": "Successful execution",
+						"headers":     headers,
 						"content": map[string]interface{}{
+							"application/xml": xmlContent,
 							"application/json": map[string]interface{}{
 								"schema": map[string]interface{}{
 									"type": "object",
 									"properties": map[string]interface{}{
-										"data": map[string]interface{}{
+										"count": map[string]interface{}{
+											"type":        "integer",
+											"description": "Number of matching rows (only with count_only=true, replaces data and meta)",
+										},
+										"data": dataSchema,
+										"warnings": map[string]interface{}{
 											"type":        "array",
-											"description": "Array of result rows",
-											"items": map[string]interface{}{
-												"type": "object",
-											},
+											"description": "`truncated_to_first` when an object/scalar query matched more than one row; `slow_query` and `many_rows` when the execution exceeded a warning threshold; `duplicate_columns` when column names repeat (row keys become `id`, `id_2`, ...); `schema_drift` when the columns differ from the query's captured response schema",
+											"items":       map[string]string{"type": "string"},
 										},
 										"meta": map[string]interface{}{
 											"type":        "object",
@@ -248,11 +438,72 @@ func (h *DocHandler) GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 					"400": map[string]interface{}{
 						"description": "Bad Request - Invalid parameters or missing required fields",
 					},
+					"406": map[string]interface{}{
+						"description": "The requested format is not supported; `supported` lists the formats",
+					},
+					"409": map[string]interface{}{
+						"description": "The database rejected the statement on a constraint (`code` is `constraint_violation`)",
+					},
 					"500": map[string]interface{}{
-						"description": "Internal Server Error",
+						"description": "Internal Server Error; `code` is `syntax_error` when the database rejected the query's SQL",
+					},
+					"502": map[string]interface{}{
+						"description": "The database could not be reached (`code` is `connection_failed`)",
+					},
+					"504": map[string]interface{}{
+						"description": "The query timed out (`code` is `timeout`)",
 					},
 				},
 			}
+			switch {
+			case emptyStatus == http.StatusNoContent:
+				operation["responses"].(map[string]interface{})["204"] = map[string]interface{}{
+					"description": "Query returned no rows (no body)",
+				}
+			case canBeEmpty || emptyStatus == http.StatusNotFound:
+				operation["responses"].(map[string]interface{})["404"] = map[string]interface{}{
+					"description": "Query returned no rows",
+				}
+			}
+			if window, err := service.ParseExecWindow(q.ExecWindow); err == nil && window != nil {
+				operation["responses"].(map[string]interface{})["403"] = map[string]interface{}{
+					"description": fmt.Sprintf("Outside the execution window (%s); `Retry-After` gives the seconds until it opens",
+						strings.TrimSpace(window.Start+"-"+window.End+" "+window.Timezone)),
+				}
+			}
+			if q.Lifecycle(now) != core.LifecycleCurrent {
+				operation["deprecated"] = true
+			}
+			if q.SunsetAt != nil {
+				desc := "Retired on " + q.SunsetAt.Format(time.DateOnly) + " (`code` is `query_sunset`)"
+				if q.SupersededBy != "" {
+					desc += "; use `" + q.SupersededBy + "` instead"
+				}
+				operation["responses"].(map[string]interface{})["410"] = map[string]interface{}{"description": desc}
+			}
+
+			operation["parameters"] = append(operation["parameters"].([]map[string]interface{}), sourced...)
+			if core.IsWriteSQL(q.SQLText) {
+				operation["parameters"] = append(operation["parameters"].([]map[string]interface{}), map[string]interface{}{
+					"name":        headerIdempotencyKey,
+					"in":          "header",
+					"required":    false,
+					"description": "Runs the query once per key: retries with the same key get the stored response (with `Idempotent-Replayed: true`) for the IDEMPOTENCY_TTL_HOURS setting",
+					"schema":      map[string]interface{}{"type": "string", "maxLength": maxIdempotencyKeyLength},
+				})
+				responses := operation["responses"].(map[string]interface{})
+				responses["409"] = map[string]interface{}{
+					"description": "The database rejected the statement on a constraint (`code` is `constraint_violation`), or a request with the same Idempotency-Key is still running (`Retry-After` is set)",
+				}
+				responses["422"] = map[string]interface{}{
+					"description": "The Idempotency-Key was already used for a different request",
+				}
+			}
+
+			if example != nil {
+				content := operation["responses"].(map[string]interface{})["200"].(map[string]interface{})["content"].(map[string]interface{})
+				content["application/json"].(map[string]interface{})["example"] = map[string]interface{}{"data": example.Data}
+			}
 
 			paths[pathKey] = map[string]interface{}{
 				"post": operation,
@@ -264,11 +515,11 @@ func (h *DocHandler) GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 		"openapi": "3.0.0",
 		"info": map[string]interface{}{
 			"title":       "DbBridge API",
-			"version":     "1.0.0",
-			"description": "Dynamic API generated from Saved Queries.\n\n## Query Variables (in SQL)\n- `{param}` - Standard parameter\n- `{param:default}` - Parameter with default value\n- `{pagination}` or `{pagination:P:L}` - Pagination control\n- `{order_by:col(whitelist):dir}` - Dynamic sorting with whitelist validation\n- `{select}cols{endselect}` - Metadata block for total count\n- Arrays supported: `IN ({ids})` expands to `IN (?, ?, ?)`\n\n## API Parameters\n- `page` - Page number (requires {pagination} in query)\n- `per_page` - Items per page (requires {pagination} in query)\n- `order_by` - Column to sort by (requires {order_by} in query)\n- `order_direction` - Sort direction: `asc` or `desc` (requires {order_by} in query)\n\n## Response Fields\n- `data` - Array of result rows\n- `meta` - Pagination metadata (total, page, per_page, etc.)\n- `error` - Non-fatal error (e.g., COUNT query fails)\n- `debug_sql`, `debug_count_sql`, `debug_args` - Debug info (when DEBUG=true)\n\n## Reserved Parameter Names\nThe following names cannot be used as user-defined query parameters:\npage, per_page, order_by, order_direction",
+			"version":     buildinfo.Version,
+			"description": "Dynamic API generated from Saved Queries.\n\n## Query Variables (in SQL)\n- `{param}` - Standard parameter\n- `{param:default}` - Parameter with default value\n- `{pagination}` or `{pagination:P:L}` - Pagination control\n- `{order_by:col(whitelist):dir}` - Dynamic sorting with whitelist validation\n- `{select}cols{endselect}` - Metadata block for total count\n- Arrays supported: `IN ({ids})` expands to `IN (?, ?, ?)`\n\n## Parameter Precedence\nA parameter takes the first value set by the request, by the query's `{param:default}`, or by the connection's default parameters. Parameters come from the JSON body unless the query takes them from the URL query, a header or an extra path segment (`/api/{connectionName}/{querySlug}/{value}`), documented as such; those win over a body value of the same name. Parameters the connection forces always take the connection's value: request values for them are ignored and the response carries a `forced_params` warning\n\n## API Parameters\n- `page` - Page number (requires {pagination} in query)\n- `per_page` - Items per page (requires {pagination} in query)\n- `order_by` - Column to sort by (requires {order_by} in query)\n- `order_direction` - Sort direction: `asc` or `desc` (requires {order_by} in query)\n- `?count_only=true` (URL query) - Return `{count: N}` only, without fetching rows\n- `?format=xml|csv|ndjson` (URL query) - Return the flat rows in another format; without it the `Accept` header picks one (`application/xml`, `text/csv`, `application/x-ndjson`), and a format that is not supported answers 406\n\n## Response Fields\n- `data` - Array of result rows; the first row as an object for `object` queries, or its first column for `scalar` queries (404 when there are no rows)\n- `warnings` - `truncated_to_first` when an `object`/`scalar` query matched several rows; `slow_query` or `many_rows` when the execution exceeded a warning threshold but still succeeded; `duplicate_columns` when the result repeats a column name; `forced_params` when the request set a parameter its connection forces; `deprecated` when the query is deprecated; `schema_drift` when the columns differ from those documented for the query\n- `meta` - Pagination metadata (total, page, per_page, etc.); `meta.columns` keeps the original column names and `meta.keys` lists the deduplicated row keys (`id`, `id_2`) when names repeat\n- Row objects are documented with their columns and types when an admin captured the query's response schema from a sample run; the types are best-effort\n- `error` - Non-fatal error (e.g., COUNT query fails)\n- `debug_sql`, `debug_count_sql`, `debug_args` - Debug info (when DEBUG=true)\n\n## Response Envelopes\nThe fields above are the `v2` envelope. The `v1` envelope of older clients is `{\"success\": true, \"data\": ...}`, or `{\"success\": false, \"error\": ...}`. A request picks one with its path (`/api/v1/{connectionName}/{querySlug}`, also `/api/v2/...` and `/api/v1/env/...`) or the `profile` of its Accept header (`application/json; profile=v1`); otherwise the API key's default envelope applies. JSON responses name theirs in the `X-DbBridge-Envelope` header\n\n## Database Errors\nErrors the database reports are answered as JSON `{\"error\": ..., \"code\": ...}` with a cleaned message; `code` is one of `constraint_violation` (409), `permission_denied` (403), `syntax_error` (500), `timeout` (504) or `connection_failed` (502)\n\n## Response Headers\n- `X-DbBridge-Duration-Ms` - Server-side execution time in milliseconds\n- `X-DbBridge-Connection` - Connection the query ran on\n- `X-DbBridge-Rows` - Rows returned by the database (not sent with count_only)\n- `X-DbBridge-Warnings` - Warning thresholds exceeded, comma-separated\n- `X-DbBridge-Envelope` - `v1` or `v2`, the envelope of a JSON response\n\n## Environments\n`POST /api/env/{environment}/{querySlug}` runs a query on the one connection of its allowed list labelled with that environment (404 when there is none, 409 when there are several). `/api/docs/openapi.json?group=environment` documents these routes instead of the per-connection ones. A key scoped to connections or `env:NAME` environments gets 403 on any other connection\n\n## Idempotency\nQueries that write (INSERT, UPDATE, DELETE, MERGE, procedure calls) accept an `Idempotency-Key` header of up to 255 printable characters. The first request with a key runs the query and its response is stored for the API key for the IDEMPOTENCY_TTL_HOURS setting; retries with the same key get that response again with `Idempotent-Replayed: true` instead of running the query, 409 while the first request is still running, and 422 when the key was used for a different connection, query, format or parameters. Failed executions (5xx) are not stored and can be retried\n\n## Bundles\n`POST /api/bundle` with `{\"entries\": [{\"connection\": ..., \"query\": ..., \"params\": {...}, \"format\": \"csv\"}]}` (up to 50 entries; any format of `?format=`) answers with a zip holding one `<slug>.<format>` file per entry; a failed entry becomes `<slug>.error.txt`. The zip is capped by the BUNDLE_MAX_MB setting\n\n## Snapshot Paging\n`?snapshot=true` (URL query, optionally with `chunk_size`, default 100, up to 10000) runs the query once and keeps its whole result, so paging through a table that changes meanwhile has no duplicates or gaps. The response holds the first chunk with `meta.total`, `meta.offset`, `meta.expires_at` and `meta.next_token`; `GET /api/snapshots/{next_token}` answers the next chunk, and the same token always answers the same chunk, so retries are safe. `next_token` is left out on the last chunk. Tokens only work for the API key that opened the snapshot. A snapshot not read for the SNAPSHOT_IDLE_MINUTES setting expires: its tokens answer 410 with code `snapshot_expired`, and the client restarts paging without a token. Results over the SNAPSHOT_MAX_ROWS setting answer 422 with code `snapshot_too_large`. A key with SNAPSHOT_MAX_PER_KEY snapshots open gets 429 with code `snapshot_limit` for another, and 503 with that code is answered while SNAPSHOT_MAX_OPEN snapshots of all keys are open\n\n## Exports\n`POST /api/{connectionName}/{querySlug}/export?format=csv|ndjson` runs the query in the background with all its rows, writing them to a gzipped file, and answers 202 with the job; `GET /api/jobs/{id}` reports its status (`queued`, `running`, `done` or `failed`) and rows written, and `GET /api/jobs/{id}/download` serves the file (range requests resume interrupted downloads). Only the API key that started an export sees it, besides admin keys and signed-in admins. Files are deleted after the EXPORT_RETENTION_HOURS setting, and once all export files would exceed EXPORT_MAX_MB running exports fail and new ones are refused with 507\n\n## Admin API\nAdmin API keys (created by admins with an expiry date) call the admin JSON API instead of running queries: `GET /api/admin/connections`, `GET /api/admin/connections/{id}/heatmap?weeks=4` (executions and average duration by weekday and hour, and per day), `GET /api/admin/queries/{id}/impact?window=24h` (executions, error rate and duration percentiles before and after the query's last edit, or `at=`), `GET`/`POST /api/admin/queries` and `GET`/`PUT`/`DELETE /api/admin/queries/{id}`, with the fields of the query form as JSON (`Content-Type: application/json`; invalid fields answer 422 with `fields`). A signed-in admin session works too. Admin keys get 403 on query endpoints unless scoped to connections, data keys get 403 on the admin API, and every change is audited with the key that made it\n\n## Deprecation\nA deprecated query still runs, but its responses carry a `Deprecation` header (`@` and the Unix time it was deprecated), a `Sunset` header with the date it will stop working, a `Link` header to its `successor-version` and the `deprecated` warning, and the spec marks it `deprecated`. After the sunset date it answers 410 with code `query_sunset` and `superseded_by` naming the replacement. The changelog lists planned deprecations as `lifecycle` changes\n\n## Renamed Queries\nA renamed query keeps answering on its old slugs until an admin retires them; those responses are deprecated since the rename, with a `Link` to the current slug (unless the SLUG_ALIAS_DEPRECATION setting is off). This spec documents the current slugs only\n\n## Changelog\n`GET /api/changelog?since=YYYY-MM-DD` (API key required) lists the queries whose endpoint, parameters, output shape or deprecation changed since then (default: the last 30 days), with the parameter diffs. A key scoped to connections only sees the queries that run on one of them\n\n## Reserved Parameter Names\nThe following names cannot be used as user-defined query parameters:\npage, per_page, order_by, order_direction",
 		},
 		"servers": []map[string]string{
-			{"url": "http://localhost:8080"},
+			{"url": v.base},
 		},
 		"paths": paths,
 		"components": map[string]interface{}{
@@ -287,6 +538,124 @@ func (h *DocHandler) GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(spec)
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(spec); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// paramSchema is the JSON schema of a query parameter in the request body
+func paramSchema(p service.ParamDoc) map[string]interface{} {
+	schema := map[string]interface{}{"type": p.Type}
+	if p.Type == "array" {
+		schema["items"] = map[string]interface{}{}
+	}
+	if p.Description != "" {
+		schema["description"] = p.Description
+	}
+	if p.Default != "" {
+		schema["default"] = p.DefaultValue()
+		if schema["default"] == nil {
+			schema["nullable"] = true
+		}
+	}
+	if p.Example != nil {
+		schema["example"] = p.Example
+	}
+	return schema
+}
+
+// paramObject is the OpenAPI parameter object of a query parameter taken
+// from the URL query, a header or the path
+func paramObject(p service.ParamDoc) map[string]interface{} {
+	schema := paramSchema(p)
+	obj := map[string]interface{}{"name": p.Name, "in": p.In, "required": p.Required || p.In == service.ParamInPath}
+	if p.In == service.ParamInHeader {
+		obj["name"] = p.Header
+	}
+	if d, ok := schema["description"]; ok {
+		obj["description"] = d
+		delete(schema, "description")
+	}
+	if p.Type == "array" {
+		// Arrays are comma-separated in every source
+		obj["explode"] = false
+	}
+	obj["schema"] = schema
+	return obj
+}
+
+// capturedRowSchema describes a row by the columns of a captured response
+// schema, by row key
+func capturedRowSchema(captured *service.ResponseSchema, columns map[string]interface{}) map[string]interface{} {
+	description := fmt.Sprintf("Columns captured from a sample run on %s. Best-effort: types are those of the capture and may differ on other connections or parameters",
+		captured.CapturedAt.Format(time.DateOnly))
+	if captured.DriftAt != nil {
+		description += "; executions have returned other columns since " + captured.DriftAt.Format(time.DateOnly)
+	}
+	return map[string]interface{}{
+		"type":        "object",
+		"description": description,
+		"properties":  columns,
+		"required":    captured.Names(),
+	}
+}
+
+// shapedRowSchema describes a row nested by a shaping config: the key columns
+// plus one array per child group. Columns are typed from columns, the
+// properties of a captured response schema, when they are there.
+func shapedRowSchema(shape *service.ShapeConfig, columns map[string]interface{}) map[string]interface{} {
+	column := func(name string) interface{} {
+		if c, ok := columns[name]; ok {
+			return c
+		}
+		return map[string]interface{}{}
+	}
+	properties := make(map[string]interface{})
+	for _, k := range shape.Key {
+		properties[k] = column(k)
+	}
+	for name, cols := range shape.Children {
+		childProps := make(map[string]interface{})
+		for _, c := range cols {
+			childProps[c] = column(c)
+		}
+		properties[name] = map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type":       "object",
+				"properties": childProps,
+			},
+		}
+	}
+	return map[string]interface{}{
+		"type":        "object",
+		"description": "Rows grouped by " + strings.Join(shape.Key, ", ") + "; other columns stay on the parent",
+		"properties":  properties,
+	}
+}
+
+// executionHeaders documents the metadata headers set by Handler.ExecuteQuery
+var executionHeaders = map[string]interface{}{
+	headerDuration: map[string]interface{}{
+		"description": "Server-side execution time in milliseconds",
+		"schema":      map[string]string{"type": "integer"},
+	},
+	headerConnection: map[string]interface{}{
+		"description": "Name of the connection the query ran on",
+		"schema":      map[string]string{"type": "string"},
+	},
+	headerRows: map[string]interface{}{
+		"description": "Rows returned by the database, before shaping; not sent with count_only",
+		"schema":      map[string]string{"type": "integer"},
+	},
+	headerWarnings: map[string]interface{}{
+		"description": "Soft limits the execution exceeded (slow_query, many_rows); only sent when there are any",
+		"schema":      map[string]string{"type": "string"},
+	},
+	headerEnvelope: map[string]interface{}{
+		"description": "Envelope of a JSON response, v1 or v2",
+		"schema":      map[string]interface{}{"type": "string", "enum": []string{"v1", "v2"}},
+	},
 }
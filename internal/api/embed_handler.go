@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// embedRefresh is how often an embedded table reloads itself
+const embedRefresh = 5 * time.Minute
+
+// EmbedHandler serves GET /embed/{token}: the results of an embed token's
+// query as a bare HTML table meant for an iframe, or as JSON when the
+// request accepts application/json. The URL's query string is never read;
+// the token fixes everything the run uses.
+type EmbedHandler struct {
+	embeds    *service.EmbedService
+	templates *Templates
+	limiter   *RateLimiter // per token; nil = unlimited
+}
+
+func NewEmbedHandler(embeds *service.EmbedService, templates *Templates, limiter *RateLimiter) *EmbedHandler {
+	return &EmbedHandler{embeds: embeds, templates: templates, limiter: limiter}
+}
+
+func (h *EmbedHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/embed/{token}", h.Serve)
+}
+
+// embedCell is a value of the embedded table
+type embedCell struct {
+	Value string
+	Null  bool
+}
+
+func (h *EmbedHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	ctx := context.WithValue(r.Context(), core.ContextKeyClientIP, extractIP(r))
+
+	t, err := h.embeds.Resolve(chi.URLParam(r, "token"))
+	if errors.Is(err, service.ErrEmbedNotFound) {
+		h.fail(w, r, http.StatusNotFound, "This embed link is not valid.")
+		return
+	}
+	if err != nil {
+		h.embeds.Refuse(ctx, t, err)
+		h.fail(w, r, http.StatusGone, "This embed link has expired or was revoked.")
+		return
+	}
+	if h.limiter != nil && !h.limiter.Allow("embed:"+strconv.FormatInt(t.ID, 10)) {
+		h.embeds.Refuse(ctx, t, service.ErrEmbedRateLimited)
+		w.Header().Set("Retry-After", "60")
+		h.fail(w, r, http.StatusTooManyRequests, "This embed is viewed too often, try again in a minute.")
+		return
+	}
+
+	result, err := h.embeds.Run(ctx, t)
+	if err != nil {
+		logger.Error.Printf("Embed token #%d failed: %v", t.ID, err)
+		h.fail(w, r, http.StatusBadGateway, "The data could not be loaded.")
+		return
+	}
+	columns := result.Meta.RowKeys()
+
+	if acceptsJSON(r) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"columns": columns,
+			"data":    result.Data,
+			"capped":  len(result.Data) >= t.RowCap,
+		})
+		return
+	}
+
+	rows := make([][]embedCell, len(result.Data))
+	for i, row := range result.Data {
+		rows[i] = make([]embedCell, len(columns))
+		for j, col := range columns {
+			if v := row[col]; v != nil {
+				rows[i][j] = embedCell{Value: fmt.Sprint(v)}
+			} else {
+				rows[i][j] = embedCell{Null: true}
+			}
+		}
+	}
+	h.page(w, http.StatusOK, map[string]interface{}{
+		"Title":   t.Label,
+		"Columns": columns,
+		"Rows":    rows,
+		"RowCap":  t.RowCap,
+		"Capped":  len(rows) >= t.RowCap,
+		"Updated": time.Now(),
+		"Refresh": int(embedRefresh.Seconds()),
+	})
+}
+
+func (h *EmbedHandler) fail(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if acceptsJSON(r) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		writeJSONError(w, status, message)
+		return
+	}
+	h.page(w, status, map[string]interface{}{"Error": message})
+}
+
+// page renders embed.html. Its policy allows inline styles and nothing
+// else, and leaves framing open, as embedding is the point.
+func (h *EmbedHandler) page(w http.ResponseWriter, status int, data map[string]interface{}) {
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := h.templates.ExecuteTemplate(w, "embed.html", data); err != nil {
+		logger.Error.Printf("Failed to render embed.html: %v", err)
+	}
+}
+
+// acceptsJSON reports whether r asks for JSON rather than a page
+func acceptsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// headerEnvelope tells clients which envelope a JSON query result uses
+const headerEnvelope = "X-DbBridge-Envelope"
+
+// jsonV1Format writes JSON results in the v1 envelope. It is not registered:
+// envelopeFormat swaps it in for the JSON format.
+var jsonV1Format = &outputFormat{Name: "json", ContentType: "application/json", Write: writeJSONV1Result}
+
+// selectEnvelope picks the envelope of a JSON query result. An explicit
+// version wins: the one in the path (/api/v1/...), then the profile of a
+// JSON range in Accept (application/json; profile=v1). Without one the API
+// key's default applies, and v2 for keys without a default.
+func selectEnvelope(pathVersion, accept, keyDefault string) string {
+	if validEnvelope(pathVersion) {
+		return pathVersion
+	}
+	for _, part := range strings.Split(accept, ",") {
+		typ, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || (typ != "application/json" && typ != "*/*") {
+			continue
+		}
+		if profile := strings.ToLower(params["profile"]); validEnvelope(profile) {
+			return profile
+		}
+	}
+	if validEnvelope(keyDefault) {
+		return keyDefault
+	}
+	return core.EnvelopeV2
+}
+
+func validEnvelope(v string) bool {
+	return v == core.EnvelopeV1 || v == core.EnvelopeV2
+}
+
+// envelopeFormat applies the request's envelope to the JSON format and
+// announces it in headerEnvelope. Other formats have no envelope.
+func envelopeFormat(w http.ResponseWriter, r *http.Request, format *outputFormat) *outputFormat {
+	if format.Name != "json" {
+		return format
+	}
+	keyDefault, _ := r.Context().Value(core.ContextKeyApiKeyEnvelope).(string)
+	envelope := selectEnvelope(chi.URLParam(r, "envelope"), r.Header.Get("Accept"), keyDefault)
+	w.Header().Set(headerEnvelope, envelope)
+	if envelope == core.EnvelopeV1 {
+		return jsonV1Format
+	}
+	return format
+}
+
+// writeJSONV1Result answers with the v1 envelope: the shaped data next to
+// "success", or the error. Warnings are only in the X-DbBridge-Warnings
+// header.
+func writeJSONV1Result(w http.ResponseWriter, result *service.ExecutionResult) {
+	status, body := shapeResult(result)
+	v1 := map[string]interface{}{"success": status == http.StatusOK}
+	if status == http.StatusOK {
+		v1["data"] = body["data"]
+	} else {
+		v1["error"] = body["error"]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v1)
+}
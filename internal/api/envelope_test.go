@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestSelectEnvelope(t *testing.T) {
+	explicit := []struct {
+		name, path, accept string
+		want               string // "" = the key's default
+	}{
+		{"none", "", "", ""},
+		{"plain Accept", "", "application/json", ""},
+		{"path v1", "v1", "", "v1"},
+		{"path v2", "v2", "", "v2"},
+		{"Accept v1", "", "application/json; profile=v1", "v1"},
+		{"Accept v2", "", `application/json;profile="v2"`, "v2"},
+		{"Accept */* v1", "", "text/csv;q=0.5, */*; profile=v1", "v1"},
+		{"unknown profile", "", "application/json; profile=v3", ""},
+		{"profile of another type", "", "application/xml; profile=v1", ""},
+		{"path wins over Accept", "v2", "application/json; profile=v1", "v2"},
+		{"path v1 over Accept v2", "v1", "application/json; profile=v2", "v1"},
+	}
+	for _, keyDefault := range []string{"", core.EnvelopeV1, core.EnvelopeV2} {
+		fallback := keyDefault
+		if fallback == "" {
+			fallback = core.EnvelopeV2
+		}
+		for _, tc := range explicit {
+			want := tc.want
+			if want == "" {
+				want = fallback
+			}
+			if got := selectEnvelope(tc.path, tc.accept, keyDefault); got != want {
+				t.Errorf("key default %q, %s: got %s, want %s", keyDefault, tc.name, got, want)
+			}
+		}
+	}
+}
+
+func TestEnvelopeFormat(t *testing.T) {
+	result := &service.ExecutionResult{Data: []map[string]interface{}{{"id": 1}}}
+	for _, tc := range []struct {
+		keyDefault, path, format string
+		header, body             string
+	}{
+		{core.EnvelopeV1, "", "json", "v1", `{"data":[{"id":1}],"success":true}`},
+		{core.EnvelopeV1, "v2", "json", "v2", ""},
+		{core.EnvelopeV2, "v1", "json", "v1", `{"data":[{"id":1}],"success":true}`},
+		{core.EnvelopeV1, "", "csv", "", ""}, // no envelope outside JSON
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/api/main/orders", nil)
+		ctx := context.WithValue(r.Context(), core.ContextKeyApiKeyEnvelope, tc.keyDefault)
+		rctx := chi.NewRouteContext()
+		if tc.path != "" {
+			rctx.URLParams.Add("envelope", tc.path)
+		}
+		r = r.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+
+		rec := httptest.NewRecorder()
+		format := envelopeFormat(rec, r, formatByName(tc.format))
+		if got := rec.Header().Get(headerEnvelope); got != tc.header {
+			t.Errorf("%+v: header %q, want %q", tc, got, tc.header)
+		}
+		format.Write(rec, result)
+		if tc.body != "" {
+			// Re-encoded, so the keys are sorted
+			var got interface{}
+			json.Unmarshal(rec.Body.Bytes(), &got)
+			if gotJSON, _ := json.Marshal(got); string(gotJSON) != tc.body {
+				t.Errorf("%+v: body %s", tc, rec.Body)
+			}
+		} else if tc.format == "json" {
+			var body map[string]interface{}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if _, ok := body["meta"]; !ok {
+				t.Errorf("%+v: v2 body without meta: %s", tc, rec.Body)
+			}
+		}
+	}
+}
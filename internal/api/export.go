@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// exportEncoders are the formats of background exports: the flat row
+// formats, which can be written a row at a time
+var exportEncoders = map[string]func(w io.Writer) service.ExportEncoder{
+	"csv":    func(w io.Writer) service.ExportEncoder { return &csvExportEncoder{cw: csv.NewWriter(w)} },
+	"ndjson": func(w io.Writer) service.ExportEncoder { return &ndjsonExportEncoder{enc: json.NewEncoder(w)} },
+}
+
+// csvExportEncoder writes rows like encodeCSV
+type csvExportEncoder struct {
+	cw     *csv.Writer
+	keys   []string
+	record []string
+}
+
+func (e *csvExportEncoder) WriteHeader(columns, keys []string) error {
+	e.keys = keys
+	e.record = make([]string, len(keys))
+	return e.cw.Write(columns)
+}
+
+func (e *csvExportEncoder) WriteRow(row map[string]interface{}) error {
+	for i, key := range e.keys {
+		e.record[i] = ""
+		if v := row[key]; v != nil {
+			e.record[i] = textValue(v)
+		}
+	}
+	return e.cw.Write(e.record)
+}
+
+func (e *csvExportEncoder) Close() error {
+	e.cw.Flush()
+	return e.cw.Error()
+}
+
+// ndjsonExportEncoder writes rows like writeNDJSON
+type ndjsonExportEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExportEncoder) WriteHeader(columns, keys []string) error { return nil }
+
+func (e *ndjsonExportEncoder) WriteRow(row map[string]interface{}) error { return e.enc.Encode(row) }
+
+func (e *ndjsonExportEncoder) Close() error { return nil }
+
+// exportFormatNames lists the export formats, for error messages
+func exportFormatNames() []string {
+	names := make([]string, 0, len(exportEncoders))
+	for name := range exportEncoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetExports enables background exports and their job routes.
+// sessionUserID lets a signed-in admin follow the jobs too.
+func (h *Handler) SetExports(s *service.ExportService, sessionUserID func(*http.Request) int64) {
+	h.exports = s
+	h.sessionUserID = sessionUserID
+}
+
+// StartExport queues a background export of a query's full result to a
+// gzipped file (?format=csv or ndjson, default csv) and answers 202 with the
+// job; GET /api/jobs/{id} follows it and /api/jobs/{id}/download serves the
+// file once it is done
+func (h *Handler) StartExport(w http.ResponseWriter, r *http.Request) {
+	connName, querySlug := chi.URLParam(r, "connectionName"), chi.URLParam(r, "querySlug")
+	if h.inMaintenance(w, connName) {
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	if format == "" {
+		format = "csv"
+	}
+	newEncoder, ok := exportEncoders[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unsupported export format %q (supported: %s)", format, strings.Join(exportFormatNames(), ", ")),
+			http.StatusBadRequest)
+		return
+	}
+	write, err := h.executor.IsWriteQuery(querySlug)
+	if err != nil {
+		writeExecError(w, err)
+		return
+	}
+	if write {
+		http.Error(w, "queries that write cannot be exported", http.StatusBadRequest)
+		return
+	}
+
+	params, err := h.executionParams(r, querySlug)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	job, err := h.exports.Start(r.Context(), connName, querySlug, params, format, newEncoder)
+	if err != nil {
+		writeExportError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// jobAuthMiddleware guards the export job routes: an API key as for queries,
+// or an admin key, unscoped too, or a signed-in admin session, which may
+// follow the exports of every key
+func (h *Handler) jobAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") == "" && h.sessionUserID != nil {
+			if userID := h.sessionUserID(r); userID != 0 {
+				ctx := context.WithValue(r.Context(), core.ContextKeyUserID, userID)
+				next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, exportAdminKey, true)))
+				return
+			}
+		}
+		apiKey, ctx, ok := h.authenticateKey(w, r)
+		if !ok || !h.takeQuota(w, apiKey) {
+			return
+		}
+		if apiKey.IsAdmin() {
+			ctx = context.WithValue(ctx, exportAdminKey, true)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ExportStatus answers an export job started with the request's API key
+func (h *Handler) ExportStatus(w http.ResponseWriter, r *http.Request) {
+	job, err := h.ownExport(r)
+	if err != nil {
+		writeExportError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// DownloadExport serves the file of an export started with the request's
+// API key, with range requests for resuming
+func (h *Handler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.ownExport(r); err != nil {
+		writeExportError(w, err)
+		return
+	}
+	serveExport(w, r, h.exports, chi.URLParam(r, "id"))
+}
+
+// ownExport returns the {id} export if the request's API key started it or
+// an admin asks; other keys get ErrExportNotFound, not to give away that it
+// exists
+func (h *Handler) ownExport(r *http.Request) (*service.ExportJob, error) {
+	job, err := h.exports.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		return nil, err
+	}
+	if admin, _ := r.Context().Value(exportAdminKey).(bool); admin {
+		return job, nil
+	}
+	apiKeyID, _ := r.Context().Value(core.ContextKeyApiKeyID).(int64)
+	if job.ApiKeyID != apiKeyID {
+		return nil, service.ErrExportNotFound
+	}
+	return job, nil
+}
+
+// serveExport answers with the file of the export id
+func serveExport(w http.ResponseWriter, r *http.Request, exports *service.ExportService, id string) {
+	f, job, err := exports.Open(id)
+	if err != nil {
+		writeExportError(w, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", job.FileName()))
+	modified := time.Time{}
+	if job.FinishedAt != nil {
+		modified = *job.FinishedAt
+	}
+	http.ServeContent(w, r, job.FileName(), modified, f)
+}
+
+// writeExportError answers an error of the export service as JSON
+func writeExportError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var spaceErr *service.ExportSpaceError
+	switch {
+	case errors.Is(err, service.ErrExportNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrExportNotReady), errors.Is(err, service.ErrExportFailed):
+		status = http.StatusConflict
+	case errors.As(err, &spaceErr):
+		status = http.StatusInsufficientStorage
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// ExportHandler lets admins follow and download the exports of every API key
+type ExportHandler struct {
+	exports *service.ExportService
+}
+
+func NewExportHandler(exports *service.ExportService) *ExportHandler {
+	return &ExportHandler{exports: exports}
+}
+
+func (h *ExportHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/admin/exports", h.List)
+	r.Get("/admin/exports/{id}/download", h.Download)
+}
+
+// List answers all exports, newest first
+func (h *ExportHandler) List(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"exports": h.exports.List()})
+}
+
+func (h *ExportHandler) Download(w http.ResponseWriter, r *http.Request) {
+	serveExport(w, r, h.exports, chi.URLParam(r, "id"))
+}
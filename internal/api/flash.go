@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/gob"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// Flash levels, also the CSS hook of the message in the layout
+const (
+	FlashSuccess = "success"
+	FlashWarning = "warning"
+	FlashError   = "error"
+)
+
+// Flash is a one-time message a handler queues in the session before
+// redirecting. The next rendered page shows and removes it.
+type Flash struct {
+	Level   string
+	Message string
+}
+
+const flashKey = "flashes"
+
+func init() {
+	// Session values are gob encoded into the cookie
+	gob.Register(Flash{})
+}
+
+// addFlash queues a message in the session. It must run before the response
+// is written, as the session cookie is a header.
+func addFlash(store sessions.Store, w http.ResponseWriter, r *http.Request, level, msg string) {
+	session, _ := store.Get(r, "dbbridge-session")
+	session.AddFlash(Flash{Level: level, Message: msg}, flashKey)
+	session.Save(r, w)
+}
+
+// takeFlashes takes the queued messages out of session, in the order they
+// were added. The caller saves the session.
+func takeFlashes(session *sessions.Session) []Flash {
+	values := session.Flashes(flashKey)
+	if len(values) == 0 {
+		return nil
+	}
+	flashes := make([]Flash, 0, len(values))
+	for _, v := range values {
+		if f, ok := v.(Flash); ok {
+			flashes = append(flashes, f)
+		}
+	}
+	return flashes
+}
+
+// SetFlash queues a message for the next page the user sees, normally the
+// one the handler redirects to
+func (h *WebHandler) SetFlash(w http.ResponseWriter, r *http.Request, level, msg string) {
+	addFlash(h.sessionStore, w, r, level, msg)
+}
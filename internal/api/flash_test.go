@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestFlashSurvivesOneRedirect(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	tmpl, err := NewTemplates("../../web/templates/*.html", templateFuncs(nil, nil), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &WebHandler{sessionStore: store, templates: tmpl}
+
+	// A save handler queues two messages and redirects
+	req := httptest.NewRequest("POST", "/admin/connections/save", nil)
+	rec := httptest.NewRecorder()
+	h.SetFlash(rec, req, FlashSuccess, "Connection prod saved.")
+	h.SetFlash(rec, req, FlashWarning, "Connection prod is inactive.")
+	http.Redirect(rec, req, "/admin/connections", http.StatusFound)
+	// Each save sets the cookie again; like a browser, keep the last one
+	all := rec.Result().Cookies()
+	cookies := all[len(all)-1:]
+
+	render := func(cookies []*http.Cookie) (string, []*http.Cookie) {
+		req := httptest.NewRequest("GET", "/admin/profile", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.render(w, req, "profile.html", map[string]interface{}{"Title": "My Profile"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("render = %d %s", w.Code, w.Body.String())
+		}
+		if next := w.Result().Cookies(); len(next) > 0 {
+			return w.Body.String(), next
+		}
+		return w.Body.String(), cookies
+	}
+
+	body, cookies := render(cookies)
+	saved := strings.Index(body, "Connection prod saved.")
+	inactive := strings.Index(body, "Connection prod is inactive.")
+	if saved < 0 || inactive < saved {
+		t.Fatalf("page after redirect lacks the queued messages in order:\n%s", body)
+	}
+	if !strings.Contains(body, "flash-warning") {
+		t.Error("warning rendered without its level")
+	}
+
+	if body, _ := render(cookies); strings.Contains(body, "Connection prod") {
+		t.Error("flash shown again on the following page")
+	}
+}
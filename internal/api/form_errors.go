@@ -0,0 +1,13 @@
+package api
+
+// formErrors collects the validation errors of an admin form keyed by form
+// field name. The form is rendered again with the submitted values and the
+// errors next to their inputs as .Errors, under the form.error_summary banner.
+type formErrors map[string]string
+
+// add records msg for field, keeping the first error of each field
+func (e formErrors) add(field, msg string) {
+	if _, ok := e[field]; !ok {
+		e[field] = msg
+	}
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"bytes"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// outputFormat is a response format of query executions. Adding a format is
+// one registerFormat call with its writer; execute, the admin test run and
+// zip bundles all pick formats from the registry.
+type outputFormat struct {
+	Name        string   // ?format= value, also the bundle file extension
+	ContentType string   // media type written and matched against Accept
+	MediaTypes  []string // other media types in Accept that select it
+	// Write answers with the buffered result, setting the Content-Type and status
+	Write func(w http.ResponseWriter, result *service.ExecutionResult)
+}
+
+// outputFormats lists the formats in registration order; the first one
+// answers requests without a preference
+var outputFormats []*outputFormat
+
+func registerFormat(f *outputFormat) {
+	outputFormats = append(outputFormats, f)
+}
+
+func init() {
+	registerFormat(&outputFormat{Name: "json", ContentType: "application/json", Write: writeJSONResult})
+	registerFormat(&outputFormat{Name: "xml", ContentType: "application/xml", MediaTypes: []string{"text/xml"},
+		Write: func(w http.ResponseWriter, result *service.ExecutionResult) { writeXML(w, result.XMLRoot, result) }})
+	registerFormat(&outputFormat{Name: "csv", ContentType: "text/csv", Write: writeCSV})
+	registerFormat(&outputFormat{Name: "ndjson", ContentType: "application/x-ndjson", MediaTypes: []string{"application/ndjson"},
+		Write: writeNDJSON})
+}
+
+// formatByName returns the registered format called name, nil if none is
+func formatByName(name string) *outputFormat {
+	for _, f := range outputFormats {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// formatNames lists the registered formats, for error messages
+func formatNames() []string {
+	names := make([]string, len(outputFormats))
+	for i, f := range outputFormats {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// matches reports whether the Accept media range mediaRange selects f
+func (f *outputFormat) matches(mediaRange string) bool {
+	if mediaRange == "*/*" {
+		return true
+	}
+	if typ, ok := strings.CutSuffix(mediaRange, "/*"); ok {
+		return strings.HasPrefix(f.ContentType, typ+"/")
+	}
+	if mediaRange == f.ContentType {
+		return true
+	}
+	for _, t := range f.MediaTypes {
+		if mediaRange == t {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatError is a request for a format that is not registered
+type FormatError struct {
+	Requested string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("unsupported format %s (supported: %s)", e.Requested, strings.Join(formatNames(), ", "))
+}
+
+// negotiateFormat picks the response format of a request. An explicit
+// ?format= wins over the Accept header; Accept ranges are tried by quality,
+// ties in the order given, and a request with neither gets the first
+// registered format (JSON). Naming no registered format is a FormatError.
+func negotiateFormat(r *http.Request) (*outputFormat, error) {
+	if name := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format"))); name != "" {
+		if f := formatByName(name); f != nil {
+			return f, nil
+		}
+		return nil, &FormatError{Requested: strconv.Quote(name)}
+	}
+
+	accept := strings.TrimSpace(r.Header.Get("Accept"))
+	if accept == "" {
+		return outputFormats[0], nil
+	}
+	type mediaRange struct {
+		typ string
+		q   float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		typ, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{typ, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	for _, mr := range ranges {
+		for _, f := range outputFormats {
+			if f.matches(mr.typ) {
+				return f, nil
+			}
+		}
+	}
+	return nil, &FormatError{Requested: "in Accept: " + accept}
+}
+
+// writeNotAcceptable answers a FormatError with 406 and the supported formats
+func writeNotAcceptable(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotAcceptable)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "supported": formatNames()})
+}
+
+// writeJSONResult answers with the shaped JSON body, see shapeResult
+func writeJSONResult(w http.ResponseWriter, result *service.ExecutionResult) {
+	status, body := shapeResult(result)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeCSV answers with the flat rows as CSV, see encodeCSV
+func writeCSV(w http.ResponseWriter, result *service.ExecutionResult) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	encodeCSV(w, result)
+}
+
+// writeNDJSON answers with one JSON object per flat row and line. Like CSV
+// and XML, shaping and result modes only apply to JSON.
+func writeNDJSON(w http.ResponseWriter, result *service.ExecutionResult) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, row := range result.Data {
+		if err := enc.Encode(row); err != nil {
+			return // the client went away
+		}
+	}
+}
+
+// bufferedResponse collects a format's response in memory, for zip bundles
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(status int)      { b.status = status }
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"dbbridge/internal/service"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	for _, tc := range []struct {
+		query, accept, want string
+	}{
+		{"", "", "json"},
+		{"", "*/*", "json"},
+		{"", "text/csv", "csv"},
+		{"", "application/xml;q=0.5, text/csv", "csv"},
+		{"", "text/html, application/xhtml+xml, */*;q=0.8", "json"},
+		{"", "text/*", "csv"},
+		{"", "application/ndjson", "ndjson"},
+		// ?format= wins over Accept, whatever its quality
+		{"xml", "text/csv", "xml"},
+		{"CSV", "application/json", "csv"},
+		{"json", "application/xml", "json"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/api/main/orders?format="+tc.query, nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept", tc.accept)
+		}
+		f, err := negotiateFormat(r)
+		if err != nil || f.Name != tc.want {
+			t.Errorf("format=%q Accept=%q: got %v, %v, want %s", tc.query, tc.accept, f, err, tc.want)
+		}
+	}
+
+	for _, tc := range []struct{ query, accept string }{
+		{"xlsx", ""},
+		{"xlsx", "application/json"}, // an unknown ?format= is not rescued by Accept
+		{"", "text/html"},
+		{"", "application/json;q=0"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/api/main/orders?format="+tc.query, nil)
+		r.Header.Set("Accept", tc.accept)
+		var formatErr *FormatError
+		if _, err := negotiateFormat(r); !errors.As(err, &formatErr) {
+			t.Errorf("format=%q Accept=%q: got %v, want a FormatError", tc.query, tc.accept, err)
+		}
+	}
+}
+
+func TestWriteNotAcceptable(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeNotAcceptable(rec, &FormatError{Requested: `"xlsx"`})
+	if rec.Code != http.StatusNotAcceptable || !strings.Contains(rec.Body.String(), `"supported":["json","xml","csv","ndjson"]`) {
+		t.Errorf("%d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	result := &service.ExecutionResult{
+		Meta: service.MetaInfo{Columns: []string{"id"}},
+		Data: []map[string]interface{}{{"id": 1}, {"id": 2}},
+	}
+	rec := httptest.NewRecorder()
+	formatByName("ndjson").Write(rec, result)
+	if got := rec.Body.String(); got != "{\"id\":1}\n{\"id\":2}\n" {
+		t.Errorf("body = %q", got)
+	}
+}
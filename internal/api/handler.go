@@ -2,11 +2,19 @@ package api
 
 import (
 	"context"
+	"dbbridge/internal/buildinfo"
+	"dbbridge/internal/config"
 	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
 	"dbbridge/internal/service"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5" // Using Chi router for simplicity and pattern matching
 )
@@ -15,21 +23,109 @@ type Handler struct {
 	executor   *service.QueryExecutor
 	docHandler *DocHandler
 	authSvc    *service.AuthService
+	auditRepo  core.AuditRepository
+	config     *config.Store
+	settings   *service.SettingsService // nil = no maintenance mode
+	contracts  *service.ContractLog     // nil = no changelog
+	// nil = Idempotency-Key is ignored
+	idempotency core.IdempotencyRepository
+	exports     *service.ExportService // nil = no background exports
+	snapshots   *service.SnapshotStore // nil = no snapshot paging
+	quota       *service.DailyQuota    // nil = no daily quota
+	// sessionUserID returns the signed-in admin, 0 for none; see SetExports
+	sessionUserID func(*http.Request) int64
 }
 
-func NewHandler(executor *service.QueryExecutor, docHandler *DocHandler, authSvc *service.AuthService) *Handler {
+// SetSettings enables maintenance mode, read from the runtime settings
+func (h *Handler) SetSettings(s *service.SettingsService) {
+	h.settings = s
+}
+
+// SetQuota caps the API requests of each key per day
+func (h *Handler) SetQuota(q *service.DailyQuota) {
+	h.quota = q
+}
+
+// SetContractLog enables GET /api/changelog
+func (h *Handler) SetContractLog(l *service.ContractLog) {
+	h.contracts = l
+}
+
+func NewHandler(executor *service.QueryExecutor, docHandler *DocHandler, authSvc *service.AuthService, auditRepo core.AuditRepository, cfgStore *config.Store) *Handler {
 	return &Handler{
 		executor:   executor,
 		docHandler: docHandler,
 		authSvc:    authSvc,
+		auditRepo:  auditRepo,
+		config:     cfgStore,
 	}
 }
 
 func (h *Handler) ExecuteQuery(w http.ResponseWriter, r *http.Request) {
-	connName := chi.URLParam(r, "connectionName")
-	querySlug := chi.URLParam(r, "querySlug")
+	h.execute(w, r, chi.URLParam(r, "connectionName"), chi.URLParam(r, "querySlug"))
+}
+
+// ExecuteEnvQuery runs a query on the one connection of its allowed list
+// labelled with the {environment} of the path
+func (h *Handler) ExecuteEnvQuery(w http.ResponseWriter, r *http.Request) {
+	connName, err := h.executor.ResolveEnvironment(chi.URLParam(r, "environment"), chi.URLParam(r, "querySlug"))
+	if err != nil {
+		writeExecError(w, err)
+		return
+	}
+	h.execute(w, r, connName, chi.URLParam(r, "querySlug"))
+}
+
+func (h *Handler) execute(w http.ResponseWriter, r *http.Request, connName, querySlug string) {
+	if h.inMaintenance(w, connName) {
+		return
+	}
+	params, err := h.executionParams(r, querySlug)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	format, err := negotiateFormat(r)
+	if err != nil {
+		writeNotAcceptable(w, err)
+		return
+	}
+	format = envelopeFormat(w, r, format)
 
-	// Parse body params
+	// Retries of write queries with the same Idempotency-Key run them once
+	if key := r.Header.Get(headerIdempotencyKey); key != "" && h.idempotency != nil && r.URL.Query().Get("count_only") != "true" {
+		apiKeyID, _ := r.Context().Value(core.ContextKeyApiKeyID).(int64)
+		if write, err := h.executor.IsWriteQuery(querySlug); err == nil && write && apiKeyID != 0 {
+			hash := requestHash(connName, querySlug, format.Name, params)
+			h.serveIdempotent(w, apiKeyID, key, hash, func(w http.ResponseWriter) {
+				h.run(w, r, connName, querySlug, params, format)
+			})
+			return
+		}
+	}
+	h.run(w, r, connName, querySlug, params, format)
+}
+
+// inMaintenance answers 503 when maintenance mode blocks the connection and
+// reports whether it did
+func (h *Handler) inMaintenance(w http.ResponseWriter, connName string) bool {
+	if h.settings == nil {
+		return false
+	}
+	m := h.settings.Maintenance()
+	if !m.Blocks(connName) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(m.RetryAfter))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]string{"error": m.Message})
+	return true
+}
+
+// requestParams parses the JSON body parameters of an execution
+func requestParams(r *http.Request) map[string]interface{} {
 	var params map[string]interface{}
 	if r.Body != nil {
 		defer r.Body.Close()
@@ -38,61 +134,475 @@ func (h *Handler) ExecuteQuery(w http.ResponseWriter, r *http.Request) {
 	if params == nil {
 		params = make(map[string]interface{})
 	}
+	return params
+}
+
+// run executes a query with the parsed request and writes the response
+func (h *Handler) run(w http.ResponseWriter, r *http.Request, connName, querySlug string, params map[string]interface{}, format *outputFormat) {
+	start := time.Now()
+	w.Header().Set(headerConnection, connName)
+	if lifecycle, err := h.executor.Lifecycle(querySlug, start); err == nil {
+		setLifecycleHeaders(w, connName, lifecycle)
+	}
+
+	// Count-only mode: how many rows match, without fetching any
+	if r.URL.Query().Get("count_only") == "true" {
+		count, err := h.executor.CountByName(r.Context(), connName, querySlug, params)
+		setDuration(w, start)
+		if err != nil {
+			writeExecError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"count": count})
+		return
+	}
+
+	// Snapshot paging: the whole result is kept and read in chunks by token
+	if r.URL.Query().Get("snapshot") == "true" {
+		h.openSnapshot(w, r, connName, querySlug, params, format)
+		return
+	}
 
 	result, err := h.executor.ExecuteByName(r.Context(), connName, querySlug, params)
+	setDuration(w, start)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeExecError(w, err)
+		return
+	}
+	w.Header().Set(headerRows, strconv.Itoa(len(result.Data)))
+	if len(result.Warnings) > 0 {
+		w.Header().Set(headerWarnings, strings.Join(result.Warnings, ", "))
+	}
+	if writeEmptyResponse(w, result) {
+		return
+	}
+
+	format.Write(w, result)
+}
+
+// Metadata headers on execute responses, so clients can correlate latency
+// without parsing the body
+const (
+	headerDuration   = "X-DbBridge-Duration-Ms"
+	headerConnection = "X-DbBridge-Connection"
+	headerRows       = "X-DbBridge-Rows"
+	headerWarnings   = "X-DbBridge-Warnings"
+)
+
+// statusCancelled answers executions cancelled from the admin UI
+const statusCancelled = 499
+
+// setLifecycleHeaders announces a deprecated query with the Deprecation
+// (RFC 9745) and Sunset (RFC 8594) headers and links its replacement
+func setLifecycleHeaders(w http.ResponseWriter, connName string, l *service.QueryLifecycle) {
+	if l == nil {
+		return
+	}
+	if l.DeprecatedAt != nil {
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(l.DeprecatedAt.Unix(), 10))
+	}
+	if l.SunsetAt != nil {
+		w.Header().Set("Sunset", l.SunsetAt.UTC().Format(http.TimeFormat))
+	}
+	if l.SupersededBy != "" {
+		w.Header().Set("Link", fmt.Sprintf(`</api/%s/%s>; rel="successor-version"`, connName, l.SupersededBy))
+	}
+}
+
+func setDuration(w http.ResponseWriter, start time.Time) {
+	w.Header().Set(headerDuration, strconv.FormatInt(time.Since(start).Milliseconds(), 10))
+}
+
+// writeExecError answers a failed execution. A query outside its execution
+// window is a 403 whose Retry-After points at the window's next opening, as
+// are a query needing an API key attribute the caller lacks, one touching
+// schemas its connection does not allow and a connection outside the key's
+// scopes; an identifier parameter outside its whitelist is a 400. An
+// environment matching no connection of the query is a 404, several a 409. A
+// query past its sunset date is a JSON 410 naming its replacement. An
+// execution cancelled by an admin is a JSON 499, the status nginx uses for
+// requests cut short. A translated database error is JSON with its code, see
+// dbErrorStatus.
+func writeExecError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrExecutionCancelled) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCancelled)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	var dbErr *service.DBError
+	if errors.As(err, &dbErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(dbErrorStatus[dbErr.Code])
+		json.NewEncoder(w).Encode(map[string]string{"error": dbErr.Message, "code": string(dbErr.Code)})
 		return
 	}
+	var attrErr *core.KeyAttributeError
+	var schemaErr *service.SchemaError
+	var scopeErr *core.KeyScopeError
+	if errors.As(err, &attrErr) || errors.As(err, &schemaErr) || errors.As(err, &scopeErr) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	var envErr *service.EnvironmentError
+	if errors.As(err, &envErr) {
+		status := http.StatusNotFound
+		if len(envErr.Matches) > 1 {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	var identErr *core.IdentifierError
+	if errors.As(err, &identErr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var sunsetErr *service.SunsetError
+	if errors.As(err, &sunsetErr) {
+		body := map[string]string{"error": err.Error(), "code": "query_sunset"}
+		if sunsetErr.SupersededBy != "" {
+			body["superseded_by"] = sunsetErr.SupersededBy
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(body)
+		return
+	}
+	var windowErr *service.WindowError
+	if errors.As(err, &windowErr) {
+		retry := int(math.Ceil(time.Until(windowErr.Next).Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(retry, 1)))
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
 
+// dbErrorStatus is the status answering each class of database error. A
+// syntax error is in the saved query, not the request, so it stays a 500.
+var dbErrorStatus = map[core.DBErrorClass]int{
+	core.ErrClassConstraint: http.StatusConflict,
+	core.ErrClassPermission: http.StatusForbidden,
+	core.ErrClassSyntax:     http.StatusInternalServerError,
+	core.ErrClassTimeout:    http.StatusGatewayTimeout,
+	core.ErrClassConnection: http.StatusBadGateway,
+}
+
+// writeEmptyResponse sets the headers of the query's response config and,
+// when it has an empty status and there are no rows, answers with it: a 204
+// without a body or a 404 like an empty object query's. It reports whether
+// the response was written.
+func writeEmptyResponse(w http.ResponseWriter, result *service.ExecutionResult) bool {
+	cfg := result.Response
+	if cfg == nil {
+		return false
+	}
+	for name, value := range cfg.Headers {
+		w.Header().Set(name, value)
+	}
+	if cfg.EmptyStatus == 0 || len(result.Data) > 0 {
+		return false
+	}
+	if cfg.EmptyStatus == http.StatusNoContent {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	w.WriteHeader(cfg.EmptyStatus)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": "Query returned no rows"})
+	return true
+}
+
+// shapeResult builds the response body: rows are nested by the query's
+// shaping config, then the result mode applies. In object and scalar mode only
+// the first row is used; extra rows add the truncated_to_first warning and no
+// rows is a 404. Soft limit warnings are passed on in every mode.
+func shapeResult(result *service.ExecutionResult) (int, map[string]interface{}) {
+	if result.Shape != nil {
+		nested, err := result.Shape.Apply(result.Data, result.Meta.RowKeys())
+		if err != nil {
+			return http.StatusInternalServerError, map[string]interface{}{"error": err.Error()}
+		}
+		result.Data = nested
+	}
+
+	body := map[string]interface{}{
 		"data":  result.Data,
 		"meta":  result.Meta,
 		"error": result.Error,
-	})
+	}
+	if len(result.Warnings) > 0 {
+		body["warnings"] = result.Warnings
+	}
+	if result.ResultMode != core.ResultModeObject && result.ResultMode != core.ResultModeScalar {
+		return http.StatusOK, body
+	}
+
+	if len(result.Data) == 0 {
+		return http.StatusNotFound, map[string]interface{}{"error": "Query returned no rows"}
+	}
+	if len(result.Data) > 1 {
+		body["warnings"] = append(append([]string{}, result.Warnings...), "truncated_to_first")
+	}
+
+	first := result.Data[0]
+	if result.ResultMode == core.ResultModeObject {
+		body["data"] = first
+		return http.StatusOK, body
+	}
+	var value interface{}
+	if keys := result.Meta.RowKeys(); len(keys) > 0 {
+		value = first[keys[0]]
+	}
+	body["data"] = value
+	return http.StatusOK, body
+}
+
+// Version returns the build info of the running binary (public, no auth)
+func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildinfo.Get())
+}
+
+// defaultChangelogWindow is how far back /api/changelog looks without ?since
+const defaultChangelogWindow = 30 * 24 * time.Hour
+
+// Changelog lists the saved queries whose contract (endpoint, parameters or
+// output shape) changed since ?since, an RFC 3339 time or a date, with the
+// parameter diffs. A scoped key only sees the queries of its connections.
+func (h *Handler) Changelog(w http.ResponseWriter, r *http.Request) {
+	if h.contracts == nil {
+		http.NotFound(w, r)
+		return
+	}
+	since := time.Now().Add(-defaultChangelogWindow)
+	if s := r.URL.Query().Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t, err = time.ParseInLocation(time.DateOnly, s, time.Local)
+		}
+		if err != nil {
+			http.Error(w, "Invalid since (use an RFC 3339 time or YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	scopes, _ := r.Context().Value(core.ContextKeyApiKeyScopes).([]core.KeyScope)
+	entries, err := h.contracts.Changelog(since, scopes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"since": since, "changes": entries})
 }
 
 // Router setup
 func (h *Handler) Routes() http.Handler {
 	r := chi.NewRouter()
 	r.Use(LoggingMiddleware)
-	r.Use(h.AuthMiddleware)
+	if h.exports != nil {
+		// Admins follow every export, so these take admin keys and sessions too
+		r.Group(func(r chi.Router) {
+			r.Use(h.jobAuthMiddleware)
+			r.Get("/jobs/{id}", h.ExportStatus)
+			r.Get("/jobs/{id}/download", h.DownloadExport)
+		})
+	}
+	r.Group(func(r chi.Router) {
+		r.Use(h.AuthMiddleware)
+		h.keyRoutes(r)
+	})
+	return r
+}
+
+// keyRoutes are the routes behind AuthMiddleware
+func (h *Handler) keyRoutes(r chi.Router) {
 
 	// Old route (optional to keep or remove, let's keep for ID access if needed or just replace?)
 	// User asked for /{connectionname}/{queryname}.
 	// API Docs
 	r.Get("/docs/openapi.json", h.docHandler.GetOpenAPISpec)
 	r.Get("/docs", h.docHandler.ServeSwaggerUI)
+	r.Get("/docs/{connectionName}/{querySlug}", h.docHandler.QueryPage)
+	r.Get("/version", h.Version)
+	r.Get("/changelog", h.Changelog)
 
 	r.Post("/{connectionName}/{querySlug}", h.ExecuteQuery)
-
-	return r
+	r.Post("/{connectionName}/{querySlug}/{pathValue}", h.ExecuteQuery)
+	r.Post("/env/{environment}/{querySlug}", h.ExecuteEnvQuery)
+	r.Post("/env/{environment}/{querySlug}/{pathValue}", h.ExecuteEnvQuery)
+	// The same with an explicit envelope, see selectEnvelope
+	r.Route("/{envelope:v[12]}", func(r chi.Router) {
+		r.Post("/{connectionName}/{querySlug}", h.ExecuteQuery)
+		r.Post("/{connectionName}/{querySlug}/{pathValue}", h.ExecuteQuery)
+		r.Post("/env/{environment}/{querySlug}", h.ExecuteEnvQuery)
+		r.Post("/env/{environment}/{querySlug}/{pathValue}", h.ExecuteEnvQuery)
+	})
+	r.Post("/bundle", h.Bundle)
+	if h.exports != nil {
+		r.Post("/{connectionName}/{querySlug}/export", h.StartExport)
+	}
+	if h.snapshots != nil {
+		r.Get("/snapshots/{token}", h.SnapshotPage)
+	}
 }
 
 func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow public access to API Docs
-		if strings.HasPrefix(r.URL.Path, "/api/docs") {
+		// Allow public access to API Docs and version info; the per-query
+		// docs pages need a key
+		switch r.URL.Path {
+		case "/api/docs", "/api/docs/openapi.json", "/api/version":
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		apiKeyStr := r.Header.Get("X-API-Key")
-		if apiKeyStr == "" {
-			http.Error(w, "Missing X-API-Key header", http.StatusUnauthorized)
+		apiKey, ctx, ok := h.authenticateKey(w, r)
+		if !ok {
 			return
 		}
-
-		// Verify Key
-		apiKey, err := h.authSvc.VerifyApiKey(apiKeyStr)
-		if err != nil {
-			http.Error(w, "Invalid X-API-Key", http.StatusUnauthorized)
+		// Admin keys run queries only where they are explicitly scoped
+		if apiKey.IsAdmin() && apiKey.Scopes == "" {
+			h.deny(w, r, apiKey, "admin key without scopes",
+				"Admin API keys can only call /api/admin unless scoped to connections")
+			return
+		}
+		if !h.takeQuota(w, apiKey) {
 			return
 		}
-
-		// Store API Key ID in context
-		ctx := context.WithValue(r.Context(), core.ContextKeyApiKeyID, apiKey.ID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// takeQuota counts a request of apiKey against its daily quota; once it is
+// used up it answers 429 and returns false
+func (h *Handler) takeQuota(w http.ResponseWriter, apiKey *core.ApiKey) bool {
+	if h.quota == nil {
+		return true
+	}
+	ok, retryAfter := h.quota.Take(apiKey.ID, time.Now())
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(retryAfter.Seconds())), 1)))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Daily quota of this API key used up", "code": "quota_exceeded"})
+	}
+	return ok
+}
+
+// authenticateKey verifies the request's X-API-Key and the IP allowlists and
+// returns the key and a context carrying it; on failure it has answered and
+// ok is false
+func (h *Handler) authenticateKey(w http.ResponseWriter, r *http.Request) (apiKey *core.ApiKey, ctx context.Context, ok bool) {
+	apiKeyStr := r.Header.Get("X-API-Key")
+	if apiKeyStr == "" {
+		http.Error(w, "Missing X-API-Key header", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	// Verify Key
+	apiKey, err := h.authSvc.VerifyApiKey(apiKeyStr)
+	if err != nil {
+		http.Error(w, "Invalid X-API-Key", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	// Enforce the global and per-key IP allowlists before anything executes
+	clientIP := extractIP(r)
+	if reason := h.checkAllowlists(clientIP, apiKey); reason != "" {
+		h.deny(w, r, apiKey, reason, "Client IP not allowed for this API key")
+		return nil, nil, false
+	}
+
+	// Store API Key ID, its owner and client IP in context
+	ctx = context.WithValue(r.Context(), core.ContextKeyApiKeyID, apiKey.ID)
+	ctx = context.WithValue(ctx, core.ContextKeyApiKeyPrefix, apiKey.KeyPrefix)
+	ctx = context.WithValue(ctx, core.ContextKeyUserID, apiKey.UserID)
+	ctx = context.WithValue(ctx, core.ContextKeyClientIP, clientIP)
+	attrs, err := core.ParseKeyAttributes(apiKey.Attributes)
+	if err != nil {
+		logger.Error.Printf("API key %s... has invalid attributes: %v", apiKey.KeyPrefix, err)
+	}
+	ctx = context.WithValue(ctx, core.ContextKeyApiKeyAttributes, attrs)
+	scopes, err := core.ParseKeyScopes(apiKey.Scopes)
+	if err != nil {
+		// Validated when saved, so fail closed on anything else
+		logger.Error.Printf("API key %s... has invalid scopes: %v", apiKey.KeyPrefix, err)
+		scopes = []core.KeyScope{{Name: "-"}}
+	}
+	ctx = context.WithValue(ctx, core.ContextKeyApiKeyScopes, scopes)
+	ctx = context.WithValue(ctx, core.ContextKeyApiKeyEnvelope, apiKey.Envelope)
+	return apiKey, ctx, true
+}
+
+// deny audits a refused API key request and answers 403 with msg
+func (h *Handler) deny(w http.ResponseWriter, r *http.Request, apiKey *core.ApiKey, reason, msg string) {
+	clientIP := extractIP(r)
+	logger.Info.Printf("API key %s... rejected from %s: %s", apiKey.KeyPrefix, clientIP, reason)
+	h.auditRepo.Create(&core.AuditLog{
+		Timestamp:    time.Now(),
+		UserID:       apiKey.UserID,
+		ApiKeyID:     &apiKey.ID,
+		ApiKeyPrefix: apiKey.KeyPrefix + "...",
+		Status:       "DENIED",
+		ErrorMessage: fmt.Sprintf("%s (%s %s)", reason, r.Method, r.URL.Path),
+		ClientIP:     clientIP,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// AdminAPIMiddleware guards the admin JSON API under /api/admin: it accepts
+// a signed-in admin session (sessionUserID is non-zero) or an admin API key.
+// Writes must be sent as application/json, which browsers do not post
+// cross-site without a preflight.
+func (h *Handler) AdminAPIMiddleware(sessionUserID func(*http.Request) int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodDelete &&
+				!strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+				http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+			if userID := sessionUserID(r); userID != 0 && r.Header.Get("X-API-Key") == "" {
+				ctx := context.WithValue(r.Context(), core.ContextKeyUserID, userID)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			apiKey, ctx, ok := h.authenticateKey(w, r)
+			if !ok {
+				return
+			}
+			if !apiKey.IsAdmin() {
+				h.deny(w, r, apiKey, "data key on the admin API", "This API key cannot call the admin API")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// checkAllowlists returns why clientIP may not use apiKey, or "" if it may
+func (h *Handler) checkAllowlists(clientIP string, apiKey *core.ApiKey) string {
+	global, err := config.ParseCIDRList(h.config.Get().APIAllowedCIDRs)
+	if err != nil {
+		// Validated at load/reload, so this only happens on a programming error: fail closed
+		return "invalid API_ALLOWED_CIDRS"
+	}
+	if !ipAllowed(clientIP, global) {
+		return "IP not in API_ALLOWED_CIDRS"
+	}
+
+	perKey, err := config.ParseCIDRList(splitCIDRs(apiKey.AllowedCIDRs))
+	if err != nil {
+		return "invalid key allowlist"
+	}
+	if !ipAllowed(clientIP, perKey) {
+		return "IP not in key allowlist"
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestShapeResult(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"total": int64(7), "name": "a"},
+		{"total": int64(9), "name": "b"},
+	}
+	meta := service.MetaInfo{Columns: []string{"total", "name"}}
+
+	tests := []struct {
+		name       string
+		mode       string
+		data       []map[string]interface{}
+		wantStatus int
+		wantData   interface{}
+		wantWarn   bool
+	}{
+		{"rows unchanged", "rows", rows, http.StatusOK, nil, false},
+		{"object first row", "object", rows[:1], http.StatusOK, rows[0], false},
+		{"object truncated", "object", rows, http.StatusOK, rows[0], true},
+		{"object empty", "object", nil, http.StatusNotFound, nil, false},
+		{"scalar first column", "scalar", rows[:1], http.StatusOK, int64(7), false},
+		{"scalar truncated", "scalar", rows, http.StatusOK, int64(7), true},
+		{"scalar empty", "scalar", nil, http.StatusNotFound, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := shapeResult(&service.ExecutionResult{Data: tt.data, Meta: meta, ResultMode: tt.mode})
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			_, hasWarn := body["warnings"]
+			if hasWarn != tt.wantWarn {
+				t.Errorf("warnings present = %v, want %v", hasWarn, tt.wantWarn)
+			}
+			switch tt.mode {
+			case "rows":
+				if got, ok := body["data"].([]map[string]interface{}); !ok || len(got) != len(tt.data) {
+					t.Errorf("data = %v, want the rows unchanged", body["data"])
+				}
+			case "object":
+				got, ok := body["data"].(map[string]interface{})
+				if !ok || got["name"] != tt.wantData.(map[string]interface{})["name"] {
+					t.Errorf("data = %v, want %v", body["data"], tt.wantData)
+				}
+			default:
+				if body["data"] != tt.wantData {
+					t.Errorf("data = %v, want %v", body["data"], tt.wantData)
+				}
+			}
+		})
+	}
+}
+
+func TestShapeResultSoftLimitWarnings(t *testing.T) {
+	rows := []map[string]interface{}{{"id": 1}, {"id": 2}}
+	meta := service.MetaInfo{Columns: []string{"id"}}
+
+	_, body := shapeResult(&service.ExecutionResult{Data: rows, Meta: meta, ResultMode: "rows", Warnings: []string{"slow_query"}})
+	if got, _ := body["warnings"].([]string); len(got) != 1 || got[0] != "slow_query" {
+		t.Errorf("rows warnings = %v", body["warnings"])
+	}
+	_, body = shapeResult(&service.ExecutionResult{Data: rows, Meta: meta, ResultMode: "object", Warnings: []string{"many_rows"}})
+	if got, _ := body["warnings"].([]string); len(got) != 2 || got[0] != "many_rows" || got[1] != "truncated_to_first" {
+		t.Errorf("object warnings = %v", body["warnings"])
+	}
+}
+
+func TestWriteEmptyResponse(t *testing.T) {
+	cfg := &service.ResponseConfig{Headers: map[string]string{"X-Vendor-Id": "42"}, EmptyStatus: http.StatusNoContent}
+
+	w := httptest.NewRecorder()
+	if writeEmptyResponse(w, &service.ExecutionResult{Data: []map[string]interface{}{{"id": 1}}, Response: cfg}) {
+		t.Error("rows were answered as empty")
+	}
+	if w.Header().Get("X-Vendor-Id") != "42" {
+		t.Errorf("headers = %v, want the configured header", w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	if !writeEmptyResponse(w, &service.ExecutionResult{Response: cfg}) || w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("empty result = %d %q, want 204 without a body", w.Code, w.Body.String())
+	}
+
+	cfg.EmptyStatus = http.StatusNotFound
+	w = httptest.NewRecorder()
+	if !writeEmptyResponse(w, &service.ExecutionResult{Response: cfg}) || w.Code != http.StatusNotFound {
+		t.Errorf("empty result = %d, want 404", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	if writeEmptyResponse(w, &service.ExecutionResult{}) || len(w.Header()) != 0 {
+		t.Error("a query without a response config changed the response")
+	}
+}
+
+func TestWriteExecErrorTranslated(t *testing.T) {
+	driverErr := errors.New(`execution error: pq: duplicate key value violates unique constraint "orders_pkey"`)
+	err := &service.DBError{Code: core.ErrClassConstraint, Message: `duplicate key value violates unique constraint "orders_pkey"`, Err: driverErr}
+
+	w := httptest.NewRecorder()
+	writeExecError(w, err)
+	if w.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409", w.Code)
+	}
+	var body map[string]string
+	if jsonErr := json.Unmarshal(w.Body.Bytes(), &body); jsonErr != nil {
+		t.Fatal(jsonErr)
+	}
+	if body["code"] != "constraint_violation" || body["error"] != err.Message {
+		t.Errorf("body = %v", body)
+	}
+	if service.ErrorDetail(err) != driverErr.Error() {
+		t.Errorf("ErrorDetail() = %q, want the driver's error", service.ErrorDetail(err))
+	}
+}
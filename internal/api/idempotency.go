@@ -0,0 +1,129 @@
+package api
+
+import (
+	"crypto/sha256"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Idempotency-Key lets clients retry executions of write queries without
+// running them twice: the first request's response is stored and replayed
+const (
+	headerIdempotencyKey    = "Idempotency-Key"
+	headerIdempotentReplay  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+)
+
+// SetIdempotency enables Idempotency-Key on executions of write queries
+func (h *Handler) SetIdempotency(repo core.IdempotencyRepository) {
+	h.idempotency = repo
+}
+
+// idempotencyTTL is the IDEMPOTENCY_TTL_HOURS setting
+func (h *Handler) idempotencyTTL() time.Duration {
+	hours := 24
+	if h.settings != nil {
+		hours = h.settings.Int("IDEMPOTENCY_TTL_HOURS")
+	} else if h.config != nil {
+		hours = h.config.Get().IdempotencyTTLHours
+	}
+	return time.Duration(max(hours, 1)) * time.Hour
+}
+
+// validIdempotencyKey accepts up to 255 printable ASCII characters
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestHash identifies what an execution request asks for, so a key reused
+// for a different request is caught. json.Marshal sorts the parameter names.
+func requestHash(connName, querySlug, format string, params map[string]interface{}) string {
+	body, _ := json.Marshal(params)
+	sum := sha256.Sum256([]byte(connName + "\x00" + querySlug + "\x00" + format + "\x00" + string(body)))
+	return hex.EncodeToString(sum[:])
+}
+
+// serveIdempotent runs an execution once per API key and Idempotency-Key.
+// The first request claims the key and its response is stored; later ones
+// get that response again with Idempotent-Replayed: true, 409 while the first
+// is still running and 422 when they ask for something else. Responses of
+// failed runs (5xx, cancelled) are not stored, so the client can retry them.
+func (h *Handler) serveIdempotent(w http.ResponseWriter, apiKeyID int64, key, hash string, run func(w http.ResponseWriter)) {
+	if !validIdempotencyKey(key) {
+		writeJSONError(w, http.StatusBadRequest, "Idempotency-Key must be 1 to 255 printable ASCII characters")
+		return
+	}
+	now := time.Now()
+	rec := &core.IdempotencyRecord{ApiKeyID: apiKeyID, Key: key, RequestHash: hash, CreatedAt: now, ExpiresAt: now.Add(h.idempotencyTTL())}
+	existing, err := h.idempotency.Claim(rec)
+	if err != nil {
+		logger.Error.Printf("Idempotency key claim failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Idempotency-Key could not be checked")
+		return
+	}
+	switch {
+	case existing == nil:
+	case existing.RequestHash != hash:
+		writeJSONError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+		return
+	case existing.StatusCode == 0:
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, http.StatusConflict, "a request with this Idempotency-Key is still running")
+		return
+	default:
+		var header http.Header
+		json.Unmarshal([]byte(existing.Headers), &header)
+		for name, values := range header {
+			w.Header()[name] = values
+		}
+		w.Header().Set(headerIdempotentReplay, "true")
+		w.WriteHeader(existing.StatusCode)
+		w.Write(existing.Body)
+		return
+	}
+
+	buf := newBufferedResponse()
+	stored := false
+	defer func() {
+		if !stored {
+			if err := h.idempotency.Release(apiKeyID, key); err != nil {
+				logger.Error.Printf("Idempotency key release failed: %v", err)
+			}
+		}
+	}()
+	run(buf)
+
+	if buf.status < http.StatusInternalServerError && buf.status != statusCancelled {
+		headers, _ := json.Marshal(buf.header)
+		rec.StatusCode, rec.Headers, rec.Body = buf.status, string(headers), buf.body.Bytes()
+		if err := h.idempotency.Complete(rec); err != nil {
+			logger.Error.Printf("Idempotency key store failed: %v", err)
+		} else {
+			stored = true
+		}
+	}
+	for name, values := range buf.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(buf.status)
+	w.Write(buf.body.Bytes())
+}
+
+// writeJSONError answers with status and {"error": message}
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"dbbridge/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestServeIdempotent(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	h := &Handler{idempotency: data.NewIdempotencyRepo(db)}
+
+	var runs atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	insert := func(w http.ResponseWriter) {
+		if runs.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(headerRows, "1")
+		w.Write([]byte(`{"data":[{"id":7}]}`))
+	}
+	hash := requestHash("orders", "create-order", "json", map[string]interface{}{"ref": "A-1"})
+	serve := func(apiKeyID int64, key, hash string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.serveIdempotent(w, apiKeyID, key, hash, insert)
+		return w
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- serve(1, "order-A-1", hash) }()
+	<-started
+
+	// Concurrent duplicates while the first runs: none executes the query
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := serve(1, "order-A-1", hash); w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+				t.Errorf("duplicate while running: %d %s", w.Code, w.Body)
+			}
+		}()
+	}
+	wg.Wait()
+	close(release)
+	if w := <-first; w.Code != http.StatusOK || w.Header().Get(headerIdempotentReplay) != "" {
+		t.Fatalf("first request: %d %v", w.Code, w.Header())
+	}
+
+	replay := serve(1, "order-A-1", hash)
+	if replay.Code != http.StatusOK || replay.Body.String() != `{"data":[{"id":7}]}` ||
+		replay.Header().Get(headerIdempotentReplay) != "true" || replay.Header().Get(headerRows) != "1" {
+		t.Errorf("replay: %d %v %s", replay.Code, replay.Header(), replay.Body)
+	}
+	other := requestHash("orders", "create-order", "json", map[string]interface{}{"ref": "B-2"})
+	if w := serve(1, "order-A-1", other); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key: %d", w.Code)
+	}
+	// Keys are scoped to the API key
+	if w := serve(2, "order-A-1", hash); w.Code != http.StatusOK || w.Header().Get(headerIdempotentReplay) != "" {
+		t.Errorf("other API key: %d %v", w.Code, w.Header())
+	}
+	if w := serve(1, "", hash); w.Code != http.StatusBadRequest {
+		t.Errorf("empty key: %d", w.Code)
+	}
+	if n := runs.Load(); n != 2 {
+		t.Errorf("query ran %d times, want 2", n)
+	}
+}
+
+func TestServeIdempotentConcurrentFirst(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	h := &Handler{idempotency: data.NewIdempotencyRepo(db)}
+
+	var runs atomic.Int32
+	statuses := make(chan int, 16)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(statuses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			h.serveIdempotent(w, 1, "k", "h", func(w http.ResponseWriter) {
+				runs.Add(1)
+				w.WriteHeader(http.StatusCreated)
+			})
+			statuses <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	if n := runs.Load(); n != 1 {
+		t.Errorf("query ran %d times, want 1", n)
+	}
+	for code := range statuses {
+		if code != http.StatusCreated && code != http.StatusConflict {
+			t.Errorf("status %d", code)
+		}
+	}
+}
+
+func TestServeIdempotentFailureNotStored(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	h := &Handler{idempotency: data.NewIdempotencyRepo(db)}
+
+	status := http.StatusBadGateway
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.serveIdempotent(w, 1, "k", "h", func(w http.ResponseWriter) { w.WriteHeader(status) })
+		if w.Code != status || w.Header().Get(headerIdempotentReplay) != "" {
+			t.Errorf("attempt %d: %d %v", i, w.Code, w.Header())
+		}
+		status = http.StatusOK // the retry runs again and succeeds
+	}
+}
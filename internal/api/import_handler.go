@@ -0,0 +1,57 @@
+package api
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxImportSize bounds an uploaded OpenAPI spec or Postman collection
+const maxImportSize = 10 << 20
+
+// ImportQueriesForm shows the query import page
+func (h *WebHandler) ImportQueriesForm(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, "query_import.html", map[string]interface{}{"Title": "Import Queries"})
+}
+
+// ImportQueries creates inactive draft queries from an uploaded or pasted
+// OpenAPI spec or Postman collection and reports each endpoint's outcome
+func (h *WebHandler) ImportQueries(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	raw := []byte(strings.TrimSpace(r.FormValue("spec_text")))
+	if file, _, err := r.FormFile("spec"); err == nil {
+		raw, err = io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			h.render(w, r, "query_import.html", map[string]interface{}{"Title": "Import Queries", "Error": err.Error()})
+			return
+		}
+	}
+
+	items, err := service.ParseImport(raw)
+	if err != nil {
+		h.render(w, r, "query_import.html", map[string]interface{}{"Title": "Import Queries", "Error": err.Error()})
+		return
+	}
+
+	results := service.ImportQueries(h.queryRepo, items, h.sessionUsername(r))
+	counts := map[string]int{}
+	for _, res := range results {
+		counts[res.Status]++
+		switch res.Status {
+		case service.ImportCreated:
+			h.record(r, service.AdminEvent{Type: core.EventQueryCreate, Target: "query " + res.Query.Slug, QueryID: res.Query.ID,
+				Changes: h.queryChanges(nil, res.Query)})
+		case service.ImportUpdated:
+			h.record(r, service.AdminEvent{Type: core.EventQueryUpdate, Target: "query " + res.Query.Slug, QueryID: res.Query.ID,
+				Changes: h.queryChanges(res.Before, res.Query)})
+		}
+	}
+	h.render(w, r, "query_import.html", map[string]interface{}{
+		"Title":   "Import Queries",
+		"Results": results,
+		"Counts":  counts,
+	})
+}
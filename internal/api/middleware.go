@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"dbbridge/internal/buildinfo"
 	"dbbridge/internal/logger"
 	"net/http"
 	"time"
@@ -25,6 +26,14 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// ServerHeaderMiddleware advertises the running version in the Server response header
+func ServerHeaderMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", buildinfo.ServerHeader())
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Custom response writer to capture status code
 type responseWriter struct {
 	http.ResponseWriter
@@ -41,6 +50,8 @@ type key int
 
 const (
 	UserKey key = iota
+	// exportAdminKey marks an admin key or session, which sees every export
+	exportAdminKey
 )
 
 // AuthMiddleware - Placeholder for now until we implement full Auth Service
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"dbbridge/internal/service"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// OrphanHandler reports and cleans rows referencing deleted objects: a JSON
+// report and cleanup endpoint, and the admin page using them
+type OrphanHandler struct {
+	templates   *Templates
+	janitor     *service.OrphanJanitor
+	sessionUser func(r *http.Request) int64
+}
+
+func NewOrphanHandler(templates *Templates, janitor *service.OrphanJanitor, sessionUser func(r *http.Request) int64) *OrphanHandler {
+	return &OrphanHandler{
+		templates:   templates,
+		janitor:     janitor,
+		sessionUser: sessionUser,
+	}
+}
+
+func (h *OrphanHandler) Page(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.janitor.Report()
+	data := map[string]interface{}{"Title": "Orphaned Data", "Counts": counts}
+	if err != nil {
+		data["Error"] = err.Error()
+	}
+	h.templates.Page(w, r, "orphans.html", data)
+}
+
+// Report answers the orphaned row counts by category
+func (h *OrphanHandler) Report(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.janitor.Report()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"orphans": counts})
+}
+
+// Clean fixes the orphaned rows in one transaction and answers the rows
+// affected per category; ?dry_run=true rolls it back
+func (h *OrphanHandler) Clean(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	counts, err := h.janitor.Clean(h.sessionUser(r), dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dry_run": dryRun,
+		"actions": counts,
+		"summary": service.OrphanSummary(counts),
+	})
+}
+
+func (h *OrphanHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/admin/maintenance", h.Page)
+	r.Get("/admin/maintenance/orphans", h.Report)
+	r.Post("/admin/maintenance/orphans/clean", h.Clean)
+}
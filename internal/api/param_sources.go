@@ -0,0 +1,57 @@
+package api
+
+import (
+	"dbbridge/internal/logger"
+	"dbbridge/internal/service"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// executionParams assembles the parameters of an execution of querySlug:
+// the JSON body, then the parameters its params_config takes from the URL
+// query, a header or the {pathValue} segment, which win over body values of
+// the same name. Such an override is logged. A path segment the query takes
+// no parameter from is an error.
+func (h *Handler) executionParams(r *http.Request, querySlug string) (map[string]interface{}, error) {
+	params := requestParams(r)
+	pathValue, err := url.PathUnescape(chi.URLParam(r, "pathValue"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid path segment: %w", err)
+	}
+	cfg, err := h.executor.ParamsConfig(querySlug)
+	if err != nil {
+		// An unknown query is reported by the execution
+		return params, nil
+	}
+
+	pathUsed := false
+	for name, p := range cfg {
+		var text string
+		var ok bool
+		switch p.In {
+		case service.ParamInQuery:
+			text, ok = r.URL.Query().Get(name), r.URL.Query().Has(name)
+		case service.ParamInHeader:
+			text, ok = r.Header.Get(p.Header), len(r.Header.Values(p.Header)) > 0
+		case service.ParamInPath:
+			text, ok, pathUsed = pathValue, pathValue != "", true
+		default:
+			continue
+		}
+		if !ok {
+			continue
+		}
+		v := p.Value(text)
+		if old, set := params[name]; set && fmt.Sprint(old) != fmt.Sprint(v) {
+			logger.Info.Printf("Query %s: parameter %s from the %s overrides the body value", querySlug, name, p.In)
+		}
+		params[name] = v
+	}
+	if pathValue != "" && !pathUsed {
+		return nil, fmt.Errorf("query %s takes no parameter from the path", querySlug)
+	}
+	return params, nil
+}
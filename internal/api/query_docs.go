@@ -0,0 +1,250 @@
+package api
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// exampleRows is how many result rows the example response on a query's docs
+// page shows
+const exampleRows = 3
+
+// queryEndpoint is the URL a saved query answers on for one connection
+type queryEndpoint struct {
+	ConnectionID int64
+	Connection   string
+	URL          string
+}
+
+// queryDocs builds the data of a query's docs page, with an endpoint for each
+// active connection in conns the query may run on
+func queryDocs(q *core.SavedQuery, conns []core.DBConnection, base string) map[string]interface{} {
+	var endpoints []queryEndpoint
+	for _, c := range conns {
+		if c.IsActive && allowsConnection(q, c.ID) {
+			endpoints = append(endpoints, queryEndpoint{
+				ConnectionID: c.ID,
+				Connection:   c.Name,
+				URL:          fmt.Sprintf("%s/api/%s/%s", base, core.Slugify(c.Name), q.Slug),
+			})
+		}
+	}
+
+	params := service.QueryParams(q)
+	body := service.ExampleBody(params)
+	if ex, _ := service.ParseQueryExample(q.Example); ex != nil {
+		body = ex.Params
+	}
+	pretty, _ := json.MarshalIndent(body, "", "  ")
+	data := map[string]interface{}{
+		"Title":               "API Docs: " + q.Slug,
+		"Query":               q,
+		"Endpoints":           endpoints,
+		"Params":              params,
+		"ExampleBody":         string(pretty),
+		"ExampleConnectionID": int64(0), // connection of the example run, 0 = none yet
+		"KeyAttributes":       core.NewSQLParser().KeyParams(q.SQLText),
+	}
+	if len(endpoints) > 0 {
+		data["Curl"] = curlExample(endpoints[0].URL, body, params)
+	}
+	if window, _ := service.ParseExecWindow(q.ExecWindow); window != nil {
+		data["Window"] = window
+	}
+	return data
+}
+
+func allowsConnection(q *core.SavedQuery, connID int64) bool {
+	for _, id := range q.AllowedConnectionIDs {
+		if id == connID {
+			return true
+		}
+	}
+	return false
+}
+
+// curlExample is a copy-paste curl call of endpoint with a placeholder API key,
+// passing the parameters not taken from the body where params declares
+func curlExample(endpoint string, body map[string]interface{}, params []service.ParamDoc) string {
+	var headers string
+	query := url.Values{}
+	for _, p := range params {
+		v := paramText(p.Sample())
+		switch p.In {
+		case service.ParamInQuery:
+			query.Set(p.Name, v)
+		case service.ParamInHeader:
+			headers += "  -H '" + p.Header + ": " + strings.ReplaceAll(v, "'", `'\''`) + "' \\\n"
+		case service.ParamInPath:
+			endpoint += "/" + url.PathEscape(v)
+		}
+	}
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	b, _ := json.Marshal(body)
+	return "curl -X POST '" + endpoint + "' \\\n" +
+		"  -H 'X-API-Key: YOUR_API_KEY' \\\n" + headers +
+		"  -H 'Content-Type: application/json' \\\n" +
+		"  -d '" + strings.ReplaceAll(string(b), "'", `'\''`) + "'"
+}
+
+// paramText is a parameter value as sent outside the body, arrays
+// comma-separated
+func paramText(v interface{}) string {
+	items, ok := v.([]interface{})
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	texts := make([]string, len(items))
+	for i, item := range items {
+		texts[i] = fmt.Sprint(item)
+	}
+	return strings.Join(texts, ",")
+}
+
+// queryFromURL returns the saved query named by the {id} URL parameter
+func (h *WebHandler) queryFromURL(r *http.Request) (*core.SavedQuery, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query id")
+	}
+	return h.queryRepo.GetByID(id)
+}
+
+// DetectParams parses the posted SQL for the query form as it is typed: the
+// parameter names with their inline defaults, the system variables used, parse
+// warnings, and the parameters as documented by the posted params_config for
+// the parameter editor
+func (h *WebHandler) DetectParams(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req struct {
+		SQLText      string `json:"sql_text"`
+		ParamsConfig string `json:"params_config"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+
+	parsed := core.NewSQLParser().ParseWithWarnings(req.SQLText)
+	names := []string{}
+	defaults := make(map[string]string)
+	for _, p := range service.QueryParams(&core.SavedQuery{SQLText: req.SQLText}) {
+		if p.Undocumented { // i.e. from the SQL, not a pagination or sorting parameter
+			names = append(names, p.Name)
+			if p.Default != "" {
+				defaults[p.Name] = p.Default
+			}
+		}
+	}
+	resp := map[string]interface{}{
+		"names":            names,
+		"defaults":         defaults,
+		"system_variables": append([]string{}, parsed.SystemVars...),
+		"warnings":         append([]string{}, parsed.Warnings...),
+		"params":           service.QueryParams(&core.SavedQuery{SQLText: req.SQLText, ParamsConfig: req.ParamsConfig}),
+	}
+	if _, err := service.ParseParamsConfig(req.ParamsConfig); err != nil {
+		resp["error"] = err.Error()
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// QueryDocs shows the documentation of one saved query, a page to hand to a
+// partner instead of the full Swagger UI
+func (h *WebHandler) QueryDocs(w http.ResponseWriter, r *http.Request) {
+	q, err := h.queryFromURL(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	conns, err := h.connRepo.GetAll()
+	if err != nil {
+		http.Error(w, "Failed to load connections: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.render(w, r, "query_docs.html", queryDocs(q, conns, baseURL(h.config, r)))
+}
+
+// QueryDocsExample samples the query with its example request body on the
+// posted connection and shows the API response on the docs page. The run is
+// audited as a sample execution and as an admin event.
+func (h *WebHandler) QueryDocsExample(w http.ResponseWriter, r *http.Request) {
+	q, err := h.queryFromURL(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	conns, err := h.connRepo.GetAll()
+	if err != nil {
+		http.Error(w, "Failed to load connections: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := queryDocs(q, conns, baseURL(h.config, r))
+
+	connID, _ := strconv.ParseInt(r.FormValue("connection_id"), 10, 64)
+	allowed := false
+	for _, e := range data["Endpoints"].([]queryEndpoint) {
+		allowed = allowed || e.ConnectionID == connID
+	}
+	if !allowed {
+		data["ExampleError"] = "The query does not run on that connection."
+		h.render(w, r, "query_docs.html", data)
+		return
+	}
+	data["ExampleConnectionID"] = connID
+
+	params := service.ExampleParams(service.QueryParams(q))
+	result, err := h.executor.Execute(service.WithSample(r.Context(), service.SampleRows), connID, q.Slug, params)
+	ev := service.AdminEvent{Type: core.EventQueryExample, Target: "query " + q.Slug, QueryID: q.ID, ConnectionID: connID}
+	if err != nil {
+		ev.Error = err.Error()
+		data["ExampleError"] = err.Error()
+	} else {
+		if len(result.Data) > exampleRows {
+			result.Data = result.Data[:exampleRows]
+			data["ExampleTruncated"] = true
+		}
+		status, body := shapeResult(result)
+		pretty, _ := json.MarshalIndent(body, "", "  ")
+		data["ExampleStatus"] = status
+		data["ExampleResponse"] = string(pretty)
+	}
+	h.record(r, ev)
+
+	h.render(w, r, "query_docs.html", data)
+}
+
+// QueryPage serves the documentation of one endpoint to API consumers. Unlike
+// the full spec it needs an API key, as it is meant for one partner.
+func (h *DocHandler) QueryPage(w http.ResponseWriter, r *http.Request) {
+	if h.templates == nil {
+		http.NotFound(w, r)
+		return
+	}
+	conn, err := h.connRepo.GetByName(chi.URLParam(r, "connectionName"))
+	if err != nil || !conn.IsActive {
+		http.NotFound(w, r)
+		return
+	}
+	q, err := h.queryRepo.GetBySlug(chi.URLParam(r, "querySlug"))
+	if err != nil || !q.IsActive || !allowsConnection(q, conn.ID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "api_query_docs.html", queryDocs(q, []core.DBConnection{*conn}, baseURL(h.config, r))); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
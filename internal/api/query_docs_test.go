@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"dbbridge/internal/config"
+	"dbbridge/internal/core"
+	"dbbridge/internal/data"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestQueryDocsPages(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tmpl, err := NewTemplates("../../web/templates/*.html", templateFuncs(nil, nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connRepo, queryRepo := data.NewConnectionRepo(db), data.NewQueryRepo(db)
+	cfgStore := config.NewStore(&config.Config{BaseURL: "https://bridge.example.com"})
+
+	conn := &core.DBConnection{Name: "erp", Driver: "sqlite", IsActive: true}
+	if err := connRepo.Create(conn); err != nil {
+		t.Fatal(err)
+	}
+	q := &core.SavedQuery{Slug: "customer", SQLText: "SELECT * FROM customers WHERE id = {id}", IsActive: true,
+		ParamsConfig: `{"id": {"type": "integer", "description": "Customer number"}}`, AllowedConnectionIDs: []int64{conn.ID}}
+	if err := queryRepo.Create(q); err != nil {
+		t.Fatal(err)
+	}
+
+	withParams := func(r *http.Request, kv ...string) *http.Request {
+		rctx := chi.NewRouteContext()
+		for i := 0; i < len(kv); i += 2 {
+			rctx.URLParams.Add(kv[i], kv[i+1])
+		}
+		return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+	}
+
+	h := &WebHandler{connRepo: connRepo, queryRepo: queryRepo, templates: tmpl, config: cfgStore}
+	w := httptest.NewRecorder()
+	h.QueryDocs(w, withParams(httptest.NewRequest("GET", "/admin/queries/1/docs", nil), "id", "1"))
+	body := w.Body.String()
+	for _, want := range []string{
+		"POST https://bridge.example.com/api/erp/customer",
+		"Customer number",
+		"-d &#39;{&#34;id&#34;:1}&#39;",
+		`action="/admin/queries/1/docs/example"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("admin docs page lacks %q", want)
+		}
+	}
+
+	docs := NewDocHandler(queryRepo, connRepo, cfgStore)
+	docs.SetTemplates(tmpl)
+	w = httptest.NewRecorder()
+	docs.QueryPage(w, withParams(httptest.NewRequest("GET", "/api/docs/erp/customer", nil), "connectionName", "erp", "querySlug", "customer"))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Customer number") || strings.Contains(w.Body.String(), "docs/example") {
+		t.Errorf("public docs page = %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	docs.QueryPage(w, withParams(httptest.NewRequest("GET", "/api/docs/erp/other", nil), "connectionName", "erp", "querySlug", "other"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown query docs = %d, want 404", w.Code)
+	}
+
+	// The per-query page needs a key, unlike the spec
+	api := &Handler{}
+	open := api.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for path, want := range map[string]int{"/api/docs/erp/customer": http.StatusUnauthorized, "/api/docs/openapi.json": http.StatusOK} {
+		w = httptest.NewRecorder()
+		open.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("GET %s without key = %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestDetectParams(t *testing.T) {
+	h := &WebHandler{}
+	w := httptest.NewRecorder()
+	h.DetectParams(w, httptest.NewRequest("POST", "/admin/queries/detect-params", strings.NewReader(
+		`{"sql_text": "SELECT {pagination} * FROM orders WHERE customer = {customer} AND status = {status:open} -- {old}", "params_config": "{\"customer\": {\"example\": 1042}}"}`)))
+
+	var resp struct {
+		Names    []string           `json:"names"`
+		Defaults map[string]string  `json:"defaults"`
+		System   []string           `json:"system_variables"`
+		Warnings []string           `json:"warnings"`
+		Params   []service.ParamDoc `json:"params"`
+		Error    string             `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "" || strings.Join(resp.Names, ",") != "customer,status" || resp.Defaults["status"] != "open" {
+		t.Fatalf("DetectParams() = %+v", resp)
+	}
+	if len(resp.System) != 1 || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "{old} is inside a comment") {
+		t.Errorf("system variables %q, warnings %q", resp.System, resp.Warnings)
+	}
+	if p := resp.Params[0]; p.Name != "customer" || p.Undocumented || p.Example != float64(1042) {
+		t.Errorf("documented param = %+v", p)
+	}
+	if p := resp.Params[1]; p.Name != "status" || !p.Undocumented || p.Default != "open" {
+		t.Errorf("undocumented param = %+v", p)
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultEmbedDays is how long a new embed token lasts unless told otherwise
+const defaultEmbedDays = 90
+
+// queryEmbed is an embed token as listed on the query form
+type queryEmbed struct {
+	core.EmbedToken
+	URL        string
+	Connection string
+	Active     bool
+}
+
+// queryEmbeds lists the embed tokens of q with their URLs, which the signing
+// key rebuilds, so they can be copied again at any time, and the connections
+// new tokens may use
+func (h *WebHandler) queryEmbeds(r *http.Request, q *core.SavedQuery, conns []core.DBConnection) ([]queryEmbed, []core.DBConnection) {
+	tokens, _ := h.embeds.List(q.ID)
+	names := make(map[int64]string, len(conns))
+	var allowed []core.DBConnection
+	for _, c := range conns {
+		names[c.ID] = c.Name
+		if allowsConnection(q, c.ID) {
+			allowed = append(allowed, c)
+		}
+	}
+	now := time.Now()
+	embeds := make([]queryEmbed, len(tokens))
+	for i := range tokens {
+		embeds[i] = queryEmbed{
+			EmbedToken: tokens[i],
+			URL:        baseURL(h.config, r) + "/embed/" + h.embeds.Token(&tokens[i]),
+			Connection: names[tokens[i].ConnectionID],
+			Active:     tokens[i].Active(now),
+		}
+	}
+	return embeds, allowed
+}
+
+// CreateEmbed issues an embed token for the query from the embed_* fields
+// of the query form
+func (h *WebHandler) CreateEmbed(w http.ResponseWriter, r *http.Request) {
+	q, err := h.queryFromURL(r)
+	if err != nil || h.embeds == nil {
+		http.NotFound(w, r)
+		return
+	}
+	back := fmt.Sprintf("/admin/queries/edit?id=%d", q.ID)
+
+	opts := service.EmbedOptions{QueryID: q.ID, Label: r.FormValue("embed_label"), CreatedBy: h.sessionUserID(r)}
+	opts.ConnectionID, _ = strconv.ParseInt(r.FormValue("embed_connection_id"), 10, 64)
+	if v := strings.TrimSpace(r.FormValue("embed_row_cap")); v != "" {
+		if opts.RowCap, err = strconv.Atoi(v); err != nil || opts.RowCap < 1 {
+			err = fmt.Errorf("the row cap must be a positive number")
+		}
+	}
+	days := defaultEmbedDays
+	if v := strings.TrimSpace(r.FormValue("embed_days")); v != "" && err == nil {
+		if days, err = strconv.Atoi(v); err != nil || days < 1 {
+			err = fmt.Errorf("the days must be a positive number")
+		}
+	}
+	opts.TTL = time.Duration(days) * 24 * time.Hour
+	if v := strings.TrimSpace(r.FormValue("embed_params")); v != "" && err == nil {
+		if json.Unmarshal([]byte(v), &opts.Params) != nil {
+			err = fmt.Errorf("the parameters must be a JSON object")
+		}
+	}
+
+	var t *core.EmbedToken
+	if err == nil {
+		_, t, err = h.embeds.Create(opts)
+	}
+	ev := service.AdminEvent{Type: core.EventQueryEmbedCreate, Target: "query " + q.Slug, QueryID: q.ID, ConnectionID: opts.ConnectionID}
+	if err != nil {
+		ev.Error = err.Error()
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.embed_failed", q.Slug, err.Error()))
+	} else {
+		ev.Changes = service.AuditChanges{"embed_token": {New: fmt.Sprintf("#%d, %d rows, expires %s", t.ID, t.RowCap, t.ExpiresAt.Format("2006-01-02"))}}
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.embed_created", q.Slug))
+	}
+	h.record(r, ev)
+	http.Redirect(w, r, back+"#embeds", http.StatusFound)
+}
+
+// RevokeEmbed revokes an embed token of the query
+func (h *WebHandler) RevokeEmbed(w http.ResponseWriter, r *http.Request) {
+	q, err := h.queryFromURL(r)
+	if err != nil || h.embeds == nil {
+		http.NotFound(w, r)
+		return
+	}
+	id, _ := strconv.ParseInt(chi.URLParam(r, "embedID"), 10, 64)
+	t, err := h.embeds.Get(id)
+	if err != nil || t.QueryID != q.ID {
+		http.NotFound(w, r)
+		return
+	}
+	ev := service.AdminEvent{Type: core.EventQueryEmbedRevoke, Target: "query " + q.Slug, QueryID: q.ID, ConnectionID: t.ConnectionID,
+		Changes: service.AuditChanges{"embed_token": {Old: fmt.Sprintf("#%d", t.ID)}}}
+	if err := h.embeds.Revoke(t.ID); err != nil {
+		ev.Error = err.Error()
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.embed_failed", q.Slug, err.Error()))
+	} else {
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.embed_revoked", t.ID))
+	}
+	h.record(r, ev)
+	http.Redirect(w, r, fmt.Sprintf("/admin/queries/edit?id=%d#embeds", q.ID), http.StatusFound)
+}
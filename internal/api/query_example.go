@@ -0,0 +1,93 @@
+package api
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"fmt"
+	"net/http"
+)
+
+// recordExample stores a successful test run of q's saved SQL as its example
+// for the OpenAPI spec: the parameters and the first exampleRows rows, shaped
+// like the API answers and sanitized. Runs of edited, unsaved SQL are not
+// recorded.
+func (h *WebHandler) recordExample(r *http.Request, q *core.SavedQuery, params map[string]interface{}, result *service.ExecutionResult) error {
+	sample := *result
+	if len(sample.Data) > exampleRows {
+		sample.Data = sample.Data[:exampleRows]
+	}
+	sample.ResultMode = q.ResultMode
+	sample.Shape, _ = service.ParseShapeConfig(q.ShapeConfig)
+	status, body := shapeResult(&sample)
+	if status != http.StatusOK {
+		return fmt.Errorf("the run has no example response (%v)", body["error"])
+	}
+
+	example, err := service.NewQueryExample(params, body["data"], h.sessionUsername(r)).Encode()
+	if err != nil {
+		return err
+	}
+	if err := h.queryRepo.UpdateExample(q.ID, example); err != nil {
+		return err
+	}
+	before := *q
+	q.Example = example
+	h.record(r, service.AdminEvent{Type: core.EventQueryUpdate, Target: "query " + q.Slug, QueryID: q.ID,
+		Changes: h.queryChanges(&before, q)})
+	return nil
+}
+
+// QueryExampleAction refreshes (action=refresh) or clears (action=clear) a
+// query's recorded example. Refreshing samples the saved SQL with the
+// example's parameters on the first active connection the query may run on.
+func (h *WebHandler) QueryExampleAction(w http.ResponseWriter, r *http.Request) {
+	q, err := h.queryFromURL(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	back := fmt.Sprintf("/admin/queries/edit?id=%d", q.ID)
+
+	if r.FormValue("action") == "clear" {
+		if err := h.queryRepo.UpdateExample(q.ID, ""); err != nil {
+			h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.example_failed", q.Slug, err.Error()))
+		} else {
+			before := *q
+			q.Example = ""
+			h.record(r, service.AdminEvent{Type: core.EventQueryUpdate, Target: "query " + q.Slug, QueryID: q.ID,
+				Changes: h.queryChanges(&before, q)})
+			h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.example_cleared", q.Slug))
+		}
+		http.Redirect(w, r, back, http.StatusFound)
+		return
+	}
+
+	params := map[string]interface{}{}
+	if ex, _ := service.ParseQueryExample(q.Example); ex != nil {
+		params = ex.Params
+	}
+	conns, _ := h.connRepo.GetAll()
+	var connID int64
+	for _, c := range conns {
+		if c.IsActive && allowsConnection(q, c.ID) {
+			connID = c.ID
+			break
+		}
+	}
+	if connID == 0 {
+		err = fmt.Errorf("the query has no active connection")
+	}
+	var result *service.ExecutionResult
+	if err == nil {
+		result, err = h.executor.ExecuteSQL(service.WithSample(r.Context(), service.SampleRows), connID, q.SQLText, params, q.ID)
+	}
+	if err == nil {
+		err = h.recordExample(r, q, params, result)
+	}
+	if err != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.example_failed", q.Slug, service.ErrorDetail(err)))
+	} else {
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.example_recorded", q.Slug))
+	}
+	http.Redirect(w, r, back, http.StatusFound)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// QueryResponseSchemaAction captures (action=capture) or clears
+// (action=clear) a query's response schema. Capturing samples the saved SQL
+// with the example's parameters on the connection in schema_connection_id.
+func (h *WebHandler) QueryResponseSchemaAction(w http.ResponseWriter, r *http.Request) {
+	q, err := h.queryFromURL(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	back := fmt.Sprintf("/admin/queries/edit?id=%d#response-schema", q.ID)
+	before := *q
+
+	if r.FormValue("action") == "clear" {
+		if err := h.queryRepo.UpdateResponseSchema(q.ID, ""); err != nil {
+			h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.schema_failed", q.Slug, err.Error()))
+		} else {
+			q.ResponseSchema = ""
+			h.record(r, service.AdminEvent{Type: core.EventQueryUpdate, Target: "query " + q.Slug, QueryID: q.ID,
+				Changes: h.queryChanges(&before, q)})
+			h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.schema_cleared", q.Slug))
+		}
+		http.Redirect(w, r, back, http.StatusFound)
+		return
+	}
+
+	params := map[string]interface{}{}
+	if ex, _ := service.ParseQueryExample(q.Example); ex != nil {
+		params = ex.Params
+	}
+	connID, _ := strconv.ParseInt(r.FormValue("schema_connection_id"), 10, 64)
+	if !allowsConnection(q, connID) {
+		err = fmt.Errorf("the query does not run on that connection")
+	}
+	var result *service.ExecutionResult
+	if err == nil {
+		result, err = h.executor.ExecuteSQL(service.WithSample(r.Context(), service.SampleRows), connID, q.SQLText, params, q.ID)
+	}
+	var schema *service.ResponseSchema
+	if err == nil {
+		schema, err = service.NewResponseSchema(result, connID, h.sessionUsername(r))
+	}
+	if err == nil {
+		q.ResponseSchema, err = schema.Encode()
+	}
+	if err == nil {
+		err = h.queryRepo.UpdateResponseSchema(q.ID, q.ResponseSchema)
+	}
+	if err != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.schema_failed", q.Slug, service.ErrorDetail(err)))
+	} else {
+		h.record(r, service.AdminEvent{Type: core.EventQueryUpdate, Target: "query " + q.Slug, QueryID: q.ID,
+			ConnectionID: connID, Changes: h.queryChanges(&before, q)})
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.schema_captured", q.Slug))
+	}
+	http.Redirect(w, r, back, http.StatusFound)
+}
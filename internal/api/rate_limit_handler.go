@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RateLimitHandler shows the active limiter configuration and bucket states
+type RateLimitHandler struct {
+	templates  *Templates
+	exemptions *RateLimitExemptions
+	limiters   []*RateLimiter
+}
+
+func NewRateLimitHandler(templates *Templates, exemptions *RateLimitExemptions, limiters ...*RateLimiter) *RateLimitHandler {
+	return &RateLimitHandler{
+		templates:  templates,
+		exemptions: exemptions,
+		limiters:   limiters,
+	}
+}
+
+func (h *RateLimitHandler) Diagnostics(w http.ResponseWriter, r *http.Request) {
+	var states []LimiterState
+	for _, l := range h.limiters {
+		states = append(states, l.Snapshot())
+	}
+	cidrs, paths, sessionBypass := h.exemptions.Describe()
+
+	h.templates.Page(w, r, "rate_limits.html", map[string]interface{}{
+		"Title":         "Rate Limits",
+		"Limiters":      states,
+		"ExemptCIDRs":   cidrs,
+		"ExemptPaths":   paths,
+		"SessionBypass": sessionBypass,
+	})
+}
+
+func (h *RateLimitHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/admin/rate-limits", h.Diagnostics)
+}
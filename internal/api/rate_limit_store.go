@@ -0,0 +1,182 @@
+package api
+
+import (
+	"crypto/sha256"
+	"dbbridge/internal/redis"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryLimiterStore keeps buckets in process memory. Each instance enforces
+// its own quota, which is fine for single-instance deployments.
+type MemoryLimiterStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	cleanup time.Duration // how often to prune stale entries
+}
+
+type bucket struct {
+	tokens    float64
+	lastCheck time.Time
+}
+
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	m := &MemoryLimiterStore{
+		buckets: make(map[string]*bucket),
+		cleanup: 5 * time.Minute,
+	}
+
+	// Start cleanup goroutine
+	go m.cleanupLoop()
+
+	return m
+}
+
+func (m *MemoryLimiterStore) Take(key string, rate float64, burst int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	b, exists := m.buckets[key]
+
+	if !exists {
+		// New key — start with full bucket minus 1 token
+		m.buckets[key] = &bucket{
+			tokens:    float64(burst) - 1,
+			lastCheck: now,
+		}
+		return true, nil
+	}
+
+	// Refill tokens based on elapsed time
+	elapsed := now.Sub(b.lastCheck).Seconds()
+	b.tokens += elapsed * rate
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.lastCheck = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (m *MemoryLimiterStore) clamp(burst int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range m.buckets {
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+	}
+}
+
+func (m *MemoryLimiterStore) snapshot(rate float64, burst int) []BucketState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var states []BucketState
+	for key, b := range m.buckets {
+		tokens := b.tokens + now.Sub(b.lastCheck).Seconds()*rate
+		if tokens > float64(burst) {
+			tokens = float64(burst)
+		}
+		states = append(states, BucketState{
+			Key:       maskBucketKey(key),
+			Tokens:    tokens,
+			LastCheck: b.lastCheck,
+		})
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].LastCheck.After(states[j].LastCheck)
+	})
+	return states
+}
+
+// cleanupLoop periodically removes stale buckets.
+func (m *MemoryLimiterStore) cleanupLoop() {
+	ticker := time.NewTicker(m.cleanup)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.mu.Lock()
+		now := time.Now()
+		for key, b := range m.buckets {
+			// Remove if no activity for 10 minutes
+			if now.Sub(b.lastCheck) > 10*time.Minute {
+				delete(m.buckets, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// tokenBucketScript refills and takes from a bucket atomically. It uses the
+// Redis server clock so instances with skewed clocks still share one quota.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], ttl)
+return allowed
+`)
+
+// RedisLimiterStore shares buckets between instances through Redis
+// (RATE_LIMIT_BACKEND=redis).
+type RedisLimiterStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisLimiterStore stores buckets under prefix, e.g. "dbbridge:ratelimit:api:"
+func NewRedisLimiterStore(client *redis.Client, prefix string) *RedisLimiterStore {
+	return &RedisLimiterStore{client: client, prefix: prefix}
+}
+
+func (s *RedisLimiterStore) Take(key string, rate float64, burst int) (bool, error) {
+	// Keys may be raw API keys, never store them in plain text
+	sum := sha256.Sum256([]byte(key))
+	redisKey := s.prefix + hex.EncodeToString(sum[:16])
+
+	// Expire once the bucket would be full again, plus a second of slack
+	ttl := int64(math.Ceil(float64(burst)/rate*1000)) + 1000
+
+	reply, err := tokenBucketScript.Run(s.client, []string{redisKey},
+		strconv.FormatFloat(rate, 'f', -1, 64), strconv.Itoa(burst), strconv.FormatInt(ttl, 10))
+	if err != nil {
+		return false, err
+	}
+	allowed, ok := reply.(int64)
+	if !ok {
+		return false, fmt.Errorf("unexpected rate limit script reply %T", reply)
+	}
+	return allowed == 1, nil
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"dbbridge/internal/redis"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// runLimiterStoreSuite is the behavioral contract every LimiterStore must pass
+func runLimiterStoreSuite(t *testing.T, newStore func(t *testing.T) LimiterStore) {
+	t.Run("new key starts with a full bucket", func(t *testing.T) {
+		store := newStore(t)
+		for i := 0; i < 3; i++ {
+			ok, err := store.Take("client-a", 0.001, 3)
+			if err != nil {
+				t.Fatalf("Take() error = %v", err)
+			}
+			if !ok {
+				t.Fatalf("request %d rejected, want burst of 3 allowed", i+1)
+			}
+		}
+	})
+
+	t.Run("rejects once burst is exhausted", func(t *testing.T) {
+		store := newStore(t)
+		for i := 0; i < 2; i++ {
+			store.Take("client-a", 0.001, 2)
+		}
+		ok, err := store.Take("client-a", 0.001, 2)
+		if err != nil {
+			t.Fatalf("Take() error = %v", err)
+		}
+		if ok {
+			t.Errorf("third request allowed, want rejected after burst of 2")
+		}
+	})
+
+	t.Run("keys are isolated", func(t *testing.T) {
+		store := newStore(t)
+		store.Take("client-a", 0.001, 1)
+		ok, _ := store.Take("client-b", 0.001, 1)
+		if !ok {
+			t.Errorf("client-b rejected because of client-a's usage")
+		}
+	})
+
+	t.Run("refills over time", func(t *testing.T) {
+		store := newStore(t)
+		store.Take("client-a", 20, 1) // 20 tokens/sec, one every 50ms
+		if ok, _ := store.Take("client-a", 20, 1); ok {
+			t.Fatalf("second immediate request allowed, want rejected")
+		}
+		time.Sleep(120 * time.Millisecond)
+		if ok, _ := store.Take("client-a", 20, 1); !ok {
+			t.Errorf("request after refill rejected, want allowed")
+		}
+	})
+}
+
+func TestMemoryLimiterStore(t *testing.T) {
+	runLimiterStoreSuite(t, func(t *testing.T) LimiterStore {
+		return NewMemoryLimiterStore()
+	})
+}
+
+// Set REDIS_URL (e.g. redis://localhost:6379/15) to run the suite against Redis
+func TestRedisLimiterStore(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL not set")
+	}
+	client, err := redis.NewClient(redisURL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	runLimiterStoreSuite(t, func(t *testing.T) LimiterStore {
+		// Unique prefix per subtest so runs don't share buckets
+		prefix := fmt.Sprintf("dbbridge:test:%s:%d:", t.Name(), time.Now().UnixNano())
+		return NewRedisLimiterStore(client, prefix)
+	})
+}
+
+func TestRateLimiterFailsOpen(t *testing.T) {
+	// Nothing listens on port 1, so every Take fails
+	client, err := redis.NewClient("redis://127.0.0.1:1")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	rl := NewRateLimiterWithStore("test", 1, 1, NewRedisLimiterStore(client, "test:"))
+
+	for i := 0; i < 3; i++ {
+		if !rl.Allow("client-a") {
+			t.Fatalf("request %d rejected while store is down, want fail open", i+1)
+		}
+	}
+}
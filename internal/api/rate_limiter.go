@@ -1,80 +1,104 @@
 package api
 
 import (
+	"dbbridge/internal/config"
 	"dbbridge/internal/logger"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
 
-// RateLimiter implements a simple in-memory token bucket rate limiter.
-// Each unique key (IP or API key) gets its own bucket.
+// RateLimiter implements a token bucket rate limiter.
+// Each unique key (IP or API key) gets its own bucket, held by a LimiterStore
+// (in-memory by default, Redis when instances must share quotas).
 type RateLimiter struct {
-	mu      sync.Mutex
-	buckets map[string]*bucket
-	rate    float64       // tokens per second
-	burst   int           // max tokens (burst capacity)
-	cleanup time.Duration // how often to prune stale entries
+	name       string
+	mu         sync.Mutex
+	rate       float64 // tokens per second
+	burst      int     // max tokens (burst capacity)
+	store      LimiterStore
+	exemptions *RateLimitExemptions
+
+	lastStoreErr time.Time // throttles fail-open warnings
 }
 
-type bucket struct {
-	tokens    float64
-	lastCheck time.Time
+// LimiterStore holds the token buckets. Implementations must be safe for
+// concurrent use and must refill at rate tokens/second up to burst.
+type LimiterStore interface {
+	// Take consumes one token from key's bucket, returning false when it is empty.
+	// A new key starts with a full bucket.
+	Take(key string, ratePerSec float64, burst int) (bool, error)
 }
 
-// NewRateLimiter creates a rate limiter.
+// NewRateLimiter creates an in-memory rate limiter.
+// name identifies the route group on the diagnostics page,
 // rate = requests per minute, burst = max burst size.
-func NewRateLimiter(ratePerMinute float64, burst int) *RateLimiter {
-	rl := &RateLimiter{
-		buckets: make(map[string]*bucket),
-		rate:    ratePerMinute / 60.0, // convert to per-second
-		burst:   burst,
-		cleanup: 5 * time.Minute,
+func NewRateLimiter(name string, ratePerMinute float64, burst int) *RateLimiter {
+	return NewRateLimiterWithStore(name, ratePerMinute, burst, NewMemoryLimiterStore())
+}
+
+// NewRateLimiterWithStore creates a rate limiter backed by the given store
+func NewRateLimiterWithStore(name string, ratePerMinute float64, burst int, store LimiterStore) *RateLimiter {
+	return &RateLimiter{
+		name:  name,
+		rate:  ratePerMinute / 60.0, // convert to per-second
+		burst: burst,
+		store: store,
 	}
+}
 
-	// Start cleanup goroutine
-	go rl.cleanupLoop()
+// SetLimits changes the rate and burst of a running limiter (used on config reload).
+// Existing buckets keep their tokens, capped to the new burst.
+func (rl *RateLimiter) SetLimits(ratePerMinute float64, burst int) {
+	rl.mu.Lock()
+	rl.rate = ratePerMinute / 60.0
+	rl.burst = burst
+	rl.mu.Unlock()
 
-	return rl
+	if m, ok := rl.store.(*MemoryLimiterStore); ok {
+		m.clamp(burst)
+	}
 }
 
 // Allow checks if a request from the given key is allowed.
+// If the store is unreachable the request is allowed (fail open) and a warning is logged.
 func (rl *RateLimiter) Allow(key string) bool {
 	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-	b, exists := rl.buckets[key]
+	rate, burst := rl.rate, rl.burst
+	rl.mu.Unlock()
 
-	if !exists {
-		// New key — start with full bucket minus 1 token
-		rl.buckets[key] = &bucket{
-			tokens:    float64(rl.burst) - 1,
-			lastCheck: now,
+	allowed, err := rl.store.Take(key, rate, burst)
+	if err != nil {
+		rl.mu.Lock()
+		if time.Since(rl.lastStoreErr) > 30*time.Second {
+			rl.lastStoreErr = time.Now()
+			logger.Error.Printf("Rate limiter %q store unavailable, allowing requests: %v", rl.name, err)
 		}
+		rl.mu.Unlock()
 		return true
 	}
+	return allowed
+}
 
-	// Refill tokens based on elapsed time
-	elapsed := now.Sub(b.lastCheck).Seconds()
-	b.tokens += elapsed * rl.rate
-	if b.tokens > float64(rl.burst) {
-		b.tokens = float64(rl.burst)
-	}
-	b.lastCheck = now
-
-	if b.tokens >= 1 {
-		b.tokens--
-		return true
-	}
+// SetExemptions attaches the shared exemption rules checked before every request
+func (rl *RateLimiter) SetExemptions(e *RateLimitExemptions) {
+	rl.exemptions = e
+}
 
-	return false
+func (rl *RateLimiter) isExempt(r *http.Request) bool {
+	return rl.exemptions != nil && rl.exemptions.IsExempt(r)
 }
 
 // Middleware returns a Chi-compatible middleware that rate limits by IP.
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rl.isExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		key := extractIP(r)
 
 		if !rl.Allow(key) {
@@ -90,6 +114,11 @@ func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 // MiddlewareByAPIKey returns a middleware that rate limits by API key (falls back to IP).
 func (rl *RateLimiter) MiddlewareByAPIKey(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rl.isExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		key := r.Header.Get("X-API-Key")
 		if key == "" {
 			key = extractIP(r) // fallback to IP
@@ -105,37 +134,115 @@ func (rl *RateLimiter) MiddlewareByAPIKey(next http.Handler) http.Handler {
 	})
 }
 
-// extractIP gets the client IP from the request.
-func extractIP(r *http.Request) string {
-	// Check X-Forwarded-For first (for reverse proxies)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		return xff
+// BucketState is a point-in-time view of one key's bucket for the diagnostics page
+type BucketState struct {
+	Key       string
+	Tokens    float64
+	LastCheck time.Time
+}
+
+// LimiterState is a point-in-time view of a limiter's configuration and buckets
+type LimiterState struct {
+	Name          string
+	RatePerMinute float64
+	Burst         int
+	Backend       string
+	Buckets       []BucketState
+}
+
+// Snapshot returns the limiter configuration and current buckets. Tokens are
+// refilled to "now" for display; API keys are masked to their prefix.
+// Buckets are only listed for the in-memory store.
+func (rl *RateLimiter) Snapshot() LimiterState {
+	rl.mu.Lock()
+	rate, burst := rl.rate, rl.burst
+	rl.mu.Unlock()
+
+	state := LimiterState{
+		Name:          rl.name,
+		RatePerMinute: rate * 60,
+		Burst:         burst,
+		Backend:       "redis",
 	}
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+	if m, ok := rl.store.(*MemoryLimiterStore); ok {
+		state.Backend = "memory"
+		state.Buckets = m.snapshot(rate, burst)
 	}
-	// Fallback to RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
+	return state
+}
+
+// maskBucketKey hides API keys (64 hex chars) while leaving IPs readable
+func maskBucketKey(key string) string {
+	if net.ParseIP(key) != nil || len(key) <= 16 {
+		return key
 	}
-	return ip
+	return key[:8] + "..."
 }
 
-// cleanupLoop periodically removes stale buckets.
-func (rl *RateLimiter) cleanupLoop() {
-	ticker := time.NewTicker(rl.cleanup)
-	defer ticker.Stop()
+// RateLimitExemptions decides which requests skip rate limiting entirely.
+// It is shared by all limiters and updated on config reload.
+type RateLimitExemptions struct {
+	mu            sync.RWMutex
+	cidrs         []*net.IPNet
+	paths         []string
+	sessionBypass bool
 
-	for range ticker.C {
-		rl.mu.Lock()
-		now := time.Now()
-		for key, b := range rl.buckets {
-			// Remove if no activity for 10 minutes
-			if now.Sub(b.lastCheck) > 10*time.Minute {
-				delete(rl.buckets, key)
+	// hasAdminSession reports whether the request carries a valid admin session
+	hasAdminSession func(r *http.Request) bool
+}
+
+func NewRateLimitExemptions(hasAdminSession func(r *http.Request) bool) *RateLimitExemptions {
+	return &RateLimitExemptions{hasAdminSession: hasAdminSession}
+}
+
+// Apply replaces the exemption rules from config. Invalid CIDRs are skipped
+// (config validation rejects them before they get here).
+func (e *RateLimitExemptions) Apply(cfg *config.Config) {
+	var cidrs []*net.IPNet
+	for _, c := range cfg.RateLimitExemptCIDRs {
+		if ipNet, err := config.ParseCIDR(c); err == nil {
+			cidrs = append(cidrs, ipNet)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cidrs = cidrs
+	e.paths = append([]string{}, cfg.RateLimitExemptPaths...)
+	e.sessionBypass = cfg.RateLimitSessionBypass
+}
+
+// IsExempt checks the path prefixes, the client IP and finally the admin session
+func (e *RateLimitExemptions) IsExempt(r *http.Request) bool {
+	e.mu.RLock()
+	cidrs, paths, sessionBypass := e.cidrs, e.paths, e.sessionBypass
+	e.mu.RUnlock()
+
+	for _, p := range paths {
+		if strings.HasPrefix(r.URL.Path, p) {
+			return true
+		}
+	}
+
+	if len(cidrs) > 0 {
+		if ip := net.ParseIP(extractIP(r)); ip != nil {
+			for _, c := range cidrs {
+				if c.Contains(ip) {
+					return true
+				}
 			}
 		}
-		rl.mu.Unlock()
 	}
+
+	return sessionBypass && e.hasAdminSession != nil && e.hasAdminSession(r)
+}
+
+// Describe returns the active rules for the diagnostics page
+func (e *RateLimitExemptions) Describe() (cidrs []string, paths []string, sessionBypass bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, c := range e.cidrs {
+		cidrs = append(cidrs, c.String())
+	}
+	return cidrs, append([]string{}, e.paths...), e.sessionBypass
 }
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"dbbridge/internal/logger"
+	"dbbridge/internal/service"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// SettingsHandler serves the admin settings page: runtime settings grouped
+// into forms, and the test email for the SMTP setup
+type SettingsHandler struct {
+	templates   *Templates
+	settings    *service.SettingsService
+	mailer      *service.Mailer
+	sessionUser func(r *http.Request) int64
+}
+
+func NewSettingsHandler(templates *Templates, settings *service.SettingsService, mailer *service.Mailer, sessionUser func(r *http.Request) int64) *SettingsHandler {
+	return &SettingsHandler{
+		templates:   templates,
+		settings:    settings,
+		mailer:      mailer,
+		sessionUser: sessionUser,
+	}
+}
+
+// settingView is one field on the settings page
+type settingView struct {
+	service.SettingDef
+	Value      string
+	Default    string
+	Overridden bool
+}
+
+type settingGroup struct {
+	Name     string
+	Settings []settingView
+}
+
+func (h *SettingsHandler) groups() []settingGroup {
+	var groups []settingGroup
+	for _, def := range h.settings.Defs() {
+		view := settingView{
+			SettingDef: def,
+			Value:      h.settings.Get(def.Key),
+			Default:    h.settings.Default(def.Key),
+			Overridden: h.settings.IsOverridden(def.Key),
+		}
+		if def.Type == service.SettingSecret {
+			// Never send secrets back to the browser
+			view.Value, view.Default = "", ""
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Name != def.Group {
+			groups = append(groups, settingGroup{Name: def.Group})
+		}
+		g := &groups[len(groups)-1]
+		g.Settings = append(g.Settings, view)
+	}
+	return groups
+}
+
+func (h *SettingsHandler) render(w http.ResponseWriter, r *http.Request, extra map[string]interface{}) {
+	data := map[string]interface{}{
+		"Title":       "Settings",
+		"Groups":      h.groups(),
+		"MailEnabled": h.mailer.Config().Enabled(),
+		"NotifyTo":    strings.Join(h.mailer.Config().To, ", "),
+		"SMTPHost":    h.mailer.Config().Host,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	h.templates.Page(w, r, "settings.html", data)
+}
+
+func (h *SettingsHandler) SettingsPage(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, nil)
+}
+
+// SaveSettings applies one group's form. An empty field resets the setting to
+// its env default; for secrets an empty field keeps the stored value unless
+// "reset" is ticked.
+func (h *SettingsHandler) SaveSettings(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	group := r.FormValue("group")
+
+	var changes []service.SettingChange
+	for _, def := range h.settings.Defs() {
+		if def.Group != group {
+			continue
+		}
+		value := strings.TrimSpace(r.FormValue(def.Key))
+		switch {
+		case def.Type == service.SettingSecret && r.FormValue(def.Key+"_reset") != "":
+			changes = append(changes, service.SettingChange{Key: def.Key, Reset: true})
+		case def.Type == service.SettingSecret && value == "":
+			// keep
+		case value == "":
+			changes = append(changes, service.SettingChange{Key: def.Key, Reset: true})
+		default:
+			changes = append(changes, service.SettingChange{Key: def.Key, Value: value})
+		}
+	}
+
+	if err := h.settings.Update(h.sessionUser(r), changes); err != nil {
+		h.render(w, r, map[string]interface{}{"Error": err.Error()})
+		return
+	}
+	logger.Info.Printf("Settings updated: %s", group)
+	h.render(w, r, map[string]interface{}{"Success": h.templates.T(r, "flash.settings_saved", group)})
+}
+
+// SendTestEmail sends a test message synchronously and shows the SMTP result
+func (h *SettingsHandler) SendTestEmail(w http.ResponseWriter, r *http.Request) {
+	var to []string
+	for _, addr := range strings.Split(r.FormValue("to"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+
+	if err := h.mailer.SendTest(to); err != nil {
+		logger.Error.Printf("Test email failed: %v", err)
+		h.render(w, r, map[string]interface{}{"TestTo": strings.Join(to, ", "), "Error": h.templates.T(r, "flash.test_email_failed", err.Error())})
+		return
+	}
+	h.render(w, r, map[string]interface{}{"TestTo": strings.Join(to, ", "), "Success": h.templates.T(r, "flash.test_email_sent", strings.Join(to, ", "))})
+}
+
+// ToggleMaintenance switches maintenance mode from the layout banner or the
+// settings page (enabled=true|false) and returns to the page it came from
+func (h *SettingsHandler) ToggleMaintenance(w http.ResponseWriter, r *http.Request) {
+	on := r.FormValue("enabled") == "true"
+	if err := h.settings.SetMaintenance(h.sessionUser(r), on); err != nil {
+		h.render(w, r, map[string]interface{}{"Error": err.Error()})
+		return
+	}
+	logger.Info.Printf("Maintenance mode %s", map[bool]string{true: "enabled", false: "disabled"}[on])
+
+	back := r.Referer()
+	if back == "" {
+		back = "/admin/settings"
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+func (h *SettingsHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/admin/settings", h.SettingsPage)
+	r.Post("/admin/settings", h.SaveSettings)
+	r.Post("/admin/maintenance", h.ToggleMaintenance)
+	r.Post("/admin/settings/test-email", h.SendTestEmail)
+}
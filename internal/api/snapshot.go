@@ -0,0 +1,117 @@
+package api
+
+import (
+	"dbbridge/internal/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Chunk sizes of snapshot paging, see ?chunk_size=
+const (
+	defaultSnapshotChunk = 100
+	maxSnapshotChunk     = 10000
+)
+
+// SetSnapshots enables snapshot paging: ?snapshot=true on executions and
+// GET /api/snapshots/{token}
+func (h *Handler) SetSnapshots(s *service.SnapshotStore) {
+	h.snapshots = s
+}
+
+// openSnapshot runs a query into a snapshot and answers with its first chunk
+func (h *Handler) openSnapshot(w http.ResponseWriter, r *http.Request, connName, querySlug string, params map[string]interface{}, format *outputFormat) {
+	if h.snapshots == nil {
+		http.Error(w, "snapshot paging is not enabled", http.StatusBadRequest)
+		return
+	}
+	if format.Name != "json" {
+		http.Error(w, "snapshot paging answers JSON only", http.StatusNotAcceptable)
+		return
+	}
+	chunkSize := defaultSnapshotChunk
+	if v := r.URL.Query().Get("chunk_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSnapshotChunk {
+			http.Error(w, "chunk_size must be a number from 1 to "+strconv.Itoa(maxSnapshotChunk), http.StatusBadRequest)
+			return
+		}
+		chunkSize = n
+	}
+	write, err := h.executor.IsWriteQuery(querySlug)
+	if err != nil {
+		writeExecError(w, err)
+		return
+	}
+	if write {
+		http.Error(w, "queries that write cannot be paged by snapshot", http.StatusBadRequest)
+		return
+	}
+
+	start := time.Now()
+	page, err := h.snapshots.Open(r.Context(), connName, querySlug, params, chunkSize)
+	setDuration(w, start)
+	if err != nil {
+		writeSnapshotError(w, err)
+		return
+	}
+	writeSnapshotPage(w, page)
+}
+
+// SnapshotPage answers the chunk of a snapshot a paging token points to.
+// Asking for the same token again answers the same chunk, so retries are
+// safe.
+func (h *Handler) SnapshotPage(w http.ResponseWriter, r *http.Request) {
+	page, err := h.snapshots.Page(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		writeSnapshotError(w, err)
+		return
+	}
+	writeSnapshotPage(w, page)
+}
+
+func writeSnapshotPage(w http.ResponseWriter, page *service.SnapshotPage) {
+	meta := map[string]interface{}{
+		"columns":    page.Columns,
+		"offset":     page.Offset,
+		"total":      page.Total,
+		"expires_at": page.ExpiresAt,
+	}
+	if page.Keys != nil {
+		meta["keys"] = page.Keys
+	}
+	if page.NextToken != "" {
+		meta["next_token"] = page.NextToken
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(headerRows, strconv.Itoa(len(page.Data)))
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": page.Data, "meta": meta})
+}
+
+// writeSnapshotError answers snapshot failures with a code clients can act
+// on: snapshot_expired means paging restarts without a token
+func writeSnapshotError(w http.ResponseWriter, err error) {
+	var tooLarge *service.SnapshotTooLargeError
+	var limit *service.SnapshotLimitError
+	status, code := 0, ""
+	switch {
+	case errors.Is(err, service.ErrSnapshotExpired):
+		status, code = http.StatusGone, "snapshot_expired"
+	case errors.As(err, &tooLarge):
+		status, code = http.StatusUnprocessableEntity, "snapshot_too_large"
+	case errors.As(err, &limit) && limit.PerKey:
+		status, code = http.StatusTooManyRequests, "snapshot_limit"
+	case errors.As(err, &limit):
+		status, code = http.StatusServiceUnavailable, "snapshot_limit"
+	default:
+		writeExecError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error(), "code": code})
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"crypto/sha256"
+	"dbbridge/internal/logger"
+	"dbbridge/internal/service"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// specMaxAge is how long a cached spec is served before it is rebuilt
+// anyway: deprecations and sunsets take effect by date, not by an edit
+const specMaxAge = 5 * time.Minute
+
+// maxSpecVariants bounds the cached specs, as the base URL comes from the
+// request's Host unless BASE_URL is set; other variants are built per request
+const maxSpecVariants = 8
+
+// specVariant is what a spec depends on besides the repositories
+type specVariant struct {
+	groupByEnv bool
+	base       string
+}
+
+// cachedSpec is a built OpenAPI spec
+type cachedSpec struct {
+	body       []byte
+	etag       string
+	generation int64 // of the queries and connections it was built from
+	builtAt    time.Time
+}
+
+// SetGeneration caches the OpenAPI spec until g counts a change of the
+// queries or connections. The cached specs are then rebuilt in the
+// background, and served as they were until the rebuild completes.
+func (h *DocHandler) SetGeneration(g *service.Generation) {
+	h.generation = g
+	g.Watch(h.refresh)
+}
+
+// refresh rebuilds the cached specs in the background
+func (h *DocHandler) refresh() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for v := range h.specs {
+		h.startBuild(v)
+	}
+}
+
+// startBuild rebuilds the spec of v in the background, unless it is being
+// rebuilt already. A change made meanwhile makes it build again. h.mu is
+// held.
+func (h *DocHandler) startBuild(v specVariant) {
+	if h.building[v] {
+		return
+	}
+	h.building[v] = true
+	go func() {
+		for {
+			spec, err := h.build(v)
+			h.mu.Lock()
+			if err == nil {
+				h.specs[v] = spec
+			}
+			if err != nil || spec.generation == h.generation.Current() {
+				delete(h.building, v)
+				h.mu.Unlock()
+				if err != nil {
+					logger.Error.Printf("OpenAPI spec rebuild: %v", err)
+				}
+				return
+			}
+			h.mu.Unlock()
+		}
+	}()
+}
+
+// build builds the spec of v, noting the generation it reflects
+func (h *DocHandler) build(v specVariant) (*cachedSpec, error) {
+	var generation int64
+	if h.generation != nil {
+		generation = h.generation.Current()
+	}
+	body, err := h.buildSpec(v)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	return &cachedSpec{body: body, etag: `"` + hex.EncodeToString(sum[:16]) + `"`, generation: generation, builtAt: time.Now()}, nil
+}
+
+// spec returns the spec of v: the cached one, rebuilt in the background when
+// stale, or one built now when none is cached
+func (h *DocHandler) spec(v specVariant) (*cachedSpec, error) {
+	if h.generation == nil {
+		return h.build(v)
+	}
+	h.mu.Lock()
+	cached := h.specs[v]
+	if cached != nil && (cached.generation != h.generation.Current() || time.Since(cached.builtAt) > specMaxAge) {
+		h.startBuild(v)
+	}
+	h.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	spec, err := h.build(v)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	if _, ok := h.specs[v]; !ok && len(h.specs) < maxSpecVariants {
+		h.specs[v] = spec
+	}
+	h.mu.Unlock()
+	return spec, nil
+}
+
+// Rebuild builds the cached specs again now, e.g. after the metadata
+// database was edited by hand
+func (h *DocHandler) Rebuild() error {
+	h.mu.Lock()
+	variants := make([]specVariant, 0, len(h.specs))
+	for v := range h.specs {
+		variants = append(variants, v)
+	}
+	h.mu.Unlock()
+	for _, v := range variants {
+		spec, err := h.build(v)
+		if err != nil {
+			return err
+		}
+		h.mu.Lock()
+		h.specs[v] = spec
+		h.mu.Unlock()
+	}
+	return nil
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"dbbridge/internal/buildinfo"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Overall states of the status page
+const (
+	statusOK          = "ok"
+	statusDegraded    = "degraded" // a listed connection is down or degraded
+	statusMaintenance = "maintenance"
+)
+
+// StatusHandler serves the public status page: the version, maintenance
+// mode and the health of the connections flagged show_on_status_page, by
+// name only. It needs no login or API key, so it never shows connection
+// strings, drivers or queries.
+type StatusHandler struct {
+	templates *Templates
+	monitor   *service.HealthMonitor
+	settings  *service.SettingsService   // nil = no maintenance mode
+	metadata  func() core.MetadataStatus // nil = always ready
+}
+
+func NewStatusHandler(templates *Templates, monitor *service.HealthMonitor, settings *service.SettingsService) *StatusHandler {
+	return &StatusHandler{templates: templates, monitor: monitor, settings: settings}
+}
+
+// SetMetadataHealth makes /readyz answer 503 while fn reports the metadata
+// database unavailable
+func (h *StatusHandler) SetMetadataHealth(fn func() core.MetadataStatus) {
+	h.metadata = fn
+}
+
+// statusReport is the body of /status.json and the data of /status
+type statusReport struct {
+	Status      string                     `json:"status"`
+	Version     string                     `json:"version"`
+	Maintenance *maintenanceNotice         `json:"maintenance,omitempty"`
+	Connections []service.ConnectionHealth `json:"connections"`
+	GeneratedAt time.Time                  `json:"generated_at"`
+}
+
+type maintenanceNotice struct {
+	Message string `json:"message"`
+	Partial bool   `json:"partial"` // only some connections are paused
+}
+
+func (h *StatusHandler) report() (*statusReport, error) {
+	conns, err := h.monitor.Status()
+	if err != nil {
+		return nil, err
+	}
+	rep := &statusReport{Status: statusOK, Version: buildinfo.Version, Connections: conns, GeneratedAt: time.Now().UTC()}
+	for _, c := range conns {
+		if c.State == service.HealthDown || c.State == service.HealthDegraded {
+			rep.Status = statusDegraded
+		}
+	}
+	if h.settings != nil {
+		if m := h.settings.Maintenance(); m.Active {
+			rep.Maintenance = &maintenanceNotice{Message: m.Message, Partial: len(m.Connections) > 0}
+			if !rep.Maintenance.Partial {
+				rep.Status = statusMaintenance
+			}
+		}
+	}
+	return rep, nil
+}
+
+// Page renders the status page
+func (h *StatusHandler) Page(w http.ResponseWriter, r *http.Request) {
+	rep, err := h.report()
+	if err != nil {
+		logger.Error.Printf("Status page: %v", err)
+		http.Error(w, "Status unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if err := h.templates.Render(w, r, "status.html", rep); err != nil {
+		logger.Error.Printf("Status page: %v", err)
+	}
+}
+
+// JSON answers the status page as JSON
+func (h *StatusHandler) JSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	rep, err := h.report()
+	if err != nil {
+		logger.Error.Printf("Status page: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"error": "status unavailable"})
+		return
+	}
+	json.NewEncoder(w).Encode(rep)
+}
+
+// Ready is the readiness probe of load balancers and orchestrators: 200
+// while the metadata database answers, else 503 with its state. The
+// connections checked are counted by state, down apart from degraded; they
+// do not decide readiness, as other connections may still be served.
+func (h *StatusHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	status := core.MetadataStatus{State: core.MetadataOK}
+	if h.metadata != nil {
+		status = h.metadata()
+	}
+	ready := "ready"
+	if !status.OK() {
+		ready = "unavailable"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	body := map[string]interface{}{"status": ready, "metadata_db": status}
+	if h.monitor != nil {
+		if counts, err := h.monitor.Summary(); err == nil {
+			body["connections"] = counts
+		}
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+func (h *StatusHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/status", h.Page)
+	r.Get("/status.json", h.JSON)
+	r.Get("/readyz", h.Ready)
+}
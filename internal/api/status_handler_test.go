@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/data"
+	"dbbridge/internal/service"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatusPage(t *testing.T) {
+	dir := t.TempDir()
+	db, err := data.OpenDB(filepath.Join(dir, "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tmpl, err := NewTemplates("../../web/templates/*.html", templateFuncs(nil, nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crypto, err := service.NewEncryptionService("0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connRepo := data.NewConnectionRepo(db)
+	good, _ := crypto.Encrypt("file:" + filepath.Join(dir, "dbbridge.db"))
+	missing, _ := crypto.Encrypt("file:" + filepath.Join(dir, "missing.db"))
+	for _, c := range []core.DBConnection{
+		{Name: "orders", ConnectionStringEnc: good, ShowOnStatusPage: true, IsActive: true},
+		{Name: "billing", ConnectionStringEnc: missing, ShowOnStatusPage: true, IsActive: true},
+		{Name: "erp", ConnectionStringEnc: good, ShowOnStatusPage: true, IsActive: true, HealthQuery: "SELECT 1 WHERE 0"},
+		{Name: "internal-hr", ConnectionStringEnc: good, IsActive: true},
+	} {
+		c.Driver = "sqlite"
+		if err := connRepo.Create(&c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	executor := service.NewQueryExecutor(connRepo, data.NewQueryRepo(db), &recordedAudit{}, crypto, nil)
+	monitor := service.NewHealthMonitor(connRepo, executor, nil)
+	monitor.CheckAll(context.Background())
+	h := NewStatusHandler(tmpl, monitor, nil)
+
+	w := httptest.NewRecorder()
+	h.JSON(w, httptest.NewRequest("GET", "/status.json", nil))
+	var rep statusReport
+	if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Status != statusDegraded || len(rep.Connections) != 3 {
+		t.Fatalf("report = %+v", rep)
+	}
+	if c := rep.Connections[0]; c.Name != "billing" || c.State != service.HealthDown || c.CheckedAt == nil {
+		t.Errorf("billing = %+v", c)
+	}
+	if c := rep.Connections[1]; c.Name != "erp" || c.State != service.HealthDegraded {
+		t.Errorf("erp = %+v", c)
+	}
+	if c := rep.Connections[2]; c.Name != "orders" || c.State != service.HealthUp {
+		t.Errorf("orders = %+v", c)
+	}
+	// Reasons are for admins only
+	if strings.Contains(w.Body.String(), "no rows") {
+		t.Errorf("status.json shows the reason: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.Ready(w, httptest.NewRequest("GET", "/readyz", nil))
+	var ready struct {
+		Connections map[string]int `json:"connections"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &ready)
+	if c := ready.Connections; w.Code != http.StatusOK || c["up"] != 1 || c["degraded"] != 1 || c["down"] != 1 {
+		t.Errorf("readyz = %d %s, want 200 with one connection in each state", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.Page(w, httptest.NewRequest("GET", "/status", nil))
+	page := w.Body.String()
+	if !strings.Contains(page, "orders") || !strings.Contains(page, "billing") {
+		t.Errorf("page misses the listed connections:\n%s", page)
+	}
+	// Nothing but names and states: no unlisted connections, drivers or paths
+	for _, secret := range []string{"internal-hr", "sqlite", dir} {
+		if strings.Contains(page, secret) || strings.Contains(w.Body.String(), secret) {
+			t.Errorf("status page shows %q", secret)
+		}
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	h := NewStatusHandler(nil, nil, nil)
+	status := core.MetadataStatus{State: core.MetadataOK}
+	h.SetMetadataHealth(func() core.MetadataStatus { return status })
+	ready := func() int {
+		w := httptest.NewRecorder()
+		h.Ready(w, httptest.NewRequest("GET", "/readyz", nil))
+		return w.Code
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("healthy metadata database = %d, want 200", code)
+	}
+	status = core.MetadataStatus{State: core.MetadataLocked, Message: "locked by a backup"}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("locked metadata database = %d, want 503", code)
+	}
+}
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"crypto/rand"
+	"dbbridge/internal/buildinfo"
+	"dbbridge/internal/config"
+	"dbbridge/internal/core"
+	"dbbridge/internal/i18n"
+	"dbbridge/internal/logger"
+	"dbbridge/internal/service"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// templateFuncs is the one funcMap of the admin templates, so a reload parses
+// them exactly like startup did
+func templateFuncs(cfgStore *config.Store, settings *service.SettingsService) template.FuncMap {
+	return template.FuncMap{
+		"add":         func(a, b int) int { return a + b },
+		"sub":         func(a, b int) int { return a - b },
+		"hasPrefix":   strings.HasPrefix,
+		"join":        strings.Join,
+		"demoMode":    func() bool { return cfgStore != nil && cfgStore.Get().DemoMode },
+		"windowDays":  func() []string { return []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"} },
+		"formatBytes": formatBytes,
+		"now":         time.Now,
+		"auditParams": func(raw string) []auditParam { return formatAuditParams(raw, auditParamLimit) },
+		"truncate": func(s string, n int) string {
+			if r := []rune(s); len(r) > n {
+				return string(r[:n]) + "…"
+			}
+			return s
+		},
+		"maintenance": func() service.MaintenanceState {
+			if settings == nil {
+				return service.MaintenanceState{}
+			}
+			return settings.Maintenance()
+		},
+	}
+}
+
+// Templates is the admin UI template set shared by all handlers, parsed once
+// per locale with t and locale funcs bound to it. Reload swaps the parsed
+// sets atomically: renders in progress finish with the set they started
+// with, and sets that fail to parse are never installed.
+type Templates struct {
+	files         fs.FS // nil = pattern is a path on disk
+	pattern       string
+	funcs         template.FuncMap
+	sets          atomic.Pointer[map[string]*template.Template]
+	store         *sessions.CookieStore // signed-in user and flash messages, nil = none
+	defaultLocale func() string         // DEFAULT_LOCALE, nil = English
+	metadata      func() core.MetadataStatus
+}
+
+func NewTemplates(pattern string, funcs template.FuncMap, store *sessions.CookieStore) (*Templates, error) {
+	return NewTemplatesFS(nil, pattern, funcs, store)
+}
+
+// NewTemplatesFS parses the templates matching pattern in files, such as an
+// embedded set
+func NewTemplatesFS(files fs.FS, pattern string, funcs template.FuncMap, store *sessions.CookieStore) (*Templates, error) {
+	t := &Templates{files: files, pattern: pattern, funcs: funcs, store: store}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload parses the template files again, keeping the current sets on error
+func (t *Templates) Reload() error {
+	sets := make(map[string]*template.Template)
+	for _, locale := range i18n.Locales() {
+		funcs := template.FuncMap{
+			"t":      func(key string, args ...interface{}) string { return i18n.T(locale, key, args...) },
+			"locale": func() string { return locale },
+		}
+		set := template.New("layout.html").Funcs(t.funcs).Funcs(funcs)
+		var err error
+		if t.files != nil {
+			set, err = set.ParseFS(t.files, t.pattern)
+		} else {
+			set, err = set.ParseGlob(t.pattern)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse templates: %w", err)
+		}
+		sets[locale] = set
+	}
+	t.sets.Store(&sets)
+	return nil
+}
+
+// SetDefaultLocale sets where the language of users without one comes from
+func (t *Templates) SetDefaultLocale(fn func() string) {
+	t.defaultLocale = fn
+}
+
+// SetMetadataHealth sets where pages learn the health of the metadata
+// database, shown as a banner while it is unavailable
+func (t *Templates) SetMetadataHealth(fn func() core.MetadataStatus) {
+	t.metadata = fn
+}
+
+// Locale is the admin UI language of r: the one saved in the session at
+// sign-in or in My Profile, else DEFAULT_LOCALE
+func (t *Templates) Locale(r *http.Request) string {
+	if t.store != nil {
+		session, _ := t.store.Get(r, "dbbridge-session")
+		if locale, _ := session.Values["locale"].(string); i18n.Normalize(locale) != "" {
+			return i18n.Normalize(locale)
+		}
+	}
+	if t.defaultLocale != nil {
+		if locale := i18n.Normalize(t.defaultLocale()); locale != "" {
+			return locale
+		}
+	}
+	return i18n.DefaultLocale
+}
+
+// T translates a message of the catalog into the language of r
+func (t *Templates) T(r *http.Request, key string, args ...interface{}) string {
+	return i18n.T(t.Locale(r), key, args...)
+}
+
+func (t *Templates) set(locale string) *template.Template {
+	sets := *t.sets.Load()
+	if set, ok := sets[locale]; ok {
+		return set
+	}
+	return sets[i18n.DefaultLocale]
+}
+
+// ExecuteTemplate renders a standalone template such as the API docs of a
+// query, in English
+func (t *Templates) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	return t.set(i18n.DefaultLocale).ExecuteTemplate(w, name, data)
+}
+
+// Render renders a standalone template such as the login page in the
+// language of r
+func (t *Templates) Render(w io.Writer, r *http.Request, name string, data interface{}) error {
+	return t.set(t.Locale(r)).ExecuteTemplate(w, name, data)
+}
+
+// CurrentUser is the signed-in admin, available to every page
+type CurrentUser struct {
+	ID       int64
+	Username string
+}
+
+// RoleAdmin is the role of every signed-in user; there are no others yet
+const RoleAdmin = "admin"
+
+// sessionDataKey is the reserved key of the page session, both in the layout
+// data and in the map data of a page
+const sessionDataKey = "Session"
+
+// PageSession is what pages know of the request's session. A request without
+// one gets the zero value, so public pages render all the same.
+type PageSession struct {
+	User      CurrentUser
+	Role      string // RoleAdmin when signed in, "" otherwise
+	CSRFToken string // one per session, "" without one
+	Flashes   []Flash
+	Nav       string // the active nav section: dashboard, connections, queries...
+}
+
+// SignedIn reports whether the request carries a signed-in user
+func (s PageSession) SignedIn() bool {
+	return s.User.ID != 0
+}
+
+// Page renders a page inside the admin layout. Besides the page's own data
+// (as .Data) the layout gets .Page, .Path, .Version and the page session as
+// .Session. Map data gets the page session as "Session" too; the key is
+// reserved and overwritten.
+func (t *Templates) Page(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	sess := t.session(w, r)
+	if m, ok := data.(map[string]interface{}); ok {
+		m[sessionDataKey] = sess
+	}
+
+	layout := map[string]interface{}{
+		"Page":         name, // To identify active page
+		"Path":         r.URL.Path,
+		"Data":         data,
+		"Version":      buildinfo.Version,
+		sessionDataKey: sess,
+	}
+	if t.metadata != nil {
+		if status := t.metadata(); !status.OK() {
+			layout["Metadata"] = status
+		}
+	}
+	err := t.set(t.Locale(r)).ExecuteTemplate(w, "layout.html", layout)
+	if err != nil {
+		logger.Error.Printf("Failed to render %s: %v", name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// session reads the page session of r once: the signed-in user, takes the
+// pending flash messages and hands out the session's CSRF token, creating it
+// on the first page a user sees
+func (t *Templates) session(w http.ResponseWriter, r *http.Request) PageSession {
+	sess := PageSession{Nav: navSection(r.URL.Path)}
+	if t.store == nil {
+		return sess
+	}
+	session, _ := t.store.Get(r, "dbbridge-session")
+	sess.User.ID, _ = session.Values["user_id"].(int64)
+	sess.User.Username, _ = session.Values["username"].(string)
+	sess.Flashes = takeFlashes(session)
+	changed := len(sess.Flashes) > 0
+
+	if sess.SignedIn() {
+		sess.Role, _ = session.Values["role"].(string)
+		if sess.Role == "" {
+			// Sessions started before roles were recorded
+			sess.Role = RoleAdmin
+		}
+		sess.CSRFToken, _ = session.Values[csrfTokenKey].(string)
+		if sess.CSRFToken == "" {
+			sess.CSRFToken = newCSRFToken()
+			session.Values[csrfTokenKey] = sess.CSRFToken
+			changed = true
+		}
+	}
+	if changed {
+		session.Save(r, w)
+	}
+	return sess
+}
+
+// csrfTokenKey is the session value of the CSRF token
+const csrfTokenKey = "csrf_token"
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// navSection is the nav entry a path belongs to: the first segment after
+// /admin, dashboard for /admin itself
+func navSection(path string) string {
+	rest, ok := strings.CutPrefix(path, "/admin")
+	if !ok {
+		return ""
+	}
+	section, _, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+	if section == "" || section == "welcome" {
+		return "dashboard"
+	}
+	return section
+}
+
+// formatBytes writes a size as 512 B, 1.5 KB, 20.0 MB and so on
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestTemplatesRenderDuringReload(t *testing.T) {
+	tmpl, err := NewTemplates("../../web/templates/*.html", templateFuncs(nil, nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				if err := tmpl.Reload(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}
+	}()
+
+	var renders sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		renders.Add(1)
+		go func() {
+			defer renders.Done()
+			for j := 0; j < 20; j++ {
+				w := httptest.NewRecorder()
+				tmpl.Page(w, httptest.NewRequest("GET", "/admin/profile", nil), "profile.html", map[string]interface{}{"Title": "My Profile"})
+				if w.Code != 200 || !strings.Contains(w.Body.String(), "My Profile") {
+					t.Errorf("render during reload = %d %s", w.Code, w.Body.String())
+					return
+				}
+			}
+		}()
+	}
+	renders.Wait()
+	close(stop)
+	wg.Wait()
+}
+
+func TestTemplatesReloadKeepsSetOnError(t *testing.T) {
+	tmpl, err := NewTemplates("../../web/templates/*.html", templateFuncs(nil, nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.pattern = "testdata/missing/*.html"
+	if err := tmpl.Reload(); err == nil {
+		t.Fatal("Reload() of missing templates succeeded")
+	}
+	w := httptest.NewRecorder()
+	tmpl.Page(w, httptest.NewRequest("GET", "/admin", nil), "debug.html", map[string]interface{}{"Title": "Debug"})
+	if w.Code != 200 {
+		t.Errorf("render after failed reload = %d", w.Code)
+	}
+}
+
+func TestTemplatesLocale(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	tmpl, err := NewTemplates("../../web/templates/*.html", templateFuncs(nil, nil), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultLocale := ""
+	tmpl.SetDefaultLocale(func() string { return defaultLocale })
+
+	render := func(req *http.Request) string {
+		w := httptest.NewRecorder()
+		tmpl.Page(w, req, "profile.html", map[string]interface{}{"Title": "My Profile"})
+		return w.Body.String()
+	}
+	if body := render(httptest.NewRequest("GET", "/admin/profile", nil)); !strings.Contains(body, "Change Password") || !strings.Contains(body, `lang="en"`) {
+		t.Errorf("page without a locale is not English:\n%s", body)
+	}
+
+	// DEFAULT_LOCALE applies to users who have not picked a language
+	defaultLocale = "id"
+	if body := render(httptest.NewRequest("GET", "/admin/profile", nil)); !strings.Contains(body, "Ubah Kata Sandi") {
+		t.Errorf("page with DEFAULT_LOCALE=id is not Indonesian:\n%s", body)
+	}
+
+	// The language saved in the session wins
+	req := httptest.NewRequest("GET", "/admin/profile", nil)
+	rec := httptest.NewRecorder()
+	session, _ := store.Get(req, "dbbridge-session")
+	session.Values["locale"] = "en"
+	session.Save(req, rec)
+	req.AddCookie(rec.Result().Cookies()[0])
+	if body := render(req); !strings.Contains(body, "Change Password") {
+		t.Errorf("page with the session locale en is not English:\n%s", body)
+	}
+	if got := tmpl.T(req, "flash.query_saved", "orders"); got != "Query orders saved." {
+		t.Errorf("T() = %q", got)
+	}
+}
+
+func TestTemplatesPageSession(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	tmpl, err := NewTemplates("../../web/templates/*.html", templateFuncs(nil, nil), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a session the page renders with the zero page session
+	data := map[string]interface{}{"Title": "Debug", "Session": "page value"}
+	w := httptest.NewRecorder()
+	tmpl.Page(w, httptest.NewRequest("GET", "/admin/debug", nil), "debug.html", data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("page without a session = %d %s", w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); strings.Contains(body, "signed in as") || strings.Contains(body, "csrf-token") {
+		t.Errorf("page without a session shows a user:\n%s", body)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("page without a session set a cookie")
+	}
+	if sess, ok := data["Session"].(PageSession); !ok || sess.SignedIn() || sess.Nav != "debug" {
+		t.Errorf("page data Session = %#v", data["Session"])
+	}
+
+	// A signed-in session gets its user, role and a CSRF token that stays
+	req := httptest.NewRequest("GET", "/admin/profile", nil)
+	rec := httptest.NewRecorder()
+	session, _ := store.Get(req, "dbbridge-session")
+	session.Values["user_id"] = int64(7)
+	session.Values["username"] = "alice"
+	session.Save(req, rec)
+	cookies := rec.Result().Cookies()
+
+	render := func() PageSession {
+		req := httptest.NewRequest("GET", "/admin/profile", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		data := map[string]interface{}{"Title": "My Profile"}
+		w := httptest.NewRecorder()
+		tmpl.Page(w, req, "profile.html", data)
+		if !strings.Contains(w.Body.String(), "signed in as alice") {
+			t.Errorf("signed-in page lacks the user:\n%s", w.Body.String())
+		}
+		if next := w.Result().Cookies(); len(next) > 0 {
+			cookies = next
+		}
+		return data["Session"].(PageSession)
+	}
+	first := render()
+	if first.User != (CurrentUser{ID: 7, Username: "alice"}) || first.Role != RoleAdmin || first.Nav != "profile" {
+		t.Errorf("page session = %#v", first)
+	}
+	if len(first.CSRFToken) != 64 {
+		t.Errorf("CSRF token = %q", first.CSRFToken)
+	}
+	if second := render(); second.CSRFToken != first.CSRFToken {
+		t.Errorf("CSRF token changed from %q to %q", first.CSRFToken, second.CSRFToken)
+	}
+}
+
+func TestNavSection(t *testing.T) {
+	for path, want := range map[string]string{
+		"/admin":              "dashboard",
+		"/admin/":             "dashboard",
+		"/admin/welcome":      "dashboard",
+		"/admin/queries":      "queries",
+		"/admin/queries/edit": "queries",
+		"/admin/api-keys":     "api-keys",
+		"/admin/logs/12":      "logs",
+		"/status":             "",
+	} {
+		if got := navSection(path); got != want {
+			t.Errorf("navSection(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
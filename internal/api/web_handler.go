@@ -5,20 +5,22 @@ import (
 	"database/sql"
 	"dbbridge/internal/config"
 	"dbbridge/internal/core"
+	"dbbridge/internal/i18n"
 	"dbbridge/internal/logger"
 	"dbbridge/internal/service"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
+	"io/fs"
 	"net/http"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/sessions"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type WebHandler struct {
@@ -27,29 +29,89 @@ type WebHandler struct {
 	auditRepo    core.AuditRepository
 	userRepo     core.UserRepository
 	cryptoSvc    *service.EncryptionService
-	templates    *template.Template
+	templates    *Templates
 	apiKeyRepo   core.ApiKeyRepository
 	authSvc      *service.AuthService
-	config       *config.Config
+	config       *config.Store
 	executor     *service.QueryExecutor
+	settings     *service.SettingsService
+	secrets      *service.SecretResolver
+	sqlite       service.SQLiteFilePolicy
+	drivers      *service.DriverRegistry
+	events       *service.AdminAuditor
+	contracts    *service.ContractLog           // nil = contract changes not recorded
+	details      core.ExecutionDetailRepository // nil = no debug capture
+	usage        *service.UsageStats            // nil = no usage heatmaps
+	embeds       *service.EmbedService          // nil = no embed tokens
+	health       *service.HealthMonitor         // nil = no health on the connections page
+	docs         *DocHandler                    // nil = no rebuild docs action
 	sessionStore *sessions.CookieStore
 }
 
-func NewWebHandler(connRepo core.ConnectionRepository, queryRepo core.QueryRepository, auditRepo core.AuditRepository, userRepo core.UserRepository, apiKeyRepo core.ApiKeyRepository, authSvc *service.AuthService, cryptoSvc *service.EncryptionService, cfg *config.Config) *WebHandler {
-	funcMap := template.FuncMap{
-		"add": func(a, b int) int { return a + b },
-		"sub": func(a, b int) int { return a - b },
-	}
+// SetContractLog records the contract changes of query saves and deletes
+func (h *WebHandler) SetContractLog(l *service.ContractLog) {
+	h.contracts = l
+}
 
-	tmpl, err := template.New("layout.html").Funcs(funcMap).ParseGlob("web/templates/*.html")
-	if err != nil {
-		logger.Error.Fatalf("Failed to parse templates: %v", err)
-	}
+// SetSecretResolver enables vault: references for test runs and Test Connection
+func (h *WebHandler) SetSecretResolver(r *service.SecretResolver) {
+	h.secrets = r
+	h.executor.SetSecretResolver(r)
+}
+
+// SetSQLitePolicy restricts the files sqlite connections may open, in test
+// runs and Test Connection as well
+func (h *WebHandler) SetSQLitePolicy(p service.SQLiteFilePolicy) {
+	h.sqlite = p
+	h.executor.SetSQLitePolicy(p)
+}
 
-	executor := service.NewQueryExecutor(connRepo, queryRepo, auditRepo, cryptoSvc)
+// SetDetailRepo enables debug capture, for test runs as well, and shows the
+// captures on audit entries
+func (h *WebHandler) SetDetailRepo(repo core.ExecutionDetailRepository) {
+	h.details = repo
+	h.executor.SetDetailRepo(repo)
+}
+
+// SetUsageStats enables the usage heatmap of connections, on their page and
+// as JSON
+func (h *WebHandler) SetUsageStats(s *service.UsageStats) {
+	h.usage = s
+}
+
+// SetEmbeds enables embed token management on the query form
+func (h *WebHandler) SetEmbeds(s *service.EmbedService) {
+	h.embeds = s
+}
+
+// SetHealthMonitor shows the last health check of connections on the
+// connections page
+func (h *WebHandler) SetHealthMonitor(m *service.HealthMonitor) {
+	h.health = m
+}
+
+// SetDocs enables the rebuild docs action of the queries page
+func (h *WebHandler) SetDocs(d *DocHandler) {
+	h.docs = d
+}
+
+// TemplatePattern matches the admin templates in the files given to
+// NewWebHandler, os.DirFS("web/templates") in production
+const TemplatePattern = "*.html"
+
+func NewWebHandler(templateFiles fs.FS, connRepo core.ConnectionRepository, queryRepo core.QueryRepository, auditRepo core.AuditRepository, userRepo core.UserRepository, apiKeyRepo core.ApiKeyRepository, authSvc *service.AuthService, cryptoSvc *service.EncryptionService, cfgStore *config.Store, settingsSvc *service.SettingsService) *WebHandler {
+	executor := service.NewQueryExecutor(connRepo, queryRepo, auditRepo, cryptoSvc, settingsSvc)
 
 	// Create session store with the same key as AuthHandler
-	store := sessions.NewCookieStore([]byte(cfg.DbBridgeKey))
+	store := sessions.NewCookieStore([]byte(cfgStore.Get().DbBridgeKey))
+
+	tmpl, err := NewTemplatesFS(templateFiles, TemplatePattern, templateFuncs(cfgStore, settingsSvc), store)
+	if err != nil {
+		logger.Error.Fatalf("Failed to parse templates: %v", err)
+	}
+	if settingsSvc != nil {
+		tmpl.SetDefaultLocale(func() string { return settingsSvc.Get("DEFAULT_LOCALE") })
+	}
 
 	return &WebHandler{
 		connRepo:     connRepo,
@@ -59,37 +121,182 @@ func NewWebHandler(connRepo core.ConnectionRepository, queryRepo core.QueryRepos
 		cryptoSvc:    cryptoSvc,
 		apiKeyRepo:   apiKeyRepo,
 		authSvc:      authSvc,
-		config:       cfg,
+		config:       cfgStore,
 		templates:    tmpl,
 		executor:     executor,
+		settings:     settingsSvc,
+		drivers:      service.NewDriverRegistry(settingsSvc),
+		events:       service.NewAdminAuditor(auditRepo),
 		sessionStore: store,
 	}
 }
 
+// sessionUserID returns the logged-in admin's user ID, 0 without a session
+func (h *WebHandler) sessionUserID(r *http.Request) int64 {
+	session, _ := h.sessionStore.Get(r, "dbbridge-session")
+	userID, _ := session.Values["user_id"].(int64)
+	return userID
+}
+
+// sessionUsername returns the logged-in admin's username, recorded as the
+// last modifier of connections and queries
+func (h *WebHandler) sessionUsername(r *http.Request) string {
+	session, _ := h.sessionStore.Get(r, "dbbridge-session")
+	username, _ := session.Values["username"].(string)
+	return username
+}
+
+// actorName is the signed-in admin's username, or the admin API key of an
+// /api/admin request, recorded as the last modifier of queries
+func (h *WebHandler) actorName(r *http.Request) string {
+	if prefix, ok := r.Context().Value(core.ContextKeyApiKeyPrefix).(string); ok {
+		return "api key " + prefix + "..."
+	}
+	return h.sessionUsername(r)
+}
+
+// record writes an admin event for the signed-in user, or for the admin API
+// key of an /api/admin request and its owner
+func (h *WebHandler) record(r *http.Request, ev service.AdminEvent) {
+	ev.UserID = h.sessionUserID(r)
+	if keyID, ok := r.Context().Value(core.ContextKeyApiKeyID).(int64); ok {
+		ev.ApiKeyID = keyID
+		ev.UserID, _ = r.Context().Value(core.ContextKeyUserID).(int64)
+	}
+	ev.ClientIP = extractIP(r)
+	h.events.Record(ev)
+}
+
+// queryChanges diffs a query for an admin event. The SQL of a confidential
+// query is redacted while query_sql is encrypted and the params of audit
+// entries are not.
+func (h *WebHandler) queryChanges(before, after *core.SavedQuery) service.AuditChanges {
+	changes := service.DiffFields(before, after)
+	if (before != nil && before.Confidential) || (after != nil && after.Confidential) {
+		h.redactEncrypted(changes, core.EncryptQuerySQL, "sql_text")
+	}
+	return changes
+}
+
+// apiKeyChanges diffs an API key for an admin event, redacting the
+// description like queryChanges the SQL
+func (h *WebHandler) apiKeyChanges(before, after *core.ApiKey) service.AuditChanges {
+	changes := service.DiffFields(before, after)
+	h.redactEncrypted(changes, core.EncryptAPIKeyDescriptions, "description")
+	return changes
+}
+
+func (h *WebHandler) redactEncrypted(changes service.AuditChanges, group, field string) {
+	groups := h.config.Get().MetadataEncrypt
+	if !slices.Contains(groups, group) || slices.Contains(groups, core.EncryptAuditParams) {
+		return
+	}
+	if c, ok := changes[field]; ok {
+		if c.Old != nil {
+			c.Old = "********"
+		}
+		if c.New != nil {
+			c.New = "********"
+		}
+		changes[field] = c
+	}
+}
+
 // ... (Existing handlers) ...
 
+// auditPageSize is the number of entries per audit log page
+const auditPageSize = 100
+
 func (h *WebHandler) HandleAuditLogs(w http.ResponseWriter, r *http.Request) {
-	logs, err := h.auditRepo.GetRecent(100)
+	filter := r.URL.Query().Get("type")
+	userID, _ := strconv.ParseInt(r.URL.Query().Get("user"), 10, 64)
+	beforeID, _ := strconv.ParseInt(r.URL.Query().Get("before"), 10, 64)
+	logs, err := h.auditRepo.ListRecent(auditPageSize, filter, userID, beforeID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	h.render(w, "audit_logs.html", map[string]interface{}{
-		"Title": "Audit Logs",
-		"Logs":  logs,
+	var older int64 // the next page continues after the last entry shown
+	if len(logs) == auditPageSize {
+		older = logs[len(logs)-1].ID
+	}
+	users, _ := h.userRepo.GetAll()
+	h.render(w, r, "audit_logs.html", map[string]interface{}{
+		"Title":  "Audit Logs",
+		"Logs":   logs,
+		"Filter": filter,
+		"Users":  users,
+		"UserID": userID,
+		"Paged":  beforeID != 0,
+		"Older":  older,
 	})
 }
 
-// ReloadTemplates helper for development (optional)
-func (h *WebHandler) ReloadTemplates() {
-	funcMap := template.FuncMap{
-		"hasPrefix": strings.HasPrefix,
+// HandleAuditEntry shows one audit entry with the SQL its execution sent,
+// when the query had debug capture on
+func (h *WebHandler) HandleAuditEntry(w http.ResponseWriter, r *http.Request) {
+	data, ok := h.auditEntry(w, r)
+	if !ok {
+		return
 	}
-	var err error
-	h.templates, err = template.New("").Funcs(funcMap).ParseGlob("web/templates/*.html")
+	h.render(w, r, "audit_entry.html", data)
+}
+
+// replayPreviewRows caps the rows of a replay shown on the audit entry
+const replayPreviewRows = 50
+
+// ReplayAuditEntry runs the execution of an audit entry again and shows the
+// fresh result on the entry, see service.QueryExecutor.Replay. Queries that
+// write need the confirm_write box.
+func (h *WebHandler) ReplayAuditEntry(w http.ResponseWriter, r *http.Request) {
+	data, ok := h.auditEntry(w, r)
+	if !ok {
+		return
+	}
+	replay, err := h.executor.Replay(r.Context(), data["Log"].(*core.AuditLog), r.FormValue("confirm_write") == "on")
 	if err != nil {
-		fmt.Printf("CRITICAL: Failed to reload templates: %v\n", err)
+		data["ReplayError"] = err.Error()
+	}
+	data["Replay"] = replay
+	if replay != nil && replay.Result != nil {
+		data["ReplayColumns"] = replay.Result.Meta.RowKeys()
+		data["ReplayData"] = replay.Result.Data[:min(len(replay.Result.Data), replayPreviewRows)]
 	}
+	h.render(w, r, "audit_entry.html", data)
+}
+
+// auditEntry loads the {id} audit entry for its page; without one it has
+// answered 404
+func (h *WebHandler) auditEntry(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	entry, err := h.auditRepo.GetByID(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	var detail *core.ExecutionDetail
+	if h.details != nil {
+		if detail, err = h.details.Get(id); err != nil {
+			logger.Error.Printf("Audit entry %d: %v", id, err)
+		}
+	}
+	data := map[string]interface{}{
+		"Title":  "Audit Entry",
+		"Log":    entry,
+		"Detail": detail,
+	}
+	if _, write, err := h.executor.ReplayQuery(entry); err == nil {
+		data["Replayable"] = true
+		data["ReplayWrite"] = write
+		data["ReplayWritesOff"] = write && !h.executor.ReplayWrites()
+	}
+	return data, true
+}
+
+// ReloadTemplates parses the templates again, e.g. while editing them. Every
+// handler sharing the set picks up the result.
+func (h *WebHandler) ReloadTemplates() error {
+	return h.templates.Reload()
 }
 
 func (h *WebHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
@@ -102,6 +309,7 @@ func (h *WebHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 	// 2. Connections
 	conns, err := h.connRepo.GetAll()
 	activeConns := 0
+	needsSetup := err == nil && len(conns) == 0 // the setup wizard can be re-entered
 	if err == nil {
 		for _, c := range conns {
 			if c.IsActive {
@@ -128,7 +336,7 @@ func (h *WebHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 		userCount = len(users)
 	}
 
-	h.render(w, "dashboard.html", map[string]interface{}{
+	h.render(w, r, "dashboard.html", map[string]interface{}{
 		"Title":         "Dashboard",
 		"Logs":          logs,
 		"TotalConns":    len(conns),
@@ -136,6 +344,7 @@ func (h *WebHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 		"TotalQueries":  len(queries),
 		"ActiveQueries": activeQueries,
 		"TotalUsers":    userCount,
+		"NeedsSetup":    needsSetup,
 	})
 }
 
@@ -145,9 +354,14 @@ func (h *WebHandler) ConnectionsList(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	h.render(w, "connections.html", map[string]interface{}{
+	var health map[int64]service.ConnectionHealth
+	if h.health != nil {
+		health = h.health.States()
+	}
+	h.render(w, r, "connections.html", map[string]interface{}{
 		"Title":       "Connections",
 		"Connections": conns,
+		"Health":      health,
 	})
 }
 
@@ -157,9 +371,18 @@ func (h *WebHandler) QueriesList(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	h.render(w, "queries.html", map[string]interface{}{
+	// Queries whose executions stopped matching their captured response
+	// schema are flagged for a new capture
+	drifted := map[int64]bool{}
+	for _, q := range queries {
+		if schema, _ := service.ParseResponseSchema(q.ResponseSchema); schema != nil && schema.DriftAt != nil {
+			drifted[q.ID] = true
+		}
+	}
+	h.render(w, r, "queries.html", map[string]interface{}{
 		"Title":   "Queries",
 		"Queries": queries,
+		"Drifted": drifted,
 	})
 }
 
@@ -168,9 +391,10 @@ func (h *WebHandler) QueriesList(w http.ResponseWriter, r *http.Request) {
 func (h *WebHandler) ConnectionForm(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("id")
 	data := map[string]interface{}{
-		"IsEdit":           false,
-		"Connection":       core.DBConnection{},
-		"SupportedDrivers": h.config.SupportedDrivers,
+		"IsEdit":     false,
+		"Connection": core.DBConnection{},
+		"HealthRule": service.HealthRule{Kind: service.HealthRuleNonEmpty},
+		"Drivers":    h.drivers.Options(),
 	}
 
 	if idStr != "" {
@@ -180,16 +404,63 @@ func (h *WebHandler) ConnectionForm(w http.ResponseWriter, r *http.Request) {
 		if err == nil {
 			data["IsEdit"] = true
 			data["Connection"] = conn
+			data["HealthRule"], _ = service.ParseHealthRule(conn.HealthRule)
+			data["DriverDisabled"] = !h.drivers.Enabled(conn.Driver)
+			if h.usage != nil {
+				if heatmap, err := h.usage.Heatmap(conn.ID, defaultHeatmapWeeks, time.Now()); err != nil {
+					logger.Error.Printf("Usage of connection %s: %v", conn.Name, err)
+				} else {
+					data["Heatmap"] = heatmap
+				}
+			}
 
-			// Decrypt for display
-			decrypted, err := h.cryptoSvc.Decrypt(conn.ConnectionStringEnc)
-			if err == nil {
-				data["ConnectionStringDec"] = decrypted
+			// The stored string stays on the server unless revealed, see
+			// RevealConnectionString; a blank field keeps it on save
+			if service.IsSQLiteDriver(conn.Driver) {
+				decrypted, err := h.cryptoSvc.Decrypt(conn.ConnectionStringEnc)
+				if err == nil {
+					if expanded, err := service.ExpandConnectionVars(decrypted); err == nil {
+						data["SQLiteFile"] = h.sqlite.Stat(expanded)
+					}
+				}
 			}
 		}
 	}
 
-	h.render(w, "connection_form.html", data)
+	h.render(w, r, "connection_form.html", data)
+}
+
+// defaultHeatmapWeeks is the range of a usage heatmap without ?weeks=
+const defaultHeatmapWeeks = 4
+
+// ConnectionHeatmap answers the usage heatmap of the {id} connection as JSON,
+// over ?weeks= weeks
+func (h *WebHandler) ConnectionHeatmap(w http.ResponseWriter, r *http.Request) {
+	if h.usage == nil {
+		writeJSONError(w, http.StatusNotFound, "usage statistics are not enabled")
+		return
+	}
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	conn, err := h.connRepo.GetByID(id)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "connection not found")
+		return
+	}
+	weeks := defaultHeatmapWeeks
+	if v := r.URL.Query().Get("weeks"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > service.MaxHeatmapWeeks {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("weeks must be a number from 1 to %d", service.MaxHeatmapWeeks))
+			return
+		}
+		weeks = n
+	}
+	heatmap, err := h.usage.Heatmap(conn.ID, weeks, time.Now())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, heatmap)
 }
 
 func (h *WebHandler) SaveConnection(w http.ResponseWriter, r *http.Request) {
@@ -206,15 +477,25 @@ func (h *WebHandler) SaveConnection(w http.ResponseWriter, r *http.Request) {
 
 	idStr := r.FormValue("id")
 	name := r.FormValue("name")
-	driver := r.FormValue("driver")
+	driver := core.PresetDriver(r.FormValue("driver"))
 	rawConnStr := r.FormValue("connection_string")
+	dialect := strings.TrimSpace(r.FormValue("dialect"))
+	privateKey := strings.TrimSpace(r.FormValue("private_key"))
+	initOptions := strings.TrimSpace(r.FormValue("init_options"))
 	isActive := r.FormValue("is_active") == "on"
 
-	var conn *core.DBConnection
+	var conn, before *core.DBConnection
 	if idStr != "" {
 		// Update
 		id, _ := strconv.ParseInt(idStr, 10, 64)
 		conn, _ = h.connRepo.GetByID(id)
+		if conn == nil {
+			h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.connection_not_found"))
+			http.Redirect(w, r, "/admin/connections", http.StatusFound)
+			return
+		}
+		saved := *conn
+		before = &saved
 	} else {
 		// New
 		conn = &core.DBConnection{}
@@ -222,31 +503,261 @@ func (h *WebHandler) SaveConnection(w http.ResponseWriter, r *http.Request) {
 
 	conn.Name = core.Slugify(name)
 	conn.Driver = driver
+	conn.Dialect = dialect
+	conn.InitOptions = initOptions
+	conn.PingQuery = strings.TrimSpace(r.FormValue("ping_query"))
+	conn.HealthQuery = strings.TrimSpace(r.FormValue("health_query"))
+	conn.HealthRule = ""
+	if conn.HealthQuery != "" {
+		conn.HealthRule = strings.TrimSpace(r.FormValue("health_rule") + " " + r.FormValue("health_rule_value"))
+	}
+	conn.SkipPing = r.FormValue("skip_ping") == "on"
+	conn.BindMode = r.FormValue("bind_mode")
+	conn.StripComments = r.FormValue("strip_comments") == "on"
+	conn.AllowedSchemas = strings.TrimSpace(r.FormValue("allowed_schemas"))
+	conn.Production = r.FormValue("production") == "on"
+	conn.Protected = r.FormValue("protected") == "on"
+	conn.Environment = core.Slugify(r.FormValue("environment"))
+	conn.ShowOnStatusPage = r.FormValue("show_on_status_page") == "on"
+	conn.DefaultParams = strings.TrimSpace(r.FormValue("default_params"))
 	conn.IsActive = isActive
 
+	errs := h.validateConnection(r, conn, name, rawConnStr, privateKey)
+	renderForm := func(msg string) {
+		conn.Name = name // as typed
+		rule, _ := service.ParseHealthRule(conn.HealthRule)
+		h.render(w, r, "connection_form.html", map[string]interface{}{
+			"IsEdit":              conn.ID != 0,
+			"Connection":          conn,
+			"HealthRule":          rule,
+			"ConnectionStringDec": rawConnStr,
+			"Drivers":             h.drivers.Options(),
+			"Errors":              errs,
+			"Error":               msg,
+		})
+	}
+	if len(errs) > 0 {
+		renderForm(h.templates.T(r, "form.error_summary"))
+		return
+	}
+
+	// Secrets are audited as changed/unchanged only
+	connStrChanged := rawConnStr != ""
+	if connStrChanged && before != nil {
+		oldConnStr, _ := h.cryptoSvc.Decrypt(before.ConnectionStringEnc)
+		connStrChanged = oldConnStr != rawConnStr
+	}
+
 	// Only update password if provided or new
 	if rawConnStr != "" {
 		encStr, err := h.cryptoSvc.Encrypt(rawConnStr)
 		if err != nil {
-			http.Error(w, "Encryption failed: "+err.Error(), http.StatusInternalServerError)
+			renderForm("Encryption failed: " + err.Error())
 			return
 		}
 		conn.ConnectionStringEnc = encStr
 	}
 
+	// Like the connection string, a stored key is only replaced when a new one is pasted
+	if r.FormValue("remove_private_key") == "on" {
+		conn.CredentialsEnc = ""
+	}
+	if privateKey != "" {
+		credsJSON, _ := json.Marshal(core.ConnectionCredentials{PrivateKey: privateKey})
+		encCreds, err := h.cryptoSvc.Encrypt(string(credsJSON))
+		if err != nil {
+			renderForm("Encryption failed: " + err.Error())
+			return
+		}
+		conn.CredentialsEnc = encCreds
+	}
+
+	conn.UpdatedBy = h.sessionUsername(r)
+	event := core.EventConnectionCreate
+	var saveErr error
 	if conn.ID != 0 {
-		h.connRepo.Update(conn)
+		event = core.EventConnectionUpdate
+		saveErr = h.connRepo.Update(conn)
 	} else {
-		h.connRepo.Create(conn)
+		saveErr = h.connRepo.Create(conn)
+	}
+
+	changes := service.DiffFields(before, conn)
+	changes.Redacted("connection_string", connStrChanged)
+	changes.Redacted("private_key", privateKey != "" || (before != nil && before.CredentialsEnc != conn.CredentialsEnc))
+	// Default params are kept out of JSON, so DiffFields does not see them
+	oldParams := ""
+	if before != nil {
+		oldParams = before.DefaultParams
+	}
+	if oldParams != conn.DefaultParams {
+		changes["default_params"] = service.FieldChange{Old: oldParams, New: conn.DefaultParams}
+	}
+	ev := service.AdminEvent{Type: event, Target: "connection " + conn.Name, ConnectionID: conn.ID, Changes: changes}
+	if saveErr != nil {
+		ev.Error = saveErr.Error()
 	}
+	h.record(r, ev)
 
+	if saveErr != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.connection_save_failed", conn.Name, saveErr.Error()))
+	} else {
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.connection_saved", conn.Name))
+		// The static check only warns: the driver may read what it doubts
+		if rawConnStr != "" {
+			if findings := h.checkDSN(conn.Driver, rawConnStr, privateKey); len(findings) > 0 {
+				h.SetFlash(w, r, FlashWarning, h.templates.T(r, "flash.connection_dsn_findings", conn.Name, formatDSNFindings(findings)))
+			}
+		}
+	}
 	http.Redirect(w, r, "/admin/connections", http.StatusFound)
 }
 
+// ValidateConnection checks a connection string without connecting, for when
+// the database is out of reach, and answers the findings as JSON
+func (h *WebHandler) ValidateConnection(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	driver := core.PresetDriver(r.FormValue("driver"))
+	if driver == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Driver is required"})
+		return
+	}
+	findings := h.checkDSN(driver, r.FormValue("connection_string"), strings.TrimSpace(r.FormValue("private_key")))
+	if findings == nil {
+		findings = []service.DSNFinding{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"valid": len(findings) == 0, "findings": findings})
+}
+
+// checkDSN runs service.CheckDSN on connStr with the ${DBB_VAR_...}
+// placeholders that resolve here filled in
+func (h *WebHandler) checkDSN(driver, connStr, privateKey string) []service.DSNFinding {
+	if expanded, err := service.ExpandConnectionVars(connStr); err == nil {
+		connStr = expanded
+	}
+	var creds *core.ConnectionCredentials
+	if privateKey != "" {
+		creds = &core.ConnectionCredentials{PrivateKey: privateKey}
+	}
+	return service.CheckDSN(driver, connStr, creds)
+}
+
+// formatDSNFindings lists findings on one line for a flash message
+func formatDSNFindings(findings []service.DSNFinding) string {
+	parts := make([]string, len(findings))
+	for i, f := range findings {
+		parts[i] = f.Message
+		if f.Field != "" {
+			parts[i] = f.Field + ": " + f.Message
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// validateConnection checks a submitted connection form; name is the name as
+// typed, before slugifying
+func (h *WebHandler) validateConnection(r *http.Request, conn *core.DBConnection, name, rawConnStr, privateKey string) formErrors {
+	errs := formErrors{}
+	if strings.TrimSpace(name) == "" {
+		errs.add("name", h.templates.T(r, "validation.name_required"))
+	} else if conn.Name == "" {
+		errs.add("name", h.templates.T(r, "validation.name_invalid"))
+	} else if existing, err := h.connRepo.GetByName(conn.Name); err == nil && existing.ID != conn.ID {
+		errs.add("name", h.templates.T(r, "validation.connection_exists", conn.Name))
+	}
+	if conn.Driver == "" {
+		errs.add("driver", h.templates.T(r, "validation.preset_required"))
+		return errs
+	}
+	// A connection keeps a driver it already has, even one disabled since
+	kept := false
+	if conn.ID != 0 {
+		saved, err := h.connRepo.GetByID(conn.ID)
+		kept = err == nil && saved.Driver == conn.Driver
+	}
+	if !kept && !core.KnownDriver(conn.Driver) {
+		errs.add("driver", h.templates.T(r, "validation.driver_unknown", conn.Driver))
+		return errs
+	}
+	if !kept && !h.drivers.Enabled(conn.Driver) {
+		errs.add("driver", h.templates.T(r, "validation.driver_disabled", conn.Driver))
+		return errs
+	}
+	if conn.ID == 0 && rawConnStr == "" {
+		errs.add("connection_string", h.templates.T(r, "validation.connection_string_required"))
+	}
+	if conn.Dialect != "" {
+		if _, err := core.ParseDialect(conn.Dialect, conn.Driver); err != nil {
+			errs.add("dialect", err.Error())
+		}
+	}
+	if conn.BindMode != core.BindModeNative && conn.BindMode != core.BindModeString {
+		errs.add("bind_mode", h.templates.T(r, "validation.bind_mode_unknown", conn.BindMode))
+	}
+	if _, err := service.ParseAllowedSchemas(conn.AllowedSchemas); err != nil {
+		errs.add("allowed_schemas", err.Error())
+	}
+	if _, err := service.ParseConnectionParams(conn.DefaultParams); err != nil {
+		errs.add("default_params", err.Error())
+	}
+	if core.IsWriteSQL(conn.HealthQuery) {
+		errs.add("health_query", h.templates.T(r, "validation.health_query_write"))
+	}
+	if _, err := service.ParseHealthRule(conn.HealthRule); err != nil {
+		errs.add("health_rule", err.Error())
+	}
+
+	// Check the connection string, key and init options together. ${DBB_VAR_...}
+	// placeholders may only be set where the connection is deployed, so the
+	// checks are skipped when they do not resolve here.
+	connStr := rawConnStr
+	if connStr == "" && conn.ConnectionStringEnc != "" {
+		connStr, _ = h.cryptoSvc.Decrypt(conn.ConnectionStringEnc)
+	}
+	if expanded, err := service.ExpandConnectionVars(connStr); connStr != "" && err == nil {
+		if rawConnStr != "" {
+			if err := service.ValidateDSN(conn.Driver, expanded); err != nil {
+				errs.add("connection_string", err.Error())
+				return errs
+			}
+		}
+		var creds *core.ConnectionCredentials
+		if privateKey != "" {
+			creds = &core.ConnectionCredentials{PrivateKey: privateKey}
+		}
+		if service.IsSQLiteDriver(conn.Driver) {
+			if _, err := h.sqlite.Apply(expanded); errors.Is(err, service.ErrSQLiteOutsideBase) {
+				errs.add("connection_string", err.Error())
+				return errs
+			}
+		}
+		if _, err := service.ConnectionDSN(conn.Driver, expanded, creds, conn.InitOptions); err != nil {
+			field := "connection_string"
+			if conn.InitOptions != "" {
+				field = "init_options"
+			} else if privateKey != "" {
+				field = "private_key"
+			}
+			errs.add(field, err.Error())
+		}
+	}
+	return errs
+}
+
 func (h *WebHandler) DeleteConnection(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("id")
 	id, _ := strconv.ParseInt(idStr, 10, 64)
-	h.connRepo.Delete(id)
+	before, err := h.connRepo.GetByID(id)
+	if err != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.connection_not_found"))
+	} else if err := h.connRepo.Delete(id); err != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.connection_delete_failed", before.Name, err.Error()))
+	} else {
+		h.record(r, service.AdminEvent{Type: core.EventConnectionDelete, Target: "connection " + before.Name,
+			Changes: service.DiffFields(before, nil)})
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.connection_deleted", before.Name))
+	}
 	http.Redirect(w, r, "/admin/connections", http.StatusFound)
 }
 
@@ -257,18 +768,71 @@ func (h *WebHandler) TestConnection(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	driver := r.FormValue("driver")
+	driver := core.PresetDriver(r.FormValue("driver"))
 	connStr := r.FormValue("connection_string")
+	var creds *core.ConnectionCredentials
+	if key := strings.TrimSpace(r.FormValue("private_key")); key != "" {
+		creds = &core.ConnectionCredentials{PrivateKey: key}
+	}
+
+	// Editing a connection, a blank string tests the stored one (and the
+	// stored key unless one is pasted), decrypted here only
+	source := "provided"
+	if connStr == "" && r.FormValue("id") != "" {
+		id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+		stored, err := h.storedConnection(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		connStr, source = stored.connStr, "stored"
+		if creds == nil && r.FormValue("remove_private_key") != "on" {
+			creds = stored.creds
+		}
+	}
+	w.Header().Set("X-DbBridge-Connection-Source", source)
 
 	if driver == "" || connStr == "" {
 		http.Error(w, "Driver and Connection String are required", http.StatusBadRequest)
 		return
 	}
+	connStr, err := service.ExpandConnectionVars(connStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	connStr, err = h.secrets.Resolve(r.Context(), connStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := service.ValidateDSN(driver, connStr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dsn, err := service.ConnectionDSN(driver, connStr, creds, r.FormValue("init_options"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// A missing sqlite file would otherwise be created empty and pass
+	if service.IsSQLiteDriver(driver) {
+		if dsn, err = h.sqlite.Apply(dsn); err != nil {
+			http.Error(w, "Connection failed: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	dialect, err := core.DialectFor(r.FormValue("dialect"), driver, connStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Try to connect
 	// Note: You might need to import the driver packages if they aren't already imported in main.go
 	// Since main.go imports modernc.org/sqlite, and likely others should be imported there using _
-	db, err := sql.Open(driver, connStr)
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		http.Error(w, "Failed to open connection: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -278,15 +842,74 @@ func (h *WebHandler) TestConnection(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	if err := db.PingContext(ctx); err != nil {
+	if err := service.PingDB(ctx, db, strings.TrimSpace(r.FormValue("ping_query")), dialect); err != nil {
 		http.Error(w, "Connection failed: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
+	if source == "stored" {
+		w.Write([]byte("Connection successful! (tested the saved connection string)"))
+		return
+	}
 	w.Write([]byte("Connection successful!"))
 }
 
+// storedSecrets are the decrypted secrets of a saved connection
+type storedSecrets struct {
+	connStr string
+	creds   *core.ConnectionCredentials // nil for none
+}
+
+// storedConnection decrypts the connection string and credentials of the
+// saved connection id, for server-side use only
+func (h *WebHandler) storedConnection(id int64) (*storedSecrets, error) {
+	conn, err := h.connRepo.GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("connection not found")
+	}
+	connStr, err := h.cryptoSvc.Decrypt(conn.ConnectionStringEnc)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt the saved connection string: %w", err)
+	}
+	s := &storedSecrets{connStr: connStr}
+	if conn.CredentialsEnc != "" {
+		credsJSON, err := h.cryptoSvc.Decrypt(conn.CredentialsEnc)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt the saved credentials: %w", err)
+		}
+		s.creds = &core.ConnectionCredentials{}
+		if err := json.Unmarshal([]byte(credsJSON), s.creds); err != nil {
+			return nil, fmt.Errorf("invalid saved credentials: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// RevealConnectionString answers the decrypted connection string of a saved
+// connection, for the form's Reveal button. Every reveal is audited.
+func (h *WebHandler) RevealConnectionString(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	conn, err := h.connRepo.GetByID(id)
+	if err != nil {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return
+	}
+	connStr, err := h.cryptoSvc.Decrypt(conn.ConnectionStringEnc)
+	ev := service.AdminEvent{Type: core.EventConnectionReveal, Target: "connection " + conn.Name, ConnectionID: conn.ID}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	h.record(r, ev)
+	if err != nil {
+		http.Error(w, "Cannot decrypt the connection string", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"connection_string": connStr})
+}
+
 // RunQuery executes a raw SQL query against a specific connection (for testing)
 func (h *WebHandler) RunQuery(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -294,11 +917,21 @@ func (h *WebHandler) RunQuery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// JSON answers with the whole result for the query form; ?format=csv and
+	// the other registered formats download it like the API would answer
+	format, err := negotiateFormat(r)
+	if err != nil {
+		writeNotAcceptable(w, err)
+		return
+	}
+
 	var params map[string]interface{}
 	var connID int64
 	var queryID int64
 	var sqlText string
-	var err error
+	var ignoreWindow bool
+	var sample bool
+	var confirm string // the connection's name, typed to run SQL that writes
 
 	// Check content type to handle JSON or Form
 	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
@@ -307,6 +940,9 @@ func (h *WebHandler) RunQuery(w http.ResponseWriter, r *http.Request) {
 			QueryID      int64                  `json:"query_id"`
 			SQLText      string                 `json:"sql_text"`
 			Params       map[string]interface{} `json:"params"`
+			IgnoreWindow bool                   `json:"ignore_window"`
+			Sample       bool                   `json:"sample"`
+			Confirm      string                 `json:"confirm_connection"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			w.Header().Set("Content-Type", "application/json")
@@ -318,6 +954,9 @@ func (h *WebHandler) RunQuery(w http.ResponseWriter, r *http.Request) {
 		queryID = req.QueryID
 		sqlText = req.SQLText
 		params = req.Params // Can be nil
+		ignoreWindow = req.IgnoreWindow
+		sample = req.Sample
+		confirm = req.Confirm
 	} else {
 		// Fallback to Form (existing behavior)
 		connIDStr := r.FormValue("connection_id")
@@ -339,6 +978,9 @@ func (h *WebHandler) RunQuery(w http.ResponseWriter, r *http.Request) {
 		if queryIDStr != "" {
 			queryID, _ = strconv.ParseInt(queryIDStr, 10, 64)
 		}
+		ignoreWindow = r.FormValue("ignore_window") == "on"
+		sample = r.FormValue("sample") == "on"
+		confirm = r.FormValue("confirm_connection")
 		// Form doesn't easily support map params without convention.
 		// For now, keep params empty for Form.
 		params = make(map[string]interface{})
@@ -348,15 +990,52 @@ func (h *WebHandler) RunQuery(w http.ResponseWriter, r *http.Request) {
 		params = make(map[string]interface{})
 	}
 
-	result, err := h.executor.ExecuteSQL(r.Context(), connID, sqlText, params, queryID)
+	ctx := r.Context()
+	if ignoreWindow {
+		ctx = service.WithWindowOverride(ctx)
+	}
+	if sample {
+		ctx = service.WithSample(ctx, service.SampleRows)
+	}
+
+	// Runs on a protected connection always have its row cap and timeout;
+	// typing its name only lets SQL that writes run. Both that and a name
+	// that does not match are audited.
+	if conn, err := h.connRepo.GetByID(connID); err == nil && conn.Protected {
+		guard := service.ProtectedGuardrails(h.settings)
+		ev := service.AdminEvent{Type: core.EventConnectionGuardOverride, Target: "connection " + conn.Name,
+			ConnectionID: conn.ID, QueryID: queryID, Changes: service.AuditChanges{"sql": {New: sqlText}}}
+		switch confirm {
+		case "":
+		case conn.Name:
+			guard.AllowWrite = true
+			h.record(r, ev)
+		default:
+			ev.Denied, ev.Error = true, "the connection name typed does not match"
+			h.record(r, ev)
+			writeConfirmConnection(w, "The name typed does not match the connection's name.")
+			return
+		}
+		ctx = service.WithGuardrails(ctx, guard)
+	}
+
+	result, err := h.executor.ExecuteSQL(ctx, connID, sqlText, params, queryID)
+	if errors.Is(err, service.ErrProtectedWrite) {
+		writeConfirmConnection(w, service.ErrorDetail(err))
+		return
+	}
 	if err != nil {
 		// Return JSON error to be friendly to frontend fetch
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, `{"error": "%s"}`, strings.ReplaceAll(err.Error(), "\"", "\\\""))
+		fmt.Fprintf(w, `{"error": "%s"}`, strings.ReplaceAll(service.ErrorDetail(err), "\"", "\\\""))
 		return
 	}
 
+	if format.Name != "json" {
+		format.Write(w, result)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 
 	// Manual JSON marshaling to avoid importing "encoding/json" if not already there?
@@ -374,6 +1053,144 @@ func (h *WebHandler) RunQuery(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewEncoder(w).Encode(result); err != nil {
 		http.Error(w, "Failed to encode result", http.StatusInternalServerError)
 	}
+
+	// Queries opted in keep their last successful run of the saved SQL as
+	// their OpenAPI example
+	if queryID != 0 {
+		if q, err := h.queryRepo.GetByID(queryID); err == nil && q.RecordExample && q.SQLText == sqlText {
+			if err := h.recordExample(r, q, params, result); err != nil {
+				logger.Info.Printf("Example of query %s not recorded: %v", q.Slug, err)
+			}
+		}
+	}
+}
+
+// writeConfirmConnection answers a test run on a protected connection that
+// needs its name typed to go ahead
+func writeConfirmConnection(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"error": message, "code": "confirm_connection"})
+}
+
+// DiffQuery runs a saved query on two connections and returns a comparison
+// summary, e.g. to verify a migrated database returns the same data.
+// The key is a column name, or a comma separated list for a composite key.
+func (h *WebHandler) DiffQuery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	queryID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid Query ID"})
+		return
+	}
+
+	var req struct {
+		ConnectionA int64                  `json:"connection_a"`
+		ConnectionB int64                  `json:"connection_b"`
+		Key         string                 `json:"key"`
+		Params      map[string]interface{} `json:"params"`
+		MaxRows     int                    `json:"max_rows"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if req.Params == nil {
+		req.Params = make(map[string]interface{})
+	}
+
+	var keyColumns []string
+	for _, k := range strings.Split(req.Key, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keyColumns = append(keyColumns, k)
+		}
+	}
+
+	result, err := h.executor.DiffQuery(r.Context(), h.sessionUserID(r), queryID, service.DiffOptions{
+		ConnectionA: req.ConnectionA,
+		ConnectionB: req.ConnectionB,
+		Params:      req.Params,
+		KeyColumns:  keyColumns,
+		MaxRows:     req.MaxRows,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// BenchmarkQuery runs a saved query repeatedly on one connection and returns
+// its latency spread, see service.QueryExecutor.BenchmarkQuery
+func (h *WebHandler) BenchmarkQuery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	queryID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid Query ID"})
+		return
+	}
+
+	var req struct {
+		ConnectionID      int64                  `json:"connection_id"`
+		Params            map[string]interface{} `json:"params"`
+		Iterations        int                    `json:"iterations"`
+		Concurrency       int                    `json:"concurrency"`
+		ConfirmProduction bool                   `json:"confirm_production"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if req.Params == nil {
+		req.Params = make(map[string]interface{})
+	}
+
+	result, err := h.executor.BenchmarkQuery(r.Context(), h.sessionUserID(r), queryID, service.BenchmarkOptions{
+		ConnectionID:      req.ConnectionID,
+		Params:            req.Params,
+		Iterations:        req.Iterations,
+		Concurrency:       req.Concurrency,
+		ConfirmProduction: req.ConfirmProduction,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// ExecutionsList shows the executions in flight
+func (h *WebHandler) ExecutionsList(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, "executions.html", map[string]interface{}{
+		"Title":      "Running Executions",
+		"Executions": h.executor.Executions().List(),
+	})
+}
+
+// CancelExecution cancels an execution in flight; it ends with a CANCELLED
+// audit entry and its caller gets a 499
+func (h *WebHandler) CancelExecution(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	x, ok := h.executor.Executions().Cancel(id)
+	if !ok {
+		h.SetFlash(w, r, FlashWarning, h.templates.T(r, "flash.execution_finished"))
+	} else {
+		target := "connection " + x.Connection
+		if x.QuerySlug != "" {
+			target = "query " + x.QuerySlug + " on " + target
+		}
+		h.record(r, service.AdminEvent{Type: core.EventQueryCancel, Target: target})
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.execution_cancelled"))
+	}
+	http.Redirect(w, r, "/admin/executions", http.StatusFound)
 }
 
 // --- Queries Form Handlers ---
@@ -400,10 +1217,110 @@ func (h *WebHandler) QueryForm(w http.ResponseWriter, r *http.Request) {
 		if err == nil {
 			data["IsEdit"] = true
 			data["Query"] = q
+			data["Aliases"], _ = h.queryRepo.ListAliases(q.ID)
+			if window, _ := service.ParseExecWindow(q.ExecWindow); window != nil {
+				data["Window"] = window
+			}
+			if ex, _ := service.ParseQueryExample(q.Example); ex != nil {
+				pretty, _ := json.MarshalIndent(map[string]interface{}{"params": ex.Params, "data": ex.Data}, "", "  ")
+				data["Example"] = ex
+				data["ExampleJSON"] = string(pretty)
+			}
+			if schema, _ := service.ParseResponseSchema(q.ResponseSchema); schema != nil {
+				data["ResponseSchema"] = schema
+			}
+			var schemaConns []core.DBConnection
+			for _, c := range conns {
+				if allowsConnection(q, c.ID) {
+					schemaConns = append(schemaConns, c)
+				}
+			}
+			data["SchemaConnections"] = schemaConns
+			if h.embeds != nil {
+				data["EmbedsEnabled"] = true
+				data["Embeds"], data["EmbedConnections"] = h.queryEmbeds(r, q, conns)
+			}
+			if h.usage != nil {
+				impact, err := h.queryImpact(q, r.URL.Query().Get("impact_window"), r.URL.Query().Get("impact_at"))
+				if err != nil {
+					data["ImpactError"] = err.Error()
+				}
+				data["Impact"] = impact
+			}
 		}
 	}
 
-	h.render(w, "query_form.html", data)
+	h.render(w, r, "query_form.html", data)
+}
+
+// queryImpact compares the executions of q before and after the boundary
+// at, an RFC 3339 time or a datetime-local input in server time, over
+// window; at defaults to q's last modification
+func (h *WebHandler) queryImpact(q *core.SavedQuery, window, at string) (*service.QueryImpact, error) {
+	d, err := service.ParseImpactWindow(window)
+	if err != nil {
+		return nil, err
+	}
+	var boundary time.Time
+	switch {
+	case at != "":
+		if boundary, err = time.Parse(time.RFC3339, at); err != nil {
+			if boundary, err = time.ParseInLocation("2006-01-02T15:04", at, time.Local); err != nil {
+				return nil, fmt.Errorf("at must be a time such as 2024-05-06T14:30")
+			}
+		}
+	case q.UpdatedAt != nil:
+		boundary = *q.UpdatedAt
+	default:
+		return nil, fmt.Errorf("the query has no modification time; choose a boundary with at")
+	}
+	return h.usage.QueryImpact(q.ID, boundary.In(time.Local), d, time.Now())
+}
+
+// QueryImpact answers the error rate and latency of the {id} query before
+// and after its last edit, or ?at=, as JSON, over ?window= each side
+func (h *WebHandler) QueryImpact(w http.ResponseWriter, r *http.Request) {
+	if h.usage == nil {
+		writeJSONError(w, http.StatusNotFound, "usage statistics are not enabled")
+		return
+	}
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	q, err := h.queryRepo.GetByID(id)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "query not found")
+		return
+	}
+	impact, err := h.queryImpact(q, r.URL.Query().Get("window"), r.URL.Query().Get("at"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, impact)
+}
+
+// formDate reads a date input as the start of that day in server time, nil
+// when empty
+func formDate(r *http.Request, name string) *time.Time {
+	day, err := time.ParseInLocation(time.DateOnly, strings.TrimSpace(r.FormValue(name)), time.Local)
+	if err != nil {
+		return nil
+	}
+	return &day
+}
+
+// execWindowFromForm reads the query form's execution window fields, nil
+// when no times are set
+func execWindowFromForm(r *http.Request) *service.ExecWindow {
+	start, end := r.FormValue("window_start"), r.FormValue("window_end")
+	if start == "" && end == "" {
+		return nil
+	}
+	return &service.ExecWindow{
+		Start:    start,
+		End:      end,
+		Days:     r.PostForm["window_days"],
+		Timezone: strings.TrimSpace(r.FormValue("window_timezone")),
+	}
 }
 
 func (h *WebHandler) SaveQuery(w http.ResponseWriter, r *http.Request) {
@@ -423,63 +1340,312 @@ func (h *WebHandler) SaveQuery(w http.ResponseWriter, r *http.Request) {
 		Slug:                 core.Slugify(r.FormValue("slug")),
 		Description:          r.FormValue("description"),
 		SQLText:              r.FormValue("sql_text"),
+		ParamsConfig:         strings.TrimSpace(r.FormValue("params_config")),
 		IsActive:             r.FormValue("is_active") == "on",
+		ResultMode:           core.NormalizeResultMode(r.FormValue("result_mode")),
+		ShapeConfig:          strings.TrimSpace(r.FormValue("shape_config")),
+		XMLRoot:              strings.TrimSpace(r.FormValue("xml_root")),
+		ResponseConfig:       strings.TrimSpace(r.FormValue("response_config")),
+		SkipSchemaCheck:      r.FormValue("skip_schema_check") == "on",
+		RecordExample:        r.FormValue("record_example") == "on",
+		DebugCapture:         r.FormValue("debug_capture") == "on",
+		Confidential:         r.FormValue("confidential") == "on",
 		AllowedConnectionIDs: connIDs,
 	}
+	// Values are only captured along with the SQL
+	q.DebugCaptureValues = q.DebugCapture && r.FormValue("debug_capture_values") == "on"
 
 	if idStr != "" {
-		id, _ := strconv.ParseInt(idStr, 10, 64)
-		q.ID = id
-		// For update we need to preserve things or just overwrite.
-		// Repo Update usually takes full object.
-		h.queryRepo.Update(q)
+		q.ID, _ = strconv.ParseInt(idStr, 10, 64)
+	}
+	// Empty = the global setting
+	q.WarnDurationMs, _ = strconv.Atoi(strings.TrimSpace(r.FormValue("warn_duration_ms")))
+	q.WarnRows, _ = strconv.Atoi(strings.TrimSpace(r.FormValue("warn_rows")))
+
+	window := execWindowFromForm(r)
+	if window != nil {
+		b, _ := json.Marshal(window)
+		q.ExecWindow = string(b)
+	}
+	q.DeprecatedAt = formDate(r, "deprecated_at")
+	q.SunsetAt = formDate(r, "sunset_at")
+	q.SupersededBy = core.Slugify(r.FormValue("superseded_by"))
+	q.SunsetMessage = strings.TrimSpace(r.FormValue("sunset_message"))
+
+	if errs := h.validateQuery(r, q, r.FormValue("slug")); len(errs) > 0 {
+		conns, _ := h.connRepo.GetAll()
+		q.Slug = r.FormValue("slug") // as typed
+		h.render(w, r, "query_form.html", map[string]interface{}{
+			"IsEdit":      idStr != "",
+			"Query":       q,
+			"Connections": conns,
+			"Window":      window,
+			"Errors":      errs,
+			"Error":       h.templates.T(r, "form.error_summary"),
+		})
+		return
+	}
+
+	diff, saveErr := h.storeQuery(r, q)
+	if saveErr != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.query_save_failed", q.Slug, saveErr.Error()))
+	} else {
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.query_saved", q.Slug))
+		if diff != nil && diff.Change == service.ContractChanged {
+			h.SetFlash(w, r, FlashWarning, h.templates.T(r, "flash.query_contract_changed", q.Slug, diff.Summary()))
+		}
+		if len(q.AllowedConnectionIDs) == 0 {
+			h.SetFlash(w, r, FlashWarning, h.templates.T(r, "flash.query_no_connections", q.Slug))
+		}
+	}
+	http.Redirect(w, r, "/admin/queries", http.StatusFound)
+}
+
+// storeQuery creates q, or updates it when it has an ID, audits the save and
+// records its contract change, if any
+func (h *WebHandler) storeQuery(r *http.Request, q *core.SavedQuery) (*service.ContractDiff, error) {
+	q.UpdatedBy = h.actorName(r)
+	var before *core.SavedQuery
+	event := core.EventQueryCreate
+	var saveErr error
+	if q.ID != 0 {
+		before, _ = h.queryRepo.GetByID(q.ID)
+		if before != nil {
+			// Only test runs and the example and schema buttons change these
+			q.Example, q.ResponseSchema = before.Example, before.ResponseSchema
+		}
+		event = core.EventQueryUpdate
+		if before != nil && before.IsActive != q.IsActive {
+			event = core.EventQueryDeactivate
+			if q.IsActive {
+				event = core.EventQueryActivate
+			}
+		}
+		saveErr = h.queryRepo.Update(q)
 	} else {
-		h.queryRepo.Create(q)
+		saveErr = h.queryRepo.Create(q)
+	}
+
+	ev := service.AdminEvent{Type: event, Target: "query " + q.Slug, QueryID: q.ID, Changes: h.queryChanges(before, q)}
+	if saveErr != nil {
+		ev.Error = saveErr.Error()
 	}
+	h.record(r, ev)
+	if saveErr != nil {
+		return nil, saveErr
+	}
+	return h.recordContract(before, q), nil
+}
+
+// recordContract records the contract change of a query save or delete, if
+// any, and returns it
+func (h *WebHandler) recordContract(before, after *core.SavedQuery) *service.ContractDiff {
+	if h.contracts == nil {
+		return nil
+	}
+	diff, err := h.contracts.Record(before, after)
+	if err != nil {
+		logger.Error.Printf("Failed to record contract change: %v", err)
+	}
+	return diff
+}
 
+// validateQuery checks a submitted query form; slug is the slug as typed,
+// before slugifying
+func (h *WebHandler) validateQuery(r *http.Request, q *core.SavedQuery, slug string) formErrors {
+	errs := formErrors{}
+	if strings.TrimSpace(slug) == "" {
+		errs.add("slug", h.templates.T(r, "validation.slug_required"))
+	} else if q.Slug == "" {
+		errs.add("slug", h.templates.T(r, "validation.slug_invalid"))
+	} else if existing, err := h.queryRepo.GetBySlug(q.Slug); err == nil && existing.ID != q.ID {
+		if existing.Slug != q.Slug {
+			errs.add("slug", h.templates.T(r, "validation.slug_alias", q.Slug, existing.Slug, h.freeSlug(q.Slug)))
+		} else {
+			errs.add("slug", h.templates.T(r, "validation.slug_exists", q.Slug, h.freeSlug(q.Slug)))
+		}
+	}
+	if strings.TrimSpace(q.SQLText) == "" {
+		errs.add("sql_text", h.templates.T(r, "validation.sql_required"))
+	} else if !q.SkipSchemaCheck {
+		for _, id := range q.AllowedConnectionIDs {
+			conn, err := h.connRepo.GetByID(id)
+			if err != nil {
+				continue
+			}
+			if err := service.CheckSchemas(conn, q.SQLText); err != nil {
+				errs.add("sql_text", h.templates.T(r, "validation.schema_ack", err.Error()))
+				break
+			}
+		}
+	}
+	if _, err := service.ParseParamsConfig(q.ParamsConfig); err != nil {
+		errs.add("params_config", err.Error())
+	}
+	if _, err := service.ParseShapeConfig(q.ShapeConfig); err != nil {
+		errs.add("shape_config", err.Error())
+	}
+	if _, err := service.ParseResponseConfig(q.ResponseConfig); err != nil {
+		errs.add("response_config", err.Error())
+	}
+	if q.WarnDurationMs < 0 || q.WarnRows < 0 {
+		errs.add("warn", h.templates.T(r, "validation.warn_negative"))
+	}
+	if q.XMLRoot != "" && !isXMLName(q.XMLRoot) {
+		errs.add("xml_root", h.templates.T(r, "validation.xml_root_invalid", q.XMLRoot))
+	}
+	if _, err := service.ParseExecWindow(q.ExecWindow); err != nil {
+		errs.add("window", err.Error())
+	}
+	if q.SunsetAt != nil && (q.DeprecatedAt == nil || q.DeprecatedAt.After(*q.SunsetAt)) {
+		errs.add("lifecycle", h.templates.T(r, "validation.sunset_needs_deprecation"))
+	}
+	if q.SupersededBy != "" {
+		if q.SupersededBy == q.Slug {
+			errs.add("lifecycle", h.templates.T(r, "validation.superseded_self"))
+		} else if _, err := h.queryRepo.GetBySlug(q.SupersededBy); err != nil {
+			errs.add("lifecycle", h.templates.T(r, "validation.superseded_unknown", q.SupersededBy))
+		}
+	}
+	return errs
+}
+
+// freeSlug returns slug, or the first of slug-2, slug-3... that is neither a
+// query's slug nor an alias
+func (h *WebHandler) freeSlug(slug string) string {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s-%d", slug, n)
+		if _, err := h.queryRepo.GetBySlug(candidate); err != nil {
+			return candidate
+		}
+	}
+}
+
+// RetireQueryAlias drops the old slug "alias" of the {id} query: its URLs
+// stop working and the slug can be reused
+func (h *WebHandler) RetireQueryAlias(w http.ResponseWriter, r *http.Request) {
+	q, err := h.queryFromURL(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	slug := r.FormValue("alias")
+	aliases, _ := h.queryRepo.ListAliases(q.ID)
+	if !slices.ContainsFunc(aliases, func(a core.QuerySlugAlias) bool { return a.Slug == slug }) {
+		http.NotFound(w, r)
+		return
+	}
+	ev := service.AdminEvent{Type: core.EventQueryAliasRetire, Target: "query " + q.Slug, QueryID: q.ID,
+		Changes: service.AuditChanges{"slug_alias": {Old: slug}}}
+	if err := h.queryRepo.DeleteAlias(slug); err != nil {
+		ev.Error = err.Error()
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.alias_retire_failed", slug, err.Error()))
+	} else {
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.alias_retired", slug))
+	}
+	h.record(r, ev)
+	http.Redirect(w, r, fmt.Sprintf("/admin/queries/edit?id=%d", q.ID), http.StatusFound)
+}
+
+// RebuildDocs builds the cached OpenAPI specs again, for changes made to
+// the metadata database outside dbbridge
+func (h *WebHandler) RebuildDocs(w http.ResponseWriter, r *http.Request) {
+	if h.docs == nil {
+		http.NotFound(w, r)
+		return
+	}
+	ev := service.AdminEvent{Type: core.EventDocsRebuild, Target: "API docs"}
+	if err := h.docs.Rebuild(); err != nil {
+		ev.Error = err.Error()
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.docs_rebuild_failed", err.Error()))
+	} else {
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.docs_rebuilt"))
+	}
+	h.record(r, ev)
 	http.Redirect(w, r, "/admin/queries", http.StatusFound)
 }
 
 func (h *WebHandler) DeleteQuery(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("id")
 	id, _ := strconv.ParseInt(idStr, 10, 64)
-	h.queryRepo.Delete(id)
+	before, err := h.queryRepo.GetByID(id)
+	if err != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.query_not_found"))
+	} else if err := h.queryRepo.Delete(id); err != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.query_delete_failed", before.Slug, err.Error()))
+	} else {
+		h.record(r, service.AdminEvent{Type: core.EventQueryDelete, Target: "query " + before.Slug,
+			Changes: h.queryChanges(before, nil)})
+		h.recordContract(before, nil)
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.query_deleted", before.Slug))
+	}
 	http.Redirect(w, r, "/admin/queries", http.StatusFound)
 }
 
+// ReloadConfig re-reads the configuration, the HTTP equivalent of SIGHUP for Windows
+func (h *WebHandler) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	result, err := h.config.Reload()
+	ev := service.AdminEvent{Type: core.EventConfigReload, Target: "config"}
+	if err != nil {
+		ev.Error = err.Error()
+	} else if len(result.RestartRequired) > 0 {
+		ev.Changes = service.AuditChanges{"restart_required": {New: result.RestartRequired}}
+	}
+	h.record(r, ev)
+	if err != nil {
+		logger.Error.Printf("Config reload failed: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	logger.Info.Printf("Config reload via admin: %s", result)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":          true,
+		"message":          result.String(),
+		"warnings":         result.Warnings,
+		"restart_required": result.RestartRequired,
+	})
+}
+
 // --- My Profile Handlers ---
 
 func (h *WebHandler) HandleProfile(w http.ResponseWriter, r *http.Request) {
+	// The signed-in user and flash messages come with every page
+	h.render(w, r, "profile.html", map[string]interface{}{
+		"Title":   "My Profile",
+		"Locales": i18n.Locales(),
+		"Locale":  h.templates.Locale(r),
+	})
+}
+
+// HandleUpdateLocale saves the admin UI language of the signed-in user, in
+// the user and in the session so it applies from the next page on
+func (h *WebHandler) HandleUpdateLocale(w http.ResponseWriter, r *http.Request) {
+	locale := i18n.Normalize(r.FormValue("locale"))
+	if locale == "" {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.language_invalid"))
+		http.Redirect(w, r, "/admin/profile", http.StatusFound)
+		return
+	}
+	if err := h.userRepo.SetLocale(h.sessionUserID(r), locale); err != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.language_save_failed", err.Error()))
+		http.Redirect(w, r, "/admin/profile", http.StatusFound)
+		return
+	}
+
 	session, _ := h.sessionStore.Get(r, "dbbridge-session")
-	userID, _ := session.Values["user_id"].(int64)
-	username, _ := session.Values["username"].(string)
+	session.Values["locale"] = locale
+	session.Save(r, w)
 
-	// Check for flash messages
-	successMsg := ""
-	errorMsg := ""
-	if msg, ok := session.Values["flash_success"].(string); ok && msg != "" {
-		successMsg = msg
-		delete(session.Values, "flash_success")
-		session.Save(r, w)
-	}
-	if msg, ok := session.Values["flash_error"].(string); ok && msg != "" {
-		errorMsg = msg
-		delete(session.Values, "flash_error")
-		session.Save(r, w)
-	}
-
-	h.render(w, "profile.html", map[string]interface{}{
-		"Title":    "My Profile",
-		"UserID":   userID,
-		"Username": username,
-		"Success":  successMsg,
-		"Error":    errorMsg,
-	})
+	h.SetFlash(w, r, FlashSuccess, i18n.T(locale, "flash.language_saved"))
+	http.Redirect(w, r, "/admin/profile", http.StatusFound)
 }
 
 func (h *WebHandler) HandleUpdatePassword(w http.ResponseWriter, r *http.Request) {
-	session, _ := h.sessionStore.Get(r, "dbbridge-session")
-	userID, _ := session.Values["user_id"].(int64)
+	userID := h.sessionUserID(r)
 
 	currentPassword := r.FormValue("current_password")
 	newPassword := r.FormValue("new_password")
@@ -487,14 +1653,12 @@ func (h *WebHandler) HandleUpdatePassword(w http.ResponseWriter, r *http.Request
 
 	// Validate
 	if newPassword == "" {
-		session.Values["flash_error"] = "New password is required."
-		session.Save(r, w)
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.password_required"))
 		http.Redirect(w, r, "/admin/profile", http.StatusFound)
 		return
 	}
 	if newPassword != confirmPassword {
-		session.Values["flash_error"] = "New passwords do not match."
-		session.Save(r, w)
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.password_mismatch"))
 		http.Redirect(w, r, "/admin/profile", http.StatusFound)
 		return
 	}
@@ -502,38 +1666,36 @@ func (h *WebHandler) HandleUpdatePassword(w http.ResponseWriter, r *http.Request
 	// Verify current password
 	user, err := h.userRepo.GetByID(userID)
 	if err != nil {
-		session.Values["flash_error"] = "User not found."
-		session.Save(r, w)
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.user_not_found"))
 		http.Redirect(w, r, "/admin/profile", http.StatusFound)
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
-		session.Values["flash_error"] = "Current password is incorrect."
-		session.Save(r, w)
+	if !h.authSvc.VerifyPassword(user, currentPassword) {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.password_incorrect"))
 		http.Redirect(w, r, "/admin/profile", http.StatusFound)
 		return
 	}
 
 	// Hash new password
-	hashedValue, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashedValue, err := h.authSvc.HashPassword(newPassword)
 	if err != nil {
-		session.Values["flash_error"] = "Failed to update password."
-		session.Save(r, w)
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.password_update_failed"))
 		http.Redirect(w, r, "/admin/profile", http.StatusFound)
 		return
 	}
 
-	user.PasswordHash = string(hashedValue)
+	user.PasswordHash = hashedValue
 	if err := h.userRepo.Update(user); err != nil {
-		session.Values["flash_error"] = "Failed to save password: " + err.Error()
-		session.Save(r, w)
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.password_save_failed", err.Error()))
 		http.Redirect(w, r, "/admin/profile", http.StatusFound)
 		return
 	}
 
-	session.Values["flash_success"] = "Password updated successfully!"
-	session.Save(r, w)
+	h.record(r, service.AdminEvent{Type: core.EventUserPassword, Target: "user " + user.Username,
+		Changes: service.AuditChanges{"password": {Old: "********", New: "********"}}})
+
+	h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.password_updated"))
 	http.Redirect(w, r, "/admin/profile", http.StatusFound)
 }
 
@@ -542,7 +1704,7 @@ func (h *WebHandler) HandleUpdatePassword(w http.ResponseWriter, r *http.Request
 func (h *WebHandler) HandleListApiKeys(w http.ResponseWriter, r *http.Request) {
 	keys, err := h.apiKeyRepo.List()
 	if err != nil {
-		h.render(w, "api_keys.html", map[string]interface{}{"Error": err.Error()})
+		h.render(w, r, "api_keys.html", map[string]interface{}{"Error": err.Error()})
 		return
 	}
 
@@ -550,18 +1712,41 @@ func (h *WebHandler) HandleListApiKeys(w http.ResponseWriter, r *http.Request) {
 		"Title": "API Keys",
 		"Keys":  keys,
 	}
-	h.render(w, "api_keys.html", data)
+	h.render(w, r, "api_keys.html", data)
 }
 
 func (h *WebHandler) HandleCreateApiKey(w http.ResponseWriter, r *http.Request) {
 	userID := int64(1) // Default to admin for now
 	description := r.FormValue("description")
+	kind := r.FormValue("kind")
+	if kind == "" {
+		kind = core.ApiKeyKindData
+	}
 
-	key, apiKey, err := h.authSvc.GenerateApiKey(userID, description)
+	// Keys work through the expiry date, in server time
+	var expiresAt *time.Time
+	var err error
+	if v := strings.TrimSpace(r.FormValue("expires_at")); v != "" {
+		day, parseErr := time.ParseInLocation("2006-01-02", v, time.Local)
+		if parseErr != nil {
+			err = fmt.Errorf("invalid expiry date %q", v)
+		} else {
+			end := day.AddDate(0, 0, 1)
+			expiresAt = &end
+		}
+	}
+	var key string
+	var apiKey *core.ApiKey
+	if err == nil {
+		key, apiKey, err = h.authSvc.GenerateApiKeyKind(userID, description, kind, expiresAt)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.api_key_create_failed", err.Error()))
+		http.Redirect(w, r, "/admin/api-keys", http.StatusFound)
 		return
 	}
+	h.record(r, service.AdminEvent{Type: core.EventAPIKeyCreate, Target: apiKeyTarget(apiKey),
+		Changes: h.apiKeyChanges(nil, apiKey)})
 
 	keys, _ := h.apiKeyRepo.List()
 
@@ -572,53 +1757,193 @@ func (h *WebHandler) HandleCreateApiKey(w http.ResponseWriter, r *http.Request)
 		"NewID":   apiKey.ID,
 		"NewDesc": apiKey.Description,
 	}
-	h.render(w, "api_keys.html", data)
+	h.render(w, r, "api_keys.html", data)
 }
 
 func (h *WebHandler) HandleRevokeApiKey(w http.ResponseWriter, r *http.Request) {
 	idStr := r.FormValue("id")
 	id, _ := strconv.ParseInt(idStr, 10, 64)
 
+	before := h.findApiKey(id)
 	if err := h.apiKeyRepo.Revoke(int64(id)); err != nil {
 		logger.Error.Printf("Failed to revoke key: %v", err)
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.api_key_revoke_failed", err.Error()))
+	} else if before != nil {
+		h.record(r, service.AdminEvent{Type: core.EventAPIKeyRevoke, Target: apiKeyTarget(before),
+			Changes: service.AuditChanges{"is_active": {Old: before.IsActive, New: false}}})
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.api_key_revoked", before.KeyPrefix))
 	}
 	http.Redirect(w, r, "/admin/api-keys", http.StatusFound)
 }
 
-func (h *WebHandler) render(w http.ResponseWriter, tmplName string, data interface{}) {
-	if h.templates == nil {
-		h.ReloadTemplates() // Try loading if nil
-		if h.templates == nil {
-			logger.Error.Println("WebHandler: Templates are nil after reload attempt")
-			http.Error(w, "WebTemplates not loaded", http.StatusInternalServerError)
-			return
+// HandleReenableApiKey activates a key disabled for lack of use again. Its
+// inactivity is counted from now; revoked keys stay revoked.
+func (h *WebHandler) HandleReenableApiKey(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+
+	before := h.findApiKey(id)
+	if before == nil || !before.AutoDisabled() {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.api_key_reenable_failed", "not disabled for lack of use"))
+	} else if err := h.apiKeyRepo.Reenable(id); err != nil {
+		logger.Error.Printf("Failed to re-enable key: %v", err)
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.api_key_reenable_failed", err.Error()))
+	} else {
+		h.record(r, service.AdminEvent{Type: core.EventAPIKeyReenable, Target: apiKeyTarget(before),
+			Changes: service.AuditChanges{"is_active": {Old: false, New: true}}})
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.api_key_reenabled", before.KeyPrefix))
+	}
+	http.Redirect(w, r, "/admin/api-keys", http.StatusFound)
+}
+
+// findApiKey returns the key with id from the key list, nil if there is none
+func (h *WebHandler) findApiKey(id int64) *core.ApiKey {
+	keys, _ := h.apiKeyRepo.List()
+	for i := range keys {
+		if keys[i].ID == id {
+			return &keys[i]
 		}
 	}
+	return nil
+}
 
-	// Execute layout which should yield the specific template
-	// Assuming layout.html defines {{block "content" .}}
-	err := h.templates.ExecuteTemplate(w, "layout.html", map[string]interface{}{
-		"Page": tmplName, // To identify active page
-		"Data": data,
-	})
+func apiKeyTarget(k *core.ApiKey) string {
+	return "api key " + k.KeyPrefix + "..."
+}
+
+// HandleUpdateApiKeyAllowlist replaces a key's CIDR allowlist (empty = unrestricted)
+func (h *WebHandler) HandleUpdateApiKeyAllowlist(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+
+	cidrs := splitCIDRs(r.FormValue("allowed_cidrs"))
+	if _, err := config.ParseCIDRList(cidrs); err != nil {
+		keys, _ := h.apiKeyRepo.List()
+		h.render(w, r, "api_keys.html", map[string]interface{}{
+			"Title": "API Keys",
+			"Keys":  keys,
+			"Error": "Invalid allowlist: " + err.Error(),
+		})
+		return
+	}
+
+	before := h.findApiKey(id)
+	if err := h.apiKeyRepo.UpdateAllowedCIDRs(id, strings.Join(cidrs, ",")); err != nil {
+		logger.Error.Printf("Failed to update key allowlist: %v", err)
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.allowlist_update_failed", err.Error()))
+	} else if before != nil && before.AllowedCIDRs != strings.Join(cidrs, ",") {
+		h.record(r, service.AdminEvent{Type: core.EventAPIKeyAllowlist, Target: apiKeyTarget(before),
+			Changes: service.AuditChanges{"allowed_cidrs": {Old: before.AllowedCIDRs, New: strings.Join(cidrs, ",")}}})
+		if len(cidrs) == 0 {
+			h.SetFlash(w, r, FlashWarning, h.templates.T(r, "flash.allowlist_removed", before.KeyPrefix))
+		} else {
+			h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.allowlist_updated", before.KeyPrefix))
+		}
+	}
+	http.Redirect(w, r, "/admin/api-keys", http.StatusFound)
+}
+
+// HandleUpdateApiKeyAttributes replaces a key's attributes, which queries
+// read through {_key.*} parameters
+func (h *WebHandler) HandleUpdateApiKeyAttributes(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+
+	attrs, err := core.ParseKeyAttributes(r.FormValue("attributes"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		keys, _ := h.apiKeyRepo.List()
+		h.render(w, r, "api_keys.html", map[string]interface{}{
+			"Title": "API Keys",
+			"Keys":  keys,
+			"Error": "Invalid attributes: " + err.Error(),
+		})
+		return
+	}
+
+	before := h.findApiKey(id)
+	text := core.FormatKeyAttributes(attrs, false)
+	if err := h.apiKeyRepo.UpdateAttributes(id, text); err != nil {
+		logger.Error.Printf("Failed to update key attributes: %v", err)
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.attributes_update_failed", err.Error()))
+	} else if before != nil && before.Attributes != text {
+		old, _ := core.ParseKeyAttributes(before.Attributes)
+		h.record(r, service.AdminEvent{Type: core.EventAPIKeyAttributes, Target: apiKeyTarget(before),
+			Changes: service.AuditChanges{"attributes": {Old: core.FormatKeyAttributes(old, true), New: core.FormatKeyAttributes(attrs, true)}}})
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.attributes_updated", before.KeyPrefix))
+	}
+	http.Redirect(w, r, "/admin/api-keys", http.StatusFound)
+}
+
+// HandleUpdateApiKeyScopes replaces the connections and environments a key
+// may run queries on
+func (h *WebHandler) HandleUpdateApiKeyScopes(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+
+	scopes, err := core.ParseKeyScopes(r.FormValue("scopes"))
+	if err != nil {
+		keys, _ := h.apiKeyRepo.List()
+		h.render(w, r, "api_keys.html", map[string]interface{}{
+			"Title": "API Keys",
+			"Keys":  keys,
+			"Error": "Invalid scopes: " + err.Error(),
+		})
+		return
+	}
+
+	before := h.findApiKey(id)
+	text := core.FormatKeyScopes(scopes)
+	if err := h.apiKeyRepo.UpdateScopes(id, text); err != nil {
+		logger.Error.Printf("Failed to update key scopes: %v", err)
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.scopes_update_failed", err.Error()))
+	} else if before != nil && before.Scopes != text {
+		h.record(r, service.AdminEvent{Type: core.EventAPIKeyScopes, Target: apiKeyTarget(before),
+			Changes: service.AuditChanges{"scopes": {Old: before.Scopes, New: text}}})
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.scopes_updated", before.KeyPrefix))
+	}
+	http.Redirect(w, r, "/admin/api-keys", http.StatusFound)
+}
+
+// HandleUpdateApiKeyEnvelope sets the envelope of a key's JSON results when
+// a request names none, see selectEnvelope
+func (h *WebHandler) HandleUpdateApiKeyEnvelope(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	envelope := r.FormValue("envelope")
+	if !validEnvelope(envelope) {
+		keys, _ := h.apiKeyRepo.List()
+		h.render(w, r, "api_keys.html", map[string]interface{}{
+			"Title": "API Keys",
+			"Keys":  keys,
+			"Error": "Invalid envelope: must be v1 or v2",
+		})
+		return
+	}
+
+	before := h.findApiKey(id)
+	if err := h.apiKeyRepo.UpdateEnvelope(id, envelope); err != nil {
+		logger.Error.Printf("Failed to update key envelope: %v", err)
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.envelope_update_failed", err.Error()))
+	} else if before != nil && before.Envelope != envelope {
+		h.record(r, service.AdminEvent{Type: core.EventAPIKeyEnvelope, Target: apiKeyTarget(before),
+			Changes: service.AuditChanges{"envelope": {Old: before.Envelope, New: envelope}}})
+		h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.envelope_updated", before.KeyPrefix, envelope))
 	}
+	http.Redirect(w, r, "/admin/api-keys", http.StatusFound)
+}
+
+func (h *WebHandler) render(w http.ResponseWriter, r *http.Request, tmplName string, data interface{}) {
+	h.templates.Page(w, r, tmplName, data)
 }
 
-// GetTemplates returns the parsed templates (useful for sharing with AuthHandler)
-func (h *WebHandler) GetTemplates() *template.Template {
+// GetTemplates returns the template set shared with the other admin handlers
+func (h *WebHandler) GetTemplates() *Templates {
 	return h.templates
 }
 
 // Setup Routes for Web
 func (h *WebHandler) RegisterRoutes(r chi.Router) {
-	// Redirect root to admin
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/setup", http.StatusFound)
-	})
-
 	r.Get("/admin", h.Dashboard)
+	r.Get("/admin/welcome", h.Welcome)
+	r.Post("/admin/welcome/connection", h.WelcomeConnection)
+	r.Post("/admin/welcome/query", h.WelcomeQuery)
+	r.Post("/admin/welcome/api-key", h.WelcomeAPIKey)
+	r.Post("/admin/welcome/finish", h.WelcomeFinish)
 
 	// Connections
 	r.Get("/admin/connections", h.ConnectionsList)
@@ -626,26 +1951,59 @@ func (h *WebHandler) RegisterRoutes(r chi.Router) {
 	r.Get("/admin/connections/edit", h.ConnectionForm)
 	r.Post("/admin/connections/save", h.SaveConnection)
 	r.Post("/admin/connections/test", h.TestConnection)
+	r.Post("/admin/connections/validate", h.ValidateConnection)
+	r.Post("/admin/connections/reveal", h.RevealConnectionString)
 	r.Get("/admin/connections/delete", h.DeleteConnection)
+	r.Get("/admin/stats/connections/{id}/heatmap", h.ConnectionHeatmap)
 
 	// Queries
 	r.Get("/admin/queries", h.QueriesList)
 	r.Get("/admin/queries/new", h.QueryForm)
 	r.Get("/admin/queries/edit", h.QueryForm) // Careful: requires ID
 	r.Post("/admin/queries/save", h.SaveQuery)
+	r.Get("/admin/queries/import", h.ImportQueriesForm)
+	r.Post("/admin/queries/import", h.ImportQueries)
+	r.Post("/admin/docs/rebuild", h.RebuildDocs)
 	r.Post("/admin/queries/run", h.RunQuery) // Test Run
+	r.Post("/admin/queries/detect-params", h.DetectParams)
 	r.Get("/admin/queries/delete", h.DeleteQuery)
+	r.Post("/admin/queries/{id}/diff", h.DiffQuery)
+	r.Post("/admin/queries/{id}/benchmark", h.BenchmarkQuery)
+	r.Post("/admin/queries/{id}/example", h.QueryExampleAction)
+	r.Post("/admin/queries/{id}/schema", h.QueryResponseSchemaAction)
+	r.Post("/admin/queries/{id}/aliases/retire", h.RetireQueryAlias)
+	r.Post("/admin/queries/{id}/embeds", h.CreateEmbed)
+	r.Post("/admin/queries/{id}/embeds/{embedID}/revoke", h.RevokeEmbed)
+	r.Get("/admin/executions", h.ExecutionsList)
+	r.Get("/admin/bundle", h.BundlePage)
+	r.Post("/admin/bundle", h.DownloadBundle)
+	r.Post("/admin/executions/{id}/cancel", h.CancelExecution)
+	r.Get("/admin/queries/{id}/docs", h.QueryDocs)
+	r.Get("/admin/queries/{id}/impact", h.QueryImpact)
+	r.Post("/admin/queries/{id}/docs/example", h.QueryDocsExample)
 
 	// Profile
 	r.Get("/admin/profile", h.HandleProfile)
 	r.Post("/admin/profile", h.HandleUpdatePassword)
+	r.Post("/admin/profile/locale", h.HandleUpdateLocale)
 
 	r.Get("/admin/api-keys", h.HandleListApiKeys)
 	r.Post("/admin/api-keys/create", h.HandleCreateApiKey)
 	r.Post("/admin/api-keys/revoke", h.HandleRevokeApiKey)
+	r.Post("/admin/api-keys/reenable", h.HandleReenableApiKey)
+	r.Post("/admin/api-keys/allowlist", h.HandleUpdateApiKeyAllowlist)
+	r.Post("/admin/api-keys/attributes", h.HandleUpdateApiKeyAttributes)
+	r.Post("/admin/api-keys/scopes", h.HandleUpdateApiKeyScopes)
+	r.Post("/admin/api-keys/envelope", h.HandleUpdateApiKeyEnvelope)
 
 	// Audit Logs
 	r.Get("/admin/logs", h.HandleAuditLogs)
+	r.Get("/admin/logs/{id}", h.HandleAuditEntry)
+	r.Post("/admin/logs/{id}/replay", h.ReplayAuditEntry)
+	r.Get("/admin/logs/{id}/params", h.AuditEntryParams)
+
+	// Config
+	r.Post("/admin/reload", h.ReloadConfig)
 }
 
 func (h *WebHandler) RegisterStatic(r chi.Router) {
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"dbbridge/internal/config"
+	"dbbridge/internal/core"
+	"dbbridge/internal/data"
+	"dbbridge/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestSaveQueryValidation(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	tmpl, err := NewTemplates("../../web/templates/*.html", templateFuncs(nil, nil), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queryRepo := data.NewQueryRepo(db)
+	h := &WebHandler{connRepo: data.NewConnectionRepo(db), queryRepo: queryRepo, templates: tmpl,
+		sessionStore: store, config: config.NewStore(&config.Config{})}
+
+	if err := queryRepo.Create(&core.SavedQuery{Slug: "orders", SQLText: "SELECT 1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	save := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/queries/save", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.SaveQuery(w, req)
+		return w
+	}
+
+	w := save(url.Values{"slug": {"orders"}, "description": {"Open orders by customer"}, "params_config": {"{not json"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("invalid form = %d, want the form rendered again", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"A query with slug orders already exists.",
+		"SQL is required.",
+		"invalid params config",
+		`value="Open orders by customer"`, // submitted values are kept
+		"{not json",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("re-rendered form lacks %q", want)
+		}
+	}
+	if all, _ := queryRepo.GetAll(); len(all) != 1 {
+		t.Errorf("invalid query was saved, %d queries", len(all))
+	}
+
+	w = save(url.Values{"slug": {"open-orders"}, "sql_text": {"SELECT 1"}})
+	if w.Code != http.StatusFound {
+		t.Fatalf("valid form = %d, want redirect", w.Code)
+	}
+	if _, err := queryRepo.GetBySlug("open-orders"); err != nil {
+		t.Errorf("valid query not saved: %v", err)
+	}
+}
+
+func TestConfidentialSQLLeftOutOfAuditParams(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	tmpl, err := NewTemplates("../../web/templates/*.html", templateFuncs(nil, nil), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queryRepo := data.NewQueryRepo(db)
+	h := &WebHandler{connRepo: data.NewConnectionRepo(db), queryRepo: queryRepo, templates: tmpl, sessionStore: store,
+		events: service.NewAdminAuditor(data.NewAuditRepo(db)),
+		config: config.NewStore(&config.Config{MetadataEncrypt: []string{core.EncryptQuerySQL}})}
+
+	for _, form := range []url.Values{
+		{"slug": {"salaries"}, "sql_text": {"SELECT salary FROM staff"}, "confidential": {"on"}},
+		{"slug": {"products"}, "sql_text": {"SELECT name FROM products"}},
+	} {
+		req := httptest.NewRequest("POST", "/admin/queries/save", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.SaveQuery(w, req)
+		if w.Code != http.StatusFound {
+			t.Fatalf("save %s = %d, want redirect", form.Get("slug"), w.Code)
+		}
+	}
+	q, err := queryRepo.GetBySlug("salaries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.DeleteQuery(w, httptest.NewRequest("GET", "/admin/queries/delete?id="+strconv.FormatInt(q.ID, 10), nil))
+
+	// The params column as stored, not through the repository
+	rows, err := db.Query(`SELECT params FROM audit_logs ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var params []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			t.Fatal(err)
+		}
+		params = append(params, p)
+	}
+	if len(params) != 3 {
+		t.Fatalf("%d audit entries, want create, create and delete", len(params))
+	}
+	for _, i := range []int{0, 2} {
+		if strings.Contains(params[i], "salary") || !strings.Contains(params[i], `"sql_text":{"old":`) {
+			t.Errorf("entry %d params = %s, want the SQL redacted", i, params[i])
+		}
+	}
+	if !strings.Contains(params[1], "SELECT name FROM products") {
+		t.Errorf("SQL of a query not confidential redacted: %s", params[1])
+	}
+}
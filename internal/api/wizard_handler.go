@@ -0,0 +1,224 @@
+package api
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Session values of the setup wizard. wizardKey marks a wizard in progress,
+// the others hold what its steps created so the later steps can use them.
+const (
+	wizardKey           = "wizard"
+	wizardConnectionKey = "wizard_connection_id"
+	wizardQueryKey      = "wizard_query_id"
+)
+
+// wizardSteps are the steps after the admin account, in order
+var wizardSteps = []string{"connection", "query", "api-key"}
+
+// wizardState reads the wizard's session values. A wizard is started from
+// the setup page, or by entering it while there are no connections yet.
+func (h *WebHandler) wizardState(w http.ResponseWriter, r *http.Request) (active bool, connID, queryID int64) {
+	session, _ := h.sessionStore.Get(r, "dbbridge-session")
+	active, _ = session.Values[wizardKey].(bool)
+	if !active {
+		if conns, err := h.connRepo.GetAll(); err == nil && len(conns) == 0 {
+			session.Values[wizardKey] = true
+			session.Save(r, w)
+			active = true
+		}
+	}
+	connID, _ = session.Values[wizardConnectionKey].(int64)
+	queryID, _ = session.Values[wizardQueryKey].(int64)
+	return active, connID, queryID
+}
+
+func (h *WebHandler) setWizardValue(w http.ResponseWriter, r *http.Request, key string, value interface{}) {
+	session, _ := h.sessionStore.Get(r, "dbbridge-session")
+	session.Values[key] = value
+	session.Save(r, w)
+}
+
+// Welcome shows a step of the setup wizard: ?step=connection (the default),
+// query or api-key. Every step can be skipped by going on to the next.
+func (h *WebHandler) Welcome(w http.ResponseWriter, r *http.Request) {
+	active, connID, queryID := h.wizardState(w, r)
+	if !active {
+		http.Redirect(w, r, "/admin", http.StatusFound)
+		return
+	}
+	step := r.URL.Query().Get("step")
+	if !slices.Contains(wizardSteps, step) {
+		step = wizardSteps[0]
+	}
+	h.renderWizard(w, r, step, connID, queryID, map[string]interface{}{})
+}
+
+func (h *WebHandler) renderWizard(w http.ResponseWriter, r *http.Request, step string, connID, queryID int64, data map[string]interface{}) {
+	data["Title"] = "Welcome"
+	data["Step"] = step
+	data["Steps"] = wizardSteps
+	data["Drivers"] = h.drivers.Options()
+	if connID != 0 {
+		if conn, err := h.connRepo.GetByID(connID); err == nil {
+			data["Connection"] = conn
+		}
+	}
+	if _, ok := data["Connection"]; !ok && step == "query" {
+		// A query needs a connection; without one from the wizard take the first
+		if conns, err := h.connRepo.GetAll(); err == nil && len(conns) > 0 {
+			data["Connection"] = &conns[0]
+		}
+	}
+	if queryID != 0 {
+		if q, err := h.queryRepo.GetByID(queryID); err == nil {
+			data["Query"] = q
+		}
+	}
+	h.render(w, r, "wizard.html", data)
+}
+
+// WelcomeConnection saves the wizard's first connection
+func (h *WebHandler) WelcomeConnection(w http.ResponseWriter, r *http.Request) {
+	active, _, queryID := h.wizardState(w, r)
+	if !active {
+		http.Redirect(w, r, "/admin", http.StatusFound)
+		return
+	}
+
+	name := r.FormValue("name")
+	rawConnStr := r.FormValue("connection_string")
+	conn := &core.DBConnection{
+		Name:     core.Slugify(name),
+		Driver:   core.PresetDriver(r.FormValue("driver")),
+		IsActive: true,
+	}
+	if errs := h.validateConnection(r, conn, name, rawConnStr, ""); len(errs) > 0 {
+		h.renderWizard(w, r, "connection", 0, queryID, map[string]interface{}{
+			"Errors": errs,
+			"Error":  h.templates.T(r, "form.error_summary"),
+			"Form":   map[string]string{"name": name, "driver": r.FormValue("driver"), "connection_string": rawConnStr},
+		})
+		return
+	}
+	enc, err := h.cryptoSvc.Encrypt(rawConnStr)
+	if err != nil {
+		h.renderWizard(w, r, "connection", 0, queryID, map[string]interface{}{"Error": "Encryption failed: " + err.Error()})
+		return
+	}
+	conn.ConnectionStringEnc = enc
+	conn.UpdatedBy = h.sessionUsername(r)
+
+	saveErr := h.connRepo.Create(conn)
+	changes := service.DiffFields(nil, conn)
+	changes.Redacted("connection_string", true)
+	ev := service.AdminEvent{Type: core.EventConnectionCreate, Target: "connection " + conn.Name, ConnectionID: conn.ID, Changes: changes}
+	if saveErr != nil {
+		ev.Error = saveErr.Error()
+	}
+	h.record(r, ev)
+	if saveErr != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.connection_save_failed", conn.Name, saveErr.Error()))
+		http.Redirect(w, r, "/admin/welcome?step=connection", http.StatusFound)
+		return
+	}
+
+	h.setWizardValue(w, r, wizardConnectionKey, conn.ID)
+	h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.connection_saved", conn.Name))
+	http.Redirect(w, r, "/admin/welcome?step=query", http.StatusFound)
+}
+
+// WelcomeQuery saves the wizard's first query, linked to its connection
+func (h *WebHandler) WelcomeQuery(w http.ResponseWriter, r *http.Request) {
+	active, connID, _ := h.wizardState(w, r)
+	if !active {
+		http.Redirect(w, r, "/admin", http.StatusFound)
+		return
+	}
+	if id, err := strconv.ParseInt(r.FormValue("connection_id"), 10, 64); err == nil {
+		connID = id
+	}
+
+	q := &core.SavedQuery{
+		Slug:                 core.Slugify(r.FormValue("slug")),
+		Description:          strings.TrimSpace(r.FormValue("description")),
+		SQLText:              r.FormValue("sql_text"),
+		IsActive:             true,
+		ResultMode:           core.NormalizeResultMode(""),
+		AllowedConnectionIDs: []int64{connID},
+	}
+	if errs := h.validateQuery(r, q, r.FormValue("slug")); len(errs) > 0 {
+		h.renderWizard(w, r, "query", connID, 0, map[string]interface{}{
+			"Errors": errs,
+			"Error":  h.templates.T(r, "form.error_summary"),
+			"Form":   map[string]string{"slug": r.FormValue("slug"), "description": q.Description, "sql_text": q.SQLText},
+		})
+		return
+	}
+	q.UpdatedBy = h.sessionUsername(r)
+
+	saveErr := h.queryRepo.Create(q)
+	ev := service.AdminEvent{Type: core.EventQueryCreate, Target: "query " + q.Slug, QueryID: q.ID, Changes: h.queryChanges(nil, q)}
+	if saveErr != nil {
+		ev.Error = saveErr.Error()
+	}
+	h.record(r, ev)
+	if saveErr != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.query_save_failed", q.Slug, saveErr.Error()))
+		http.Redirect(w, r, "/admin/welcome?step=query", http.StatusFound)
+		return
+	}
+	h.recordContract(nil, q)
+
+	h.setWizardValue(w, r, wizardQueryKey, q.ID)
+	h.SetFlash(w, r, FlashSuccess, h.templates.T(r, "flash.query_saved", q.Slug))
+	http.Redirect(w, r, "/admin/welcome?step=api-key", http.StatusFound)
+}
+
+// WelcomeAPIKey generates the wizard's API key and shows it once, with a curl
+// call of the wizard's query when there is one
+func (h *WebHandler) WelcomeAPIKey(w http.ResponseWriter, r *http.Request) {
+	active, connID, queryID := h.wizardState(w, r)
+	if !active {
+		http.Redirect(w, r, "/admin", http.StatusFound)
+		return
+	}
+
+	description := strings.TrimSpace(r.FormValue("description"))
+	if description == "" {
+		description = "Setup wizard"
+	}
+	key, apiKey, err := h.authSvc.GenerateApiKey(h.sessionUserID(r), description)
+	if err != nil {
+		h.SetFlash(w, r, FlashError, h.templates.T(r, "flash.api_key_create_failed", err.Error()))
+		http.Redirect(w, r, "/admin/welcome?step=api-key", http.StatusFound)
+		return
+	}
+	h.record(r, service.AdminEvent{Type: core.EventAPIKeyCreate, Target: apiKeyTarget(apiKey),
+		Changes: h.apiKeyChanges(nil, apiKey)})
+
+	data := map[string]interface{}{"NewKey": key}
+	if q, err := h.queryRepo.GetByID(queryID); err == nil {
+		if conn, err := h.connRepo.GetByID(connID); err == nil {
+			docs := queryDocs(q, []core.DBConnection{*conn}, baseURL(h.config, r))
+			if curl, ok := docs["Curl"].(string); ok {
+				data["Curl"] = strings.Replace(curl, "YOUR_API_KEY", key, 1)
+			}
+		}
+	}
+	h.renderWizard(w, r, "api-key", connID, queryID, data)
+}
+
+// WelcomeFinish ends the wizard
+func (h *WebHandler) WelcomeFinish(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, "dbbridge-session")
+	delete(session.Values, wizardKey)
+	delete(session.Values, wizardConnectionKey)
+	delete(session.Values, wizardQueryKey)
+	session.Save(r, w)
+	http.Redirect(w, r, "/admin", http.StatusFound)
+}
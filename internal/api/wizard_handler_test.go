@@ -0,0 +1,80 @@
+package api
+
+import (
+	"dbbridge/internal/config"
+	"dbbridge/internal/core"
+	"dbbridge/internal/data"
+	"dbbridge/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+// recordedAudit keeps the audit entries written, for tests of admin events
+type recordedAudit struct {
+	core.AuditRepository
+	logs []core.AuditLog
+}
+
+func (a *recordedAudit) Create(log *core.AuditLog) error {
+	a.logs = append(a.logs, *log)
+	return nil
+}
+
+func TestWizardConnectionStep(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	tmpl, err := NewTemplates("../../web/templates/*.html", templateFuncs(nil, nil), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crypto, err := service.NewEncryptionService("0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit := &recordedAudit{}
+	connRepo := data.NewConnectionRepo(db)
+	h := &WebHandler{connRepo: connRepo, queryRepo: data.NewQueryRepo(db), templates: tmpl, cryptoSvc: crypto,
+		sessionStore: store, events: service.NewAdminAuditor(audit),
+		config: config.NewStore(&config.Config{SupportedDrivers: []string{"sqlite"}})}
+
+	// Without connections the wizard opens for anyone signed in
+	w := httptest.NewRecorder()
+	h.Welcome(w, httptest.NewRequest("GET", "/admin/welcome", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `action="/admin/welcome/connection"`) {
+		t.Fatalf("welcome = %d, want the connection step", w.Code)
+	}
+
+	form := url.Values{"name": {"Local DB"}, "driver": {"sqlite"}, "connection_string": {"file:local.db"}}
+	req := httptest.NewRequest("POST", "/admin/welcome/connection", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	h.WelcomeConnection(w, req)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/admin/welcome?step=query" {
+		t.Fatalf("save = %d %q, want redirect to the query step", w.Code, w.Header().Get("Location"))
+	}
+	conn, err := connRepo.GetByName("local-db")
+	if err != nil {
+		t.Fatalf("connection not saved: %v", err)
+	}
+	if len(audit.logs) != 1 || audit.logs[0].ConnectionID != conn.ID {
+		t.Errorf("audit = %+v, want one entry for the connection", audit.logs)
+	}
+
+	// Once connections exist, the dashboard link is gone and the wizard only
+	// continues for a session that started it
+	w = httptest.NewRecorder()
+	h.Welcome(w, httptest.NewRequest("GET", "/admin/welcome", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/admin" {
+		t.Errorf("welcome without a wizard session = %d %q, want redirect to /admin", w.Code, w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bufio"
+	"dbbridge/internal/service"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const defaultXMLRoot = "result"
+
+// writeXML streams the rows as
+//
+//	<result><row><order_id>1</order_id><col name="unit price">9.5</col></row></result>
+//
+// Columns whose name is a valid XML element name become elements, others fall
+// back to <col name="...">. NULL values are empty elements with xsi:nil="true".
+// Rows are always flat: shaping and result modes only apply to JSON.
+func writeXML(w http.ResponseWriter, root string, result *service.ExecutionResult) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	encodeXML(w, root, result)
+}
+
+// encodeXML writes the document of writeXML to w, flushing it every 100 rows
+// when w is an http.Flusher
+func encodeXML(w io.Writer, root string, result *service.ExecutionResult) {
+	if root == "" {
+		root = defaultXMLRoot
+	}
+
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	bw.WriteString(xml.Header)
+	fmt.Fprintf(bw, `<%s xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"`, root)
+	if result.Meta.Truncated {
+		bw.WriteString(` truncated="true"`)
+	}
+	bw.WriteString(">\n")
+
+	// Resolve each column's open/close tags once rather than per row
+	// Tags use the deduplicated row keys so repeated columns stay distinct
+	keys := result.Meta.RowKeys()
+	open := make([]string, len(keys))
+	closing := make([]string, len(keys))
+	for i, col := range keys {
+		if isXMLName(col) {
+			open[i], closing[i] = "<"+col, "</"+col+">"
+		} else {
+			var name strings.Builder
+			xml.EscapeText(&name, []byte(col))
+			open[i], closing[i] = `<col name="`+name.String()+`"`, "</col>"
+		}
+	}
+
+	for n, row := range result.Data {
+		bw.WriteString("  <row>")
+		for i, key := range keys {
+			val := row[key]
+			if val == nil {
+				bw.WriteString(open[i] + ` xsi:nil="true"/>`)
+				continue
+			}
+			bw.WriteString(open[i] + ">")
+			xml.EscapeText(bw, []byte(textValue(val)))
+			bw.WriteString(closing[i])
+		}
+		bw.WriteString("</row>\n")
+
+		// Push completed rows to the client instead of buffering the whole document
+		if n%100 == 99 {
+			bw.Flush()
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+	}
+	fmt.Fprintf(bw, "</%s>\n", root)
+}
+
+// textValue is a non-NULL value as text in the XML and CSV outputs
+func textValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// isXMLName reports whether s can be used as an element name: an XML name
+// without a namespace prefix that does not start with the reserved "xml"
+func isXMLName(s string) bool {
+	if s == "" || strings.HasPrefix(strings.ToLower(s), "xml") {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r)):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"dbbridge/internal/service"
+	"encoding/xml"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteXML(t *testing.T) {
+	result := &service.ExecutionResult{
+		Meta: service.MetaInfo{Columns: []string{"id", "unit price", "note"}},
+		Data: []map[string]interface{}{
+			{"id": int64(1), "unit price": "9.50", "note": "a < b & \"c\""},
+			{"id": int64(2), "unit price": []byte("3"), "note": nil},
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	writeXML(rec, "orders", result)
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/xml") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`<orders xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">`,
+		`<row><id>1</id><col name="unit price">9.50</col><note>a &lt; b &amp; &#34;c&#34;</note></row>`,
+		`<row><id>2</id><col name="unit price">3</col><note xsi:nil="true"/></row>`,
+		`</orders>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body missing %s\n%s", want, body)
+		}
+	}
+
+	// The document must be well-formed
+	dec := xml.NewDecoder(strings.NewReader(body))
+	for {
+		if _, err := dec.Token(); err != nil {
+			if err != io.EOF {
+				t.Fatalf("invalid XML: %v\n%s", err, body)
+			}
+			break
+		}
+	}
+}
+
+func TestIsXMLName(t *testing.T) {
+	valid := []string{"id", "order_id", "Name", "a-b.c", "_x", "prénom"}
+	invalid := []string{"", "1st", "unit price", "ns:col", "xmlData", "a/b", "-x"}
+	for _, s := range valid {
+		if !isXMLName(s) {
+			t.Errorf("isXMLName(%q) = false", s)
+		}
+	}
+	for _, s := range invalid {
+		if isXMLName(s) {
+			t.Errorf("isXMLName(%q) = true", s)
+		}
+	}
+}
+
+func TestWriteXMLDuplicateColumns(t *testing.T) {
+	result := &service.ExecutionResult{
+		Meta: service.MetaInfo{
+			Columns: []string{"id", "id", "id"},
+			Keys:    []string{"id", "id_2", "id_3"},
+		},
+		Data: []map[string]interface{}{{"id": int64(1), "id_2": int64(2), "id_3": int64(3)}},
+	}
+
+	rec := httptest.NewRecorder()
+	writeXML(rec, "pairs", result)
+
+	if want := `<row><id>1</id><id_2>2</id_2><id_3>3</id_3></row>`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("body missing %s\n%s", want, rec.Body.String())
+	}
+}
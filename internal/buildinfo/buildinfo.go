@@ -0,0 +1,43 @@
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Populated at build time via -ldflags, e.g.
+//
+//	go build -ldflags "-X dbbridge/internal/buildinfo.Version=1.2.0 -X dbbridge/internal/buildinfo.Commit=abc1234 -X dbbridge/internal/buildinfo.BuildDate=2026-01-01T00:00:00Z"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info is the JSON representation returned by GET /api/version
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build info of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// String returns a single line summary for logs and --version
+func String() string {
+	return fmt.Sprintf("DbBridge %s (commit %s, built %s, %s)", Version, Commit, BuildDate, runtime.Version())
+}
+
+// ServerHeader returns the value used for the Server response header
+func ServerHeader() string {
+	return "DbBridge/" + Version
+}
@@ -2,12 +2,14 @@ package config
 
 import (
 	"crypto/rand"
+	"dbbridge/internal/core"
 	"encoding/base64"
 	"encoding/binary"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"unicode/utf16"
 
 	"github.com/joho/godotenv"
@@ -16,16 +18,195 @@ import (
 type Config struct {
 	Port             int
 	DbBridgeKey      string
-	SupportedDrivers []string
+	SupportedDrivers []string // see core.DriverPresets, empty = all
+	DebugEndpoints   bool
+	ChaosMode        bool // fault injection under /admin/debug/chaos, for resilience testing only
+	DemoMode         bool // throwaway database seeded with sample data, see `dbbridge --demo`
+	ServerHeader     bool
+	TLSCertFile      string
+	TLSKeyFile       string
+	LogLevel         string
+	BaseURL          string
+	LoginRateLimit   int
+	LoginRateBurst   int
+	APIRateLimit     int
+	APIRateBurst     int
+	AdminRateLimit   int
+	AdminRateBurst   int
+	EmbedRateLimit   int // per embed token
+	EmbedRateBurst   int
+	APIDailyQuota    int    // requests per API key and day, 0 = unlimited
+	QuotaTimezone    string // where quota days start, empty = server time zone
+
+	// Execution caps and audit retention; all of these can be overridden at
+	// runtime from the admin settings page (see service.SettingsService)
+	QueryTimeout        int // seconds
+	MaxRows             int // 0 = unlimited
+	AuditRetentionRows  int
+	AccessEventHours    int // how long rejected API requests are kept
+	BundleMaxMB         int // total size of a zip bundle of results
+	IdempotencyTTLHours int // how long Idempotency-Key responses are replayed
+
+	// Background exports: files under ExportDir written by ExportWorkers jobs
+	// at a time, kept ExportRetentionHours and capped at ExportMaxMB in total
+	ExportDir            string
+	ExportWorkers        int
+	ExportRetentionHours int
+	ExportMaxMB          int
+	ExportTimeoutMinutes int // per export, instead of QueryTimeout
+
+	// Snapshot paging: results of up to SnapshotMaxRows rows kept for
+	// SnapshotIdleMinutes after their last page was read, at most
+	// SnapshotMaxPerKey per API key and SnapshotMaxOpen in all
+	SnapshotMaxRows     int
+	SnapshotIdleMinutes int
+	SnapshotMaxPerKey   int
+	SnapshotMaxOpen     int
+
+	// Guardrails of admin test runs on protected connections
+	ProtectedMaxRows        int
+	ProtectedTimeoutSeconds int
+
+	// Soft limits: slower or larger results succeed but are flagged, 0 = off
+	WarnDurationMs int
+	WarnRows       int
+
+	// Rate limit exemptions: client CIDRs (or single IPs), path prefixes,
+	// and requests carrying a valid admin session
+	RateLimitExemptCIDRs   []string
+	RateLimitExemptPaths   []string
+	RateLimitSessionBypass bool
+
+	// TrustedProxies are the only peers whose X-Forwarded-For / X-Real-IP headers
+	// are believed when resolving the client IP
+	TrustedProxies []string
+	// APIAllowedCIDRs restricts the public API to these client ranges (empty = unrestricted)
+	APIAllowedCIDRs []string
+
+	// RateLimitBackend is "memory" (per instance) or "redis" (shared via RedisURL)
+	RateLimitBackend string
+	RedisURL         string
+
+	// AuditSink forwards audit entries to a SIEM: "" (off), "http", "syslog" or "file".
+	// AuditSinkTarget is the endpoint URL, syslog address (udp://host:514) or file path.
+	AuditSink       string
+	AuditSinkTarget string
+	AuditSinkToken  string // sent as Bearer token by the http sink
+	AuditQueueSize  int
+	AuditBatchSize  int
+
+	// Execution audit entries are written by AuditWriteWorkers goroutines
+	// from a queue of AuditWriteQueueSize entries, dropping the oldest when full
+	AuditWriteQueueSize int
+	AuditWriteWorkers   int
+
+	// SMTP settings for email notifications; notifications are off while
+	// SMTPHost or NotifyEmailTo is empty. SMTPTLS is "starttls", "tls" or "none".
+	SMTPHost       string
+	SMTPPort       int
+	SMTPTLS        string
+	SMTPUsername   string
+	SMTPPassword   string
+	SMTPFrom       string
+	NotifyEmailTo  []string
+	NotifyThrottle int // minutes between emails of the same event type
+
+	// HashiCorp Vault for vault:path#field references in connection strings.
+	// Off while VaultAddr is empty; authenticates with VaultToken or, when it
+	// is empty, AppRole (VaultRoleID/VaultSecretID).
+	VaultAddr         string
+	VaultToken        string
+	VaultRoleID       string
+	VaultSecretID     string
+	VaultNamespace    string
+	VaultCacheSeconds int
+
+	// Maintenance mode answers API executions with 503, for all connections or
+	// only MaintenanceConnections. Usually toggled from the admin UI, which
+	// stores it as a runtime setting.
+	MaintenanceMode        bool
+	MaintenanceMessage     string
+	MaintenanceRetryAfter  int // seconds
+	MaintenanceConnections []string
+
+	// OrphanCleanup cleans rows referencing deleted objects weekly
+	OrphanCleanup bool
+
+	// InactiveKeyDisable disables API keys not used for InactiveKeyDays
+	InactiveKeyDisable bool
+	InactiveKeyDays    int
+
+	// MetadataEncrypt lists the core.EncryptGroups whose columns are stored
+	// encrypted with DBBRIDGE_KEY. Rows written before a group was listed
+	// stay plaintext until `dbbridge encrypt-metadata` converts them.
+	MetadataEncrypt []string
+
+	// Argon2id cost of new password hashes, see service.Argon2idParams.
+	// Stored hashes made with other values are re-hashed at the next login.
+	Argon2MemoryKB    int
+	Argon2Iterations  int
+	Argon2Parallelism int
+
+	// DebugCapture lets queries flagged for it store the SQL they send
+	DebugCapture bool
+
+	// ReplayWrites lets admins replay audited executions of queries that write
+	ReplayWrites bool
+
+	// SlugAliasDeprecation marks executions by a renamed query's old slug
+	// deprecated
+	SlugAliasDeprecation bool
+
+	// DisabledDriverConnections is what saved connections on a driver left
+	// out of SupportedDrivers do: "run" as before, or "block"
+	DisabledDriverConnections string
+
+	// SessionTagTemplate labels database sessions for DBAs, "off" = none
+	SessionTagTemplate string
+
+	// SQLiteBaseDir, when set, is the only directory tree sqlite connections
+	// may open files in; SQLiteReadOnly opens them all with mode=ro
+	SQLiteBaseDir  string
+	SQLiteReadOnly bool
+
+	// DefaultLocale is the admin UI language for users who have not picked
+	// one, and the language of email notifications
+	DefaultLocale string
+
+	// issues found while parsing raw values, reported by Validate
+	parseIssues []Issue
 }
 
+// Load reads the configuration from the environment (and .env), generating
+// DBBRIDGE_KEY on first start if it is missing.
 func Load() (*Config, error) {
+	return load(true)
+}
+
+// LoadForCheck reads the configuration without generating or saving a key,
+// so `dbbridge config check` has no side effects.
+func LoadForCheck() (*Config, error) {
+	return load(false)
+}
+
+func load(generateKey bool) (*Config, error) {
 	// Try loading .env file, but don't fail if it doesn't exist
-	_ = godotenv.Load()
+	loadDotEnv()
 
+	var issues []Issue
+
+	// A key that is set but too short is kept as-is and reported by Validate,
+	// regenerating it would make existing encrypted connection strings unreadable.
 	key := os.Getenv("DBBRIDGE_KEY")
-	if len(key) < 32 {
-		fmt.Println("DBBRIDGE_KEY not found or too short. Generating a new secure key...")
+	if key == "" && generateKey && os.Getenv("DEMO_MODE") == "true" {
+		// The demo database is thrown away on exit, so its key is too
+		newKey, err := generateRandomKey(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+		key = newKey
+	} else if key == "" && generateKey {
+		fmt.Println("DBBRIDGE_KEY not found. Generating a new secure key...")
 		newKey, err := generateRandomKey(32)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate key: %w", err)
@@ -39,31 +220,236 @@ func Load() (*Config, error) {
 		key = newKey
 	}
 
-	portStr := os.Getenv("PORT")
-	port := 8080
-	if portStr != "" {
-		p, err := strconv.Atoi(portStr)
-		if err == nil {
-			port = p
+	port := intEnv("PORT", 8080, &issues)
+
+	// Drivers new connections may use, by driver or display name; unset = all
+	var drivers []string
+	if driversStr := os.Getenv("SUPPORTED_DRIVERS"); driversStr != "" {
+		for _, d := range strings.Split(driversStr, ",") {
+			drivers = append(drivers, strings.TrimSpace(d))
 		}
 	}
+	disabledDriverConns := strings.TrimSpace(os.Getenv("DISABLED_DRIVER_CONNECTIONS"))
+	if disabledDriverConns == "" {
+		disabledDriverConns = "run"
+	}
 
-	driversStr := os.Getenv("SUPPORTED_DRIVERS")
-	var drivers []string
-	if driversStr != "" {
-		drivers = strings.Split(driversStr, ",")
-	} else {
-		// Default drivers if not specified
-		drivers = []string{"Sql Anywhere 10", "PostgreSQL", "MySQL", "SQLite", "SQL Server"}
+	// pprof and runtime stats under /admin/debug are off unless explicitly enabled
+	debugEndpoints := os.Getenv("DEBUG_ENDPOINTS") == "true"
+
+	// Fault injection is for developers testing resilience, never for production
+	chaosMode := os.Getenv("CHAOS_MODE") == "true"
+
+	// Server response header carries the version; set SERVER_HEADER=false to hide it
+	serverHeader := os.Getenv("SERVER_HEADER") != "false"
+
+	// Default to loopback only, so a reverse proxy on the same host works out of
+	// the box. Trusting private ranges would let any LAN client spoof its IP past
+	// API_ALLOWED_CIDRS and key allowlists: a proxy elsewhere is listed explicitly.
+	trustedProxies := listEnv("TRUSTED_PROXIES")
+	if _, set := os.LookupEnv("TRUSTED_PROXIES"); !set {
+		trustedProxies = []string{"127.0.0.1/32", "::1/128"}
+	}
+
+	rateLimitBackend := strings.ToLower(strings.TrimSpace(os.Getenv("RATE_LIMIT_BACKEND")))
+	if rateLimitBackend == "" {
+		rateLimitBackend = "memory"
+	}
+
+	smtpTLS := strings.ToLower(strings.TrimSpace(os.Getenv("SMTP_TLS")))
+	if smtpTLS == "" {
+		smtpTLS = "starttls"
+	}
+
+	defaultLocale := strings.ToLower(strings.TrimSpace(os.Getenv("DEFAULT_LOCALE")))
+	if defaultLocale == "" {
+		defaultLocale = "en"
+	}
+
+	logLevel := strings.ToLower(strings.TrimSpace(os.Getenv("LOG_LEVEL")))
+	if logLevel == "" {
+		logLevel = "info"
+	}
+
+	maintenanceMessage := strings.TrimSpace(os.Getenv("MAINTENANCE_MESSAGE"))
+	if maintenanceMessage == "" {
+		maintenanceMessage = "DbBridge is down for maintenance, please retry later"
+	}
+	sessionTag := strings.TrimSpace(os.Getenv("SESSION_TAG_TEMPLATE"))
+	if sessionTag == "" {
+		sessionTag = "dbbridge/{query}/{key}"
+	}
+	exportDir := strings.TrimSpace(os.Getenv("EXPORT_DIR"))
+	if exportDir == "" {
+		exportDir = "exports"
 	}
 
 	return &Config{
 		Port:             port,
 		DbBridgeKey:      key,
 		SupportedDrivers: drivers,
+		DebugEndpoints:   debugEndpoints,
+		ChaosMode:        chaosMode,
+		DemoMode:         os.Getenv("DEMO_MODE") == "true",
+		ServerHeader:     serverHeader,
+		TLSCertFile:      os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:       os.Getenv("TLS_KEY_FILE"),
+		LogLevel:         logLevel,
+		BaseURL:          strings.TrimRight(strings.TrimSpace(os.Getenv("BASE_URL")), "/"),
+		LoginRateLimit:   intEnv("LOGIN_RATE_LIMIT", 5, &issues),
+		LoginRateBurst:   intEnv("LOGIN_RATE_BURST", 3, &issues),
+		APIRateLimit:     intEnv("API_RATE_LIMIT", 60, &issues),
+		APIRateBurst:     intEnv("API_RATE_BURST", 10, &issues),
+		AdminRateLimit:   intEnv("ADMIN_RATE_LIMIT", 300, &issues),
+		AdminRateBurst:   intEnv("ADMIN_RATE_BURST", 50, &issues),
+		EmbedRateLimit:   intEnv("EMBED_RATE_LIMIT", 30, &issues),
+		EmbedRateBurst:   intEnv("EMBED_RATE_BURST", 10, &issues),
+		APIDailyQuota:    intEnv("API_DAILY_QUOTA", 0, &issues),
+		QuotaTimezone:    strings.TrimSpace(os.Getenv("QUOTA_TIMEZONE")),
+
+		QueryTimeout:        intEnv("QUERY_TIMEOUT_SECONDS", 30, &issues),
+		MaxRows:             intEnv("MAX_ROWS", 0, &issues),
+		AuditRetentionRows:  intEnv("AUDIT_RETENTION_ROWS", 1000, &issues),
+		AccessEventHours:    intEnv("ACCESS_EVENT_RETENTION_HOURS", 72, &issues),
+		BundleMaxMB:         intEnv("BUNDLE_MAX_MB", 100, &issues),
+		IdempotencyTTLHours: intEnv("IDEMPOTENCY_TTL_HOURS", 24, &issues),
+
+		ExportDir:            exportDir,
+		ExportWorkers:        intEnv("EXPORT_WORKERS", 2, &issues),
+		ExportRetentionHours: intEnv("EXPORT_RETENTION_HOURS", 24, &issues),
+		ExportMaxMB:          intEnv("EXPORT_MAX_MB", 10240, &issues),
+		ExportTimeoutMinutes: intEnv("EXPORT_TIMEOUT_MINUTES", 120, &issues),
+
+		SnapshotMaxRows:     intEnv("SNAPSHOT_MAX_ROWS", 100000, &issues),
+		SnapshotIdleMinutes: intEnv("SNAPSHOT_IDLE_MINUTES", 10, &issues),
+		SnapshotMaxPerKey:   intEnv("SNAPSHOT_MAX_PER_KEY", 3, &issues),
+		SnapshotMaxOpen:     intEnv("SNAPSHOT_MAX_OPEN", 20, &issues),
+
+		ProtectedMaxRows:        intEnv("PROTECTED_MAX_ROWS", 100, &issues),
+		ProtectedTimeoutSeconds: intEnv("PROTECTED_TIMEOUT_SECONDS", 5, &issues),
+
+		WarnDurationMs: intEnv("WARN_DURATION_MS", 0, &issues),
+		WarnRows:       intEnv("WARN_ROWS", 0, &issues),
+
+		RateLimitExemptCIDRs:      listEnv("RATE_LIMIT_EXEMPT_CIDRS"),
+		RateLimitExemptPaths:      listEnv("RATE_LIMIT_EXEMPT_PATHS"),
+		RateLimitSessionBypass:    os.Getenv("RATE_LIMIT_SESSION_BYPASS") != "false",
+		RateLimitBackend:          rateLimitBackend,
+		RedisURL:                  strings.TrimSpace(os.Getenv("REDIS_URL")),
+		TrustedProxies:            trustedProxies,
+		APIAllowedCIDRs:           listEnv("API_ALLOWED_CIDRS"),
+		AuditSink:                 strings.ToLower(strings.TrimSpace(os.Getenv("AUDIT_SINK"))),
+		AuditSinkTarget:           strings.TrimSpace(os.Getenv("AUDIT_SINK_TARGET")),
+		AuditSinkToken:            os.Getenv("AUDIT_SINK_TOKEN"),
+		AuditQueueSize:            intEnv("AUDIT_QUEUE_SIZE", 1000, &issues),
+		AuditBatchSize:            intEnv("AUDIT_BATCH_SIZE", 100, &issues),
+		AuditWriteQueueSize:       intEnv("AUDIT_WRITE_QUEUE_SIZE", 10000, &issues),
+		AuditWriteWorkers:         intEnv("AUDIT_WRITE_WORKERS", 2, &issues),
+		SMTPHost:                  strings.TrimSpace(os.Getenv("SMTP_HOST")),
+		SMTPPort:                  intEnv("SMTP_PORT", 587, &issues),
+		SMTPTLS:                   smtpTLS,
+		SMTPUsername:              os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:              os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:                  strings.TrimSpace(os.Getenv("SMTP_FROM")),
+		NotifyEmailTo:             listEnv("NOTIFY_EMAIL_TO"),
+		NotifyThrottle:            intEnv("NOTIFY_THROTTLE_MINUTES", 15, &issues),
+		VaultAddr:                 strings.TrimRight(strings.TrimSpace(os.Getenv("VAULT_ADDR")), "/"),
+		VaultToken:                strings.TrimSpace(os.Getenv("VAULT_TOKEN")),
+		VaultRoleID:               strings.TrimSpace(os.Getenv("VAULT_ROLE_ID")),
+		VaultSecretID:             strings.TrimSpace(os.Getenv("VAULT_SECRET_ID")),
+		VaultNamespace:            strings.TrimSpace(os.Getenv("VAULT_NAMESPACE")),
+		VaultCacheSeconds:         intEnv("VAULT_CACHE_SECONDS", 300, &issues),
+		MaintenanceMode:           os.Getenv("MAINTENANCE_MODE") == "true",
+		MaintenanceMessage:        maintenanceMessage,
+		MaintenanceRetryAfter:     intEnv("MAINTENANCE_RETRY_AFTER", 300, &issues),
+		MaintenanceConnections:    listEnv("MAINTENANCE_CONNECTIONS"),
+		OrphanCleanup:             os.Getenv("ORPHAN_CLEANUP") == "true",
+		InactiveKeyDisable:        os.Getenv("INACTIVE_KEY_DISABLE") == "true",
+		InactiveKeyDays:           intEnv("INACTIVE_KEY_DAYS", 90, &issues),
+		MetadataEncrypt:           listEnv("METADATA_ENCRYPT"),
+		Argon2MemoryKB:            intEnv("ARGON2_MEMORY_KB", 64*1024, &issues),
+		Argon2Iterations:          intEnv("ARGON2_ITERATIONS", 3, &issues),
+		Argon2Parallelism:         intEnv("ARGON2_PARALLELISM", 2, &issues),
+		DebugCapture:              os.Getenv("DEBUG_CAPTURE") != "false",
+		ReplayWrites:              os.Getenv("AUDIT_REPLAY_WRITES") != "false",
+		SlugAliasDeprecation:      os.Getenv("SLUG_ALIAS_DEPRECATION") != "false",
+		SessionTagTemplate:        sessionTag,
+		DisabledDriverConnections: disabledDriverConns,
+		SQLiteBaseDir:             strings.TrimSpace(os.Getenv("SQLITE_BASE_DIR")),
+		SQLiteReadOnly:            os.Getenv("SQLITE_READ_ONLY") == "true",
+		DefaultLocale:             defaultLocale,
+
+		parseIssues: issues,
 	}, nil
 }
 
+// intEnv parses a numeric variable, recording an issue instead of silently
+// falling back to the default when the value is not a number
+func intEnv(key string, def int, issues *[]Issue) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		*issues = append(*issues, Issue{Key: key, Fatal: true,
+			Message: fmt.Sprintf("%q is not a number, e.g. %s=%d", raw, key, def)})
+		return def
+	}
+	return v
+}
+
+// listEnv splits a comma separated variable, dropping empty entries
+func listEnv(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+var (
+	envMu      sync.Mutex
+	processEnv map[string]bool // variables set by the real environment, never overridden by .env
+	dotenvKeys map[string]bool // variables currently populated from .env
+)
+
+// loadDotEnv applies .env on top of the process environment. Unlike godotenv.Load
+// it can be called again on reload: values from .env are refreshed (and removed
+// ones unset) while variables from the real environment still take precedence.
+func loadDotEnv() {
+	envMu.Lock()
+	defer envMu.Unlock()
+
+	if processEnv == nil {
+		processEnv = make(map[string]bool)
+		for _, env := range os.Environ() {
+			processEnv[strings.SplitN(env, "=", 2)[0]] = true
+		}
+	}
+
+	values, err := godotenv.Read()
+	if err != nil {
+		return
+	}
+
+	for k := range dotenvKeys {
+		if _, ok := values[k]; !ok {
+			os.Unsetenv(k)
+		}
+	}
+	dotenvKeys = make(map[string]bool)
+	for k, v := range values {
+		if processEnv[k] {
+			continue
+		}
+		os.Setenv(k, v)
+		dotenvKeys[k] = true
+	}
+}
+
 func generateRandomKey(length int) (string, error) {
 	b := make([]byte, length)
 	_, err := rand.Read(b)
@@ -156,3 +542,113 @@ func saveKeyToEnv(key string) error {
 	output := strings.Join(newLines, "\n")
 	return os.WriteFile(filename, []byte(output), 0644)
 }
+
+// Setting returns the env-derived value of a runtime setting by its variable
+// name, used as the fallback when no override is stored in the database
+func (c *Config) Setting(key string) string {
+	switch key {
+	case "QUERY_TIMEOUT_SECONDS":
+		return strconv.Itoa(c.QueryTimeout)
+	case "MAX_ROWS":
+		return strconv.Itoa(c.MaxRows)
+	case "AUDIT_RETENTION_ROWS":
+		return strconv.Itoa(c.AuditRetentionRows)
+	case "ACCESS_EVENT_RETENTION_HOURS":
+		return strconv.Itoa(c.AccessEventHours)
+	case "BUNDLE_MAX_MB":
+		return strconv.Itoa(c.BundleMaxMB)
+	case "IDEMPOTENCY_TTL_HOURS":
+		return strconv.Itoa(c.IdempotencyTTLHours)
+	case "EXPORT_RETENTION_HOURS":
+		return strconv.Itoa(c.ExportRetentionHours)
+	case "EXPORT_MAX_MB":
+		return strconv.Itoa(c.ExportMaxMB)
+	case "EXPORT_TIMEOUT_MINUTES":
+		return strconv.Itoa(c.ExportTimeoutMinutes)
+	case "SNAPSHOT_MAX_ROWS":
+		return strconv.Itoa(c.SnapshotMaxRows)
+	case "SNAPSHOT_IDLE_MINUTES":
+		return strconv.Itoa(c.SnapshotIdleMinutes)
+	case "SNAPSHOT_MAX_PER_KEY":
+		return strconv.Itoa(c.SnapshotMaxPerKey)
+	case "SNAPSHOT_MAX_OPEN":
+		return strconv.Itoa(c.SnapshotMaxOpen)
+	case "PROTECTED_MAX_ROWS":
+		return strconv.Itoa(c.ProtectedMaxRows)
+	case "PROTECTED_TIMEOUT_SECONDS":
+		return strconv.Itoa(c.ProtectedTimeoutSeconds)
+	case "WARN_DURATION_MS":
+		return strconv.Itoa(c.WarnDurationMs)
+	case "WARN_ROWS":
+		return strconv.Itoa(c.WarnRows)
+	case "LOGIN_RATE_LIMIT":
+		return strconv.Itoa(c.LoginRateLimit)
+	case "LOGIN_RATE_BURST":
+		return strconv.Itoa(c.LoginRateBurst)
+	case "API_RATE_LIMIT":
+		return strconv.Itoa(c.APIRateLimit)
+	case "API_RATE_BURST":
+		return strconv.Itoa(c.APIRateBurst)
+	case "ADMIN_RATE_LIMIT":
+		return strconv.Itoa(c.AdminRateLimit)
+	case "ADMIN_RATE_BURST":
+		return strconv.Itoa(c.AdminRateBurst)
+	case "EMBED_RATE_LIMIT":
+		return strconv.Itoa(c.EmbedRateLimit)
+	case "EMBED_RATE_BURST":
+		return strconv.Itoa(c.EmbedRateBurst)
+	case "API_DAILY_QUOTA":
+		return strconv.Itoa(c.APIDailyQuota)
+	case "QUOTA_TIMEZONE":
+		return c.QuotaTimezone
+	case "SMTP_HOST":
+		return c.SMTPHost
+	case "SMTP_PORT":
+		return strconv.Itoa(c.SMTPPort)
+	case "SMTP_TLS":
+		return c.SMTPTLS
+	case "SMTP_USERNAME":
+		return c.SMTPUsername
+	case "SMTP_PASSWORD":
+		return c.SMTPPassword
+	case "SMTP_FROM":
+		return c.SMTPFrom
+	case "NOTIFY_EMAIL_TO":
+		return strings.Join(c.NotifyEmailTo, ",")
+	case "NOTIFY_THROTTLE_MINUTES":
+		return strconv.Itoa(c.NotifyThrottle)
+	case "MAINTENANCE_MODE":
+		return strconv.FormatBool(c.MaintenanceMode)
+	case "MAINTENANCE_MESSAGE":
+		return c.MaintenanceMessage
+	case "MAINTENANCE_RETRY_AFTER":
+		return strconv.Itoa(c.MaintenanceRetryAfter)
+	case "MAINTENANCE_CONNECTIONS":
+		return strings.Join(c.MaintenanceConnections, ",")
+	case "ORPHAN_CLEANUP":
+		return strconv.FormatBool(c.OrphanCleanup)
+	case "INACTIVE_KEY_DISABLE":
+		return strconv.FormatBool(c.InactiveKeyDisable)
+	case "INACTIVE_KEY_DAYS":
+		return strconv.Itoa(c.InactiveKeyDays)
+	case "DEBUG_CAPTURE":
+		return strconv.FormatBool(c.DebugCapture)
+	case "AUDIT_REPLAY_WRITES":
+		return strconv.FormatBool(c.ReplayWrites)
+	case "SLUG_ALIAS_DEPRECATION":
+		return strconv.FormatBool(c.SlugAliasDeprecation)
+	case "SESSION_TAG_TEMPLATE":
+		return c.SessionTagTemplate
+	case "SUPPORTED_DRIVERS":
+		var drivers []string
+		for _, d := range c.SupportedDrivers {
+			drivers = append(drivers, core.DriverName(d))
+		}
+		return strings.Join(drivers, ",")
+	case "DISABLED_DRIVER_CONNECTIONS":
+		return c.DisabledDriverConnections
+	case "DEFAULT_LOCALE":
+		return c.DefaultLocale
+	}
+	return ""
+}
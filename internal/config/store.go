@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Store holds the active configuration behind an atomically swapped pointer.
+// Handlers call Get on every request so a reload is picked up without a restart.
+type Store struct {
+	current atomic.Pointer[Config]
+
+	mu    sync.Mutex // serializes Reload and hook registration
+	hooks []func(*Config)
+}
+
+func NewStore(cfg *Config) *Store {
+	s := &Store{}
+	s.current.Store(cfg)
+	return s
+}
+
+// Get returns the active configuration. Callers must treat it as read-only.
+func (s *Store) Get() *Config {
+	return s.current.Load()
+}
+
+// OnReload registers a function that applies reloadable settings to a live
+// component (rate limiters, logger, ...). It is called after every successful reload.
+func (s *Store) OnReload(fn func(*Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, fn)
+}
+
+// ReloadResult describes the outcome of a reload
+type ReloadResult struct {
+	Issues          []Issue  `json:"-"`
+	Warnings        []string `json:"warnings"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// Reload re-reads the environment and .env, validates the result and swaps it in.
+// Settings that cannot change on a running server keep their current value and
+// are reported in RestartRequired. On validation errors nothing is applied.
+func (s *Store) Reload() (*ReloadResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.Get()
+	next, err := load(false)
+	if err != nil {
+		return nil, err
+	}
+	if next.DbBridgeKey == "" {
+		next.DbBridgeKey = old.DbBridgeKey
+	}
+
+	result := &ReloadResult{Issues: next.Validate()}
+	if HasFatal(result.Issues) {
+		var msgs []string
+		for _, issue := range result.Issues {
+			if issue.Fatal {
+				msgs = append(msgs, issue.String())
+			}
+		}
+		return result, errors.New("configuration not reloaded: " + strings.Join(msgs, "; "))
+	}
+	for _, issue := range result.Issues {
+		result.Warnings = append(result.Warnings, issue.String())
+	}
+
+	// Non-reloadable settings: keep what the server was started with
+	keep := func(name string, changed bool) {
+		if changed {
+			result.RestartRequired = append(result.RestartRequired, name)
+		}
+	}
+	keep("PORT", next.Port != old.Port)
+	keep("DBBRIDGE_KEY", next.DbBridgeKey != old.DbBridgeKey)
+	keep("TLS_CERT_FILE", next.TLSCertFile != old.TLSCertFile)
+	keep("TLS_KEY_FILE", next.TLSKeyFile != old.TLSKeyFile)
+	keep("DEBUG_ENDPOINTS", next.DebugEndpoints != old.DebugEndpoints)
+	keep("CHAOS_MODE", next.ChaosMode != old.ChaosMode)
+	keep("DEMO_MODE", next.DemoMode != old.DemoMode)
+	keep("SERVER_HEADER", next.ServerHeader != old.ServerHeader)
+	keep("RATE_LIMIT_BACKEND", next.RateLimitBackend != old.RateLimitBackend)
+	keep("REDIS_URL", next.RedisURL != old.RedisURL)
+	keep("AUDIT_SINK", next.AuditSink != old.AuditSink)
+	keep("AUDIT_SINK_TARGET", next.AuditSinkTarget != old.AuditSinkTarget)
+	keep("AUDIT_SINK_TOKEN", next.AuditSinkToken != old.AuditSinkToken)
+	keep("AUDIT_QUEUE_SIZE", next.AuditQueueSize != old.AuditQueueSize)
+	keep("AUDIT_BATCH_SIZE", next.AuditBatchSize != old.AuditBatchSize)
+	keep("AUDIT_WRITE_QUEUE_SIZE", next.AuditWriteQueueSize != old.AuditWriteQueueSize)
+	keep("AUDIT_WRITE_WORKERS", next.AuditWriteWorkers != old.AuditWriteWorkers)
+	keep("SQLITE_BASE_DIR", next.SQLiteBaseDir != old.SQLiteBaseDir)
+	keep("SQLITE_READ_ONLY", next.SQLiteReadOnly != old.SQLiteReadOnly)
+	keep("EXPORT_DIR", next.ExportDir != old.ExportDir)
+	keep("EXPORT_WORKERS", next.ExportWorkers != old.ExportWorkers)
+	keep("METADATA_ENCRYPT", !slices.Equal(next.MetadataEncrypt, old.MetadataEncrypt))
+	keep("ARGON2_MEMORY_KB", next.Argon2MemoryKB != old.Argon2MemoryKB)
+	keep("ARGON2_ITERATIONS", next.Argon2Iterations != old.Argon2Iterations)
+	keep("ARGON2_PARALLELISM", next.Argon2Parallelism != old.Argon2Parallelism)
+	next.Port = old.Port
+	next.DbBridgeKey = old.DbBridgeKey
+	next.TLSCertFile = old.TLSCertFile
+	next.TLSKeyFile = old.TLSKeyFile
+	next.DebugEndpoints = old.DebugEndpoints
+	next.ChaosMode = old.ChaosMode
+	next.DemoMode = old.DemoMode
+	next.ServerHeader = old.ServerHeader
+	next.RateLimitBackend = old.RateLimitBackend
+	next.RedisURL = old.RedisURL
+	next.AuditSink = old.AuditSink
+	next.AuditSinkTarget = old.AuditSinkTarget
+	next.AuditSinkToken = old.AuditSinkToken
+	next.AuditQueueSize = old.AuditQueueSize
+	next.AuditBatchSize = old.AuditBatchSize
+	next.AuditWriteQueueSize = old.AuditWriteQueueSize
+	next.AuditWriteWorkers = old.AuditWriteWorkers
+	next.SQLiteBaseDir = old.SQLiteBaseDir
+	next.SQLiteReadOnly = old.SQLiteReadOnly
+	next.ExportDir = old.ExportDir
+	next.ExportWorkers = old.ExportWorkers
+	next.MetadataEncrypt = old.MetadataEncrypt
+	next.Argon2MemoryKB = old.Argon2MemoryKB
+	next.Argon2Iterations = old.Argon2Iterations
+	next.Argon2Parallelism = old.Argon2Parallelism
+
+	s.current.Store(next)
+	for _, fn := range s.hooks {
+		fn(next)
+	}
+
+	return result, nil
+}
+
+func (r *ReloadResult) String() string {
+	msg := fmt.Sprintf("configuration reloaded (%d warnings)", len(r.Warnings))
+	if len(r.RestartRequired) > 0 {
+		msg += "; restart required to apply: " + strings.Join(r.RestartRequired, ", ")
+	}
+	return msg
+}
@@ -0,0 +1,458 @@
+package config
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/i18n"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// minKeyEntropyBits is the estimated entropy below which DBBRIDGE_KEY is flagged as weak
+const minKeyEntropyBits = 128
+
+// knownPrefixedVars lists the DBBRIDGE_* variables DbBridge understands.
+// Anything else with the prefix is most likely a typo.
+var knownPrefixedVars = map[string]bool{
+	"DBBRIDGE_KEY": true,
+}
+
+// Issue is a single configuration problem. Fatal issues prevent startup,
+// the rest are printed as warnings.
+type Issue struct {
+	Key     string
+	Message string
+	Fatal   bool
+}
+
+func (i Issue) String() string {
+	level := "WARNING"
+	if i.Fatal {
+		level = "ERROR"
+	}
+	return fmt.Sprintf("%s %s: %s", level, i.Key, i.Message)
+}
+
+// Validate checks the loaded configuration and returns every problem found,
+// so they can all be reported at once instead of failing on the first one.
+func (c *Config) Validate() []Issue {
+	issues := append([]Issue{}, c.parseIssues...)
+
+	if c.Port < 1 || c.Port > 65535 {
+		issues = append(issues, Issue{Key: "PORT", Fatal: true,
+			Message: fmt.Sprintf("%d is out of range, must be between 1 and 65535", c.Port)})
+	}
+
+	switch {
+	case c.DbBridgeKey == "":
+		issues = append(issues, Issue{Key: "DBBRIDGE_KEY",
+			Message: "not set, a new key will be generated and saved to .env on first start"})
+	case len(c.DbBridgeKey) < 32:
+		issues = append(issues, Issue{Key: "DBBRIDGE_KEY", Fatal: true,
+			Message: fmt.Sprintf("too short (%d characters, need at least 32); set a longer key or remove it to let DbBridge generate one (existing encrypted connection strings will need to be re-entered)", len(c.DbBridgeKey))})
+	default:
+		if bits := estimateEntropyBits(c.DbBridgeKey); bits < minKeyEntropyBits {
+			issues = append(issues, Issue{Key: "DBBRIDGE_KEY",
+				Message: fmt.Sprintf("looks weak (~%.0f bits of entropy, want at least %d); use a random value such as the one generated on first start", bits, minKeyEntropyBits)})
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, d := range c.SupportedDrivers {
+		if d == "" {
+			issues = append(issues, Issue{Key: "SUPPORTED_DRIVERS", Fatal: true,
+				Message: fmt.Sprintf("entry %d is empty, check for stray commas", i+1)})
+			continue
+		}
+		if !core.KnownDriver(d) {
+			issues = append(issues, Issue{Key: "SUPPORTED_DRIVERS", Fatal: true,
+				Message: fmt.Sprintf("%q is not a driver DbBridge connects with (use %s)", d, strings.Join(core.Drivers(), ", "))})
+			continue
+		}
+		if seen[core.DriverName(d)] {
+			issues = append(issues, Issue{Key: "SUPPORTED_DRIVERS",
+				Message: fmt.Sprintf("%q is listed more than once", d)})
+		}
+		seen[core.DriverName(d)] = true
+	}
+	if c.DisabledDriverConnections != "run" && c.DisabledDriverConnections != "block" {
+		issues = append(issues, Issue{Key: "DISABLED_DRIVER_CONNECTIONS", Fatal: true,
+			Message: fmt.Sprintf("%q is neither run nor block", c.DisabledDriverConnections)})
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		issues = append(issues, Issue{Key: "TLS_CERT_FILE/TLS_KEY_FILE", Fatal: true,
+			Message: "both must be set to enable HTTPS, or both left empty"})
+	}
+	for _, f := range []struct{ key, path string }{{"TLS_CERT_FILE", c.TLSCertFile}, {"TLS_KEY_FILE", c.TLSKeyFile}} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			issues = append(issues, Issue{Key: f.key, Fatal: true,
+				Message: fmt.Sprintf("cannot read %q: %v", f.path, err)})
+		}
+	}
+
+	if c.SQLiteBaseDir != "" {
+		if info, err := os.Stat(c.SQLiteBaseDir); err != nil {
+			issues = append(issues, Issue{Key: "SQLITE_BASE_DIR", Fatal: true,
+				Message: fmt.Sprintf("cannot read %q: %v", c.SQLiteBaseDir, err)})
+		} else if !info.IsDir() {
+			issues = append(issues, Issue{Key: "SQLITE_BASE_DIR", Fatal: true,
+				Message: fmt.Sprintf("%q is not a directory", c.SQLiteBaseDir)})
+		}
+	}
+
+	if c.LogLevel != "info" && c.LogLevel != "error" {
+		issues = append(issues, Issue{Key: "LOG_LEVEL",
+			Message: fmt.Sprintf("%q is not a valid level, use info or error (falling back to info)", c.LogLevel)})
+	}
+
+	if i18n.Normalize(c.DefaultLocale) != c.DefaultLocale {
+		issues = append(issues, Issue{Key: "DEFAULT_LOCALE",
+			Message: fmt.Sprintf("%q is not supported, use %s (falling back to en)", c.DefaultLocale, strings.Join(i18n.Locales(), " or "))})
+	}
+
+	if c.BaseURL != "" {
+		if u, err := url.Parse(c.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			issues = append(issues, Issue{Key: "BASE_URL", Fatal: true,
+				Message: fmt.Sprintf("%q is not an absolute http(s) URL, e.g. BASE_URL=https://dbbridge.example.com", c.BaseURL)})
+		}
+	}
+
+	for _, limit := range []struct {
+		key string
+		v   int
+	}{
+		{"LOGIN_RATE_LIMIT", c.LoginRateLimit},
+		{"LOGIN_RATE_BURST", c.LoginRateBurst},
+		{"API_RATE_LIMIT", c.APIRateLimit},
+		{"API_RATE_BURST", c.APIRateBurst},
+		{"ADMIN_RATE_LIMIT", c.AdminRateLimit},
+		{"ADMIN_RATE_BURST", c.AdminRateBurst},
+		{"EMBED_RATE_LIMIT", c.EmbedRateLimit},
+		{"EMBED_RATE_BURST", c.EmbedRateBurst},
+	} {
+		if limit.v < 1 {
+			issues = append(issues, Issue{Key: limit.key, Fatal: true,
+				Message: fmt.Sprintf("%d must be at least 1", limit.v)})
+		}
+	}
+
+	if c.APIDailyQuota < 0 {
+		issues = append(issues, Issue{Key: "API_DAILY_QUOTA", Fatal: true, Message: "must not be negative (0 = unlimited)"})
+	}
+	if c.QuotaTimezone != "" {
+		if _, err := time.LoadLocation(c.QuotaTimezone); err != nil {
+			issues = append(issues, Issue{Key: "QUOTA_TIMEZONE", Fatal: true,
+				Message: fmt.Sprintf("%q is not a time zone, e.g. Asia/Jakarta", c.QuotaTimezone)})
+		}
+	}
+
+	for _, cidr := range c.RateLimitExemptCIDRs {
+		if _, err := ParseCIDR(cidr); err != nil {
+			issues = append(issues, Issue{Key: "RATE_LIMIT_EXEMPT_CIDRS", Fatal: true,
+				Message: fmt.Sprintf("%q is not a CIDR or IP address, e.g. 10.0.0.0/8", cidr)})
+		}
+	}
+	for _, list := range []struct {
+		key   string
+		cidrs []string
+	}{
+		{"TRUSTED_PROXIES", c.TrustedProxies},
+		{"API_ALLOWED_CIDRS", c.APIAllowedCIDRs},
+	} {
+		for _, cidr := range list.cidrs {
+			if _, err := ParseCIDR(cidr); err != nil {
+				issues = append(issues, Issue{Key: list.key, Fatal: true,
+					Message: fmt.Sprintf("%q is not a CIDR or IP address, e.g. 10.0.0.0/8", cidr)})
+			}
+		}
+	}
+
+	for _, path := range c.RateLimitExemptPaths {
+		if !strings.HasPrefix(path, "/") {
+			issues = append(issues, Issue{Key: "RATE_LIMIT_EXEMPT_PATHS", Fatal: true,
+				Message: fmt.Sprintf("%q must start with /, e.g. /api/version", path)})
+		}
+	}
+
+	if c.QueryTimeout < 1 {
+		issues = append(issues, Issue{Key: "QUERY_TIMEOUT_SECONDS", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.MaxRows < 0 {
+		issues = append(issues, Issue{Key: "MAX_ROWS", Fatal: true, Message: "must not be negative (0 = unlimited)"})
+	}
+	if c.BundleMaxMB < 1 {
+		issues = append(issues, Issue{Key: "BUNDLE_MAX_MB", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.IdempotencyTTLHours < 1 {
+		issues = append(issues, Issue{Key: "IDEMPOTENCY_TTL_HOURS", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.ExportWorkers < 1 {
+		issues = append(issues, Issue{Key: "EXPORT_WORKERS", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.ExportRetentionHours < 1 {
+		issues = append(issues, Issue{Key: "EXPORT_RETENTION_HOURS", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.ExportMaxMB < 1 {
+		issues = append(issues, Issue{Key: "EXPORT_MAX_MB", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.ExportTimeoutMinutes < 1 {
+		issues = append(issues, Issue{Key: "EXPORT_TIMEOUT_MINUTES", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.SnapshotMaxRows < 1 {
+		issues = append(issues, Issue{Key: "SNAPSHOT_MAX_ROWS", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.SnapshotIdleMinutes < 1 {
+		issues = append(issues, Issue{Key: "SNAPSHOT_IDLE_MINUTES", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.SnapshotMaxPerKey < 1 {
+		issues = append(issues, Issue{Key: "SNAPSHOT_MAX_PER_KEY", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.SnapshotMaxOpen < 1 {
+		issues = append(issues, Issue{Key: "SNAPSHOT_MAX_OPEN", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.InactiveKeyDays < 1 {
+		issues = append(issues, Issue{Key: "INACTIVE_KEY_DAYS", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.Argon2Iterations < 1 {
+		issues = append(issues, Issue{Key: "ARGON2_ITERATIONS", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.Argon2Parallelism < 1 || c.Argon2Parallelism > 255 {
+		issues = append(issues, Issue{Key: "ARGON2_PARALLELISM", Fatal: true, Message: "must be between 1 and 255"})
+	}
+	switch {
+	case c.Argon2MemoryKB < 8*c.Argon2Parallelism:
+		issues = append(issues, Issue{Key: "ARGON2_MEMORY_KB", Fatal: true,
+			Message: fmt.Sprintf("must be at least 8 KiB per lane of ARGON2_PARALLELISM (%d)", 8*c.Argon2Parallelism)})
+	case c.Argon2MemoryKB > 4*1024*1024:
+		issues = append(issues, Issue{Key: "ARGON2_MEMORY_KB", Fatal: true, Message: "must be at most 4194304 (4 GiB)"})
+	case c.Argon2MemoryKB < 19*1024:
+		issues = append(issues, Issue{Key: "ARGON2_MEMORY_KB",
+			Message: fmt.Sprintf("%d KiB is below the 19456 KiB commonly recommended for password hashing", c.Argon2MemoryKB)})
+	}
+	for _, g := range c.MetadataEncrypt {
+		if !slices.Contains(core.EncryptGroups, g) {
+			issues = append(issues, Issue{Key: "METADATA_ENCRYPT", Fatal: true,
+				Message: fmt.Sprintf("%q is not a column group, use %s", g, strings.Join(core.EncryptGroups, ", "))})
+		}
+	}
+	if c.ProtectedMaxRows < 1 {
+		issues = append(issues, Issue{Key: "PROTECTED_MAX_ROWS", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.ProtectedTimeoutSeconds < 1 {
+		issues = append(issues, Issue{Key: "PROTECTED_TIMEOUT_SECONDS", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.WarnDurationMs < 0 {
+		issues = append(issues, Issue{Key: "WARN_DURATION_MS", Fatal: true, Message: "must not be negative (0 = off)"})
+	}
+	if c.WarnRows < 0 {
+		issues = append(issues, Issue{Key: "WARN_ROWS", Fatal: true, Message: "must not be negative (0 = off)"})
+	}
+	if c.AuditRetentionRows < 1 {
+		issues = append(issues, Issue{Key: "AUDIT_RETENTION_ROWS", Fatal: true, Message: "must be at least 1"})
+	}
+
+	switch c.RateLimitBackend {
+	case "memory":
+	case "redis":
+		if c.RedisURL == "" {
+			issues = append(issues, Issue{Key: "REDIS_URL", Fatal: true,
+				Message: "required when RATE_LIMIT_BACKEND=redis, e.g. REDIS_URL=redis://:password@localhost:6379/0"})
+		} else if u, err := url.Parse(c.RedisURL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+			issues = append(issues, Issue{Key: "REDIS_URL", Fatal: true,
+				Message: "must be a redis:// or rediss:// URL"})
+		}
+	default:
+		issues = append(issues, Issue{Key: "RATE_LIMIT_BACKEND", Fatal: true,
+			Message: fmt.Sprintf("%q is not supported, use memory or redis", c.RateLimitBackend)})
+	}
+
+	switch c.AuditSink {
+	case "":
+	case "http":
+		if u, err := url.Parse(c.AuditSinkTarget); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			issues = append(issues, Issue{Key: "AUDIT_SINK_TARGET", Fatal: true,
+				Message: "must be an http(s) URL when AUDIT_SINK=http, e.g. https://siem.example.com/ingest"})
+		} else if u.Scheme == "http" && c.AuditSinkToken != "" {
+			issues = append(issues, Issue{Key: "AUDIT_SINK_TARGET",
+				Message: "AUDIT_SINK_TOKEN is sent over plain http, use https"})
+		}
+	case "syslog":
+		if u, err := url.Parse(c.AuditSinkTarget); err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			issues = append(issues, Issue{Key: "AUDIT_SINK_TARGET", Fatal: true,
+				Message: "must be udp://host:port or tcp://host:port when AUDIT_SINK=syslog, e.g. udp://10.0.0.5:514"})
+		}
+	case "file":
+		if c.AuditSinkTarget == "" {
+			issues = append(issues, Issue{Key: "AUDIT_SINK_TARGET", Fatal: true,
+				Message: "must be a file path when AUDIT_SINK=file, e.g. audit.jsonl"})
+		}
+	default:
+		issues = append(issues, Issue{Key: "AUDIT_SINK", Fatal: true,
+			Message: fmt.Sprintf("%q is not supported, use http, syslog or file", c.AuditSink)})
+	}
+	if c.AuditQueueSize < 1 {
+		issues = append(issues, Issue{Key: "AUDIT_QUEUE_SIZE", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.AuditBatchSize < 1 {
+		issues = append(issues, Issue{Key: "AUDIT_BATCH_SIZE", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.AuditWriteQueueSize < 1 {
+		issues = append(issues, Issue{Key: "AUDIT_WRITE_QUEUE_SIZE", Fatal: true, Message: "must be at least 1"})
+	}
+	if c.AuditWriteWorkers < 1 {
+		issues = append(issues, Issue{Key: "AUDIT_WRITE_WORKERS", Fatal: true, Message: "must be at least 1"})
+	}
+
+	if c.VaultAddr != "" {
+		if u, err := url.Parse(c.VaultAddr); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			issues = append(issues, Issue{Key: "VAULT_ADDR", Fatal: true,
+				Message: "must be an http(s) URL, e.g. https://vault.example.com:8200"})
+		} else if u.Scheme == "http" {
+			issues = append(issues, Issue{Key: "VAULT_ADDR",
+				Message: "Vault tokens and secrets are sent over plain http, use https"})
+		}
+		if c.VaultToken == "" && (c.VaultRoleID == "" || c.VaultSecretID == "") {
+			issues = append(issues, Issue{Key: "VAULT_TOKEN", Fatal: true,
+				Message: "set VAULT_TOKEN, or VAULT_ROLE_ID and VAULT_SECRET_ID for AppRole login, when VAULT_ADDR is set"})
+		}
+		if c.VaultCacheSeconds < 0 {
+			issues = append(issues, Issue{Key: "VAULT_CACHE_SECONDS", Fatal: true, Message: "must be 0 (no caching) or more"})
+		}
+	}
+
+	if c.SMTPHost != "" {
+		if c.SMTPPort < 1 || c.SMTPPort > 65535 {
+			issues = append(issues, Issue{Key: "SMTP_PORT", Fatal: true,
+				Message: fmt.Sprintf("%d is out of range, e.g. 587 for STARTTLS or 465 for TLS", c.SMTPPort)})
+		}
+		switch c.SMTPTLS {
+		case "starttls", "tls":
+		case "none":
+			if c.SMTPPassword != "" {
+				issues = append(issues, Issue{Key: "SMTP_TLS",
+					Message: "SMTP_PASSWORD is sent unencrypted, use starttls or tls"})
+			}
+		default:
+			issues = append(issues, Issue{Key: "SMTP_TLS", Fatal: true,
+				Message: fmt.Sprintf("%q is not supported, use starttls, tls or none", c.SMTPTLS)})
+		}
+		if _, err := mail.ParseAddress(c.SMTPFrom); err != nil {
+			issues = append(issues, Issue{Key: "SMTP_FROM", Fatal: true,
+				Message: "must be an email address when SMTP_HOST is set, e.g. dbbridge@example.com"})
+		}
+		if len(c.NotifyEmailTo) == 0 {
+			issues = append(issues, Issue{Key: "NOTIFY_EMAIL_TO",
+				Message: "SMTP_HOST is set but there are no recipients, notifications are disabled"})
+		}
+	}
+	for _, to := range c.NotifyEmailTo {
+		if _, err := mail.ParseAddress(to); err != nil {
+			issues = append(issues, Issue{Key: "NOTIFY_EMAIL_TO", Fatal: true,
+				Message: fmt.Sprintf("%q is not an email address", to)})
+		}
+	}
+	if c.NotifyThrottle < 0 {
+		issues = append(issues, Issue{Key: "NOTIFY_THROTTLE_MINUTES", Fatal: true, Message: "must not be negative"})
+	}
+
+	if c.MaintenanceRetryAfter < 1 {
+		issues = append(issues, Issue{Key: "MAINTENANCE_RETRY_AFTER", Fatal: true, Message: "must be at least 1 second"})
+	}
+
+	for _, key := range []string{"DEBUG", "DEBUG_ENDPOINTS", "DEMO_MODE", "SERVER_HEADER", "RATE_LIMIT_SESSION_BYPASS", "MAINTENANCE_MODE"} {
+		if v := os.Getenv(key); v != "" && v != "true" && v != "false" {
+			issues = append(issues, Issue{Key: key,
+				Message: fmt.Sprintf("%q is not a boolean, use true or false", v)})
+		}
+	}
+
+	issues = append(issues, unknownPrefixedVars()...)
+
+	return issues
+}
+
+// ParseCIDR accepts either a CIDR ("10.0.0.0/8") or a single IP ("10.1.2.3")
+func ParseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	return ipNet, err
+}
+
+// ParseCIDRList parses a list of CIDRs/IPs, returning the first invalid entry as error
+func ParseCIDRList(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		ipNet, err := ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a CIDR or IP address", s)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// HasFatal reports whether any of the issues should prevent startup
+func HasFatal(issues []Issue) bool {
+	for _, i := range issues {
+		if i.Fatal {
+			return true
+		}
+	}
+	return false
+}
+
+func unknownPrefixedVars() []Issue {
+	var issues []Issue
+	var known []string
+	for k := range knownPrefixedVars {
+		known = append(known, k)
+	}
+	sort.Strings(known)
+
+	for _, env := range os.Environ() {
+		name := strings.SplitN(env, "=", 2)[0]
+		if strings.HasPrefix(strings.ToUpper(name), "DBBRIDGE_") && !knownPrefixedVars[name] {
+			issues = append(issues, Issue{Key: name,
+				Message: fmt.Sprintf("unknown variable, ignored (known: %s)", strings.Join(known, ", "))})
+		}
+	}
+	sort.Slice(issues, func(a, b int) bool { return issues[a].Key < issues[b].Key })
+	return issues
+}
+
+// estimateEntropyBits approximates the key strength from its character distribution
+func estimateEntropyBits(s string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	perChar := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(total)
+		perChar -= p * math.Log2(p)
+	}
+	return perChar * float64(total)
+}
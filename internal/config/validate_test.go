@@ -0,0 +1,40 @@
+package config_test
+
+import (
+	"dbbridge/internal/config"
+	"dbbridge/internal/testutil"
+	"strings"
+	"testing"
+)
+
+func TestValidateSupportedDrivers(t *testing.T) {
+	cases := []struct {
+		drivers []string
+		fatal   bool
+		want    string
+	}{
+		{[]string{"sqlite", "SQL Server", "postgresql"}, false, ""},
+		{[]string{"sqlite", "mongodb"}, true, `"mongodb" is not a driver`},
+		{[]string{"sqlite", ""}, true, "entry 2 is empty"},
+		{[]string{"sqlite", "sqlite3"}, false, "listed more than once"},
+	}
+	for _, c := range cases {
+		cfg := testutil.Config()
+		cfg.SupportedDrivers = c.drivers
+		var got []config.Issue
+		for _, issue := range cfg.Validate() {
+			if issue.Key == "SUPPORTED_DRIVERS" {
+				got = append(got, issue)
+			}
+		}
+		if c.want == "" {
+			if len(got) != 0 {
+				t.Errorf("%q: %v, want no issue", c.drivers, got)
+			}
+			continue
+		}
+		if len(got) != 1 || got[0].Fatal != c.fatal || !strings.Contains(got[0].Message, c.want) {
+			t.Errorf("%q: %v, want one issue with %q, fatal %v", c.drivers, got, c.want, c.fatal)
+		}
+	}
+}
@@ -4,4 +4,16 @@ type ContextKey string
 
 const (
 	ContextKeyApiKeyID ContextKey = "apiKeyID"
+	// ContextKeyApiKeyPrefix holds the calling API key's prefix, for session tags
+	ContextKeyApiKeyPrefix ContextKey = "apiKeyPrefix"
+	ContextKeyClientIP     ContextKey = "clientIP"
+	// ContextKeyApiKeyAttributes holds the calling API key's []KeyAttribute
+	ContextKeyApiKeyAttributes ContextKey = "apiKeyAttributes"
+	// ContextKeyApiKeyScopes holds the calling API key's []KeyScope
+	ContextKeyApiKeyScopes ContextKey = "apiKeyScopes"
+	// ContextKeyApiKeyEnvelope holds the calling API key's default envelope
+	ContextKeyApiKeyEnvelope ContextKey = "apiKeyEnvelope"
+	// ContextKeyUserID is the authenticated principal: the signed-in admin,
+	// or the user who owns the API key
+	ContextKeyUserID ContextKey = "userID"
 )
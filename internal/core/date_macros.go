@@ -0,0 +1,100 @@
+package core
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// DateMacro is a date expression the server evaluates when a query runs, used
+// as a parameter default ({since:today-7d}) or as a placeholder of its own
+// (WHERE created >= {start_of_month}). It is one of now, today, start_of_week
+// (Monday), start_of_month or start_of_year, optionally shifted by whole hours
+// (h), days (d), weeks (w), months (m) or years (y), as in today-7d or
+// start_of_month+1m. It binds as a time.Time, never as text.
+type DateMacro string
+
+var reDateMacro = regexp.MustCompile(`^(now|today|start_of_week|start_of_month|start_of_year)(?:\s*([+-])\s*(\d+)\s*([hdwmy]))?$`)
+
+// ParseDateMacro returns s as a DateMacro when it is one
+func ParseDateMacro(s string) (DateMacro, bool) {
+	if !reDateMacro.MatchString(s) {
+		return "", false
+	}
+	return DateMacro(s), true
+}
+
+// Eval returns the value of m at now, in now's location. Days, weeks, months
+// and years move the calendar date and keep the wall clock, so today-1d is
+// midnight the day before even across a DST change, while hours are elapsed
+// time. A month or year shift that lands past the end of a month is clamped
+// to its last day: on March 31, today-1m is the last day of February.
+func (m DateMacro) Eval(now time.Time) time.Time {
+	sm := reDateMacro.FindStringSubmatch(string(m))
+	if sm == nil {
+		return now
+	}
+	n, _ := strconv.Atoi(sm[3])
+	if sm[2] == "-" {
+		n = -n
+	}
+	if sm[1] == "now" {
+		return shift(now, n, sm[4])
+	}
+
+	// The other macros are the start of a day, worked out on the calendar
+	// date so that a midnight skipped by DST doesn't move it to the day before
+	y, mo, d := now.Date()
+	date := time.Date(y, mo, d, 0, 0, 0, 0, time.UTC)
+	switch sm[1] {
+	case "start_of_week":
+		date = date.AddDate(0, 0, -(int(now.Weekday())+6)%7) // back to Monday
+	case "start_of_month":
+		date = date.AddDate(0, 0, 1-d)
+	case "start_of_year":
+		date = time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if sm[4] == "h" {
+		return startOfDay(date, now.Location()).Add(time.Duration(n) * time.Hour)
+	}
+	return startOfDay(shift(date, n, sm[4]), now.Location())
+}
+
+// shift moves t by n of unit, one of the DateMacro offset units; n = 0 leaves
+// it as is
+func shift(t time.Time, n int, unit string) time.Time {
+	switch unit {
+	case "h":
+		return t.Add(time.Duration(n) * time.Hour)
+	case "d":
+		return t.AddDate(0, 0, n)
+	case "w":
+		return t.AddDate(0, 0, 7*n)
+	case "m":
+		return addMonths(t, n)
+	case "y":
+		return addMonths(t, 12*n)
+	}
+	return t
+}
+
+// addMonths shifts t by n calendar months, clamping the day to the length of
+// the target month where time.AddDate would roll over into the next one
+func addMonths(t time.Time, n int) time.Time {
+	y, mo, d := t.Date()
+	first := time.Date(y, mo+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	d = min(d, first.AddDate(0, 1, -1).Day())
+	return time.Date(first.Year(), first.Month(), d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// startOfDay returns the first instant in loc of the calendar date of date.
+// Where DST skips midnight, as in Santiago, that is the end of the skipped
+// hour rather than the time.Date normalization into the day before.
+func startOfDay(date time.Time, loc *time.Location) time.Time {
+	y, mo, d := date.Date()
+	t := time.Date(y, mo, d, 0, 0, 0, 0, loc)
+	if t.Day() != d {
+		_, t = t.ZoneBounds()
+	}
+	return t
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDateMacroEval(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+	at := func(loc *time.Location, y int, mo time.Month, d, h int) time.Time {
+		return time.Date(y, mo, d, h, 0, 0, 0, loc)
+	}
+	utc := time.UTC
+	tests := []struct {
+		name  string
+		macro string
+		now   time.Time
+		want  time.Time
+	}{
+		{"now", "now", at(utc, 2024, 5, 15, 13), at(utc, 2024, 5, 15, 13)},
+		{"today", "today", at(utc, 2024, 5, 15, 13), at(utc, 2024, 5, 15, 0)},
+		{"days back", "today-7d", at(utc, 2024, 3, 3, 13), at(utc, 2024, 2, 25, 0)},
+		{"spaces around the offset", "today - 7d", at(utc, 2024, 3, 3, 13), at(utc, 2024, 2, 25, 0)},
+		{"weeks", "today+2w", at(utc, 2024, 12, 25, 8), at(utc, 2025, 1, 8, 0)},
+		{"hours", "now-36h", at(utc, 2024, 1, 1, 6), at(utc, 2023, 12, 30, 18)},
+
+		{"start of week on Sunday", "start_of_week", at(utc, 2024, 3, 10, 9), at(utc, 2024, 3, 4, 0)},
+		{"start of week on Monday", "start_of_week", at(utc, 2024, 3, 4, 9), at(utc, 2024, 3, 4, 0)},
+		{"start of week across a year", "start_of_week", at(utc, 2025, 1, 1, 9), at(utc, 2024, 12, 30, 0)},
+		{"start of year back a year", "start_of_year-1y", at(utc, 2024, 7, 4, 9), at(utc, 2023, 1, 1, 0)},
+
+		{"start of month", "start_of_month", at(utc, 2024, 1, 31, 23), at(utc, 2024, 1, 1, 0)},
+		{"previous month across a year", "start_of_month-1m", at(utc, 2024, 1, 15, 9), at(utc, 2023, 12, 1, 0)},
+		{"next month from the 31st", "start_of_month+1m", at(utc, 2024, 1, 31, 9), at(utc, 2024, 2, 1, 0)},
+		{"month back clamps to leap February", "today-1m", at(utc, 2024, 3, 31, 9), at(utc, 2024, 2, 29, 0)},
+		{"month back clamps to February", "today-1m", at(utc, 2023, 3, 31, 9), at(utc, 2023, 2, 28, 0)},
+		{"month forward clamps to 30 days", "today+1m", at(utc, 2024, 5, 31, 9), at(utc, 2024, 6, 30, 0)},
+		{"year from a leap day", "today+1y", at(utc, 2024, 2, 29, 9), at(utc, 2025, 2, 28, 0)},
+
+		// DST starts 2024-03-10 02:00 and ends 2024-11-03 02:00 in New York
+		{"today on the day DST starts", "today", at(ny, 2024, 3, 10, 12), at(ny, 2024, 3, 10, 0)},
+		{"day after DST starts", "today+1d", at(ny, 2024, 3, 10, 12), at(ny, 2024, 3, 11, 0)},
+		{"day back across DST start keeps the wall clock", "now-1d", at(ny, 2024, 3, 10, 12), at(ny, 2024, 3, 9, 12)},
+		{"hours back across DST start are elapsed time", "now-24h", at(ny, 2024, 3, 10, 12), at(ny, 2024, 3, 9, 11)},
+		{"day back across DST end keeps the wall clock", "now-1d", at(ny, 2024, 11, 3, 12), at(ny, 2024, 11, 2, 12)},
+		{"hours back across DST end are elapsed time", "now-24h", at(ny, 2024, 11, 3, 12), at(ny, 2024, 11, 2, 13)},
+		{"week back across DST end", "start_of_week-1w", at(ny, 2024, 11, 5, 12), at(ny, 2024, 10, 28, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, ok := ParseDateMacro(tt.macro)
+			if !ok {
+				t.Fatalf("ParseDateMacro(%q) failed", tt.macro)
+			}
+			if got := m.Eval(tt.now); !got.Equal(tt.want) || got.Location() != tt.want.Location() {
+				t.Errorf("%s at %s = %s, want %s", tt.macro, tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDateMacroMidnightInDSTGap(t *testing.T) {
+	// Santiago moved its clocks from 00:00 to 01:00 on 2024-09-08
+	scl, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+	got := DateMacro("today").Eval(time.Date(2024, 9, 8, 12, 0, 0, 0, scl))
+	if want := time.Date(2024, 9, 8, 1, 0, 0, 0, scl); !got.Equal(want) {
+		t.Errorf("today = %s, want %s", got, want)
+	}
+}
+
+func TestParseDateMacroRejects(t *testing.T) {
+	for _, s := range []string{"", "yesterday", "today-7", "today-7x", "today7d", "today-d", "now+-1h", "Today"} {
+		if _, ok := ParseDateMacro(s); ok {
+			t.Errorf("ParseDateMacro(%q) accepted", s)
+		}
+	}
+}
+
+func TestDateMacroParameters(t *testing.T) {
+	now := time.Date(2024, 3, 31, 15, 30, 0, 0, time.UTC)
+	parser := NewSQLParser()
+	parser.now = func() time.Time { return now }
+
+	sql := "SELECT * FROM t WHERE created >= {start_of_month} AND created < { today+1d } AND updated >= {since:today-1m}"
+	values := map[string]interface{}{"start_of_month": "1970-01-01"}
+	res := parser.Parse(sql, values)
+	if want := "SELECT * FROM t WHERE created >= ? AND created < ? AND updated >= ?"; res.SQL != want {
+		t.Fatalf("SQL = %q, want %q", res.SQL, want)
+	}
+	args, err := parser.MapValues(res.ParamNames, values, res.Defaults, res.RawDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Time{
+		time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+	}
+	for i, w := range want {
+		got, ok := args[i].(time.Time)
+		if !ok || !got.Equal(w) {
+			t.Errorf("arg %d = %#v, want time %s", i, args[i], w)
+		}
+	}
+
+	// A value sent for a macro default overrides it; a macro placeholder can't be
+	values["since"] = "2024-01-01"
+	args, err = parser.MapValues(res.ParamNames, values, res.Defaults, res.RawDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args[2] != "2024-01-01" {
+		t.Errorf("since = %#v, want the value sent", args[2])
+	}
+	if _, ok := args[0].(time.Time); !ok {
+		t.Errorf("start_of_month = %#v, want the macro's time", args[0])
+	}
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DBErrorClass is the code a database error is translated to for API callers
+type DBErrorClass string
+
+const (
+	ErrClassConstraint DBErrorClass = "constraint_violation"
+	ErrClassPermission DBErrorClass = "permission_denied"
+	ErrClassSyntax     DBErrorClass = "syntax_error"
+	ErrClassTimeout    DBErrorClass = "timeout"
+	ErrClassConnection DBErrorClass = "connection_failed"
+)
+
+// classMessages replace the driver's text for classes whose details (hosts,
+// logins) are not for API callers
+var classMessages = map[DBErrorClass]string{
+	ErrClassTimeout:    "the query took too long and was stopped",
+	ErrClassConnection: "the database could not be reached",
+}
+
+type errorRule struct {
+	class DBErrorClass
+	match *regexp.Regexp
+}
+
+func rule(class DBErrorClass, pattern string) errorRule {
+	return errorRule{class: class, match: regexp.MustCompile(`(?i)` + pattern)}
+}
+
+// sqlStateRules classify ODBC errors, which carry the SQLSTATE in braces
+var sqlStateRules = []errorRule{
+	rule(ErrClassConstraint, `\{23\w{3}\}`),
+	rule(ErrClassPermission, `\{42501\}`),
+	rule(ErrClassConnection, `\{(08\w{3}|28000)\}`),
+	rule(ErrClassTimeout, `\{HYT0[01]\}`),
+	rule(ErrClassSyntax, `\{(42000|37000)\}.*syntax`),
+}
+
+// dialectErrorRules are tried in order for the dialect's name, before
+// commonErrorRules
+var dialectErrorRules = map[string][]errorRule{
+	"postgres": {
+		rule(ErrClassConstraint, `violates (unique|foreign key|not-null|check|exclusion) constraint|SQLSTATE 23\w{3}`),
+		rule(ErrClassPermission, `permission denied|must be owner of|SQLSTATE 42501`),
+		rule(ErrClassSyntax, `syntax error|SQLSTATE 42601`),
+		rule(ErrClassTimeout, `canceling statement due to (statement|lock) timeout|SQLSTATE 57014`),
+		rule(ErrClassConnection, `password authentication failed|database "[^"]*" does not exist|too many connections|the database system is (starting up|shutting down)`),
+	},
+	"mysql": {
+		rule(ErrClassConstraint, `^Error (1062|1451|1452|1048|1216|1217|3819)\b`),
+		rule(ErrClassPermission, `^Error (1142|1143|1044|1227|1370)\b`),
+		rule(ErrClassSyntax, `^Error (1064|1149)\b`),
+		rule(ErrClassTimeout, `^Error (3024|1205|1317)\b`),
+		rule(ErrClassConnection, `^Error (1045|1040|1049|1129)\b|invalid connection|bad connection`),
+	},
+	"mssql": {
+		rule(ErrClassConstraint, `Violation of (PRIMARY KEY|UNIQUE KEY) constraint|Cannot insert duplicate key|conflicted with the (FOREIGN KEY|REFERENCE|CHECK) constraint|Cannot insert the value NULL`),
+		rule(ErrClassPermission, `permission was denied|permission denied`),
+		rule(ErrClassSyntax, `Incorrect syntax near|Unclosed quotation mark`),
+		rule(ErrClassTimeout, `Lock request time out period exceeded|timeout expired`),
+		rule(ErrClassConnection, `Login failed for user|Cannot open database|unable to open tcp connection`),
+	},
+	"oracle": {
+		rule(ErrClassConstraint, `ORA-(00001|01400|01407|02290|02291|02292):`),
+		rule(ErrClassPermission, `ORA-(01031|01749|01720|00990):`),
+		rule(ErrClassSyntax, `ORA-(00900|00904|00905|00906|00907|00917|00923|00933|00936|01756):`),
+		rule(ErrClassTimeout, `ORA-(01013|00054|30006):`),
+		rule(ErrClassConnection, `ORA-(01017|01034|12154|12170|12514|12541|12543|28000):`),
+	},
+	"sqlite": {
+		rule(ErrClassConstraint, `constraint failed`),
+		rule(ErrClassPermission, `attempt to write a readonly database|not authorized`),
+		rule(ErrClassSyntax, `syntax error|incomplete input|unrecognized token`),
+		rule(ErrClassTimeout, `database is locked|database table is locked`),
+		rule(ErrClassConnection, `unable to open database file`),
+	},
+	"snowflake": {
+		rule(ErrClassConstraint, `^\d+ \(23\w{3}\):|NULL result in a non-nullable column|Duplicate row detected`),
+		rule(ErrClassPermission, `^\d+ \(42501\):|Insufficient privileges`),
+		rule(ErrClassSyntax, `^\d+ \(42000\):(?s:.*)syntax error`),
+		rule(ErrClassTimeout, `^\d+ \(57014\):|reached its statement or warehouse timeout`),
+		rule(ErrClassConnection, `^\d+ \((08\w{3}|28000)\):|Incorrect username or password`),
+	},
+	"sqlanywhere": append([]errorRule{
+		rule(ErrClassConstraint, `is not unique|No primary key value for foreign key|cannot be NULL|Primary key for row in table .* is referenced`),
+		rule(ErrClassPermission, `Permission denied|do not have permission`),
+		rule(ErrClassSyntax, `Syntax error near`),
+		rule(ErrClassTimeout, `Statement interrupted by user|User '[^']*' has the row .* locked`),
+		rule(ErrClassConnection, `Database server not found|Invalid user ID or password|Connection was terminated`),
+	}, sqlStateRules...),
+	"odbc": sqlStateRules,
+}
+
+// commonErrorRules catch what network and database/sql report for any driver
+var commonErrorRules = []errorRule{
+	rule(ErrClassTimeout, `context deadline exceeded`),
+	rule(ErrClassConnection, `connection refused|no such host|i/o timeout|connection reset by peer|broken pipe|driver: bad connection|network is unreachable|failed to ping database`),
+}
+
+// vendorNoise matches the parts of a driver message that mean nothing to an
+// API caller: driver prefixes, error numbers, SQLSTATEs and ODBC vendor tags
+var vendorNoise = []*regexp.Regexp{
+	regexp.MustCompile(`^(pq|mssql|sqlite|ERROR|FATAL|SQL logic error|constraint failed|login error): `),
+	regexp.MustCompile(`^SQL\w+: `),
+	regexp.MustCompile(`^\{\w{5}\} `),
+	regexp.MustCompile(`^(\[[^\]]*\])+\s*`),
+	regexp.MustCompile(`^Error \d+( \(\w+\))?: `),
+	regexp.MustCompile(`^ORA-\d+: `),
+	regexp.MustCompile(`^\d+ \(\w{5}\): `),
+	regexp.MustCompile(`^SQL compilation error: `),
+	regexp.MustCompile(` \(SQLSTATE \w{5}\)$`),
+	regexp.MustCompile(` \(\d+\)$`),
+}
+
+// ClassifyDBError translates a driver error for the dialect named dialect. It
+// returns the error's class and a message a caller can read, or ok false when
+// no rule matches.
+func ClassifyDBError(dialect string, err error) (class DBErrorClass, message string, ok bool) {
+	if err == nil {
+		return "", "", false
+	}
+	text := err.Error()
+	for _, rules := range [][]errorRule{dialectErrorRules[dialect], commonErrorRules} {
+		for _, r := range rules {
+			if r.match.MatchString(text) {
+				if msg, fixed := classMessages[r.class]; fixed {
+					return r.class, msg, true
+				}
+				return r.class, CleanDBErrorMessage(text), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// CleanDBErrorMessage strips driver prefixes, error codes and vendor tags from
+// a driver message and keeps only its first diagnostic on one line
+func CleanDBErrorMessage(text string) string {
+	// ODBC reports further diagnostic records on lines of their own
+	if i := strings.Index(text, "\n{"); i >= 0 {
+		text = text[:i]
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	for changed := true; changed; {
+		changed = false
+		for _, re := range vendorNoise {
+			if cleaned := re.ReplaceAllString(text, ""); cleaned != text {
+				text, changed = strings.TrimSpace(cleaned), true
+			}
+		}
+	}
+	return text
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassifyDBError(t *testing.T) {
+	tests := []struct {
+		dialect string
+		err     string
+		class   DBErrorClass
+		message string
+	}{
+		// lib/pq and pgx
+		{"postgres", `pq: duplicate key value violates unique constraint "orders_pkey"`, ErrClassConstraint, `duplicate key value violates unique constraint "orders_pkey"`},
+		{"postgres", `pq: insert or update on table "orders" violates foreign key constraint "orders_customer_id_fkey"`, ErrClassConstraint, `insert or update on table "orders" violates foreign key constraint "orders_customer_id_fkey"`},
+		{"postgres", `ERROR: null value in column "name" of relation "customers" violates not-null constraint (SQLSTATE 23502)`, ErrClassConstraint, `null value in column "name" of relation "customers" violates not-null constraint`},
+		{"postgres", `pq: permission denied for table orders`, ErrClassPermission, `permission denied for table orders`},
+		{"postgres", `pq: syntax error at or near "FORM"`, ErrClassSyntax, `syntax error at or near "FORM"`},
+		{"postgres", `pq: canceling statement due to statement timeout`, ErrClassTimeout, classMessages[ErrClassTimeout]},
+		{"postgres", `failed to ping database: pq: password authentication failed for user "app"`, ErrClassConnection, classMessages[ErrClassConnection]},
+		{"postgres", `failed to ping database: dial tcp 10.0.0.5:5432: connect: connection refused`, ErrClassConnection, classMessages[ErrClassConnection]},
+
+		// go-sql-driver/mysql
+		{"mysql", `Error 1062 (23000): Duplicate entry '7' for key 'orders.PRIMARY'`, ErrClassConstraint, `Duplicate entry '7' for key 'orders.PRIMARY'`},
+		{"mysql", `Error 1452: Cannot add or update a child row: a foreign key constraint fails`, ErrClassConstraint, `Cannot add or update a child row: a foreign key constraint fails`},
+		{"mysql", `Error 1142 (42000): SELECT command denied to user 'app'@'10.0.0.9' for table 'orders'`, ErrClassPermission, `SELECT command denied to user 'app'@'10.0.0.9' for table 'orders'`},
+		{"mysql", `Error 1064 (42000): You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use near 'FORM orders' at line 1`, ErrClassSyntax, `You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use near 'FORM orders' at line 1`},
+		{"mysql", `Error 3024 (HY000): Query execution was interrupted, maximum statement execution time exceeded`, ErrClassTimeout, classMessages[ErrClassTimeout]},
+		{"mysql", `Error 1045 (28000): Access denied for user 'app'@'10.0.0.9' (using password: YES)`, ErrClassConnection, classMessages[ErrClassConnection]},
+
+		// go-mssqldb
+		{"mssql", `mssql: Violation of PRIMARY KEY constraint 'PK_orders'. Cannot insert duplicate key in object 'dbo.orders'. The duplicate key value is (1).`, ErrClassConstraint, `Violation of PRIMARY KEY constraint 'PK_orders'. Cannot insert duplicate key in object 'dbo.orders'. The duplicate key value is (1).`},
+		{"mssql", `mssql: The INSERT statement conflicted with the FOREIGN KEY constraint "FK_orders_customers".`, ErrClassConstraint, `The INSERT statement conflicted with the FOREIGN KEY constraint "FK_orders_customers".`},
+		{"mssql", `mssql: The SELECT permission was denied on the object 'orders', database 'shop', schema 'dbo'.`, ErrClassPermission, `The SELECT permission was denied on the object 'orders', database 'shop', schema 'dbo'.`},
+		{"mssql", `mssql: Incorrect syntax near 'FORM'.`, ErrClassSyntax, `Incorrect syntax near 'FORM'.`},
+		{"mssql", `mssql: login error: Login failed for user 'app'.`, ErrClassConnection, classMessages[ErrClassConnection]},
+
+		// go-ora
+		{"oracle", `ORA-00001: unique constraint (SHOP.ORDERS_PK) violated`, ErrClassConstraint, `unique constraint (SHOP.ORDERS_PK) violated`},
+		{"oracle", `ORA-01031: insufficient privileges`, ErrClassPermission, `insufficient privileges`},
+		{"oracle", `ORA-00933: SQL command not properly ended`, ErrClassSyntax, `SQL command not properly ended`},
+		{"oracle", `ORA-01013: user requested cancel of current operation`, ErrClassTimeout, classMessages[ErrClassTimeout]},
+		{"oracle", `ORA-12541: TNS:no listener`, ErrClassConnection, classMessages[ErrClassConnection]},
+
+		// modernc.org/sqlite
+		{"sqlite", `constraint failed: UNIQUE constraint failed: orders.id (2067)`, ErrClassConstraint, `UNIQUE constraint failed: orders.id`},
+		{"sqlite", `attempt to write a readonly database (8)`, ErrClassPermission, `attempt to write a readonly database`},
+		{"sqlite", `SQL logic error: near "FORM": syntax error (1)`, ErrClassSyntax, `near "FORM": syntax error`},
+		{"sqlite", `database is locked (5) (SQLITE_BUSY)`, ErrClassTimeout, classMessages[ErrClassTimeout]},
+
+		// gosnowflake
+		{"snowflake", "001003 (42000): SQL compilation error:\nsyntax error line 1 at position 9 unexpected 'FORM'.", ErrClassSyntax, `syntax error line 1 at position 9 unexpected 'FORM'.`},
+		{"snowflake", `000630 (57014): Statement reached its statement or warehouse timeout of 10 second(s) and was canceled.`, ErrClassTimeout, classMessages[ErrClassTimeout]},
+		{"snowflake", `390100 (08004): Incorrect username or password was specified.`, ErrClassConnection, classMessages[ErrClassConnection]},
+
+		// SQL Anywhere and other engines over ODBC
+		{"sqlanywhere", "SQLExecute: {23000} [Sybase][ODBC Driver][Adaptive Server Anywhere]Primary key for table 'orders' is not unique : Primary key value ('1')\n{01000} [Sybase][ODBC Driver]General warning", ErrClassConstraint, `Primary key for table 'orders' is not unique : Primary key value ('1')`},
+		{"sqlanywhere", `SQLExecute: {42000} [SAP][ODBC Driver][SQL Anywhere]Permission denied: you do not have permission to select from "orders"`, ErrClassPermission, `Permission denied: you do not have permission to select from "orders"`},
+		{"sqlanywhere", `SQLPrepare: {42000} [Sybase][ODBC Driver][SQL Anywhere]Syntax error near 'FORM' on line 1`, ErrClassSyntax, `Syntax error near 'FORM' on line 1`},
+		{"sqlanywhere", `SQLDriverConnect: {08001} [Sybase][ODBC Driver][SQL Anywhere]Database server not found`, ErrClassConnection, classMessages[ErrClassConnection]},
+		{"odbc", `SQLExecute: {23000} [IBM][CLI Driver][DB2/LINUXX8664] SQL0803N One or more values in the INSERT statement are not valid`, ErrClassConstraint, `SQL0803N One or more values in the INSERT statement are not valid`},
+		{"odbc", `SQLExecute: {HYT00} [Microsoft][ODBC Driver 18 for SQL Server]Query timeout expired`, ErrClassTimeout, classMessages[ErrClassTimeout]},
+
+		// Any driver
+		{"mysql", `context deadline exceeded`, ErrClassTimeout, classMessages[ErrClassTimeout]},
+		{"odbc", `driver: bad connection`, ErrClassConnection, classMessages[ErrClassConnection]},
+	}
+	for _, tt := range tests {
+		class, message, ok := ClassifyDBError(tt.dialect, errors.New(tt.err))
+		if !ok || class != tt.class || message != tt.message {
+			t.Errorf("ClassifyDBError(%s, %q) = %s, %q, %v; want %s, %q", tt.dialect, tt.err, class, message, ok, tt.class, tt.message)
+		}
+	}
+}
+
+func TestClassifyDBErrorUnknown(t *testing.T) {
+	for _, tt := range []struct{ dialect, err string }{
+		{"postgres", `pq: relation "orderz" does not exist`},
+		{"oracle", `ORA-00942: table or view does not exist`},
+		// Another dialect's rules do not apply
+		{"postgres", `ORA-00001: unique constraint (SHOP.ORDERS_PK) violated`},
+	} {
+		if class, _, ok := ClassifyDBError(tt.dialect, errors.New(tt.err)); ok {
+			t.Errorf("ClassifyDBError(%s, %q) = %s, want no class", tt.dialect, tt.err, class)
+		}
+	}
+}
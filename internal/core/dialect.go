@@ -0,0 +1,213 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect captures how a database engine differs in the SQL DbBridge generates
+// around saved queries. Saved queries are written with ? placeholders and a
+// dialect turns them into what the driver expects.
+type Dialect interface {
+	// Name identifies the dialect, e.g. "postgres" or "sqlanywhere"
+	Name() string
+	// PaginationClause is what {pagination} is replaced with
+	PaginationClause(limit, offset int) string
+	// RewritePlaceholders converts ? placeholders to the driver's style.
+	// Question marks inside literals, quoted identifiers and comments are left alone.
+	RewritePlaceholders(sqlText string) string
+	// ExplainWrapper returns the statement showing the plan of sqlText, "" when unsupported
+	ExplainWrapper(sqlText string) string
+	// ReadOnlySetup returns the statements that make a session read-only, nil when
+	// the engine has none (use a read-only login or connection option instead)
+	ReadOnlySetup() []string
+	// CatalogQueries returns the queries listing tables and columns
+	CatalogQueries() CatalogQueries
+	// QuoteIdentifier quotes a table or column name
+	QuoteIdentifier(name string) string
+}
+
+// CatalogQueries list the schema of a connection. Tables returns
+// (table_schema, table_name) rows; Columns takes the table name as its only ?
+// parameter and returns (column_name, data_type) rows in column order.
+// An empty query means the dialect does not support it.
+type CatalogQueries struct {
+	Tables  string
+	Columns string
+}
+
+// PingQuerier is implemented by dialects that check a new connection with a
+// query rather than the driver's Ping
+type PingQuerier interface {
+	PingQuery() string
+}
+
+// PaginationPlacer is implemented by dialects whose pagination clause has a
+// fixed place in a statement, wherever its {pagination} tag sits.
+// PlacePagination returns sqlText without the tag at sqlText[start:end] and
+// with clause at its place, or an error when the statement has none.
+type PaginationPlacer interface {
+	PlacePagination(sqlText string, start, end int, clause string) (string, error)
+}
+
+// SessionTagger is implemented by dialects that can label database sessions
+// with the application using them, so DBAs can attribute load. SessionTag
+// returns dsn carrying tag, or the statements that set it on each new
+// session; tag is already cleaned by SanitizeSessionTag. A connection string
+// that sets the option itself keeps its own value.
+type SessionTagger interface {
+	SessionTag(dsn, tag string) (taggedDSN string, setup []string)
+}
+
+// driverNames maps the display names used in SUPPORTED_DRIVERS and older
+// forms to the name the driver registers with database/sql, see DriverPresets
+var driverNames = map[string]string{
+	"sql server":      "sqlserver",
+	"mssql server":    "sqlserver",
+	"postgresql":      "postgres",
+	"sqlite3":         "sqlite",
+	"sql anywhere":    "odbc",
+	"sql anywhere 10": "odbc",
+}
+
+// DriverName returns the registered driver name for a driver or display name
+func DriverName(name string) string {
+	name = strings.TrimSpace(name)
+	if mapped, ok := driverNames[strings.ToLower(name)]; ok {
+		return mapped
+	}
+	return strings.ToLower(name)
+}
+
+// DialectFor resolves a connection's dialect. spec is the connection's dialect
+// field; when it is empty the dialect is detected from the driver and, for
+// ODBC, the connection string (which may be "" when it is not at hand).
+func DialectFor(spec, driver, connStr string) (Dialect, error) {
+	if strings.TrimSpace(spec) != "" {
+		return ParseDialect(spec, driver)
+	}
+
+	// Native drivers speak the dialect of their preset
+	if p, ok := nativePreset(driver); ok {
+		return ParseDialect(p.Dialect, p.Driver)
+	}
+	lowerConn := strings.ToLower(connStr)
+	switch strings.ToLower(driver) {
+	case "pgx":
+		return PostgresDialect{}, nil
+	case "mssql", "odbc":
+		// SQL Anywhere drivers usually contain "SQL Anywhere" or "ASA"
+		if strings.Contains(lowerConn, "sql anywhere") || strings.Contains(lowerConn, "asa") {
+			return sqlAnywhereDialect(), nil
+		}
+		if strings.Contains(lowerConn, "oracle") {
+			return OracleDialect{}, nil
+		}
+		if strings.EqualFold(driver, "mssql") || strings.Contains(lowerConn, "sql server") {
+			return MSSQLDialect{}, nil
+		}
+	}
+	return &GenericDialect{}, nil
+}
+
+// ParseDialect parses an explicit dialect field: one of sqlite, postgres,
+// mysql, mssql, oracle, snowflake, sqlanywhere or odbc, where odbc takes options, e.g.
+// "odbc:pagination=offset_fetch,quote=brackets" (see GenericDialect).
+func ParseDialect(spec, driver string) (Dialect, error) {
+	name, options, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if options != "" && name != "odbc" {
+		return nil, fmt.Errorf("dialect %q does not take options", name)
+	}
+
+	switch name {
+	case "sqlite":
+		return SQLiteDialect{}, nil
+	case "postgres":
+		return PostgresDialect{}, nil
+	case "mysql":
+		return MySQLDialect{}, nil
+	case "mssql":
+		return MSSQLDialect{NamedParams: strings.EqualFold(driver, "sqlserver")}, nil
+	case "oracle":
+		return OracleDialect{PositionalBinds: strings.EqualFold(driver, "oracle")}, nil
+	case "snowflake":
+		return SnowflakeDialect{}, nil
+	case "sqlanywhere":
+		return sqlAnywhereDialect(), nil
+	case "odbc":
+		return parseGenericDialect(options)
+	}
+	return nil, fmt.Errorf("unknown dialect %q (use sqlite, postgres, mysql, mssql, oracle, snowflake, sqlanywhere or odbc)", name)
+}
+
+// rewriteQuestionMarks replaces each ? outside literals, quoted identifiers and
+// comments with placeholder(n), n counting from 1. quotes lists the characters
+// that open a quoted section in the dialect ('[' closes with ']').
+func rewriteQuestionMarks(sqlText, quotes string, placeholder func(n int) string) string {
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(sqlText); i++ {
+		c := sqlText[i]
+		switch {
+		case strings.IndexByte(quotes, c) >= 0:
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end := i + 1
+			for end < len(sqlText) {
+				if sqlText[end] == closing {
+					// A doubled quote is an escaped quote, not the end
+					if end+1 < len(sqlText) && sqlText[end+1] == closing {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			if end >= len(sqlText) {
+				end = len(sqlText) - 1
+			}
+			b.WriteString(sqlText[i : end+1])
+			i = end
+		case c == '-' && i+1 < len(sqlText) && sqlText[i+1] == '-':
+			end := strings.IndexByte(sqlText[i:], '\n')
+			if end < 0 {
+				end = len(sqlText) - i
+			}
+			b.WriteString(sqlText[i : i+end])
+			i += end - 1
+		case c == '/' && i+1 < len(sqlText) && sqlText[i+1] == '*':
+			end := strings.Index(sqlText[i+2:], "*/")
+			if end < 0 {
+				end = len(sqlText) - i - 2
+			} else {
+				end += 2
+			}
+			b.WriteString(sqlText[i : i+2+end])
+			i += 2 + end - 1
+		case c == '?':
+			n++
+			b.WriteString(placeholder(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// quoteWith wraps name in open/close, doubling any close character inside it
+func quoteWith(name, open, close string) string {
+	return open + strings.ReplaceAll(name, close, close+close) + close
+}
+
+// informationSchemaCatalog is the standard catalog most engines support
+var informationSchemaCatalog = CatalogQueries{
+	Tables: `SELECT table_schema, table_name FROM information_schema.tables
+WHERE table_schema NOT IN ('information_schema', 'pg_catalog', 'sys', 'INFORMATION_SCHEMA')
+ORDER BY table_schema, table_name`,
+	Columns: `SELECT column_name, data_type FROM information_schema.columns
+WHERE table_name = ? ORDER BY ordinal_position`,
+}
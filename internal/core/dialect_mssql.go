@@ -0,0 +1,63 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MSSQLDialect is Microsoft SQL Server. The go-mssqldb "sqlserver" driver
+// needs @p1-style parameters (NamedParams); its "mssql" name and ODBC take ?.
+type MSSQLDialect struct {
+	NamedParams bool
+}
+
+func (MSSQLDialect) Name() string { return "mssql" }
+
+// PaginationClause uses OFFSET/FETCH (SQL Server 2012+), which must follow an ORDER BY
+func (MSSQLDialect) PaginationClause(limit, offset int) string {
+	return fmt.Sprintf("OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", offset, limit)
+}
+
+func (d MSSQLDialect) RewritePlaceholders(sqlText string) string {
+	if !d.NamedParams {
+		return sqlText
+	}
+	return rewriteQuestionMarks(sqlText, `'"[`, func(n int) string {
+		return "@p" + strconv.Itoa(n)
+	})
+}
+
+// ExplainWrapper is unsupported: SHOWPLAN must be switched on in its own batch
+func (MSSQLDialect) ExplainWrapper(sqlText string) string { return "" }
+
+// ReadOnlySetup has no session statement; use ApplicationIntent=ReadOnly or a
+// read-only login
+func (MSSQLDialect) ReadOnlySetup() []string { return nil }
+
+// SessionTag sets the application name shown in sys.dm_exec_sessions:
+// "app name" for go-mssqldb connection strings, APP for ODBC drivers
+func (MSSQLDialect) SessionTag(dsn, tag string) (string, []string) {
+	lower := strings.ToLower(dsn)
+	if strings.Contains(lower, "driver=") && !strings.HasPrefix(lower, "odbc:") {
+		return withDSNOption(dsn, "APP", tag, ";"), nil
+	}
+	return withDSNOption(dsn, "app name", tag, ";"), nil
+}
+
+func (MSSQLDialect) CatalogQueries() CatalogQueries {
+	return CatalogQueries{
+		Tables: `SELECT TABLE_SCHEMA AS table_schema, TABLE_NAME AS table_name FROM INFORMATION_SCHEMA.TABLES
+ORDER BY TABLE_SCHEMA, TABLE_NAME`,
+		Columns: `SELECT COLUMN_NAME AS column_name, DATA_TYPE AS data_type FROM INFORMATION_SCHEMA.COLUMNS
+WHERE TABLE_NAME = ? ORDER BY ORDINAL_POSITION`,
+	}
+}
+
+func (MSSQLDialect) QuoteIdentifier(name string) string {
+	return quoteWith(name, "[", "]")
+}
+
+// EscapeLike puts the LIKE wildcards in brackets, as SQL Server has no
+// default escape character
+func (MSSQLDialect) EscapeLike(s string) string { return bracketLikeEscaper.Replace(s) }
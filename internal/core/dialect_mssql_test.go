@@ -0,0 +1,35 @@
+package core
+
+import "testing"
+
+func TestMSSQLDialect(t *testing.T) {
+	d := MSSQLDialect{}
+
+	if got := d.PaginationClause(20, 40); got != "OFFSET 40 ROWS FETCH NEXT 20 ROWS ONLY" {
+		t.Errorf("PaginationClause = %q", got)
+	}
+	if got := d.RewritePlaceholders("a = ?"); got != "a = ?" {
+		t.Errorf("RewritePlaceholders without NamedParams = %q, want unchanged", got)
+	}
+	if got := d.ExplainWrapper("SELECT 1"); got != "" {
+		t.Errorf("ExplainWrapper = %q, want unsupported", got)
+	}
+	if got := d.ReadOnlySetup(); got != nil {
+		t.Errorf("ReadOnlySetup = %v, want nil", got)
+	}
+	if got := d.QuoteIdentifier("a]b"); got != "[a]]b]" {
+		t.Errorf("QuoteIdentifier = %q", got)
+	}
+}
+
+func TestMSSQLDialectNamedParams(t *testing.T) {
+	d, err := ParseDialect("mssql", "sqlserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "SELECT [why?] FROM t WHERE a = ? AND b = '?' AND c = ?"
+	want := "SELECT [why?] FROM t WHERE a = @p1 AND b = '?' AND c = @p2"
+	if got := d.RewritePlaceholders(in); got != want {
+		t.Errorf("RewritePlaceholders = %q, want %q", got, want)
+	}
+}
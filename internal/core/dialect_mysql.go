@@ -0,0 +1,56 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MySQLDialect is MySQL and MariaDB through go-sql-driver/mysql
+type MySQLDialect struct{}
+
+func (MySQLDialect) Name() string { return "mysql" }
+
+func (MySQLDialect) PaginationClause(limit, offset int) string {
+	return fmt.Sprintf("LIMIT %d, %d", offset, limit)
+}
+
+// RewritePlaceholders is a no-op: the driver takes ? natively
+func (MySQLDialect) RewritePlaceholders(sqlText string) string { return sqlText }
+
+func (MySQLDialect) ExplainWrapper(sqlText string) string {
+	return "EXPLAIN " + sqlText
+}
+
+func (MySQLDialect) ReadOnlySetup() []string {
+	return []string{"SET SESSION TRANSACTION READ ONLY"}
+}
+
+// SessionTag sets the program_name connection attribute, shown in
+// performance_schema.session_connect_attrs
+func (MySQLDialect) SessionTag(dsn, tag string) (string, []string) {
+	if strings.Contains(dsn, "connectionAttributes=") {
+		return dsn, nil
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "connectionAttributes=program_name:" + tag, nil
+}
+
+// CatalogQueries is limited to the database of the connection
+func (MySQLDialect) CatalogQueries() CatalogQueries {
+	return CatalogQueries{
+		Tables: `SELECT table_schema, table_name FROM information_schema.tables
+WHERE table_schema = DATABASE() ORDER BY table_name`,
+		Columns: `SELECT column_name, data_type FROM information_schema.columns
+WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position`,
+	}
+}
+
+func (MySQLDialect) QuoteIdentifier(name string) string {
+	return quoteWith(name, "`", "`")
+}
+
+// EscapeLike escapes with backslash, the default LIKE escape character
+func (MySQLDialect) EscapeLike(s string) string { return backslashLikeEscaper.Replace(s) }
@@ -0,0 +1,23 @@
+package core
+
+import "testing"
+
+func TestMySQLDialect(t *testing.T) {
+	d := MySQLDialect{}
+
+	if got := d.PaginationClause(20, 40); got != "LIMIT 40, 20" {
+		t.Errorf("PaginationClause = %q", got)
+	}
+	if got := d.RewritePlaceholders("a = ?"); got != "a = ?" {
+		t.Errorf("RewritePlaceholders = %q, want unchanged", got)
+	}
+	if got := d.ExplainWrapper("SELECT 1"); got != "EXPLAIN SELECT 1" {
+		t.Errorf("ExplainWrapper = %q", got)
+	}
+	if got := d.ReadOnlySetup(); len(got) != 1 || got[0] != "SET SESSION TRANSACTION READ ONLY" {
+		t.Errorf("ReadOnlySetup = %v", got)
+	}
+	if got := d.QuoteIdentifier("we`ird"); got != "`we``ird`" {
+		t.Errorf("QuoteIdentifier = %q", got)
+	}
+}
@@ -0,0 +1,199 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GenericDialect covers ODBC data sources without a dedicated dialect. The
+// zero value speaks standard SQL with LIMIT/OFFSET and ? placeholders; options
+// from the connection's dialect field ("odbc:key=value,...") adjust it:
+//
+//	pagination   limit_offset (default), offset_fetch, top_start_at, none
+//	placeholder  question (default), dollar ($1), at (@p1), colon (:1)
+//	quote        double (default), brackets, backtick
+//	explain      statement prefix showing a plan, e.g. "EXPLAIN"; unset = unsupported
+//	catalog      information_schema (default) or none
+type GenericDialect struct {
+	name        string
+	Pagination  string
+	Placeholder string
+	Quote       string
+	Explain     string
+	NoCatalog   bool
+}
+
+// sqlAnywhereDialect is SAP/Sybase SQL Anywhere: TOP n START AT m goes right
+// after SELECT, where PlacePagination moves it wherever {pagination} sits
+func sqlAnywhereDialect() *GenericDialect {
+	return &GenericDialect{name: "sqlanywhere", Pagination: "top_start_at"}
+}
+
+func parseGenericDialect(options string) (*GenericDialect, error) {
+	d := &GenericDialect{}
+	for _, opt := range strings.Split(options, ",") {
+		if strings.TrimSpace(opt) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(opt, "=")
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if !ok {
+			return nil, fmt.Errorf("odbc dialect option %q must be key=value", opt)
+		}
+
+		var allowed []string
+		switch key {
+		case "pagination":
+			d.Pagination, allowed = value, []string{"limit_offset", "offset_fetch", "top_start_at", "none"}
+		case "placeholder":
+			d.Placeholder, allowed = value, []string{"question", "dollar", "at", "colon"}
+		case "quote":
+			d.Quote, allowed = value, []string{"double", "brackets", "backtick"}
+		case "explain":
+			d.Explain = value
+		case "catalog":
+			d.NoCatalog, allowed = value == "none", []string{"information_schema", "none"}
+		default:
+			return nil, fmt.Errorf("unknown odbc dialect option %q", key)
+		}
+		if allowed != nil && !containsString(allowed, value) {
+			return nil, fmt.Errorf("odbc dialect option %s must be one of %s", key, strings.Join(allowed, ", "))
+		}
+	}
+	return d, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *GenericDialect) Name() string {
+	if d.name != "" {
+		return d.name
+	}
+	return "odbc"
+}
+
+func (d *GenericDialect) PaginationClause(limit, offset int) string {
+	switch d.Pagination {
+	case "offset_fetch":
+		return fmt.Sprintf("OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", offset, limit)
+	case "top_start_at":
+		return fmt.Sprintf("TOP %d START AT %d", limit, offset+1)
+	case "none":
+		return ""
+	}
+	return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+}
+
+func (d *GenericDialect) RewritePlaceholders(sqlText string) string {
+	var placeholder func(n int) string
+	switch d.Placeholder {
+	case "dollar":
+		placeholder = func(n int) string { return "$" + strconv.Itoa(n) }
+	case "at":
+		placeholder = func(n int) string { return "@p" + strconv.Itoa(n) }
+	case "colon":
+		placeholder = func(n int) string { return ":" + strconv.Itoa(n) }
+	default:
+		return sqlText
+	}
+
+	quotes := `'"`
+	switch d.Quote {
+	case "brackets":
+		quotes += "["
+	case "backtick":
+		quotes += "`"
+	}
+	return rewriteQuestionMarks(sqlText, quotes, placeholder)
+}
+
+func (d *GenericDialect) ExplainWrapper(sqlText string) string {
+	if d.Explain == "" {
+		return ""
+	}
+	return d.Explain + " " + sqlText
+}
+
+// ReadOnlySetup has no portable statement; use a read-only DSN or login
+func (d *GenericDialect) ReadOnlySetup() []string { return nil }
+
+func (d *GenericDialect) CatalogQueries() CatalogQueries {
+	if d.NoCatalog {
+		return CatalogQueries{}
+	}
+	return informationSchemaCatalog
+}
+
+func (d *GenericDialect) QuoteIdentifier(name string) string {
+	switch d.Quote {
+	case "brackets":
+		return quoteWith(name, "[", "]")
+	case "backtick":
+		return quoteWith(name, "`", "`")
+	}
+	return quoteWith(name, `"`, `"`)
+}
+
+// reSetOperator finds the set operators that make a statement several SELECTs
+var reSetOperator = regexp.MustCompile(`(?i)\b(union|intersect|except|minus)\b`)
+
+// reLeadingWord matches the first keyword of a statement and, when it is
+// SELECT, a DISTINCT following it. Comment markers left by CutComments are
+// skipped.
+var reLeadingWord = regexp.MustCompile(`(?i)^(?:\s|\x00[0-9]+\x00)*([a-z]+)\b(?:(?:\s|\x00[0-9]+\x00)+distinct\b)?`)
+
+// PlacePagination puts TOP n START AT m right after the SELECT, or SELECT
+// DISTINCT, of the statement when the dialect pages that way: SQL Anywhere
+// accepts it nowhere else. Other pagination styles replace the tag where it is.
+func (d *GenericDialect) PlacePagination(sqlText string, start, end int, clause string) (string, error) {
+	if d.Pagination != "top_start_at" {
+		return sqlText[:start] + clause + sqlText[end:], nil
+	}
+
+	// Cut the tag along with a space around it
+	if start > 0 && isSpace(sqlText[start-1]) && (end == len(sqlText) || isSpace(sqlText[end])) {
+		start--
+	}
+	sqlText = sqlText[:start] + sqlText[end:]
+
+	m := reLeadingWord.FindStringSubmatchIndex(sqlText)
+	if m == nil || !strings.EqualFold(sqlText[m[2]:m[3]], "select") {
+		if m != nil && strings.EqualFold(sqlText[m[2]:m[3]], "with") {
+			return "", fmt.Errorf("{pagination} cannot be placed in a query starting with WITH: %s pages with TOP n START AT m after the outermost SELECT; select from a derived table instead", d.Name())
+		}
+		return "", fmt.Errorf("{pagination} needs a query starting with SELECT: %s pages with TOP n START AT m after it", d.Name())
+	}
+
+	// Only a set operator outside parentheses combines the outermost SELECT
+	ctx := sqlContexts(sqlText)
+	depth := make([]int, len(sqlText))
+	level := 0
+	for i := range sqlText {
+		if ctx[i] == inCode && sqlText[i] == '(' {
+			level++
+		} else if ctx[i] == inCode && sqlText[i] == ')' {
+			level--
+		}
+		depth[i] = level
+	}
+	for _, loc := range reSetOperator.FindAllStringIndex(sqlText, -1) {
+		if ctx[loc[0]] == inCode && depth[loc[0]] == 0 {
+			return "", fmt.Errorf("{pagination} cannot be placed in a query combining SELECTs with %s: select from a derived table instead", strings.ToUpper(sqlText[loc[0]:loc[1]]))
+		}
+	}
+
+	return sqlText[:m[1]] + " " + clause + sqlText[m[1]:], nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
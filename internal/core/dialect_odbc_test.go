@@ -0,0 +1,110 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenericDialectDefaults(t *testing.T) {
+	d, err := ParseDialect("odbc", "odbc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Name() != "odbc" {
+		t.Errorf("Name = %q", d.Name())
+	}
+	if got := d.PaginationClause(20, 40); got != "LIMIT 20 OFFSET 40" {
+		t.Errorf("PaginationClause = %q", got)
+	}
+	if got := d.RewritePlaceholders("a = ?"); got != "a = ?" {
+		t.Errorf("RewritePlaceholders = %q, want unchanged", got)
+	}
+	if got := d.ExplainWrapper("SELECT 1"); got != "" {
+		t.Errorf("ExplainWrapper = %q, want unsupported", got)
+	}
+	if got := d.QuoteIdentifier("x"); got != `"x"` {
+		t.Errorf("QuoteIdentifier = %q", got)
+	}
+	if d.CatalogQueries().Tables == "" {
+		t.Error("CatalogQueries.Tables empty, want information_schema")
+	}
+}
+
+func TestGenericDialectOptions(t *testing.T) {
+	d, err := ParseDialect("odbc: pagination=offset_fetch, placeholder=colon, quote=brackets, explain=EXPLAIN PLAN FOR, catalog=none", "odbc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := d.PaginationClause(10, 0); got != "OFFSET 0 ROWS FETCH NEXT 10 ROWS ONLY" {
+		t.Errorf("PaginationClause = %q", got)
+	}
+	if got := d.RewritePlaceholders("SELECT [a?] WHERE x = ? AND y = ?"); got != "SELECT [a?] WHERE x = :1 AND y = :2" {
+		t.Errorf("RewritePlaceholders = %q", got)
+	}
+	if got := d.ExplainWrapper("SELECT 1"); got != "EXPLAIN PLAN FOR SELECT 1" {
+		t.Errorf("ExplainWrapper = %q", got)
+	}
+	if got := d.QuoteIdentifier("x"); got != "[x]" {
+		t.Errorf("QuoteIdentifier = %q", got)
+	}
+	if c := d.CatalogQueries(); c.Tables != "" || c.Columns != "" {
+		t.Errorf("CatalogQueries = %+v, want none", c)
+	}
+}
+
+func TestSQLAnywhereDialect(t *testing.T) {
+	d, err := ParseDialect("sqlanywhere", "odbc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name() != "sqlanywhere" {
+		t.Errorf("Name = %q", d.Name())
+	}
+	// START AT is 1-based
+	if got := d.PaginationClause(50, 100); got != "TOP 50 START AT 101" {
+		t.Errorf("PaginationClause = %q", got)
+	}
+}
+
+func TestSQLAnywherePlacePagination(t *testing.T) {
+	d, _ := ParseDialect("sqlanywhere", "odbc")
+	placer := d.(PaginationPlacer)
+	clause := d.PaginationClause(20, 40)
+
+	tests := []struct {
+		name, sql, want, wantErr string
+	}{
+		{"tag after SELECT", "SELECT {pagination} id FROM t", "SELECT TOP 20 START AT 41 id FROM t", ""},
+		{"tag at the end", "SELECT id, name FROM t ORDER BY id {pagination}", "SELECT TOP 20 START AT 41 id, name FROM t ORDER BY id", ""},
+		{"distinct", "select distinct city FROM t\n{pagination}", "select distinct TOP 20 START AT 41 city FROM t", ""},
+		{"distinct after a comment", "SELECT \x000\x00 DISTINCT city FROM t {pagination}", "SELECT \x000\x00 DISTINCT TOP 20 START AT 41 city FROM t", ""},
+		{"union in a derived table", "SELECT * FROM (SELECT a FROM x UNION SELECT a FROM y) u {pagination}", "SELECT TOP 20 START AT 41 * FROM (SELECT a FROM x UNION SELECT a FROM y) u", ""},
+		{"union in a literal", "SELECT 'union' AS kind FROM t {pagination}", "SELECT TOP 20 START AT 41 'union' AS kind FROM t", ""},
+		{"union", "SELECT a FROM x UNION ALL SELECT a FROM y {pagination}", "", "UNION"},
+		{"cte", "WITH x AS (SELECT 1 AS a) SELECT a FROM x {pagination}", "", "WITH"},
+		{"not a select", "BEGIN SELECT 1 {pagination} END", "", "starting with SELECT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := strings.Index(tt.sql, "{pagination}")
+			got, err := placer.PlacePagination(tt.sql, start, start+len("{pagination}"), clause)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want one mentioning %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("PlacePagination = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	// Other pagination styles replace the tag where it is
+	d, _ = ParseDialect("odbc", "odbc")
+	if got, _ := d.(PaginationPlacer).PlacePagination("SELECT 1 {pagination}", 9, 21, "LIMIT 1 OFFSET 0"); got != "SELECT 1 LIMIT 1 OFFSET 0" {
+		t.Errorf("limit_offset PlacePagination = %q", got)
+	}
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// OracleDialect is Oracle Database 12c+. The go-ora "oracle" driver needs
+// :1-style binds (PositionalBinds); ODBC takes ?.
+type OracleDialect struct {
+	PositionalBinds bool
+}
+
+func (OracleDialect) Name() string { return "oracle" }
+
+// PaginationClause uses the 12c row limiting clause, which goes after ORDER BY
+func (OracleDialect) PaginationClause(limit, offset int) string {
+	return fmt.Sprintf("OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", offset, limit)
+}
+
+func (d OracleDialect) RewritePlaceholders(sqlText string) string {
+	if !d.PositionalBinds {
+		return sqlText
+	}
+	return rewriteQuestionMarks(sqlText, `'"`, func(n int) string {
+		return ":" + strconv.Itoa(n)
+	})
+}
+
+// ExplainWrapper is unsupported: EXPLAIN PLAN writes to PLAN_TABLE instead of
+// returning rows
+func (OracleDialect) ExplainWrapper(sqlText string) string { return "" }
+
+// ReadOnlySetup has no session statement (SET TRANSACTION READ ONLY only lasts
+// one transaction); use a login with SELECT grants only
+func (OracleDialect) ReadOnlySetup() []string { return nil }
+
+// SessionTag sets the module shown in V$SESSION, which takes 48 bytes
+func (OracleDialect) SessionTag(dsn, tag string) (string, []string) {
+	if len(tag) > 48 {
+		tag = tag[:48]
+	}
+	return dsn, []string{"BEGIN DBMS_APPLICATION_INFO.SET_MODULE('" + tag + "', NULL); END;"}
+}
+
+// CatalogQueries lists the tables of the connected user's schema. Oracle stores
+// unquoted names in upper case, so Columns expects e.g. "ORDERS".
+func (OracleDialect) CatalogQueries() CatalogQueries {
+	return CatalogQueries{
+		Tables:  `SELECT USER AS table_schema, table_name FROM user_tables ORDER BY table_name`,
+		Columns: `SELECT column_name, data_type FROM user_tab_columns WHERE table_name = ? ORDER BY column_id`,
+	}
+}
+
+// QuoteIdentifier quotes name as is; quoted Oracle identifiers are case sensitive
+func (OracleDialect) QuoteIdentifier(name string) string {
+	return quoteWith(name, `"`, `"`)
+}
+
+// PingQuery checks the session with a round trip, as Oracle has no SELECT
+// without FROM
+func (OracleDialect) PingQuery() string { return "SELECT 1 FROM dual" }
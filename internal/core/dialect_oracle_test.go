@@ -0,0 +1,58 @@
+package core
+
+import "testing"
+
+func TestOracleDialect(t *testing.T) {
+	d := OracleDialect{}
+
+	if got := d.PaginationClause(20, 40); got != "OFFSET 40 ROWS FETCH NEXT 20 ROWS ONLY" {
+		t.Errorf("PaginationClause = %q", got)
+	}
+	if got := d.RewritePlaceholders("a = ?"); got != "a = ?" {
+		t.Errorf("RewritePlaceholders without PositionalBinds = %q, want unchanged", got)
+	}
+	if got := d.ExplainWrapper("SELECT 1 FROM dual"); got != "" {
+		t.Errorf("ExplainWrapper = %q, want unsupported", got)
+	}
+	if got := d.ReadOnlySetup(); got != nil {
+		t.Errorf("ReadOnlySetup = %v, want nil", got)
+	}
+	if got := d.QuoteIdentifier(`Mixed"Case`); got != `"Mixed""Case"` {
+		t.Errorf("QuoteIdentifier = %q", got)
+	}
+	if got := d.PingQuery(); got != "SELECT 1 FROM dual" {
+		t.Errorf("PingQuery = %q", got)
+	}
+}
+
+func TestOracleDialectBinds(t *testing.T) {
+	d, err := DialectFor("", "oracle", "oracle://scott:tiger@db:1521/ORCLPDB1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := `SELECT "why?", 'a?' FROM emp WHERE deptno = ? AND sal > ? -- ?`
+	want := `SELECT "why?", 'a?' FROM emp WHERE deptno = :1 AND sal > :2 -- ?`
+	if got := d.RewritePlaceholders(in); got != want {
+		t.Errorf("RewritePlaceholders = %q, want %q", got, want)
+	}
+	if got := d.RewritePlaceholders(d.CatalogQueries().Columns); got == d.CatalogQueries().Columns {
+		t.Error("catalog Columns query has no placeholder to rewrite")
+	}
+}
+
+func TestOracleDialectDetection(t *testing.T) {
+	d, err := DialectFor("", "odbc", "Driver={Oracle in OraClient12Home1};Dbq=ORCL;Uid=scott;Pwd=tiger;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name() != "oracle" {
+		t.Fatalf("Name = %q, want oracle", d.Name())
+	}
+	// ODBC keeps ? placeholders
+	if got := d.RewritePlaceholders("a = ?"); got != "a = ?" {
+		t.Errorf("RewritePlaceholders = %q, want unchanged", got)
+	}
+	if _, ok := d.(PingQuerier); !ok {
+		t.Error("Oracle dialect does not implement PingQuerier")
+	}
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// PostgresDialect is PostgreSQL through lib/pq, which only understands $n placeholders
+type PostgresDialect struct{}
+
+func (PostgresDialect) Name() string { return "postgres" }
+
+func (PostgresDialect) PaginationClause(limit, offset int) string {
+	return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+}
+
+// RewritePlaceholders numbers the placeholders: ? becomes $1, $2, ...
+// '[' is not a quote here since it is used for array subscripts.
+func (PostgresDialect) RewritePlaceholders(sqlText string) string {
+	return rewriteQuestionMarks(sqlText, `'"`, func(n int) string {
+		return "$" + strconv.Itoa(n)
+	})
+}
+
+func (PostgresDialect) ExplainWrapper(sqlText string) string {
+	return "EXPLAIN " + sqlText
+}
+
+func (PostgresDialect) ReadOnlySetup() []string {
+	return []string{"SET SESSION CHARACTERISTICS AS TRANSACTION READ ONLY"}
+}
+
+// SessionTag sets application_name, shown in pg_stat_activity
+func (PostgresDialect) SessionTag(dsn, tag string) (string, []string) {
+	return withDSNOption(dsn, "application_name", tag, " "), nil
+}
+
+func (PostgresDialect) CatalogQueries() CatalogQueries {
+	return informationSchemaCatalog
+}
+
+func (PostgresDialect) QuoteIdentifier(name string) string {
+	return quoteWith(name, `"`, `"`)
+}
+
+// EscapeLike escapes with backslash, the default LIKE escape character
+func (PostgresDialect) EscapeLike(s string) string { return backslashLikeEscaper.Replace(s) }
@@ -0,0 +1,28 @@
+package core
+
+import "testing"
+
+func TestPostgresDialect(t *testing.T) {
+	d := PostgresDialect{}
+
+	if got := d.PaginationClause(20, 40); got != "LIMIT 20 OFFSET 40" {
+		t.Errorf("PaginationClause = %q", got)
+	}
+	in := `SELECT tags[1], '?' FROM "t?" WHERE id IN (?, ?) AND name = ?`
+	want := `SELECT tags[1], '?' FROM "t?" WHERE id IN ($1, $2) AND name = $3`
+	if got := d.RewritePlaceholders(in); got != want {
+		t.Errorf("RewritePlaceholders = %q, want %q", got, want)
+	}
+	if got := d.ExplainWrapper("SELECT 1"); got != "EXPLAIN SELECT 1" {
+		t.Errorf("ExplainWrapper = %q", got)
+	}
+	if got := d.ReadOnlySetup(); len(got) != 1 {
+		t.Errorf("ReadOnlySetup = %v", got)
+	}
+	if got := d.QuoteIdentifier("Order"); got != `"Order"` {
+		t.Errorf("QuoteIdentifier = %q", got)
+	}
+	if got := d.RewritePlaceholders(d.CatalogQueries().Columns); got == d.CatalogQueries().Columns {
+		t.Error("catalog Columns query has no placeholder to rewrite")
+	}
+}
@@ -0,0 +1,36 @@
+package core
+
+import "fmt"
+
+// SnowflakeDialect is Snowflake through gosnowflake, which binds ? as is
+type SnowflakeDialect struct{}
+
+func (SnowflakeDialect) Name() string { return "snowflake" }
+
+func (SnowflakeDialect) PaginationClause(limit, offset int) string {
+	return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+}
+
+func (SnowflakeDialect) RewritePlaceholders(sqlText string) string { return sqlText }
+
+func (SnowflakeDialect) ExplainWrapper(sqlText string) string {
+	return "EXPLAIN USING TABULAR " + sqlText
+}
+
+// ReadOnlySetup has no session statement; grant the connection's role SELECT only
+func (SnowflakeDialect) ReadOnlySetup() []string { return nil }
+
+// SessionTag sets QUERY_TAG, shown in the query history
+func (SnowflakeDialect) SessionTag(dsn, tag string) (string, []string) {
+	return dsn, []string{"ALTER SESSION SET QUERY_TAG = '" + tag + "'"}
+}
+
+// CatalogQueries covers the connection's current database
+func (SnowflakeDialect) CatalogQueries() CatalogQueries {
+	return informationSchemaCatalog
+}
+
+// QuoteIdentifier quotes name as is; unquoted Snowflake identifiers resolve in upper case
+func (SnowflakeDialect) QuoteIdentifier(name string) string {
+	return quoteWith(name, `"`, `"`)
+}
@@ -0,0 +1,32 @@
+package core
+
+import "testing"
+
+func TestSnowflakeDialect(t *testing.T) {
+	d, err := DialectFor("", "snowflake", "user@acct/db/schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name() != "snowflake" {
+		t.Fatalf("Name = %q", d.Name())
+	}
+
+	if got := d.PaginationClause(20, 40); got != "LIMIT 20 OFFSET 40" {
+		t.Errorf("PaginationClause = %q", got)
+	}
+	if got := d.RewritePlaceholders("a = ? AND b = ?"); got != "a = ? AND b = ?" {
+		t.Errorf("RewritePlaceholders = %q, want unchanged", got)
+	}
+	if got := d.ExplainWrapper("SELECT 1"); got != "EXPLAIN USING TABULAR SELECT 1" {
+		t.Errorf("ExplainWrapper = %q", got)
+	}
+	if got := d.ReadOnlySetup(); got != nil {
+		t.Errorf("ReadOnlySetup = %v, want nil", got)
+	}
+	if got := d.CatalogQueries(); got != informationSchemaCatalog {
+		t.Errorf("CatalogQueries = %+v, want INFORMATION_SCHEMA", got)
+	}
+	if got := d.QuoteIdentifier("order"); got != `"order"` {
+		t.Errorf("QuoteIdentifier = %q", got)
+	}
+}
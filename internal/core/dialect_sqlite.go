@@ -0,0 +1,39 @@
+package core
+
+import "fmt"
+
+// SQLiteDialect is SQLite through modernc.org/sqlite
+type SQLiteDialect struct{}
+
+func (SQLiteDialect) Name() string { return "sqlite" }
+
+func (SQLiteDialect) PaginationClause(limit, offset int) string {
+	return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+}
+
+// RewritePlaceholders is a no-op: SQLite takes ? natively
+func (SQLiteDialect) RewritePlaceholders(sqlText string) string { return sqlText }
+
+func (SQLiteDialect) ExplainWrapper(sqlText string) string {
+	return "EXPLAIN QUERY PLAN " + sqlText
+}
+
+func (SQLiteDialect) ReadOnlySetup() []string {
+	return []string{"PRAGMA query_only = ON"}
+}
+
+// PingQuery reads the schema: Ping alone does not touch the file, so a file
+// that is not a database would only fail on the first query
+func (SQLiteDialect) PingQuery() string { return "SELECT count(*) FROM sqlite_master" }
+
+func (SQLiteDialect) CatalogQueries() CatalogQueries {
+	return CatalogQueries{
+		Tables: `SELECT 'main' AS table_schema, name AS table_name FROM sqlite_master
+WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY name`,
+		Columns: `SELECT name AS column_name, type AS data_type FROM pragma_table_info(?) ORDER BY cid`,
+	}
+}
+
+func (SQLiteDialect) QuoteIdentifier(name string) string {
+	return quoteWith(name, `"`, `"`)
+}
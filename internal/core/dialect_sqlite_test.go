@@ -0,0 +1,26 @@
+package core
+
+import "testing"
+
+func TestSQLiteDialect(t *testing.T) {
+	d := SQLiteDialect{}
+
+	if got := d.PaginationClause(20, 40); got != "LIMIT 20 OFFSET 40" {
+		t.Errorf("PaginationClause = %q", got)
+	}
+	if got := d.RewritePlaceholders("a = ? AND b = ?"); got != "a = ? AND b = ?" {
+		t.Errorf("RewritePlaceholders = %q, want unchanged", got)
+	}
+	if got := d.ExplainWrapper("SELECT 1"); got != "EXPLAIN QUERY PLAN SELECT 1" {
+		t.Errorf("ExplainWrapper = %q", got)
+	}
+	if got := d.ReadOnlySetup(); len(got) != 1 || got[0] != "PRAGMA query_only = ON" {
+		t.Errorf("ReadOnlySetup = %v", got)
+	}
+	if got := d.QuoteIdentifier(`my "col"`); got != `"my ""col"""` {
+		t.Errorf("QuoteIdentifier = %q", got)
+	}
+	if c := d.CatalogQueries(); c.Tables == "" || c.Columns == "" {
+		t.Errorf("CatalogQueries = %+v, want both", c)
+	}
+}
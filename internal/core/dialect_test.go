@@ -0,0 +1,138 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDialectForDetection(t *testing.T) {
+	tests := []struct {
+		driver, connStr, want string
+	}{
+		{"sqlite", "file:test.db", "sqlite"},
+		{"postgres", "host=localhost", "postgres"},
+		{"mysql", "user@tcp(db)/x", "mysql"},
+		{"sqlserver", "sqlserver://sa@db", "mssql"},
+		{"mssql", "server=db", "mssql"},
+		{"odbc", "Driver={SQL Anywhere 17};ServerName=x", "sqlanywhere"},
+		{"odbc", "Driver={ODBC Driver 18 for SQL Server};Server=db", "mssql"},
+		{"odbc", "Driver={PostgreSQL Unicode};Server=db", "odbc"},
+		{"odbc", "", "odbc"},
+		{"unknown", "", "odbc"},
+	}
+	for _, tt := range tests {
+		d, err := DialectFor("", tt.driver, tt.connStr)
+		if err != nil {
+			t.Fatalf("DialectFor(%q, %q) error = %v", tt.driver, tt.connStr, err)
+		}
+		if d.Name() != tt.want {
+			t.Errorf("DialectFor(%q, %q) = %s, want %s", tt.driver, tt.connStr, d.Name(), tt.want)
+		}
+	}
+}
+
+func TestDialectForExplicit(t *testing.T) {
+	// An explicit dialect wins over detection
+	d, err := DialectFor("sqlanywhere", "odbc", "Driver={ODBC Driver 18 for SQL Server}")
+	if err != nil || d.Name() != "sqlanywhere" {
+		t.Errorf("DialectFor(sqlanywhere) = %v, %v", d, err)
+	}
+
+	for _, spec := range []string{"db2", "postgres:placeholder=dollar", "odbc:pagination=skip", "odbc:quote"} {
+		if _, err := ParseDialect(spec, "odbc"); err == nil {
+			t.Errorf("ParseDialect(%q) error = nil", spec)
+		}
+	}
+}
+
+func TestDriverName(t *testing.T) {
+	tests := map[string]string{
+		"SQL Server":      "sqlserver",
+		"PostgreSQL":      "postgres",
+		"Sql Anywhere 10": "odbc",
+		"sqlserver":       "sqlserver",
+		"mssql":           "mssql",
+		" Oracle ":        "oracle",
+	}
+	for in, want := range tests {
+		if got := DriverName(in); got != want {
+			t.Errorf("DriverName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRewriteQuestionMarks(t *testing.T) {
+	number := func(n int) string { return "$" + string(rune('0'+n)) }
+	tests := []struct {
+		in, quotes, want string
+	}{
+		{"SELECT * FROM t WHERE a = ? AND b = ?", `'"`, "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{"SELECT '?', \"a?\" FROM t WHERE a = ?", `'"`, "SELECT '?', \"a?\" FROM t WHERE a = $1"},
+		{"SELECT 'it''s ?' WHERE a = ?", `'"`, "SELECT 'it''s ?' WHERE a = $1"},
+		{"SELECT a -- why?\nFROM t WHERE a = ? /* or ? */", `'"`, "SELECT a -- why?\nFROM t WHERE a = $1 /* or ? */"},
+		{"SELECT [col?] FROM t WHERE a = ?", `'"[`, "SELECT [col?] FROM t WHERE a = $1"},
+		{"SELECT arr[?] FROM t", `'"`, "SELECT arr[$1] FROM t"},
+		{"SELECT 'unterminated ?", `'"`, "SELECT 'unterminated ?"},
+	}
+	for _, tt := range tests {
+		if got := rewriteQuestionMarks(tt.in, tt.quotes, number); got != tt.want {
+			t.Errorf("rewriteQuestionMarks(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSessionTag(t *testing.T) {
+	tag := SanitizeSessionTag("dbbridge/monthly orders/ab'12")
+	if tag != "dbbridge/monthly_orders/ab_12" {
+		t.Fatalf("SanitizeSessionTag = %q", tag)
+	}
+	if long := SanitizeSessionTag(strings.Repeat("x", 100)); len(long) != maxSessionTag {
+		t.Errorf("tag of %d bytes", len(long))
+	}
+
+	for _, tc := range []struct {
+		dialect   Dialect
+		dsn, want string
+		setup     bool
+	}{
+		{PostgresDialect{}, "host=db dbname=app", "host=db dbname=app application_name=" + tag, false},
+		{PostgresDialect{}, "postgres://u:p@db/app?sslmode=disable", "postgres://u:p@db/app?application_name=dbbridge%2Fmonthly_orders%2Fab_12&sslmode=disable", false},
+		{PostgresDialect{}, "host=db application_name=etl", "host=db application_name=etl", false},
+		{MSSQLDialect{}, "server=db;database=app;", "server=db;database=app;app name=" + tag, false},
+		{MSSQLDialect{}, "Driver={ODBC Driver 18 for SQL Server};Server=db", "Driver={ODBC Driver 18 for SQL Server};Server=db;APP=" + tag, false},
+		{MySQLDialect{}, "u:p@tcp(db:3306)/app?parseTime=true", "u:p@tcp(db:3306)/app?parseTime=true&connectionAttributes=program_name:" + tag, false},
+		{OracleDialect{}, "oracle://u:p@db/svc", "oracle://u:p@db/svc", true},
+		{SnowflakeDialect{}, "u:p@acct/db", "u:p@acct/db", true},
+	} {
+		tagger, ok := tc.dialect.(SessionTagger)
+		if !ok {
+			t.Fatalf("%s dialect does not tag sessions", tc.dialect.Name())
+		}
+		dsn, setup := tagger.SessionTag(tc.dsn, tag)
+		if dsn != tc.want || (len(setup) > 0) != tc.setup {
+			t.Errorf("%s %q: %q, %q", tc.dialect.Name(), tc.dsn, dsn, setup)
+		}
+		for _, stmt := range setup {
+			if !strings.Contains(stmt, "'"+tag+"'") {
+				t.Errorf("%s setup %q lacks the tag", tc.dialect.Name(), stmt)
+			}
+		}
+	}
+	if _, ok := Dialect(SQLiteDialect{}).(SessionTagger); ok {
+		t.Error("sqlite has no sessions to tag")
+	}
+}
+
+func TestDriverPresets(t *testing.T) {
+	for value, want := range map[string]string{"odbc_sa17": "odbc", "sqlserver": "sqlserver", "SQL Server": "sqlserver", "Sql Anywhere 10": "odbc"} {
+		if got := PresetDriver(value); got != want {
+			t.Errorf("PresetDriver(%q) = %q, want %q", value, got, want)
+		}
+	}
+	if !KnownDriver("PostgreSQL") || KnownDriver("db2") {
+		t.Error("KnownDriver does not follow the presets")
+	}
+	if d, err := DialectFor("", "sqlite3", ""); err != nil || d.Name() != "sqlite" {
+		t.Errorf("DialectFor(sqlite3) = %v, %v", d, err)
+	}
+}
@@ -1,5 +1,7 @@
 package core
 
+import "time"
+
 // UserRepository defines storage operations for users and api keys
 type UserRepository interface {
 	CreateUser(username, passwordHash string) (*User, error)
@@ -7,6 +9,7 @@ type UserRepository interface {
 	GetByID(id int64) (*User, error)
 	GetAll() ([]User, error)
 	Update(user *User) error
+	SetLocale(id int64, locale string) error
 	Delete(id int64) error
 	CountUsers() (int, error)
 	CreateApiKey(userID int64, keyPrefix, keyHash string) (*ApiKey, error)
@@ -19,6 +22,15 @@ type ApiKeyRepository interface {
 	List() ([]ApiKey, error)
 	GetByHash(hash string) (*ApiKey, error)
 	Revoke(id int64) error
+	UpdateAllowedCIDRs(id int64, cidrs string) error
+	UpdateAttributes(id int64, attributes string) error
+	UpdateScopes(id int64, scopes string) error
+	UpdateEnvelope(id int64, envelope string) error
+	// DisableInactive disables an active key for lack of use
+	DisableInactive(id int64) error
+	// Reenable activates a key disabled for lack of use again, restarting
+	// its inactivity from now
+	Reenable(id int64) error
 	UpdateLastUsed(id int64) error
 }
 
@@ -32,18 +44,117 @@ type ConnectionRepository interface {
 	Delete(id int64) error
 }
 
-// QueryRepository defines storage operations for saved queries
+// QueryRepository defines storage operations for saved queries. Update keeps
+// the old slug of a renamed query as an alias, which GetBySlug resolves after
+// the current slugs; Delete drops the query's aliases.
 type QueryRepository interface {
 	Create(query *SavedQuery) error
 	GetAll() ([]SavedQuery, error)
 	GetByID(id int64) (*SavedQuery, error)
 	GetBySlug(slug string) (*SavedQuery, error)
 	Update(query *SavedQuery) error
+	UpdateExample(id int64, example string) error       // "" clears it
+	UpdateResponseSchema(id int64, schema string) error // "" clears it
 	Delete(id int64) error
+	ListAliases(queryID int64) ([]QuerySlugAlias, error) // oldest first
+	DeleteAlias(slug string) error
+}
+
+// AccessEventRepository stores the access events of rejected API requests
+type AccessEventRepository interface {
+	CreateBatch(events []*AccessEvent) error
+	List(filter AccessEventFilter, limit int, beforeID int64) ([]AccessEvent, error) // newest first, ids below beforeID if set
+	DeleteBefore(t time.Time) (int64, error)
+}
+
+// ContractRepository stores the changes of saved queries' API contracts
+type ContractRepository interface {
+	Add(change *ContractChange) error
+	ListSince(since time.Time) ([]ContractChange, error) // oldest first
+}
+
+// ExecutionDetailRepository stores the captured SQL of executions by audit
+// entry
+type ExecutionDetailRepository interface {
+	Add(d *ExecutionDetail) error
+	Get(auditID int64) (*ExecutionDetail, error) // nil when nothing was captured
+}
+
+// IdempotencyRepository stores API executions by Idempotency-Key
+type IdempotencyRepository interface {
+	// Claim stores rec as running unless an unexpired record of the same API
+	// key and key exists, which it returns instead; nil means rec was stored
+	Claim(rec *IdempotencyRecord) (*IdempotencyRecord, error)
+	Complete(rec *IdempotencyRecord) error // stores the response of a claimed key
+	Release(apiKeyID int64, key string) error
+}
+
+// OrphanRepository finds and cleans rows referencing deleted objects
+type OrphanRepository interface {
+	CountOrphans() ([]OrphanCount, error)
+	// CleanOrphans fixes every category in one transaction and returns the
+	// rows affected; with dryRun the transaction is rolled back
+	CleanOrphans(dryRun bool) ([]OrphanCount, error)
+}
+
+// UsageRepository keeps the hourly usage of connections, rolled up from the
+// audit log so it outlives the audit retention
+type UsageRepository interface {
+	// Rollup adds the hours from the last one rolled up to until, a whole
+	// hour, and returns the rows written
+	Rollup(until time.Time) (int64, error)
+	// Hourly returns the usage of connectionID in [from, to) by hour, oldest
+	// first: rolled up hours, then the audit log after them
+	Hourly(connectionID int64, from, to time.Time) ([]ConnectionUsage, error)
+	// QueryStats aggregates the executions of queryID in [from, to) from the
+	// audit log, so only over its retention
+	QueryStats(queryID int64, from, to time.Time) (ExecutionStats, error)
+}
+
+// EmbedTokenRepository stores the embed tokens of saved queries
+type EmbedTokenRepository interface {
+	Create(t *EmbedToken) error
+	GetByID(id int64) (*EmbedToken, error)
+	ListByQuery(queryID int64) ([]EmbedToken, error) // newest first
+	Revoke(id int64) error
+	UpdateLastUsed(id int64) error
+}
+
+// QuotaRepository keeps the API requests of each key per quota day
+// ("YYYY-MM-DD"), so daily quotas survive restarts
+type QuotaRepository interface {
+	// Add adds each usage's requests to what its key has on its day
+	Add(usage []QuotaUsage) error
+	// Day returns the requests of each key on day
+	Day(day string) (map[int64]int64, error)
+	// DeleteBefore removes the days before day
+	DeleteBefore(day string) error
+}
+
+// SettingsRepository stores runtime setting overrides by key
+type SettingsRepository interface {
+	GetAll() (map[string]string, error)
+	Set(key, value string) error
+	Delete(key string) error
 }
 
 // AuditRepository defines storage operations for audit logs
 type AuditRepository interface {
 	Create(log *AuditLog) error
 	GetRecent(limit int) ([]AuditLog, error)
+	GetByID(id int64) (*AuditLog, error)
+	// ListRecent is GetRecent narrowed by an AuditFilter* constant or an
+	// event category ("connection", "auth", ...) and by the acting user;
+	// "" and 0 list everything. beforeID continues after that entry, 0 from
+	// the newest.
+	ListRecent(limit int, filter string, userID int64, beforeID int64) ([]AuditLog, error)
+	ListAfter(afterID int64, limit int) ([]AuditLog, error)
+	GetForwardCursor(sink string) (int64, error)
+	SetForwardCursor(sink string, lastID int64) error
+}
+
+// Cipher encrypts metadata values at rest, see service.EncryptionService
+type Cipher interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, error)
 }
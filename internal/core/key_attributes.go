@@ -0,0 +1,100 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// KeyParamPrefix starts the parameters bound from the calling API key's
+// attributes, e.g. {_key.tenant_id}. They are never taken from the request.
+const KeyParamPrefix = "_key."
+
+// KeyAttribute is one attribute of an API key
+type KeyAttribute struct {
+	Name      string
+	Value     string
+	Sensitive bool // redacted in audit logs
+}
+
+var reAttributeName = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// ParseKeyAttributes reads an API key's attributes: name=value per line, a
+// leading ! marks the attribute sensitive (!token=abc). Blank lines and lines
+// starting with # are skipped.
+func ParseKeyAttributes(s string) ([]KeyAttribute, error) {
+	var attrs []KeyAttribute
+	seen := make(map[string]bool)
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var a KeyAttribute
+		if strings.HasPrefix(line, "!") {
+			a.Sensitive = true
+			line = line[1:]
+		}
+		name, value, ok := strings.Cut(line, "=")
+		a.Name, a.Value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !reAttributeName.MatchString(a.Name) {
+			return nil, fmt.Errorf("attributes line %d: want name=value with a name of letters, digits and _, got %q", i+1, line)
+		}
+		if seen[a.Name] {
+			return nil, fmt.Errorf("attributes line %d: %s is set twice", i+1, a.Name)
+		}
+		seen[a.Name] = true
+		attrs = append(attrs, a)
+	}
+	return attrs, nil
+}
+
+// FormatKeyAttributes writes attrs in the form ParseKeyAttributes reads, with
+// the values of sensitive attributes replaced by ******** when redact is set
+func FormatKeyAttributes(attrs []KeyAttribute, redact bool) string {
+	lines := make([]string, len(attrs))
+	for i, a := range attrs {
+		value := a.Value
+		if a.Sensitive {
+			if redact {
+				value = "********"
+			}
+			lines[i] = "!" + a.Name + "=" + value
+		} else {
+			lines[i] = a.Name + "=" + value
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// KeyAttributeError is a query needing an API key attribute the caller lacks
+type KeyAttributeError struct {
+	Attribute string
+	NoKey     bool // not called with an API key at all
+}
+
+func (e *KeyAttributeError) Error() string {
+	if e.NoKey {
+		return fmt.Sprintf("query uses {%s%s}, which is only set for API key calls", KeyParamPrefix, e.Attribute)
+	}
+	return fmt.Sprintf("query needs the API key attribute %s, which this key does not have", e.Attribute)
+}
+
+// KeyParams lists the attribute names of the {_key.*} parameters sqlText uses
+// outside comments, once each
+func (p *SQLParser) KeyParams(sqlText string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	ctx := sqlContexts(sqlText)
+	for _, m := range p.regex.FindAllStringIndex(sqlText, -1) {
+		name := paramName(sqlText[m[0]:m[1]])
+		if ctx[m[0]] == inComment || !strings.HasPrefix(name, KeyParamPrefix) {
+			continue
+		}
+		if name = strings.TrimPrefix(name, KeyParamPrefix); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
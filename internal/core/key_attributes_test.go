@@ -0,0 +1,35 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeyAttributes(t *testing.T) {
+	attrs, err := ParseKeyAttributes("tenant_id = 42\n\n# comment\n!token=a=b")
+	want := []KeyAttribute{{Name: "tenant_id", Value: "42"}, {Name: "token", Value: "a=b", Sensitive: true}}
+	if err != nil || !reflect.DeepEqual(attrs, want) {
+		t.Fatalf("ParseKeyAttributes() = %+v, %v", attrs, err)
+	}
+	if got := FormatKeyAttributes(attrs, true); got != "tenant_id=42\n!token=********" {
+		t.Errorf("FormatKeyAttributes(redacted) = %q", got)
+	}
+
+	for _, bad := range []string{"tenant", "tenant-id=1", "=1", "a=1\na=2"} {
+		if _, err := ParseKeyAttributes(bad); err == nil {
+			t.Errorf("ParseKeyAttributes(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestKeyParams(t *testing.T) {
+	p := NewSQLParser()
+	sql := "SELECT * FROM t WHERE tenant = {_key.tenant_id} AND region = {_key.region} AND id = {id} -- {_key.other}\nOR tenant = {_key.tenant_id}"
+	if got := p.KeyParams(sql); !reflect.DeepEqual(got, []string{"tenant_id", "region"}) {
+		t.Errorf("KeyParams() = %q", got)
+	}
+	res := p.Parse(sql, nil)
+	if !reflect.DeepEqual(res.ParamNames, []string{"_key.tenant_id", "_key.region", "id", "_key.tenant_id"}) {
+		t.Errorf("ParamNames = %q", res.ParamNames)
+	}
+}
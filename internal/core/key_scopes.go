@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EnvScopePrefix marks a key scope naming an environment, e.g. env:staging
+const EnvScopePrefix = "env:"
+
+// KeyScope is a connection, or with Environment set every connection of an
+// environment, an API key may run queries on
+type KeyScope struct {
+	Name        string
+	Environment bool
+}
+
+func (s KeyScope) String() string {
+	if s.Environment {
+		return EnvScopePrefix + s.Name
+	}
+	return s.Name
+}
+
+// ParseKeyScopes reads an API key's scopes: connection names and env:NAME
+// entries, separated by commas or newlines. No scopes means every connection.
+func ParseKeyScopes(s string) ([]KeyScope, error) {
+	var scopes []KeyScope
+	seen := make(map[KeyScope]bool)
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var scope KeyScope
+		if name, ok := strings.CutPrefix(entry, EnvScopePrefix); ok {
+			scope = KeyScope{Name: Slugify(name), Environment: true}
+		} else {
+			scope = KeyScope{Name: Slugify(entry)}
+		}
+		if scope.Name == "" {
+			return nil, fmt.Errorf("invalid scope %q: want a connection name or env:NAME", entry)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// FormatKeyScopes writes scopes in the form ParseKeyScopes reads
+func FormatKeyScopes(scopes []KeyScope) string {
+	entries := make([]string, len(scopes))
+	for i, s := range scopes {
+		entries[i] = s.String()
+	}
+	return strings.Join(entries, ",")
+}
+
+// ScopesAllow reports whether a key with scopes may use conn
+func ScopesAllow(scopes []KeyScope, conn *DBConnection) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, s := range scopes {
+		if s.Environment && conn.Environment != "" && s.Name == conn.Environment {
+			return true
+		}
+		if !s.Environment && s.Name == Slugify(conn.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyScopeError is a call on a connection outside the API key's scopes
+type KeyScopeError struct {
+	Connection string
+}
+
+func (e *KeyScopeError) Error() string {
+	return fmt.Sprintf("API key is not scoped to connection %s", e.Connection)
+}
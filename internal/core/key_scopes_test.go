@@ -0,0 +1,42 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeyScopes(t *testing.T) {
+	scopes, err := ParseKeyScopes("Reporting DB, env:Staging\nenv:staging,")
+	want := []KeyScope{{Name: "reporting-db"}, {Name: "staging", Environment: true}}
+	if err != nil || !reflect.DeepEqual(scopes, want) {
+		t.Fatalf("ParseKeyScopes() = %+v, %v", scopes, err)
+	}
+	if got := FormatKeyScopes(scopes); got != "reporting-db,env:staging" {
+		t.Errorf("FormatKeyScopes() = %q", got)
+	}
+	for _, bad := range []string{"env:", "!!"} {
+		if _, err := ParseKeyScopes(bad); err == nil {
+			t.Errorf("ParseKeyScopes(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestScopesAllow(t *testing.T) {
+	scopes := []KeyScope{{Name: "reporting"}, {Name: "staging", Environment: true}}
+	for _, tc := range []struct {
+		conn DBConnection
+		want bool
+	}{
+		{DBConnection{Name: "reporting", Environment: "prod"}, true},
+		{DBConnection{Name: "orders-staging", Environment: "staging"}, true},
+		{DBConnection{Name: "orders-prod", Environment: "prod"}, false},
+		{DBConnection{Name: "staging"}, false}, // an environment scope is not a connection name
+	} {
+		if got := ScopesAllow(scopes, &tc.conn); got != tc.want {
+			t.Errorf("ScopesAllow(%s/%s) = %v, want %v", tc.conn.Name, tc.conn.Environment, got, tc.want)
+		}
+	}
+	if !ScopesAllow(nil, &DBConnection{Name: "any"}) {
+		t.Error("a key without scopes is restricted")
+	}
+}
@@ -10,36 +10,278 @@ type User struct {
 	PasswordHash string    `json:"-"` // Added for Auth
 	IsActive     bool      `json:"is_active"`
 	CreatedAt    time.Time `json:"created_at"`
+	Locale       string    `json:"locale"` // admin UI language, "" = the default
 }
 
 // ... (Other models remain same)
 type ApiKey struct {
-	ID          int64      `json:"id"`
-	UserID      int64      `json:"user_id"`
-	KeyPrefix   string     `json:"key_prefix"`
-	KeyHash     string     `json:"-"`
-	Description string     `json:"description"`
-	IsActive    bool       `json:"is_active"`
-	LastUsedAt  *time.Time `json:"last_used_at"`
-	CreatedAt   time.Time  `json:"created_at"`
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	KeyPrefix    string     `json:"key_prefix"`
+	KeyHash      string     `json:"-"`
+	Description  string     `json:"description"`
+	AllowedCIDRs string     `json:"allowed_cidrs"` // Comma-separated, empty = unrestricted
+	Attributes   string     `json:"-"`             // see ParseKeyAttributes; bound to {_key.*} parameters
+	Scopes       string     `json:"scopes"`        // see ParseKeyScopes; empty = every connection
+	Kind         string     `json:"kind"`          // ApiKeyKindData or ApiKeyKindAdmin
+	Envelope     string     `json:"envelope"`      // EnvelopeV1 or EnvelopeV2, for requests naming none
+	IsActive     bool       `json:"is_active"`
+	IsDemo       bool       `json:"is_demo"` // seeded sample object, see service.DemoSeeder
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at"` // nil = never; always set for admin keys
+	// DisabledReason is ApiKeyDisabledInactive for a key disabled for lack of
+	// use, which admins can re-enable; empty for active and revoked keys
+	DisabledReason string     `json:"disabled_reason"`
+	ReenabledAt    *time.Time `json:"reenabled_at"`
+}
+
+// ApiKeyDisabledInactive is the DisabledReason of keys disabled by
+// service.InactiveKeyJanitor
+const ApiKeyDisabledInactive = "inactive"
+
+// AutoDisabled reports a key disabled for lack of use
+func (k *ApiKey) AutoDisabled() bool {
+	return !k.IsActive && k.DisabledReason == ApiKeyDisabledInactive
+}
+
+// LastActivity is when the key was last used, created or re-enabled,
+// whichever is latest
+func (k *ApiKey) LastActivity() time.Time {
+	last := k.CreatedAt
+	for _, t := range []*time.Time{k.LastUsedAt, k.ReenabledAt} {
+		if t != nil && t.After(last) {
+			last = *t
+		}
+	}
+	return last
+}
+
+// API key kinds. Data keys run queries; admin keys call the admin JSON API
+// under /api/admin, and run queries only on the connections they are scoped to.
+const (
+	ApiKeyKindData  = "data"
+	ApiKeyKindAdmin = "admin"
+)
+
+// Envelopes of JSON query results. v1 is the body of older clients, v2 the
+// one with the result's meta and warnings.
+const (
+	EnvelopeV1 = "v1" // {"success": true, "data": ...}
+	EnvelopeV2 = "v2" // {"data": ..., "meta": ..., "error": ..., "warnings": ...}
+)
+
+// IsAdmin reports an admin key
+func (k *ApiKey) IsAdmin() bool {
+	return k.Kind == ApiKeyKindAdmin
+}
+
+// Expired reports a key past its expiry at now
+func (k *ApiKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
 }
 
 type DBConnection struct {
-	ID                  int64  `json:"id"`
-	Name                string `json:"name"`
-	Driver              string `json:"driver"`
-	ConnectionStringEnc string `json:"-"` // Encrypted
-	IsActive            bool   `json:"is_active"`
+	ID                  int64      `json:"id"`
+	Name                string     `json:"name"`
+	Driver              string     `json:"driver"`
+	ConnectionStringEnc string     `json:"-"`                   // Encrypted
+	Dialect             string     `json:"dialect"`             // empty = detected from driver and connection string
+	CredentialsEnc      string     `json:"-"`                   // Encrypted ConnectionCredentials JSON, empty when none
+	InitOptions         string     `json:"init_options"`        // key=value per line, applied when the connection opens
+	PingQuery           string     `json:"ping_query"`          // used instead of the driver's Ping, e.g. SELECT 1 FROM dummy
+	HealthQuery         string     `json:"health_query"`        // run by the health monitor after its ping; empty = none
+	HealthRule          string     `json:"health_rule"`         // what HealthQuery must return, see service.ParseHealthRule
+	SkipPing            bool       `json:"skip_ping"`           // no check before executing; errors surface on the query itself
+	BindMode            string     `json:"bind_mode"`           // BindModeNative or BindModeString
+	StripComments       bool       `json:"strip_comments"`      // comments are removed from the SQL sent to the driver
+	AllowedSchemas      string     `json:"allowed_schemas"`     // see service.ParseAllowedSchemas; empty = unrestricted
+	Production          bool       `json:"production"`          // benchmarks need an explicit confirmation
+	Protected           bool       `json:"protected"`           // admin test runs are read-only, capped and short unless confirmed by name
+	Environment         string     `json:"environment"`         // label such as prod, routed by /api/env/{environment}/...; empty = none
+	ShowOnStatusPage    bool       `json:"show_on_status_page"` // health listed on the public /status page, by name only
+	DefaultParams       string     `json:"-"`                   // see service.ConnectionParams; admin only, empty = none
+	IsActive            bool       `json:"is_active"`
+	IsDemo              bool       `json:"is_demo"`    // seeded sample object, see service.DemoSeeder
+	CreatedAt           *time.Time `json:"created_at"` // nil for rows older than the column
+	UpdatedAt           *time.Time `json:"updated_at"`
+	UpdatedBy           string     `json:"updated_by"` // admin username, or SystemActor
+}
+
+// Parameter binding modes. Some ODBC drivers reject Go integer or time
+// values; BindModeString hands every parameter to the driver as text.
+const (
+	BindModeNative = ""
+	BindModeString = "string"
+)
+
+// ConnectionCredentials holds secrets kept out of the connection string
+type ConnectionCredentials struct {
+	PrivateKey string `json:"private_key,omitempty"` // PEM, PKCS#8 or PKCS#1, unencrypted
 }
 
 type SavedQuery struct {
-	ID                   int64   `json:"id"`
-	Slug                 string  `json:"slug"`
-	Description          string  `json:"description"`
-	SQLText              string  `json:"sql_text"`
-	ParamsConfig         string  `json:"params_config"` // JSON string
-	IsActive             bool    `json:"is_active"`
-	AllowedConnectionIDs []int64 `json:"allowed_connection_ids"` // Many-to-many
+	ID                   int64      `json:"id"`
+	Slug                 string     `json:"slug"`
+	Description          string     `json:"description"`
+	SQLText              string     `json:"sql_text"`
+	ParamsConfig         string     `json:"params_config"` // JSON string
+	IsActive             bool       `json:"is_active"`
+	ResultMode           string     `json:"result_mode"`            // rows, object or scalar
+	ShapeConfig          string     `json:"shape_config"`           // JSON nesting config, empty = flat rows
+	XMLRoot              string     `json:"xml_root"`               // root element for ?format=xml, empty = result
+	ResponseConfig       string     `json:"response_config"`        // JSON service.ResponseConfig, empty = defaults
+	ExecWindow           string     `json:"exec_window"`            // JSON service.ExecWindow, empty = any time
+	SkipSchemaCheck      bool       `json:"skip_schema_check"`      // acknowledged: not checked against connections' allowed schemas
+	WarnDurationMs       int        `json:"warn_duration_ms"`       // soft limit, 0 = the WARN_DURATION_MS setting
+	WarnRows             int        `json:"warn_rows"`              // soft limit, 0 = the WARN_ROWS setting
+	RecordExample        bool       `json:"record_example"`         // admin test runs of the saved SQL replace Example
+	Example              string     `json:"example"`                // JSON service.QueryExample for the OpenAPI spec, empty = none
+	ResponseSchema       string     `json:"response_schema"`        // JSON service.ResponseSchema for the OpenAPI spec, empty = none
+	DebugCapture         bool       `json:"debug_capture"`          // executions store their final SQL and argument types, see ExecutionDetail
+	DebugCaptureValues   bool       `json:"debug_capture_values"`   // with DebugCapture, the argument values too
+	Confidential         bool       `json:"confidential"`           // SQLText is encrypted at rest when METADATA_ENCRYPT has query_sql
+	IsDemo               bool       `json:"is_demo"`                // seeded sample object, see service.DemoSeeder
+	AllowedConnectionIDs []int64    `json:"allowed_connection_ids"` // Many-to-many
+	DeprecatedAt         *time.Time `json:"deprecated_at"`          // from then responses carry Deprecation headers, nil = never
+	SunsetAt             *time.Time `json:"sunset_at"`              // from then executions answer 410, nil = never
+	SupersededBy         string     `json:"superseded_by"`          // slug of the replacement query, empty = none
+	SunsetMessage        string     `json:"sunset_message"`         // error after the sunset, empty = one naming SupersededBy
+	CreatedAt            *time.Time `json:"created_at"`             // nil for rows older than the column
+	UpdatedAt            *time.Time `json:"updated_at"`
+	UpdatedBy            string     `json:"updated_by"` // admin username, or SystemActor
+}
+
+// Lifecycle states of a saved query, see SavedQuery.Lifecycle
+const (
+	LifecycleCurrent    = ""
+	LifecycleDeprecated = "deprecated"
+	LifecycleSunset     = "sunset"
+)
+
+// Lifecycle returns the Lifecycle* state of q at now
+func (q *SavedQuery) Lifecycle(now time.Time) string {
+	switch {
+	case q.SunsetAt != nil && !now.Before(*q.SunsetAt):
+		return LifecycleSunset
+	case q.DeprecatedAt != nil && !now.Before(*q.DeprecatedAt):
+		return LifecycleDeprecated
+	}
+	return LifecycleCurrent
+}
+
+// QuerySlugAlias is a former slug of a saved query, kept when the query is
+// renamed so that its old URLs keep working until the alias is retired
+type QuerySlugAlias struct {
+	Slug      string    `json:"slug"`
+	QueryID   int64     `json:"query_id"`
+	CreatedAt time.Time `json:"created_at"` // when the query was renamed away from it
+}
+
+// AccessEvent is an API request answered with a non-2xx status: a bad API
+// key, a rate-limited call, an unknown route or a failed execution
+type AccessEvent struct {
+	ID         int64     `json:"id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	ClientIP   string    `json:"client_ip"`
+	KeyPrefix  string    `json:"key_prefix,omitempty"` // first characters of the X-API-Key sent, "" for none
+	Code       string    `json:"code"`                 // the response's error code, else derived from the status
+	Message    string    `json:"message,omitempty"`    // start of the error message
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// AccessEventFilter selects access events; zero fields match all
+type AccessEventFilter struct {
+	MinStatus, MaxStatus int
+	Path                 string // substring of the path
+	KeyPrefix            string
+	ClientIP             string
+	Code                 string
+}
+
+// ContractChange records a save or delete that changed what API consumers of
+// a saved query depend on. The contracts are JSON service.QueryContract
+// values; an empty one means the endpoint did not exist (or was inactive).
+type ContractChange struct {
+	ID          int64
+	QueryID     int64
+	QuerySlug   string
+	OldContract string
+	NewContract string
+	ChangedAt   time.Time
+}
+
+// ExecutionDetail is the SQL an execution of a query with DebugCapture sent
+// to the database, linked to its audit entry and deleted with it
+type ExecutionDetail struct {
+	AuditID   int64
+	SQL       string   // after system variables, pagination and placeholder rewriting
+	ArgTypes  []string // type of each bound argument, in order
+	ArgValues string   // JSON array of the arguments, only with DebugCaptureValues
+}
+
+// IdempotencyRecord is an API execution sent with an Idempotency-Key and
+// the response it got, replayed to retries until ExpiresAt. StatusCode 0
+// means the execution is still running.
+type IdempotencyRecord struct {
+	ApiKeyID    int64
+	Key         string
+	RequestHash string // connection, query, format and parameters of the request
+	StatusCode  int
+	Headers     string // JSON http.Header of the response
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// OrphanCount is one kind of row left behind by deletes that did not cascade,
+// with what cleaning does to it
+type OrphanCount struct {
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	Action      string `json:"action"`
+	Count       int64  `json:"count"`
+}
+
+// ConnectionUsage is the executions audited on a connection in one hour
+type ConnectionUsage struct {
+	ConnectionID int64
+	Hour         time.Time // start of the hour, in the server's time zone
+	Executions   int64
+	DurationMs   int64 // total of the executions
+}
+
+// ExecutionStats aggregates the executions of a query audited over a time
+// range, durations in milliseconds
+type ExecutionStats struct {
+	Executions int64 `json:"executions"`
+	Errors     int64 `json:"errors"`
+	P50Ms      int64 `json:"p50_ms"`
+	P95Ms      int64 `json:"p95_ms"`
+	P99Ms      int64 `json:"p99_ms"`
+}
+
+// SystemActor is recorded as UpdatedBy for changes not made by an admin,
+// such as demo seeding
+const SystemActor = "system"
+
+// Result modes decide how a query's rows are shaped in the API response
+const (
+	ResultModeRows   = "rows"   // array of objects (default)
+	ResultModeObject = "object" // first row as an object, 404 when empty
+	ResultModeScalar = "scalar" // first column of the first row
+)
+
+// NormalizeResultMode returns mode if it is a known result mode, otherwise rows
+func NormalizeResultMode(mode string) string {
+	switch mode {
+	case ResultModeObject, ResultModeScalar:
+		return mode
+	}
+	return ResultModeRows
 }
 
 type AuditLog struct {
@@ -56,4 +298,111 @@ type AuditLog struct {
 	DurationMs     int64     `json:"duration_ms"`
 	Status         string    `json:"status"`
 	ErrorMessage   string    `json:"error_message"`
+	ClientIP       string    `json:"client_ip"`
+	Mode           string    `json:"mode,omitempty"`       // "count" for count-only runs, "sample" for sample runs, "embed" for embed token runs, "healthcheck" for health queries, empty for full runs
+	EventType      string    `json:"event_type,omitempty"` // admin event, e.g. EventConnectionUpdate; empty for query executions
+	Target         string    `json:"target,omitempty"`     // the entity an admin event changed, e.g. "connection prod-db"
+	Username       string    `json:"username,omitempty"`   // Display only
+}
+
+// Admin event types recorded in AuditLog.EventType. The part before the dot
+// is the category the audit log page filters on.
+const (
+	EventConnectionCreate        = "connection.create"
+	EventConnectionUpdate        = "connection.update"
+	EventConnectionDelete        = "connection.delete"
+	EventConnectionReveal        = "connection.reveal"
+	EventConnectionGuardOverride = "connection.guard_override"
+	EventQueryCreate             = "query.create"
+	EventQueryUpdate             = "query.update"
+	EventQueryActivate           = "query.activate"
+	EventQueryDeactivate         = "query.deactivate"
+	EventQueryDelete             = "query.delete"
+	EventQueryExample            = "query.example"
+	EventQueryCancel             = "query.cancel"
+	EventQueryAliasRetire        = "query.alias_retire"
+	EventQueryEmbedCreate        = "query.embed_create"
+	EventQueryEmbedRevoke        = "query.embed_revoke"
+	EventAPIKeyCreate            = "api_key.create"
+	EventAPIKeyRevoke            = "api_key.revoke"
+	EventAPIKeyAllowlist         = "api_key.allowlist"
+	EventAPIKeyAttributes        = "api_key.attributes"
+	EventAPIKeyScopes            = "api_key.scopes"
+	EventAPIKeyEnvelope          = "api_key.envelope"
+	EventAPIKeyAutoDisable       = "api_key.auto_disable"
+	EventAPIKeyReenable          = "api_key.reenable"
+	EventUserCreate              = "user.create"
+	EventUserPassword            = "user.password"
+	EventSettingsUpdate          = "settings.update"
+	EventConfigReload            = "config.reload"
+	EventOrphanCleanup           = "maintenance.orphans"
+	EventDocsRebuild             = "maintenance.docs_rebuild"
+	EventLogin                   = "auth.login"
+	EventLogout                  = "auth.logout"
+)
+
+// EmbedToken lets anyone holding its signed token view the results of one
+// saved query on one connection, with fixed parameters and at most RowCap
+// rows, until it expires or is revoked. See service.EmbedService.
+type EmbedToken struct {
+	ID           int64      `json:"id"`
+	QueryID      int64      `json:"query_id"`
+	ConnectionID int64      `json:"connection_id"`
+	Params       string     `json:"params"` // JSON object, the parameters of every run
+	RowCap       int        `json:"row_cap"`
+	Label        string     `json:"label"`
+	CreatedBy    int64      `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+// QuotaUsage is a number of API requests of a key on one quota day
+type QuotaUsage struct {
+	ApiKeyID int64
+	Day      string // YYYY-MM-DD in the quota time zone
+	Requests int64
+}
+
+// Active reports whether the token may be used at now
+func (t *EmbedToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// Audit log filters besides an event category such as "connection"
+const (
+	AuditFilterExecutions = "executions" // query executions only
+	AuditFilterAdmin      = "admin"      // every admin event
+)
+
+// Column groups of the metadata database that METADATA_ENCRYPT can encrypt
+// at rest
+const (
+	EncryptAuditParams        = "audit_params"         // audit_logs.params, execution_details.arg_values
+	EncryptQuerySQL           = "query_sql"            // queries.sql_text of queries marked Confidential, execution_details.sql_text
+	EncryptAPIKeyDescriptions = "api_key_descriptions" // api_keys.description
+)
+
+// EncryptGroups lists the Encrypt* groups
+var EncryptGroups = []string{EncryptAuditParams, EncryptQuerySQL, EncryptAPIKeyDescriptions}
+
+// States of the metadata database, see MetadataStatus
+const (
+	MetadataOK      = "ok"
+	MetadataLocked  = "locked"  // another process holds a lock on the file
+	MetadataMissing = "missing" // the file is gone or holds no dbbridge data
+	MetadataCorrupt = "corrupt" // the file is not a readable SQLite database
+	MetadataError   = "error"
+)
+
+// MetadataStatus is the health of dbbridge's own SQLite database
+type MetadataStatus struct {
+	State   string    `json:"state"`
+	Message string    `json:"message,omitempty"` // what to do about it
+	Since   time.Time `json:"since"`
+}
+
+func (s MetadataStatus) OK() bool {
+	return s.State == MetadataOK
 }
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// reIdentParam matches an identifier parameter, {name!ident:allowed,...}: a
+// table or column name chosen by the request from the listed ones
+var reIdentParam = regexp.MustCompile(`\{\s*(\w+)\s*!\s*ident\s*(?::([^}]*))?\}`)
+
+// reIdentifier is what a whitelist entry may be: a name, optionally qualified
+var reIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// IdentParam is an identifier parameter of a query
+type IdentParam struct {
+	Name    string
+	Allowed []string
+}
+
+// IdentifierError rejects the value given for an identifier parameter
+type IdentifierError struct {
+	Param   string
+	Value   interface{} // nil when the parameter is missing
+	Allowed []string
+}
+
+func (e *IdentifierError) Error() string {
+	if len(e.Allowed) == 0 {
+		return fmt.Sprintf("identifier parameter %s has no allowed values", e.Param)
+	}
+	if e.Value == nil {
+		return fmt.Sprintf("missing identifier parameter %s (one of %s)", e.Param, strings.Join(e.Allowed, ", "))
+	}
+	return fmt.Sprintf("invalid value %q for %s (one of %s)", fmt.Sprint(e.Value), e.Param, strings.Join(e.Allowed, ", "))
+}
+
+// identParam parses the submatches of reIdentParam. Entries that are not
+// plain identifiers are left out of the whitelist.
+func identParam(m []string) IdentParam {
+	ip := IdentParam{Name: m[1]}
+	for _, entry := range strings.Split(m[2], ",") {
+		if entry = strings.TrimSpace(entry); reIdentifier.MatchString(entry) {
+			ip.Allowed = append(ip.Allowed, entry)
+		}
+	}
+	return ip
+}
+
+// IdentParams lists the identifier parameters of sqlText outside comments, in
+// order of appearance, once each
+func (p *SQLParser) IdentParams(sqlText string) []IdentParam {
+	var params []IdentParam
+	seen := make(map[string]bool)
+	ctx := sqlContexts(sqlText)
+	for _, m := range reIdentParam.FindAllStringSubmatchIndex(sqlText, -1) {
+		if ctx[m[0]] == inComment {
+			continue
+		}
+		ip := identParam(submatches(sqlText, m))
+		if !seen[ip.Name] {
+			seen[ip.Name] = true
+			params = append(params, ip)
+		}
+	}
+	return params
+}
+
+// BindIdentifiers replaces the identifier parameters of sqlText with the
+// requested identifier, quoted by dialect. The value must be a string equal
+// to one of the placeholder's whitelist entries; anything else, a missing
+// value included, is an *IdentifierError and nothing is substituted.
+func (p *SQLParser) BindIdentifiers(sqlText string, values map[string]interface{}, dialect Dialect) (string, error) {
+	var bindErr error
+	bound := replaceOutsideComments(reIdentParam, sqlText, sqlContexts(sqlText), func(match string) string {
+		ip := identParam(reIdentParam.FindStringSubmatch(match))
+		value := values[ip.Name]
+		s, _ := value.(string)
+		for _, allowed := range ip.Allowed {
+			if s == allowed {
+				parts := strings.Split(allowed, ".")
+				for i, part := range parts {
+					parts[i] = dialect.QuoteIdentifier(part)
+				}
+				return strings.Join(parts, ".")
+			}
+		}
+		if bindErr == nil {
+			bindErr = &IdentifierError{Param: ip.Name, Value: value, Allowed: ip.Allowed}
+		}
+		return match
+	})
+	if bindErr != nil {
+		return "", bindErr
+	}
+	return bound, nil
+}
+
+// submatches returns the submatch strings of loc, "" for unmatched groups
+func submatches(s string, loc []int) []string {
+	m := make([]string, len(loc)/2)
+	for i := range m {
+		if loc[2*i] >= 0 {
+			m[i] = s[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	return m
+}
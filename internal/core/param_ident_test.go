@@ -0,0 +1,65 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBindIdentifiers(t *testing.T) {
+	parser := NewSQLParser()
+	sql := "SELECT * FROM {table!ident:orders, invoices, sales.orders} WHERE id = {id} -- {table!ident:x}"
+
+	tests := []struct {
+		name    string
+		value   interface{}
+		dialect Dialect
+		want    string
+	}{
+		{"allowed", "orders", PostgresDialect{}, `SELECT * FROM "orders" WHERE id = {id} -- {table!ident:x}`},
+		{"qualified", "sales.orders", MSSQLDialect{}, "SELECT * FROM [sales].[orders] WHERE id = {id} -- {table!ident:x}"},
+		{"mysql quoting", "invoices", MySQLDialect{}, "SELECT * FROM `invoices` WHERE id = {id} -- {table!ident:x}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parser.BindIdentifiers(sql, map[string]interface{}{"table": tt.value}, tt.dialect)
+			if err != nil || got != tt.want {
+				t.Errorf("BindIdentifiers() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	for _, bad := range []interface{}{
+		nil, "", "Orders", "orders ", " orders", "order", "orders2", "sales", "orders;", "invoices--",
+		`orders"; DROP TABLE users; --`, "orders]", "`orders`", `"orders"`, "orders\x00", "sales.orders.x", 1,
+		[]interface{}{"orders"},
+	} {
+		got, err := parser.BindIdentifiers(sql, map[string]interface{}{"table": bad}, PostgresDialect{})
+		var identErr *IdentifierError
+		if !errors.As(err, &identErr) || got != "" {
+			t.Errorf("BindIdentifiers(%q) = %q, %v, want an IdentifierError", bad, got, err)
+		}
+	}
+	if _, err := parser.BindIdentifiers(sql, map[string]interface{}{}, PostgresDialect{}); err == nil {
+		t.Error("missing identifier parameter was accepted")
+	}
+}
+
+func TestBindIdentifiersWhitelist(t *testing.T) {
+	parser := NewSQLParser()
+	// Without a whitelist, or with entries that are not identifiers, nothing is allowed
+	for _, sql := range []string{"SELECT * FROM {t!ident}", "SELECT * FROM {t!ident:}", `SELECT * FROM {t!ident:a b,"x",y;z}`} {
+		for _, value := range []string{"", "a b", `"x"`, "y;z"} {
+			if got, err := parser.BindIdentifiers(sql, map[string]interface{}{"t": value}, SQLiteDialect{}); err == nil {
+				t.Errorf("%s with %q = %q, want rejected", sql, value, got)
+			}
+		}
+		if res := parser.ParseWithWarnings(sql); len(res.Warnings) != 1 {
+			t.Errorf("ParseWithWarnings(%s) = %q, want a whitelist warning", sql, res.Warnings)
+		}
+	}
+
+	params := parser.IdentParams("SELECT {col!ident:id,name} FROM {t!ident:a} ORDER BY {col!ident:id,name}")
+	if len(params) != 2 || params[0].Name != "col" || len(params[0].Allowed) != 2 || params[1].Name != "t" {
+		t.Errorf("IdentParams() = %+v", params)
+	}
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Like modifiers, as in {q|contains}: the parameter binds as a LIKE pattern
+// matching values that contain, start with or end with it
+const (
+	LikeContains   = "contains"
+	LikeStartsWith = "startswith"
+	LikeEndsWith   = "endswith"
+)
+
+// LikeEscaper is implemented by dialects that can make % and _ in a value
+// match literally in LIKE without an ESCAPE clause. Elsewhere a like
+// parameter's wildcards keep their meaning (the value is still bound, never
+// spliced into the SQL).
+type LikeEscaper interface {
+	EscapeLike(s string) string
+}
+
+var (
+	backslashLikeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	bracketLikeEscaper   = strings.NewReplacer(`[`, `[[]`, `%`, `[%]`, `_`, `[_]`)
+)
+
+// likeModifier returns the modifier of a {name|modifier} token's content
+func likeModifier(content string) (name, modifier string, ok bool) {
+	name, modifier, ok = strings.Cut(content, "|")
+	modifier = strings.ToLower(strings.TrimSpace(modifier))
+	switch modifier {
+	case LikeContains, LikeStartsWith, LikeEndsWith:
+		return strings.TrimSpace(name), modifier, ok
+	}
+	return "", "", false
+}
+
+// LikePattern wraps value in the wildcards of modifier, escaping its own
+// wildcards where dialect can
+func LikePattern(value, modifier string, dialect Dialect) string {
+	if e, ok := dialect.(LikeEscaper); ok {
+		value = e.EscapeLike(value)
+	}
+	switch modifier {
+	case LikeContains:
+		return "%" + value + "%"
+	case LikeStartsWith:
+		return value + "%"
+	case LikeEndsWith:
+		return "%" + value
+	}
+	return value
+}
+
+// BindLikeValues returns values with the like parameters of r turned into
+// their LIKE patterns for dialect, to pass to MapValues. values itself is
+// left as it is; null stays null.
+func (r *ParseResult) BindLikeValues(values map[string]interface{}, dialect Dialect) map[string]interface{} {
+	if len(r.LikeParams) == 0 {
+		return values
+	}
+	bound := make(map[string]interface{}, len(values))
+	for name, v := range values {
+		bound[name] = v
+	}
+	for name, modifier := range r.LikeParams {
+		if v, ok := values[name]; ok && v != nil {
+			bound[name] = LikePattern(fmt.Sprint(v), modifier, dialect)
+		}
+	}
+	return bound
+}
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ReservedParams are request body names the executor uses itself, so a SQL
+// parameter of the same name can't be set independently
+var ReservedParams = []string{"page", "per_page", "order_by", "order_direction"}
+
+var reColonPlaceholder = regexp.MustCompile(`(^|[^:\w]):([A-Za-z_]\w*)`)
+
+// ParseWithWarnings parses sqlText like Parse without values and also
+// reports what is likely a mistake: parameters inside string literals (they
+// are still replaced) or comments (they are ignored), braces that don't form a
+// parameter, identifier parameters without a usable whitelist, reserved
+// parameter names, an unpaired {select} block and :name style
+// placeholders that are sent to the database as is.
+func (p *SQLParser) ParseWithWarnings(sqlText string) *ParseResult {
+	res := p.Parse(sqlText, nil)
+	ctx := sqlContexts(sqlText)
+	line := func(pos int) int { return strings.Count(sqlText[:pos], "\n") + 1 }
+	warn := func(pos int, format string, args ...interface{}) {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("line %d: ", line(pos))+fmt.Sprintf(format, args...))
+	}
+
+	matched := make([]bool, len(sqlText))
+	reserved := make(map[string]bool, len(ReservedParams))
+	for _, name := range ReservedParams {
+		reserved[name] = true
+	}
+	for _, m := range p.regex.FindAllStringIndex(sqlText, -1) {
+		for i := m[0]; i < m[1]; i++ {
+			matched[i] = true
+		}
+		token := sqlText[m[0]:m[1]]
+		name := paramName(token)
+		switch {
+		case ctx[m[0]] == inString || ctx[m[0]] == inQuotedIdent:
+			warn(m[0], "%s is inside a quoted string but is still replaced by a parameter", token)
+		case ctx[m[0]] == inComment:
+			warn(m[0], "%s is inside a comment and is ignored", token)
+		case name == "":
+			warn(m[0], "empty %s is replaced by a parameter without a name", token)
+		case systemVars[strings.ToLower(name)]:
+			// expanded by the executor
+		case reserved[strings.ToLower(name)]:
+			warn(m[0], "%s uses the reserved name %s, which the request body sets for pagination or sorting", token, name)
+		}
+	}
+
+	for _, m := range reIdentParam.FindAllStringSubmatchIndex(sqlText, -1) {
+		for i := m[0]; i < m[1]; i++ {
+			matched[i] = true
+		}
+		if ctx[m[0]] == inComment {
+			continue
+		}
+		sm := submatches(sqlText, m)
+		ip := identParam(sm)
+		entries := 0
+		for _, e := range strings.Split(sm[2], ",") {
+			if strings.TrimSpace(e) != "" {
+				entries++
+			}
+		}
+		switch {
+		case len(ip.Allowed) == 0:
+			warn(m[0], "%s has no allowed identifiers, so every request is rejected", sm[0])
+		case len(ip.Allowed) < entries:
+			warn(m[0], "%s lists entries that are not plain identifiers; they are never allowed", sm[0])
+		}
+	}
+
+	// Braces in code that are not part of a parameter
+	for i := 0; i < len(sqlText); i++ {
+		if matched[i] || ctx[i] != inCode {
+			continue
+		}
+		switch sqlText[i] {
+		case '{':
+			end := strings.IndexAny(sqlText[i+1:], "{}")
+			if end < 0 || sqlText[i+1+end] == '{' {
+				warn(i, "'{' is never closed")
+				continue
+			}
+			warn(i, "%s is not a valid parameter and is sent to the database as is", sqlText[i:i+1+end+1])
+			i += end + 1
+		case '}':
+			warn(i, "'}' has no opening '{'")
+		}
+	}
+
+	hasSelect, hasEnd := false, false
+	for _, v := range res.SystemVars {
+		hasSelect = hasSelect || v == "select"
+		hasEnd = hasEnd || v == "endselect"
+	}
+	if hasSelect != hasEnd {
+		res.Warnings = append(res.Warnings, "{select} and {endselect} must be used together")
+	}
+
+	for _, m := range reColonPlaceholder.FindAllStringSubmatchIndex(sqlText, -1) {
+		pos := m[4] - 1 // the colon
+		if ctx[pos] == inCode && !matched[pos] {
+			warn(pos, ":%s looks like a placeholder; DbBridge parameters are written {%s}", sqlText[m[4]:m[5]], sqlText[m[4]:m[5]])
+		}
+	}
+	return res
+}
+
+// systemVars are the {...} variables the executor expands itself
+var systemVars = map[string]bool{"select": true, "endselect": true, "order_by": true, "pagination": true}
+
+// systemVarsIn lists the system variables sqlText uses outside comments, once
+// each
+func (p *SQLParser) systemVarsIn(sqlText string) []string {
+	var vars []string
+	seen := make(map[string]bool)
+	ctx := sqlContexts(sqlText)
+	for _, m := range p.regex.FindAllStringIndex(sqlText, -1) {
+		if ctx[m[0]] == inComment {
+			continue
+		}
+		name := strings.ToLower(paramName(sqlText[m[0]:m[1]]))
+		if systemVars[name] && !seen[name] {
+			seen[name] = true
+			vars = append(vars, name)
+		}
+	}
+	return vars
+}
+
+// paramName returns the parameter name of a {...} token, without default,
+// raw| prefix or like modifier
+func paramName(token string) string {
+	content := strings.TrimSpace(token[1 : len(token)-1])
+	content = strings.TrimPrefix(content, "raw|")
+	if name, _, ok := likeModifier(content); ok {
+		return name
+	}
+	if i := strings.Index(content, ":"); i >= 0 {
+		content = content[:i]
+	}
+	return strings.TrimSpace(content)
+}
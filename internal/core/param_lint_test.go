@@ -0,0 +1,49 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWithWarnings(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string // substrings of the warnings, in order; none = clean
+	}{
+		{"clean", "SELECT {pagination::20} {select}id, name{endselect} FROM t WHERE id = {id} {order_by:name(id,name):desc}", nil},
+		{"braces in a string literal", `SELECT * FROM t WHERE doc = '{"a": 1}' AND note <> 'it''s {}' AND id = {id}`, []string{"{} is inside a quoted string"}},
+		{"json object literal", `SELECT json_extract('{"k": "v"}', '$.k')`, nil},
+		{"parameter in a string", "SELECT * FROM t WHERE name LIKE '%{name}%'", []string{"line 1: {name} is inside a quoted string"}},
+		{"parameter in comments", "SELECT *\n-- WHERE id = {id}\nFROM t /* {x} */", []string{"line 2: {id} is inside a comment", "line 3: {x} is inside a comment"}},
+		{"unclosed brace", "SELECT * FROM t WHERE id = {id", []string{"line 1: '{' is never closed"}},
+		{"stray brace", "SELECT * FROM t WHERE id = id}", []string{"'}' has no opening '{'"}},
+		{"not a parameter", "SELECT * FROM t WHERE id = {customer-id}", []string{"{customer-id} is not a valid parameter"}},
+		{"empty braces", "SELECT {} FROM t", []string{"empty {}"}},
+		{"reserved name", "SELECT * FROM t LIMIT {per_page}", []string{"reserved name per_page"}},
+		{"unpaired select", "SELECT {select}id FROM t", []string{"{select} and {endselect}"}},
+		{"identifier parameter", "SELECT * FROM {t!ident:orders,invoices}", nil},
+		{"colon placeholder", "SELECT * FROM t WHERE id = :id AND x::int = 1 AND t = '10:30'", []string{":id looks like a placeholder"}},
+	}
+	p := NewSQLParser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := p.ParseWithWarnings(tt.sql)
+			if len(res.Warnings) != len(tt.want) {
+				t.Fatalf("warnings = %q, want %d", res.Warnings, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(res.Warnings[i], want) {
+					t.Errorf("warning %d = %q, want %q", i, res.Warnings[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSystemVars(t *testing.T) {
+	res := NewSQLParser().Parse("SELECT {pagination} {select}id{endselect} FROM t {order_by:id} {pagination}", nil)
+	if got := strings.Join(res.SystemVars, ","); got != "pagination,select,endselect,order_by" {
+		t.Errorf("SystemVars = %s", got)
+	}
+}
@@ -7,33 +7,44 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // SQLParser handles parsing of named parameters {var} to positional parameters ?
 type SQLParser struct {
 	regex *regexp.Regexp
+	now   func() time.Time // clock of date macros, in the result timezone
 }
 
 func NewSQLParser() *SQLParser {
 	return &SQLParser{
-		regex: regexp.MustCompile(`\{\s*(?:raw\|(\w+)|(\w+)(?::raw\|([^}]+))?|(\w+):([^}]+))?\s*\}`),
+		now:   time.Now,
+		regex: regexp.MustCompile(`\{\s*(?:(_key\.\w+)|((?:now|today|start_of_(?:week|month|year))\s*[+-]\s*\d+\s*[hdwmy])|raw\|(\w+)|(\w+)\s*\|\s*(?i:contains|startswith|endswith)|(\w+)(?::raw\|([^}]+))?|(\w+):([^}]*))?\s*\}`),
 	}
 }
 
+// NullDefault is the default that binds SQL NULL when the parameter is absent,
+// as in {deleted_at:null}
+const NullDefault = "null"
+
 // ParseResult contains the transformed SQL, the list of parameter names, and default values
 type ParseResult struct {
 	SQL         string
 	ParamNames  []string
-	Defaults    map[string]interface{}
+	Defaults    map[string]interface{} // nil for NullDefault, "" for {param:}, a DateMacro for date macros
 	RawDefaults map[string]string
+	LikeParams  map[string]string // like modifier by parameter name, see BindLikeValues
+	SystemVars  []string          // system variables used, e.g. "pagination", in order of appearance
+	Warnings    []string          // likely mistakes, only filled by ParseWithWarnings
 }
 
 // Parse takes SQL text and optional values. If values are provided, it detects arrays/slices
-// and expands placeholders (? -> ?, ?, ?) accordingly.
+// and expands placeholders (? -> ?, ?, ?) accordingly. Placeholders inside comments are ignored.
 func (p *SQLParser) Parse(sqlText string, values map[string]interface{}) *ParseResult {
 	paramNames := []string{}
 	defaults := make(map[string]interface{})
 	rawDefaults := make(map[string]string)
+	likeParams := make(map[string]string)
 
 	// System variables to exclude from parameter parsing
 	systemVars := map[string]bool{
@@ -44,12 +55,19 @@ func (p *SQLParser) Parse(sqlText string, values map[string]interface{}) *ParseR
 	}
 
 	// Replace all occurrences of {var} or {var:default} with ?
-	transformedSQL := p.regex.ReplaceAllStringFunc(sqlText, func(match string) string {
+	transformedSQL := replaceOutsideComments(p.regex, sqlText, sqlContexts(sqlText), func(match string) string {
 		// match is like "{id}", "{status:active}", "{raw|param}", or "{param:raw|default}"
 		// Remove { and }
 		content := match[1 : len(match)-1]
 
 		// Check which pattern matched
+		// Pattern 0: param|contains, param|startswith, param|endswith - bound as a LIKE pattern
+		if paramName, modifier, ok := likeModifier(content); ok && !strings.HasPrefix(content, "raw|") {
+			likeParams[paramName] = modifier
+			paramNames = append(paramNames, paramName)
+			return "?"
+		}
+
 		// Pattern 1: raw|param
 		if strings.HasPrefix(content, "raw|") {
 			paramName := strings.TrimSpace(strings.TrimPrefix(content, "raw|"))
@@ -59,6 +77,9 @@ func (p *SQLParser) Parse(sqlText string, values map[string]interface{}) *ParseR
 			// {raw|param} - replace langsung dengan value (tanpa placeholder)
 			if values != nil {
 				if val, ok := values[paramName]; ok {
+					if val == nil {
+						return "NULL"
+					}
 					return fmt.Sprintf("%v", val)
 				}
 			}
@@ -101,7 +122,13 @@ func (p *SQLParser) Parse(sqlText string, values map[string]interface{}) *ParseR
 				return match
 			}
 
-			defaults[paramName] = defVal
+			if strings.EqualFold(defVal, NullDefault) {
+				defaults[paramName] = nil
+			} else if macro, ok := ParseDateMacro(defVal); ok {
+				defaults[paramName] = macro
+			} else {
+				defaults[paramName] = defVal
+			}
 
 			// Array Expansion Logic
 			if values != nil {
@@ -151,6 +178,13 @@ func (p *SQLParser) Parse(sqlText string, values map[string]interface{}) *ParseR
 			return match
 		}
 
+		// Pattern 5: {today-7d} - a date macro, bound by MapValues whatever the request says
+		if macro, ok := ParseDateMacro(paramName); ok {
+			defaults[paramName] = macro
+			paramNames = append(paramNames, paramName)
+			return "?"
+		}
+
 		// Array Expansion Logic
 		if values != nil {
 			if val, ok := values[paramName]; ok {
@@ -198,10 +232,16 @@ func (p *SQLParser) Parse(sqlText string, values map[string]interface{}) *ParseR
 		ParamNames:  paramNames,
 		Defaults:    defaults,
 		RawDefaults: rawDefaults,
+		LikeParams:  likeParams,
+		SystemVars:  p.systemVarsIn(sqlText),
 	}
 }
 
-// MapValues takes param names, values, defaults, and raw defaults to build argument list
+// MapValues takes param names, values, defaults, and raw defaults to build argument list.
+// A value that is present binds as is, so JSON null binds NULL and "" an empty string;
+// an absent one takes its default, where a nil default (NullDefault) binds NULL
+// and a DateMacro binds its value now. A date macro used as a placeholder of
+// its own always binds its value.
 func (p *SQLParser) MapValues(paramNames []string, values map[string]interface{}, defaults map[string]interface{}, rawDefaults map[string]string) ([]interface{}, error) {
 	result := []interface{}{}
 	missing := []string{}
@@ -240,10 +280,18 @@ func (p *SQLParser) MapValues(paramNames []string, values map[string]interface{}
 			}
 		}
 
+		if macro, ok := defaults[name].(DateMacro); ok && string(macro) == name {
+			result = append(result, macro.Eval(p.now()))
+			continue
+		}
+
 		val, ok := values[name]
 		if !ok {
 			// Try default
 			if def, hasDef := defaults[name]; hasDef {
+				if macro, ok := def.(DateMacro); ok {
+					def = macro.Eval(p.now())
+				}
 				result = append(result, def)
 				continue
 			}
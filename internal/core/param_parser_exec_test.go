@@ -0,0 +1,69 @@
+package core_test
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/testutil"
+	"fmt"
+	"testing"
+)
+
+// The parsed SQL and bound values run on SQLite, so a placeholder count that
+// disagrees with the values fails here rather than only in a string compare
+func TestParseExecutes(t *testing.T) {
+	db := testutil.OpenDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT, status TEXT, note TEXT)`,
+		`INSERT INTO items VALUES (1, 'apple', 'open', NULL), (2, 'banana', 'closed', 'x'), (3, 'cherry', 'open', '')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		sql    string
+		values map[string]interface{}
+		want   string // ids as fmt %v
+	}{
+		{"bound value", "SELECT id FROM items WHERE status = {status}",
+			map[string]interface{}{"status": "closed"}, "[2]"},
+		{"default", "SELECT id FROM items WHERE status = {status:open}", nil, "[1 3]"},
+		{"array expanded", "SELECT id FROM items WHERE id IN ({ids})",
+			map[string]interface{}{"ids": []interface{}{1, 3}}, "[1 3]"},
+		{"repeated parameter", "SELECT id FROM items WHERE name = {n} OR note = {n}",
+			map[string]interface{}{"n": "x"}, "[2]"},
+		{"null default", "SELECT id FROM items WHERE note IS {note:null}", nil, "[1]"},
+		{"raw default", "SELECT id FROM items ORDER BY {order:raw|id DESC}", nil, "[3 2 1]"},
+		{"placeholder in comment", "SELECT id FROM items -- {ignored}\nWHERE id = {id}",
+			map[string]interface{}{"id": 2}, "[2]"},
+		{"contains", "SELECT id FROM items WHERE name LIKE {q|contains}",
+			map[string]interface{}{"q": "an"}, "[2]"},
+	}
+	parser := core.NewSQLParser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := parser.Parse(tt.sql, tt.values)
+			args, err := parser.MapValues(res.ParamNames, res.BindLikeValues(tt.values, core.SQLiteDialect{}), res.Defaults, res.RawDefaults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows, err := db.Query(res.SQL, args...)
+			if err != nil {
+				t.Fatalf("%s %v: %v", res.SQL, args, err)
+			}
+			defer rows.Close()
+			ids := []int64{}
+			for rows.Next() {
+				var id int64
+				if err := rows.Scan(&id); err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, id)
+			}
+			if got := fmt.Sprintf("%v", ids); got != tt.want {
+				t.Errorf("%s %v = %s, want %s", res.SQL, args, got, tt.want)
+			}
+		})
+	}
+}
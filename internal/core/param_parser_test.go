@@ -0,0 +1,88 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapValuesNullAndEmpty(t *testing.T) {
+	absent := struct{}{}
+	tests := []struct {
+		name  string
+		sql   string
+		value interface{} // absent = not in the body
+		want  interface{}
+		err   bool
+	}{
+		{"required absent", "{p}", absent, nil, true},
+		{"required null", "{p}", nil, nil, false},
+		{"required empty", "{p}", "", "", false},
+		{"required value", "{p}", "x", "x", false},
+		{"defaulted absent", "{p:open}", absent, "open", false},
+		{"defaulted null", "{p:open}", nil, nil, false},
+		{"defaulted empty", "{p:open}", "", "", false},
+		{"empty default absent", "{p:}", absent, "", false},
+		{"empty default null", "{p:}", nil, nil, false},
+		{"null default absent", "{p:null}", absent, nil, false},
+		{"null default keyword is case-insensitive", "{p:NULL}", absent, nil, false},
+		{"null default empty", "{p:null}", "", "", false},
+		{"null default value", "{p:null}", "x", "x", false},
+	}
+	parser := NewSQLParser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := map[string]interface{}{}
+			if tt.value != absent {
+				values["p"] = tt.value
+			}
+			res := parser.Parse("SELECT * FROM t WHERE c = "+tt.sql, values)
+			if res.SQL != "SELECT * FROM t WHERE c = ?" {
+				t.Fatalf("SQL = %q", res.SQL)
+			}
+			args, err := parser.MapValues(res.ParamNames, values, res.Defaults, res.RawDefaults)
+			if tt.err {
+				if err == nil {
+					t.Errorf("MapValues() = %#v, want a missing parameter error", args)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(args, []interface{}{tt.want}) {
+				t.Errorf("MapValues() = %#v, %v, want [%#v]", args, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRawNull(t *testing.T) {
+	res := NewSQLParser().Parse("SELECT * FROM t WHERE c IS {raw|p}", map[string]interface{}{"p": nil})
+	if res.SQL != "SELECT * FROM t WHERE c IS NULL" {
+		t.Errorf("SQL = %q", res.SQL)
+	}
+}
+
+func TestLikeModifiers(t *testing.T) {
+	parser := NewSQLParser()
+	res := parser.Parse("SELECT * FROM t WHERE name LIKE {q|contains} AND code LIKE { c | StartsWith } AND x LIKE {e|endswith}", nil)
+	if res.SQL != "SELECT * FROM t WHERE name LIKE ? AND code LIKE ? AND x LIKE ?" {
+		t.Fatalf("SQL = %q", res.SQL)
+	}
+	values := map[string]interface{}{"q": `50%_off\`, "c": 7, "e": "x"}
+	tests := []struct {
+		dialect Dialect
+		want    []interface{}
+	}{
+		{PostgresDialect{}, []interface{}{`%50\%\_off\\%`, "7%", "%x"}},
+		{MySQLDialect{}, []interface{}{`%50\%\_off\\%`, "7%", "%x"}},
+		{MSSQLDialect{}, []interface{}{`%50[%][_]off\%`, "7%", "%x"}},
+		{SQLiteDialect{}, []interface{}{`%50%_off\%`, "7%", "%x"}}, // no default escape character
+	}
+	for _, tt := range tests {
+		args, err := parser.MapValues(res.ParamNames, res.BindLikeValues(values, tt.dialect), res.Defaults, res.RawDefaults)
+		if err != nil || !reflect.DeepEqual(args, tt.want) {
+			t.Errorf("%s: args = %q, %v, want %q", tt.dialect.Name(), args, err, tt.want)
+		}
+	}
+	if values["q"] != `50%_off\` {
+		t.Errorf("BindLikeValues changed the request values: %v", values)
+	}
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"strings"
+)
+
+// schemaToken is a token of SQL text as seen by SchemaRefs
+type schemaToken struct {
+	text  string // identifier with quotes removed, or the punctuation
+	ident bool
+}
+
+// tableKeywords are followed by a table reference
+var tableKeywords = map[string]bool{"FROM": true, "JOIN": true, "INTO": true, "UPDATE": true, "TABLE": true, "APPLY": true}
+
+// clauseKeywords can't be a table alias
+var clauseKeywords = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "CROSS": true,
+	"OUTER": true, "NATURAL": true, "ON": true, "USING": true, "GROUP": true, "ORDER": true, "HAVING": true,
+	"LIMIT": true, "OFFSET": true, "FETCH": true, "UNION": true, "EXCEPT": true, "INTERSECT": true,
+	"MINUS": true, "WINDOW": true, "SET": true, "VALUES": true, "SELECT": true, "WITH": true, "FOR": true,
+	"RETURNING": true, "PIVOT": true, "UNPIVOT": true, "APPLY": true, "OUTPUT": true, "WHEN": true,
+}
+
+// schemaTokens splits sqlText into identifiers ("quoted", [bracketed] and
+// `backticked` ones included) and punctuation, skipping comments, string
+// literals and whitespace
+func schemaTokens(sqlText string) []schemaToken {
+	ctx := sqlContexts(sqlText)
+	var tokens []schemaToken
+	for i := 0; i < len(sqlText); {
+		c := sqlText[i]
+		switch {
+		case ctx[i] == inComment || ctx[i] == inString:
+			i++
+		case ctx[i] == inQuotedIdent:
+			start := i
+			for i < len(sqlText) && ctx[i] == inQuotedIdent {
+				i++
+			}
+			name := strings.TrimSuffix(sqlText[start+1:i], `"`)
+			tokens = append(tokens, schemaToken{text: strings.ReplaceAll(name, `""`, `"`), ident: true})
+		case c == '[' || c == '`':
+			closing := byte(']')
+			if c == '`' {
+				closing = '`'
+			}
+			end := strings.IndexByte(sqlText[i+1:], closing)
+			if end < 0 {
+				end = len(sqlText) - i - 1
+			}
+			tokens = append(tokens, schemaToken{text: sqlText[i+1 : i+1+end], ident: true})
+			i += end + 2
+		case isIdentByte(c):
+			start := i
+			for i < len(sqlText) && isIdentByte(sqlText[i]) && ctx[i] == inCode {
+				i++
+			}
+			tokens = append(tokens, schemaToken{text: sqlText[start:i], ident: true})
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		default:
+			tokens = append(tokens, schemaToken{text: string(c)})
+			i++
+		}
+	}
+	return tokens
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c == '#' || c == '@' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// SchemaRefs lists the qualifiers of the schema-qualified table references in
+// sqlText, e.g. "hr" for FROM hr.employees and "erp.dbo" for JOIN
+// erp.dbo.items, once each in order of appearance. It is a heuristic: tables
+// are found after FROM, JOIN, INTO, UPDATE, TABLE and APPLY and in comma
+// separated FROM lists; names built by dynamic SQL or called as functions in
+// the select list are not seen.
+func SchemaRefs(sqlText string) []string {
+	tokens := schemaTokens(sqlText)
+	var refs []string
+	seen := make(map[string]bool)
+	// query[d] is whether the parentheses at depth d hold a query rather than
+	// function arguments, as in EXTRACT(YEAR FROM d)
+	query := []bool{true}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.text == "(":
+			next := ""
+			if i+1 < len(tokens) {
+				next = strings.ToUpper(tokens[i+1].text)
+			}
+			query = append(query, next == "SELECT" || next == "WITH" || next == "VALUES")
+			continue
+		case t.text == ")":
+			if len(query) > 1 {
+				query = query[:len(query)-1]
+			}
+			continue
+		}
+		keyword := strings.ToUpper(t.text)
+		if !t.ident || !tableKeywords[keyword] || !query[len(query)-1] {
+			continue
+		}
+		if keyword == "FROM" && i > 0 && strings.EqualFold(tokens[i-1].text, "DISTINCT") {
+			continue // IS DISTINCT FROM
+		}
+
+		j := i + 1
+		for {
+			parts, n := qualifiedName(tokens[j:])
+			if n == 0 {
+				break
+			}
+			if len(parts) > 1 {
+				q := strings.Join(parts[:len(parts)-1], ".")
+				if !seen[strings.ToLower(q)] {
+					seen[strings.ToLower(q)] = true
+					refs = append(refs, q)
+				}
+			}
+			j += n
+			if keyword != "FROM" {
+				break
+			}
+			// [AS] alias, then another table after a comma
+			if j < len(tokens) && strings.EqualFold(tokens[j].text, "AS") {
+				j++
+			}
+			if j < len(tokens) && tokens[j].ident && !clauseKeywords[strings.ToUpper(tokens[j].text)] {
+				j++
+			}
+			if j >= len(tokens) || tokens[j].text != "," {
+				break
+			}
+			j++
+		}
+		i = j - 1
+	}
+	return refs
+}
+
+// qualifiedName reads a dotted name at the start of tokens and returns its
+// parts and the tokens it took, 0 when tokens don't start with a name
+func qualifiedName(tokens []schemaToken) ([]string, int) {
+	if len(tokens) == 0 || !tokens[0].ident {
+		return nil, 0
+	}
+	parts := []string{tokens[0].text}
+	n := 1
+	for n < len(tokens) && tokens[n].text == "." {
+		n++
+		if n < len(tokens) && tokens[n].ident {
+			parts = append(parts, tokens[n].text)
+			n++
+		} else {
+			parts = append(parts, "") // db..table
+		}
+	}
+	return parts, n
+}
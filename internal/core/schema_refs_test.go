@@ -0,0 +1,33 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaRefs(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{"unqualified", "SELECT * FROM orders o JOIN items i ON i.order_id = o.id", nil},
+		{"join", "SELECT * FROM sales.orders o JOIN hr.employees e ON e.id = o.rep_id", []string{"sales", "hr"}},
+		{"comma list", "SELECT * FROM sales.orders AS o, hr.employees e, items WHERE 1 = 1", []string{"sales", "hr"}},
+		{"quoted names", `SELECT * FROM "Sales"."Orders" JOIN [hr].[people] ON 1 = 1 JOIN ` + "`crm`.`leads`" + ` ON 1 = 1`, []string{"Sales", "hr", "crm"}},
+		{"three-part name", "SELECT * FROM erp.dbo.items", []string{"erp.dbo"}},
+		{"once each", "SELECT * FROM hr.a JOIN HR.b ON 1 = 1", []string{"hr"}},
+		{"subquery", "SELECT * FROM (SELECT id FROM audit.log) l", []string{"audit"}},
+		{"function arguments", "SELECT EXTRACT(YEAR FROM o.created_at) FROM orders o", nil},
+		{"is distinct from", "SELECT * FROM t WHERE t.a IS DISTINCT FROM t.b", nil},
+		{"dml", "INSERT INTO arch.orders SELECT * FROM orders; UPDATE arch.stats SET n = 1", []string{"arch"}},
+		{"comments and strings", "SELECT 'FROM hr.x' FROM t -- JOIN hr.y\n/* FROM hr.z */", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SchemaRefs(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SchemaRefs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"net/url"
+	"strings"
+)
+
+// maxSessionTag fits PostgreSQL's application_name, the shortest limit of
+// the supported engines
+const maxSessionTag = 63
+
+// SanitizeSessionTag keeps letters, digits and _ . / : @ - of tag, replacing
+// anything else with _, so it can be put in connection strings and SQL
+// literals without quoting
+func SanitizeSessionTag(tag string) string {
+	var b strings.Builder
+	for _, r := range tag {
+		if b.Len() == maxSessionTag {
+			break
+		}
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("_./:@-", r):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// withDSNOption sets key=value in a URL connection string's query, or
+// appends it to a key=value connection string whose items are separated by
+// sep. A string that sets key already is returned as is.
+func withDSNOption(dsn, key, value, sep string) string {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return dsn
+		}
+		q := u.Query()
+		for k := range q {
+			if strings.EqualFold(k, key) {
+				return dsn
+			}
+		}
+		q.Set(key, value)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+
+	for _, item := range strings.Split(dsn, sep) {
+		k, _, _ := strings.Cut(item, "=")
+		if strings.EqualFold(strings.TrimSpace(k), key) {
+			return dsn
+		}
+	}
+	if dsn = strings.TrimRight(dsn, sep+" "); dsn == "" {
+		return key + "=" + value
+	}
+	return dsn + sep + key + "=" + value
+}
@@ -0,0 +1,208 @@
+package core
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sqlContext is what a byte of SQL text is part of
+type sqlContext uint8
+
+const (
+	inCode sqlContext = iota
+	inString
+	inQuotedIdent
+	inComment
+)
+
+// sqlContexts marks each byte of sqlText as code, a '...' string literal, a
+// "..." quoted identifier or a -- or /* */ comment. Block comments nest, as in
+// PostgreSQL and SQL Server; quotes inside comments don't open a string.
+func sqlContexts(sqlText string) []sqlContext {
+	ctx := make([]sqlContext, len(sqlText))
+	for i := 0; i < len(sqlText); {
+		c := sqlText[i]
+		switch {
+		case c == '\'' || c == '"':
+			kind := inString
+			if c == '"' {
+				kind = inQuotedIdent
+			}
+			ctx[i] = kind
+			i++
+			for i < len(sqlText) {
+				ctx[i] = kind
+				if sqlText[i] == c {
+					// A doubled quote is an escaped one
+					if i+1 < len(sqlText) && sqlText[i+1] == c {
+						ctx[i+1] = kind
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+		case strings.HasPrefix(sqlText[i:], "--"):
+			for i < len(sqlText) && sqlText[i] != '\n' {
+				ctx[i] = inComment
+				i++
+			}
+		case strings.HasPrefix(sqlText[i:], "/*"):
+			depth := 0
+			for i < len(sqlText) {
+				switch {
+				case strings.HasPrefix(sqlText[i:], "/*"):
+					depth++
+				case strings.HasPrefix(sqlText[i:], "*/"):
+					depth--
+				default:
+					ctx[i] = inComment
+					i++
+					continue
+				}
+				ctx[i], ctx[i+1] = inComment, inComment
+				i += 2
+				if depth == 0 {
+					break
+				}
+			}
+		default:
+			ctx[i] = inCode
+			i++
+		}
+	}
+	return ctx
+}
+
+// replaceOutsideComments is re.ReplaceAllStringFunc leaving the matches that
+// start inside a comment as they are
+func replaceOutsideComments(re *regexp.Regexp, sqlText string, ctx []sqlContext, repl func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringIndex(sqlText, -1) {
+		if ctx[m[0]] == inComment {
+			continue
+		}
+		b.WriteString(sqlText[last:m[0]])
+		b.WriteString(repl(sqlText[m[0]:m[1]]))
+		last = m[1]
+	}
+	b.WriteString(sqlText[last:])
+	return b.String()
+}
+
+// SQLComments are the comments cut out of SQL text by CutComments, in order
+type SQLComments []string
+
+// reCommentMarker matches the markers CutComments leaves; NUL doesn't occur in
+// SQL text, so they can't clash with anything a query contains
+var reCommentMarker = regexp.MustCompile("\x00([0-9]+)\x00")
+
+// CutComments replaces each comment in sqlText with a marker, so that braces,
+// placeholders and semicolons inside comments are left alone by the text
+// processing that follows. Restore or Strip turns the markers back.
+func CutComments(sqlText string) (string, SQLComments) {
+	ctx := sqlContexts(sqlText)
+	var b strings.Builder
+	var comments SQLComments
+	for i := 0; i < len(sqlText); {
+		if ctx[i] != inComment {
+			b.WriteByte(sqlText[i])
+			i++
+			continue
+		}
+		start := i
+		for i < len(sqlText) && ctx[i] == inComment {
+			i++
+		}
+		b.WriteString("\x00" + strconv.Itoa(len(comments)) + "\x00")
+		comments = append(comments, sqlText[start:i])
+	}
+	return b.String(), comments
+}
+
+// Restore puts the comments back into the markers of sqlText
+func (c SQLComments) Restore(sqlText string) string {
+	return reCommentMarker.ReplaceAllStringFunc(sqlText, func(m string) string {
+		n, _ := strconv.Atoi(m[1 : len(m)-1])
+		if n < len(c) {
+			return c[n]
+		}
+		return ""
+	})
+}
+
+// Strip drops the markers of sqlText. A block comment becomes a space so the
+// words around it stay apart; a line comment keeps its line break.
+func (c SQLComments) Strip(sqlText string) string {
+	return reCommentMarker.ReplaceAllStringFunc(sqlText, func(m string) string {
+		n, _ := strconv.Atoi(m[1 : len(m)-1])
+		if n < len(c) && strings.HasPrefix(c[n], "--") {
+			return ""
+		}
+		return " "
+	})
+}
+
+// StripComments removes the -- and /* */ comments from sqlText, leaving string
+// literals and quoted identifiers as they are
+func StripComments(sqlText string) string {
+	cut, comments := CutComments(sqlText)
+	return comments.Strip(cut)
+}
+
+// SplitStatements splits sqlText into statements at the semicolons outside
+// string literals, quoted identifiers and comments. Statements are trimmed;
+// empty ones are left out.
+func SplitStatements(sqlText string) []string {
+	ctx := sqlContexts(sqlText)
+	var stmts []string
+	add := func(s string) {
+		if s = strings.TrimSpace(s); s != "" && strings.TrimSpace(StripComments(s)) != "" {
+			stmts = append(stmts, s)
+		}
+	}
+	start := 0
+	for i := 0; i < len(sqlText); i++ {
+		if sqlText[i] == ';' && ctx[i] == inCode {
+			add(sqlText[start:i])
+			start = i + 1
+		}
+	}
+	add(sqlText[start:])
+	return stmts
+}
+
+// reFirstKeyword finds the keyword a statement starts with
+var reFirstKeyword = regexp.MustCompile(`^[\s(]*([A-Za-z]+)`)
+
+// reWriteClause finds a data-changing clause inside a WITH statement
+var reWriteClause = regexp.MustCompile(`(?i)\b(INSERT|UPDATE|DELETE|MERGE)\b`)
+
+// writeKeywords start statements that change data or call procedures
+var writeKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "REPLACE": true, "UPSERT": true,
+	"CALL": true, "EXEC": true, "EXECUTE": true, "BEGIN": true, "DECLARE": true,
+	"CREATE": true, "ALTER": true, "DROP": true, "TRUNCATE": true,
+}
+
+// IsWriteSQL reports whether a statement of sqlText changes data or calls a
+// procedure, as opposed to only reading. A WITH statement counts as a write
+// when its code has an INSERT, UPDATE, DELETE or MERGE clause.
+func IsWriteSQL(sqlText string) bool {
+	for _, stmt := range SplitStatements(sqlText) {
+		code := StripComments(stmt)
+		m := reFirstKeyword.FindStringSubmatch(code)
+		if m == nil {
+			continue
+		}
+		keyword := strings.ToUpper(m[1])
+		if writeKeywords[keyword] || keyword == "WITH" && reWriteClause.MatchString(code) {
+			return true
+		}
+	}
+	return false
+}
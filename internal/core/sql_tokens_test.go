@@ -0,0 +1,74 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name, sql, want string
+	}{
+		{"line comment", "SELECT 1 -- one\nFROM t", "SELECT 1 \nFROM t"},
+		{"block comment", "SELECT/* cols */a FROM t", "SELECT a FROM t"},
+		{"nested block comments", "SELECT /* outer /* inner */ still outer */ 1", "SELECT   1"},
+		{"quote inside comment", "SELECT 1 -- it's {id}\nFROM t WHERE a = 'x'", "SELECT 1 \nFROM t WHERE a = 'x'"},
+		{"comment markers in strings", `SELECT '-- no', "/* col */" FROM t`, `SELECT '-- no', "/* col */" FROM t`},
+		{"unclosed block comment", "SELECT 1 /* {x}", "SELECT 1  "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripComments(tt.sql); got != tt.want {
+				t.Errorf("StripComments() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCutCommentsRestore(t *testing.T) {
+	sql := "SELECT /*+ INDEX(t) */ a -- {pagination}\nFROM t /* a /* b */ c */ WHERE x = '/*'"
+	cut, comments := CutComments(sql)
+	if len(comments) != 3 {
+		t.Fatalf("comments = %q", comments)
+	}
+	if got := comments.Restore(cut); got != sql {
+		t.Errorf("Restore() = %q, want %q", got, sql)
+	}
+}
+
+func TestParseIgnoresComments(t *testing.T) {
+	res := NewSQLParser().Parse("SELECT * FROM t -- WHERE id = {id}\nWHERE /* {a} /* {b} */ {c} */ name = {name}", nil)
+	if !reflect.DeepEqual(res.ParamNames, []string{"name"}) {
+		t.Errorf("ParamNames = %q, want [name]", res.ParamNames)
+	}
+	want := "SELECT * FROM t -- WHERE id = {id}\nWHERE /* {a} /* {b} */ {c} */ name = ?"
+	if res.SQL != want {
+		t.Errorf("SQL = %q, want %q", res.SQL, want)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	sql := "INSERT INTO t VALUES ('a;b'); -- done; really\nSELECT 1 /* ; */;\n;\n-- trailing note"
+	want := []string{"INSERT INTO t VALUES ('a;b')", "-- done; really\nSELECT 1 /* ; */"}
+	if got := SplitStatements(sql); !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitStatements() = %q, want %q", got, want)
+	}
+}
+
+func TestIsWriteSQL(t *testing.T) {
+	for sql, want := range map[string]bool{
+		"SELECT * FROM orders WHERE id = {id}":                   false,
+		"-- insert a row\nSELECT 'delete' AS action":             false,
+		"WITH t AS (SELECT 1) SELECT * FROM t":                   false,
+		"insert into orders (ref) values ({ref})":                true,
+		"/* audit */ UPDATE orders SET paid = 1":                 true,
+		"EXEC dbo.close_period {period}":                         true,
+		"SELECT 1; DELETE FROM queue WHERE id = {id}":            true,
+		"WITH moved AS (DELETE FROM queue RETURNING *) SELECT 1": true,
+		"(SELECT id FROM a) UNION (SELECT id FROM b)":            false,
+	} {
+		if got := IsWriteSQL(sql); got != want {
+			t.Errorf("IsWriteSQL(%q) = %v, want %v", sql, got, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"database/sql"
+	"dbbridge/internal/core"
+	"strings"
+	"time"
+)
+
+// likeEscaper escapes the wildcards of a LIKE pattern using ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+type AccessEventRepo struct {
+	db *sql.DB
+}
+
+func NewAccessEventRepo(db *sql.DB) *AccessEventRepo {
+	return &AccessEventRepo{db: db}
+}
+
+// CreateBatch inserts events in one transaction and sets their ids
+func (r *AccessEventRepo) CreateBatch(events []*core.AccessEvent) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO access_events (timestamp, method, path, status, client_ip, key_prefix, code, message, duration_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range events {
+		res, err := stmt.Exec(e.Timestamp, e.Method, e.Path, e.Status, e.ClientIP, e.KeyPrefix, e.Code, e.Message, e.DurationMs)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		e.ID, _ = res.LastInsertId()
+	}
+	return tx.Commit()
+}
+
+func (r *AccessEventRepo) List(filter core.AccessEventFilter, limit int, beforeID int64) ([]core.AccessEvent, error) {
+	var where []string
+	var args []interface{}
+	if filter.MinStatus != 0 {
+		where = append(where, "status >= ?")
+		args = append(args, filter.MinStatus)
+	}
+	if filter.MaxStatus != 0 {
+		where = append(where, "status <= ?")
+		args = append(args, filter.MaxStatus)
+	}
+	if filter.Path != "" {
+		where = append(where, `path LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(filter.Path)+"%")
+	}
+	for _, f := range []struct{ column, value string }{
+		{"key_prefix", filter.KeyPrefix}, {"client_ip", filter.ClientIP}, {"code", filter.Code},
+	} {
+		if f.value != "" {
+			where = append(where, f.column+" = ?")
+			args = append(args, f.value)
+		}
+	}
+	if beforeID != 0 {
+		where = append(where, "id < ?")
+		args = append(args, beforeID)
+	}
+	query := `SELECT id, timestamp, method, path, status, client_ip, key_prefix, code, message, duration_ms FROM access_events`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	rows, err := r.db.Query(query+` ORDER BY id DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []core.AccessEvent
+	for rows.Next() {
+		var e core.AccessEvent
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.Method, &e.Path, &e.Status, &e.ClientIP, &e.KeyPrefix, &e.Code, &e.Message, &e.DurationMs); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// DeleteBefore drops the events older than t and returns how many
+func (r *AccessEventRepo) DeleteBefore(t time.Time) (int64, error) {
+	res, err := r.db.Exec(`DELETE FROM access_events WHERE timestamp < ?`, t)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -7,19 +7,29 @@ import (
 )
 
 type ApiKeyRepo struct {
-	db *sql.DB
+	db     *sql.DB
+	cipher *MetadataCipher // nil = descriptions stored as plaintext
 }
 
 func NewApiKeyRepo(db *sql.DB) *ApiKeyRepo {
 	return &ApiKeyRepo{db: db}
 }
 
+// SetCipher encrypts descriptions when the api_key_descriptions group is on
+func (r *ApiKeyRepo) SetCipher(c *MetadataCipher) {
+	r.cipher = c
+}
+
 func (r *ApiKeyRepo) Create(key *core.ApiKey) error {
+	desc, err := r.cipher.seal(core.EncryptAPIKeyDescriptions, key.Description)
+	if err != nil {
+		return err
+	}
 	query := `
-		INSERT INTO api_keys (user_id, key_prefix, key_hash, description, created_at, is_active)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO api_keys (user_id, key_prefix, key_hash, description, allowed_cidrs, envelope, kind, created_at, expires_at, is_active, is_demo)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	res, err := r.db.Exec(query, key.UserID, key.KeyPrefix, key.KeyHash, key.Description, key.CreatedAt, key.IsActive)
+	res, err := r.db.Exec(query, key.UserID, key.KeyPrefix, key.KeyHash, desc, key.AllowedCIDRs, key.Envelope, key.Kind, key.CreatedAt, key.ExpiresAt, key.IsActive, key.IsDemo)
 	if err != nil {
 		return err
 	}
@@ -35,7 +45,7 @@ func (r *ApiKeyRepo) List() ([]core.ApiKey, error) {
 	// For admin, listing all keys or maybe filtered by user.
 	// For now, list all.
 	query := `
-		SELECT id, user_id, key_prefix, description, created_at, last_used_at, is_active
+		SELECT id, user_id, key_prefix, description, allowed_cidrs, attributes, scopes, envelope, kind, created_at, last_used_at, expires_at, is_active, is_demo, disabled_reason, reenabled_at
 		FROM api_keys
 		ORDER BY created_at DESC
 	`
@@ -48,17 +58,25 @@ func (r *ApiKeyRepo) List() ([]core.ApiKey, error) {
 	var keys []core.ApiKey
 	for rows.Next() {
 		var k core.ApiKey
-		var lastUsed sql.NullTime
+		var lastUsed, expires, reenabled sql.NullTime
 		var desc sql.NullString
-		if err := rows.Scan(&k.ID, &k.UserID, &k.KeyPrefix, &desc, &k.CreatedAt, &lastUsed, &k.IsActive); err != nil {
+		var cidrs sql.NullString
+		if err := rows.Scan(&k.ID, &k.UserID, &k.KeyPrefix, &desc, &cidrs, &k.Attributes, &k.Scopes, &k.Envelope, &k.Kind, &k.CreatedAt, &lastUsed, &expires, &k.IsActive, &k.IsDemo, &k.DisabledReason, &reenabled); err != nil {
 			return nil, err
 		}
 		if lastUsed.Valid {
 			k.LastUsedAt = &lastUsed.Time
 		}
+		if expires.Valid {
+			k.ExpiresAt = &expires.Time
+		}
+		if reenabled.Valid {
+			k.ReenabledAt = &reenabled.Time
+		}
 		if desc.Valid {
-			k.Description = desc.String
+			k.Description = r.cipher.open(desc.String)
 		}
+		k.AllowedCIDRs = cidrs.String
 		keys = append(keys, k)
 	}
 	return keys, nil
@@ -66,16 +84,17 @@ func (r *ApiKeyRepo) List() ([]core.ApiKey, error) {
 
 func (r *ApiKeyRepo) GetByHash(hash string) (*core.ApiKey, error) {
 	query := `
-		SELECT id, user_id, key_prefix, key_hash, description, created_at, last_used_at, is_active
+		SELECT id, user_id, key_prefix, key_hash, description, allowed_cidrs, attributes, scopes, envelope, kind, created_at, last_used_at, expires_at, is_active, is_demo, disabled_reason, reenabled_at
 		FROM api_keys
 		WHERE key_hash = ? AND is_active = 1
 	`
 	row := r.db.QueryRow(query, hash)
 
 	var k core.ApiKey
-	var lastUsed sql.NullTime
+	var lastUsed, expires, reenabled sql.NullTime
 	var desc sql.NullString
-	if err := row.Scan(&k.ID, &k.UserID, &k.KeyPrefix, &k.KeyHash, &desc, &k.CreatedAt, &lastUsed, &k.IsActive); err != nil {
+	var cidrs sql.NullString
+	if err := row.Scan(&k.ID, &k.UserID, &k.KeyPrefix, &k.KeyHash, &desc, &cidrs, &k.Attributes, &k.Scopes, &k.Envelope, &k.Kind, &k.CreatedAt, &lastUsed, &expires, &k.IsActive, &k.IsDemo, &k.DisabledReason, &reenabled); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -84,18 +103,61 @@ func (r *ApiKeyRepo) GetByHash(hash string) (*core.ApiKey, error) {
 	if lastUsed.Valid {
 		k.LastUsedAt = &lastUsed.Time
 	}
+	if expires.Valid {
+		k.ExpiresAt = &expires.Time
+	}
+	if reenabled.Valid {
+		k.ReenabledAt = &reenabled.Time
+	}
 	if desc.Valid {
-		k.Description = desc.String
+		k.Description = r.cipher.open(desc.String)
 	}
+	k.AllowedCIDRs = cidrs.String
 	return &k, nil
 }
 
 func (r *ApiKeyRepo) Revoke(id int64) error {
-	query := `UPDATE api_keys SET is_active = 0 WHERE id = ?`
+	query := `UPDATE api_keys SET is_active = 0, disabled_reason = '' WHERE id = ?`
 	_, err := r.db.Exec(query, id)
 	return err
 }
 
+func (r *ApiKeyRepo) DisableInactive(id int64) error {
+	query := `UPDATE api_keys SET is_active = 0, disabled_reason = ? WHERE id = ? AND is_active = 1`
+	_, err := r.db.Exec(query, core.ApiKeyDisabledInactive, id)
+	return err
+}
+
+func (r *ApiKeyRepo) Reenable(id int64) error {
+	query := `UPDATE api_keys SET is_active = 1, disabled_reason = '', reenabled_at = ? WHERE id = ? AND is_active = 0 AND disabled_reason = ?`
+	_, err := r.db.Exec(query, time.Now(), id, core.ApiKeyDisabledInactive)
+	return err
+}
+
+func (r *ApiKeyRepo) UpdateAllowedCIDRs(id int64, cidrs string) error {
+	query := `UPDATE api_keys SET allowed_cidrs = ? WHERE id = ?`
+	_, err := r.db.Exec(query, cidrs, id)
+	return err
+}
+
+func (r *ApiKeyRepo) UpdateAttributes(id int64, attributes string) error {
+	query := `UPDATE api_keys SET attributes = ? WHERE id = ?`
+	_, err := r.db.Exec(query, attributes, id)
+	return err
+}
+
+func (r *ApiKeyRepo) UpdateScopes(id int64, scopes string) error {
+	query := `UPDATE api_keys SET scopes = ? WHERE id = ?`
+	_, err := r.db.Exec(query, scopes, id)
+	return err
+}
+
+func (r *ApiKeyRepo) UpdateEnvelope(id int64, envelope string) error {
+	query := `UPDATE api_keys SET envelope = ? WHERE id = ?`
+	_, err := r.db.Exec(query, envelope, id)
+	return err
+}
+
 func (r *ApiKeyRepo) UpdateLastUsed(id int64) error {
 	query := `UPDATE api_keys SET last_used_at = ? WHERE id = ?`
 	_, err := r.db.Exec(query, time.Now(), id)
@@ -4,55 +4,188 @@ import (
 	"database/sql"
 	"dbbridge/internal/core"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type AuditRepo struct {
-	db *sql.DB
+	db     *sql.DB
+	cipher *MetadataCipher // nil = params stored as plaintext
+
+	mu          sync.RWMutex
+	subscribers []auditSubscriber
+	retention   func() int
+	pruning     atomic.Bool // a retention delete is running
+	deferPrune  atomic.Bool // Prune is called by the audit writer, not Create
+}
+
+type auditSubscriber struct {
+	ch     chan<- core.AuditLog
+	onDrop func()
 }
 
 func NewAuditRepo(db *sql.DB) *AuditRepo {
-	return &AuditRepo{db: db}
+	return &AuditRepo{db: db, retention: func() int { return 1000 }}
+}
+
+// SetRetention sets how many entries are kept, read on every insert so a
+// runtime settings change applies immediately
+func (r *AuditRepo) SetRetention(fn func() int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retention = fn
+}
+
+// DeferRetention stops Create from starting retention deletes. The caller
+// runs Prune itself, as service.AuditWriter does between its inserts.
+func (r *AuditRepo) DeferRetention() {
+	r.deferPrune.Store(true)
+}
+
+// SetCipher encrypts params when the audit_params group is on, and decrypts
+// them and the API key descriptions read. Set it before the first entry is
+// written.
+func (r *AuditRepo) SetCipher(c *MetadataCipher) {
+	r.cipher = c
+}
+
+// Subscribe delivers every created entry to ch. Sends never block: when ch is
+// full the entry is skipped and onDrop is called, so a slow consumer cannot
+// stall query execution.
+func (r *AuditRepo) Subscribe(ch chan<- core.AuditLog, onDrop func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, auditSubscriber{ch: ch, onDrop: onDrop})
+}
+
+func (r *AuditRepo) publish(l core.AuditLog) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, s := range r.subscribers {
+		select {
+		case s.ch <- l:
+		default:
+			if s.onDrop != nil {
+				s.onDrop()
+			}
+		}
+	}
 }
 
 func (r *AuditRepo) Create(l *core.AuditLog) error {
-	res, err := r.db.Exec(`INSERT INTO audit_logs (timestamp, user_id, api_key_id, connection_id, query_id, duration_ms, status, error_message, params) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		l.Timestamp, l.UserID, l.ApiKeyID, l.ConnectionID, l.QueryID, l.DurationMs, l.Status, l.ErrorMessage, l.Params)
+	params, err := r.cipher.seal(core.EncryptAuditParams, l.Params)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.Exec(`INSERT INTO audit_logs (timestamp, user_id, api_key_id, connection_id, query_id, duration_ms, status, error_message, params, client_ip, mode, event_type, target) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		l.Timestamp, l.UserID, l.ApiKeyID, l.ConnectionID, l.QueryID, l.DurationMs, l.Status, l.ErrorMessage, params, l.ClientIP, l.Mode, l.EventType, l.Target)
 	if err != nil {
 		return err
 	}
 	id, _ := res.LastInsertId()
 	l.ID = id
 
-	// Simple Retention Policy: Keep last 1000 logs
-	// A more robust solution would be a background job, but this works for now.
-	// Randomly trigger cleanup (e.g., 10% chance) to avoid overhead on every insert
-	// or just do it. SQLite is fast enough for small tables.
-	// Let's do it every time for "exactness" or maybe just strict limit?
-	// DELETE FROM audit_logs WHERE id NOT IN (SELECT id FROM audit_logs ORDER BY id DESC LIMIT 1000)
-	go func() {
-		// Run in background to not block response
-		limit := 1000 // TODO: Configurable
-		_, _ = r.db.Exec(`DELETE FROM audit_logs WHERE id NOT IN (SELECT id FROM audit_logs ORDER BY id DESC LIMIT ?)`, limit)
-	}()
+	r.publish(*l)
+
+	// Retention: keep the last AUDIT_RETENTION_ROWS entries. One delete runs
+	// at a time in the background; inserts during it leave their rows to the
+	// next one.
+	if !r.deferPrune.Load() && r.pruning.CompareAndSwap(false, true) {
+		go func() {
+			defer r.pruning.Store(false)
+			r.Prune()
+		}()
+	}
 
 	return nil
 }
 
-func (r *AuditRepo) GetRecent(limit int) ([]core.AuditLog, error) {
-	query := `
+// Prune deletes the entries beyond the retention limit
+func (r *AuditRepo) Prune() {
+	r.mu.RLock()
+	limit := r.retention()
+	r.mu.RUnlock()
+	_, _ = r.db.Exec(`DELETE FROM audit_logs WHERE id NOT IN (SELECT id FROM audit_logs ORDER BY id DESC LIMIT ?)`, limit)
+	// Captured SQL expires with its entry
+	_, _ = r.db.Exec(`DELETE FROM execution_details WHERE audit_id < (SELECT MIN(id) FROM audit_logs)`)
+}
+
+const auditSelect = `
 		SELECT 
-			a.id, a.timestamp, a.user_id, a.api_key_id, a.connection_id, a.query_id, a.duration_ms, a.status, a.error_message, a.params,
+			a.id, a.timestamp, a.user_id, a.api_key_id, a.connection_id, a.query_id, a.duration_ms, a.status, a.error_message, a.params, a.client_ip, a.mode,
+			a.event_type, a.target,
 			k.key_prefix, k.description,
 			c.name as connection_name,
-			q.slug as query_slug
+			q.slug as query_slug,
+			u.username
 		FROM audit_logs a
 		LEFT JOIN api_keys k ON a.api_key_id = k.id
 		LEFT JOIN connections c ON a.connection_id = c.id
 		LEFT JOIN queries q ON a.query_id = q.id
-		ORDER BY a.timestamp DESC 
-		LIMIT ?`
+		LEFT JOIN users u ON a.user_id = u.id`
 
-	rows, err := r.db.Query(query, limit)
+func (r *AuditRepo) GetByID(id int64) (*core.AuditLog, error) {
+	logs, err := r.query(auditSelect+` WHERE a.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(logs) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &logs[0], nil
+}
+
+func (r *AuditRepo) GetRecent(limit int) ([]core.AuditLog, error) {
+	return r.ListRecent(limit, "", 0, 0)
+}
+
+// ListRecent pages by keyset on the indexed (timestamp, id) instead of
+// OFFSET, so older pages cost no more than the first. beforeID is the last
+// entry of the previous page; an entry since removed by retention ends the
+// listing.
+func (r *AuditRepo) ListRecent(limit int, filter string, userID int64, beforeID int64) ([]core.AuditLog, error) {
+	var where []string
+	var args []interface{}
+	switch filter {
+	case "":
+	case core.AuditFilterExecutions:
+		where = append(where, "a.event_type = ''")
+	case core.AuditFilterAdmin:
+		where = append(where, "a.event_type <> ''")
+	default:
+		where = append(where, `a.event_type LIKE ? ESCAPE '\'`)
+		args = append(args, strings.ReplaceAll(filter, "_", `\_`)+".%")
+	}
+	if userID != 0 {
+		where = append(where, "a.user_id = ?")
+		args = append(args, userID)
+	}
+	if beforeID != 0 {
+		where = append(where, "(a.timestamp, a.id) < (SELECT timestamp, id FROM audit_logs WHERE id = ?)")
+		args = append(args, beforeID)
+	}
+	query := auditSelect
+	if len(where) > 0 {
+		query += `
+		WHERE ` + strings.Join(where, " AND ")
+	}
+	return r.query(query+`
+		ORDER BY a.timestamp DESC, a.id DESC
+		LIMIT ?`, append(args, limit)...)
+}
+
+// ListAfter returns entries with an id greater than afterID, oldest first
+func (r *AuditRepo) ListAfter(afterID int64, limit int) ([]core.AuditLog, error) {
+	return r.query(auditSelect+`
+		WHERE a.id > ?
+		ORDER BY a.id ASC
+		LIMIT ?`, afterID, limit)
+}
+
+func (r *AuditRepo) query(query string, args ...interface{}) ([]core.AuditLog, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -66,14 +199,21 @@ func (r *AuditRepo) GetRecent(limit int) ([]core.AuditLog, error) {
 		var connName sql.NullString
 		var querySlug sql.NullString
 		var params sql.NullString
+		var clientIP sql.NullString
+		var mode sql.NullString
+		var username sql.NullString
 
-		if err := rows.Scan(&l.ID, &l.Timestamp, &l.UserID, &l.ApiKeyID, &l.ConnectionID, &l.QueryID, &l.DurationMs, &l.Status, &l.ErrorMessage, &params, &keyPrefix, &keyDesc, &connName, &querySlug); err != nil {
+		if err := rows.Scan(&l.ID, &l.Timestamp, &l.UserID, &l.ApiKeyID, &l.ConnectionID, &l.QueryID, &l.DurationMs, &l.Status, &l.ErrorMessage, &params, &clientIP, &mode,
+			&l.EventType, &l.Target, &keyPrefix, &keyDesc, &connName, &querySlug, &username); err != nil {
 			return nil, err
 		}
 
 		if params.Valid {
-			l.Params = params.String
+			l.Params = r.cipher.open(params.String)
 		}
+		l.ClientIP = clientIP.String
+		l.Mode = mode.String
+		l.Username = username.String
 		if connName.Valid {
 			l.ConnectionName = connName.String
 		}
@@ -83,7 +223,7 @@ func (r *AuditRepo) GetRecent(limit int) ([]core.AuditLog, error) {
 
 		if keyPrefix.Valid {
 			if keyDesc.Valid && keyDesc.String != "" {
-				l.ApiKeyPrefix = fmt.Sprintf("%s... (%s)", keyPrefix.String, keyDesc.String)
+				l.ApiKeyPrefix = fmt.Sprintf("%s... (%s)", keyPrefix.String, r.cipher.open(keyDesc.String))
 			} else {
 				l.ApiKeyPrefix = keyPrefix.String + "..."
 			}
@@ -96,3 +236,20 @@ func (r *AuditRepo) GetRecent(limit int) ([]core.AuditLog, error) {
 	}
 	return logs, nil
 }
+
+// GetForwardCursor returns the last id delivered to sink, 0 if it never delivered
+func (r *AuditRepo) GetForwardCursor(sink string) (int64, error) {
+	var lastID int64
+	err := r.db.QueryRow(`SELECT last_id FROM audit_forward_cursors WHERE sink = ?`, sink).Scan(&lastID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return lastID, err
+}
+
+func (r *AuditRepo) SetForwardCursor(sink string, lastID int64) error {
+	_, err := r.db.Exec(`INSERT INTO audit_forward_cursors (sink, last_id, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(sink) DO UPDATE SET last_id = excluded.last_id, updated_at = excluded.updated_at`,
+		sink, lastID, time.Now())
+	return err
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"dbbridge/internal/core"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestDB(tb testing.TB) *AuditRepo {
+	tb.Helper()
+	db, err := OpenDB(filepath.Join(tb.TempDir(), "dbbridge.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	repo := NewAuditRepo(db)
+	repo.SetRetention(func() int { return 10_000_000 })
+	return repo
+}
+
+func TestAuditListRecentPagesByKeyset(t *testing.T) {
+	repo := openTestDB(t)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	for i := 0; i < 25; i++ {
+		// Groups of three entries share a timestamp, and ids don't follow
+		// timestamps, as when a slow execution is audited after a fast one
+		ts := base.Add(time.Duration((i/3)*((i%2)*2-1)) * time.Minute)
+		if err := repo.Create(&core.AuditLog{Timestamp: ts, Status: "SUCCESS", QueryID: int64(i % 2)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all, err := repo.ListRecent(100, "", 0, 0)
+	if err != nil || len(all) != 25 {
+		t.Fatalf("ListRecent = %d entries, %v", len(all), err)
+	}
+
+	var paged []core.AuditLog
+	before := int64(0)
+	for {
+		page, err := repo.ListRecent(10, "", 0, before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, page...)
+		if len(page) < 10 {
+			break
+		}
+		before = page[len(page)-1].ID
+	}
+	if len(paged) != len(all) {
+		t.Fatalf("pages hold %d entries, want %d", len(paged), len(all))
+	}
+	for i := range all {
+		if paged[i].ID != all[i].ID {
+			t.Fatalf("entry %d of the pages is #%d, want #%d", i, paged[i].ID, all[i].ID)
+		}
+		if i > 0 && all[i].Timestamp.After(all[i-1].Timestamp) {
+			t.Fatalf("entry #%d is newer than the one before it", all[i].ID)
+		}
+	}
+}
+
+// BenchmarkAuditListRecent reads a page deep into a log of a million entries
+// by OFFSET, as the log was read before, and by keyset:
+//
+//	go test ./internal/data -run '^$' -bench AuditListRecent -benchtime 20x
+func BenchmarkAuditListRecent(b *testing.B) {
+	if testing.Short() {
+		b.Skip("seeds a million audit entries")
+	}
+	const entries, depth, pageSize = 1_000_000, 500_000, 100
+	repo := openTestDB(b)
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO audit_logs (timestamp, user_id, connection_id, query_id, duration_ms, status, error_message) VALUES (?, 1, ?, ?, 5, 'SUCCESS', '')`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	base := time.Now().Add(-entries * time.Second)
+	for i := 0; i < entries; i++ {
+		if _, err := stmt.Exec(base.Add(time.Duration(i)*time.Second), i%10, i%200); err != nil {
+			b.Fatal(err)
+		}
+	}
+	stmt.Close()
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+
+	var beforeID int64
+	if err := repo.db.QueryRow(`SELECT id FROM audit_logs ORDER BY timestamp DESC, id DESC LIMIT 1 OFFSET ?`, depth-1).Scan(&beforeID); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+
+	b.Run(fmt.Sprintf("offset-%d", depth), func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			logs, err := repo.query(auditSelect+`
+				ORDER BY a.timestamp DESC, a.id DESC
+				LIMIT ? OFFSET ?`, pageSize, depth)
+			if err != nil || len(logs) != pageSize {
+				b.Fatalf("%d entries, %v", len(logs), err)
+			}
+		}
+	})
+	b.Run(fmt.Sprintf("keyset-%d", depth), func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			logs, err := repo.ListRecent(pageSize, "", 0, beforeID)
+			if err != nil || len(logs) != pageSize {
+				b.Fatalf("%d entries, %v", len(logs), err)
+			}
+		}
+	})
+}
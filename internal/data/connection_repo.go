@@ -3,6 +3,7 @@ package data
 import (
 	"database/sql"
 	"dbbridge/internal/core"
+	"time"
 )
 
 type ConnectionRepo struct {
@@ -14,8 +15,10 @@ func NewConnectionRepo(db *sql.DB) *ConnectionRepo {
 }
 
 func (r *ConnectionRepo) Create(conn *core.DBConnection) error {
-	query := `INSERT INTO connections (name, driver, connection_string_enc, is_active) VALUES (?, ?, ?, ?)`
-	res, err := r.db.Exec(query, conn.Name, conn.Driver, conn.ConnectionStringEnc, conn.IsActive)
+	query := `INSERT INTO connections (name, driver, connection_string_enc, dialect, credentials_enc, init_options, ping_query, health_query, health_rule, skip_ping, bind_mode, strip_comments, allowed_schemas, production, protected, environment, show_on_status_page, default_params, is_active, is_demo, created_at, updated_at, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	now := time.Now()
+	res, err := r.db.Exec(query, conn.Name, conn.Driver, conn.ConnectionStringEnc, conn.Dialect, conn.CredentialsEnc, conn.InitOptions,
+		conn.PingQuery, conn.HealthQuery, conn.HealthRule, conn.SkipPing, conn.BindMode, conn.StripComments, conn.AllowedSchemas, conn.Production, conn.Protected, conn.Environment, conn.ShowOnStatusPage, conn.DefaultParams, conn.IsActive, conn.IsDemo, now, now, conn.UpdatedBy)
 	if err != nil {
 		return err
 	}
@@ -24,11 +27,12 @@ func (r *ConnectionRepo) Create(conn *core.DBConnection) error {
 		return err
 	}
 	conn.ID = id
+	conn.CreatedAt, conn.UpdatedAt = &now, &now
 	return nil
 }
 
 func (r *ConnectionRepo) GetAll() ([]core.DBConnection, error) {
-	rows, err := r.db.Query(`SELECT id, name, driver, connection_string_enc, is_active FROM connections`)
+	rows, err := r.db.Query(`SELECT id, name, driver, connection_string_enc, dialect, credentials_enc, init_options, ping_query, health_query, health_rule, skip_ping, bind_mode, strip_comments, allowed_schemas, production, protected, environment, show_on_status_page, default_params, is_active, is_demo, created_at, updated_at, updated_by FROM connections ORDER BY updated_at IS NULL, updated_at DESC, id`)
 	if err != nil {
 		return nil, err
 	}
@@ -39,10 +43,13 @@ func (r *ConnectionRepo) GetAll() ([]core.DBConnection, error) {
 		var c core.DBConnection
 		// SQLite stores booleans as integers (0 or 1)
 		var isActive int
-		if err := rows.Scan(&c.ID, &c.Name, &c.Driver, &c.ConnectionStringEnc, &isActive); err != nil {
+		var createdAt, updatedAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.Name, &c.Driver, &c.ConnectionStringEnc, &c.Dialect, &c.CredentialsEnc, &c.InitOptions, &c.PingQuery, &c.HealthQuery, &c.HealthRule, &c.SkipPing, &c.BindMode, &c.StripComments, &c.AllowedSchemas, &c.Production, &c.Protected, &c.Environment, &c.ShowOnStatusPage, &c.DefaultParams, &isActive, &c.IsDemo,
+			&createdAt, &updatedAt, &c.UpdatedBy); err != nil {
 			return nil, err
 		}
 		c.IsActive = isActive == 1
+		c.CreatedAt, c.UpdatedAt = timePtr(createdAt), timePtr(updatedAt)
 		connections = append(connections, c)
 	}
 	return connections, nil
@@ -51,31 +58,37 @@ func (r *ConnectionRepo) GetAll() ([]core.DBConnection, error) {
 func (r *ConnectionRepo) GetByID(id int64) (*core.DBConnection, error) {
 	var c core.DBConnection
 	var isActive int
-	err := r.db.QueryRow(`SELECT id, name, driver, connection_string_enc, is_active FROM connections WHERE id = ?`, id).
-		Scan(&c.ID, &c.Name, &c.Driver, &c.ConnectionStringEnc, &isActive)
+	var createdAt, updatedAt sql.NullTime
+	err := r.db.QueryRow(`SELECT id, name, driver, connection_string_enc, dialect, credentials_enc, init_options, ping_query, health_query, health_rule, skip_ping, bind_mode, strip_comments, allowed_schemas, production, protected, environment, show_on_status_page, default_params, is_active, is_demo, created_at, updated_at, updated_by FROM connections WHERE id = ?`, id).
+		Scan(&c.ID, &c.Name, &c.Driver, &c.ConnectionStringEnc, &c.Dialect, &c.CredentialsEnc, &c.InitOptions, &c.PingQuery, &c.HealthQuery, &c.HealthRule, &c.SkipPing, &c.BindMode, &c.StripComments, &c.AllowedSchemas, &c.Production, &c.Protected, &c.Environment, &c.ShowOnStatusPage, &c.DefaultParams, &isActive, &c.IsDemo,
+			&createdAt, &updatedAt, &c.UpdatedBy)
 	if err != nil {
 		return nil, err
 	}
 	c.IsActive = isActive == 1
-	c.IsActive = isActive == 1
+	c.CreatedAt, c.UpdatedAt = timePtr(createdAt), timePtr(updatedAt)
 	return &c, nil
 }
 
 func (r *ConnectionRepo) GetByName(name string) (*core.DBConnection, error) {
 	var c core.DBConnection
 	var isActive int
-	err := r.db.QueryRow(`SELECT id, name, driver, connection_string_enc, is_active FROM connections WHERE name = ?`, name).
-		Scan(&c.ID, &c.Name, &c.Driver, &c.ConnectionStringEnc, &isActive)
+	var createdAt, updatedAt sql.NullTime
+	err := r.db.QueryRow(`SELECT id, name, driver, connection_string_enc, dialect, credentials_enc, init_options, ping_query, health_query, health_rule, skip_ping, bind_mode, strip_comments, allowed_schemas, production, protected, environment, show_on_status_page, default_params, is_active, is_demo, created_at, updated_at, updated_by FROM connections WHERE name = ?`, name).
+		Scan(&c.ID, &c.Name, &c.Driver, &c.ConnectionStringEnc, &c.Dialect, &c.CredentialsEnc, &c.InitOptions, &c.PingQuery, &c.HealthQuery, &c.HealthRule, &c.SkipPing, &c.BindMode, &c.StripComments, &c.AllowedSchemas, &c.Production, &c.Protected, &c.Environment, &c.ShowOnStatusPage, &c.DefaultParams, &isActive, &c.IsDemo,
+			&createdAt, &updatedAt, &c.UpdatedBy)
 	if err != nil {
 		return nil, err
 	}
 	c.IsActive = isActive == 1
+	c.CreatedAt, c.UpdatedAt = timePtr(createdAt), timePtr(updatedAt)
 	return &c, nil
 }
 
 func (r *ConnectionRepo) Update(conn *core.DBConnection) error {
-	_, err := r.db.Exec(`UPDATE connections SET name=?, driver=?, connection_string_enc=?, is_active=? WHERE id=?`,
-		conn.Name, conn.Driver, conn.ConnectionStringEnc, conn.IsActive, conn.ID)
+	_, err := r.db.Exec(`UPDATE connections SET name=?, driver=?, connection_string_enc=?, dialect=?, credentials_enc=?, init_options=?, ping_query=?, health_query=?, health_rule=?, skip_ping=?, bind_mode=?, strip_comments=?, allowed_schemas=?, production=?, protected=?, environment=?, show_on_status_page=?, default_params=?, is_active=?, updated_at=?, updated_by=? WHERE id=?`,
+		conn.Name, conn.Driver, conn.ConnectionStringEnc, conn.Dialect, conn.CredentialsEnc, conn.InitOptions,
+		conn.PingQuery, conn.HealthQuery, conn.HealthRule, conn.SkipPing, conn.BindMode, conn.StripComments, conn.AllowedSchemas, conn.Production, conn.Protected, conn.Environment, conn.ShowOnStatusPage, conn.DefaultParams, conn.IsActive, time.Now(), conn.UpdatedBy, conn.ID)
 	return err
 }
 
@@ -83,3 +96,11 @@ func (r *ConnectionRepo) Delete(id int64) error {
 	_, err := r.db.Exec(`DELETE FROM connections WHERE id=?`, id)
 	return err
 }
+
+// timePtr maps a nullable timestamp column to an optional model field
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,50 @@
+package data
+
+import (
+	"database/sql"
+	"dbbridge/internal/core"
+	"time"
+)
+
+type ContractRepo struct {
+	db *sql.DB
+}
+
+func NewContractRepo(db *sql.DB) *ContractRepo {
+	return &ContractRepo{db: db}
+}
+
+func (r *ContractRepo) Add(c *core.ContractChange) error {
+	if c.ChangedAt.IsZero() {
+		c.ChangedAt = time.Now()
+	}
+	res, err := r.db.Exec(`INSERT INTO query_contract_changes (query_id, query_slug, old_contract, new_contract, changed_at) VALUES (?, ?, ?, ?, ?)`,
+		c.QueryID, c.QuerySlug, c.OldContract, c.NewContract, c.ChangedAt)
+	if err != nil {
+		return err
+	}
+	c.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// ListSince returns the changes made at or after since. Contract changes are
+// rare, so they are filtered here rather than by comparing stored timestamps.
+func (r *ContractRepo) ListSince(since time.Time) ([]core.ContractChange, error) {
+	rows, err := r.db.Query(`SELECT id, query_id, query_slug, old_contract, new_contract, changed_at FROM query_contract_changes ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []core.ContractChange
+	for rows.Next() {
+		var c core.ContractChange
+		if err := rows.Scan(&c.ID, &c.QueryID, &c.QuerySlug, &c.OldContract, &c.NewContract, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		if !c.ChangedAt.Before(since) {
+			changes = append(changes, c)
+		}
+	}
+	return changes, rows.Err()
+}
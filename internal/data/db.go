@@ -5,16 +5,48 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	_ "modernc.org/sqlite"
 )
 
+// sqliteDSN makes connections wait on a locked database instead of failing
+// with SQLITE_BUSY: background writes such as audit retention share the file
+// with request-path inserts. Transactions take the write lock up front, since
+// a deferred one that reads first can't wait its way out of a lock conflict
+func sqliteDSN(dbPath string) string {
+	var params []string
+	if !strings.Contains(dbPath, "busy_timeout") {
+		params = append(params, "_pragma=busy_timeout(5000)")
+	}
+	if !strings.Contains(dbPath, "_txlock") {
+		params = append(params, "_txlock=immediate")
+	}
+	if len(params) == 0 {
+		return dbPath
+	}
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	return dbPath + sep + strings.Join(params, "&")
+}
+
 // InitDB initializes the SQLite database and runs migrations
 func InitDB() (*sql.DB, error) {
+	dbPath, err := DBPath()
+	if err != nil {
+		return nil, err
+	}
+	return OpenDB(dbPath)
+}
+
+// DBPath returns the location of dbbridge.db, next to the executable
+func DBPath() (string, error) {
 	// Determine database path execution relative
 	exePath, err := os.Executable()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	dbPath := filepath.Join(filepath.Dir(exePath), "dbbridge.db")
 
@@ -23,8 +55,12 @@ func InitDB() (*sql.DB, error) {
 		wd, _ := os.Getwd()
 		dbPath = filepath.Join(wd, "dbbridge.db")
 	}
+	return dbPath, nil
+}
 
-	db, err := sql.Open("sqlite", dbPath)
+// OpenDB opens the SQLite database at dbPath and runs migrations
+func OpenDB(dbPath string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", sqliteDSN(dbPath))
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +136,106 @@ func runMigrations(db *sql.DB) error {
 		status TEXT,
 		error_message TEXT
 	);
+
+	-- Runtime settings edited on the admin settings page, override env defaults
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Last audit log id delivered per forwarding sink, survives restarts
+	CREATE TABLE IF NOT EXISTS audit_forward_cursors (
+		sink TEXT PRIMARY KEY,
+		last_id INTEGER NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Saves and deletes that changed a query's API contract, for /api/changelog
+	CREATE TABLE IF NOT EXISTS query_contract_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		query_id INTEGER NOT NULL,
+		query_slug TEXT NOT NULL,
+		old_contract TEXT NOT NULL DEFAULT '', -- JSON service.QueryContract, empty = no endpoint
+		new_contract TEXT NOT NULL DEFAULT '',
+		changed_at DATETIME NOT NULL
+	);
+
+	-- API executions of write queries by Idempotency-Key, replayed to retries
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		api_key_id INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		request_hash TEXT NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0, -- 0 = still running
+		headers TEXT NOT NULL DEFAULT '',       -- JSON http.Header of the response
+		body BLOB,
+		created_at INTEGER NOT NULL,            -- unix seconds
+		expires_at INTEGER NOT NULL,
+		PRIMARY KEY (api_key_id, key)
+	);
+
+	-- API requests answered with a non-2xx status, kept for ACCESS_EVENT_RETENTION_HOURS
+	CREATE TABLE IF NOT EXISTS access_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		client_ip TEXT NOT NULL DEFAULT '',
+		key_prefix TEXT NOT NULL DEFAULT '',
+		code TEXT NOT NULL DEFAULT '',
+		message TEXT NOT NULL DEFAULT '',
+		duration_ms INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS idx_access_events_timestamp ON access_events (timestamp);
+
+	-- Executions per connection and hour ("YYYY-MM-DD HH" in server time),
+	-- rolled up from audit_logs by the usage rollup
+	CREATE TABLE IF NOT EXISTS connection_usage (
+		connection_id INTEGER NOT NULL,
+		hour TEXT NOT NULL,
+		executions INTEGER NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		PRIMARY KEY (connection_id, hour)
+	);
+
+	-- Former slugs of renamed queries, still resolved to the query
+	CREATE TABLE IF NOT EXISTS query_slug_aliases (
+		slug TEXT PRIMARY KEY,
+		query_id INTEGER NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+
+	-- The SQL sent by executions of queries with debug_capture, per audit entry
+	CREATE TABLE IF NOT EXISTS execution_details (
+		audit_id INTEGER PRIMARY KEY,
+		sql_text TEXT NOT NULL,
+		arg_types TEXT NOT NULL DEFAULT '', -- JSON array of Go type names
+		arg_values TEXT NOT NULL DEFAULT '' -- JSON array, only with debug_capture_values
+	);
+
+	-- Signed tokens showing one query's results in an iframe, see service.EmbedService
+	CREATE TABLE IF NOT EXISTS embed_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		query_id INTEGER NOT NULL,
+		connection_id INTEGER NOT NULL,
+		params TEXT NOT NULL DEFAULT '',
+		row_cap INTEGER NOT NULL,
+		label TEXT NOT NULL DEFAULT '',
+		created_by INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		last_used_at DATETIME
+	);
+
+	-- API requests per key and quota day, see service.DailyQuota
+	CREATE TABLE IF NOT EXISTS api_key_quota_usage (
+		api_key_id INTEGER NOT NULL,
+		day TEXT NOT NULL,
+		requests INTEGER NOT NULL,
+		PRIMARY KEY (api_key_id, day)
+	);
 	`
 	_, err := db.Exec(schema)
 	if err != nil {
@@ -130,6 +266,367 @@ func runMigrations(db *sql.DB) error {
 		}
 	}
 
+	// Migration: Add allowed_cidrs to api_keys
+	if !columnExists(db, "api_keys", "allowed_cidrs") {
+		_, err := db.Exec(`ALTER TABLE api_keys ADD COLUMN allowed_cidrs TEXT;`)
+		if err != nil {
+			return fmt.Errorf("failed to add allowed_cidrs column: %w", err)
+		}
+	}
+
+	// Migration: Add attributes to api_keys, bound to {_key.*} parameters
+	if !columnExists(db, "api_keys", "attributes") {
+		_, err := db.Exec(`ALTER TABLE api_keys ADD COLUMN attributes TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add attributes column: %w", err)
+		}
+	}
+
+	// Migration: Add mode to audit_logs
+	if !columnExists(db, "audit_logs", "mode") {
+		_, err := db.Exec(`ALTER TABLE audit_logs ADD COLUMN mode TEXT;`)
+		if err != nil {
+			return fmt.Errorf("failed to add mode column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "queries", "result_mode") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN result_mode TEXT NOT NULL DEFAULT 'rows';`)
+		if err != nil {
+			return fmt.Errorf("failed to add result_mode column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "queries", "shape_config") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN shape_config TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add shape_config column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "queries", "xml_root") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN xml_root TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add xml_root column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "connections", "dialect") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN dialect TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add dialect column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "connections", "credentials_enc") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN credentials_enc TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add credentials_enc column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "connections", "init_options") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN init_options TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add init_options column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "connections", "ping_query") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN ping_query TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add ping_query column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "connections", "skip_ping") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN skip_ping INTEGER NOT NULL DEFAULT 0;`)
+		if err != nil {
+			return fmt.Errorf("failed to add skip_ping column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "connections", "bind_mode") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN bind_mode TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add bind_mode column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "connections", "allowed_schemas") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN allowed_schemas TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add allowed_schemas column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "connections", "strip_comments") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN strip_comments INTEGER NOT NULL DEFAULT 0;`)
+		if err != nil {
+			return fmt.Errorf("failed to add strip_comments column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "connections", "production") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN production INTEGER NOT NULL DEFAULT 0;`)
+		if err != nil {
+			return fmt.Errorf("failed to add production column: %w", err)
+		}
+	}
+
+	// Objects seeded by demo mode or `dbbridge seed`, badged in the UI
+	for _, table := range []string{"connections", "queries", "api_keys"} {
+		if !columnExists(db, table, "is_demo") {
+			_, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN is_demo INTEGER NOT NULL DEFAULT 0;`, table))
+			if err != nil {
+				return fmt.Errorf("failed to add is_demo column to %s: %w", table, err)
+			}
+		}
+	}
+
+	if !columnExists(db, "queries", "skip_schema_check") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN skip_schema_check INTEGER NOT NULL DEFAULT 0;`)
+		if err != nil {
+			return fmt.Errorf("failed to add skip_schema_check column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "queries", "warn_duration_ms") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN warn_duration_ms INTEGER NOT NULL DEFAULT 0;`)
+		if err != nil {
+			return fmt.Errorf("failed to add warn_duration_ms column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "queries", "warn_rows") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN warn_rows INTEGER NOT NULL DEFAULT 0;`)
+		if err != nil {
+			return fmt.Errorf("failed to add warn_rows column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "queries", "record_example") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN record_example INTEGER NOT NULL DEFAULT 0;`)
+		if err != nil {
+			return fmt.Errorf("failed to add record_example column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "queries", "debug_capture") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN debug_capture INTEGER NOT NULL DEFAULT 0;`)
+		if err != nil {
+			return fmt.Errorf("failed to add debug_capture column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "queries", "debug_capture_values") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN debug_capture_values INTEGER NOT NULL DEFAULT 0;`)
+		if err != nil {
+			return fmt.Errorf("failed to add debug_capture_values column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "queries", "example") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN example TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add example column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "queries", "response_schema") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN response_schema TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add response_schema column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "queries", "response_config") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN response_config TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add response_config column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "queries", "exec_window") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN exec_window TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add exec_window column: %w", err)
+		}
+	}
+
+	// Audit log reads: the log and dashboard sort by timestamp, per-query,
+	// per-connection and per-key views filter first
+	for _, idx := range []string{
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_timestamp ON audit_logs (timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_query ON audit_logs (query_id, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_connection ON audit_logs (connection_id, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_api_key ON audit_logs (api_key_id, timestamp)`,
+	} {
+		if _, err := db.Exec(idx); err != nil {
+			return fmt.Errorf("failed to create audit log index: %w", err)
+		}
+	}
+
+	// Last-modified attribution. SQLite cannot add a column defaulting to
+	// CURRENT_TIMESTAMP, so rows created before this migration keep NULL times.
+	for _, table := range []string{"connections", "queries"} {
+		for _, col := range [][2]string{{"created_at", "DATETIME"}, {"updated_at", "DATETIME"}, {"updated_by", "TEXT NOT NULL DEFAULT ''"}} {
+			name := col[0]
+			if !columnExists(db, table, name) {
+				_, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s;`, table, name, col[1]))
+				if err != nil {
+					return fmt.Errorf("failed to add %s column to %s: %w", name, table, err)
+				}
+			}
+		}
+	}
+
+	// Migration: Add client_ip to audit_logs
+	if !columnExists(db, "audit_logs", "client_ip") {
+		_, err := db.Exec(`ALTER TABLE audit_logs ADD COLUMN client_ip TEXT;`)
+		if err != nil {
+			return fmt.Errorf("failed to add client_ip column: %w", err)
+		}
+	}
+
+	// Admin events (configuration changes, sign-ins) share the audit table;
+	// query executions leave event_type empty
+	if !columnExists(db, "audit_logs", "event_type") {
+		_, err := db.Exec(`ALTER TABLE audit_logs ADD COLUMN event_type TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add event_type column: %w", err)
+		}
+	}
+
+	if !columnExists(db, "audit_logs", "target") {
+		_, err := db.Exec(`ALTER TABLE audit_logs ADD COLUMN target TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add target column: %w", err)
+		}
+	}
+
+	// Admin UI language picked by the user, '' = DEFAULT_LOCALE
+	if !columnExists(db, "users", "locale") {
+		_, err := db.Exec(`ALTER TABLE users ADD COLUMN locale TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add locale column: %w", err)
+		}
+	}
+
+	// Environment label of a connection, for /api/env/{environment}/... routes
+	if !columnExists(db, "connections", "environment") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN environment TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add environment column: %w", err)
+		}
+	}
+
+	// Connections whose admin test runs have guardrails, see
+	// core.DBConnection.Protected
+	if !columnExists(db, "connections", "protected") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN protected INTEGER NOT NULL DEFAULT 0;`)
+		if err != nil {
+			return fmt.Errorf("failed to add protected column: %w", err)
+		}
+	}
+
+	// Deep health checks: a query the health monitor runs and the rule its
+	// result must meet
+	if !columnExists(db, "connections", "health_query") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN health_query TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add health_query column: %w", err)
+		}
+	}
+	if !columnExists(db, "connections", "health_rule") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN health_rule TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add health_rule column: %w", err)
+		}
+	}
+
+	// Connections listed with their health on the public /status page
+	if !columnExists(db, "connections", "show_on_status_page") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN show_on_status_page INTEGER NOT NULL DEFAULT 0;`)
+		if err != nil {
+			return fmt.Errorf("failed to add show_on_status_page column: %w", err)
+		}
+	}
+
+	// Parameters a connection gives every query, see service.ConnectionParams
+	if !columnExists(db, "connections", "default_params") {
+		_, err := db.Exec(`ALTER TABLE connections ADD COLUMN default_params TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add default_params column: %w", err)
+		}
+	}
+
+	// Connections and environments an API key may use, '' = all
+	if !columnExists(db, "api_keys", "scopes") {
+		_, err := db.Exec(`ALTER TABLE api_keys ADD COLUMN scopes TEXT NOT NULL DEFAULT '';`)
+		if err != nil {
+			return fmt.Errorf("failed to add scopes column: %w", err)
+		}
+	}
+
+	// Why a key was disabled other than by revocation, see core.ApiKey.DisabledReason
+	for _, col := range []struct{ name, def string }{
+		{"disabled_reason", "TEXT NOT NULL DEFAULT ''"},
+		{"reenabled_at", "DATETIME"},
+	} {
+		if !columnExists(db, "api_keys", col.name) {
+			_, err := db.Exec(fmt.Sprintf(`ALTER TABLE api_keys ADD COLUMN %s %s;`, col.name, col.def))
+			if err != nil {
+				return fmt.Errorf("failed to add %s column: %w", col.name, err)
+			}
+		}
+	}
+
+	// Response envelope of an API key's requests naming none, see core.EnvelopeV1
+	if !columnExists(db, "api_keys", "envelope") {
+		_, err := db.Exec(`ALTER TABLE api_keys ADD COLUMN envelope TEXT NOT NULL DEFAULT 'v2';`)
+		if err != nil {
+			return fmt.Errorf("failed to add envelope column: %w", err)
+		}
+	}
+
+	// Deprecation lifecycle of queries, see core.SavedQuery.Lifecycle
+	for _, col := range []struct{ name, def string }{
+		{"deprecated_at", "DATETIME"},
+		{"sunset_at", "DATETIME"},
+		{"superseded_by", "TEXT NOT NULL DEFAULT ''"},
+		{"sunset_message", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if !columnExists(db, "queries", col.name) {
+			_, err := db.Exec(fmt.Sprintf(`ALTER TABLE queries ADD COLUMN %s %s;`, col.name, col.def))
+			if err != nil {
+				return fmt.Errorf("failed to add %s column: %w", col.name, err)
+			}
+		}
+	}
+
+	// Data or admin keys, see core.ApiKey.Kind, and their expiry
+	if !columnExists(db, "api_keys", "kind") {
+		_, err := db.Exec(`ALTER TABLE api_keys ADD COLUMN kind TEXT NOT NULL DEFAULT 'data';`)
+		if err != nil {
+			return fmt.Errorf("failed to add kind column: %w", err)
+		}
+	}
+	if !columnExists(db, "api_keys", "expires_at") {
+		_, err := db.Exec(`ALTER TABLE api_keys ADD COLUMN expires_at DATETIME;`)
+		if err != nil {
+			return fmt.Errorf("failed to add expires_at column: %w", err)
+		}
+	}
+
+	// Queries whose SQL is encrypted at rest, see core.EncryptQuerySQL
+	if !columnExists(db, "queries", "confidential") {
+		_, err := db.Exec(`ALTER TABLE queries ADD COLUMN confidential INTEGER NOT NULL DEFAULT 0;`)
+		if err != nil {
+			return fmt.Errorf("failed to add confidential column: %w", err)
+		}
+	}
+
 	return nil
 }
 
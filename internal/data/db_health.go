@@ -0,0 +1,149 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dbHealthInterval = 15 * time.Second
+	dbProbeTimeout   = 5 * time.Second
+	// dbIdleConns is the idle pool size restored after a reopen, the
+	// database/sql default OpenDB keeps
+	dbIdleConns = 2
+)
+
+// DBHealth watches the metadata database file under the running process.
+// A file replaced, e.g. by restoring a backup, is reopened: the pooled
+// connections to the old file are dropped so new ones open the new file,
+// which is migrated. A file that is missing, locked by another process or
+// corrupt is reported by Status, and logged once when it starts and ends.
+type DBHealth struct {
+	db   *sql.DB
+	path string
+
+	mu      sync.Mutex
+	file    os.FileInfo // the file the pool has open, nil = none
+	status  core.MetadataStatus
+	pending string // a lock seen by the last check, reported if it persists
+}
+
+func NewDBHealth(db *sql.DB, path string) *DBHealth {
+	h := &DBHealth{db: db, path: path, status: core.MetadataStatus{State: core.MetadataOK, Since: time.Now()}}
+	h.file, _ = os.Stat(path)
+	return h
+}
+
+func (h *DBHealth) Status() core.MetadataStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+// Check probes the file and the database now, reopening a replaced file
+func (h *DBHealth) Check() core.MetadataStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state, msg := h.probe()
+	if state == core.MetadataLocked && h.pending != core.MetadataLocked {
+		// Locks come and go with every write; only one held across two
+		// checks is a problem
+		h.pending = state
+		return h.status
+	}
+	h.pending = ""
+	if state != h.status.State || msg != h.status.Message {
+		switch {
+		case state == core.MetadataOK:
+			logger.Info.Printf("Metadata database %s is available again", h.path)
+		case state != h.status.State:
+			logger.Error.Printf("Metadata database %s: %s", h.path, msg)
+		}
+		h.status = core.MetadataStatus{State: state, Message: msg, Since: time.Now()}
+	}
+	return h.status
+}
+
+func (h *DBHealth) probe() (string, string) {
+	fi, err := os.Stat(h.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return core.MetadataMissing, "the file is missing; restore it from a backup, or restart dbbridge to start over with an empty one"
+	}
+	if err != nil {
+		return core.MetadataError, err.Error()
+	}
+	if h.file == nil || !os.SameFile(h.file, fi) {
+		if state, msg := h.reopen(); state != core.MetadataOK {
+			return state, msg
+		}
+		if h.file != nil {
+			logger.Info.Printf("Metadata database %s was replaced and reopened", h.path)
+		}
+		h.file = fi
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbProbeTimeout)
+	defer cancel()
+	var tables int
+	if err := h.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master`).Scan(&tables); err != nil {
+		return classifyDBError(err)
+	}
+	return core.MetadataOK, ""
+}
+
+// reopen drops the pooled connections, which hold the replaced file open,
+// and migrates the new file if it is a dbbridge database
+func (h *DBHealth) reopen() (string, string) {
+	h.db.SetMaxIdleConns(0)
+	h.db.SetMaxIdleConns(dbIdleConns)
+
+	var users int
+	err := h.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'`).Scan(&users)
+	if err != nil {
+		return classifyDBError(err)
+	}
+	if users == 0 {
+		return core.MetadataMissing, "the file holds no dbbridge data; restore dbbridge.db from a backup"
+	}
+	if err := runMigrations(h.db); err != nil {
+		return core.MetadataError, fmt.Sprintf("migrating the new file failed: %v", err)
+	}
+	return core.MetadataOK, ""
+}
+
+// classifyDBError tells locks and corruption from other SQLite errors
+func classifyDBError(err error) (string, string) {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "database is locked") || strings.Contains(msg, "sqlite_busy") ||
+		errors.Is(err, context.DeadlineExceeded):
+		return core.MetadataLocked, "another process holds a lock on the file, such as a backup tool; requests fail until it lets go"
+	case strings.Contains(msg, "malformed") || strings.Contains(msg, "not a database") ||
+		strings.Contains(msg, "sqlite_corrupt") || strings.Contains(msg, "sqlite_notadb"):
+		return core.MetadataCorrupt, "the file is not a readable SQLite database; restore dbbridge.db from a backup"
+	}
+	return core.MetadataError, err.Error()
+}
+
+// Run checks every dbHealthInterval until ctx is cancelled
+func (h *DBHealth) Run(ctx context.Context) {
+	ticker := time.NewTicker(dbHealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.Check()
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDBHealthRecoversReplacedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dbbridge.db")
+	db, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	users := NewUserRepo(db)
+	if _, err := users.CreateUser("old", "x"); err != nil {
+		t.Fatal(err)
+	}
+	health := NewDBHealth(db, path)
+	if s := health.Check(); !s.OK() {
+		t.Fatalf("fresh database: %+v", s)
+	}
+
+	// A backup with other users restored over the file
+	backupPath := filepath.Join(dir, "backup.db")
+	backup, err := OpenDB(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewUserRepo(backup).CreateUser("restored", "x"); err != nil {
+		t.Fatal(err)
+	}
+	backup.Close()
+	if err := os.Rename(backupPath, path); err != nil {
+		t.Fatal(err)
+	}
+	if s := health.Check(); !s.OK() {
+		t.Fatalf("after the swap: %+v", s)
+	}
+	if _, err := users.GetUserByUsername("restored"); err != nil {
+		t.Errorf("restored user not found after the reopen: %v", err)
+	}
+	if _, err := users.GetUserByUsername("old"); err == nil {
+		t.Error("user of the replaced file still found")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if s := health.Check(); s.State != core.MetadataMissing {
+		t.Errorf("removed file: %+v, want missing", s)
+	}
+	if err := os.WriteFile(path, []byte("not a database, just some text that is long enough to hold a header"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if s := health.Check(); s.State != core.MetadataCorrupt || health.Status().State != core.MetadataCorrupt {
+		t.Errorf("garbage file: %+v, want corrupt", s)
+	}
+}
+
+func TestDBHealthLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dbbridge.db")
+	db, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	health := NewDBHealth(db, path)
+
+	// Another process, such as a backup tool, holding an exclusive lock
+	other, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	conn, err := other.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(context.Background(), `BEGIN EXCLUSIVE`); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := health.Check(); !s.OK() {
+		t.Errorf("first locked check: %+v, want still ok", s)
+	}
+	if s := health.Check(); s.State != core.MetadataLocked {
+		t.Errorf("lock held across checks: %+v, want locked", s)
+	}
+	conn.ExecContext(context.Background(), `ROLLBACK`)
+	conn.Close()
+	if s := health.Check(); !s.OK() {
+		t.Errorf("lock released: %+v", s)
+	}
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"database/sql"
+	"dbbridge/internal/core"
+	"time"
+)
+
+type EmbedTokenRepo struct {
+	db *sql.DB
+}
+
+func NewEmbedTokenRepo(db *sql.DB) *EmbedTokenRepo {
+	return &EmbedTokenRepo{db: db}
+}
+
+const embedTokenColumns = `id, query_id, connection_id, params, row_cap, label, created_by, created_at, expires_at, revoked_at, last_used_at`
+
+func (r *EmbedTokenRepo) Create(t *core.EmbedToken) error {
+	res, err := r.db.Exec(`INSERT INTO embed_tokens (query_id, connection_id, params, row_cap, label, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, t.QueryID, t.ConnectionID, t.Params, t.RowCap, t.Label, t.CreatedBy, t.CreatedAt, t.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	t.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *EmbedTokenRepo) GetByID(id int64) (*core.EmbedToken, error) {
+	return scanEmbedToken(r.db.QueryRow(`SELECT `+embedTokenColumns+` FROM embed_tokens WHERE id = ?`, id))
+}
+
+func (r *EmbedTokenRepo) ListByQuery(queryID int64) ([]core.EmbedToken, error) {
+	rows, err := r.db.Query(`SELECT `+embedTokenColumns+` FROM embed_tokens WHERE query_id = ? ORDER BY id DESC`, queryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tokens []core.EmbedToken
+	for rows.Next() {
+		t, err := scanEmbedToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *EmbedTokenRepo) Revoke(id int64) error {
+	_, err := r.db.Exec(`UPDATE embed_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now(), id)
+	return err
+}
+
+func (r *EmbedTokenRepo) UpdateLastUsed(id int64) error {
+	_, err := r.db.Exec(`UPDATE embed_tokens SET last_used_at = ? WHERE id = ?`, time.Now(), id)
+	return err
+}
+
+func scanEmbedToken(row interface {
+	Scan(dest ...interface{}) error
+}) (*core.EmbedToken, error) {
+	var t core.EmbedToken
+	var revoked, lastUsed sql.NullTime
+	if err := row.Scan(&t.ID, &t.QueryID, &t.ConnectionID, &t.Params, &t.RowCap, &t.Label, &t.CreatedBy,
+		&t.CreatedAt, &t.ExpiresAt, &revoked, &lastUsed); err != nil {
+		return nil, err
+	}
+	if revoked.Valid {
+		t.RevokedAt = &revoked.Time
+	}
+	if lastUsed.Valid {
+		t.LastUsedAt = &lastUsed.Time
+	}
+	return &t, nil
+}
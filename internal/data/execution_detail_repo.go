@@ -0,0 +1,62 @@
+package data
+
+import (
+	"database/sql"
+	"dbbridge/internal/core"
+	"encoding/json"
+	"errors"
+)
+
+type ExecutionDetailRepo struct {
+	db     *sql.DB
+	cipher *MetadataCipher // nil = stored as plaintext
+}
+
+func NewExecutionDetailRepo(db *sql.DB) *ExecutionDetailRepo {
+	return &ExecutionDetailRepo{db: db}
+}
+
+// SetCipher encrypts the SQL when the query_sql group is on and the argument
+// values when the audit_params group is
+func (r *ExecutionDetailRepo) SetCipher(c *MetadataCipher) {
+	r.cipher = c
+}
+
+func (r *ExecutionDetailRepo) Add(d *core.ExecutionDetail) error {
+	types, err := json.Marshal(d.ArgTypes)
+	if err != nil {
+		return err
+	}
+	sqlText, err := r.cipher.seal(core.EncryptQuerySQL, d.SQL)
+	if err != nil {
+		return err
+	}
+	values, err := r.cipher.seal(core.EncryptAuditParams, d.ArgValues)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT OR REPLACE INTO execution_details (audit_id, sql_text, arg_types, arg_values) VALUES (?, ?, ?, ?)`,
+		d.AuditID, sqlText, string(types), values)
+	return err
+}
+
+func (r *ExecutionDetailRepo) Get(auditID int64) (*core.ExecutionDetail, error) {
+	d := core.ExecutionDetail{AuditID: auditID}
+	var types string
+	err := r.db.QueryRow(`SELECT sql_text, arg_types, arg_values FROM execution_details WHERE audit_id = ?`, auditID).
+		Scan(&d.SQL, &types, &d.ArgValues)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.SQL = r.cipher.open(d.SQL)
+	d.ArgValues = r.cipher.open(d.ArgValues)
+	if types != "" {
+		if err := json.Unmarshal([]byte(types), &d.ArgTypes); err != nil {
+			return nil, err
+		}
+	}
+	return &d, nil
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"database/sql"
+	"dbbridge/internal/core"
+	"sync"
+	"time"
+)
+
+type IdempotencyRepo struct {
+	db *sql.DB
+	mu sync.Mutex // serializes the writes
+}
+
+func NewIdempotencyRepo(db *sql.DB) *IdempotencyRepo {
+	return &IdempotencyRepo{db: db}
+}
+
+// Claim inserts rec unless its (api_key_id, key) primary key is taken, and
+// reads the row that holds it otherwise. Claims are serialized so concurrent
+// retries of one key do not race each other into SQLITE_BUSY; exactly one of
+// them stores its record. An expired record is replaced.
+func (r *IdempotencyRepo) Claim(rec *core.IdempotencyRecord) (*core.IdempotencyRecord, error) {
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE api_key_id = ? AND key = ? AND expires_at < ?`,
+		rec.ApiKeyID, rec.Key, rec.CreatedAt.Unix()); err != nil {
+		return nil, err
+	}
+	res, err := r.db.Exec(`INSERT INTO idempotency_keys (api_key_id, key, request_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (api_key_id, key) DO NOTHING`,
+		rec.ApiKeyID, rec.Key, rec.RequestHash, rec.CreatedAt.Unix(), rec.ExpiresAt.Unix())
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return nil, nil
+	}
+
+	var existing core.IdempotencyRecord
+	var created, expires int64
+	err = r.db.QueryRow(`SELECT api_key_id, key, request_hash, status_code, headers, body, created_at, expires_at FROM idempotency_keys WHERE api_key_id = ? AND key = ?`,
+		rec.ApiKeyID, rec.Key).Scan(&existing.ApiKeyID, &existing.Key, &existing.RequestHash, &existing.StatusCode,
+		&existing.Headers, &existing.Body, &created, &expires)
+	if err != nil {
+		return nil, err
+	}
+	existing.CreatedAt, existing.ExpiresAt = time.Unix(created, 0), time.Unix(expires, 0)
+	return &existing, nil
+}
+
+func (r *IdempotencyRepo) Complete(rec *core.IdempotencyRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.db.Exec(`UPDATE idempotency_keys SET status_code = ?, headers = ?, body = ? WHERE api_key_id = ? AND key = ?`,
+		rec.StatusCode, rec.Headers, rec.Body, rec.ApiKeyID, rec.Key)
+	return err
+}
+
+func (r *IdempotencyRepo) Release(apiKeyID int64, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE api_key_id = ? AND key = ?`, apiKeyID, key)
+	return err
+}
@@ -0,0 +1,682 @@
+// Package memory implements the core repository interfaces in memory, for
+// tests and embedders that don't need SQL behind them. Lookups of missing
+// rows fail with sql.ErrNoRows like the SQLite repositories, and rows are
+// copied in and out. Nothing is ever evicted.
+package memory
+
+import (
+	"database/sql"
+	"dbbridge/internal/core"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Users is an in-memory core.UserRepository
+type Users struct {
+	mu    sync.Mutex
+	users []core.User
+}
+
+var _ core.UserRepository = (*Users)(nil)
+
+func (r *Users) CreateUser(username, passwordHash string) (*core.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Username == username {
+			return nil, errUnique("users.username")
+		}
+	}
+	u := core.User{ID: int64(len(r.users) + 1), Username: username, PasswordHash: passwordHash, IsActive: true, CreatedAt: time.Now()}
+	r.users = append(r.users, u)
+	return &u, nil
+}
+
+func (r *Users) GetUserByUsername(username string) (*core.User, error) {
+	return r.find(func(u core.User) bool { return u.Username == username })
+}
+
+func (r *Users) GetByID(id int64) (*core.User, error) {
+	return r.find(func(u core.User) bool { return u.ID == id })
+}
+
+func (r *Users) find(match func(core.User) bool) (*core.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.ID != 0 && match(u) {
+			return &u, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *Users) GetAll() ([]core.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var users []core.User
+	for _, u := range r.users {
+		if u.ID != 0 {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (r *Users) Update(user *core.User) error {
+	return r.update(user.ID, func(u *core.User) { *u = *user })
+}
+
+func (r *Users) SetLocale(id int64, locale string) error {
+	return r.update(id, func(u *core.User) { u.Locale = locale })
+}
+
+func (r *Users) Delete(id int64) error {
+	// Deleted users keep their slot so ids are not reused
+	return r.update(id, func(u *core.User) { *u = core.User{} })
+}
+
+func (r *Users) update(id int64, fn func(*core.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.users {
+		if r.users[i].ID == id {
+			fn(&r.users[i])
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *Users) CountUsers() (int, error) {
+	users, _ := r.GetAll()
+	return len(users), nil
+}
+
+// The API key methods of UserRepository are placeholders in the SQLite
+// repository as well; keys live in an ApiKeyRepository.
+
+func (r *Users) CreateApiKey(userID int64, keyPrefix, keyHash string) (*core.ApiKey, error) {
+	return nil, nil
+}
+
+func (r *Users) GetApiKeyByHash(keyHash string) (*core.ApiKey, error) {
+	return nil, nil
+}
+
+func (r *Users) ValidateApiKey(plainKey string) (*core.User, error) {
+	return nil, nil
+}
+
+// APIKeys is an in-memory core.ApiKeyRepository
+type APIKeys struct {
+	mu   sync.Mutex
+	keys []core.ApiKey
+}
+
+var _ core.ApiKeyRepository = (*APIKeys)(nil)
+
+func (r *APIKeys) Create(key *core.ApiKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key.ID = int64(len(r.keys) + 1)
+	r.keys = append(r.keys, *key)
+	return nil
+}
+
+func (r *APIKeys) List() ([]core.ApiKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]core.ApiKey, len(r.keys))
+	for i, k := range r.keys {
+		// Newest first, like the SQLite repository
+		keys[len(keys)-1-i] = k
+	}
+	return keys, nil
+}
+
+// GetByHash returns nil, nil for unknown and revoked keys
+func (r *APIKeys) GetByHash(hash string) (*core.ApiKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range r.keys {
+		if k.KeyHash == hash && k.IsActive {
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *APIKeys) Revoke(id int64) error {
+	return r.update(id, func(k *core.ApiKey) { k.IsActive, k.DisabledReason = false, "" })
+}
+
+func (r *APIKeys) DisableInactive(id int64) error {
+	return r.update(id, func(k *core.ApiKey) {
+		if k.IsActive {
+			k.IsActive, k.DisabledReason = false, core.ApiKeyDisabledInactive
+		}
+	})
+}
+
+func (r *APIKeys) Reenable(id int64) error {
+	now := time.Now()
+	return r.update(id, func(k *core.ApiKey) {
+		if k.AutoDisabled() {
+			k.IsActive, k.DisabledReason, k.ReenabledAt = true, "", &now
+		}
+	})
+}
+
+func (r *APIKeys) UpdateAllowedCIDRs(id int64, cidrs string) error {
+	return r.update(id, func(k *core.ApiKey) { k.AllowedCIDRs = cidrs })
+}
+
+func (r *APIKeys) UpdateAttributes(id int64, attributes string) error {
+	return r.update(id, func(k *core.ApiKey) { k.Attributes = attributes })
+}
+
+func (r *APIKeys) UpdateScopes(id int64, scopes string) error {
+	return r.update(id, func(k *core.ApiKey) { k.Scopes = scopes })
+}
+
+func (r *APIKeys) UpdateEnvelope(id int64, envelope string) error {
+	return r.update(id, func(k *core.ApiKey) { k.Envelope = envelope })
+}
+
+func (r *APIKeys) UpdateLastUsed(id int64) error {
+	now := time.Now()
+	return r.update(id, func(k *core.ApiKey) { k.LastUsedAt = &now })
+}
+
+func (r *APIKeys) update(id int64, fn func(*core.ApiKey)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.keys {
+		if r.keys[i].ID == id {
+			fn(&r.keys[i])
+		}
+	}
+	return nil
+}
+
+// Connections is an in-memory core.ConnectionRepository
+type Connections struct {
+	mu     sync.Mutex
+	nextID int64
+	conns  []core.DBConnection
+}
+
+var _ core.ConnectionRepository = (*Connections)(nil)
+
+func (r *Connections) Create(conn *core.DBConnection) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.conns {
+		if c.Name == conn.Name {
+			return errUnique("connections.name")
+		}
+	}
+	r.nextID++
+	now := time.Now()
+	conn.ID = r.nextID
+	conn.CreatedAt, conn.UpdatedAt = &now, &now
+	r.conns = append(r.conns, *conn)
+	return nil
+}
+
+func (r *Connections) GetAll() ([]core.DBConnection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]core.DBConnection(nil), r.conns...), nil
+}
+
+func (r *Connections) GetByID(id int64) (*core.DBConnection, error) {
+	return r.find(func(c core.DBConnection) bool { return c.ID == id })
+}
+
+func (r *Connections) GetByName(name string) (*core.DBConnection, error) {
+	return r.find(func(c core.DBConnection) bool { return c.Name == name })
+}
+
+func (r *Connections) find(match func(core.DBConnection) bool) (*core.DBConnection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.conns {
+		if match(c) {
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *Connections) Update(conn *core.DBConnection) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.conns {
+		if r.conns[i].ID == conn.ID {
+			now := time.Now()
+			conn.CreatedAt, conn.UpdatedAt = r.conns[i].CreatedAt, &now
+			r.conns[i] = *conn
+		}
+	}
+	return nil
+}
+
+func (r *Connections) Delete(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.conns {
+		if r.conns[i].ID == id {
+			r.conns = append(r.conns[:i], r.conns[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Queries is an in-memory core.QueryRepository
+type Queries struct {
+	mu      sync.Mutex
+	nextID  int64
+	queries []core.SavedQuery
+	aliases []core.QuerySlugAlias
+}
+
+var _ core.QueryRepository = (*Queries)(nil)
+
+func (r *Queries) Create(q *core.SavedQuery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.queries {
+		if existing.Slug == q.Slug {
+			return errUnique("queries.slug")
+		}
+	}
+	r.nextID++
+	now := time.Now()
+	q.ID = r.nextID
+	q.ResultMode = core.NormalizeResultMode(q.ResultMode)
+	q.CreatedAt, q.UpdatedAt = &now, &now
+	r.queries = append(r.queries, copyQuery(*q))
+	return nil
+}
+
+func (r *Queries) GetAll() ([]core.SavedQuery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queries := make([]core.SavedQuery, len(r.queries))
+	for i, q := range r.queries {
+		queries[i] = copyQuery(q)
+	}
+	return queries, nil
+}
+
+func (r *Queries) GetByID(id int64) (*core.SavedQuery, error) {
+	return r.find(func(q core.SavedQuery) bool { return q.ID == id })
+}
+
+func (r *Queries) GetBySlug(slug string) (*core.SavedQuery, error) {
+	q, err := r.find(func(q core.SavedQuery) bool { return q.Slug == slug })
+	if err != sql.ErrNoRows {
+		return q, err
+	}
+	r.mu.Lock()
+	id := int64(0)
+	for _, a := range r.aliases {
+		if a.Slug == slug {
+			id = a.QueryID
+		}
+	}
+	r.mu.Unlock()
+	return r.find(func(q core.SavedQuery) bool { return id != 0 && q.ID == id })
+}
+
+func (r *Queries) find(match func(core.SavedQuery) bool) (*core.SavedQuery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, q := range r.queries {
+		if match(q) {
+			q = copyQuery(q)
+			return &q, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *Queries) Update(q *core.SavedQuery) error {
+	return r.update(q.ID, func(stored *core.SavedQuery) {
+		now := time.Now()
+		// Like the SQL UPDATE: the example, the response schema and the demo
+		// flag are kept
+		q.Example, q.ResponseSchema, q.IsDemo = stored.Example, stored.ResponseSchema, stored.IsDemo
+		q.ResultMode = core.NormalizeResultMode(q.ResultMode)
+		q.CreatedAt, q.UpdatedAt = stored.CreatedAt, &now
+		if stored.Slug != q.Slug {
+			r.dropAliases(func(a core.QuerySlugAlias) bool { return a.Slug == q.Slug || a.Slug == stored.Slug })
+			r.aliases = append(r.aliases, core.QuerySlugAlias{Slug: stored.Slug, QueryID: q.ID, CreatedAt: now})
+		}
+		*stored = copyQuery(*q)
+	})
+}
+
+func (r *Queries) UpdateExample(id int64, example string) error {
+	return r.update(id, func(q *core.SavedQuery) { q.Example = example })
+}
+
+func (r *Queries) UpdateResponseSchema(id int64, schema string) error {
+	return r.update(id, func(q *core.SavedQuery) { q.ResponseSchema = schema })
+}
+
+func (r *Queries) update(id int64, fn func(*core.SavedQuery)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.queries {
+		if r.queries[i].ID == id {
+			fn(&r.queries[i])
+		}
+	}
+	return nil
+}
+
+func (r *Queries) Delete(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.queries {
+		if r.queries[i].ID == id {
+			r.queries = append(r.queries[:i], r.queries[i+1:]...)
+			break
+		}
+	}
+	r.dropAliases(func(a core.QuerySlugAlias) bool { return a.QueryID == id })
+	return nil
+}
+
+func (r *Queries) ListAliases(queryID int64) ([]core.QuerySlugAlias, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var aliases []core.QuerySlugAlias
+	for _, a := range r.aliases {
+		if a.QueryID == queryID {
+			aliases = append(aliases, a)
+		}
+	}
+	return aliases, nil
+}
+
+func (r *Queries) DeleteAlias(slug string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dropAliases(func(a core.QuerySlugAlias) bool { return a.Slug == slug })
+	return nil
+}
+
+// dropAliases removes the aliases matching drop; r.mu must be held
+func (r *Queries) dropAliases(drop func(core.QuerySlugAlias) bool) {
+	kept := r.aliases[:0]
+	for _, a := range r.aliases {
+		if !drop(a) {
+			kept = append(kept, a)
+		}
+	}
+	r.aliases = kept
+}
+
+func copyQuery(q core.SavedQuery) core.SavedQuery {
+	q.AllowedConnectionIDs = append([]int64(nil), q.AllowedConnectionIDs...)
+	return q
+}
+
+// Audit is an in-memory core.AuditRepository
+type Audit struct {
+	mu      sync.Mutex
+	logs    []core.AuditLog
+	cursors map[string]int64
+}
+
+var _ core.AuditRepository = (*Audit)(nil)
+
+func (r *Audit) Create(l *core.AuditLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l.ID = int64(len(r.logs) + 1)
+	r.logs = append(r.logs, *l)
+	return nil
+}
+
+// Logs returns the entries written so far, oldest first
+func (r *Audit) Logs() []core.AuditLog {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]core.AuditLog(nil), r.logs...)
+}
+
+func (r *Audit) GetRecent(limit int) ([]core.AuditLog, error) {
+	return r.ListRecent(limit, "", 0, 0)
+}
+
+func (r *Audit) GetByID(id int64) (*core.AuditLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id < 1 || id > int64(len(r.logs)) {
+		return nil, sql.ErrNoRows
+	}
+	l := r.logs[id-1]
+	return &l, nil
+}
+
+// ListRecent narrows by user and by event type prefix, enough for the
+// category filters; the AuditFilter* constants are not applied
+func (r *Audit) ListRecent(limit int, filter string, userID int64, beforeID int64) ([]core.AuditLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var logs []core.AuditLog
+	for i := len(r.logs) - 1; i >= 0 && len(logs) < limit; i-- {
+		l := r.logs[i]
+		if (beforeID != 0 && l.ID >= beforeID) || (userID != 0 && l.UserID != userID) ||
+			(filter != "" && !strings.HasPrefix(l.EventType, filter)) {
+			continue
+		}
+		logs = append(logs, l)
+	}
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Timestamp.After(logs[j].Timestamp) })
+	return logs, nil
+}
+
+func (r *Audit) ListAfter(afterID int64, limit int) ([]core.AuditLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var logs []core.AuditLog
+	for _, l := range r.logs {
+		if l.ID > afterID && len(logs) < limit {
+			logs = append(logs, l)
+		}
+	}
+	return logs, nil
+}
+
+func (r *Audit) GetForwardCursor(sink string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cursors[sink], nil
+}
+
+func (r *Audit) SetForwardCursor(sink string, lastID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cursors == nil {
+		r.cursors = map[string]int64{}
+	}
+	r.cursors[sink] = lastID
+	return nil
+}
+
+// Settings is an in-memory core.SettingsRepository
+type Settings struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+var _ core.SettingsRepository = (*Settings)(nil)
+
+func (r *Settings) GetAll() (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := make(map[string]string, len(r.values))
+	for k, v := range r.values {
+		all[k] = v
+	}
+	return all, nil
+}
+
+func (r *Settings) Set(key, value string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values == nil {
+		r.values = map[string]string{}
+	}
+	r.values[key] = value
+	return nil
+}
+
+func (r *Settings) Delete(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.values, key)
+	return nil
+}
+
+// Details is an in-memory core.ExecutionDetailRepository
+type Details struct {
+	mu      sync.Mutex
+	details map[int64]core.ExecutionDetail
+}
+
+var _ core.ExecutionDetailRepository = (*Details)(nil)
+
+func (r *Details) Add(d *core.ExecutionDetail) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.details == nil {
+		r.details = map[int64]core.ExecutionDetail{}
+	}
+	r.details[d.AuditID] = *d
+	return nil
+}
+
+func (r *Details) Get(auditID int64) (*core.ExecutionDetail, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.details[auditID]
+	if !ok {
+		return nil, nil
+	}
+	return &d, nil
+}
+
+// AccessEvents is an in-memory core.AccessEventRepository
+type AccessEvents struct {
+	mu     sync.Mutex
+	nextID int64
+	events []core.AccessEvent
+}
+
+var _ core.AccessEventRepository = (*AccessEvents)(nil)
+
+func (r *AccessEvents) CreateBatch(events []*core.AccessEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range events {
+		r.nextID++
+		e.ID = r.nextID
+		r.events = append(r.events, *e)
+	}
+	return nil
+}
+
+func (r *AccessEvents) List(filter core.AccessEventFilter, limit int, beforeID int64) ([]core.AccessEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []core.AccessEvent
+	for i := len(r.events) - 1; i >= 0 && len(events) < limit; i-- {
+		e := r.events[i]
+		if (beforeID != 0 && e.ID >= beforeID) ||
+			(filter.MinStatus != 0 && e.Status < filter.MinStatus) ||
+			(filter.MaxStatus != 0 && e.Status > filter.MaxStatus) ||
+			!strings.Contains(e.Path, filter.Path) ||
+			(filter.KeyPrefix != "" && e.KeyPrefix != filter.KeyPrefix) ||
+			(filter.ClientIP != "" && e.ClientIP != filter.ClientIP) ||
+			(filter.Code != "" && e.Code != filter.Code) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (r *AccessEvents) DeleteBefore(t time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.events[:0]
+	for _, e := range r.events {
+		if !e.Timestamp.Before(t) {
+			kept = append(kept, e)
+		}
+	}
+	n := int64(len(r.events) - len(kept))
+	r.events = kept
+	return n, nil
+}
+
+// Quota is an in-memory core.QuotaRepository
+type Quota struct {
+	mu   sync.Mutex
+	days map[string]map[int64]int64
+}
+
+var _ core.QuotaRepository = (*Quota)(nil)
+
+func (r *Quota) Add(usage []core.QuotaUsage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.days == nil {
+		r.days = make(map[string]map[int64]int64)
+	}
+	for _, u := range usage {
+		if r.days[u.Day] == nil {
+			r.days[u.Day] = make(map[int64]int64)
+		}
+		r.days[u.Day][u.ApiKeyID] += u.Requests
+	}
+	return nil
+}
+
+func (r *Quota) Day(day string) (map[int64]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[int64]int64, len(r.days[day]))
+	for k, n := range r.days[day] {
+		counts[k] = n
+	}
+	return counts, nil
+}
+
+func (r *Quota) DeleteBefore(day string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for d := range r.days {
+		if d < day {
+			delete(r.days, d)
+		}
+	}
+	return nil
+}
+
+// errUnique mimics the error of SQLite's UNIQUE constraints
+type errUnique string
+
+func (e errUnique) Error() string {
+	return "constraint failed: UNIQUE constraint failed: " + string(e)
+}
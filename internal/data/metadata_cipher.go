@@ -0,0 +1,144 @@
+package data
+
+import (
+	"database/sql"
+	"dbbridge/internal/core"
+	"strings"
+)
+
+// encryptedPrefix marks an encrypted metadata value. Values without it are
+// plaintext, written before encryption was turned on, and read as stored.
+const encryptedPrefix = "enc:v1:"
+
+// MetadataCipher encrypts the columns of the core.EncryptGroups turned on
+// before they are stored, and decrypts every encrypted value read, whatever
+// the groups: turning a group off leaves its rows readable. Encrypted values
+// are opaque to SQL, so LIKE and equality filters on them match nothing.
+type MetadataCipher struct {
+	cipher core.Cipher
+	groups map[string]bool
+}
+
+func NewMetadataCipher(cipher core.Cipher, groups []string) *MetadataCipher {
+	m := &MetadataCipher{cipher: cipher, groups: make(map[string]bool)}
+	for _, g := range groups {
+		m.groups[g] = true
+	}
+	return m
+}
+
+// Encrypts reports whether group is encrypted
+func (m *MetadataCipher) Encrypts(group string) bool {
+	return m != nil && m.groups[group]
+}
+
+// seal encrypts s for storage when group is on. A nil MetadataCipher
+// stores plaintext.
+func (m *MetadataCipher) seal(group, s string) (string, error) {
+	if !m.Encrypts(group) || s == "" || strings.HasPrefix(s, encryptedPrefix) {
+		return s, nil
+	}
+	enc, err := m.cipher.Encrypt(s)
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + enc, nil
+}
+
+// open decrypts a stored value. One it cannot decrypt, without the cipher
+// or under another DBBRIDGE_KEY, is returned as stored rather than failing
+// the whole listing.
+func (m *MetadataCipher) open(s string) string {
+	if m == nil || !strings.HasPrefix(s, encryptedPrefix) {
+		return s
+	}
+	plain, err := m.cipher.Decrypt(strings.TrimPrefix(s, encryptedPrefix))
+	if err != nil {
+		return s
+	}
+	return plain
+}
+
+// metadataColumns are the columns of each group, with the key of their
+// table and the condition on the rows that are encrypted
+var metadataColumns = []struct {
+	group, table, key, column, where string
+}{
+	{core.EncryptAuditParams, "audit_logs", "id", "params", ""},
+	{core.EncryptAuditParams, "execution_details", "audit_id", "arg_values", ""},
+	{core.EncryptQuerySQL, "queries", "id", "sql_text", "confidential = 1"},
+	{core.EncryptQuerySQL, "execution_details", "audit_id", "sql_text", ""},
+	{core.EncryptAPIKeyDescriptions, "api_keys", "id", "description", ""},
+}
+
+// EncryptMetadata encrypts the plaintext values left in the columns of the
+// groups m has on, written before they were, and returns how many were
+// encrypted per group. Each column is converted in one transaction, so a
+// failure leaves its rows as they were; running it again picks up where it
+// stopped.
+func EncryptMetadata(db *sql.DB, m *MetadataCipher) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, c := range metadataColumns {
+		if !m.Encrypts(c.group) {
+			continue
+		}
+		n, err := encryptColumn(db, m, c.group, c.table, c.key, c.column, c.where)
+		if err != nil {
+			return counts, err
+		}
+		counts[c.group] += n
+	}
+	return counts, nil
+}
+
+func encryptColumn(db *sql.DB, m *MetadataCipher, group, table, key, column, where string) (int, error) {
+	query := `SELECT ` + key + `, ` + column + ` FROM ` + table + ` WHERE ` + column + ` <> '' AND ` + column + ` NOT LIKE '` + encryptedPrefix + `%'`
+	if where != "" {
+		query += ` AND ` + where
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Read everything first: SQLite runs one statement at a time on a
+	// transaction's connection
+	type row struct {
+		id    int64
+		value string
+	}
+	rows, err := tx.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	var plain []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		plain = append(plain, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(`UPDATE ` + table + ` SET ` + column + ` = ? WHERE ` + key + ` = ?`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, r := range plain {
+		enc, err := m.seal(group, r.value)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := stmt.Exec(enc, r.id); err != nil {
+			return 0, err
+		}
+	}
+	return len(plain), tx.Commit()
+}
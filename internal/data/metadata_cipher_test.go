@@ -0,0 +1,171 @@
+package data
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCipher(t *testing.T, key string, groups ...string) *MetadataCipher {
+	t.Helper()
+	crypto, err := service.NewEncryptionService(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewMetadataCipher(crypto, groups)
+}
+
+func TestMetadataCipherRoundTrip(t *testing.T) {
+	audit := openTestDB(t)
+	cipher := testCipher(t, strings.Repeat("k", 32), core.EncryptGroups...)
+	audit.SetCipher(cipher)
+	keys := NewApiKeyRepo(audit.db)
+	keys.SetCipher(cipher)
+	queries := NewQueryRepo(audit.db)
+	queries.SetCipher(cipher)
+	details := NewExecutionDetailRepo(audit.db)
+	details.SetCipher(cipher)
+
+	key := &core.ApiKey{UserID: 1, KeyPrefix: "dbb_abc", KeyHash: "h", Description: "payroll export", CreatedAt: time.Now(), IsActive: true}
+	if err := keys.Create(key); err != nil {
+		t.Fatal(err)
+	}
+	secret := &core.SavedQuery{Slug: "salaries", SQLText: "SELECT salary FROM staff", Confidential: true}
+	open := &core.SavedQuery{Slug: "products", SQLText: "SELECT name FROM products"}
+	for _, q := range []*core.SavedQuery{secret, open} {
+		if err := queries.Create(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entry := &core.AuditLog{Timestamp: time.Now(), ApiKeyID: &key.ID, Status: "SUCCESS", Params: `{"ssn":"123"}`}
+	if err := audit.Create(entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Params != `{"ssn":"123"}` {
+		t.Errorf("Create changed the entry's params to %q", entry.Params)
+	}
+	detail := &core.ExecutionDetail{AuditID: entry.ID, SQL: "SELECT salary FROM staff WHERE ssn = ?", ArgTypes: []string{"string"}, ArgValues: `["123"]`}
+	if err := details.Add(detail); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := func(query string, args ...interface{}) string {
+		t.Helper()
+		var v string
+		if err := audit.db.QueryRow(query, args...).Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for name, v := range map[string]string{
+		"description":  stored(`SELECT description FROM api_keys WHERE id = ?`, key.ID),
+		"sql_text":     stored(`SELECT sql_text FROM queries WHERE id = ?`, secret.ID),
+		"params":       stored(`SELECT params FROM audit_logs WHERE id = ?`, entry.ID),
+		"captured SQL": stored(`SELECT sql_text FROM execution_details WHERE audit_id = ?`, entry.ID),
+		"arg_values":   stored(`SELECT arg_values FROM execution_details WHERE audit_id = ?`, entry.ID),
+	} {
+		if !strings.HasPrefix(v, encryptedPrefix) {
+			t.Errorf("%s stored as %q, want it encrypted", name, v)
+		}
+	}
+	if v := stored(`SELECT sql_text FROM queries WHERE id = ?`, open.ID); v != open.SQLText {
+		t.Errorf("SQL of a query not confidential stored as %q", v)
+	}
+
+	got, err := queries.GetBySlug("salaries")
+	if err != nil || got.SQLText != secret.SQLText || !got.Confidential {
+		t.Fatalf("GetBySlug = %+v, %v", got, err)
+	}
+	list, err := keys.List()
+	if err != nil || len(list) != 1 || list[0].Description != "payroll export" {
+		t.Fatalf("List = %+v, %v", list, err)
+	}
+	logs, err := audit.ListRecent(10, "", 0, 0)
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("ListRecent = %d entries, %v", len(logs), err)
+	}
+	if logs[0].Params != `{"ssn":"123"}` || logs[0].ApiKeyPrefix != "dbb_abc... (payroll export)" {
+		t.Errorf("audit entry read as params %q, key %q", logs[0].Params, logs[0].ApiKeyPrefix)
+	}
+	if got, err := details.Get(entry.ID); err != nil || got.SQL != detail.SQL || got.ArgValues != detail.ArgValues {
+		t.Errorf("execution detail read as %+v, %v", got, err)
+	}
+
+	// Filters in SQL no longer see the values
+	var n int
+	audit.db.QueryRow(`SELECT COUNT(*) FROM queries WHERE sql_text LIKE '%salary%'`).Scan(&n)
+	if n != 0 {
+		t.Error("LIKE matched encrypted SQL")
+	}
+
+	// Under another key the stored value is shown instead of failing the read
+	other := NewQueryRepo(audit.db)
+	other.SetCipher(testCipher(t, strings.Repeat("x", 32)))
+	if got, err := other.GetByID(secret.ID); err != nil || !strings.HasPrefix(got.SQLText, encryptedPrefix) {
+		t.Errorf("GetByID with another key = %+v, %v", got, err)
+	}
+}
+
+func TestEncryptMetadata(t *testing.T) {
+	audit := openTestDB(t)
+	keys := NewApiKeyRepo(audit.db)
+	queries := NewQueryRepo(audit.db)
+
+	// Written before encryption was turned on
+	key := &core.ApiKey{UserID: 1, KeyPrefix: "dbb_abc", KeyHash: "h", Description: "billing", CreatedAt: time.Now(), IsActive: true}
+	if err := keys.Create(key); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []*core.SavedQuery{
+		{Slug: "salaries", SQLText: "SELECT salary FROM staff", Confidential: true},
+		{Slug: "products", SQLText: "SELECT name FROM products"},
+	} {
+		if err := queries.Create(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, params := range []string{`{"id":1}`, `{"id":2}`, ""} {
+		if err := audit.Create(&core.AuditLog{Timestamp: time.Now(), Status: "SUCCESS", Params: params}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	details := NewExecutionDetailRepo(audit.db)
+	if err := details.Add(&core.ExecutionDetail{AuditID: 1, SQL: "SELECT salary FROM staff WHERE id = ?", ArgValues: "[1]"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cipher := testCipher(t, strings.Repeat("k", 32), core.EncryptAuditParams, core.EncryptQuerySQL)
+	counts, err := EncryptMetadata(audit.db, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{core.EncryptAuditParams: 3, core.EncryptQuerySQL: 2}
+	if len(counts) != len(want) || counts[core.EncryptAuditParams] != 3 || counts[core.EncryptQuerySQL] != 2 {
+		t.Errorf("counts = %v, want %v", counts, want)
+	}
+	var desc string
+	audit.db.QueryRow(`SELECT description FROM api_keys WHERE id = ?`, key.ID).Scan(&desc)
+	if desc != "billing" {
+		t.Errorf("description of a group not listed stored as %q", desc)
+	}
+	var captured, values string
+	audit.db.QueryRow(`SELECT sql_text, arg_values FROM execution_details WHERE audit_id = 1`).Scan(&captured, &values)
+	if !strings.HasPrefix(captured, encryptedPrefix) || !strings.HasPrefix(values, encryptedPrefix) {
+		t.Errorf("execution detail stored as %q, %q, want it encrypted", captured, values)
+	}
+
+	// Converted rows read back, and a second run has nothing left to do
+	queries.SetCipher(cipher)
+	if q, err := queries.GetBySlug("salaries"); err != nil || q.SQLText != "SELECT salary FROM staff" {
+		t.Errorf("GetBySlug = %+v, %v", q, err)
+	}
+	details.SetCipher(cipher)
+	if d, err := details.Get(1); err != nil || d.ArgValues != "[1]" {
+		t.Errorf("Get = %+v, %v", d, err)
+	}
+	if counts, err = EncryptMetadata(audit.db, cipher); err != nil || counts[core.EncryptAuditParams] != 0 || counts[core.EncryptQuerySQL] != 0 {
+		t.Errorf("second run = %v, %v", counts, err)
+	}
+}
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"database/sql"
+	"dbbridge/internal/core"
+	"fmt"
+)
+
+// orphanCheck counts and fixes one category of orphaned rows. Audit entries
+// keep their history and only lose the dangling reference: ids are reset to
+// 0, which the audit log treats as none, and API keys to NULL. Checks run in
+// order, so the audit entries of API keys deleted by the first are cleared
+// by the last.
+type orphanCheck struct {
+	category, description, action string
+	where                         string // rows of table that are orphaned
+	table, fix                    string // fix is the SET clause, "" = delete
+}
+
+var orphanChecks = []orphanCheck{
+	{"api_keys", "API keys of deleted users", "deleted",
+		`user_id NOT IN (SELECT id FROM users)`, "api_keys", ""},
+	{"query_connections", "Query links to deleted queries or connections", "deleted",
+		`query_id NOT IN (SELECT id FROM queries) OR connection_id NOT IN (SELECT id FROM connections)`, "query_connections", ""},
+	{"audit_queries", "Audit entries referencing deleted queries", "query reference cleared",
+		`query_id != 0 AND query_id NOT IN (SELECT id FROM queries)`, "audit_logs", "query_id = 0"},
+	{"audit_connections", "Audit entries referencing deleted connections", "connection reference cleared",
+		`connection_id != 0 AND connection_id NOT IN (SELECT id FROM connections)`, "audit_logs", "connection_id = 0"},
+	{"audit_api_keys", "Audit entries referencing deleted API keys", "API key reference cleared",
+		`api_key_id IS NOT NULL AND api_key_id NOT IN (SELECT id FROM api_keys)`, "audit_logs", "api_key_id = NULL"},
+	{"idempotency_keys", "Expired idempotency keys and those of deleted API keys", "deleted",
+		`expires_at < CAST(strftime('%s', 'now') AS INTEGER) OR api_key_id NOT IN (SELECT id FROM api_keys)`, "idempotency_keys", ""},
+	{"connection_usage", "Usage statistics of deleted connections", "deleted",
+		`connection_id NOT IN (SELECT id FROM connections)`, "connection_usage", ""},
+}
+
+func (c orphanCheck) result(count int64) core.OrphanCount {
+	return core.OrphanCount{Category: c.category, Description: c.description, Action: c.action, Count: count}
+}
+
+type OrphanRepo struct {
+	db *sql.DB
+}
+
+func NewOrphanRepo(db *sql.DB) *OrphanRepo {
+	return &OrphanRepo{db: db}
+}
+
+func (r *OrphanRepo) CountOrphans() ([]core.OrphanCount, error) {
+	counts := make([]core.OrphanCount, 0, len(orphanChecks))
+	for _, c := range orphanChecks {
+		var n int64
+		if err := r.db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, c.table, c.where)).Scan(&n); err != nil {
+			return nil, fmt.Errorf("%s: %w", c.category, err)
+		}
+		counts = append(counts, c.result(n))
+	}
+	return counts, nil
+}
+
+func (r *OrphanRepo) CleanOrphans(dryRun bool) ([]core.OrphanCount, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	counts := make([]core.OrphanCount, 0, len(orphanChecks))
+	for _, c := range orphanChecks {
+		stmt := fmt.Sprintf(`DELETE FROM %s WHERE %s`, c.table, c.where)
+		if c.fix != "" {
+			stmt = fmt.Sprintf(`UPDATE %s SET %s WHERE %s`, c.table, c.fix, c.where)
+		}
+		res, err := tx.Exec(stmt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.category, err)
+		}
+		n, _ := res.RowsAffected()
+		counts = append(counts, c.result(n))
+	}
+	if dryRun {
+		return counts, nil
+	}
+	return counts, tx.Commit()
+}
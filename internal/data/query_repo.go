@@ -3,24 +3,47 @@ package data
 import (
 	"database/sql"
 	"dbbridge/internal/core"
+	"time"
 )
 
 type QueryRepo struct {
-	db *sql.DB
+	db     *sql.DB
+	cipher *MetadataCipher // nil = SQL stored as plaintext
 }
 
 func NewQueryRepo(db *sql.DB) *QueryRepo {
 	return &QueryRepo{db: db}
 }
 
+// SetCipher encrypts the SQL of confidential queries when the query_sql
+// group is on
+func (r *QueryRepo) SetCipher(c *MetadataCipher) {
+	r.cipher = c
+}
+
+// sealSQL is the sql_text stored for q
+func (r *QueryRepo) sealSQL(q *core.SavedQuery) (string, error) {
+	if !q.Confidential {
+		return q.SQLText, nil
+	}
+	return r.cipher.seal(core.EncryptQuerySQL, q.SQLText)
+}
+
 func (r *QueryRepo) Create(q *core.SavedQuery) error {
-	res, err := r.db.Exec(`INSERT INTO queries (slug, description, sql_text, params_config, is_active) VALUES (?, ?, ?, ?, ?)`,
-		q.Slug, q.Description, q.SQLText, q.ParamsConfig, q.IsActive)
+	sqlText, err := r.sealSQL(q)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	res, err := r.db.Exec(`INSERT INTO queries (slug, description, sql_text, params_config, is_active, result_mode, shape_config, xml_root, response_config, exec_window, skip_schema_check, warn_duration_ms, warn_rows, record_example, example, response_schema, debug_capture, debug_capture_values, confidential, is_demo, deprecated_at, sunset_at, superseded_by, sunset_message, created_at, updated_at, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		q.Slug, q.Description, sqlText, q.ParamsConfig, q.IsActive, core.NormalizeResultMode(q.ResultMode), q.ShapeConfig, q.XMLRoot, q.ResponseConfig, q.ExecWindow, q.SkipSchemaCheck, q.WarnDurationMs, q.WarnRows, q.RecordExample, q.Example, q.ResponseSchema, q.DebugCapture, q.DebugCaptureValues, q.Confidential, q.IsDemo,
+		q.DeprecatedAt, q.SunsetAt, q.SupersededBy, q.SunsetMessage, now, now, q.UpdatedBy)
 	if err != nil {
 		return err
 	}
 	id, _ := res.LastInsertId()
 	q.ID = id
+	q.CreatedAt, q.UpdatedAt = &now, &now
 
 	return r.updateLinks(q.ID, q.AllowedConnectionIDs)
 }
@@ -28,12 +51,17 @@ func (r *QueryRepo) Create(q *core.SavedQuery) error {
 func (r *QueryRepo) GetByID(id int64) (*core.SavedQuery, error) {
 	var q core.SavedQuery
 	var isActive int
-	err := r.db.QueryRow(`SELECT id, slug, description, sql_text, params_config, is_active FROM queries WHERE id = ?`, id).
-		Scan(&q.ID, &q.Slug, &q.Description, &q.SQLText, &q.ParamsConfig, &isActive)
+	var createdAt, updatedAt, deprecatedAt, sunsetAt sql.NullTime
+	err := r.db.QueryRow(`SELECT id, slug, description, sql_text, params_config, is_active, result_mode, shape_config, xml_root, response_config, exec_window, skip_schema_check, warn_duration_ms, warn_rows, record_example, example, response_schema, debug_capture, debug_capture_values, confidential, is_demo, deprecated_at, sunset_at, superseded_by, sunset_message, created_at, updated_at, updated_by FROM queries WHERE id = ?`, id).
+		Scan(&q.ID, &q.Slug, &q.Description, &q.SQLText, &q.ParamsConfig, &isActive, &q.ResultMode, &q.ShapeConfig, &q.XMLRoot, &q.ResponseConfig, &q.ExecWindow, &q.SkipSchemaCheck, &q.WarnDurationMs, &q.WarnRows, &q.RecordExample, &q.Example, &q.ResponseSchema, &q.DebugCapture, &q.DebugCaptureValues, &q.Confidential, &q.IsDemo,
+			&deprecatedAt, &sunsetAt, &q.SupersededBy, &q.SunsetMessage, &createdAt, &updatedAt, &q.UpdatedBy)
 	if err != nil {
 		return nil, err
 	}
 	q.IsActive = isActive == 1
+	q.SQLText = r.cipher.open(q.SQLText)
+	q.CreatedAt, q.UpdatedAt = timePtr(createdAt), timePtr(updatedAt)
+	q.DeprecatedAt, q.SunsetAt = timePtr(deprecatedAt), timePtr(sunsetAt)
 
 	q.AllowedConnectionIDs, err = r.getLinks(q.ID)
 	if err != nil {
@@ -43,15 +71,34 @@ func (r *QueryRepo) GetByID(id int64) (*core.SavedQuery, error) {
 	return &q, nil
 }
 
+// GetBySlug returns the query whose slug is slug, else the query slug is an
+// alias of
 func (r *QueryRepo) GetBySlug(slug string) (*core.SavedQuery, error) {
+	q, err := r.getBySlug(slug)
+	if err != sql.ErrNoRows {
+		return q, err
+	}
+	var id int64
+	if err := r.db.QueryRow(`SELECT query_id FROM query_slug_aliases WHERE slug = ?`, slug).Scan(&id); err != nil {
+		return nil, err
+	}
+	return r.GetByID(id)
+}
+
+func (r *QueryRepo) getBySlug(slug string) (*core.SavedQuery, error) {
 	var q core.SavedQuery
 	var isActive int
-	err := r.db.QueryRow(`SELECT id, slug, description, sql_text, params_config, is_active FROM queries WHERE slug = ?`, slug).
-		Scan(&q.ID, &q.Slug, &q.Description, &q.SQLText, &q.ParamsConfig, &isActive)
+	var createdAt, updatedAt, deprecatedAt, sunsetAt sql.NullTime
+	err := r.db.QueryRow(`SELECT id, slug, description, sql_text, params_config, is_active, result_mode, shape_config, xml_root, response_config, exec_window, skip_schema_check, warn_duration_ms, warn_rows, record_example, example, response_schema, debug_capture, debug_capture_values, confidential, is_demo, deprecated_at, sunset_at, superseded_by, sunset_message, created_at, updated_at, updated_by FROM queries WHERE slug = ?`, slug).
+		Scan(&q.ID, &q.Slug, &q.Description, &q.SQLText, &q.ParamsConfig, &isActive, &q.ResultMode, &q.ShapeConfig, &q.XMLRoot, &q.ResponseConfig, &q.ExecWindow, &q.SkipSchemaCheck, &q.WarnDurationMs, &q.WarnRows, &q.RecordExample, &q.Example, &q.ResponseSchema, &q.DebugCapture, &q.DebugCaptureValues, &q.Confidential, &q.IsDemo,
+			&deprecatedAt, &sunsetAt, &q.SupersededBy, &q.SunsetMessage, &createdAt, &updatedAt, &q.UpdatedBy)
 	if err != nil {
 		return nil, err
 	}
 	q.IsActive = isActive == 1
+	q.SQLText = r.cipher.open(q.SQLText)
+	q.CreatedAt, q.UpdatedAt = timePtr(createdAt), timePtr(updatedAt)
+	q.DeprecatedAt, q.SunsetAt = timePtr(deprecatedAt), timePtr(sunsetAt)
 
 	q.AllowedConnectionIDs, err = r.getLinks(q.ID)
 	if err != nil {
@@ -62,7 +109,7 @@ func (r *QueryRepo) GetBySlug(slug string) (*core.SavedQuery, error) {
 }
 
 func (r *QueryRepo) GetAll() ([]core.SavedQuery, error) {
-	rows, err := r.db.Query(`SELECT id, slug, description, sql_text, params_config, is_active FROM queries`)
+	rows, err := r.db.Query(`SELECT id, slug, description, sql_text, params_config, is_active, result_mode, shape_config, xml_root, response_config, exec_window, skip_schema_check, warn_duration_ms, warn_rows, record_example, example, response_schema, debug_capture, debug_capture_values, confidential, is_demo, deprecated_at, sunset_at, superseded_by, sunset_message, created_at, updated_at, updated_by FROM queries ORDER BY updated_at IS NULL, updated_at DESC, id`)
 	if err != nil {
 		return nil, err
 	}
@@ -72,10 +119,15 @@ func (r *QueryRepo) GetAll() ([]core.SavedQuery, error) {
 	for rows.Next() {
 		var q core.SavedQuery
 		var isActive int
-		if err := rows.Scan(&q.ID, &q.Slug, &q.Description, &q.SQLText, &q.ParamsConfig, &isActive); err != nil {
+		var createdAt, updatedAt, deprecatedAt, sunsetAt sql.NullTime
+		if err := rows.Scan(&q.ID, &q.Slug, &q.Description, &q.SQLText, &q.ParamsConfig, &isActive, &q.ResultMode, &q.ShapeConfig, &q.XMLRoot, &q.ResponseConfig, &q.ExecWindow, &q.SkipSchemaCheck, &q.WarnDurationMs, &q.WarnRows, &q.RecordExample, &q.Example, &q.ResponseSchema, &q.DebugCapture, &q.DebugCaptureValues, &q.Confidential, &q.IsDemo,
+			&deprecatedAt, &sunsetAt, &q.SupersededBy, &q.SunsetMessage, &createdAt, &updatedAt, &q.UpdatedBy); err != nil {
 			return nil, err
 		}
 		q.IsActive = isActive == 1
+		q.SQLText = r.cipher.open(q.SQLText)
+		q.CreatedAt, q.UpdatedAt = timePtr(createdAt), timePtr(updatedAt)
+		q.DeprecatedAt, q.SunsetAt = timePtr(deprecatedAt), timePtr(sunsetAt)
 
 		// Optimization: fetch links in loop (N+1) but fine for small scale.
 		// Better: Fetch all links and map. For now keep simple.
@@ -86,15 +138,48 @@ func (r *QueryRepo) GetAll() ([]core.SavedQuery, error) {
 	return queries, nil
 }
 
+// Update saves q; when its slug changed the old one becomes an alias, and an
+// alias matching the new slug is dropped
 func (r *QueryRepo) Update(q *core.SavedQuery) error {
-	_, err := r.db.Exec(`UPDATE queries SET slug=?, description=?, sql_text=?, params_config=?, is_active=? WHERE id=?`,
-		q.Slug, q.Description, q.SQLText, q.ParamsConfig, q.IsActive, q.ID)
+	var oldSlug string
+	if err := r.db.QueryRow(`SELECT slug FROM queries WHERE id = ?`, q.ID).Scan(&oldSlug); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	sqlText, err := r.sealSQL(q)
 	if err != nil {
 		return err
 	}
+	_, err = r.db.Exec(`UPDATE queries SET slug=?, description=?, sql_text=?, params_config=?, is_active=?, result_mode=?, shape_config=?, xml_root=?, response_config=?, exec_window=?, skip_schema_check=?, warn_duration_ms=?, warn_rows=?, record_example=?, debug_capture=?, debug_capture_values=?, confidential=?, deprecated_at=?, sunset_at=?, superseded_by=?, sunset_message=?, updated_at=?, updated_by=? WHERE id=?`,
+		q.Slug, q.Description, sqlText, q.ParamsConfig, q.IsActive, core.NormalizeResultMode(q.ResultMode), q.ShapeConfig, q.XMLRoot, q.ResponseConfig, q.ExecWindow, q.SkipSchemaCheck, q.WarnDurationMs, q.WarnRows, q.RecordExample, q.DebugCapture, q.DebugCaptureValues, q.Confidential,
+		q.DeprecatedAt, q.SunsetAt, q.SupersededBy, q.SunsetMessage, time.Now(), q.UpdatedBy, q.ID)
+	if err != nil {
+		return err
+	}
+	if oldSlug != "" && oldSlug != q.Slug {
+		if _, err := r.db.Exec(`DELETE FROM query_slug_aliases WHERE slug = ?`, q.Slug); err != nil {
+			return err
+		}
+		if _, err := r.db.Exec(`INSERT OR REPLACE INTO query_slug_aliases (slug, query_id, created_at) VALUES (?, ?, ?)`, oldSlug, q.ID, time.Now()); err != nil {
+			return err
+		}
+	}
 	return r.updateLinks(q.ID, q.AllowedConnectionIDs)
 }
 
+// UpdateExample stores a query's recorded example, "" to clear it. Recording
+// is not an edit of the query, so the modification stamp is kept.
+func (r *QueryRepo) UpdateExample(id int64, example string) error {
+	_, err := r.db.Exec(`UPDATE queries SET example=? WHERE id=?`, example, id)
+	return err
+}
+
+// UpdateResponseSchema stores a query's captured response schema, "" to clear
+// it. Like UpdateExample it keeps the modification stamp.
+func (r *QueryRepo) UpdateResponseSchema(id int64, schema string) error {
+	_, err := r.db.Exec(`UPDATE queries SET response_schema=? WHERE id=?`, schema, id)
+	return err
+}
+
 func (r *QueryRepo) Delete(id int64) error {
 	// Cascade delete should handle links, but let's be safe/explicit if needed.
 	// SQLite FKs need enabling. Assuming they are enabled or we rely on them.
@@ -102,10 +187,36 @@ func (r *QueryRepo) Delete(id int64) error {
 	// Verify if PRAGMA foreign_keys = ON is set? It's not default in SQLite.
 	// Let's manually delete links first to be sure.
 	r.db.Exec(`DELETE FROM query_connections WHERE query_id=?`, id)
+	r.db.Exec(`DELETE FROM query_slug_aliases WHERE query_id=?`, id)
 	_, err := r.db.Exec(`DELETE FROM queries WHERE id=?`, id)
 	return err
 }
 
+func (r *QueryRepo) ListAliases(queryID int64) ([]core.QuerySlugAlias, error) {
+	rows, err := r.db.Query(`SELECT slug, query_id, created_at FROM query_slug_aliases WHERE query_id = ? ORDER BY created_at, slug`, queryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []core.QuerySlugAlias
+	for rows.Next() {
+		var a core.QuerySlugAlias
+		if err := rows.Scan(&a.Slug, &a.QueryID, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, a)
+	}
+	return aliases, rows.Err()
+}
+
+// DeleteAlias retires an alias: its slug no longer resolves and can be
+// reused
+func (r *QueryRepo) DeleteAlias(slug string) error {
+	_, err := r.db.Exec(`DELETE FROM query_slug_aliases WHERE slug = ?`, slug)
+	return err
+}
+
 // Helper methods for links
 func (r *QueryRepo) updateLinks(queryID int64, connIDs []int64) error {
 	// Transaction?
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"database/sql"
+	"dbbridge/internal/core"
+)
+
+type QuotaRepo struct {
+	db *sql.DB
+}
+
+func NewQuotaRepo(db *sql.DB) *QuotaRepo {
+	return &QuotaRepo{db: db}
+}
+
+// Add adds the requests in one transaction, so several instances sharing the
+// database add up rather than overwrite each other
+func (r *QuotaRepo) Add(usage []core.QuotaUsage) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO api_key_quota_usage (api_key_id, day, requests) VALUES (?, ?, ?)
+		ON CONFLICT(api_key_id, day) DO UPDATE SET requests = requests + excluded.requests`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, u := range usage {
+		if _, err := stmt.Exec(u.ApiKeyID, u.Day, u.Requests); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *QuotaRepo) Day(day string) (map[int64]int64, error) {
+	rows, err := r.db.Query(`SELECT api_key_id, requests FROM api_key_quota_usage WHERE day = ?`, day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[int64]int64)
+	for rows.Next() {
+		var keyID, n int64
+		if err := rows.Scan(&keyID, &n); err != nil {
+			return nil, err
+		}
+		counts[keyID] = n
+	}
+	return counts, rows.Err()
+}
+
+func (r *QuotaRepo) DeleteBefore(day string) error {
+	_, err := r.db.Exec(`DELETE FROM api_key_quota_usage WHERE day < ?`, day)
+	return err
+}
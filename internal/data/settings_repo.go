@@ -0,0 +1,44 @@
+package data
+
+import (
+	"database/sql"
+	"time"
+)
+
+type SettingsRepo struct {
+	db *sql.DB
+}
+
+func NewSettingsRepo(db *sql.DB) *SettingsRepo {
+	return &SettingsRepo{db: db}
+}
+
+func (r *SettingsRepo) GetAll() (map[string]string, error) {
+	rows, err := r.db.Query(`SELECT key, value FROM settings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, rows.Err()
+}
+
+func (r *SettingsRepo) Set(key, value string) error {
+	_, err := r.db.Exec(`INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		key, value, time.Now())
+	return err
+}
+
+func (r *SettingsRepo) Delete(key string) error {
+	_, err := r.db.Exec(`DELETE FROM settings WHERE key = ?`, key)
+	return err
+}
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"database/sql"
+	"dbbridge/internal/core"
+	"math"
+	"time"
+)
+
+// usageHour is the hour key of connection_usage. Audit timestamps are
+// stored as text starting with the time in the server's zone, so their first
+// 13 characters are their hour.
+const usageHour = "2006-01-02 15"
+
+// usageExecutions are the audit entries counted as executions: not admin
+// events, nor the summaries of benchmarks and diffs, nor health checks
+const usageExecutions = `event_type = '' AND connection_id <> 0 AND status NOT IN ('BENCHMARK', 'DIFF') AND COALESCE(mode, '') <> 'healthcheck'`
+
+type UsageRepo struct {
+	db *sql.DB
+}
+
+func NewUsageRepo(db *sql.DB) *UsageRepo {
+	return &UsageRepo{db: db}
+}
+
+// rolledUntil returns the end of the last hour rolled up, zero for none
+func (r *UsageRepo) rolledUntil() (time.Time, error) {
+	var last sql.NullString
+	if err := r.db.QueryRow(`SELECT MAX(hour) FROM connection_usage`).Scan(&last); err != nil || !last.Valid {
+		return time.Time{}, err
+	}
+	t, err := time.ParseInLocation(usageHour, last.String, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Add(time.Hour), nil
+}
+
+func (r *UsageRepo) Rollup(until time.Time) (int64, error) {
+	from, err := r.rolledUntil()
+	if err != nil || !until.After(from) {
+		return 0, err
+	}
+	res, err := r.db.Exec(`INSERT INTO connection_usage (connection_id, hour, executions, duration_ms)
+		SELECT connection_id, substr(timestamp, 1, 13), COUNT(*), COALESCE(SUM(duration_ms), 0) FROM audit_logs
+		WHERE timestamp >= ? AND timestamp < ? AND `+usageExecutions+`
+		GROUP BY connection_id, substr(timestamp, 1, 13)`, from.In(time.Local), until.In(time.Local))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *UsageRepo) Hourly(connectionID int64, from, to time.Time) ([]core.ConnectionUsage, error) {
+	from, to = from.In(time.Local), to.In(time.Local)
+	rolled, err := r.rolledUntil()
+	if err != nil {
+		return nil, err
+	}
+	usage, err := r.scan(connectionID, `SELECT hour, executions, duration_ms FROM connection_usage
+		WHERE connection_id = ? AND hour >= ? AND hour < ? ORDER BY hour`,
+		connectionID, from.Format(usageHour), to.Format(usageHour))
+	if err != nil {
+		return nil, err
+	}
+	if rolled.After(from) {
+		from = rolled
+	}
+	live, err := r.scan(connectionID, `SELECT substr(timestamp, 1, 13) AS hour, COUNT(*), COALESCE(SUM(duration_ms), 0) FROM audit_logs
+		WHERE connection_id = ? AND timestamp >= ? AND timestamp < ? AND `+usageExecutions+`
+		GROUP BY hour ORDER BY hour`, connectionID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(usage, live...), nil
+}
+
+// queryStatsExecutions are the executions of a query that reached the
+// database, leaving out denied, cancelled and out-of-window calls
+const queryStatsExecutions = `query_id = ? AND timestamp >= ? AND timestamp < ? AND status IN ('SUCCESS', 'WARN', 'ERROR') AND ` + usageExecutions
+
+func (r *UsageRepo) QueryStats(queryID int64, from, to time.Time) (core.ExecutionStats, error) {
+	from, to = from.In(time.Local), to.In(time.Local)
+	var s core.ExecutionStats
+	err := r.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(status = 'ERROR'), 0) FROM audit_logs WHERE `+queryStatsExecutions,
+		queryID, from, to).Scan(&s.Executions, &s.Errors)
+	if err != nil || s.Executions == 0 {
+		return s, err
+	}
+	// Nearest-rank percentiles, each sorting the rows the (query_id, timestamp)
+	// index finds
+	for _, p := range []struct {
+		rank float64
+		ms   *int64
+	}{{0.50, &s.P50Ms}, {0.95, &s.P95Ms}, {0.99, &s.P99Ms}} {
+		offset := int64(math.Ceil(p.rank*float64(s.Executions))) - 1
+		if err := r.db.QueryRow(`SELECT duration_ms FROM audit_logs WHERE `+queryStatsExecutions+` ORDER BY duration_ms LIMIT 1 OFFSET ?`,
+			queryID, from, to, offset).Scan(p.ms); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+func (r *UsageRepo) scan(connectionID int64, query string, args ...interface{}) ([]core.ConnectionUsage, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var usage []core.ConnectionUsage
+	for rows.Next() {
+		u := core.ConnectionUsage{ConnectionID: connectionID}
+		var hour string
+		if err := rows.Scan(&hour, &u.Executions, &u.DurationMs); err != nil {
+			return nil, err
+		}
+		if u.Hour, err = time.ParseInLocation(usageHour, hour, time.Local); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"dbbridge/internal/core"
+	"testing"
+	"time"
+)
+
+func TestUsageRollup(t *testing.T) {
+	audit := openTestDB(t)
+	repo := NewUsageRepo(audit.db)
+	day := time.Date(2024, 5, 6, 0, 0, 0, 0, time.Local)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	for _, e := range []struct {
+		ts         time.Time
+		conn       int64
+		durationMs int64
+		status     string
+		eventType  string
+		mode       string
+	}{
+		{at(9, 10), 1, 10, "SUCCESS", "", ""},
+		{at(9, 40), 1, 30, "ERROR", "", ""},
+		{at(9, 15), 2, 5, "SUCCESS", "", ""},
+		{at(9, 20), 1, 0, "SUCCESS", "connection.update", ""},
+		{at(9, 30), 1, 900, "BENCHMARK", "", ""},
+		{at(9, 50), 1, 15, "SUCCESS", "", "healthcheck"},
+		{at(10, 5), 1, 20, "SUCCESS", "", ""},
+	} {
+		if _, err := audit.db.Exec(`INSERT INTO audit_logs (timestamp, user_id, connection_id, query_id, duration_ms, status, error_message, event_type, mode) VALUES (?, 0, ?, 0, ?, ?, '', ?, ?)`,
+			e.ts, e.conn, e.durationMs, e.status, e.eventType, e.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(when string) {
+		t.Helper()
+		usage, err := repo.Hourly(1, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(usage) != 2 || !usage[0].Hour.Equal(at(9, 0)) || usage[0].Executions != 2 || usage[0].DurationMs != 40 ||
+			!usage[1].Hour.Equal(at(10, 0)) || usage[1].Executions != 1 || usage[1].DurationMs != 20 {
+			t.Errorf("%s: usage = %+v, want 2 executions at 9 and 1 at 10", when, usage)
+		}
+	}
+	check("before the rollup")
+	if n, err := repo.Rollup(at(10, 0)); err != nil || n != 2 {
+		t.Fatalf("rollup to 10:00 = %d, %v; want 2 rows", n, err)
+	}
+	check("rolled up to 10:00")
+	if n, err := repo.Rollup(at(10, 0)); err != nil || n != 0 {
+		t.Errorf("repeated rollup = %d, %v; want nothing", n, err)
+	}
+	if n, err := repo.Rollup(at(11, 0)); err != nil || n != 1 {
+		t.Fatalf("rollup to 11:00 = %d, %v; want 1 row", n, err)
+	}
+	check("rolled up to 11:00")
+
+	// Rolled up hours outlive the audit retention
+	if _, err := audit.db.Exec(`DELETE FROM audit_logs`); err != nil {
+		t.Fatal(err)
+	}
+	check("after the audit log was pruned")
+}
+
+func TestQueryStats(t *testing.T) {
+	audit := openTestDB(t)
+	repo := NewUsageRepo(audit.db)
+	from := time.Date(2024, 5, 6, 9, 0, 0, 0, time.Local)
+	insert := func(minute int, query, durationMs int64, status, mode string) {
+		t.Helper()
+		if _, err := audit.db.Exec(`INSERT INTO audit_logs (timestamp, user_id, connection_id, query_id, duration_ms, status, error_message, event_type, mode) VALUES (?, 0, 1, ?, ?, ?, '', '', ?)`,
+			from.Add(time.Duration(minute)*time.Minute), query, durationMs, status, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := int64(1); i <= 10; i++ {
+		status := "SUCCESS"
+		if i == 3 {
+			status = "ERROR"
+		}
+		insert(int(i), 7, i*10, status, "")
+	}
+	insert(20, 7, 5000, "DENIED", "")
+	insert(21, 7, 5000, "SUCCESS", "healthcheck")
+	insert(22, 8, 5000, "SUCCESS", "")
+	insert(90, 7, 5000, "SUCCESS", "")
+
+	stats, err := repo.QueryStats(7, from, from.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := core.ExecutionStats{Executions: 10, Errors: 1, P50Ms: 50, P95Ms: 100, P99Ms: 100}
+	if stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+	if stats, err := repo.QueryStats(7, from.Add(-time.Hour), from); err != nil || stats != (core.ExecutionStats{}) {
+		t.Errorf("empty range = %+v, %v", stats, err)
+	}
+}
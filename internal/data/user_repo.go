@@ -28,8 +28,8 @@ func (r *UserRepo) CreateUser(username, passwordHash string) (*core.User, error)
 func (r *UserRepo) GetUserByUsername(username string) (*core.User, error) {
 	var u core.User
 	var isActive int
-	err := r.db.QueryRow(`SELECT id, username, password_hash, is_active, created_at FROM users WHERE username = ?`, username).
-		Scan(&u.ID, &u.Username, &u.PasswordHash, &isActive, &u.CreatedAt)
+	err := r.db.QueryRow(`SELECT id, username, password_hash, is_active, created_at, locale FROM users WHERE username = ?`, username).
+		Scan(&u.ID, &u.Username, &u.PasswordHash, &isActive, &u.CreatedAt, &u.Locale)
 	if err != nil {
 		return nil, err
 	}
@@ -40,8 +40,8 @@ func (r *UserRepo) GetUserByUsername(username string) (*core.User, error) {
 func (r *UserRepo) GetByID(id int64) (*core.User, error) {
 	var u core.User
 	var isActive int
-	err := r.db.QueryRow(`SELECT id, username, password_hash, is_active, created_at FROM users WHERE id = ?`, id).
-		Scan(&u.ID, &u.Username, &u.PasswordHash, &isActive, &u.CreatedAt)
+	err := r.db.QueryRow(`SELECT id, username, password_hash, is_active, created_at, locale FROM users WHERE id = ?`, id).
+		Scan(&u.ID, &u.Username, &u.PasswordHash, &isActive, &u.CreatedAt, &u.Locale)
 	if err != nil {
 		return nil, err
 	}
@@ -81,6 +81,12 @@ func (r *UserRepo) Update(u *core.User) error {
 	return err
 }
 
+// SetLocale saves the user's admin UI language
+func (r *UserRepo) SetLocale(id int64, locale string) error {
+	_, err := r.db.Exec(`UPDATE users SET locale=? WHERE id=?`, locale, id)
+	return err
+}
+
 func (r *UserRepo) Delete(id int64) error {
 	_, err := r.db.Exec(`DELETE FROM users WHERE id=?`, id)
 	return err
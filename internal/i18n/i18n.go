@@ -0,0 +1,81 @@
+// Package i18n holds the message catalog of the admin UI and email
+// notifications. API responses and logs are not localized.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultLocale is the locale every message exists in, used for any key a
+// locale lacks
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// catalogs maps locale to message key to message. Messages are fmt formats
+// when the caller passes arguments.
+var catalogs = loadCatalogs()
+
+func loadCatalogs() map[string]map[string]string {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	catalogs := make(map[string]map[string]string, len(entries))
+	for _, e := range entries {
+		raw, err := localeFiles.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", e.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(e.Name(), ".json")] = messages
+	}
+	return catalogs
+}
+
+// Locales lists the supported locales, sorted
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Normalize returns the supported locale for a tag such as "id" or "id-ID",
+// "" when it is not supported
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if base, _, ok := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-"); ok {
+		tag = base
+	}
+	if _, ok := catalogs[tag]; ok {
+		return tag
+	}
+	return ""
+}
+
+// T returns the message for key in locale, falling back to English and then
+// to the key itself. With args the message is formatted like fmt.Sprintf.
+func T(locale, key string, args ...interface{}) string {
+	msg, ok := catalogs[locale][key]
+	if !ok {
+		if msg, ok = catalogs[DefaultLocale][key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
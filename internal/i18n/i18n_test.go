@@ -0,0 +1,50 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+)
+
+// verbs matches the fmt verbs of a message, so translations take the same arguments
+var verbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestCatalogsMatchEnglish(t *testing.T) {
+	en := catalogs[DefaultLocale]
+	for _, locale := range Locales() {
+		for key, msg := range catalogs[locale] {
+			base, ok := en[key]
+			if !ok {
+				t.Errorf("%s: %s is not in the English catalog", locale, key)
+				continue
+			}
+			if got, want := verbs.FindAllString(msg, -1), verbs.FindAllString(base, -1); len(got) != len(want) {
+				t.Errorf("%s: %s has verbs %v, English has %v", locale, key, got, want)
+			}
+		}
+		for key := range en {
+			if _, ok := catalogs[locale][key]; !ok {
+				t.Errorf("%s: missing %s", locale, key)
+			}
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("id", "flash.connection_saved", "prod"); got != "Koneksi prod disimpan." {
+		t.Errorf("T(id) = %q", got)
+	}
+	if got := T("fr", "flash.connection_saved", "prod"); got != "Connection prod saved." {
+		t.Errorf("T(unsupported locale) = %q, want English", got)
+	}
+	if got := T("id", "no.such.key"); got != "no.such.key" {
+		t.Errorf("T(missing key) = %q, want the key", got)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for tag, want := range map[string]string{"id": "id", "id-ID": "id", "EN_us": "en", " en ": "en", "fr": "", "": ""} {
+		if got := Normalize(tag); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
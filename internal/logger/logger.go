@@ -7,9 +7,13 @@ import (
 	"path/filepath"
 )
 
+// Info and Error write to stdout until Init adds the log file, so packages
+// used before Init (CLI subcommands, tests) can log safely.
 var (
-	Info  *log.Logger
-	Error *log.Logger
+	Info  = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	Error = log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+
+	output io.Writer = os.Stdout
 )
 
 // Init initializes the logger to write to both stdout and a file
@@ -24,9 +28,20 @@ func Init(logDir string) error {
 	}
 
 	multiWriter := io.MultiWriter(os.Stdout, logFile)
+	output = multiWriter
 
 	Info = log.New(multiWriter, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
 	Error = log.New(multiWriter, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
 
 	return nil
 }
+
+// SetLevel switches the verbosity at runtime. "error" silences Info output,
+// anything else logs both Info and Error.
+func SetLevel(level string) {
+	if level == "error" {
+		Info.SetOutput(io.Discard)
+		return
+	}
+	Info.SetOutput(output)
+}
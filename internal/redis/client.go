@@ -0,0 +1,227 @@
+// Package redis is a minimal RESP2 client covering what DbBridge needs
+// (scripts and simple key commands) without pulling in a full driver.
+package redis
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dialTimeout = 2 * time.Second
+	ioTimeout   = 2 * time.Second
+	poolSize    = 8
+)
+
+// Error is an error reply sent by the server (e.g. "NOSCRIPT ...")
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Client is a small pooled connection to a single Redis server
+type Client struct {
+	addr     string
+	username string
+	password string
+	db       int
+	useTLS   bool
+
+	pool chan *conn
+}
+
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+}
+
+// NewClient parses a redis:// or rediss:// URL, e.g. redis://:secret@localhost:6379/0.
+// Connections are opened lazily on first use.
+func NewClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("invalid REDIS_URL scheme %q, expected redis:// or rediss://", u.Scheme)
+	}
+
+	c := &Client{
+		addr:   u.Host,
+		useTLS: u.Scheme == "rediss",
+		pool:   make(chan *conn, poolSize),
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL database %q", db)
+		}
+	}
+	return c, nil
+}
+
+// Do sends a command and returns the decoded reply: string, int64, []interface{},
+// or nil for null replies. Server error replies are returned as Error.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.do(args...)
+	if err != nil {
+		if _, isReply := err.(Error); !isReply {
+			// Network/protocol error: the connection state is unknown, drop it
+			cn.nc.Close()
+			return nil, err
+		}
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// Close closes all idle connections
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.pool:
+			cn.nc.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *Client) get() (*conn, error) {
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	default:
+		return c.dial()
+	}
+}
+
+func (c *Client) put(cn *conn) {
+	select {
+	case c.pool <- cn:
+	default:
+		cn.nc.Close()
+	}
+}
+
+func (c *Client) dial() (*conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var nc net.Conn
+	var err error
+	if c.useTLS {
+		host, _, _ := net.SplitHostPort(c.addr)
+		nc, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: host})
+	} else {
+		nc, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{nc: nc, r: bufio.NewReader(nc)}
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := cn.do(args...); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("redis auth failed: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := cn.do("SELECT", strconv.Itoa(c.db)); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("redis select failed: %w", err)
+		}
+	}
+	return cn, nil
+}
+
+func (cn *conn) do(args ...string) (interface{}, error) {
+	cn.nc.SetDeadline(time.Now().Add(ioTimeout))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(cn.nc, b.String()); err != nil {
+		return nil, err
+	}
+	return cn.readReply()
+}
+
+func (cn *conn) readReply() (interface{}, error) {
+	line, err := cn.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(cn.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			// Error replies nested in arrays are returned as values
+			item, err := cn.readReply()
+			if err != nil {
+				if replyErr, ok := err.(Error); ok {
+					items[i] = replyErr
+					continue
+				}
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
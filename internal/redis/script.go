@@ -0,0 +1,34 @@
+package redis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// Script is a Lua script executed with EVALSHA, falling back to EVAL when the
+// server has not cached it yet (first call, restart, SCRIPT FLUSH).
+type Script struct {
+	src  string
+	hash string
+}
+
+func NewScript(src string) *Script {
+	sum := sha1.Sum([]byte(src))
+	return &Script{src: src, hash: hex.EncodeToString(sum[:])}
+}
+
+// Run executes the script with the given keys and arguments
+func (s *Script) Run(c *Client, keys []string, args ...string) (interface{}, error) {
+	cmd := func(name, body string) []string {
+		out := append([]string{name, body, strconv.Itoa(len(keys))}, keys...)
+		return append(out, args...)
+	}
+
+	reply, err := c.Do(cmd("EVALSHA", s.hash)...)
+	if replyErr, ok := err.(Error); ok && strings.HasPrefix(string(replyErr), "NOSCRIPT") {
+		return c.Do(cmd("EVAL", s.src)...)
+	}
+	return reply, err
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// accessBatchSize caps the events written in one transaction
+	accessBatchSize = 200
+	// accessPruneInterval is how often Run deletes expired events
+	accessPruneInterval = time.Hour
+)
+
+// AccessLog records access events, the API requests answered with a non-2xx
+// status, off the request path: Record counts the event and queues it for a
+// worker that writes batches. When the queue is full the event is dropped
+// (and still counted), so the metadata database never slows requests down.
+// Close writes what is still queued.
+type AccessLog struct {
+	repo      core.AccessEventRepository
+	retention func() time.Duration
+	queue     chan *core.AccessEvent
+	done      chan struct{}
+
+	mu     sync.RWMutex // held for writing by Close, for reading by Record
+	closed bool
+
+	written atomic.Int64
+	failed  atomic.Int64
+	dropped atomic.Int64
+
+	countsMu sync.Mutex
+	byStatus map[string]int64
+	byCode   map[string]int64
+}
+
+// AccessLogStatus is a point-in-time view for the admin page and expvar.
+// The counts cover every event since the start, written or not.
+type AccessLogStatus struct {
+	QueueLength   int              `json:"queue_length"`
+	QueueCapacity int              `json:"queue_capacity"`
+	Written       int64            `json:"written"`
+	Failed        int64            `json:"failed"`
+	Dropped       int64            `json:"dropped"`
+	ByStatus      map[string]int64 `json:"by_status"`
+	ByCode        map[string]int64 `json:"by_code"`
+}
+
+// NewAccessLog starts a worker writing to repo through a queue of queueSize
+// events; Run deletes events older than retention
+func NewAccessLog(repo core.AccessEventRepository, queueSize int, retention func() time.Duration) *AccessLog {
+	l := &AccessLog{
+		repo:      repo,
+		retention: retention,
+		queue:     make(chan *core.AccessEvent, queueSize),
+		done:      make(chan struct{}),
+		byStatus:  map[string]int64{},
+		byCode:    map[string]int64{},
+	}
+	go l.run()
+	return l
+}
+
+// Record counts ev and queues it. After Close it is written synchronously.
+func (l *AccessLog) Record(ev *core.AccessEvent) {
+	l.countsMu.Lock()
+	l.byStatus[strconv.Itoa(ev.Status)]++
+	l.byCode[ev.Code]++
+	l.countsMu.Unlock()
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		l.store([]*core.AccessEvent{ev})
+		return
+	}
+	select {
+	case l.queue <- ev:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+func (l *AccessLog) run() {
+	defer close(l.done)
+	batch := make([]*core.AccessEvent, 0, accessBatchSize)
+	for ev := range l.queue {
+		batch = append(batch[:0], ev)
+		// Take what else is waiting, without waiting for more
+	fill:
+		for len(batch) < accessBatchSize {
+			select {
+			case ev, ok := <-l.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, ev)
+			default:
+				break fill
+			}
+		}
+		l.store(batch)
+	}
+}
+
+func (l *AccessLog) store(batch []*core.AccessEvent) {
+	if err := l.repo.CreateBatch(batch); err != nil {
+		l.failed.Add(int64(len(batch)))
+		logger.Error.Printf("Failed to write %d access events: %v", len(batch), err)
+		return
+	}
+	l.written.Add(int64(len(batch)))
+}
+
+// Close stops taking new events into the queue and waits until the worker
+// has written the queued ones, for graceful shutdown
+func (l *AccessLog) Close() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+	<-l.done
+}
+
+// Run deletes expired events every accessPruneInterval until ctx is
+// cancelled
+func (l *AccessLog) Run(ctx context.Context) {
+	ticker := time.NewTicker(accessPruneInterval)
+	defer ticker.Stop()
+	for {
+		l.Prune()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune deletes the events older than the retention
+func (l *AccessLog) Prune() {
+	if _, err := l.repo.DeleteBefore(time.Now().Add(-l.retention())); err != nil {
+		logger.Error.Printf("Failed to delete expired access events: %v", err)
+	}
+}
+
+func (l *AccessLog) Status() AccessLogStatus {
+	l.countsMu.Lock()
+	defer l.countsMu.Unlock()
+	s := AccessLogStatus{
+		QueueLength:   len(l.queue),
+		QueueCapacity: cap(l.queue),
+		Written:       l.written.Load(),
+		Failed:        l.failed.Load(),
+		Dropped:       l.dropped.Load(),
+		ByStatus:      make(map[string]int64, len(l.byStatus)),
+		ByCode:        make(map[string]int64, len(l.byCode)),
+	}
+	for k, v := range l.byStatus {
+		s.ByStatus[k] = v
+	}
+	for k, v := range l.byCode {
+		s.ByCode[k] = v
+	}
+	return s
+}
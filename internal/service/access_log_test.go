@@ -0,0 +1,33 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/data/memory"
+	"testing"
+	"time"
+)
+
+func TestAccessLog(t *testing.T) {
+	repo := &memory.AccessEvents{}
+	l := NewAccessLog(repo, 100, func() time.Duration { return time.Hour })
+
+	now := time.Now()
+	l.Record(&core.AccessEvent{Timestamp: now.Add(-2 * time.Hour), Path: "/api/shop/orders", Status: 401, Code: "unauthorized"})
+	l.Record(&core.AccessEvent{Timestamp: now, Path: "/api/shop/orders", Status: 429, Code: "too_many_requests"})
+	l.Record(&core.AccessEvent{Timestamp: now, Path: "/api/shop/nope", Status: 404, Code: "not_found"})
+	l.Close()
+
+	events, err := repo.List(core.AccessEventFilter{MinStatus: 400, MaxStatus: 499, Path: "orders"}, 10, 0)
+	if err != nil || len(events) != 2 || events[0].Status != 429 {
+		t.Fatalf("4xx on orders = %+v, %v; want the 429 then the 401", events, err)
+	}
+	s := l.Status()
+	if s.Written != 3 || s.ByStatus["404"] != 1 || s.ByCode["unauthorized"] != 1 {
+		t.Errorf("status = %+v", s)
+	}
+
+	l.Prune()
+	if events, _ := repo.List(core.AccessEventFilter{}, 10, 0); len(events) != 2 {
+		t.Errorf("after Prune: %d events, want the 2 within the hour", len(events))
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// Audit statuses of admin events
+const (
+	AdminStatus  = "ADMIN"
+	DeniedStatus = "DENIED"
+)
+
+// FieldChange is one changed field of an admin event
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// AuditChanges is the field diff stored with an admin event
+type AuditChanges map[string]FieldChange
+
+// DiffFields compares the JSON fields of two values of the same type. Either
+// may be nil, for creates and deletes. Fields tagged json:"-" (encrypted
+// connection strings, key hashes) never appear; use Redacted for those.
+// Bookkeeping fields (id, timestamps, last modifier) are left out.
+func DiffFields(before, after interface{}) AuditChanges {
+	oldFields, newFields := jsonFields(before), jsonFields(after)
+	changes := AuditChanges{}
+	for name, newValue := range newFields {
+		if oldValue, ok := oldFields[name]; !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changes[name] = FieldChange{Old: oldFields[name], New: newValue}
+		}
+	}
+	for name, oldValue := range oldFields {
+		if _, ok := newFields[name]; !ok {
+			changes[name] = FieldChange{Old: oldValue}
+		}
+	}
+	for _, name := range []string{"id", "created_at", "updated_at", "updated_by"} {
+		delete(changes, name)
+	}
+	return changes
+}
+
+// Redacted records that a secret field changed without recording its values
+func (c AuditChanges) Redacted(field string, changed bool) {
+	if changed {
+		c[field] = FieldChange{Old: "********", New: "********"}
+	}
+}
+
+func jsonFields(v interface{}) map[string]interface{} {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(b, &fields)
+	return fields
+}
+
+// AdminEvent is a configuration change or sign-in made through the admin UI
+type AdminEvent struct {
+	Type         string // core.Event* constant
+	UserID       int64  // acting user, 0 when unknown (failed sign-in, setup)
+	ApiKeyID     int64  // the admin API key that acted for UserID, 0 for a signed-in session
+	Target       string // e.g. "connection prod-db"
+	ClientIP     string
+	ConnectionID int64
+	QueryID      int64
+	Changes      AuditChanges
+	Denied       bool   // the attempt was refused, e.g. a failed sign-in
+	Error        string // why it failed, if it did
+}
+
+// AdminAuditor writes admin events to the audit log next to query executions.
+// A nil auditor records nothing.
+type AdminAuditor struct {
+	auditRepo core.AuditRepository
+}
+
+func NewAdminAuditor(auditRepo core.AuditRepository) *AdminAuditor {
+	return &AdminAuditor{auditRepo: auditRepo}
+}
+
+func (a *AdminAuditor) Record(ev AdminEvent) {
+	if a == nil {
+		return
+	}
+	entry := &core.AuditLog{
+		Timestamp:    time.Now(),
+		UserID:       ev.UserID,
+		ConnectionID: ev.ConnectionID,
+		QueryID:      ev.QueryID,
+		Status:       AdminStatus,
+		ErrorMessage: ev.Error,
+		ClientIP:     ev.ClientIP,
+		EventType:    ev.Type,
+		Target:       ev.Target,
+	}
+	if ev.ApiKeyID != 0 {
+		entry.ApiKeyID = &ev.ApiKeyID
+	}
+	if ev.Denied {
+		entry.Status = DeniedStatus
+	} else if ev.Error != "" {
+		entry.Status = "ERROR"
+	}
+	if len(ev.Changes) > 0 {
+		params, _ := json.Marshal(ev.Changes)
+		entry.Params = string(params)
+	}
+	if err := a.auditRepo.Create(entry); err != nil {
+		logger.Error.Printf("Failed to audit %s %s: %v", ev.Type, ev.Target, err)
+	}
+}
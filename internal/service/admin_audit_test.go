@@ -0,0 +1,72 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiffFields(t *testing.T) {
+	before := &core.DBConnection{ID: 1, Name: "prod", Driver: "postgres", ConnectionStringEnc: "enc-old", IsActive: true}
+	after := *before
+	after.Driver = "mysql"
+	after.IsActive = false
+	after.ConnectionStringEnc = "enc-new"
+
+	changes := DiffFields(before, &after)
+	if len(changes) != 2 {
+		t.Fatalf("DiffFields() = %v, want driver and is_active", changes)
+	}
+	if c := changes["driver"]; c.Old != "postgres" || c.New != "mysql" {
+		t.Errorf("driver change = %+v", c)
+	}
+	if c := changes["is_active"]; c.Old != true || c.New != false {
+		t.Errorf("is_active change = %+v", c)
+	}
+
+	var none *core.DBConnection
+	created := DiffFields(none, &after)
+	if c, ok := created["name"]; !ok || c.Old != nil || c.New != "prod" {
+		t.Errorf("create diff name = %+v", c)
+	}
+	if _, ok := created["id"]; ok {
+		t.Error("create diff includes id")
+	}
+	deleted := DiffFields(before, nil)
+	if c := deleted["name"]; c.Old != "prod" || c.New != nil {
+		t.Errorf("delete diff name = %+v", c)
+	}
+}
+
+func TestAdminAuditorRecord(t *testing.T) {
+	repo := &memAuditRepo{cursors: map[string]int64{}}
+	a := NewAdminAuditor(repo)
+
+	changes := AuditChanges{}
+	changes.Redacted("connection_string", true)
+	changes.Redacted("private_key", false)
+	a.Record(AdminEvent{Type: core.EventConnectionUpdate, UserID: 7, Target: "connection prod", ConnectionID: 3, Changes: changes})
+	a.Record(AdminEvent{Type: core.EventLogin, Target: "user admin", Denied: true, Error: "invalid username or password"})
+
+	if len(repo.logs) != 2 {
+		t.Fatalf("recorded %d entries, want 2", len(repo.logs))
+	}
+	got := repo.logs[0]
+	if got.Status != AdminStatus || got.EventType != core.EventConnectionUpdate || got.UserID != 7 || got.Target != "connection prod" {
+		t.Errorf("entry = %+v", got)
+	}
+	var params map[string]FieldChange
+	if err := json.Unmarshal([]byte(got.Params), &params); err != nil {
+		t.Fatalf("params %q: %v", got.Params, err)
+	}
+	if _, ok := params["private_key"]; ok || params["connection_string"].New != "********" {
+		t.Errorf("params = %s", got.Params)
+	}
+	if denied := repo.logs[1]; denied.Status != DeniedStatus || !strings.Contains(denied.ErrorMessage, "invalid") {
+		t.Errorf("failed sign-in entry = %+v", denied)
+	}
+
+	var nilAuditor *AdminAuditor
+	nilAuditor.Record(AdminEvent{Type: core.EventLogout})
+}
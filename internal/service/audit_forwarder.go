@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	auditFlushInterval = time.Second
+	auditRetryMax      = time.Minute
+)
+
+// AuditSink delivers a batch of audit entries to an external system
+type AuditSink interface {
+	Kind() string
+	Target() string
+	Send(ctx context.Context, logs []core.AuditLog) error
+	Close() error
+}
+
+// AuditForwarder ships new audit entries to a sink in near real time.
+// AuditRepo.Create publishes entries to a bounded queue, in no particular
+// order since writers run concurrently, so the queue only signals that there
+// is something to send: entries are read from the database after the
+// persistent cursor, in id order. When the queue is full the signal is
+// dropped (never blocking query execution) and a backfill is scheduled.
+type AuditForwarder struct {
+	repo      core.AuditRepository
+	sink      AuditSink
+	queue     chan core.AuditLog
+	batchSize int
+	cursorKey string
+
+	cursor    atomic.Int64
+	forwarded atomic.Int64
+	dropped   atomic.Int64
+	backfill  atomic.Bool
+
+	mu          sync.Mutex
+	failing     bool
+	lastSuccess time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// AuditForwarderStatus is a point-in-time view for the admin page and expvar
+type AuditForwarderStatus struct {
+	Sink          string    `json:"sink"`
+	Target        string    `json:"target"`
+	QueueLength   int       `json:"queue_length"`
+	QueueCapacity int       `json:"queue_capacity"`
+	BatchSize     int       `json:"batch_size"`
+	Cursor        int64     `json:"cursor"`
+	Forwarded     int64     `json:"forwarded"`
+	Dropped       int64     `json:"dropped"`
+	LastSuccess   time.Time `json:"last_success"`
+	LastError     string    `json:"last_error"`
+	LastErrorAt   time.Time `json:"last_error_at"`
+}
+
+func NewAuditForwarder(repo core.AuditRepository, sink AuditSink, queueSize, batchSize int) *AuditForwarder {
+	return &AuditForwarder{
+		repo:      repo,
+		sink:      sink,
+		queue:     make(chan core.AuditLog, queueSize),
+		batchSize: batchSize,
+		cursorKey: sink.Kind() + ":" + sink.Target(),
+	}
+}
+
+// Queue is the channel AuditRepo publishes new entries to
+func (f *AuditForwarder) Queue() chan<- core.AuditLog {
+	return f.queue
+}
+
+// OnDrop counts an entry that did not fit in the queue and schedules a backfill
+func (f *AuditForwarder) OnDrop() {
+	f.dropped.Add(1)
+	f.backfill.Store(true)
+}
+
+// Run delivers entries until ctx is cancelled. It first catches up on
+// everything recorded since the last delivered id.
+func (f *AuditForwarder) Run(ctx context.Context) {
+	defer f.sink.Close()
+
+	cursor, err := f.repo.GetForwardCursor(f.cursorKey)
+	if err != nil {
+		logger.Error.Printf("Audit forwarder: failed to load cursor, starting from the beginning: %v", err)
+	}
+	f.cursor.Store(cursor)
+	f.backfill.Store(true)
+
+	timer := time.NewTimer(auditFlushInterval)
+	defer timer.Stop()
+	signalled := 0 // entries published since the last catch-up
+
+	for {
+		if f.backfill.Swap(false) {
+			signalled = 0
+			if !f.catchUp(ctx) {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-f.queue:
+			if signalled++; signalled < f.batchSize {
+				continue
+			}
+		case <-timer.C:
+			timer.Reset(auditFlushInterval)
+			if signalled == 0 {
+				continue
+			}
+		}
+		f.backfill.Store(true)
+	}
+}
+
+// catchUp sends everything after the cursor straight from the database
+func (f *AuditForwarder) catchUp(ctx context.Context) bool {
+	for {
+		logs, err := f.repo.ListAfter(f.cursor.Load(), f.batchSize)
+		if err != nil {
+			f.recordError(err)
+			f.backfill.Store(true) // retry on the next loop
+			return true
+		}
+		if len(logs) == 0 {
+			return true
+		}
+		if !f.deliver(ctx, logs) {
+			return false
+		}
+	}
+}
+
+// deliver sends entries following the cursor in id order, retrying with
+// backoff until it succeeds, and then moves the cursor past them. It returns
+// false only when ctx is cancelled.
+func (f *AuditForwarder) deliver(ctx context.Context, logs []core.AuditLog) bool {
+	backoff := time.Second
+	for {
+		err := f.sink.Send(ctx, logs)
+		if err == nil {
+			break
+		}
+		f.recordError(err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > auditRetryMax {
+			backoff = auditRetryMax
+		}
+	}
+
+	lastID := logs[len(logs)-1].ID
+	f.cursor.Store(lastID)
+	f.forwarded.Add(int64(len(logs)))
+	if err := f.repo.SetForwardCursor(f.cursorKey, lastID); err != nil {
+		logger.Error.Printf("Audit forwarder: failed to save cursor: %v", err)
+	}
+
+	f.mu.Lock()
+	if f.failing {
+		logger.Info.Printf("Audit forwarder (%s): delivery recovered", f.sink.Kind())
+		f.failing = false
+	}
+	f.lastSuccess = time.Now()
+	f.mu.Unlock()
+	return true
+}
+
+func (f *AuditForwarder) recordError(err error) {
+	f.mu.Lock()
+	// Only log the first failure so an unreachable sink doesn't flood the log
+	if !f.failing {
+		logger.Error.Printf("Audit forwarder (%s): %v", f.sink.Kind(), err)
+		f.failing = true
+	}
+	f.lastError = err.Error()
+	f.lastErrorAt = time.Now()
+	f.mu.Unlock()
+}
+
+func (f *AuditForwarder) Status() AuditForwarderStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return AuditForwarderStatus{
+		Sink:          f.sink.Kind(),
+		Target:        f.sink.Target(),
+		QueueLength:   len(f.queue),
+		QueueCapacity: cap(f.queue),
+		BatchSize:     f.batchSize,
+		Cursor:        f.cursor.Load(),
+		Forwarded:     f.forwarded.Load(),
+		Dropped:       f.dropped.Load(),
+		LastSuccess:   f.lastSuccess,
+		LastError:     f.lastError,
+		LastErrorAt:   f.lastErrorAt,
+	}
+}
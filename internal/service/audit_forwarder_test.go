@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"dbbridge/internal/core"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memAuditRepo is an in-memory AuditRepository for forwarder tests
+type memAuditRepo struct {
+	mu      sync.Mutex
+	logs    []core.AuditLog
+	cursors map[string]int64
+}
+
+func (r *memAuditRepo) Create(l *core.AuditLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l.ID = int64(len(r.logs) + 1)
+	r.logs = append(r.logs, *l)
+	return nil
+}
+
+func (r *memAuditRepo) GetRecent(limit int) ([]core.AuditLog, error) { return nil, nil }
+
+func (r *memAuditRepo) GetByID(id int64) (*core.AuditLog, error) { return nil, sql.ErrNoRows }
+
+func (r *memAuditRepo) ListRecent(limit int, filter string, userID int64, beforeID int64) ([]core.AuditLog, error) {
+	return nil, nil
+}
+
+func (r *memAuditRepo) ListAfter(afterID int64, limit int) ([]core.AuditLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []core.AuditLog
+	for _, l := range r.logs {
+		if l.ID > afterID && len(out) < limit {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func (r *memAuditRepo) GetForwardCursor(sink string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cursors[sink], nil
+}
+
+func (r *memAuditRepo) SetForwardCursor(sink string, lastID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cursors[sink] = lastID
+	return nil
+}
+
+type recordingSink struct {
+	mu  sync.Mutex
+	ids []int64
+}
+
+func (s *recordingSink) Kind() string   { return "test" }
+func (s *recordingSink) Target() string { return "memory" }
+func (s *recordingSink) Close() error   { return nil }
+
+func (s *recordingSink) Send(ctx context.Context, logs []core.AuditLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range logs {
+		s.ids = append(s.ids, l.ID)
+	}
+	return nil
+}
+
+func (s *recordingSink) waitFor(t *testing.T, n int) []int64 {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		got := append([]int64(nil), s.ids...)
+		s.mu.Unlock()
+		if len(got) >= n {
+			return got
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("sink received fewer than %d entries", n)
+	return nil
+}
+
+func TestAuditForwarder_ResumesFromCursorAndRecoversDrops(t *testing.T) {
+	repo := &memAuditRepo{cursors: map[string]int64{"test:memory": 2}}
+	for i := 0; i < 4; i++ {
+		repo.Create(&core.AuditLog{Status: "SUCCESS"})
+	}
+
+	sink := &recordingSink{}
+	f := NewAuditForwarder(repo, sink, 1, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go f.Run(ctx)
+
+	// Entries 1-2 were delivered before the "restart"
+	if got := sink.waitFor(t, 2); got[0] != 3 || got[1] != 4 {
+		t.Fatalf("backfill sent %v, want [3 4]", got)
+	}
+
+	// Publish 5 to the queue and simulate 6 being dropped because it was full
+	l5 := core.AuditLog{Status: "SUCCESS"}
+	repo.Create(&l5)
+	f.Queue() <- l5
+	repo.Create(&core.AuditLog{Status: "ERROR"})
+	f.OnDrop()
+
+	got := sink.waitFor(t, 4)
+	want := []int64{3, 4, 5, 6}
+	for i := range want {
+		if i >= len(got) || got[i] != want[i] {
+			t.Fatalf("sink received %v, want %v", got, want)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("sink received duplicates: %v", got)
+	}
+
+	if status := f.Status(); status.Dropped != 1 || status.Cursor != 6 {
+		t.Errorf("Status() dropped=%d cursor=%d, want 1 and 6", status.Dropped, status.Cursor)
+	}
+	if c, _ := repo.GetForwardCursor("test:memory"); c != 6 {
+		t.Errorf("persisted cursor = %d, want 6", c)
+	}
+}
+
+func TestAuditForwarder_OutOfOrderPublishes(t *testing.T) {
+	// Entries 1-3 were delivered before
+	repo := &memAuditRepo{cursors: map[string]int64{"test:memory": 3}}
+	for i := 0; i < 3; i++ {
+		repo.Create(&core.AuditLog{Status: "SUCCESS"})
+	}
+
+	sink := &recordingSink{}
+	f := NewAuditForwarder(repo, sink, 10, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go f.Run(ctx)
+	time.Sleep(100 * time.Millisecond) // past the catch-up at start
+
+	// Concurrent writers publish 5 before 4, and 4 only after 5 was sent
+	l4, l5, l6 := core.AuditLog{}, core.AuditLog{}, core.AuditLog{}
+	repo.Create(&l4)
+	repo.Create(&l5)
+	f.Queue() <- l5
+	sink.waitFor(t, 2)
+	repo.Create(&l6)
+	f.Queue() <- l4
+	f.Queue() <- l6
+	sink.waitFor(t, 3)
+
+	// Give a resend of the late 4 time to show up
+	time.Sleep(1500 * time.Millisecond)
+	sink.mu.Lock()
+	got := append([]int64(nil), sink.ids...)
+	sink.mu.Unlock()
+	want := []int64{4, 5, 6}
+	if len(got) != len(want) {
+		t.Fatalf("sink received %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sink received %v, want %v", got, want)
+		}
+	}
+	if c, _ := repo.GetForwardCursor("test:memory"); c != 6 {
+		t.Errorf("persisted cursor = %d, want 6", c)
+	}
+}
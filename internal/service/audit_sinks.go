@@ -0,0 +1,170 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"dbbridge/internal/core"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const auditSinkTimeout = 10 * time.Second
+
+// NewAuditSink builds the sink selected by AUDIT_SINK
+func NewAuditSink(kind, target, token string) (AuditSink, error) {
+	switch kind {
+	case "http":
+		return &HTTPAuditSink{
+			url:    target,
+			token:  token,
+			client: &http.Client{Timeout: auditSinkTimeout},
+		}, nil
+	case "syslog":
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid syslog address: %w", err)
+		}
+		hostname, _ := os.Hostname()
+		return &SyslogAuditSink{network: u.Scheme, addr: u.Host, hostname: hostname}, nil
+	case "file":
+		return &FileAuditSink{path: target}, nil
+	}
+	return nil, fmt.Errorf("unsupported audit sink %q", kind)
+}
+
+// HTTPAuditSink POSTs each batch as a JSON array
+type HTTPAuditSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (s *HTTPAuditSink) Kind() string   { return "http" }
+func (s *HTTPAuditSink) Target() string { return s.url }
+func (s *HTTPAuditSink) Close() error   { return nil }
+
+func (s *HTTPAuditSink) Send(ctx context.Context, logs []core.AuditLog) error {
+	body, err := json.Marshal(logs)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sink returned %s", resp.Status)
+	}
+	return nil
+}
+
+// SyslogAuditSink sends one RFC 5424 message per entry (JSON payload) over
+// UDP or TCP. log/syslog is not available on Windows, hence the own writer.
+type SyslogAuditSink struct {
+	network  string
+	addr     string
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (s *SyslogAuditSink) Kind() string   { return "syslog" }
+func (s *SyslogAuditSink) Target() string { return s.network + "://" + s.addr }
+
+func (s *SyslogAuditSink) Send(ctx context.Context, logs []core.AuditLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		dialer := net.Dialer{Timeout: auditSinkTimeout}
+		conn, err := dialer.DialContext(ctx, s.network, s.addr)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	for _, l := range logs {
+		payload, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		// facility local0; warning for failed or denied requests, info otherwise
+		pri := 16*8 + 6
+		if l.Status != "SUCCESS" {
+			pri = 16*8 + 4
+		}
+		msg := fmt.Sprintf("<%d>1 %s %s dbbridge - audit - %s", pri, l.Timestamp.UTC().Format(time.RFC3339Nano), s.hostname, payload)
+		if s.network == "tcp" {
+			// RFC 6587 octet counting, so JSON payloads may contain newlines
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(auditSinkTimeout))
+		if _, err := io.WriteString(s.conn, msg); err != nil {
+			// Reconnect on the next attempt
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SyslogAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+// FileAuditSink appends one JSON object per line to a local file
+type FileAuditSink struct {
+	path string
+}
+
+func (s *FileAuditSink) Kind() string   { return "file" }
+func (s *FileAuditSink) Target() string { return s.path }
+func (s *FileAuditSink) Close() error   { return nil }
+
+func (s *FileAuditSink) Send(ctx context.Context, logs []core.AuditLog) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, l := range logs {
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+	}
+
+	// Opened per batch so log rotation (move + recreate) is picked up
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
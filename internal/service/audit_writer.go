@@ -0,0 +1,176 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// auditDropLogInterval spaces the warnings about dropped entries, so a burst
+// logs once instead of once per entry
+const auditDropLogInterval = 10 * time.Second
+
+// AuditWriter persists execution audit entries off the request path. Entries
+// go on a bounded queue drained by a few workers; when the queue is full the
+// oldest waiting entry is dropped to make room, so a slow metadata database
+// never blocks an execution. Close writes what is still queued.
+//
+// When the repository supports it, the workers also run its retention
+// delete, with the other workers' inserts held off until it finishes.
+type AuditWriter struct {
+	repo  core.AuditRepository
+	queue chan auditJob
+
+	pruner  auditPruner
+	pruneMu sync.RWMutex // held for writing by a retention delete, for reading by inserts
+	pruning atomic.Bool
+
+	workers sync.WaitGroup
+	mu      sync.RWMutex // held for writing by Close, for reading by Write
+	closed  bool
+
+	written     atomic.Int64
+	failed      atomic.Int64
+	dropped     atomic.Int64
+	lastDropLog atomic.Int64 // unix nanoseconds
+}
+
+// auditPruner is a repository whose retention delete the writer runs itself
+type auditPruner interface {
+	DeferRetention()
+	Prune()
+}
+
+// auditJob is one queued entry and what to do with its id once written
+type auditJob struct {
+	entry   *core.AuditLog
+	written func(id int64)
+}
+
+// AuditWriterStatus is a point-in-time view for expvar
+type AuditWriterStatus struct {
+	QueueLength   int   `json:"queue_length"`
+	QueueCapacity int   `json:"queue_capacity"`
+	Written       int64 `json:"written"`
+	Failed        int64 `json:"failed"`
+	Dropped       int64 `json:"dropped"`
+}
+
+// NewAuditWriter starts workers goroutines writing to repo through a queue
+// of queueSize entries
+func NewAuditWriter(repo core.AuditRepository, queueSize, workers int) *AuditWriter {
+	w := &AuditWriter{repo: repo, queue: make(chan auditJob, queueSize)}
+	if p, ok := repo.(auditPruner); ok {
+		p.DeferRetention()
+		w.pruner = p
+	}
+	for i := 0; i < workers; i++ {
+		w.workers.Add(1)
+		go w.run()
+	}
+	return w
+}
+
+// Write queues entry. written, if not nil, runs on a worker with the id of
+// the entry once it is stored. After Close entries are written synchronously.
+func (w *AuditWriter) Write(entry *core.AuditLog, written func(id int64)) {
+	job := auditJob{entry: entry, written: written}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		w.store(job)
+		return
+	}
+	for {
+		select {
+		case w.queue <- job:
+			return
+		default:
+		}
+		// Full: make room by dropping the oldest entry, unless a worker just did
+		select {
+		case old := <-w.queue:
+			w.drop(old)
+		default:
+		}
+	}
+}
+
+func (w *AuditWriter) drop(job auditJob) {
+	n := w.dropped.Add(1)
+	now := time.Now().UnixNano()
+	last := w.lastDropLog.Load()
+	if now-last >= int64(auditDropLogInterval) && w.lastDropLog.CompareAndSwap(last, now) {
+		logger.Error.Printf("Warning: audit queue full, dropped the entry of %s (%d dropped so far)",
+			job.entry.Timestamp.Format(time.RFC3339), n)
+	}
+}
+
+func (w *AuditWriter) run() {
+	defer w.workers.Done()
+	for job := range w.queue {
+		w.store(job)
+	}
+}
+
+func (w *AuditWriter) store(job auditJob) {
+	if w.insert(job) {
+		w.prune()
+	}
+}
+
+// insert writes the entry and runs its written callback, which may save
+// more rows, outside of a retention delete
+func (w *AuditWriter) insert(job auditJob) bool {
+	w.pruneMu.RLock()
+	defer w.pruneMu.RUnlock()
+	if err := w.repo.Create(job.entry); err != nil {
+		w.failed.Add(1)
+		logger.Error.Printf("Failed to write audit entry: %v", err)
+		return false
+	}
+	w.written.Add(1)
+	if job.written != nil {
+		job.written(job.entry.ID)
+	}
+	return true
+}
+
+// prune runs the retention delete unless another worker already is. Entries
+// written meanwhile are left to the next one.
+func (w *AuditWriter) prune() {
+	if w.pruner == nil || !w.pruning.CompareAndSwap(false, true) {
+		return
+	}
+	defer w.pruning.Store(false)
+	w.pruneMu.Lock()
+	defer w.pruneMu.Unlock()
+	w.pruner.Prune()
+}
+
+// Close stops taking new entries into the queue and waits until the workers
+// have written the queued ones, for graceful shutdown
+func (w *AuditWriter) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+	w.workers.Wait()
+}
+
+func (w *AuditWriter) Status() AuditWriterStatus {
+	return AuditWriterStatus{
+		QueueLength:   len(w.queue),
+		QueueCapacity: cap(w.queue),
+		Written:       w.written.Load(),
+		Failed:        w.failed.Load(),
+		Dropped:       w.dropped.Load(),
+	}
+}
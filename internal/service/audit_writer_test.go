@@ -0,0 +1,128 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingAuditRepo holds every Create until release is closed
+type blockingAuditRepo struct {
+	memAuditRepo
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (r *blockingAuditRepo) Create(l *core.AuditLog) error {
+	r.once.Do(func() { close(r.started) })
+	<-r.release
+	return r.memAuditRepo.Create(l)
+}
+
+func TestAuditWriterFlushesOnClose(t *testing.T) {
+	repo := &memAuditRepo{cursors: map[string]int64{}}
+	w := NewAuditWriter(repo, 100, 3)
+
+	var mu sync.Mutex
+	ids := map[int64]bool{}
+	for i := 0; i < 50; i++ {
+		w.Write(&core.AuditLog{QueryID: int64(i)}, func(id int64) {
+			mu.Lock()
+			ids[id] = true
+			mu.Unlock()
+		})
+	}
+	w.Close()
+
+	if len(repo.logs) != 50 || len(ids) != 50 {
+		t.Fatalf("after Close: %d entries written, %d ids reported, want 50", len(repo.logs), len(ids))
+	}
+	// Entries after Close are written right away
+	w.Write(&core.AuditLog{QueryID: 99}, nil)
+	if len(repo.logs) != 51 {
+		t.Errorf("entry after Close not written, have %d", len(repo.logs))
+	}
+	if st := w.Status(); st.Written != 51 || st.Dropped != 0 {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestAuditWriterDropsOldestWhenFull(t *testing.T) {
+	repo := &blockingAuditRepo{memAuditRepo: memAuditRepo{cursors: map[string]int64{}},
+		started: make(chan struct{}), release: make(chan struct{})}
+	w := NewAuditWriter(repo, 2, 1)
+
+	// The worker takes entry 0 and blocks on it; 1 and 2 fill the queue
+	w.Write(&core.AuditLog{QueryID: 0}, nil)
+	<-repo.started
+	for i := 1; i <= 4; i++ {
+		w.Write(&core.AuditLog{QueryID: int64(i)}, nil)
+	}
+	if st := w.Status(); st.Dropped != 2 || st.QueueLength != 2 {
+		t.Errorf("status with a full queue = %+v", st)
+	}
+
+	close(repo.release)
+	w.Close()
+	var got []int64
+	for _, l := range repo.logs {
+		got = append(got, l.QueryID)
+	}
+	if len(got) != 3 || got[0] != 0 || got[1] != 3 || got[2] != 4 {
+		t.Errorf("written queries = %v, want [0 3 4]", got)
+	}
+}
+
+// pruningAuditRepo records whether a retention delete ever ran during an insert
+type pruningAuditRepo struct {
+	memAuditRepo
+	deferred  bool
+	inserting atomic.Int32
+	pruning   atomic.Bool
+	pruned    atomic.Int32
+	overlap   atomic.Bool
+}
+
+func (r *pruningAuditRepo) DeferRetention() { r.deferred = true }
+
+func (r *pruningAuditRepo) Create(l *core.AuditLog) error {
+	r.inserting.Add(1)
+	defer r.inserting.Add(-1)
+	if r.pruning.Load() {
+		r.overlap.Store(true)
+	}
+	time.Sleep(100 * time.Microsecond)
+	return r.memAuditRepo.Create(l)
+}
+
+func (r *pruningAuditRepo) Prune() {
+	r.pruning.Store(true)
+	defer r.pruning.Store(false)
+	if r.inserting.Load() > 0 {
+		r.overlap.Store(true)
+	}
+	r.pruned.Add(1)
+	time.Sleep(100 * time.Microsecond)
+}
+
+func TestAuditWriterPrunesBetweenInserts(t *testing.T) {
+	repo := &pruningAuditRepo{memAuditRepo: memAuditRepo{cursors: map[string]int64{}}}
+	w := NewAuditWriter(repo, 100, 4)
+	for i := 0; i < 200; i++ {
+		w.Write(&core.AuditLog{QueryID: int64(i)}, nil)
+	}
+	w.Close()
+
+	if !repo.deferred {
+		t.Error("the repository still prunes on its own")
+	}
+	if repo.pruned.Load() == 0 {
+		t.Error("no retention delete ran")
+	}
+	if repo.overlap.Load() {
+		t.Error("a retention delete ran during an insert")
+	}
+}
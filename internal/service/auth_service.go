@@ -4,8 +4,11 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -14,12 +17,58 @@ import (
 type AuthService struct {
 	userRepo   core.UserRepository
 	apiKeyRepo core.ApiKeyRepository
+	hasher     PasswordHasher   // new passwords
+	legacy     []PasswordHasher // earlier schemes, verified and then replaced by hasher
 }
 
 func NewAuthService(userRepo core.UserRepository, apiKeyRepo core.ApiKeyRepository) *AuthService {
 	return &AuthService{
 		userRepo:   userRepo,
 		apiKeyRepo: apiKeyRepo,
+		hasher:     NewArgon2idHasher(DefaultArgon2idParams),
+		legacy:     []PasswordHasher{BcryptHasher{Cost: bcrypt.DefaultCost}},
+	}
+}
+
+// SetPasswordHasher hashes new passwords with h. Hashes of another scheme,
+// or of h's with other parameters, are replaced at the next login.
+func (s *AuthService) SetPasswordHasher(h PasswordHasher) {
+	s.hasher = h
+}
+
+// HashPassword hashes password in the current scheme
+func (s *AuthService) HashPassword(password string) (string, error) {
+	return s.hasher.Hash(password)
+}
+
+// VerifyPassword reports whether password is user's, whichever scheme its
+// hash is in
+func (s *AuthService) VerifyPassword(user *core.User, password string) bool {
+	for _, h := range append([]PasswordHasher{s.hasher}, s.legacy...) {
+		if strings.HasPrefix(user.PasswordHash, h.Prefix()) {
+			return h.Verify(user.PasswordHash, password)
+		}
+	}
+	return false
+}
+
+// upgradePassword re-hashes the password just verified for user when its
+// hash is of an earlier scheme or parameters. A failure leaves the old hash,
+// which still verifies.
+func (s *AuthService) upgradePassword(user *core.User, password string) {
+	if strings.HasPrefix(user.PasswordHash, s.hasher.Prefix()) && !s.hasher.Outdated(user.PasswordHash) {
+		return
+	}
+	hash, err := s.hasher.Hash(password)
+	if err == nil {
+		upgraded := *user
+		upgraded.PasswordHash = hash
+		if err = s.userRepo.Update(&upgraded); err == nil {
+			user.PasswordHash = hash
+		}
+	}
+	if err != nil {
+		logger.Error.Printf("Failed to upgrade the password hash of %s: %v", user.Username, err)
 	}
 }
 
@@ -33,53 +82,84 @@ func (s *AuthService) SetupAdmin(username, password string) error {
 		return errors.New("setup already completed")
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
 		return err
 	}
 
-	_, err = s.userRepo.CreateUser(username, string(hashedPassword))
+	_, err = s.userRepo.CreateUser(username, hashedPassword)
 	return err
 }
 
-// Authenticate checks credentials and returns user if valid
+// Authenticate checks credentials and returns user if valid. A password
+// hashed in an earlier scheme is re-hashed in the current one.
 func (s *AuthService) Authenticate(username, password string) (*core.User, error) {
 	user, err := s.userRepo.GetUserByUsername(username)
 	if err != nil {
 		return nil, errors.New("invalid credentials") // Don't leak if user exists
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
-	if err != nil {
+	if !s.VerifyPassword(user, password) {
 		return nil, errors.New("invalid credentials")
 	}
+	s.upgradePassword(user, password)
 
 	return user, nil
 }
 
 // API Key Management
 
+// Errors of GenerateApiKeyKind
+var (
+	ErrAdminKeyExpiry = errors.New("admin API keys must have an expiry")
+	ErrKeyExpiryPast  = errors.New("the expiry must be in the future")
+)
+
+// GenerateApiKey creates a data key that never expires
 func (s *AuthService) GenerateApiKey(userID int64, description string) (string, *core.ApiKey, error) {
-	// Generate random 32-byte key
+	return s.GenerateApiKeyKind(userID, description, core.ApiKeyKindData, nil)
+}
+
+// GenerateApiKeyKind creates a key of a core.ApiKeyKind* kind that expires at
+// expiresAt, nil for never. Admin keys must expire.
+func (s *AuthService) GenerateApiKeyKind(userID int64, description, kind string, expiresAt *time.Time) (string, *core.ApiKey, error) {
+	switch {
+	case kind != core.ApiKeyKindData && kind != core.ApiKeyKindAdmin:
+		return "", nil, fmt.Errorf("unknown API key kind %q", kind)
+	case kind == core.ApiKeyKindAdmin && expiresAt == nil:
+		return "", nil, ErrAdminKeyExpiry
+	case expiresAt != nil && !expiresAt.After(time.Now()):
+		return "", nil, ErrKeyExpiryPast
+	}
+	key, err := randomApiKey()
+	if err != nil {
+		return "", nil, err
+	}
+	return s.storeApiKey(key, &core.ApiKey{UserID: userID, Description: description, Kind: kind, ExpiresAt: expiresAt})
+}
+
+// randomApiKey returns a random 32-byte key, hex encoded
+func randomApiKey() (string, error) {
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
-		return "", nil, err
+		return "", err
 	}
-	key := hex.EncodeToString(bytes)
-	keyPrefix := key[:8]
+	return hex.EncodeToString(bytes), nil
+}
 
+// storeApiKey saves apiKey with the hash of a plain key; only its prefix is
+// kept readable
+func (s *AuthService) storeApiKey(key string, apiKey *core.ApiKey) (string, *core.ApiKey, error) {
 	// Hash the key
 	hasher := sha256.New()
 	hasher.Write([]byte(key))
-	keyHash := hex.EncodeToString(hasher.Sum(nil))
 
-	apiKey := &core.ApiKey{
-		UserID:      userID,
-		KeyPrefix:   keyPrefix,
-		KeyHash:     keyHash,
-		Description: description,
-		CreatedAt:   time.Now(),
-		IsActive:    true,
+	apiKey.KeyPrefix = key[:8]
+	apiKey.KeyHash = hex.EncodeToString(hasher.Sum(nil))
+	apiKey.CreatedAt = time.Now()
+	apiKey.IsActive = true
+	if apiKey.Envelope == "" {
+		apiKey.Envelope = core.EnvelopeV2
 	}
 
 	if err := s.apiKeyRepo.Create(apiKey); err != nil {
@@ -107,7 +187,7 @@ func (s *AuthService) VerifyApiKey(plainKey string) (*core.ApiKey, error) {
 	if err != nil {
 		return nil, err
 	}
-	if apiKey == nil {
+	if apiKey == nil || apiKey.Expired(time.Now()) {
 		return nil, errors.New("invalid api key")
 	}
 
@@ -134,11 +214,11 @@ func (s *AuthService) ResetPassword(username, newPassword string) error {
 		return errors.New("user not found: " + username)
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashedPassword, err := s.hasher.Hash(newPassword)
 	if err != nil {
 		return err
 	}
 
-	user.PasswordHash = string(hashedPassword)
+	user.PasswordHash = hashedPassword
 	return s.userRepo.Update(user)
 }
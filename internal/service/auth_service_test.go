@@ -0,0 +1,200 @@
+package service_test
+
+import (
+	"crypto/sha256"
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"dbbridge/internal/testutil"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthService(t *testing.T) {
+	envs := []struct {
+		name string
+		new  func(testing.TB) *testutil.Env
+	}{
+		{"memory", testutil.NewMemEnv},
+		{"sqlite", testutil.NewSQLiteEnv},
+	}
+	for _, e := range envs {
+		t.Run(e.name, func(t *testing.T) {
+			env := e.new(t)
+			if err := env.Auth.SetupAdmin("admin", "s3cret"); err != nil {
+				t.Fatal(err)
+			}
+			if err := env.Auth.SetupAdmin("other", "s3cret"); err == nil {
+				t.Error("second SetupAdmin succeeded")
+			}
+
+			logins := []struct {
+				name, username, password string
+				ok                       bool
+			}{
+				{"valid", "admin", "s3cret", true},
+				{"wrong password", "admin", "nope", false},
+				{"unknown user", "ghost", "s3cret", false},
+			}
+			for _, tt := range logins {
+				t.Run(tt.name, func(t *testing.T) {
+					user, err := env.Auth.Authenticate(tt.username, tt.password)
+					if tt.ok != (err == nil) {
+						t.Fatalf("Authenticate(%s) error = %v", tt.username, err)
+					}
+					if tt.ok && user.Username != tt.username {
+						t.Errorf("user = %s", user.Username)
+					}
+				})
+			}
+
+			user, err := env.Users.GetUserByUsername("admin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			valid, _ := env.CreateAPIKey(user.ID)
+			revoked, revokedKey := env.CreateAPIKey(user.ID)
+			if err := env.APIKeys.Revoke(revokedKey.ID); err != nil {
+				t.Fatal(err)
+			}
+			tomorrow := time.Now().Add(24 * time.Hour)
+			admin, adminKey, err := env.Auth.GenerateApiKeyKind(user.ID, "provisioning", core.ApiKeyKindAdmin, &tomorrow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !adminKey.IsAdmin() {
+				t.Errorf("kind = %q, want admin", adminKey.Kind)
+			}
+			// Expired keys cannot be generated, so store one directly
+			expired := "expired-key-0123456789"
+			hash := sha256.Sum256([]byte(expired))
+			yesterday := time.Now().Add(-24 * time.Hour)
+			if err := env.APIKeys.Create(&core.ApiKey{UserID: user.ID, KeyPrefix: expired[:8], KeyHash: hex.EncodeToString(hash[:]),
+				Kind: core.ApiKeyKindData, IsActive: true, CreatedAt: yesterday, ExpiresAt: &yesterday}); err != nil {
+				t.Fatal(err)
+			}
+			keys := []struct {
+				name, key string
+				ok        bool
+			}{
+				{"valid key", valid, true},
+				{"admin key", admin, true},
+				{"revoked key", revoked, false},
+				{"expired key", expired, false},
+				{"unknown key", "not-a-key", false},
+			}
+			for _, tt := range keys {
+				t.Run(tt.name, func(t *testing.T) {
+					key, err := env.Auth.VerifyApiKey(tt.key)
+					if tt.ok != (err == nil) {
+						t.Fatalf("VerifyApiKey error = %v", err)
+					}
+					if tt.ok && key.UserID != user.ID {
+						t.Errorf("key of user %d, want %d", key.UserID, user.ID)
+					}
+				})
+			}
+
+			if _, _, err := env.Auth.GenerateApiKeyKind(user.ID, "no expiry", core.ApiKeyKindAdmin, nil); !errors.Is(err, service.ErrAdminKeyExpiry) {
+				t.Errorf("admin key without expiry: %v, want ErrAdminKeyExpiry", err)
+			}
+			if _, _, err := env.Auth.GenerateApiKeyKind(user.ID, "past", core.ApiKeyKindData, &yesterday); !errors.Is(err, service.ErrKeyExpiryPast) {
+				t.Errorf("key expiring yesterday: %v, want ErrKeyExpiryPast", err)
+			}
+		})
+	}
+}
+
+func TestPasswordSchemes(t *testing.T) {
+	envs := []struct {
+		name string
+		new  func(testing.TB) *testutil.Env
+	}{
+		{"memory", testutil.NewMemEnv},
+		{"sqlite", testutil.NewSQLiteEnv},
+	}
+	for _, e := range envs {
+		t.Run(e.name, func(t *testing.T) {
+			env := e.new(t)
+			storedHash := func(username string) string {
+				t.Helper()
+				user, err := env.Users.GetUserByUsername(username)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return user.PasswordHash
+			}
+
+			// New passwords are Argon2id
+			if err := env.Auth.SetupAdmin("admin", "s3cret"); err != nil {
+				t.Fatal(err)
+			}
+			newHash := storedHash("admin")
+			if !strings.HasPrefix(newHash, "$argon2id$v=19$m=8,t=1,p=1$") {
+				t.Fatalf("hash of a new password = %q, want argon2id", newHash)
+			}
+			if _, err := env.Auth.Authenticate("admin", "s3cret"); err != nil {
+				t.Errorf("Argon2id password refused: %v", err)
+			}
+			if _, err := env.Auth.Authenticate("admin", "nope"); err == nil {
+				t.Error("wrong password accepted against Argon2id")
+			}
+			if storedHash("admin") != newHash {
+				t.Error("current hash re-hashed at login")
+			}
+
+			// A bcrypt hash from before Argon2id verifies and is replaced by
+			// the first successful login
+			old, err := service.BcryptHasher{Cost: bcrypt.MinCost}.Hash("legacy-pass")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := env.Users.CreateUser("legacy", old); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := env.Auth.Authenticate("legacy", "wrong"); err == nil {
+				t.Error("wrong password accepted against bcrypt")
+			}
+			if storedHash("legacy") != old {
+				t.Error("bcrypt hash replaced after a failed login")
+			}
+			user, err := env.Auth.Authenticate("legacy", "legacy-pass")
+			if err != nil {
+				t.Fatalf("bcrypt password refused: %v", err)
+			}
+			upgraded := storedHash("legacy")
+			if !strings.HasPrefix(upgraded, "$argon2id$") || user.PasswordHash != upgraded {
+				t.Fatalf("hash after login = %q, returned %q; want the same argon2id hash", upgraded, user.PasswordHash)
+			}
+			if _, err := env.Auth.Authenticate("legacy", "legacy-pass"); err != nil {
+				t.Errorf("upgraded password refused: %v", err)
+			}
+
+			// Raising the cost re-hashes at the next login too
+			stronger := testutil.TestArgon2idParams
+			stronger.Iterations = 2
+			env.Auth.SetPasswordHasher(service.NewArgon2idHasher(stronger))
+			if _, err := env.Auth.Authenticate("admin", "s3cret"); err != nil {
+				t.Fatal(err)
+			}
+			if h := storedHash("admin"); !strings.HasPrefix(h, "$argon2id$v=19$m=8,t=2,p=1$") {
+				t.Errorf("hash after raising the cost = %q", h)
+			}
+
+			// Password resets use the current scheme
+			if err := env.Auth.ResetPassword("legacy", "reset-pass"); err != nil {
+				t.Fatal(err)
+			}
+			if h := storedHash("legacy"); !strings.HasPrefix(h, "$argon2id$v=19$m=8,t=2,p=1$") {
+				t.Errorf("hash after reset = %q", h)
+			}
+			if _, err := env.Auth.Authenticate("legacy", "reset-pass"); err != nil {
+				t.Errorf("reset password refused: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFault is the error of a fault injected by Chaos
+var ErrInjectedFault = errors.New("chaos: injected fault")
+
+// ChaosFault is a fault Chaos injects into a connection's executions
+type ChaosFault struct {
+	ConnectionID     int64   `json:"connection_id"`
+	FailPings        int     `json:"fail_pings"`        // the next pings fail, counting down
+	LatencyMs        int     `json:"latency_ms"`        // added to every connection acquisition
+	ErrorProbability float64 `json:"error_probability"` // of a query failing, 0 to 1
+}
+
+// Validate checks f's ranges
+func (f ChaosFault) Validate() error {
+	if f.ConnectionID <= 0 {
+		return fmt.Errorf("connection_id is required")
+	}
+	if f.FailPings < 0 || f.LatencyMs < 0 {
+		return fmt.Errorf("fail_pings and latency_ms cannot be negative")
+	}
+	if f.ErrorProbability < 0 || f.ErrorProbability > 1 {
+		return fmt.Errorf("error_probability must be between 0 and 1")
+	}
+	return nil
+}
+
+func (f ChaosFault) empty() bool {
+	return f.FailPings == 0 && f.LatencyMs == 0 && f.ErrorProbability == 0
+}
+
+// Chaos injects faults into connections for resilience testing, see
+// CHAOS_MODE. A nil *Chaos injects nothing.
+type Chaos struct {
+	mu     sync.Mutex
+	faults map[int64]*ChaosFault
+}
+
+func NewChaos() *Chaos {
+	return &Chaos{faults: make(map[int64]*ChaosFault)}
+}
+
+// Set replaces the fault of f.ConnectionID; a fault injecting nothing clears it
+func (c *Chaos) Set(f ChaosFault) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f.empty() {
+		delete(c.faults, f.ConnectionID)
+	} else {
+		c.faults[f.ConnectionID] = &f
+	}
+	return nil
+}
+
+// Reset clears every fault
+func (c *Chaos) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.faults = make(map[int64]*ChaosFault)
+}
+
+// Faults lists the faults by connection id, pings already failed deducted
+func (c *Chaos) Faults() []ChaosFault {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := make([]ChaosFault, 0, len(c.faults))
+	for _, f := range c.faults {
+		list = append(list, *f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ConnectionID < list[j].ConnectionID })
+	return list
+}
+
+// acquire delays the acquisition of conn and fails its ping while it has
+// pings to fail. Connections skipping the ping are only delayed.
+func (c *Chaos) acquire(ctx context.Context, conn *core.DBConnection) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	var latency time.Duration
+	failPing := false
+	if f := c.faults[conn.ID]; f != nil {
+		latency = time.Duration(f.LatencyMs) * time.Millisecond
+		if f.FailPings > 0 && !conn.SkipPing {
+			f.FailPings--
+			failPing = true
+		}
+	}
+	c.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if failPing {
+		return fmt.Errorf("failed to ping database: %w", ErrInjectedFault)
+	}
+	return nil
+}
+
+// query fails a query on connectionID with the fault's error probability
+func (c *Chaos) query(connectionID int64) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	var p float64
+	if f := c.faults[connectionID]; f != nil {
+		p = f.ErrorProbability
+	}
+	c.mu.Unlock()
+	if p > 0 && rand.Float64() < p {
+		return ErrInjectedFault
+	}
+	return nil
+}
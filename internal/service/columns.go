@@ -0,0 +1,41 @@
+package service
+
+import "strconv"
+
+// WarningDuplicateColumns flags a result whose column names repeat, e.g. a
+// join selecting id from both tables. Row objects then use deduplicated keys.
+const WarningDuplicateColumns = "duplicate_columns"
+
+// dedupeColumns returns one unique key per column. The first occurrence of a
+// name keeps it; later ones become name_2, name_3, ... skipping any key that
+// is already taken, so the same column list always yields the same keys.
+func dedupeColumns(columns []string) (keys []string, dup bool) {
+	taken := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		taken[col] = true
+	}
+	seen := make(map[string]bool, len(columns))
+	next := make(map[string]int)
+	keys = make([]string, len(columns))
+	for i, col := range columns {
+		if !seen[col] {
+			seen[col] = true
+			keys[i] = col
+			continue
+		}
+		dup = true
+		n := next[col]
+		if n < 2 {
+			n = 2
+		}
+		key := col + "_" + strconv.Itoa(n)
+		for taken[key] {
+			n++
+			key = col + "_" + strconv.Itoa(n)
+		}
+		next[col] = n + 1
+		taken[key] = true
+		keys[i] = key
+	}
+	return keys, dup
+}
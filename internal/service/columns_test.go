@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/data"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDedupeColumns(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []string
+		dup  bool
+	}{
+		{[]string{"id", "name"}, []string{"id", "name"}, false},
+		{[]string{"id", "name", "id", "id"}, []string{"id", "name", "id_2", "id_3"}, true},
+		// A real id_2 column keeps its name; the repeat skips past it
+		{[]string{"id", "id_2", "id", "id"}, []string{"id", "id_2", "id_3", "id_4"}, true},
+		{[]string{"id", "id", "id_2"}, []string{"id", "id_3", "id_2"}, true},
+	}
+	for _, tt := range tests {
+		got, dup := dedupeColumns(tt.in)
+		if !reflect.DeepEqual(got, tt.want) || dup != tt.dup {
+			t.Errorf("dedupeColumns(%v) = %v, %v; want %v, %v", tt.in, got, dup, tt.want, tt.dup)
+		}
+	}
+}
+
+func TestExecuteDuplicateColumns(t *testing.T) {
+	dir := t.TempDir()
+	db, err := data.OpenDB(filepath.Join(dir, "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	crypto, err := NewEncryptionService(strings.Repeat("k", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	connRepo, queryRepo := data.NewConnectionRepo(db), data.NewQueryRepo(db)
+	userRepo, apiKeyRepo := data.NewUserRepo(db), data.NewApiKeyRepo(db)
+	seeder := NewDemoSeeder(connRepo, queryRepo, userRepo, apiKeyRepo, NewAuthService(userRepo, apiKeyRepo), crypto)
+	if _, err := seeder.Seed(context.Background(), DemoOptions{SamplePath: filepath.Join(dir, "sample.db")}); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := connRepo.GetByName(demoConnectionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executor := NewQueryExecutor(connRepo, queryRepo, &memAuditRepo{cursors: map[string]int64{}}, crypto, nil)
+	res, err := executor.ExecuteSQL(context.Background(), conn.ID, "SELECT 1 AS id, 'a' AS name, 2 AS id, 3 AS id", nil, 0)
+	if err != nil {
+		t.Fatalf("ExecuteSQL() error = %v", err)
+	}
+
+	if want := []string{"id", "name", "id", "id"}; !reflect.DeepEqual(res.Meta.Columns, want) {
+		t.Errorf("Meta.Columns = %v, want original names %v", res.Meta.Columns, want)
+	}
+	if want := []string{"id", "name", "id_2", "id_3"}; !reflect.DeepEqual(res.Meta.RowKeys(), want) {
+		t.Errorf("Meta.RowKeys() = %v, want %v", res.Meta.RowKeys(), want)
+	}
+	row := res.Data[0]
+	if len(row) != 4 || row["id"] != int64(1) || row["id_2"] != int64(2) || row["id_3"] != int64(3) {
+		t.Errorf("row = %v", row)
+	}
+	if len(res.Warnings) == 0 || res.Warnings[0] != WarningDuplicateColumns {
+		t.Errorf("Warnings = %v, want %s", res.Warnings, WarningDuplicateColumns)
+	}
+}
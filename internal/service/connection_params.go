@@ -0,0 +1,98 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// WarningForcedParams flags an execution whose request set a parameter its
+// connection forces; the request's value was not used
+const WarningForcedParams = "forced_params"
+
+// ConnectionParams are the parameters a connection gives every query run on
+// it, stored as its default params JSON:
+//
+//	{"defaults": {"region": "EU"}, "forced": {"company_id": 3}}
+//
+// A parameter takes the first value set by the request, by the query's own
+// {param:default}, or by the connection's defaults. Forced parameters take
+// the connection's value whatever the request sends, like row-level security.
+type ConnectionParams struct {
+	Defaults map[string]interface{} `json:"defaults,omitempty"`
+	Forced   map[string]interface{} `json:"forced,omitempty"`
+}
+
+var reParamName = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// ParseConnectionParams reads a connection's default params JSON, see
+// ConnectionParams. Empty is none.
+func ParseConnectionParams(s string) (*ConnectionParams, error) {
+	p := &ConnectionParams{}
+	if strings.TrimSpace(s) == "" {
+		return p, nil
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("invalid default params: %w", err)
+	}
+	for _, set := range []map[string]interface{}{p.Defaults, p.Forced} {
+		for name, v := range set {
+			if !reParamName.MatchString(name) || slices.Contains(core.ReservedParams, name) {
+				return nil, fmt.Errorf("invalid default params: %q cannot be a parameter name", name)
+			}
+			if _, ok := v.(map[string]interface{}); ok {
+				return nil, fmt.Errorf("invalid default params: %s must be a value or a list, not an object", name)
+			}
+		}
+	}
+	for name := range p.Forced {
+		if _, ok := p.Defaults[name]; ok {
+			return nil, fmt.Errorf("invalid default params: %s is both a default and forced", name)
+		}
+	}
+	return p, nil
+}
+
+// applyConnectionParams merges the parameters of conn into copies of params
+// and audited, see ConnectionParams. overridden reports a forced parameter
+// the request had set.
+func (e *QueryExecutor) applyConnectionParams(conn *core.DBConnection, sqlText string, params, audited map[string]interface{}) (bound, boundAudited map[string]interface{}, overridden bool, err error) {
+	cp, err := ParseConnectionParams(conn.DefaultParams)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("connection %s: %w", conn.Name, err)
+	}
+	if len(cp.Defaults) == 0 && len(cp.Forced) == 0 {
+		return params, audited, false, nil
+	}
+
+	bound = make(map[string]interface{}, len(params)+len(cp.Defaults)+len(cp.Forced))
+	boundAudited = make(map[string]interface{}, len(audited)+len(cp.Defaults)+len(cp.Forced))
+	for name, v := range params {
+		bound[name] = v
+	}
+	for name, v := range audited {
+		boundAudited[name] = v
+	}
+	if len(cp.Defaults) > 0 {
+		// The query's own defaults come before the connection's
+		parsed := e.parser.Parse(sqlText, nil)
+		for name, v := range cp.Defaults {
+			_, queryDefault := parsed.Defaults[name]
+			_, queryRawDefault := parsed.RawDefaults[name]
+			if _, set := bound[name]; !set && !queryDefault && !queryRawDefault {
+				bound[name], boundAudited[name] = v, v
+			}
+		}
+	}
+	for name, v := range cp.Forced {
+		_, set := params[name]
+		overridden = overridden || set
+		bound[name], boundAudited[name] = v, v
+	}
+	return bound, boundAudited, overridden, nil
+}
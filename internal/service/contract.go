@@ -0,0 +1,306 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QueryContract is what API consumers of a saved query depend on: its
+// endpoint, request parameters and output shape. Queries declare no output
+// columns, so the output is described by the result mode and the fields the
+// shaping config nests rows under.
+type QueryContract struct {
+	Slug       string                   `json:"slug"`
+	Params     map[string]ContractParam `json:"params"`
+	ResultMode string                   `json:"result_mode"`
+	Nested     []string                 `json:"nested,omitempty"`    // child groups of the shaping config
+	Lifecycle  *ContractLifecycle       `json:"lifecycle,omitempty"` // nil while no deprecation is planned
+}
+
+// ContractLifecycle is the planned deprecation of a query, dates as
+// YYYY-MM-DD in server time
+type ContractLifecycle struct {
+	DeprecatedAt string `json:"deprecated_at,omitempty"`
+	SunsetAt     string `json:"sunset_at,omitempty"`
+	SupersededBy string `json:"superseded_by,omitempty"`
+}
+
+// String describes the lifecycle for the admin UI
+func (l *ContractLifecycle) String() string {
+	var parts []string
+	if l.DeprecatedAt != "" {
+		parts = append(parts, "deprecated from "+l.DeprecatedAt)
+	}
+	if l.SunsetAt != "" {
+		parts = append(parts, "sunset on "+l.SunsetAt)
+	}
+	if l.SupersededBy != "" {
+		parts = append(parts, "superseded by "+l.SupersededBy)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ContractParam is a request parameter as documented by QueryParams
+type ContractParam struct {
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+	In       string `json:"in,omitempty"`
+	Header   string `json:"header,omitempty"`
+}
+
+// ContractOf returns the contract of q, nil when q is nil or inactive and so
+// has no endpoint
+func ContractOf(q *core.SavedQuery) *QueryContract {
+	if q == nil || !q.IsActive {
+		return nil
+	}
+	c := &QueryContract{Slug: q.Slug, Params: make(map[string]ContractParam), ResultMode: core.NormalizeResultMode(q.ResultMode)}
+	for _, p := range QueryParams(q) {
+		c.Params[p.Name] = ContractParam{Type: p.Type, Required: p.Required, In: p.In, Header: p.Header}
+	}
+	if shape, err := ParseShapeConfig(q.ShapeConfig); err == nil && shape != nil {
+		for name := range shape.Children {
+			c.Nested = append(c.Nested, name)
+		}
+		sort.Strings(c.Nested)
+	}
+	if q.DeprecatedAt != nil || q.SunsetAt != nil || q.SupersededBy != "" {
+		c.Lifecycle = &ContractLifecycle{SupersededBy: q.SupersededBy}
+		if q.DeprecatedAt != nil {
+			c.Lifecycle.DeprecatedAt = q.DeprecatedAt.Local().Format(time.DateOnly)
+		}
+		if q.SunsetAt != nil {
+			c.Lifecycle.SunsetAt = q.SunsetAt.Local().Format(time.DateOnly)
+		}
+	}
+	return c
+}
+
+// Contract changes
+const (
+	ContractAdded   = "added"
+	ContractChanged = "changed"
+	ContractRemoved = "removed"
+)
+
+// ContractDiff describes how a query's contract changed
+type ContractDiff struct {
+	Change        string                   `json:"change"` // a Contract* constant
+	Endpoint      *FieldChange             `json:"endpoint,omitempty"`
+	AddedParams   map[string]ContractParam `json:"added_params,omitempty"`
+	RemovedParams map[string]ContractParam `json:"removed_params,omitempty"`
+	ChangedParams map[string]FieldChange   `json:"changed_params,omitempty"`
+	Output        *FieldChange             `json:"output,omitempty"`    // result mode and nested fields
+	Lifecycle     *FieldChange             `json:"lifecycle,omitempty"` // ContractLifecycle, nil for none
+}
+
+// DiffContracts compares two contracts, either nil when the endpoint does not
+// exist. It returns nil when they are the same.
+func DiffContracts(from, to *QueryContract) *ContractDiff {
+	switch {
+	case from == nil && to == nil:
+		return nil
+	case from == nil:
+		return &ContractDiff{Change: ContractAdded, AddedParams: to.Params}
+	case to == nil:
+		return &ContractDiff{Change: ContractRemoved, RemovedParams: from.Params}
+	}
+
+	d := &ContractDiff{Change: ContractChanged}
+	if from.Slug != to.Slug {
+		d.Endpoint = &FieldChange{Old: from.Slug, New: to.Slug}
+	}
+	for name, p := range to.Params {
+		o, ok := from.Params[name]
+		switch {
+		case !ok:
+			if d.AddedParams == nil {
+				d.AddedParams = make(map[string]ContractParam)
+			}
+			d.AddedParams[name] = p
+		case o != p:
+			if d.ChangedParams == nil {
+				d.ChangedParams = make(map[string]FieldChange)
+			}
+			d.ChangedParams[name] = FieldChange{Old: o, New: p}
+		}
+	}
+	for name, p := range from.Params {
+		if _, ok := to.Params[name]; !ok {
+			if d.RemovedParams == nil {
+				d.RemovedParams = make(map[string]ContractParam)
+			}
+			d.RemovedParams[name] = p
+		}
+	}
+	if from.ResultMode != to.ResultMode || !reflect.DeepEqual(from.Nested, to.Nested) {
+		d.Output = &FieldChange{
+			Old: map[string]interface{}{"result_mode": from.ResultMode, "nested": from.Nested},
+			New: map[string]interface{}{"result_mode": to.ResultMode, "nested": to.Nested},
+		}
+	}
+	if !reflect.DeepEqual(from.Lifecycle, to.Lifecycle) {
+		d.Lifecycle = &FieldChange{Old: from.Lifecycle, New: to.Lifecycle}
+	}
+	if d.Endpoint == nil && d.AddedParams == nil && d.RemovedParams == nil && d.ChangedParams == nil && d.Output == nil && d.Lifecycle == nil {
+		return nil
+	}
+	return d
+}
+
+// Summary describes a changed contract in a sentence for the admin UI
+func (d *ContractDiff) Summary() string {
+	names := func(m interface{}) string {
+		keys := reflect.ValueOf(m).MapKeys()
+		list := make([]string, len(keys))
+		for i, k := range keys {
+			list[i] = k.String()
+		}
+		sort.Strings(list)
+		return strings.Join(list, ", ")
+	}
+	var parts []string
+	if d.Endpoint != nil {
+		parts = append(parts, fmt.Sprintf("endpoint renamed from %v to %v", d.Endpoint.Old, d.Endpoint.New))
+	}
+	if len(d.AddedParams) > 0 {
+		parts = append(parts, "parameters added: "+names(d.AddedParams))
+	}
+	if len(d.RemovedParams) > 0 {
+		parts = append(parts, "parameters removed: "+names(d.RemovedParams))
+	}
+	if len(d.ChangedParams) > 0 {
+		parts = append(parts, "parameters changed: "+names(d.ChangedParams))
+	}
+	if d.Output != nil {
+		parts = append(parts, "output shape changed")
+	}
+	if d.Lifecycle != nil {
+		if l, _ := d.Lifecycle.New.(*ContractLifecycle); l != nil {
+			parts = append(parts, "deprecation planned: "+l.String())
+		} else {
+			parts = append(parts, "deprecation withdrawn")
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ContractLog records the contract changes of saved queries and lists them
+// for API consumers
+type ContractLog struct {
+	repo      core.ContractRepository
+	queryRepo core.QueryRepository
+	connRepo  core.ConnectionRepository
+}
+
+func NewContractLog(repo core.ContractRepository, queryRepo core.QueryRepository, connRepo core.ConnectionRepository) *ContractLog {
+	return &ContractLog{repo: repo, queryRepo: queryRepo, connRepo: connRepo}
+}
+
+// Record compares a query before and after a save or delete (nil for a
+// create or delete) and stores the change if its contract changed. It
+// returns the change, nil when the contract is the same.
+func (l *ContractLog) Record(before, after *core.SavedQuery) (*ContractDiff, error) {
+	from, to := ContractOf(before), ContractOf(after)
+	diff := DiffContracts(from, to)
+	if diff == nil {
+		return nil, nil
+	}
+	q := after
+	if q == nil {
+		q = before
+	}
+	change := &core.ContractChange{QueryID: q.ID, QuerySlug: q.Slug, OldContract: contractJSON(from), NewContract: contractJSON(to)}
+	return diff, l.repo.Add(change)
+}
+
+func contractJSON(c *QueryContract) string {
+	if c == nil {
+		return ""
+	}
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// ChangelogEntry is a contract change as listed to API consumers
+type ChangelogEntry struct {
+	Query     string    `json:"query"`
+	ChangedAt time.Time `json:"changed_at"`
+	*ContractDiff
+}
+
+// Changelog lists the contract changes made since, oldest first, as seen by
+// an API key with scopes: the changes of every query that is active now and
+// the removals of the others. A scoped key only sees the queries that run on
+// one of its connections, so not those deleted since.
+func (l *ContractLog) Changelog(since time.Time, scopes []core.KeyScope) ([]ChangelogEntry, error) {
+	changes, err := l.repo.ListSince(since)
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[int64]bool)
+	queries, err := l.queryRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range queries {
+		active[q.ID] = q.IsActive
+	}
+	visible, err := l.visible(queries, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []ChangelogEntry{}
+	for _, c := range changes {
+		var from, to *QueryContract
+		if c.OldContract != "" {
+			from = &QueryContract{}
+			if err := json.Unmarshal([]byte(c.OldContract), from); err != nil {
+				return nil, fmt.Errorf("contract change %d: %w", c.ID, err)
+			}
+		}
+		if c.NewContract != "" {
+			to = &QueryContract{}
+			if err := json.Unmarshal([]byte(c.NewContract), to); err != nil {
+				return nil, fmt.Errorf("contract change %d: %w", c.ID, err)
+			}
+		}
+		diff := DiffContracts(from, to)
+		if diff == nil || (diff.Change != ContractRemoved && !active[c.QueryID]) {
+			continue
+		}
+		if visible != nil && !visible[c.QueryID] {
+			continue
+		}
+		entries = append(entries, ChangelogEntry{Query: c.QuerySlug, ChangedAt: c.ChangedAt, ContractDiff: diff})
+	}
+	return entries, nil
+}
+
+// visible returns the queries a key with scopes may run on at least one of
+// their connections, nil when the key is not scoped
+func (l *ContractLog) visible(queries []core.SavedQuery, scopes []core.KeyScope) (map[int64]bool, error) {
+	if len(scopes) == 0 {
+		return nil, nil
+	}
+	conns, err := l.connRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	allowed := make(map[int64]bool)
+	for i := range conns {
+		allowed[conns[i].ID] = core.ScopesAllow(scopes, &conns[i])
+	}
+	visible := make(map[int64]bool)
+	for _, q := range queries {
+		visible[q.ID] = slices.ContainsFunc(q.AllowedConnectionIDs, func(id int64) bool { return allowed[id] })
+	}
+	return visible, nil
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/data"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffContracts(t *testing.T) {
+	q := &core.SavedQuery{Slug: "orders", IsActive: true, SQLText: "SELECT * FROM orders WHERE customer = {customer} AND status = {status:open}"}
+	before := ContractOf(q)
+	if DiffContracts(before, ContractOf(q)) != nil {
+		t.Error("same query reported a contract change")
+	}
+
+	// A new default makes a parameter optional; comments don't matter
+	changed := *q
+	changed.SQLText = "SELECT * FROM orders WHERE customer = {customer:0} AND placed >= {since} -- newest first"
+	changed.ResultMode = core.ResultModeObject
+	d := DiffContracts(before, ContractOf(&changed))
+	if d == nil || d.Change != ContractChanged {
+		t.Fatalf("diff = %+v, want a change", d)
+	}
+	if _, ok := d.AddedParams["since"]; !ok || len(d.AddedParams) != 1 {
+		t.Errorf("added = %v, want since", d.AddedParams)
+	}
+	if _, ok := d.RemovedParams["status"]; !ok || len(d.RemovedParams) != 1 {
+		t.Errorf("removed = %v, want status", d.RemovedParams)
+	}
+	if c, ok := d.ChangedParams["customer"]; !ok || c.Old.(ContractParam).Required != true || c.New.(ContractParam).Required != false {
+		t.Errorf("changed = %v, want customer to become optional", d.ChangedParams)
+	}
+	if d.Output == nil {
+		t.Error("result mode change not reported")
+	}
+	if got, want := d.Summary(), "parameters added: since; parameters removed: status; parameters changed: customer; output shape changed"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+
+	sunset := time.Date(2026, 6, 30, 0, 0, 0, 0, time.Local)
+	deprecated := *q
+	deprecated.SunsetAt, deprecated.SupersededBy = &sunset, "orders-v2"
+	if d := DiffContracts(before, ContractOf(&deprecated)); d == nil || d.Lifecycle == nil {
+		t.Errorf("deprecation = %+v, want a lifecycle change", d)
+	} else if got, want := d.Summary(), "deprecation planned: sunset on 2026-06-30, superseded by orders-v2"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+
+	inactive := *q
+	inactive.IsActive = false
+	if d := DiffContracts(before, ContractOf(&inactive)); d == nil || d.Change != ContractRemoved {
+		t.Errorf("deactivation = %+v, want removed", d)
+	}
+}
+
+func TestContractLogChangelog(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	queryRepo := data.NewQueryRepo(db)
+	log := NewContractLog(data.NewContractRepo(db), queryRepo, data.NewConnectionRepo(db))
+
+	start := time.Now().Add(-time.Second)
+	q := &core.SavedQuery{Slug: "orders", IsActive: true, SQLText: "SELECT * FROM orders WHERE id = {id}"}
+	if err := queryRepo.Create(q); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := log.Record(nil, q); err != nil || d == nil || d.Change != ContractAdded {
+		t.Fatalf("create = %+v, %v", d, err)
+	}
+	gone := &core.SavedQuery{Slug: "legacy", IsActive: true, SQLText: "SELECT 1"}
+	queryRepo.Create(gone)
+	log.Record(nil, gone)
+	queryRepo.Delete(gone.ID)
+	log.Record(gone, nil)
+
+	before := *q
+	q.Description = "edited"
+	if d, _ := log.Record(&before, q); d != nil {
+		t.Errorf("description edit = %+v, want no contract change", d)
+	}
+	q.SQLText = "SELECT * FROM orders WHERE id = {id} AND {region:eu} = region"
+	queryRepo.Update(q)
+	log.Record(&before, q)
+
+	entries, err := log.Changelog(start, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Query+" "+e.Change)
+	}
+	// legacy's addition is hidden now that it is deleted, its removal is not
+	want := []string{"orders added", "legacy removed", "orders changed"}
+	if len(got) != len(want) {
+		t.Fatalf("changelog = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("changelog = %v, want %v", got, want)
+			break
+		}
+	}
+	if _, ok := entries[2].AddedParams["region"]; !ok {
+		t.Errorf("orders change = %+v, want region added", entries[2].ContractDiff)
+	}
+
+	if entries, _ := log.Changelog(time.Now().Add(time.Hour), nil); len(entries) != 0 {
+		t.Errorf("changelog from the future = %v", entries)
+	}
+}
+
+func TestContractLogChangelogScopes(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	connRepo := data.NewConnectionRepo(db)
+	queryRepo := data.NewQueryRepo(db)
+	log := NewContractLog(data.NewContractRepo(db), queryRepo, connRepo)
+
+	start := time.Now().Add(-time.Second)
+	shop := &core.DBConnection{Name: "shop", Driver: "sqlite", IsActive: true}
+	hr := &core.DBConnection{Name: "hr", Driver: "sqlite", IsActive: true, Environment: "production"}
+	for _, c := range []*core.DBConnection{shop, hr} {
+		if err := connRepo.Create(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, q := range []*core.SavedQuery{
+		{Slug: "orders", IsActive: true, SQLText: "SELECT 1", AllowedConnectionIDs: []int64{shop.ID}},
+		{Slug: "salaries", IsActive: true, SQLText: "SELECT 2", AllowedConnectionIDs: []int64{hr.ID}},
+	} {
+		if err := queryRepo.Create(q); err != nil {
+			t.Fatal(err)
+		}
+		log.Record(nil, q)
+	}
+
+	for scope, want := range map[string]string{
+		"":                "orders salaries",
+		"shop":            "orders",
+		"env:production":  "salaries",
+		"env:staging":     "",
+		"shop,env:stage2": "orders",
+	} {
+		scopes, err := core.ParseKeyScopes(scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := log.Changelog(start, scopes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Query)
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("scopes %q see %v, want %q", scope, got, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"errors"
+)
+
+// DBError is a database error translated for API callers: Error returns the
+// cleaned message while Err keeps the driver's full error for the audit log
+type DBError struct {
+	Code    core.DBErrorClass
+	Message string
+	Err     error
+}
+
+func (e *DBError) Error() string { return e.Message }
+
+func (e *DBError) Unwrap() error { return e.Err }
+
+// translateDBError classifies err, a driver error from the dialect's database
+// wrapped as full, into a DBError. A query stopped by the query timeout is a
+// timeout whatever the driver says; an error no rule matches is left as full.
+func translateDBError(ctx context.Context, dialect core.Dialect, err, full error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = context.DeadlineExceeded
+	}
+	class, message, ok := core.ClassifyDBError(dialect.Name(), err)
+	if !ok {
+		return full
+	}
+	return &DBError{Code: class, Message: message, Err: full}
+}
+
+// ErrorDetail returns the full text of err for administrators, the driver's
+// original error when err was translated
+func ErrorDetail(err error) string {
+	var dbErr *DBError
+	if errors.As(err, &dbErr) {
+		return dbErr.Err.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SetDetailRepo enables the debug capture of queries flagged DebugCapture
+func (e *QueryExecutor) SetDetailRepo(repo core.ExecutionDetailRepository) {
+	e.details = repo
+}
+
+// debugCapture reports whether executions of saved query queryID store the
+// SQL they send, and whether with the argument values. The DEBUG_CAPTURE
+// setting turns every capture off.
+func (e *QueryExecutor) debugCapture(queryID int64) (capture, values bool) {
+	if e.details == nil || queryID == 0 {
+		return false, false
+	}
+	if e.settings != nil && e.settings.Get("DEBUG_CAPTURE") == "false" {
+		return false, false
+	}
+	q, err := e.queryRepo.GetByID(queryID)
+	if err != nil || !q.DebugCapture {
+		return false, false
+	}
+	return true, q.DebugCaptureValues
+}
+
+// newExecutionDetail describes the final SQL and its arguments. Without
+// values only their types are kept.
+func newExecutionDetail(sqlText string, args []interface{}, values bool) *core.ExecutionDetail {
+	d := &core.ExecutionDetail{SQL: sqlText, ArgTypes: make([]string, len(args))}
+	for i, arg := range args {
+		d.ArgTypes[i] = argType(arg)
+	}
+	if values && len(args) > 0 {
+		if b, err := json.Marshal(args); err == nil {
+			d.ArgValues = string(b)
+		} else {
+			d.ArgValues = fmt.Sprintf("%q", fmt.Sprint(args...))
+		}
+	}
+	return d
+}
+
+// argType names the type of a bound argument as the driver receives it
+func argType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case []byte:
+		return "bytes"
+	case time.Time:
+		return "time"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// saveDetail links a captured execution to its audit entry
+func (e *QueryExecutor) saveDetail(auditID int64, d *core.ExecutionDetail) {
+	if auditID == 0 {
+		return
+	}
+	d.AuditID = auditID
+	if err := e.details.Add(d); err != nil {
+		logger.Error.Printf("Debug capture of audit entry %d failed: %v", auditID, err)
+	}
+}
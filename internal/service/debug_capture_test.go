@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/data"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebugCapture(t *testing.T) {
+	dir := t.TempDir()
+	db, err := data.OpenDB(filepath.Join(dir, "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	crypto, err := NewEncryptionService(strings.Repeat("k", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	connRepo, queryRepo, auditRepo := data.NewConnectionRepo(db), data.NewQueryRepo(db), data.NewAuditRepo(db)
+	details := data.NewExecutionDetailRepo(db)
+	enc, _ := crypto.Encrypt("file:" + filepath.Join(dir, "sample.db") + "?create_if_missing=true")
+	conn := &core.DBConnection{Name: "sample", Driver: "sqlite", ConnectionStringEnc: enc, IsActive: true}
+	if err := connRepo.Create(conn); err != nil {
+		t.Fatal(err)
+	}
+	q := &core.SavedQuery{Slug: "lookup", SQLText: "SELECT {id} AS id, {name} AS name", IsActive: true,
+		DebugCapture: true, AllowedConnectionIDs: []int64{conn.ID}}
+	if err := queryRepo.Create(q); err != nil {
+		t.Fatal(err)
+	}
+	executor := NewQueryExecutor(connRepo, queryRepo, auditRepo, crypto, nil)
+	executor.SetDetailRepo(details)
+
+	run := func() *core.ExecutionDetail {
+		t.Helper()
+		params := map[string]interface{}{"id": 7, "name": "Ada"}
+		if _, err := executor.Execute(context.Background(), conn.ID, "lookup", params); err != nil {
+			t.Fatal(err)
+		}
+		logs, err := auditRepo.GetRecent(1)
+		if err != nil || len(logs) != 1 {
+			t.Fatalf("audit: %v, %v", logs, err)
+		}
+		d, err := details.Get(logs[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	d := run()
+	if d == nil || !strings.Contains(d.SQL, "AS name") || strings.Contains(d.SQL, "{name}") || len(d.ArgTypes) != 2 {
+		t.Fatalf("types-only capture = %+v", d)
+	}
+	if d.ArgValues != "" || strings.Contains(d.SQL, "Ada") {
+		t.Errorf("values captured without debug_capture_values: %+v", d)
+	}
+
+	q.DebugCaptureValues = true
+	queryRepo.Update(q)
+	if d := run(); d == nil || !strings.Contains(d.ArgValues, "Ada") {
+		t.Errorf("capture with values = %+v", d)
+	}
+
+	q.DebugCapture = false
+	queryRepo.Update(q)
+	if d := run(); d != nil {
+		t.Errorf("captured without debug_capture: %+v", d)
+	}
+}
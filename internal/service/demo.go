@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"dbbridge/internal/core"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// Demo mode credentials. They are only created in the throwaway database of
+// `dbbridge --demo`; `dbbridge seed` generates a random key instead.
+const (
+	DemoUsername = "demo"
+	DemoPassword = "demo"
+	DemoAPIKey   = "demo-key-dbbridge-sample"
+)
+
+const demoConnectionName = "demo-sample"
+
+// sampleSchema is the demo SQLite database: a handful of customers and their orders
+const sampleSchema = `
+CREATE TABLE IF NOT EXISTS customers (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL,
+	city TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS orders (
+	id INTEGER PRIMARY KEY,
+	customer_id INTEGER NOT NULL REFERENCES customers(id),
+	ordered_at TEXT NOT NULL,
+	status TEXT NOT NULL,
+	total REAL NOT NULL
+);`
+
+const sampleData = `
+INSERT INTO customers (id, name, email, city, created_at) VALUES
+	(1, 'Ana Lima', 'ana@example.com', 'Lisbon', '2024-01-08'),
+	(2, 'Budi Santoso', 'budi@example.com', 'Jakarta', '2024-01-15'),
+	(3, 'Chloe Martin', 'chloe@example.com', 'Paris', '2024-02-02'),
+	(4, 'Dewi Lestari', 'dewi@example.com', 'Bandung', '2024-02-19'),
+	(5, 'Erik Johansson', 'erik@example.com', 'Stockholm', '2024-03-04'),
+	(6, 'Fatima Zahra', 'fatima@example.com', 'Casablanca', '2024-03-22'),
+	(7, 'Gita Rahma', 'gita@example.com', 'Jakarta', '2024-04-10'),
+	(8, 'Hiro Tanaka', 'hiro@example.com', 'Osaka', '2024-04-28'),
+	(9, 'Ines Garcia', 'ines@example.com', 'Madrid', '2024-05-13'),
+	(10, 'Jonas Weber', 'jonas@example.com', 'Berlin', '2024-06-01'),
+	(11, 'Kemal Aydin', 'kemal@example.com', 'Istanbul', '2024-06-17'),
+	(12, 'Lucas Souza', 'lucas@example.com', 'Lisbon', '2024-07-05');
+
+INSERT INTO orders (id, customer_id, ordered_at, status, total) VALUES
+	(1, 1, '2024-02-01', 'delivered', 120.50),
+	(2, 1, '2024-03-12', 'delivered', 75.00),
+	(3, 2, '2024-02-20', 'delivered', 310.00),
+	(4, 2, '2024-05-03', 'shipped', 45.90),
+	(5, 3, '2024-03-01', 'cancelled', 89.99),
+	(6, 3, '2024-04-14', 'delivered', 150.00),
+	(7, 4, '2024-03-30', 'delivered', 62.40),
+	(8, 4, '2024-06-22', 'pending', 230.00),
+	(9, 5, '2024-04-02', 'delivered', 99.00),
+	(10, 6, '2024-04-18', 'shipped', 180.75),
+	(11, 7, '2024-05-09', 'delivered', 55.00),
+	(12, 7, '2024-06-30', 'pending', 410.20),
+	(13, 8, '2024-05-21', 'delivered', 128.00),
+	(14, 9, '2024-06-11', 'shipped', 74.30),
+	(15, 9, '2024-07-02', 'pending', 19.99),
+	(16, 10, '2024-06-15', 'delivered', 260.00),
+	(17, 11, '2024-07-01', 'cancelled', 140.00),
+	(18, 12, '2024-07-20', 'pending', 88.80);`
+
+// demoQueries show the query features: pagination and sorting, required and
+// defaulted parameters, array parameters and result modes
+var demoQueries = []core.SavedQuery{
+	{
+		Slug:        "demo-customers",
+		Description: "Customers, paginated and sortable: ?page=2&per_page=5&order_by=city",
+		SQLText:     "SELECT id, name, email, city FROM customers {order_by:name(id,name,city,created_at):asc} {pagination:1:5}",
+	},
+	{
+		Slug:        "demo-customer-orders",
+		Description: "Orders of one customer, required parameter: ?customer_id=2",
+		SQLText:     "SELECT id, ordered_at, status, total FROM orders WHERE customer_id = {customer_id} ORDER BY ordered_at",
+	},
+	{
+		Slug:        "demo-orders-by-status",
+		Description: `Orders in any of several statuses, array parameter: ?statuses=["pending","shipped"]`,
+		SQLText: "SELECT o.id, c.name AS customer, o.status, o.total FROM orders o JOIN customers c ON c.id = o.customer_id " +
+			"WHERE o.status IN ({statuses}) ORDER BY o.id",
+	},
+	{
+		Slug:        "demo-revenue-by-city",
+		Description: "Revenue per city, parameter with a default: ?min_total=100",
+		SQLText: "SELECT c.city, COUNT(o.id) AS orders, SUM(o.total) AS revenue FROM orders o JOIN customers c ON c.id = o.customer_id " +
+			"WHERE o.total >= {min_total:0} AND o.status <> 'cancelled' GROUP BY c.city ORDER BY revenue DESC",
+	},
+	{
+		Slug:        "demo-customer",
+		Description: "One customer as an object (404 when missing): ?id=3",
+		SQLText:     "SELECT id, name, email, city, created_at FROM customers WHERE id = {id}",
+		ResultMode:  core.ResultModeObject,
+	},
+	{
+		Slug:        "demo-order-count",
+		Description: "Number of orders in a status, scalar result: ?status=delivered",
+		SQLText:     "SELECT COUNT(*) FROM orders WHERE status = {status:pending}",
+		ResultMode:  core.ResultModeScalar,
+	},
+}
+
+// DemoOptions controls what DemoSeeder.Seed creates
+type DemoOptions struct {
+	SamplePath  string // sample SQLite database, created and filled if empty
+	APIKey      string // plain API key to store, empty = random
+	CreateAdmin bool   // create DemoUsername/DemoPassword when no user exists
+}
+
+// DemoSeedResult reports what was seeded; objects that already existed are left alone
+type DemoSeedResult struct {
+	ConnectionName string
+	Queries        []string // slugs created by this run
+	APIKey         string   // plain key, empty when none was created
+	Admin          string   // username created by this run, if any
+}
+
+// DemoSeeder creates the demo connection, queries and API key. Every object it
+// creates is flagged IsDemo and badged in the admin UI.
+type DemoSeeder struct {
+	connRepo   core.ConnectionRepository
+	queryRepo  core.QueryRepository
+	userRepo   core.UserRepository
+	apiKeyRepo core.ApiKeyRepository
+	authSvc    *AuthService
+	cryptoSvc  *EncryptionService
+}
+
+func NewDemoSeeder(connRepo core.ConnectionRepository, queryRepo core.QueryRepository, userRepo core.UserRepository, apiKeyRepo core.ApiKeyRepository, authSvc *AuthService, cryptoSvc *EncryptionService) *DemoSeeder {
+	return &DemoSeeder{
+		connRepo:   connRepo,
+		queryRepo:  queryRepo,
+		userRepo:   userRepo,
+		apiKeyRepo: apiKeyRepo,
+		authSvc:    authSvc,
+		cryptoSvc:  cryptoSvc,
+	}
+}
+
+// Seed is idempotent: running it again only adds what is missing
+func (s *DemoSeeder) Seed(ctx context.Context, opts DemoOptions) (*DemoSeedResult, error) {
+	samplePath, err := filepath.Abs(opts.SamplePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := createSampleDB(ctx, samplePath); err != nil {
+		return nil, fmt.Errorf("sample database: %w", err)
+	}
+
+	result := &DemoSeedResult{ConnectionName: demoConnectionName}
+	conn, err := s.demoConnection(samplePath)
+	if err != nil {
+		return nil, fmt.Errorf("demo connection: %w", err)
+	}
+
+	for _, q := range demoQueries {
+		if _, err := s.queryRepo.GetBySlug(q.Slug); err == nil {
+			continue
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		q.ParamsConfig = "{}"
+		q.IsActive = true
+		q.IsDemo = true
+		q.UpdatedBy = core.SystemActor
+		q.ResultMode = core.NormalizeResultMode(q.ResultMode)
+		q.AllowedConnectionIDs = []int64{conn.ID}
+		if err := s.queryRepo.Create(&q); err != nil {
+			return nil, fmt.Errorf("demo query %s: %w", q.Slug, err)
+		}
+		result.Queries = append(result.Queries, q.Slug)
+	}
+
+	if opts.CreateAdmin {
+		count, err := s.userRepo.CountUsers()
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			if err := s.authSvc.SetupAdmin(DemoUsername, DemoPassword); err != nil {
+				return nil, fmt.Errorf("demo admin: %w", err)
+			}
+			result.Admin = DemoUsername
+		}
+	}
+
+	key, err := s.demoAPIKey(opts.APIKey)
+	if err != nil {
+		return nil, fmt.Errorf("demo api key: %w", err)
+	}
+	result.APIKey = key
+	return result, nil
+}
+
+func (s *DemoSeeder) demoConnection(samplePath string) (*core.DBConnection, error) {
+	conn, err := s.connRepo.GetByName(demoConnectionName)
+	if err == nil {
+		return conn, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	enc, err := s.cryptoSvc.Encrypt(samplePath)
+	if err != nil {
+		return nil, err
+	}
+	conn = &core.DBConnection{
+		Name:                demoConnectionName,
+		Driver:              "sqlite",
+		ConnectionStringEnc: enc,
+		IsActive:            true,
+		IsDemo:              true,
+		UpdatedBy:           core.SystemActor,
+	}
+	if err := s.connRepo.Create(conn); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// demoAPIKey creates one demo key for the first user. It returns "" when a
+// demo key exists already (its plain value is not stored) or there is no user yet.
+func (s *DemoSeeder) demoAPIKey(plain string) (string, error) {
+	keys, err := s.apiKeyRepo.List()
+	if err != nil {
+		return "", err
+	}
+	for _, k := range keys {
+		if k.IsDemo && k.IsActive {
+			return "", nil
+		}
+	}
+
+	users, err := s.userRepo.GetAll()
+	if err != nil || len(users) == 0 {
+		return "", err
+	}
+	if plain == "" {
+		if plain, err = randomApiKey(); err != nil {
+			return "", err
+		}
+	}
+	key, _, err := s.authSvc.storeApiKey(plain, &core.ApiKey{UserID: users[0].ID, Description: "Demo key", Kind: core.ApiKeyKindData, IsDemo: true})
+	return key, err
+}
+
+// createSampleDB creates the customers/orders database at path, filling it
+// only when it is new so repeated seeding keeps any edits
+func createSampleDB(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, sampleSchema); err != nil {
+		return err
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM customers").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = db.ExecContext(ctx, sampleData)
+	return err
+}
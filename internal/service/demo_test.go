@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/data"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDemoSeederSeedsRunnableQueries(t *testing.T) {
+	dir := t.TempDir()
+	db, err := data.OpenDB(filepath.Join(dir, "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	crypto, err := NewEncryptionService(strings.Repeat("k", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	connRepo, queryRepo := data.NewConnectionRepo(db), data.NewQueryRepo(db)
+	userRepo, apiKeyRepo := data.NewUserRepo(db), data.NewApiKeyRepo(db)
+	authSvc := NewAuthService(userRepo, apiKeyRepo)
+	seeder := NewDemoSeeder(connRepo, queryRepo, userRepo, apiKeyRepo, authSvc, crypto)
+
+	opts := DemoOptions{SamplePath: filepath.Join(dir, "sample.db"), APIKey: DemoAPIKey, CreateAdmin: true}
+	result, err := seeder.Seed(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	if result.Admin != DemoUsername || result.APIKey != DemoAPIKey || len(result.Queries) != len(demoQueries) {
+		t.Fatalf("Seed() = %+v", result)
+	}
+	key, err := authSvc.VerifyApiKey(DemoAPIKey)
+	if err != nil || !key.IsDemo {
+		t.Fatalf("demo key not usable: %+v, %v", key, err)
+	}
+
+	conn, err := connRepo.GetByName(demoConnectionName)
+	if err != nil || !conn.IsDemo {
+		t.Fatalf("demo connection = %+v, %v", conn, err)
+	}
+	if conn.UpdatedBy != core.SystemActor || conn.CreatedAt == nil || conn.UpdatedAt == nil {
+		t.Errorf("demo connection attribution = %v %v %q", conn.CreatedAt, conn.UpdatedAt, conn.UpdatedBy)
+	}
+	executor := NewQueryExecutor(connRepo, queryRepo, &memAuditRepo{cursors: map[string]int64{}}, crypto, nil)
+	params := map[string]map[string]interface{}{
+		"demo-customers":        {"page": "2", "order_by": "city"},
+		"demo-customer-orders":  {"customer_id": "2"},
+		"demo-orders-by-status": {"statuses": `["pending","shipped"]`},
+		"demo-revenue-by-city":  {},
+		"demo-customer":         {"id": "3"},
+		"demo-order-count":      {"status": "delivered"},
+	}
+	for _, q := range demoQueries {
+		t.Run(q.Slug, func(t *testing.T) {
+			saved, err := queryRepo.GetBySlug(q.Slug)
+			if err != nil || !saved.IsDemo {
+				t.Fatalf("GetBySlug() = %+v, %v", saved, err)
+			}
+			res, err := executor.Execute(context.Background(), conn.ID, q.Slug, params[q.Slug])
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if len(res.Data) == 0 {
+				t.Errorf("Execute() returned no rows")
+			}
+		})
+	}
+
+	// Seeding again adds nothing
+	again, err := seeder.Seed(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("second Seed() error = %v", err)
+	}
+	if len(again.Queries) != 0 || again.APIKey != "" || again.Admin != "" {
+		t.Errorf("second Seed() = %+v, want nothing new", again)
+	}
+}
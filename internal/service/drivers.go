@@ -0,0 +1,61 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrDriverDisabled is returned for executions on a connection whose driver
+// is disabled while DISABLED_DRIVER_CONNECTIONS is block
+var ErrDriverDisabled = errors.New("driver disabled")
+
+// DriverRegistry is core.DriverPresets as configured: SUPPORTED_DRIVERS
+// enables drivers for new connections, and DISABLED_DRIVER_CONNECTIONS says
+// whether saved connections on other drivers still run. Without settings
+// every driver is enabled.
+type DriverRegistry struct {
+	settings *SettingsService
+}
+
+func NewDriverRegistry(settings *SettingsService) *DriverRegistry {
+	return &DriverRegistry{settings: settings}
+}
+
+// DriverOption is a preset of the connection form
+type DriverOption struct {
+	core.DriverPreset
+	Enabled bool
+}
+
+// Enabled reports whether new connections may use driver
+func (r *DriverRegistry) Enabled(driver string) bool {
+	if r == nil || r.settings == nil {
+		return true
+	}
+	enabled := r.settings.List("SUPPORTED_DRIVERS")
+	if len(enabled) == 0 {
+		return true
+	}
+	driver = core.DriverName(driver)
+	return slices.ContainsFunc(enabled, func(name string) bool { return core.DriverName(name) == driver })
+}
+
+// Options returns every preset with whether its driver is enabled
+func (r *DriverRegistry) Options() []DriverOption {
+	options := make([]DriverOption, len(core.DriverPresets))
+	for i, p := range core.DriverPresets {
+		options[i] = DriverOption{DriverPreset: p, Enabled: r.Enabled(p.Driver)}
+	}
+	return options
+}
+
+// CheckRun refuses executions on a disabled driver when
+// DISABLED_DRIVER_CONNECTIONS is block
+func (r *DriverRegistry) CheckRun(driver string) error {
+	if r.Enabled(driver) || r.settings.Get("DISABLED_DRIVER_CONNECTIONS") != "block" {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is not in SUPPORTED_DRIVERS", ErrDriverDisabled, core.DriverName(driver))
+}
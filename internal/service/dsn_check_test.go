@@ -0,0 +1,76 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  string
+		connStr string
+		want    DSNParts
+	}{
+		{"postgres keywords", "postgres", "host=db.local port=5433 user=app password='p w' dbname=sales",
+			DSNParts{Form: DSNFormKeyValue, Host: "db.local", Port: "5433", Database: "sales", User: "app", Password: "p w"}},
+		{"postgres url", "postgres", "postgres://app:pw@db.local:5433/sales?sslmode=disable",
+			DSNParts{Form: DSNFormURL, Host: "db.local", Port: "5433", Database: "sales", User: "app", Password: "pw"}},
+		{"mysql", "mysql", "app:pw@tcp(db.local:3307)/sales",
+			DSNParts{Form: DSNFormDriver, Host: "db.local", Port: "3307", Database: "sales", User: "app", Password: "pw"}},
+		{"sqlserver", "sqlserver", "server=db.local,1444;database=sales;user id=sa;password=pw",
+			DSNParts{Form: DSNFormKeyValue, Host: "db.local", Port: "1444", Database: "sales", User: "sa"}},
+		{"oracle sid", "oracle", "oracle://app:pw@db.local:1521?SID=orcl",
+			DSNParts{Form: DSNFormURL, Host: "db.local", Port: "1521", Database: "orcl", User: "app", Password: "pw"}},
+		{"odbc braces", "odbc", "Driver={SQL Anywhere 17};Uid=dba;Pwd={a;b}};c};Host=db.local:2638",
+			DSNParts{Form: DSNFormKeyValue, Host: "db.local", Port: "2638", User: "dba", Password: "a;b};c"}},
+		{"unknown driver", "duckdb", "anything", DSNParts{Form: DSNFormDriver}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDSN(tt.driver, tt.connStr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got.Options = nil
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("ParseDSN() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDSN(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  string
+		connStr string
+		want    []string // fields of the findings, "" for the whole string
+	}{
+		{"postgres fine", "postgres", "host=db.local user=app password=x9 dbname=sales", nil},
+		{"postgres preset left as is", "postgres", "host=localhost port=5432 user=postgres password=secret dbname=mydb sslmode=disable", []string{"password"}},
+		{"postgres not key=value", "postgres", "db.local:5432", []string{""}},
+		{"postgres port", "postgres", "host=db.local port=54x2 user=app", []string{"port"}},
+		{"postgres url port", "postgres", "postgres://app@db.local:54x2/sales", []string{"port"}},
+		{"mysql no database", "mysql", "app:pw@tcp(db.local:3306)/", []string{"database"}},
+		{"mysql placeholders", "mysql", "user:password@tcp(127.0.0.1:3306)/dbname", []string{"database", "user", "password"}},
+		{"sqlserver no server", "sqlserver", "database=sales;user id=sa", []string{""}},
+		{"oracle not a url", "oracle", "app/pw@db.local:1521/orcl", []string{""}},
+		{"oracle no service", "oracle", "oracle://app:pw@db.local:1521", []string{"database"}},
+		{"odbc no driver", "odbc", "Server=db.local;Uid=sa;Pwd=x9", []string{"driver"}},
+		{"deferred values", "postgres", "host=${DBB_VAR_HOST} port=${DBB_VAR_PORT} user=app password=vault:secret/db#pw", nil},
+		{"empty", "postgres", " ", []string{""}},
+		{"unknown driver", "duckdb", "anything", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, f := range CheckDSN(tt.driver, tt.connStr, nil) {
+				fields = append(fields, f.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("CheckDSN() fields = %q, want %q (%v)", fields, tt.want, CheckDSN(tt.driver, tt.connStr, nil))
+			}
+		})
+	}
+}
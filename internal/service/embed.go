@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"dbbridge/internal/core"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Embed token limits
+const (
+	DefaultEmbedRowCap = 50
+	MaxEmbedRowCap     = 1000
+	MaxEmbedTTL        = 365 * 24 * time.Hour
+)
+
+var (
+	// ErrEmbedNotFound is returned for a token that is unknown or whose
+	// signature does not verify
+	ErrEmbedNotFound    = errors.New("embed token not found")
+	ErrEmbedExpired     = errors.New("embed token expired")
+	ErrEmbedRevoked     = errors.New("embed token revoked")
+	ErrEmbedRateLimited = errors.New("embed rate limit exceeded")
+)
+
+type embedKey struct{}
+
+// EmbedOptions describes a new embed token
+type EmbedOptions struct {
+	QueryID      int64
+	ConnectionID int64
+	Params       map[string]interface{}
+	RowCap       int // DefaultEmbedRowCap when 0
+	TTL          time.Duration
+	Label        string
+	CreatedBy    int64
+}
+
+// EmbedService issues and serves embed tokens: signed, expiring links that
+// show one saved query's results on one connection, e.g. in an iframe on an
+// intranet page. A token is "<id>.<signature>", the signature being an HMAC
+// of everything the token binds keyed by DBBRIDGE_KEY, so a stored token
+// whose query, connection, parameters, row cap or expiry were changed no
+// longer verifies. Runs are sample runs of RowCap rows, and every hit of a
+// token that verifies is audited against it with mode "embed".
+type EmbedService struct {
+	repo     core.EmbedTokenRepository
+	executor *QueryExecutor
+	key      []byte
+}
+
+func NewEmbedService(repo core.EmbedTokenRepository, executor *QueryExecutor, secret string) *EmbedService {
+	// A key of its own, so embed signatures are not made with the
+	// connection encryption key itself
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("dbbridge embed tokens"))
+	return &EmbedService{repo: repo, executor: executor, key: mac.Sum(nil)}
+}
+
+// Create issues a token for a read-only saved query on one of its allowed
+// connections and returns it with the stored token
+func (s *EmbedService) Create(opts EmbedOptions) (string, *core.EmbedToken, error) {
+	q, err := s.executor.queryRepo.GetByID(opts.QueryID)
+	if err != nil {
+		return "", nil, fmt.Errorf("query not found: %w", err)
+	}
+	if core.IsWriteSQL(q.SQLText) {
+		return "", nil, errors.New("queries that write can't be embedded")
+	}
+	if !slices.Contains(q.AllowedConnectionIDs, opts.ConnectionID) {
+		return "", nil, errors.New("the query does not run on that connection")
+	}
+	if opts.RowCap == 0 {
+		opts.RowCap = DefaultEmbedRowCap
+	}
+	if opts.RowCap < 1 || opts.RowCap > MaxEmbedRowCap {
+		return "", nil, fmt.Errorf("the row cap must be between 1 and %d", MaxEmbedRowCap)
+	}
+	if opts.TTL <= 0 || opts.TTL > MaxEmbedTTL {
+		return "", nil, fmt.Errorf("the token must expire within %d days", int(MaxEmbedTTL.Hours()/24))
+	}
+	params := ""
+	if len(opts.Params) > 0 {
+		b, err := json.Marshal(opts.Params)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid parameters: %w", err)
+		}
+		params = string(b)
+	}
+
+	now := time.Now()
+	t := &core.EmbedToken{
+		QueryID:      q.ID,
+		ConnectionID: opts.ConnectionID,
+		Params:       params,
+		RowCap:       opts.RowCap,
+		Label:        strings.TrimSpace(opts.Label),
+		CreatedBy:    opts.CreatedBy,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(opts.TTL),
+	}
+	if err := s.repo.Create(t); err != nil {
+		return "", nil, err
+	}
+	return s.Token(t), t, nil
+}
+
+// List returns the tokens of a query, newest first
+func (s *EmbedService) List(queryID int64) ([]core.EmbedToken, error) {
+	return s.repo.ListByQuery(queryID)
+}
+
+// Get returns a token by id
+func (s *EmbedService) Get(id int64) (*core.EmbedToken, error) {
+	return s.repo.GetByID(id)
+}
+
+// Revoke stops a token from working
+func (s *EmbedService) Revoke(id int64) error {
+	return s.repo.Revoke(id)
+}
+
+// Token returns the signed token of t
+func (s *EmbedService) Token(t *core.EmbedToken) string {
+	return strconv.FormatInt(t.ID, 10) + "." + base64.RawURLEncoding.EncodeToString(s.sign(t))
+}
+
+func (s *EmbedService) sign(t *core.EmbedToken) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%d|%d|%d|%d|%d|%s", t.ID, t.QueryID, t.ConnectionID, t.RowCap, t.ExpiresAt.Unix(), t.Params)
+	return mac.Sum(nil)
+}
+
+// Resolve returns the token of a signed token. An expired or revoked token
+// is returned along with ErrEmbedExpired or ErrEmbedRevoked.
+func (s *EmbedService) Resolve(token string) (*core.EmbedToken, error) {
+	idText, sigText, ok := strings.Cut(token, ".")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	sig, sigErr := base64.RawURLEncoding.DecodeString(sigText)
+	if !ok || err != nil || sigErr != nil {
+		return nil, ErrEmbedNotFound
+	}
+	t, err := s.repo.GetByID(id)
+	if err != nil || !hmac.Equal(sig, s.sign(t)) {
+		return nil, ErrEmbedNotFound
+	}
+	if t.RevokedAt != nil {
+		return t, ErrEmbedRevoked
+	}
+	if !t.Active(time.Now()) {
+		return t, ErrEmbedExpired
+	}
+	return t, nil
+}
+
+// Refuse audits a hit of t that was refused with err
+func (s *EmbedService) Refuse(ctx context.Context, t *core.EmbedToken, err error) {
+	s.executor.recordAudit(context.WithValue(ctx, embedKey{}, t.ID), time.Now(), t.ConnectionID, t.QueryID, embedParams(t), "", err, "", nil)
+}
+
+// Run runs the query of t with its parameters, at most t.RowCap rows. The
+// query is checked again as Create checked it, since it may have been edited
+// since the token was issued.
+func (s *EmbedService) Run(ctx context.Context, t *core.EmbedToken) (*ExecutionResult, error) {
+	q, err := s.executor.queryRepo.GetByID(t.QueryID)
+	switch {
+	case err != nil:
+	case !q.IsActive:
+		err = errors.New("the query is inactive")
+	case core.IsWriteSQL(q.SQLText):
+		err = errors.New("queries that write can't be embedded")
+	case !slices.Contains(q.AllowedConnectionIDs, t.ConnectionID):
+		err = errors.New("the query does not run on that connection")
+	}
+	if err != nil {
+		s.Refuse(ctx, t, err)
+		return nil, err
+	}
+	if err := s.repo.UpdateLastUsed(t.ID); err != nil {
+		return nil, err
+	}
+	ctx = WithSample(context.WithValue(ctx, embedKey{}, t.ID), t.RowCap)
+	return s.executor.Execute(ctx, t.ConnectionID, q.Slug, embedParams(t))
+}
+
+func embedParams(t *core.EmbedToken) map[string]interface{} {
+	params := map[string]interface{}{}
+	if t.Params != "" {
+		json.Unmarshal([]byte(t.Params), &params)
+	}
+	return params
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/data"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	db, err := data.OpenDB(filepath.Join(dir, "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	crypto, err := NewEncryptionService(strings.Repeat("k", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	connRepo, queryRepo := data.NewConnectionRepo(db), data.NewQueryRepo(db)
+	enc, _ := crypto.Encrypt("file:" + filepath.Join(dir, "sample.db") + "?create_if_missing=true")
+
+	var ids []int64
+	for _, c := range []core.DBConnection{
+		{Name: "orders-dev", Environment: "dev"},
+		{Name: "orders-prod", Environment: "prod"},
+		{Name: "orders-prod-replica", Environment: "prod"},
+	} {
+		c.Driver, c.ConnectionStringEnc, c.IsActive = "sqlite", enc, true
+		if err := connRepo.Create(&c); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, c.ID)
+	}
+	if err := queryRepo.Create(&core.SavedQuery{Slug: "ping", SQLText: "SELECT 1 AS one", IsActive: true, AllowedConnectionIDs: ids}); err != nil {
+		t.Fatal(err)
+	}
+	executor := NewQueryExecutor(connRepo, queryRepo, &memAuditRepo{cursors: map[string]int64{}}, crypto, nil)
+
+	if name, err := executor.ResolveEnvironment("Dev", "ping"); err != nil || name != "orders-dev" {
+		t.Errorf("ResolveEnvironment(dev) = %q, %v", name, err)
+	}
+	var envErr *EnvironmentError
+	if _, err := executor.ResolveEnvironment("prod", "ping"); !errors.As(err, &envErr) || len(envErr.Matches) != 2 {
+		t.Errorf("ResolveEnvironment(prod) error = %v, want two matches", err)
+	}
+	if _, err := executor.ResolveEnvironment("staging", "ping"); !errors.As(err, &envErr) || len(envErr.Matches) != 0 {
+		t.Errorf("ResolveEnvironment(staging) error = %v, want no match", err)
+	}
+
+	// A key scoped to an environment may not run on other connections
+	ctx := context.WithValue(context.Background(), core.ContextKeyApiKeyScopes, []core.KeyScope{{Name: "dev", Environment: true}})
+	if _, err := executor.ExecuteByName(ctx, "orders-dev", "ping", nil); err != nil {
+		t.Errorf("in scope: %v", err)
+	}
+	var scopeErr *core.KeyScopeError
+	if _, err := executor.ExecuteByName(ctx, "orders-prod", "ping", nil); !errors.As(err, &scopeErr) {
+		t.Errorf("out of scope error = %v, want KeyScopeError", err)
+	}
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WindowStatus is the audit status of an execution refused by its window
+const WindowStatus = "OUTSIDE_WINDOW"
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ExecWindow restricts when a saved query may run, e.g. outside an ERP's
+// business hours:
+//
+//	{"start": "18:00", "end": "07:00", "days": ["mon", "tue", "wed", "thu", "fri"], "timezone": "Asia/Jakarta"}
+//
+// An end before the start is an overnight window, which belongs to the day it
+// starts on. No days means every day; no timezone means the server's.
+type ExecWindow struct {
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Days     []string `json:"days,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+
+	start, end time.Duration // since midnight
+	loc        *time.Location
+}
+
+// ParseExecWindow parses and checks a query's execution window. An empty
+// string means the query may run at any time and returns nil.
+func ParseExecWindow(s string) (*ExecWindow, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var w ExecWindow
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&w); err != nil {
+		return nil, fmt.Errorf("invalid execution window: %w", err)
+	}
+	var err error
+	if w.start, err = parseClock(w.Start); err != nil {
+		return nil, fmt.Errorf("invalid execution window start: %w", err)
+	}
+	if w.end, err = parseClock(w.End); err != nil {
+		return nil, fmt.Errorf("invalid execution window end: %w", err)
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("invalid execution window: start and end are both %s", w.Start)
+	}
+	for i, d := range w.Days {
+		w.Days[i] = strings.ToLower(d)
+		if dayIndex(w.Days[i]) < 0 {
+			return nil, fmt.Errorf("invalid execution window: unknown day %q (use mon..sun)", d)
+		}
+	}
+	w.loc = time.Local
+	if w.Timezone != "" {
+		if w.loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid execution window timezone: %w", err)
+		}
+	}
+	return &w, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func dayIndex(d string) int {
+	for i, name := range weekdays {
+		if name == d {
+			return i
+		}
+	}
+	return -1
+}
+
+// HasDay reports whether the window opens on day ("mon".."sun")
+func (w *ExecWindow) HasDay(day string) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// opening returns when the window starting on day opens and closes
+func (w *ExecWindow) opening(day time.Time) (time.Time, time.Time) {
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, w.loc)
+	end := midnight.Add(w.end)
+	if w.end < w.start {
+		end = end.AddDate(0, 0, 1)
+	}
+	return midnight.Add(w.start), end
+}
+
+// Next returns t if the window is open at t, otherwise when it opens next
+func (w *ExecWindow) Next(t time.Time) time.Time {
+	local := t.In(w.loc)
+	// Yesterday's overnight window may still be open
+	for d := -1; d <= 7; d++ {
+		day := local.AddDate(0, 0, d)
+		if !w.HasDay(weekdays[day.Weekday()]) {
+			continue
+		}
+		open, closing := w.opening(day)
+		if !t.Before(closing) {
+			continue
+		}
+		if t.Before(open) {
+			return open
+		}
+		return t
+	}
+	return t // unreachable with at least one valid day
+}
+
+// Allows reports whether the window is open at t
+func (w *ExecWindow) Allows(t time.Time) bool {
+	return w.Next(t).Equal(t)
+}
+
+// WindowError is an execution refused because its query's window is closed
+type WindowError struct {
+	Slug string
+	Next time.Time // when the window opens
+}
+
+func (e *WindowError) Error() string {
+	return fmt.Sprintf("query %s may not run now, its execution window opens at %s", e.Slug, e.Next.Format(time.RFC3339))
+}
+
+type windowOverrideKey struct{}
+
+// WithWindowOverride lets executions under ctx ignore execution windows, for
+// explicit admin test runs
+func WithWindowOverride(ctx context.Context) context.Context {
+	return context.WithValue(ctx, windowOverrideKey{}, true)
+}
+
+// checkWindow refuses saved query queryID when its window is closed. Ad-hoc
+// SQL (queryID 0) has no window.
+func (e *QueryExecutor) checkWindow(ctx context.Context, queryID int64) error {
+	if queryID == 0 || ctx.Value(windowOverrideKey{}) != nil {
+		return nil
+	}
+	q, err := e.queryRepo.GetByID(queryID)
+	if err != nil {
+		return fmt.Errorf("query not found: %w", err)
+	}
+	w, err := ParseExecWindow(q.ExecWindow)
+	if err != nil || w == nil {
+		return err
+	}
+	now := time.Now()
+	if next := w.Next(now); !next.Equal(now) {
+		return &WindowError{Slug: q.Slug, Next: next}
+	}
+	return nil
+}
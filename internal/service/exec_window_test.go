@@ -0,0 +1,57 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExecWindow(t *testing.T) {
+	if w, err := ParseExecWindow(""); w != nil || err != nil {
+		t.Errorf("ParseExecWindow(\"\") = %v, %v", w, err)
+	}
+	for _, bad := range []string{
+		`{"start": "25:00", "end": "17:00"}`,
+		`{"start": "09:00", "end": "09:00"}`,
+		`{"start": "09:00", "end": "17:00", "days": ["monday"]}`,
+		`{"start": "09:00", "end": "17:00", "timezone": "Nowhere/City"}`,
+		`{"start": "09:00", "end": "17:00", "hours": 8}`,
+	} {
+		if _, err := ParseExecWindow(bad); err == nil {
+			t.Errorf("ParseExecWindow(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestExecWindowNext(t *testing.T) {
+	// Weeknights 18:00-07:00 Jakarta time; 2026-10-12 is a Monday
+	w, err := ParseExecWindow(`{"start": "18:00", "end": "07:00", "days": ["MON", "tue", "wed", "thu", "fri"], "timezone": "Asia/Jakarta"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt, _ := time.LoadLocation("Asia/Jakarta")
+	at := func(day, hour, min int) time.Time { return time.Date(2026, 10, day, hour, min, 0, 0, jkt) }
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"monday business hours", at(12, 10, 0), at(12, 18, 0)},
+		{"monday evening", at(12, 18, 0), at(12, 18, 0)},
+		{"tuesday early morning", at(13, 6, 59), at(13, 6, 59)},
+		{"tuesday window closed", at(13, 7, 0), at(13, 18, 0)},
+		{"saturday morning after friday night", at(17, 6, 30), at(17, 6, 30)},
+		{"saturday evening", at(17, 20, 0), at(19, 18, 0)},
+		{"from another timezone", at(12, 10, 0).UTC(), at(12, 18, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := w.Next(tt.now); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+			if w.Allows(tt.now) != tt.now.Equal(tt.want) {
+				t.Errorf("Allows(%v) disagrees with Next", tt.now)
+			}
+		})
+	}
+}
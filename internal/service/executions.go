@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CancelledStatus is the audit status of an execution cancelled by an admin
+const CancelledStatus = "CANCELLED"
+
+// ErrExecutionCancelled is returned by an execution cancelled from the admin UI
+var ErrExecutionCancelled = errors.New("execution cancelled by an administrator")
+
+// Execution is an execution in flight
+type Execution struct {
+	ID           int64
+	QuerySlug    string // empty for ad-hoc SQL
+	ConnectionID int64
+	Connection   string
+	Mode         string // as audited: "", "count" or "sample"
+	Caller       string
+	StartedAt    time.Time
+
+	cancel context.CancelCauseFunc
+}
+
+// Elapsed is how long the execution has been running
+func (x Execution) Elapsed() time.Duration {
+	return time.Since(x.StartedAt).Truncate(time.Millisecond)
+}
+
+// ExecutionRegistry tracks the executions in flight so they can be listed and
+// cancelled
+type ExecutionRegistry struct {
+	mu      sync.Mutex
+	nextID  int64
+	running map[int64]*Execution
+}
+
+func NewExecutionRegistry() *ExecutionRegistry {
+	return &ExecutionRegistry{running: make(map[int64]*Execution)}
+}
+
+// Start registers x and returns the context to run it under, cancelled by
+// Cancel with ErrExecutionCancelled as its cause. done must be called when the
+// execution ends, deferred so that a panic removes the entry too.
+func (r *ExecutionRegistry) Start(ctx context.Context, x Execution) (runCtx context.Context, done func()) {
+	runCtx, cancel := context.WithCancelCause(ctx)
+	x.cancel = cancel
+	x.StartedAt = time.Now()
+
+	r.mu.Lock()
+	r.nextID++
+	x.ID = r.nextID
+	r.running[x.ID] = &x
+	r.mu.Unlock()
+
+	return runCtx, func() {
+		r.mu.Lock()
+		delete(r.running, x.ID)
+		r.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// List returns the executions in flight, longest running first
+func (r *ExecutionRegistry) List() []Execution {
+	r.mu.Lock()
+	list := make([]Execution, 0, len(r.running))
+	for _, x := range r.running {
+		list = append(list, *x)
+	}
+	r.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Cancel cancels execution id, returning it; false when it is not running
+func (r *ExecutionRegistry) Cancel(id int64) (Execution, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	x, ok := r.running[id]
+	if !ok {
+		return Execution{}, false
+	}
+	x.cancel(ErrExecutionCancelled)
+	return *x, true
+}
+
+// Executions is the registry of the executor's executions in flight
+func (e *QueryExecutor) Executions() *ExecutionRegistry {
+	return e.executions
+}
+
+// trackExecution registers an execution of conn with e's registry. The
+// returned finish must be deferred; it sets the error of a cancelled execution
+// to ErrExecutionCancelled, whatever it returned, and removes the entry.
+func (e *QueryExecutor) trackExecution(ctx context.Context, conn *core.DBConnection, queryID int64, mode string) (context.Context, func(*error)) {
+	x := Execution{ConnectionID: conn.ID, Connection: conn.Name, Mode: mode, Caller: callerOf(ctx)}
+	if queryID != 0 {
+		if q, err := e.queryRepo.GetByID(queryID); err == nil {
+			x.QuerySlug = q.Slug
+		}
+	}
+	runCtx, done := e.executions.Start(ctx, x)
+	return runCtx, func(err *error) {
+		if errors.Is(context.Cause(runCtx), ErrExecutionCancelled) {
+			*err = ErrExecutionCancelled
+		}
+		done()
+	}
+}
+
+// callerOf describes who started the execution under ctx
+func callerOf(ctx context.Context) string {
+	caller := "anonymous"
+	if id, ok := ctx.Value(core.ContextKeyApiKeyID).(int64); ok {
+		caller = fmt.Sprintf("API key #%d", id)
+	} else if id, ok := ctx.Value(core.ContextKeyUserID).(int64); ok && id != 0 {
+		caller = fmt.Sprintf("user #%d", id)
+	}
+	if ip, _ := ctx.Value(core.ContextKeyClientIP).(string); ip != "" {
+		caller += " from " + ip
+	}
+	return caller
+}
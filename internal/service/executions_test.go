@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestExecutionRegistry(t *testing.T) {
+	r := NewExecutionRegistry()
+	ctx, done := r.Start(context.Background(), Execution{QuerySlug: "orders", Connection: "erp"})
+
+	list := r.List()
+	if len(list) != 1 || list[0].QuerySlug != "orders" || list[0].StartedAt.IsZero() {
+		t.Fatalf("List() = %+v", list)
+	}
+	x, ok := r.Cancel(list[0].ID)
+	if !ok || x.Connection != "erp" {
+		t.Fatalf("Cancel() = %+v, %v", x, ok)
+	}
+	if !errors.Is(context.Cause(ctx), ErrExecutionCancelled) {
+		t.Errorf("cause = %v, want ErrExecutionCancelled", context.Cause(ctx))
+	}
+
+	done()
+	if len(r.List()) != 0 {
+		t.Error("entry left after done")
+	}
+	if _, ok := r.Cancel(x.ID); ok {
+		t.Error("Cancel() of a finished execution = true")
+	}
+}
+
+func TestExecutionRegistryPanic(t *testing.T) {
+	r := NewExecutionRegistry()
+	func() {
+		defer func() { recover() }()
+		_, done := r.Start(context.Background(), Execution{})
+		defer done()
+		panic("driver bug")
+	}()
+	if len(r.List()) != 0 {
+		t.Error("entry left after a panic")
+	}
+}
@@ -6,11 +6,13 @@ import (
 	"dbbridge/internal/core"
 	"dbbridge/internal/logger"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/alexbrainman/odbc"
@@ -20,22 +22,76 @@ type QueryExecutor struct {
 	connRepo  core.ConnectionRepository
 	queryRepo core.QueryRepository
 	auditRepo core.AuditRepository
+	audit     *AuditWriter // nil = audit entries are written synchronously
 	cryptoSvc *EncryptionService
+	settings  *SettingsService
+	secrets   *SecretResolver // nil when Vault is not configured
+	sqlite    SQLiteFilePolicy
+	drivers   *DriverRegistry
+	details   core.ExecutionDetailRepository // nil = no debug capture
+	chaos     *Chaos                         // nil = no injected faults
 	parser    *core.SQLParser
+
+	executions *ExecutionRegistry
+
+	attachedMu sync.RWMutex
+	attached   map[int64]*sql.DB // by connection id, see AttachDB
 }
 
-func NewQueryExecutor(connRepo core.ConnectionRepository, queryRepo core.QueryRepository, auditRepo core.AuditRepository, cryptoSvc *EncryptionService) *QueryExecutor {
+func NewQueryExecutor(connRepo core.ConnectionRepository, queryRepo core.QueryRepository, auditRepo core.AuditRepository, cryptoSvc *EncryptionService, settings *SettingsService) *QueryExecutor {
 	return &QueryExecutor{
 		connRepo:  connRepo,
 		queryRepo: queryRepo,
 		auditRepo: auditRepo,
 		cryptoSvc: cryptoSvc,
+		settings:  settings,
+		drivers:   NewDriverRegistry(settings),
 		parser:    core.NewSQLParser(),
+
+		executions: NewExecutionRegistry(),
+	}
+}
+
+// SetSecretResolver enables vault: references in connection strings
+func (e *QueryExecutor) SetSecretResolver(r *SecretResolver) {
+	e.secrets = r
+}
+
+// SetAuditWriter moves audit writes off the request path onto w
+func (e *QueryExecutor) SetAuditWriter(w *AuditWriter) {
+	e.audit = w
+}
+
+// SetSQLitePolicy restricts the files sqlite connections may open
+func (e *QueryExecutor) SetSQLitePolicy(p SQLiteFilePolicy) {
+	e.sqlite = p
+}
+
+// SetChaos injects c's faults into connection acquisitions and queries, for
+// resilience testing only (CHAOS_MODE)
+func (e *QueryExecutor) SetChaos(c *Chaos) {
+	e.chaos = c
+}
+
+// queryTimeout is QUERY_TIMEOUT_SECONDS from the runtime settings (30s without settings)
+func (e *QueryExecutor) queryTimeout() time.Duration {
+	if e.settings == nil {
+		return 30 * time.Second
+	}
+	return time.Duration(e.settings.Int("QUERY_TIMEOUT_SECONDS")) * time.Second
+}
+
+// maxRows is MAX_ROWS from the runtime settings, 0 = unlimited
+func (e *QueryExecutor) maxRows() int {
+	if e.settings == nil {
+		return 0
 	}
+	return e.settings.Int("MAX_ROWS")
 }
 
 type MetaInfo struct {
 	Columns    []string `json:"columns,omitempty"`
+	Keys       []string `json:"keys,omitempty"` // row object keys, set only when column names repeat
 	Total      *int64   `json:"total,omitempty"`
 	Page       *int     `json:"page,omitempty"`
 	PerPage    *int     `json:"per_page,omitempty"`
@@ -44,15 +100,30 @@ type MetaInfo struct {
 	HasPrev    *bool    `json:"has_prev,omitempty"`
 	NextPage   *int     `json:"next_page,omitempty"`
 	PrevPage   *int     `json:"prev_page,omitempty"`
+	Truncated  bool     `json:"truncated,omitempty"` // stopped at MAX_ROWS
+}
+
+// RowKeys returns the keys of each row object, in column order.
+func (m MetaInfo) RowKeys() []string {
+	if m.Keys != nil {
+		return m.Keys
+	}
+	return m.Columns
 }
 
 type ExecutionResult struct {
-	Data       []map[string]interface{} `json:"data"`
-	Meta       MetaInfo                 `json:"meta,omitempty"`
-	Error      string                   `json:"error,omitempty"`
-	DebugSQL   string                   `json:"debug_sql,omitempty"`
-	DebugCount string                   `json:"debug_count_sql,omitempty"`
-	DebugArgs  interface{}              `json:"debug_args,omitempty"`
+	Data        []map[string]interface{} `json:"data"`
+	Meta        MetaInfo                 `json:"meta,omitempty"`
+	Error       string                   `json:"error,omitempty"`
+	DebugSQL    string                   `json:"debug_sql,omitempty"`
+	DebugCount  string                   `json:"debug_count_sql,omitempty"`
+	DebugArgs   interface{}              `json:"debug_args,omitempty"`
+	Warnings    []string                 `json:"warnings,omitempty"` // soft limits exceeded (see SoftLimits), duplicate_columns, deprecated (also by an old slug), schema_drift
+	ColumnTypes []ResponseColumn         `json:"-"`                  // the columns by row key with their driver types
+	ResultMode  string                   `json:"-"`                  // the saved query's result mode, shaped by the handler
+	Shape       *ShapeConfig             `json:"-"`                  // nesting applied to JSON output, nil = flat rows
+	XMLRoot     string                   `json:"-"`                  // root element for XML output
+	Response    *ResponseConfig          `json:"-"`                  // custom headers and empty status, nil = none
 }
 
 func (e *QueryExecutor) Execute(ctx context.Context, connectionID int64, querySlug string, params map[string]interface{}) (result *ExecutionResult, err error) {
@@ -71,7 +142,34 @@ func (e *QueryExecutor) Execute(ctx context.Context, connectionID int64, querySl
 	// The request is for "Test Run", maybe we don't need strict auditing for test runs, or we do.
 	// User didn't specify.
 
-	return e.ExecuteSQL(ctx, connectionID, queryDetails.SQLText, params, queryDetails.ID)
+	now := time.Now()
+	if err := checkSunset(queryDetails, now); err != nil {
+		return nil, err
+	}
+	shape, err := ParseShapeConfig(queryDetails.ShapeConfig)
+	if err != nil {
+		return nil, err
+	}
+	response, err := ParseResponseConfig(queryDetails.ResponseConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = e.ExecuteSQL(withQueryTag(ctx, querySlug), connectionID, queryDetails.SQLText, params, queryDetails.ID)
+	if err != nil {
+		return nil, err
+	}
+	if queryDetails.Lifecycle(now) == core.LifecycleDeprecated || e.aliasDeprecated(queryDetails, querySlug) {
+		result.Warnings = append(result.Warnings, WarningDeprecated)
+	}
+	if e.checkSchemaDrift(queryDetails, result) {
+		result.Warnings = append(result.Warnings, WarningSchemaDrift)
+	}
+	result.ResultMode = core.NormalizeResultMode(queryDetails.ResultMode)
+	result.Shape = shape
+	result.XMLRoot = queryDetails.XMLRoot
+	result.Response = response
+	return result, nil
 }
 
 func (e *QueryExecutor) ExecuteByName(ctx context.Context, connName string, querySlug string, params map[string]interface{}) (result *ExecutionResult, err error) {
@@ -82,66 +180,128 @@ func (e *QueryExecutor) ExecuteByName(ctx context.Context, connName string, quer
 	return e.Execute(ctx, conn.ID, querySlug, params)
 }
 
+// IsWriteQuery reports whether the saved query querySlug changes data or
+// calls a procedure, see core.IsWriteSQL
+func (e *QueryExecutor) IsWriteQuery(querySlug string) (bool, error) {
+	q, err := e.queryRepo.GetBySlug(querySlug)
+	if err != nil {
+		return false, fmt.Errorf("query not found: %w", err)
+	}
+	return core.IsWriteSQL(q.SQLText), nil
+}
+
+// ParamsConfig returns the parsed params_config of the saved query
+// querySlug, nil when it has none
+func (e *QueryExecutor) ParamsConfig(querySlug string) (map[string]ParamConfig, error) {
+	q, err := e.queryRepo.GetBySlug(querySlug)
+	if err != nil {
+		return nil, fmt.Errorf("query not found: %w", err)
+	}
+	return ParseParamsConfig(q.ParamsConfig)
+}
+
+// EnvironmentError is an environment route that does not resolve to exactly
+// one connection of the query
+type EnvironmentError struct {
+	Environment string
+	Query       string
+	Matches     []string // names of the matching connections, empty when none
+}
+
+func (e *EnvironmentError) Error() string {
+	if len(e.Matches) == 0 {
+		return fmt.Sprintf("query %s has no active connection in environment %s", e.Query, e.Environment)
+	}
+	return fmt.Sprintf("query %s has %d connections in environment %s (%s); label only one", e.Query, len(e.Matches), e.Environment, strings.Join(e.Matches, ", "))
+}
+
+// ResolveEnvironment returns the name of the one active connection labelled
+// environment among those querySlug may run on
+func (e *QueryExecutor) ResolveEnvironment(environment, querySlug string) (string, error) {
+	q, err := e.queryRepo.GetBySlug(querySlug)
+	if err != nil {
+		return "", fmt.Errorf("query not found: %w", err)
+	}
+	environment = core.Slugify(environment)
+	var matches []string
+	for _, id := range q.AllowedConnectionIDs {
+		conn, err := e.connRepo.GetByID(id)
+		if err == nil && conn.IsActive && conn.Environment != "" && conn.Environment == environment {
+			matches = append(matches, conn.Name)
+		}
+	}
+	if len(matches) != 1 {
+		return "", &EnvironmentError{Environment: environment, Query: q.Slug, Matches: matches}
+	}
+	return matches[0], nil
+}
+
 // ExecuteSQL executes a raw SQL string against a connection
 func (e *QueryExecutor) ExecuteSQL(ctx context.Context, connectionID int64, sqlText string, params map[string]interface{}, queryID int64) (result *ExecutionResult, err error) {
 	startTime := time.Now()
 
-	// Defer Audit Logging
-
 	// Defer Audit Logging (Audit logs might be useful even for ad-hoc queries, usually QueryID=0)
+	auditParams := params
+	var warning string
+	var detail *core.ExecutionDetail // set for queries with debug capture
+	mode, sample := "", sampleRows(ctx)
+	if sample > 0 {
+		mode = "sample"
+	}
 	defer func() {
-		duration := time.Since(startTime).Milliseconds()
-		status := "SUCCESS"
-		errMsg := ""
-		if err != nil {
-			status = "ERROR"
-			errMsg = err.Error()
-		}
+		e.recordAudit(ctx, startTime, connectionID, queryID, auditParams, mode, err, warning, detail)
+	}()
 
-		// TODO: UserID from context
-		var userID int64 = 0
-		var apiKeyID *int64 = nil
+	params, auditParams, err = e.bindKeyParams(ctx, sqlText, params)
+	if err != nil {
+		return nil, err
+	}
 
-		if val := ctx.Value(core.ContextKeyApiKeyID); val != nil {
-			if id, ok := val.(int64); ok {
-				apiKeyID = &id
-			}
-		}
+	if err := e.checkWindow(ctx, queryID); err != nil {
+		return nil, err
+	}
+	guard := guardrailsFrom(ctx)
+	if guard != nil && !guard.AllowWrite && core.IsWriteSQL(sqlText) {
+		return nil, ErrProtectedWrite
+	}
 
-		// Serialize Params
-		var paramsJSON string
-		if len(params) > 0 {
-			if b, err := json.Marshal(params); err == nil {
-				paramsJSON = string(b)
-			}
-		}
+	// 1. Get Connection Details & decrypt connection string
+	connDetails, decryptedConnStr, dialect, err := e.loadConnection(ctx, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	var forcedOverride bool
+	params, auditParams, forcedOverride, err = e.applyConnectionParams(connDetails, sqlText, params, auditParams)
+	if err != nil {
+		return nil, err
+	}
 
-		e.auditRepo.Create(&core.AuditLog{
-			Timestamp:    startTime,
-			UserID:       userID,
-			ApiKeyID:     apiKeyID,
-			ConnectionID: connectionID,
-			QueryID:      queryID, // Use passed QueryID
-			DurationMs:   duration,
-			Status:       status,
-			ErrorMessage: errMsg,
-			Params:       paramsJSON,
-		})
+	// A cancelled execution returns no partial result
+	runCtx, finish := e.trackExecution(ctx, connDetails, queryID, mode)
+	defer func() {
+		finish(&err)
+		if err != nil {
+			result = nil
+		}
 	}()
 
-	// 1. Get Connection Details
-	connDetails, err := e.connRepo.GetByID(connectionID)
-	if err != nil {
-		return nil, fmt.Errorf("connection not found: %w", err)
-	}
-	if !connDetails.IsActive {
-		return nil, fmt.Errorf("connection is inactive")
+	// Comments are cut out while the SQL is processed, so that {...} tags and
+	// ORDER BY inside them are left alone
+	sqlText, restoreComments := cutComments(connDetails, sqlText)
+
+	// A sample of a paginated query is its first page, whatever the caller asked for
+	paginated := rePaginationTag.MatchString(sqlText)
+	if sample > 0 && paginated {
+		params = samplePage(params, sample)
 	}
 
-	// 2. Decrypt Password/Connection String
-	decryptedConnStr, err := e.cryptoSvc.Decrypt(connDetails.ConnectionStringEnc)
+	// Identifier parameters are substituted first, as they are no bound values
+	sqlText, err = e.parser.BindIdentifiers(sqlText, params, dialect)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt connection string: %w", err)
+		return nil, err
+	}
+	if err := e.checkSchemas(connDetails, sqlText, queryID); err != nil {
+		return nil, err
 	}
 
 	// STEP 1: Parse original SQL to extract paramNames and defaults
@@ -160,10 +320,13 @@ func (e *QueryExecutor) ExecuteSQL(ctx context.Context, connectionID int64, sqlT
 
 	// Generate Main & Count from this base (before pagination)
 	countSelectBlock := e.processSelectBlock(countQueryBase)
-	countSQL := countSelectBlock.CountSQL
+	countSQL := restoreComments(countSelectBlock.CountSQL)
 
 	// STEP 4: Process pagination & order_by on formatted query for MAIN query
-	formattedSQL, page, limit := e.processSystemVariables(formattedSQL, connDetails.Driver, params, decryptedConnStr)
+	formattedSQL, page, limit, err := e.processSystemVariables(formattedSQL, dialect, params)
+	if err != nil {
+		return nil, err
+	}
 	formattedSQL = e.processOrderBy(formattedSQL, params)
 
 	// Generate Main SQL from the paginated version
@@ -173,38 +336,53 @@ func (e *QueryExecutor) ExecuteSQL(ctx context.Context, connectionID int64, sqlT
 
 	// STEP 5: Generate exec SQL - replace remaining {param} with ? in the final SQL
 	// Use selectBlock.SQLWithout which has actual column names, not {select}...{endselect}
-	execSQL := e.formatSQL(selectBlock.SQLWithout)
+	execSQL := dialect.RewritePlaceholders(restoreComments(e.formatSQL(selectBlock.SQLWithout)))
+	if sample > 0 && !paginated {
+		if execSQL, err = buildSampleSQL(execSQL, dialect, sample); err != nil {
+			return nil, err
+		}
+	}
 
 	// STEP 6: Build Parameter List using the paramNames and defaults from STEP 1
 	var args []interface{}
-	args, err = e.parser.MapValues(parseResult.ParamNames, params, parseResult.Defaults, parseResult.RawDefaults)
+	args, err = e.parser.MapValues(parseResult.ParamNames, parseResult.BindLikeValues(params, dialect), parseResult.Defaults, parseResult.RawDefaults)
 	if err != nil {
 		return nil, err
 	}
+	args = bindArgs(connDetails, args)
+	if capture, values := e.debugCapture(queryID); capture {
+		detail = newExecutionDetail(execSQL, args, values)
+	}
 
 	// 7. Connect to DB
-	// TODO: Connection pooling
-	db, err := sql.Open(connDetails.Driver, decryptedConnStr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database connection (%s): %w", connDetails.Driver, err)
+	stream := rowStreamFrom(ctx)
+	timeout := e.queryTimeout()
+	if stream != nil {
+		timeout = stream.timeout
 	}
-	defer db.Close()
-
-	// Check connection
-	ctxTimeout, cancel := context.WithTimeout(ctx, 30*time.Second)
+	if guard != nil && guard.Timeout < timeout {
+		timeout = guard.Timeout
+	}
+	ctxTimeout, cancel := context.WithTimeout(runCtx, timeout)
 	defer cancel()
 
-	if err := db.PingContext(ctxTimeout); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	db, err := e.connect(e.withSessionTag(ctxTimeout, queryID), connDetails, decryptedConnStr, dialect)
+	if err != nil {
+		return nil, translateDBError(ctxTimeout, dialect, err, err)
 	}
+	defer e.release(db)
 
 	// 8. Execute Query
 	// Special handling for Sybase/SQL Anywhere: batch with params not supported
-	isSybaseBatch := strings.Contains(strings.ToLower(connDetails.Driver), "sql anywhere") ||
-		strings.Contains(strings.ToLower(connDetails.Driver), "sybase")
+	isSybaseBatch := dialect.Name() == "sqlanywhere"
 	hasParams := len(args) > 0
 	isBatch := strings.Contains(strings.ToLower(execSQL), "begin")
 
+	// Injected, see SetChaos
+	if err := e.chaos.query(connDetails.ID); err != nil {
+		return nil, fmt.Errorf("execution error: %w", err)
+	}
+
 	// For Sybase batch with params, try to execute differently
 	var rows *sql.Rows
 	if isSybaseBatch && hasParams && isBatch {
@@ -216,6 +394,9 @@ func (e *QueryExecutor) ExecuteSQL(ctx context.Context, connectionID int64, sqlT
 
 		logger.Info.Printf("[DEBUG] Sybase batch with params - trying without batch wrapper")
 		logger.Info.Printf("[DEBUG] Single SQL: %s", singleSQL)
+		if detail != nil {
+			detail.SQL = singleSQL
+		}
 
 		rows, err = db.QueryContext(ctxTimeout, singleSQL, args...)
 	} else {
@@ -224,10 +405,11 @@ func (e *QueryExecutor) ExecuteSQL(ctx context.Context, connectionID int64, sqlT
 
 	if err != nil {
 		errMsg := fmt.Sprintf("execution error: %v\nDEBUG params: %v", err, params)
+		errMsg += bindHint(connDetails, args)
 		if os.Getenv("DEBUG") == "true" {
 			errMsg = fmt.Sprintf("%s\n\nSQL: %s\nArgs: %v", errMsg, execSQL, args)
 		}
-		return nil, fmt.Errorf("%s", errMsg)
+		return nil, translateDBError(ctxTimeout, dialect, err, fmt.Errorf("%s", errMsg))
 	}
 	defer rows.Close()
 
@@ -237,9 +419,44 @@ func (e *QueryExecutor) ExecuteSQL(ctx context.Context, connectionID int64, sqlT
 		return nil, err
 	}
 
+	keys, dupColumns := dedupeColumns(columns)
+
+	dbTypes := make([]string, len(columns))
+	columnTypes := make([]ResponseColumn, len(columns))
+	colTypes, _ := rows.ColumnTypes()
+	for i, key := range keys {
+		var ct *sql.ColumnType
+		if i < len(colTypes) {
+			ct = colTypes[i]
+			dbTypes[i] = ct.DatabaseTypeName()
+		}
+		columnTypes[i] = responseColumn(key, ct)
+	}
+
 	resultRows := []map[string]interface{}{}
+	rowCount := 0
+	maxRows := e.maxRows()
+	if sample > 0 {
+		// Dialects without a row-limiting construct are capped here
+		maxRows = sample
+	}
+	if guard != nil && (maxRows == 0 || guard.MaxRows < maxRows) {
+		maxRows = guard.MaxRows
+	}
+	truncated := false
+	if stream != nil {
+		maxRows = 0
+		if err := stream.w.WriteHeader(columns, keys); err != nil {
+			return nil, err
+		}
+	}
 
 	for rows.Next() {
+		if maxRows > 0 && rowCount >= maxRows {
+			truncated = true
+			break
+		}
+
 		// Generic row scanning
 		values := make([]interface{}, len(columns))
 		valuePtrs := make([]interface{}, len(columns))
@@ -252,28 +469,37 @@ func (e *QueryExecutor) ExecuteSQL(ctx context.Context, connectionID int64, sqlT
 		}
 
 		rowMap := make(map[string]interface{})
-		for i, col := range columns {
-			val := values[i]
-
-			// Handle []byte
-			if b, ok := val.([]byte); ok {
-				rowMap[col] = string(b)
-			} else {
-				rowMap[col] = val
+		for i, key := range keys {
+			rowMap[key] = normalizeValue(values[i], dbTypes[i])
+		}
+		rowCount++
+		if stream != nil {
+			if err := stream.w.WriteRow(rowMap); err != nil {
+				return nil, err
 			}
+			continue
 		}
 		resultRows = append(resultRows, rowMap)
 	}
+	// A stream cut short must not pass for a complete one
+	if err := rows.Err(); err != nil && stream != nil {
+		return nil, translateDBError(ctxTimeout, dialect, err, err)
+	}
 
 	// 10. Build metadata (only columns if no select block)
 	meta := MetaInfo{
-		Columns: columns,
+		Columns:   columns,
+		Truncated: truncated,
+	}
+	if dupColumns {
+		meta.Keys = keys
 	}
 
 	// 12. Execute COUNT query if {select}{endselect} block exists
 	var execError string
 
-	if selectBlock.HasBlock && selectBlock.Error == "" {
+	// A sample skips the count, which would scan the whole result
+	if selectBlock.HasBlock && selectBlock.Error == "" && sample == 0 {
 		countSQL := selectBlock.CountSQL
 
 		var total int64 = 0
@@ -285,7 +511,7 @@ func (e *QueryExecutor) ExecuteSQL(ctx context.Context, connectionID int64, sqlT
 				countArgs = args
 			}
 
-			countRows, err := db.QueryContext(ctxTimeout, countSQL, countArgs...)
+			countRows, err := db.QueryContext(ctxTimeout, dialect.RewritePlaceholders(countSQL), countArgs...)
 			if err != nil {
 				countErr = err
 			} else {
@@ -355,9 +581,392 @@ func (e *QueryExecutor) ExecuteSQL(ctx context.Context, connectionID int64, sqlT
 		}
 	}
 
+	execResult.ColumnTypes = columnTypes
+
+	// Over a soft limit the result is still returned, flagged
+	execResult.Warnings, warning = e.softLimits(queryID).Check(time.Since(startTime), rowCount)
+	if dupColumns {
+		execResult.Warnings = append([]string{WarningDuplicateColumns}, execResult.Warnings...)
+	}
+	if forcedOverride {
+		execResult.Warnings = append(execResult.Warnings, WarningForcedParams)
+	}
+
 	return execResult, nil
 }
 
+// recordAudit writes the audit entry for one execution. mode is "" for a full
+// run, "count" for count-only runs and "sample" for sample runs (replays,
+// embed token hits and health queries are marked from ctx); a successful execution with a warning
+// is audited as WARN. detail, if not nil, is saved once the entry has an id.
+// An executor without an audit repository audits nothing.
+func (e *QueryExecutor) recordAudit(ctx context.Context, startTime time.Time, connectionID, queryID int64, params map[string]interface{}, mode string, err error, warning string, detail *core.ExecutionDetail) {
+	if ctx.Value(skipAuditKey{}) != nil || (e.auditRepo == nil && e.audit == nil) {
+		return
+	}
+	duration := time.Since(startTime).Milliseconds()
+	status := "SUCCESS"
+	errMsg := ""
+	var secretErr *SecretError
+	var windowErr *WindowError
+	if errors.Is(err, ErrExecutionCancelled) {
+		status = CancelledStatus
+		errMsg = err.Error()
+	} else if errors.As(err, &secretErr) {
+		status = "SECRET_ERROR"
+		errMsg = err.Error()
+	} else if errors.As(err, &windowErr) {
+		status = WindowStatus
+		errMsg = err.Error()
+	} else if err != nil {
+		// Admins see the driver's own error, not its translation
+		status = "ERROR"
+		errMsg = ErrorDetail(err)
+	} else if warning != "" {
+		status = WarnStatus
+		errMsg = warning
+	}
+
+	userID, _ := ctx.Value(core.ContextKeyUserID).(int64)
+	var apiKeyID *int64 = nil
+
+	if val := ctx.Value(core.ContextKeyApiKeyID); val != nil {
+		if id, ok := val.(int64); ok {
+			apiKeyID = &id
+		}
+	}
+
+	clientIP, _ := ctx.Value(core.ContextKeyClientIP).(string)
+
+	// Serialize Params
+	var paramsJSON string
+	if len(params) > 0 {
+		if b, err := json.Marshal(params); err == nil {
+			paramsJSON = string(b)
+		}
+	}
+
+	entry := &core.AuditLog{
+		Timestamp:    startTime,
+		UserID:       userID,
+		ApiKeyID:     apiKeyID,
+		ConnectionID: connectionID,
+		QueryID:      queryID,
+		DurationMs:   duration,
+		Status:       status,
+		ErrorMessage: errMsg,
+		Params:       paramsJSON,
+		ClientIP:     clientIP,
+		Mode:         mode,
+	}
+	if id, ok := ctx.Value(replayKey{}).(int64); ok {
+		entry.Mode, entry.Target = "replay", fmt.Sprintf("replay of #%d", id)
+	}
+	if id, ok := ctx.Value(embedKey{}).(int64); ok {
+		entry.Mode, entry.Target = "embed", fmt.Sprintf("embed token #%d", id)
+	}
+	if ctx.Value(healthCheckKey{}) != nil {
+		entry.Mode, entry.Target = "healthcheck", "health query"
+	}
+	var written func(id int64)
+	if detail != nil {
+		written = func(id int64) { e.saveDetail(id, detail) }
+	}
+	e.writeAudit(entry, written)
+}
+
+// writeAudit hands entry to the audit writer, or writes it right away
+// without one. written, if not nil, gets the id of the stored entry.
+func (e *QueryExecutor) writeAudit(entry *core.AuditLog, written func(id int64)) {
+	if e.audit != nil {
+		e.audit.Write(entry, written)
+		return
+	}
+	if err := e.auditRepo.Create(entry); err != nil {
+		logger.Error.Printf("Failed to write audit entry: %v", err)
+		return
+	}
+	if written != nil {
+		written(entry.ID)
+	}
+}
+
+// loadConnection fetches an active connection, resolves its dialect and returns
+// the DSN to open it with
+func (e *QueryExecutor) loadConnection(ctx context.Context, connectionID int64) (*core.DBConnection, string, core.Dialect, error) {
+	connDetails, err := e.connRepo.GetByID(connectionID)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("connection not found: %w", err)
+	}
+	if !connDetails.IsActive {
+		return nil, "", nil, fmt.Errorf("connection is inactive")
+	}
+	if scopes, ok := ctx.Value(core.ContextKeyApiKeyScopes).([]core.KeyScope); ok && !core.ScopesAllow(scopes, connDetails) {
+		return nil, "", nil, &core.KeyScopeError{Connection: connDetails.Name}
+	}
+	if err := e.drivers.CheckRun(connDetails.Driver); err != nil {
+		return nil, "", nil, fmt.Errorf("connection %s: %w", connDetails.Name, err)
+	}
+	if e.attachedDB(connectionID) != nil {
+		dialect, err := core.DialectFor(connDetails.Dialect, connDetails.Driver, "")
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("connection %s: %w", connDetails.Name, err)
+		}
+		return connDetails, "", dialect, nil
+	}
+
+	decryptedConnStr, err := e.cryptoSvc.Decrypt(connDetails.ConnectionStringEnc)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to decrypt connection string: %w", err)
+	}
+	decryptedConnStr, err = ExpandConnectionVars(decryptedConnStr)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("connection %s: %w", connDetails.Name, err)
+	}
+	decryptedConnStr, err = e.secrets.Resolve(ctx, decryptedConnStr)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("connection %s: %w", connDetails.Name, err)
+	}
+
+	dialect, err := core.DialectFor(connDetails.Dialect, connDetails.Driver, decryptedConnStr)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("connection %s: %w", connDetails.Name, err)
+	}
+
+	creds, err := e.loadCredentials(connDetails)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	dsn, err := ConnectionDSN(connDetails.Driver, decryptedConnStr, creds, connDetails.InitOptions)
+	if err == nil && IsSQLiteDriver(connDetails.Driver) {
+		dsn, err = e.sqlite.Apply(dsn)
+	}
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("connection %s: %w", connDetails.Name, err)
+	}
+	return connDetails, dsn, dialect, nil
+}
+
+// CheckConnection opens and pings a connection like an execution would, for
+// the health monitor
+func (e *QueryExecutor) CheckConnection(ctx context.Context, connectionID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, e.queryTimeout())
+	defer cancel()
+	conn, dsn, dialect, err := e.loadConnection(ctx, connectionID)
+	if err != nil {
+		return err
+	}
+	db, err := e.connect(ctx, conn, dsn, dialect)
+	if err != nil {
+		return err
+	}
+	e.release(db)
+	return nil
+}
+
+// connect opens a loaded connection, to be closed with release. Vault
+// secrets may have been rotated since they were cached, so when opening fails
+// with secrets that came from Vault they are fetched afresh and the open is
+// retried once.
+func (e *QueryExecutor) connect(ctx context.Context, conn *core.DBConnection, dsn string, dialect core.Dialect) (*sql.DB, error) {
+	if err := e.chaos.acquire(ctx, conn); err != nil {
+		return nil, err
+	}
+	if db := e.attachedDB(conn.ID); db != nil {
+		return db, nil
+	}
+	db, err := openDB(ctx, conn, dsn, dialect)
+	if err == nil || e.secrets == nil {
+		return db, err
+	}
+	if raw, decErr := e.cryptoSvc.Decrypt(conn.ConnectionStringEnc); decErr != nil || !HasSecretRefs(raw) {
+		return nil, err
+	}
+
+	logger.Info.Printf("Connection %s failed with cached Vault secrets, fetching them again: %v", conn.Name, err)
+	_, freshDSN, _, loadErr := e.loadConnection(withFreshSecrets(ctx), conn.ID)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	return openDB(ctx, conn, freshDSN, dialect)
+}
+
+// loadCredentials decrypts a connection's credentials, nil when it has none
+func (e *QueryExecutor) loadCredentials(conn *core.DBConnection) (*core.ConnectionCredentials, error) {
+	if conn.CredentialsEnc == "" {
+		return nil, nil
+	}
+	plain, err := e.cryptoSvc.Decrypt(conn.CredentialsEnc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt connection credentials: %w", err)
+	}
+	var creds core.ConnectionCredentials
+	if err := json.Unmarshal([]byte(plain), &creds); err != nil {
+		return nil, fmt.Errorf("invalid connection credentials: %w", err)
+	}
+	return &creds, nil
+}
+
+// normalizeValue turns a scanned value into what the JSON output should carry.
+// Bytes become text. Oracle NUMBER arrives as a decimal string from go-ora and
+// is kept exact as a JSON number. DATE and TIMESTAMP already scan to time.Time
+// in the server's time zone, as does SQL Server DATETIMEOFFSET with its own
+// offset.
+func normalizeValue(val interface{}, dbType string) interface{} {
+	switch v := val.(type) {
+	case []byte:
+		if dbType == "UNIQUEIDENTIFIER" && len(v) == 16 {
+			return formatMSSQLGUID(v)
+		}
+		return string(v)
+	case string:
+		if dbType == "NUMBER" {
+			// json.Valid rejects forms like ".5" that JSON numbers cannot take
+			if _, err := strconv.ParseFloat(v, 64); err == nil && json.Valid([]byte(v)) {
+				return json.Number(v)
+			}
+		}
+	}
+	return val
+}
+
+// formatMSSQLGUID formats the raw bytes go-mssqldb returns for a
+// UNIQUEIDENTIFIER; SQL Server stores the first three groups little-endian
+func formatMSSQLGUID(b []byte) string {
+	return fmt.Sprintf("%X-%X-%X-%X-%X",
+		[]byte{b[3], b[2], b[1], b[0]}, []byte{b[5], b[4]}, []byte{b[7], b[6]}, b[8:10], b[10:])
+}
+
+// openDB opens and, unless the connection skips it, pings a connection. The
+// caller must Close it.
+func openDB(ctx context.Context, conn *core.DBConnection, dsn string, dialect core.Dialect) (*sql.DB, error) {
+	// TODO: Connection pooling
+	dsn, setup := tagSession(ctx, dsn, dialect)
+	db, err := openWithSetup(conn.Driver, dsn, setup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database connection (%s): %w", conn.Driver, err)
+	}
+	if conn.SkipPing {
+		return db, nil
+	}
+	if err := PingDB(ctx, db, conn.PingQuery, dialect); err != nil {
+		db.Close()
+		if conn.PingQuery == "" && conn.Driver == "odbc" {
+			return nil, fmt.Errorf("failed to ping database: %w (some ODBC drivers cannot ping: set a ping statement such as SELECT 1 FROM dummy, or turn the ping off, in the connection's advanced settings)", err)
+		}
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return db, nil
+}
+
+// PingDB checks db with pingQuery when set, else the dialect's ping query, else
+// the driver's Ping
+func PingDB(ctx context.Context, db *sql.DB, pingQuery string, dialect core.Dialect) error {
+	if pingQuery == "" {
+		if p, ok := dialect.(core.PingQuerier); ok {
+			pingQuery = p.PingQuery()
+		}
+	}
+	if pingQuery != "" {
+		rows, err := db.QueryContext(ctx, pingQuery)
+		if err != nil {
+			return err
+		}
+		return rows.Close()
+	}
+	return db.PingContext(ctx)
+}
+
+// bindArgs applies the connection's binding mode to query arguments
+func bindArgs(conn *core.DBConnection, args []interface{}) []interface{} {
+	if conn.BindMode != core.BindModeString {
+		return args
+	}
+	bound := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			bound[i] = nil
+		case string:
+			bound[i] = v
+		case []byte:
+			bound[i] = string(v)
+		case bool:
+			if v {
+				bound[i] = "1"
+			} else {
+				bound[i] = "0"
+			}
+		case time.Time:
+			bound[i] = v.Format("2006-01-02 15:04:05.999999999")
+		default:
+			bound[i] = fmt.Sprint(v)
+		}
+	}
+	return bound
+}
+
+// cutComments cuts the comments out of sqlText for processing. The returned
+// func puts them back into the processed SQL, or drops them for connections
+// that strip comments.
+func cutComments(conn *core.DBConnection, sqlText string) (string, func(string) string) {
+	cut, comments := core.CutComments(sqlText)
+	if conn.StripComments {
+		return cut, comments.Strip
+	}
+	return cut, comments.Restore
+}
+
+// bindKeyParams sets the {_key.*} parameters of sqlText from the calling API
+// key's attributes. Request values for _key.* names are dropped, never used.
+// audited is bound as recorded in the audit log, with the values of sensitive
+// attributes redacted.
+func (e *QueryExecutor) bindKeyParams(ctx context.Context, sqlText string, params map[string]interface{}) (bound, audited map[string]interface{}, err error) {
+	names := e.parser.KeyParams(sqlText)
+	dropped := false
+	for name := range params {
+		dropped = dropped || strings.HasPrefix(name, core.KeyParamPrefix)
+	}
+	if len(names) == 0 && !dropped {
+		return params, params, nil
+	}
+
+	bound = make(map[string]interface{}, len(params)+len(names))
+	audited = make(map[string]interface{}, len(params)+len(names))
+	for name, v := range params {
+		if !strings.HasPrefix(name, core.KeyParamPrefix) {
+			bound[name], audited[name] = v, v
+		}
+	}
+	attrs, isKeyCall := ctx.Value(core.ContextKeyApiKeyAttributes).([]core.KeyAttribute)
+	for _, name := range names {
+		var attr *core.KeyAttribute
+		for i := range attrs {
+			if attrs[i].Name == name {
+				attr = &attrs[i]
+			}
+		}
+		if attr == nil {
+			return params, params, &core.KeyAttributeError{Attribute: name, NoKey: !isKeyCall}
+		}
+		bound[core.KeyParamPrefix+name] = attr.Value
+		audited[core.KeyParamPrefix+name] = attr.Value
+		if attr.Sensitive {
+			audited[core.KeyParamPrefix+name] = "********"
+		}
+	}
+	return bound, audited, nil
+}
+
+// bindHint suggests the string binding mode when a query with parameters
+// fails on a driver known to be picky about parameter types
+func bindHint(conn *core.DBConnection, args []interface{}) string {
+	if conn.Driver != "odbc" || conn.BindMode == core.BindModeString || len(args) == 0 {
+		return ""
+	}
+	return "\nHint: if the ODBC driver rejects parameter types, set the connection's parameter binding to \"strings\" in its advanced settings"
+}
+
 // Helper to use the existing parser but returning the struct we need
 func (e *QueryExecutor) parseSQL(sqlText string, params map[string]interface{}) *core.ParseResult {
 	// Re-using the logic from param_parser.go
@@ -544,7 +1153,10 @@ func (e *QueryExecutor) processOrderBy(sqlText string, params map[string]interfa
 	return finalSQL
 }
 
-func (e *QueryExecutor) processSystemVariables(sqlText string, driver string, params map[string]interface{}, connStr string) (string, int, int) {
+// reOrderByBefore finds an ORDER BY clause or {order_by} tag ahead of {pagination}
+var reOrderByBefore = regexp.MustCompile(`(?i)\border\s+by\b|\{\s*order_by\s*:`)
+
+func (e *QueryExecutor) processSystemVariables(sqlText string, dialect core.Dialect, params map[string]interface{}) (string, int, int, error) {
 	// Regex to match {pagination}, {pagination:1:20}, {pagination::20}, {pagination:2:}
 	// Case insensitive due to (?i)
 	re := regexp.MustCompile(`(?i)\{\s*pagination(?::\s*(\d*)\s*:\s*(\d*)\s*)?\}`)
@@ -552,7 +1164,7 @@ func (e *QueryExecutor) processSystemVariables(sqlText string, driver string, pa
 	// FindStringIndex returns the first match's indices
 	loc := re.FindStringIndex(sqlText)
 	if loc == nil {
-		return sqlText, 1, 50
+		return sqlText, 1, 50, nil
 	}
 
 	// Default pagination values (Global Default: 1:50)
@@ -608,33 +1220,20 @@ func (e *QueryExecutor) processSystemVariables(sqlText string, driver string, pa
 	}
 
 	offset := (page - 1) * limit
-	replacement := ""
-
-	switch driver {
-	case "sqlite", "postgres":
-		replacement = fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
-	case "mysql":
-		replacement = fmt.Sprintf("LIMIT %d, %d", offset, limit)
-	case "odbc", "mssql":
-		// Detect if it is Sybase / SQL Anywhere based on Connection String
-		// SQL Anywhere drivers usually contain "SQL Anywhere" or "ASA"
-		isSybase := strings.Contains(strings.ToLower(connStr), "sql anywhere") ||
-			strings.Contains(strings.ToLower(connStr), "asa")
-
-		if isSybase {
-			replacement = fmt.Sprintf("TOP %d START AT %d", limit, offset+1)
-		} else {
-			// Default to LIMIT OFFSET for other ODBC (Postgres, MySQL, etc.)
-			// Assuming most modern SQL/ODBC drivers support LIMIT/OFFSET or similar enough
-			// If not, we might need more specific detection
-			replacement = fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
-		}
-	default:
-		replacement = fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+	replacement := dialect.PaginationClause(limit, offset)
+	// SQL Server only accepts OFFSET/FETCH after an ORDER BY; order by nothing
+	// in particular rather than fail when the query has none
+	if dialect.Name() == "mssql" && !reOrderByBefore.MatchString(sqlText[:loc[0]]) {
+		replacement = "ORDER BY (SELECT NULL) " + replacement
 	}
 
+	// Some dialects only accept the clause at a set place, wherever the tag is
+	if placer, ok := dialect.(core.PaginationPlacer); ok {
+		finalSQL, err := placer.PlacePagination(sqlText, loc[0], loc[1], replacement)
+		return finalSQL, page, limit, err
+	}
 	// Replace only the first occurrence or all? User likely uses one pagination.
 	// Provide full replacement of the matched tag.
 	finalSQL := strings.Replace(sqlText, match[0], replacement, 1)
-	return finalSQL, page, limit
+	return finalSQL, page, limit, nil
 }
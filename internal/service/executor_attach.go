@@ -0,0 +1,44 @@
+package service
+
+import (
+	"database/sql"
+)
+
+// AttachDB makes executions on connectionID run on db instead of opening the
+// connection's connection string. The executor does not close db: its owner
+// does, after DetachDB. Session tags and pings do not apply to it.
+func (e *QueryExecutor) AttachDB(connectionID int64, db *sql.DB) {
+	e.attachedMu.Lock()
+	defer e.attachedMu.Unlock()
+	if e.attached == nil {
+		e.attached = make(map[int64]*sql.DB)
+	}
+	e.attached[connectionID] = db
+}
+
+// DetachDB undoes AttachDB
+func (e *QueryExecutor) DetachDB(connectionID int64) {
+	e.attachedMu.Lock()
+	defer e.attachedMu.Unlock()
+	delete(e.attached, connectionID)
+}
+
+// attachedDB returns the database attached to connectionID, nil for none
+func (e *QueryExecutor) attachedDB(connectionID int64) *sql.DB {
+	e.attachedMu.RLock()
+	defer e.attachedMu.RUnlock()
+	return e.attached[connectionID]
+}
+
+// release closes a database returned by connect unless it is attached
+func (e *QueryExecutor) release(db *sql.DB) {
+	e.attachedMu.RLock()
+	for _, a := range e.attached {
+		if a == db {
+			e.attachedMu.RUnlock()
+			return
+		}
+	}
+	e.attachedMu.RUnlock()
+	db.Close()
+}
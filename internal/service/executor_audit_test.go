@@ -0,0 +1,28 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"testing"
+	"time"
+)
+
+func TestRecordAuditPrincipal(t *testing.T) {
+	repo := &memAuditRepo{cursors: map[string]int64{}}
+	e := &QueryExecutor{auditRepo: repo}
+
+	ctx := context.WithValue(context.Background(), core.ContextKeyUserID, int64(4))
+	ctx = context.WithValue(ctx, core.ContextKeyApiKeyID, int64(9))
+	e.recordAudit(ctx, time.Now(), 1, 2, nil, "", nil, "", nil)
+	e.recordAudit(context.Background(), time.Now(), 1, 2, nil, "", nil, "", nil)
+
+	if len(repo.logs) != 2 {
+		t.Fatalf("recorded %d entries, want 2", len(repo.logs))
+	}
+	if got := repo.logs[0]; got.UserID != 4 || got.ApiKeyID == nil || *got.ApiKeyID != 9 {
+		t.Errorf("entry with principal = %+v", got)
+	}
+	if got := repo.logs[1]; got.UserID != 0 || got.ApiKeyID != nil {
+		t.Errorf("anonymous entry = %+v", got)
+	}
+}
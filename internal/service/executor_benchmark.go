@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBenchmarkIterations = 20
+	maxBenchmarkIterations     = 500
+	maxBenchmarkConcurrency    = 8
+
+	// benchmarkSlots caps the benchmark executions in flight across all
+	// benchmarks, so several admins benchmarking at once can't take over the
+	// databases' connections from API traffic
+	benchmarkSlots = 8
+)
+
+var benchmarkGuard = make(chan struct{}, benchmarkSlots)
+
+// BenchmarkOptions describes a benchmark of one saved query on one connection
+type BenchmarkOptions struct {
+	ConnectionID      int64
+	Params            map[string]interface{}
+	Iterations        int  // executions, defaultBenchmarkIterations when 0
+	Concurrency       int  // executions running at once, 1 when 0
+	ConfirmProduction bool // required for connections marked production
+}
+
+// BenchmarkResult summarizes the executions of a benchmark. Durations are in
+// milliseconds over the successful executions; the median and p95 are
+// nearest-rank.
+type BenchmarkResult struct {
+	Iterations  int     `json:"iterations"`
+	Concurrency int     `json:"concurrency"`
+	Errors      int     `json:"errors"`
+	FirstError  string  `json:"first_error,omitempty"`
+	MinMs       float64 `json:"min_ms"`
+	MedianMs    float64 `json:"median_ms"`
+	P95Ms       float64 `json:"p95_ms"`
+	MaxMs       float64 `json:"max_ms"`
+	RowsPerRun  int     `json:"rows_per_run"`          // rows returned by the first successful execution
+	RowsVary    bool    `json:"rows_vary,omitempty"`   // executions returned different row counts
+	DurationMs  int64   `json:"duration_ms"`           // wall time of the whole benchmark
+	Interrupted bool    `json:"interrupted,omitempty"` // cancelled before all iterations ran
+}
+
+type skipAuditKey struct{}
+
+// withoutAudit makes executions under ctx skip their audit entry, for callers
+// that record a summary instead
+func withoutAudit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipAuditKey{}, true)
+}
+
+// BenchmarkQuery runs a saved query opts.Iterations times on one connection
+// through ExecuteSQL, opts.Concurrency at a time, and reports the latency
+// spread. Iterations and concurrency are capped, and every execution also
+// waits for one of the benchmarkSlots shared by all benchmarks. The
+// executions are not audited one by one; a single BENCHMARK entry for userID
+// records the summary.
+func (e *QueryExecutor) BenchmarkQuery(ctx context.Context, userID, queryID int64, opts BenchmarkOptions) (*BenchmarkResult, error) {
+	startTime := time.Now()
+
+	query, err := e.queryRepo.GetByID(queryID)
+	if err != nil {
+		return nil, fmt.Errorf("query not found: %w", err)
+	}
+	conn, err := e.connRepo.GetByID(opts.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("connection not found: %w", err)
+	}
+	if conn.Production && !opts.ConfirmProduction {
+		return nil, fmt.Errorf("connection %s is marked production; confirm to benchmark it", conn.Name)
+	}
+
+	iterations := opts.Iterations
+	if iterations <= 0 {
+		iterations = defaultBenchmarkIterations
+	}
+	if iterations > maxBenchmarkIterations {
+		iterations = maxBenchmarkIterations
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if concurrency > maxBenchmarkConcurrency {
+		concurrency = maxBenchmarkConcurrency
+	}
+	if concurrency > iterations {
+		concurrency = iterations
+	}
+
+	result := &BenchmarkResult{Iterations: iterations, Concurrency: concurrency}
+	defer func() {
+		e.auditBenchmark(startTime, userID, queryID, opts, result)
+	}()
+
+	ctxRun := withoutAudit(withQueryTag(ctx, query.Slug))
+	var mu sync.Mutex
+	var durations []time.Duration
+	rows := -1
+	next := 0
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if next == iterations {
+					mu.Unlock()
+					return
+				}
+				next++
+				mu.Unlock()
+
+				select {
+				case benchmarkGuard <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				runStart := time.Now()
+				res, runErr := e.ExecuteSQL(ctxRun, opts.ConnectionID, query.SQLText, opts.Params, queryID)
+				elapsed := time.Since(runStart)
+				<-benchmarkGuard
+
+				mu.Lock()
+				if runErr != nil {
+					result.Errors++
+					if result.FirstError == "" {
+						result.FirstError = runErr.Error()
+					}
+				} else {
+					durations = append(durations, elapsed)
+					if rows < 0 {
+						rows = len(res.Data)
+						result.RowsPerRun = rows
+					} else if rows != len(res.Data) {
+						result.RowsVary = true
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	result.Interrupted = ctx.Err() != nil
+	result.setDurations(durations)
+	result.DurationMs = time.Since(startTime).Milliseconds()
+	return result, nil
+}
+
+// setDurations fills in the latency figures from the successful executions
+func (r *BenchmarkResult) setDurations(durations []time.Duration) {
+	if len(durations) == 0 {
+		return
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	rank := func(p int) time.Duration { return durations[(p*len(durations)+99)/100-1] }
+	r.MinMs = ms(durations[0])
+	r.MedianMs = ms(rank(50))
+	r.P95Ms = ms(rank(95))
+	r.MaxMs = ms(durations[len(durations)-1])
+}
+
+// auditBenchmark records the single audit entry of a benchmark
+func (e *QueryExecutor) auditBenchmark(startTime time.Time, userID, queryID int64, opts BenchmarkOptions, result *BenchmarkResult) {
+	summary := map[string]interface{}{
+		"params":      opts.Params,
+		"iterations":  result.Iterations,
+		"concurrency": result.Concurrency,
+		"errors":      result.Errors,
+		"median_ms":   result.MedianMs,
+		"p95_ms":      result.P95Ms,
+	}
+	params, _ := json.Marshal(summary)
+
+	e.writeAudit(&core.AuditLog{
+		Timestamp:    startTime,
+		UserID:       userID,
+		ConnectionID: opts.ConnectionID,
+		QueryID:      queryID,
+		DurationMs:   time.Since(startTime).Milliseconds(),
+		Status:       "BENCHMARK",
+		Params:       string(params),
+		Mode:         "benchmark",
+	}, nil)
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBenchmarkResultDurations(t *testing.T) {
+	var durations []time.Duration
+	for i := 20; i >= 1; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	var r BenchmarkResult
+	r.setDurations(durations)
+	if r.MinMs != 1 || r.MedianMs != 10 || r.P95Ms != 19 || r.MaxMs != 20 {
+		t.Errorf("min/median/p95/max = %v/%v/%v/%v, want 1/10/19/20", r.MinMs, r.MedianMs, r.P95Ms, r.MaxMs)
+	}
+
+	r = BenchmarkResult{}
+	r.setDurations([]time.Duration{1500 * time.Microsecond})
+	if r.MinMs != 1.5 || r.MedianMs != 1.5 || r.P95Ms != 1.5 || r.MaxMs != 1.5 {
+		t.Errorf("single run = %+v", r)
+	}
+}
+
+func TestRecordAuditSkipped(t *testing.T) {
+	repo := &memAuditRepo{cursors: map[string]int64{}}
+	e := &QueryExecutor{auditRepo: repo}
+	e.recordAudit(withoutAudit(context.Background()), time.Now(), 1, 2, nil, "", nil, "", nil)
+	if len(repo.logs) != 0 {
+		t.Errorf("recorded %d entries, want none", len(repo.logs))
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBindArgs(t *testing.T) {
+	args := []interface{}{int64(42), 3.5, true, nil, "text", []byte("raw"), time.Date(2024, 3, 1, 13, 45, 0, 0, time.UTC)}
+
+	native := bindArgs(&core.DBConnection{}, args)
+	if !reflect.DeepEqual(native, args) {
+		t.Errorf("native bindArgs() = %#v, want unchanged", native)
+	}
+
+	got := bindArgs(&core.DBConnection{BindMode: core.BindModeString}, args)
+	want := []interface{}{"42", "3.5", "1", nil, "text", "raw", "2024-03-01 13:45:00"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("string bindArgs() = %#v, want %#v", got, want)
+	}
+}
+
+func TestBindHint(t *testing.T) {
+	args := []interface{}{int64(1)}
+	if hint := bindHint(&core.DBConnection{Driver: "odbc"}, args); !strings.Contains(hint, "strings") {
+		t.Errorf("bindHint(odbc) = %q, want a pointer to string binding", hint)
+	}
+	if hint := bindHint(&core.DBConnection{Driver: "odbc", BindMode: core.BindModeString}, args); hint != "" {
+		t.Errorf("bindHint(odbc, string mode) = %q, want none", hint)
+	}
+	if hint := bindHint(&core.DBConnection{Driver: "postgres"}, args); hint != "" {
+		t.Errorf("bindHint(postgres) = %q, want none", hint)
+	}
+}
+
+func TestBindKeyParams(t *testing.T) {
+	e := &QueryExecutor{parser: core.NewSQLParser()}
+	sql := "SELECT * FROM orders WHERE tenant = {_key.tenant_id} AND token = {_key.token} AND id = {id}"
+	params := map[string]interface{}{"id": 7, "_key.tenant_id": "spoofed"}
+	keyCtx := context.WithValue(context.Background(), core.ContextKeyApiKeyAttributes,
+		[]core.KeyAttribute{{Name: "tenant_id", Value: "42"}, {Name: "token", Value: "s3cret", Sensitive: true}})
+
+	bound, audited, err := e.bindKeyParams(keyCtx, sql, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"id": 7, "_key.tenant_id": "42", "_key.token": "s3cret"}; !reflect.DeepEqual(bound, want) {
+		t.Errorf("bound = %v, want %v", bound, want)
+	}
+	if want := map[string]interface{}{"id": 7, "_key.tenant_id": "42", "_key.token": "********"}; !reflect.DeepEqual(audited, want) {
+		t.Errorf("audited = %v, want %v", audited, want)
+	}
+	if params["_key.tenant_id"] != "spoofed" {
+		t.Errorf("request params changed: %v", params)
+	}
+
+	var attrErr *core.KeyAttributeError
+	lacking := context.WithValue(context.Background(), core.ContextKeyApiKeyAttributes, []core.KeyAttribute{{Name: "tenant_id", Value: "42"}})
+	if _, _, err := e.bindKeyParams(lacking, sql, params); !errors.As(err, &attrErr) || attrErr.Attribute != "token" || attrErr.NoKey {
+		t.Errorf("key without the attribute: err = %v", err)
+	}
+	if _, _, err := e.bindKeyParams(context.Background(), sql, params); !errors.As(err, &attrErr) || !attrErr.NoKey {
+		t.Errorf("call without a key: err = %v", err)
+	}
+}
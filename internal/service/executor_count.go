@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	rePaginationTag  = regexp.MustCompile(`(?i)\{\s*pagination(?::\s*\d*\s*:\s*\d*\s*)?\}`)
+	reOrderByTag     = regexp.MustCompile(`(?i)\{\s*order_by:[^}]+\}`)
+	reTrailingOrder  = regexp.MustCompile(`(?is)\s+ORDER\s+BY\s+[^()]*$`)
+	reRowLimit       = regexp.MustCompile(`(?i)\b(LIMIT|OFFSET|FETCH)\b`)
+	reLeadingSelect  = regexp.MustCompile(`(?is)^\s*(SELECT|WITH)\b`)
+	reLeadingWith    = regexp.MustCompile(`(?is)^\s*WITH\b`)
+	reBatchStatement = regexp.MustCompile(`(?is)^\s*BEGIN\b`)
+)
+
+// CountByName runs a saved query in count-only mode on a connection given by name
+func (e *QueryExecutor) CountByName(ctx context.Context, connName string, querySlug string, params map[string]interface{}) (int64, error) {
+	conn, err := e.connRepo.GetByName(connName)
+	if err != nil {
+		return 0, fmt.Errorf("connection not found: %w", err)
+	}
+	queryDetails, err := e.queryRepo.GetBySlug(querySlug)
+	if err != nil {
+		return 0, fmt.Errorf("query not found: %w", err)
+	}
+	if err := checkSunset(queryDetails, time.Now()); err != nil {
+		return 0, err
+	}
+	return e.CountSQL(withQueryTag(ctx, querySlug), conn.ID, queryDetails.SQLText, params, queryDetails.ID)
+}
+
+// CountSQL returns how many rows sqlText would produce without fetching them:
+// the query (pagination and ordering stripped) is wrapped in
+// SELECT COUNT(*) FROM ( ... ) t with the same bound parameters.
+// It is audited with mode "count".
+func (e *QueryExecutor) CountSQL(ctx context.Context, connectionID int64, sqlText string, params map[string]interface{}, queryID int64) (count int64, err error) {
+	startTime := time.Now()
+	auditParams := params
+	defer func() {
+		e.recordAudit(ctx, startTime, connectionID, queryID, auditParams, "count", err, "", nil)
+	}()
+
+	params, auditParams, err = e.bindKeyParams(ctx, sqlText, params)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := e.checkWindow(ctx, queryID); err != nil {
+		return 0, err
+	}
+
+	connDetails, decryptedConnStr, dialect, err := e.loadConnection(ctx, connectionID)
+	if err != nil {
+		return 0, err
+	}
+	params, auditParams, _, err = e.applyConnectionParams(connDetails, sqlText, params, auditParams)
+	if err != nil {
+		return 0, err
+	}
+	runCtx, finish := e.trackExecution(ctx, connDetails, queryID, "count")
+	defer finish(&err)
+
+	// Comments are dropped from the count whatever the connection's setting: a
+	// leading one would fail the SELECT check and they can hide {...} tags
+	sqlText, err = e.parser.BindIdentifiers(core.StripComments(sqlText), params, dialect)
+	if err != nil {
+		return 0, err
+	}
+	if err := e.checkSchemas(connDetails, sqlText, queryID); err != nil {
+		return 0, err
+	}
+	parseResult := e.parseSQL(sqlText, params)
+	countSQL, err := e.buildCountSQL(parseResult.SQL, dialect)
+	if err != nil {
+		return 0, err
+	}
+
+	args, err := e.parser.MapValues(parseResult.ParamNames, parseResult.BindLikeValues(params, dialect), parseResult.Defaults, parseResult.RawDefaults)
+	if err != nil {
+		return 0, err
+	}
+	args = bindArgs(connDetails, args)
+
+	ctxTimeout, cancel := context.WithTimeout(runCtx, e.queryTimeout())
+	defer cancel()
+
+	db, err := e.connect(e.withSessionTag(ctxTimeout, queryID), connDetails, decryptedConnStr, dialect)
+	if err != nil {
+		return 0, translateDBError(ctxTimeout, dialect, err, err)
+	}
+	defer e.release(db)
+
+	if err := db.QueryRowContext(ctxTimeout, countSQL, args...).Scan(&count); err != nil {
+		return 0, translateDBError(ctxTimeout, dialect, err, fmt.Errorf("count execution error: %w%s", err, bindHint(connDetails, args)))
+	}
+	return count, nil
+}
+
+// buildCountSQL wraps the parsed SQL in a COUNT(*) subquery. Shapes that cannot
+// be wrapped portably are rejected with an explanation instead of being sent
+// to the driver.
+func (e *QueryExecutor) buildCountSQL(parsedSQL string, dialect core.Dialect) (string, error) {
+	inner := strings.TrimRight(strings.TrimSpace(e.unpagedSQL(parsedSQL)), ";")
+
+	if reBatchStatement.MatchString(inner) {
+		return "", fmt.Errorf("count_only is not supported for batch (BEGIN ... END) queries")
+	}
+	if !reLeadingSelect.MatchString(inner) {
+		return "", fmt.Errorf("count_only requires a SELECT query")
+	}
+
+	// ORDER BY is meaningless for a count, and SQL Server rejects it inside a
+	// subquery. One followed by LIMIT, OFFSET or FETCH picks the rows counted,
+	// so it stays with them: every dialect accepts it there.
+	if order := reTrailingOrder.FindString(inner); order != "" && !reRowLimit.MatchString(order) {
+		inner = strings.TrimSuffix(inner, order)
+	}
+
+	if dialect.Name() == "mssql" && reLeadingWith.MatchString(inner) {
+		return "", fmt.Errorf("count_only is not supported for WITH (CTE) queries on SQL Server")
+	}
+
+	// The derived table alias is required by SQL Anywhere, MySQL and SQL Server;
+	// it is written without AS for Oracle
+	return dialect.RewritePlaceholders(fmt.Sprintf("SELECT COUNT(*) FROM (\n%s\n) t", inner)), nil
+}
+
+// unpagedSQL turns parsed SQL into executable SQL covering the whole result:
+// pagination and {order_by} are dropped and the select block is expanded
+func (e *QueryExecutor) unpagedSQL(parsedSQL string) string {
+	sqlText := e.formatSQL(parsedSQL)
+	sqlText = rePaginationTag.ReplaceAllString(sqlText, "")
+	sqlText = reOrderByTag.ReplaceAllString(sqlText, "")
+	return e.formatSQL(e.processSelectBlock(sqlText).SQLWithout)
+}
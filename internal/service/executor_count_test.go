@@ -0,0 +1,99 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"strings"
+	"testing"
+)
+
+func TestBuildCountSQL(t *testing.T) {
+	executor := &QueryExecutor{}
+
+	tests := []struct {
+		name      string
+		sql       string
+		driver    string
+		connStr   string
+		wantInner string
+		wantErr   string
+	}{
+		{
+			name:      "pagination and order_by stripped",
+			sql:       "SELECT id, name FROM users WHERE active = ? {order_by:name} {pagination}",
+			driver:    "sqlite",
+			wantInner: "SELECT id, name FROM users WHERE active = ?",
+		},
+		{
+			name:      "select block keeps columns",
+			sql:       "SELECT {select}id, total{endselect} FROM orders;",
+			driver:    "postgres",
+			wantInner: "SELECT id, total FROM orders",
+		},
+		{
+			name:      "static trailing ORDER BY removed for SQL Server",
+			sql:       "SELECT id FROM orders WHERE id IN (SELECT order_id FROM lines) ORDER BY id DESC",
+			driver:    "sqlserver",
+			wantInner: "SELECT id FROM orders WHERE id IN (SELECT order_id FROM lines)",
+		},
+		{
+			name:      "ORDER BY kept with the LIMIT it applies to",
+			sql:       "SELECT id FROM orders ORDER BY total DESC LIMIT 10",
+			driver:    "sqlite",
+			wantInner: "SELECT id FROM orders ORDER BY total DESC LIMIT 10",
+		},
+		{
+			name:      "ORDER BY kept with OFFSET FETCH",
+			sql:       "SELECT id FROM orders ORDER BY id OFFSET 5 ROWS FETCH NEXT 10 ROWS ONLY",
+			driver:    "sqlserver",
+			wantInner: "SELECT id FROM orders ORDER BY id OFFSET 5 ROWS FETCH NEXT 10 ROWS ONLY",
+		},
+		{
+			name:    "batch rejected",
+			sql:     "begin select id from #trx end",
+			driver:  "odbc",
+			wantErr: "batch",
+		},
+		{
+			name:    "non-select rejected",
+			sql:     "EXEC report_totals",
+			driver:  "odbc",
+			wantErr: "requires a SELECT",
+		},
+		{
+			name:    "CTE rejected on SQL Server via ODBC",
+			sql:     "WITH x AS (SELECT 1 AS a) SELECT a FROM x",
+			driver:  "odbc",
+			connStr: "Driver={ODBC Driver 18 for SQL Server};Server=db",
+			wantErr: "WITH (CTE)",
+		},
+		{
+			name:      "CTE allowed elsewhere",
+			sql:       "WITH x AS (SELECT 1 AS a) SELECT a FROM x",
+			driver:    "postgres",
+			wantInner: "WITH x AS (SELECT 1 AS a) SELECT a FROM x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialect, err := core.DialectFor("", tt.driver, tt.connStr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := executor.buildCountSQL(tt.sql, dialect)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("buildCountSQL() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildCountSQL() error = %v", err)
+			}
+			want := "SELECT COUNT(*) FROM (\n" + tt.wantInner + "\n) t"
+			if got != want {
+				t.Errorf("buildCountSQL() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
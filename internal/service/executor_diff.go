@@ -0,0 +1,477 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"dbbridge/internal/core"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultDiffRows is how many differing rows a diff returns when not specified
+	defaultDiffRows = 50
+	maxDiffRows     = 1000
+
+	// diffRetainRows caps how many unmatched rows keep their values while both
+	// sides are streaming. Past it only the row hash is kept, so a diff of two
+	// large, differently ordered results stays bounded in memory; rows reported
+	// without values were beyond this cap.
+	diffRetainRows = 10000
+)
+
+var errDiffAborted = errors.New("diff aborted: the other connection failed")
+
+// DiffOptions describes a comparison of one saved query across two connections
+type DiffOptions struct {
+	ConnectionA int64
+	ConnectionB int64
+	Params      map[string]interface{}
+	KeyColumns  []string // identify the same row on both sides
+	MaxRows     int      // differing rows to return, defaultDiffRows when 0
+}
+
+// DiffRow is one row that differs. Status is "changed", "only_a" or "only_b";
+// A and B hold the compared columns as text and are omitted when not retained.
+type DiffRow struct {
+	Key    map[string]interface{} `json:"key"`
+	Status string                 `json:"status"`
+	A      map[string]interface{} `json:"a,omitempty"`
+	B      map[string]interface{} `json:"b,omitempty"`
+}
+
+type DiffResult struct {
+	Identical       bool      `json:"identical"`
+	RowsA           int64     `json:"rows_a"`
+	RowsB           int64     `json:"rows_b"`
+	Matching        int64     `json:"matching"`
+	Changed         int64     `json:"changed"`
+	OnlyInA         int64     `json:"only_in_a"`
+	OnlyInB         int64     `json:"only_in_b"`
+	DuplicateKeysA  int64     `json:"duplicate_keys_a,omitempty"`
+	DuplicateKeysB  int64     `json:"duplicate_keys_b,omitempty"`
+	ColumnsCompared []string  `json:"columns_compared"`
+	ColumnsOnlyInA  []string  `json:"columns_only_in_a"`
+	ColumnsOnlyInB  []string  `json:"columns_only_in_b"`
+	Rows            []DiffRow `json:"rows"`
+	DurationMs      int64     `json:"duration_ms"`
+}
+
+// diffEntry is a key seen on at least one side and not yet matched
+type diffEntry struct {
+	seen [2]bool
+	hash [2][sha256.Size]byte
+	row  [2]map[string]interface{}
+	key  map[string]interface{}
+}
+
+// diffRun is the state shared by the two streaming sides
+type diffRun struct {
+	keyColumns      []string
+	maxRows         int
+	skipSchemaCheck bool // the query's acknowledgment, see CheckSchemas
+
+	// each side publishes its column list (nil on failure) and waits for the
+	// other's, so both hash the same columns in the same order
+	columns [2]chan []string
+
+	mu         sync.Mutex
+	pending    map[string]*diffEntry
+	retained   int
+	result     DiffResult
+	duplicates [2]int64
+}
+
+// DiffQuery runs a saved query on two connections concurrently under one shared
+// timeout and compares the results row by row, matched on opts.KeyColumns.
+// Pagination is ignored so the whole result is compared; each row is reduced
+// to a hash of its common columns, so memory grows with the number of
+// unmatched rows rather than the result size. Values are compared by their
+// text form and column names case-insensitively, so the same data read through
+// different drivers compares equal.
+//
+// Both executions are audited with mode "diff", followed by a DIFF entry for userID.
+func (e *QueryExecutor) DiffQuery(ctx context.Context, userID, queryID int64, opts DiffOptions) (result *DiffResult, err error) {
+	startTime := time.Now()
+
+	query, err := e.queryRepo.GetByID(queryID)
+	if err != nil {
+		return nil, fmt.Errorf("query not found: %w", err)
+	}
+	if len(opts.KeyColumns) == 0 {
+		return nil, fmt.Errorf("at least one key column is required")
+	}
+	if opts.ConnectionA == opts.ConnectionB {
+		return nil, fmt.Errorf("two different connections are required")
+	}
+	maxRows := opts.MaxRows
+	if maxRows <= 0 {
+		maxRows = defaultDiffRows
+	}
+	if maxRows > maxDiffRows {
+		maxRows = maxDiffRows
+	}
+
+	defer func() {
+		e.auditDiff(startTime, userID, queryID, opts, result, err)
+	}()
+
+	ctxTimeout, cancel := context.WithTimeout(withQueryTag(ctx, query.Slug), e.queryTimeout())
+	defer cancel()
+	ctxRun, cancelRun := context.WithCancel(ctxTimeout)
+	defer cancelRun()
+
+	run := &diffRun{
+		keyColumns:      opts.KeyColumns,
+		maxRows:         maxRows,
+		skipSchemaCheck: query.SkipSchemaCheck,
+		columns:         [2]chan []string{make(chan []string, 1), make(chan []string, 1)},
+		pending:         make(map[string]*diffEntry),
+	}
+
+	// The first failure cancels the other side; later errors are consequences of it
+	var wg sync.WaitGroup
+	var failOnce sync.Once
+	var firstErr error
+	for side, connID := range []int64{opts.ConnectionA, opts.ConnectionB} {
+		wg.Add(1)
+		go func(side int, connID int64) {
+			defer wg.Done()
+			sideStart := time.Now()
+			sideErr := e.diffSide(ctxRun, run, side, connID, query.SQLText, opts.Params)
+			if sideErr != nil {
+				failOnce.Do(func() {
+					firstErr = fmt.Errorf("connection %s: %w", []string{"A", "B"}[side], sideErr)
+					cancelRun()
+				})
+			}
+			e.recordAudit(ctx, sideStart, connID, queryID, opts.Params, "diff", sideErr, "", nil)
+		}(side, connID)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	run.finish()
+	run.result.DurationMs = time.Since(startTime).Milliseconds()
+	return &run.result, nil
+}
+
+// diffSide streams one connection's result into run
+func (e *QueryExecutor) diffSide(ctx context.Context, run *diffRun, side int, connID int64, sqlText string, params map[string]interface{}) (err error) {
+	published := false
+	defer func() {
+		if !published {
+			run.columns[side] <- nil
+		}
+	}()
+
+	connDetails, connStr, dialect, err := e.loadConnection(ctx, connID)
+	if err != nil {
+		return err
+	}
+
+	params, _, err = e.bindKeyParams(ctx, sqlText, params)
+	if err != nil {
+		return err
+	}
+	params, _, _, err = e.applyConnectionParams(connDetails, sqlText, params, params)
+	if err != nil {
+		return err
+	}
+	sqlText, restoreComments := cutComments(connDetails, sqlText)
+	sqlText, err = e.parser.BindIdentifiers(sqlText, params, dialect)
+	if err != nil {
+		return err
+	}
+	if !run.skipSchemaCheck {
+		if err := CheckSchemas(connDetails, sqlText); err != nil {
+			return err
+		}
+	}
+	parseResult := e.parseSQL(sqlText, params)
+	execSQL := dialect.RewritePlaceholders(restoreComments(e.unpagedSQL(parseResult.SQL)))
+	args, err := e.parser.MapValues(parseResult.ParamNames, parseResult.BindLikeValues(params, dialect), parseResult.Defaults, parseResult.RawDefaults)
+	if err != nil {
+		return err
+	}
+	args = bindArgs(connDetails, args)
+
+	db, err := e.connect(ctx, connDetails, connStr, dialect)
+	if err != nil {
+		return err
+	}
+	defer e.release(db)
+
+	rows, err := db.QueryContext(ctx, execSQL, args...)
+	if err != nil {
+		return fmt.Errorf("execution error: %w%s", err, bindHint(connDetails, args))
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	run.columns[side] <- columns
+	published = true
+
+	other := <-run.columns[1-side]
+	if other == nil {
+		return errDiffAborted
+	}
+
+	compared, keyIdx, err := run.layout(side, columns, other)
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range columns {
+		valuePtrs[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return err
+		}
+		run.add(side, columns, values, compared, keyIdx)
+	}
+	return rows.Err()
+}
+
+// layout resolves, for one side, the indexes of the compared columns (common
+// to both sides, ordered by lower-cased name) and of the key columns. Side A
+// also records the column summary.
+func (run *diffRun) layout(side int, columns, other []string) (compared []int, keyIdx []int, err error) {
+	index := make(map[string]int, len(columns))
+	for i, c := range columns {
+		index[strings.ToLower(c)] = i
+	}
+	otherSet := make(map[string]bool, len(other))
+	for _, c := range other {
+		otherSet[strings.ToLower(c)] = true
+	}
+
+	var names []string
+	for _, c := range columns {
+		if otherSet[strings.ToLower(c)] {
+			names = append(names, c)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	for _, n := range names {
+		compared = append(compared, index[strings.ToLower(n)])
+	}
+
+	for _, k := range run.keyColumns {
+		i, ok := index[strings.ToLower(k)]
+		if !ok || !otherSet[strings.ToLower(k)] {
+			return nil, nil, fmt.Errorf("key column %q is not in both results", k)
+		}
+		keyIdx = append(keyIdx, i)
+	}
+
+	if side == 0 {
+		run.mu.Lock()
+		run.result.ColumnsCompared = names
+		run.result.ColumnsOnlyInA = columnsMissing(columns, otherSet)
+		run.result.ColumnsOnlyInB = columnsMissing(other, lowerSet(columns))
+		run.mu.Unlock()
+	}
+	return compared, keyIdx, nil
+}
+
+func columnsMissing(columns []string, in map[string]bool) []string {
+	missing := []string{}
+	for _, c := range columns {
+		if !in[strings.ToLower(c)] {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+func lowerSet(columns []string) map[string]bool {
+	set := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		set[strings.ToLower(c)] = true
+	}
+	return set
+}
+
+// add hashes one row and matches it against the other side
+func (run *diffRun) add(side int, columns []string, values []interface{}, compared, keyIdx []int) {
+	var key strings.Builder
+	for _, i := range keyIdx {
+		writeDiffValue(&key, values[i])
+	}
+
+	var fields strings.Builder
+	for _, i := range compared {
+		writeDiffValue(&fields, values[i])
+	}
+	sum := sha256.Sum256([]byte(fields.String()))
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	if side == 0 {
+		run.result.RowsA++
+	} else {
+		run.result.RowsB++
+	}
+
+	entry, ok := run.pending[key.String()]
+	if ok && entry.seen[side] {
+		run.duplicates[side]++
+		return
+	}
+	if !ok {
+		entry = &diffEntry{key: make(map[string]interface{}, len(keyIdx))}
+		for _, i := range keyIdx {
+			entry.key[columns[i]] = diffText(values[i])
+		}
+		run.pending[key.String()] = entry
+	}
+	entry.seen[side] = true
+	entry.hash[side] = sum
+
+	if !entry.seen[1-side] {
+		if run.retained < diffRetainRows {
+			entry.row[side] = diffRowValues(columns, values, compared)
+			run.retained++
+		}
+		return
+	}
+
+	// Both sides seen: the entry is settled and no longer needs to be held
+	delete(run.pending, key.String())
+	if entry.row[1-side] != nil {
+		run.retained--
+	}
+	if entry.hash[0] == entry.hash[1] {
+		run.result.Matching++
+		return
+	}
+	run.result.Changed++
+	if len(run.result.Rows) < run.maxRows {
+		entry.row[side] = diffRowValues(columns, values, compared)
+		if entry.row[1-side] == nil {
+			entry.row[side] = nil // report both sides or neither
+		}
+		run.result.Rows = append(run.result.Rows, DiffRow{Key: entry.key, Status: "changed", A: entry.row[0], B: entry.row[1]})
+	}
+}
+
+// finish reports the rows that were only ever seen on one side
+func (run *diffRun) finish() {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	keys := make([]string, 0, len(run.pending))
+	for k := range run.pending {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		entry := run.pending[k]
+		status := "only_a"
+		if entry.seen[0] {
+			run.result.OnlyInA++
+		} else {
+			run.result.OnlyInB++
+			status = "only_b"
+		}
+		if len(run.result.Rows) < run.maxRows {
+			run.result.Rows = append(run.result.Rows, DiffRow{Key: entry.key, Status: status, A: entry.row[0], B: entry.row[1]})
+		}
+	}
+	if run.result.Rows == nil {
+		run.result.Rows = []DiffRow{}
+	}
+
+	run.result.DuplicateKeysA = run.duplicates[0]
+	run.result.DuplicateKeysB = run.duplicates[1]
+	run.result.Identical = run.result.Changed == 0 && run.result.OnlyInA == 0 && run.result.OnlyInB == 0 &&
+		run.result.DuplicateKeysA == 0 && run.result.DuplicateKeysB == 0 &&
+		len(run.result.ColumnsOnlyInA) == 0 && len(run.result.ColumnsOnlyInB) == 0
+}
+
+func diffRowValues(columns []string, values []interface{}, compared []int) map[string]interface{} {
+	row := make(map[string]interface{}, len(compared))
+	for _, i := range compared {
+		row[columns[i]] = diffText(values[i])
+	}
+	return row
+}
+
+// diffText is the comparable text form of a scanned value, nil for NULL
+func diffText(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// writeDiffValue appends a length-prefixed encoding of v that keeps NULL, ""
+// and adjacent values apart
+func writeDiffValue(b *strings.Builder, v interface{}) {
+	text, ok := diffText(v).(string)
+	if !ok {
+		b.WriteByte(0)
+		return
+	}
+	var n [binary.MaxVarintLen64]byte
+	b.WriteByte(1)
+	b.Write(n[:binary.PutUvarint(n[:], uint64(len(text)))])
+	b.WriteString(text)
+}
+
+func (e *QueryExecutor) auditDiff(startTime time.Time, userID, queryID int64, opts DiffOptions, result *DiffResult, err error) {
+	summary := map[string]interface{}{
+		"connection_a": opts.ConnectionA,
+		"connection_b": opts.ConnectionB,
+		"key":          opts.KeyColumns,
+	}
+	if result != nil {
+		summary["identical"] = result.Identical
+		summary["rows_a"] = result.RowsA
+		summary["rows_b"] = result.RowsB
+		summary["changed"] = result.Changed
+		summary["only_in_a"] = result.OnlyInA
+		summary["only_in_b"] = result.OnlyInB
+	}
+	params, _ := json.Marshal(summary)
+
+	entry := &core.AuditLog{
+		Timestamp:    startTime,
+		UserID:       userID,
+		ConnectionID: opts.ConnectionA,
+		QueryID:      queryID,
+		DurationMs:   time.Since(startTime).Milliseconds(),
+		Status:       "DIFF",
+		Params:       string(params),
+		Mode:         "diff",
+	}
+	if err != nil {
+		entry.ErrorMessage = err.Error()
+	}
+	e.writeAudit(entry, nil)
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"testing"
+)
+
+func newTestDiffRun(keys ...string) *diffRun {
+	return &diffRun{
+		keyColumns: keys,
+		maxRows:    10,
+		pending:    make(map[string]*diffEntry),
+	}
+}
+
+func feedDiff(t *testing.T, run *diffRun, side int, columns, other []string, rows [][]interface{}) {
+	t.Helper()
+	compared, keyIdx, err := run.layout(side, columns, other)
+	if err != nil {
+		t.Fatalf("layout() error = %v", err)
+	}
+	for _, row := range rows {
+		run.add(side, columns, row, compared, keyIdx)
+	}
+}
+
+func TestDiffRun(t *testing.T) {
+	colsA := []string{"id", "name", "legacy_flag"}
+	colsB := []string{"NAME", "ID", "created_at"}
+
+	run := newTestDiffRun("id")
+	feedDiff(t, run, 0, colsA, colsB, [][]interface{}{
+		{int64(1), "alice", "x"},
+		{int64(2), "bob", "x"},
+		{int64(3), "carol", "x"},
+		{int64(3), "carol again", "x"},
+	})
+	feedDiff(t, run, 1, colsB, colsA, [][]interface{}{
+		{[]byte("alice"), []byte("1"), nil}, // same data through a driver returning bytes
+		{"robert", int64(2), nil},
+		{"dave", int64(4), nil},
+	})
+	run.finish()
+	res := run.result
+
+	if res.RowsA != 4 || res.RowsB != 3 {
+		t.Errorf("rows = %d/%d, want 4/3", res.RowsA, res.RowsB)
+	}
+	if res.Matching != 1 || res.Changed != 1 || res.OnlyInA != 1 || res.OnlyInB != 1 {
+		t.Errorf("matching/changed/onlyA/onlyB = %d/%d/%d/%d, want 1/1/1/1", res.Matching, res.Changed, res.OnlyInA, res.OnlyInB)
+	}
+	if res.DuplicateKeysA != 1 {
+		t.Errorf("DuplicateKeysA = %d, want 1", res.DuplicateKeysA)
+	}
+	if len(res.ColumnsOnlyInA) != 1 || res.ColumnsOnlyInA[0] != "legacy_flag" {
+		t.Errorf("ColumnsOnlyInA = %v", res.ColumnsOnlyInA)
+	}
+	if len(res.ColumnsOnlyInB) != 1 || res.ColumnsOnlyInB[0] != "created_at" {
+		t.Errorf("ColumnsOnlyInB = %v", res.ColumnsOnlyInB)
+	}
+	if res.Identical {
+		t.Error("Identical = true, want false")
+	}
+
+	if len(res.Rows) != 3 {
+		t.Fatalf("len(Rows) = %d, want 3", len(res.Rows))
+	}
+	changed := res.Rows[0]
+	if changed.Status != "changed" || changed.A["name"] != "bob" || changed.B["NAME"] != "robert" {
+		t.Errorf("changed row = %+v", changed)
+	}
+	statuses := map[string]bool{res.Rows[1].Status: true, res.Rows[2].Status: true}
+	if !statuses["only_a"] || !statuses["only_b"] {
+		t.Errorf("unmatched statuses = %v", statuses)
+	}
+	if len(run.pending) != 2 {
+		t.Errorf("pending = %d, want only the 2 unmatched keys", len(run.pending))
+	}
+}
+
+func TestDiffRunIdentical(t *testing.T) {
+	cols := []string{"id", "amount"}
+	rows := [][]interface{}{{int64(1), nil}, {int64(2), ""}}
+
+	run := newTestDiffRun("id")
+	feedDiff(t, run, 0, cols, cols, rows)
+	feedDiff(t, run, 1, cols, cols, rows)
+	run.finish()
+
+	if !run.result.Identical || run.result.Matching != 2 || len(run.result.Rows) != 0 {
+		t.Errorf("result = %+v, want identical with 2 matching", run.result)
+	}
+}
+
+func TestDiffRunNullIsNotEmpty(t *testing.T) {
+	cols := []string{"id", "amount"}
+
+	run := newTestDiffRun("id")
+	feedDiff(t, run, 0, cols, cols, [][]interface{}{{int64(1), nil}})
+	feedDiff(t, run, 1, cols, cols, [][]interface{}{{int64(1), ""}})
+	run.finish()
+
+	if run.result.Changed != 1 {
+		t.Errorf("Changed = %d, want NULL and empty string to differ", run.result.Changed)
+	}
+}
+
+func TestDiffRunMissingKey(t *testing.T) {
+	run := newTestDiffRun("code")
+	if _, _, err := run.layout(0, []string{"id", "code"}, []string{"id"}); err == nil {
+		t.Error("layout() error = nil, want key column missing on one side")
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrProtectedWrite refuses SQL that writes in a run with guardrails
+var ErrProtectedWrite = errors.New("the connection is protected: test runs may only read; type the connection's name to run SQL that writes")
+
+// Guardrails limit admin test runs on protected connections, see
+// core.DBConnection.Protected
+type Guardrails struct {
+	MaxRows int
+	Timeout time.Duration
+	// AllowWrite runs SQL that writes too, once the connection's name was
+	// typed; the row cap and timeout still apply
+	AllowWrite bool
+}
+
+// ProtectedGuardrails returns the guardrails set by the PROTECTED_MAX_ROWS
+// and PROTECTED_TIMEOUT_SECONDS settings (100 rows and 5s without settings)
+func ProtectedGuardrails(settings *SettingsService) Guardrails {
+	if settings == nil {
+		return Guardrails{MaxRows: 100, Timeout: 5 * time.Second}
+	}
+	return Guardrails{
+		MaxRows: settings.Int("PROTECTED_MAX_ROWS"),
+		Timeout: time.Duration(settings.Int("PROTECTED_TIMEOUT_SECONDS")) * time.Second,
+	}
+}
+
+type guardrailsKey struct{}
+
+// WithGuardrails makes executions under ctx runs of at most g.MaxRows rows
+// and g.Timeout, or the executor's own limits where those are lower. Unless
+// g.AllowWrite, SQL that writes, as core.IsWriteSQL classifies it whatever the
+// query says, fails with ErrProtectedWrite.
+func WithGuardrails(ctx context.Context, g Guardrails) context.Context {
+	return context.WithValue(ctx, guardrailsKey{}, g)
+}
+
+// guardrailsFrom returns the guardrails of ctx, nil for none
+func guardrailsFrom(ctx context.Context) *Guardrails {
+	if g, ok := ctx.Value(guardrailsKey{}).(Guardrails); ok {
+		return &g
+	}
+	return nil
+}
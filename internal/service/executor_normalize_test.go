@@ -0,0 +1,32 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		val    interface{}
+		dbType string
+		want   interface{}
+	}{
+		{"bytes become text", []byte("abc"), "VARCHAR", "abc"},
+		{"oracle integer", "42", "NUMBER", json.Number("42")},
+		{"oracle decimal keeps precision", "12345678901234567890.123", "NUMBER", json.Number("12345678901234567890.123")},
+		{"oracle number json cannot hold", ".5", "NUMBER", ".5"},
+		{"numeric text elsewhere stays text", "42", "VARCHAR2", "42"},
+		{"mssql uniqueidentifier", []byte{0x78, 0x56, 0x34, 0x12, 0x34, 0x12, 0x34, 0x12, 0x12, 0x34, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc},
+			"UNIQUEIDENTIFIER", "12345678-1234-1234-1234-123456789ABC"},
+		{"nil", nil, "NUMBER", nil},
+		{"int64", int64(7), "", int64(7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeValue(tt.val, tt.dbType); got != tt.want {
+				t.Errorf("normalizeValue(%v, %q) = %#v, want %#v", tt.val, tt.dbType, got, tt.want)
+			}
+		})
+	}
+}
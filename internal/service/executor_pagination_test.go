@@ -0,0 +1,68 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"testing"
+)
+
+func TestProcessSystemVariablesDialects(t *testing.T) {
+	executor := &QueryExecutor{}
+	params := map[string]interface{}{"page": "3", "per_page": "20"}
+	sqlAnywhere, _ := core.ParseDialect("sqlanywhere", "odbc")
+
+	tests := []struct {
+		name    string
+		dialect core.Dialect
+		sql     string
+		want    string
+	}{
+		{"sqlite", core.SQLiteDialect{}, "SELECT * FROM t {pagination}",
+			"SELECT * FROM t LIMIT 20 OFFSET 40"},
+		{"mssql with order by", core.MSSQLDialect{NamedParams: true}, "SELECT * FROM t ORDER BY id {pagination}",
+			"SELECT * FROM t ORDER BY id OFFSET 40 ROWS FETCH NEXT 20 ROWS ONLY"},
+		{"mssql with order_by tag", core.MSSQLDialect{}, "SELECT * FROM t {order_by:id} {pagination}",
+			"SELECT * FROM t {order_by:id} OFFSET 40 ROWS FETCH NEXT 20 ROWS ONLY"},
+		{"mssql without order by", core.MSSQLDialect{}, "SELECT * FROM t {pagination}",
+			"SELECT * FROM t ORDER BY (SELECT NULL) OFFSET 40 ROWS FETCH NEXT 20 ROWS ONLY"},
+		{"oracle needs no order by", core.OracleDialect{}, "SELECT * FROM t {pagination}",
+			"SELECT * FROM t OFFSET 40 ROWS FETCH NEXT 20 ROWS ONLY"},
+		{"sqlanywhere moves TOP after SELECT DISTINCT", sqlAnywhere, "SELECT DISTINCT city FROM t {pagination}",
+			"SELECT DISTINCT TOP 20 START AT 41 city FROM t"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, page, limit, _ := executor.processSystemVariables(tt.sql, tt.dialect, params)
+			if got != tt.want {
+				t.Errorf("processSystemVariables() = %q, want %q", got, tt.want)
+			}
+			if page != 3 || limit != 20 {
+				t.Errorf("page, limit = %d, %d, want 3, 20", page, limit)
+			}
+		})
+	}
+}
+
+func TestProcessSystemVariablesSkipsComments(t *testing.T) {
+	executor := &QueryExecutor{}
+	sql := "SELECT * FROM t -- ORDER BY id {pagination:1:5}\n{pagination}"
+
+	for _, strip := range []bool{false, true} {
+		cut, restore := cutComments(&core.DBConnection{StripComments: strip}, sql)
+		got, _, limit, _ := executor.processSystemVariables(cut, core.MSSQLDialect{}, nil)
+		want := "SELECT * FROM t -- ORDER BY id {pagination:1:5}\nORDER BY (SELECT NULL) OFFSET 0 ROWS FETCH NEXT 50 ROWS ONLY"
+		if strip {
+			want = "SELECT * FROM t \nORDER BY (SELECT NULL) OFFSET 0 ROWS FETCH NEXT 50 ROWS ONLY"
+		}
+		if got = restore(got); got != want || limit != 50 {
+			t.Errorf("strip=%v: processSystemVariables() = %q (limit %d), want %q", strip, got, limit, want)
+		}
+	}
+}
+
+func TestProcessSystemVariablesPlacementError(t *testing.T) {
+	executor := &QueryExecutor{}
+	sqlAnywhere, _ := core.ParseDialect("sqlanywhere", "odbc")
+	if _, _, _, err := executor.processSystemVariables("SELECT a FROM x UNION SELECT a FROM y {pagination}", sqlAnywhere, nil); err == nil {
+		t.Error("UNION paginated on SQL Anywhere, want an error")
+	}
+}
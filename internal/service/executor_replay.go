@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// redactedValue is how the audit log records a sensitive key attribute
+const redactedValue = "********"
+
+var (
+	ErrReplayWritesDisabled = errors.New("replaying queries that write is turned off (AUDIT_REPLAY_WRITES)")
+	ErrReplayUnconfirmed    = errors.New("the query writes; confirm to run it again")
+)
+
+type replayKey struct{}
+
+// ReplayResult is a past execution run again by Replay
+type ReplayResult struct {
+	Write      bool // the query writes, see core.IsWriteSQL
+	DurationMs int64
+	Rows       int
+	Result     *ExecutionResult // nil when the replay failed
+	Error      string
+}
+
+// ReplayQuery returns the saved query the execution entry would run again
+// and whether it writes. It refuses entries that are not plain query
+// executions, and entries whose parameters can't be restored.
+func (e *QueryExecutor) ReplayQuery(entry *core.AuditLog) (q *core.SavedQuery, write bool, err error) {
+	if entry.EventType != "" || entry.QueryID == 0 || (entry.Mode != "" && entry.Mode != "replay") {
+		return nil, false, errors.New("only executions of saved queries can be replayed")
+	}
+	if strings.Contains(entry.Params, `"`+redactedValue+`"`) {
+		return nil, false, errors.New("the execution used a sensitive key attribute, which the audit log does not keep")
+	}
+	q, err = e.queryRepo.GetByID(entry.QueryID)
+	if err != nil {
+		return nil, false, fmt.Errorf("query not found: %w", err)
+	}
+	return q, core.IsWriteSQL(q.SQLText), nil
+}
+
+// ReplayWrites reports AUDIT_REPLAY_WRITES, on without settings
+func (e *QueryExecutor) ReplayWrites() bool {
+	return e.settings == nil || e.settings.Get("AUDIT_REPLAY_WRITES") != "false"
+}
+
+// Replay runs the saved query of an audited execution again on the same
+// connection with the recorded parameters. There is no query history, so the
+// query's current SQL runs. Key attributes are bound from the recorded values
+// and parameters the connection forces are left to the connection. A query
+// that writes needs confirmWrite, and AUDIT_REPLAY_WRITES on.
+//
+// The replay is audited as the user in ctx, with mode "replay" and the
+// original entry as its target.
+func (e *QueryExecutor) Replay(ctx context.Context, entry *core.AuditLog, confirmWrite bool) (*ReplayResult, error) {
+	q, write, err := e.ReplayQuery(entry)
+	if err != nil {
+		return nil, err
+	}
+	if write {
+		if !e.ReplayWrites() {
+			return nil, ErrReplayWritesDisabled
+		}
+		if !confirmWrite {
+			return nil, ErrReplayUnconfirmed
+		}
+	}
+
+	params := map[string]interface{}{}
+	if entry.Params != "" {
+		if err := json.Unmarshal([]byte(entry.Params), &params); err != nil {
+			return nil, fmt.Errorf("recorded parameters: %w", err)
+		}
+	}
+	var attrs []core.KeyAttribute
+	for name, v := range params {
+		if attr, ok := strings.CutPrefix(name, core.KeyParamPrefix); ok {
+			attrs = append(attrs, core.KeyAttribute{Name: attr, Value: fmt.Sprint(v)})
+			delete(params, name)
+		}
+	}
+	if attrs != nil {
+		ctx = context.WithValue(ctx, core.ContextKeyApiKeyAttributes, attrs)
+	}
+	if conn, err := e.connRepo.GetByID(entry.ConnectionID); err == nil {
+		if cp, err := ParseConnectionParams(conn.DefaultParams); err == nil {
+			for name := range cp.Forced {
+				delete(params, name)
+			}
+		}
+	}
+
+	ctx = context.WithValue(withQueryTag(ctx, q.Slug), replayKey{}, entry.ID)
+	start := time.Now()
+	res, err := e.ExecuteSQL(ctx, entry.ConnectionID, q.SQLText, params, q.ID)
+	replay := &ReplayResult{Write: write, DurationMs: time.Since(start).Milliseconds(), Result: res}
+	if err != nil {
+		replay.Error = ErrorDetail(err)
+	} else {
+		replay.Rows = len(res.Data)
+	}
+	return replay, nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SampleRows is how many rows a sample run returns
+const SampleRows = 10
+
+var reOffsetClause = regexp.MustCompile(`(?i)\bOFFSET\b`)
+
+type sampleKey struct{}
+
+// WithSample makes executions under ctx sample runs: whatever the caller's
+// parameters, at most rows rows are asked of the database. A query with
+// {pagination} runs its first page of rows rows; other queries are wrapped
+// in the dialect's row-limiting construct (see buildSampleSQL). Sample runs
+// are audited with mode "sample".
+func WithSample(ctx context.Context, rows int) context.Context {
+	return context.WithValue(ctx, sampleKey{}, rows)
+}
+
+// sampleRows returns the rows of a sample run under ctx, 0 for a full run
+func sampleRows(ctx context.Context) int {
+	rows, _ := ctx.Value(sampleKey{}).(int)
+	return rows
+}
+
+// samplePage returns params asking for the first page of rows rows, for
+// queries with {pagination}
+func samplePage(params map[string]interface{}, rows int) map[string]interface{} {
+	paged := make(map[string]interface{}, len(params)+2)
+	for k, v := range params {
+		paged[k] = v
+	}
+	paged["page"], paged["per_page"] = 1, rows
+	return paged
+}
+
+// buildSampleSQL wraps executable SQL so the database returns at most rows
+// rows. The query becomes a derived table, so a LIMIT, TOP or FETCH of its
+// own still applies. Dialects without a row-limiting construct get the SQL
+// back unchanged and the executor stops reading after rows rows.
+func buildSampleSQL(execSQL string, dialect core.Dialect, rows int) (string, error) {
+	inner := strings.TrimRight(strings.TrimSpace(execSQL), ";")
+
+	if reBatchStatement.MatchString(inner) {
+		return "", fmt.Errorf("sampling is not supported for batch (BEGIN ... END) queries")
+	}
+	if !reLeadingSelect.MatchString(core.StripComments(inner)) {
+		return "", fmt.Errorf("sampling requires a SELECT query")
+	}
+
+	// The construct follows the dialect's pagination style
+	style := "limit_offset"
+	switch d := dialect.(type) {
+	case *core.GenericDialect:
+		if d.Pagination != "" {
+			style = d.Pagination
+		}
+	case core.MSSQLDialect:
+		style = "top"
+	case core.OracleDialect:
+		style = "offset_fetch"
+	}
+
+	switch style {
+	case "limit_offset":
+		return fmt.Sprintf("SELECT * FROM (\n%s\n) t LIMIT %d", inner, rows), nil
+	case "offset_fetch":
+		return fmt.Sprintf("SELECT * FROM (\n%s\n) t FETCH FIRST %d ROWS ONLY", inner, rows), nil
+	case "top":
+		if reLeadingWith.MatchString(core.StripComments(inner)) {
+			return "", fmt.Errorf("sampling is not supported for WITH (CTE) queries on SQL Server")
+		}
+		// SQL Server only accepts ORDER BY in a derived table along with TOP
+		// or OFFSET
+		if order := reTrailingOrder.FindString(inner); order != "" && !reOffsetClause.MatchString(order) {
+			inner += "\nOFFSET 0 ROWS"
+		}
+		return fmt.Sprintf("SELECT TOP %d * FROM (\n%s\n) t", rows, inner), nil
+	case "top_start_at":
+		return fmt.Sprintf("SELECT TOP %d * FROM (\n%s\n) t", rows, inner), nil
+	}
+	return execSQL, nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"strings"
+	"testing"
+)
+
+func TestBuildSampleSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		dialect string
+		want    string
+		wantErr string
+	}{
+		{"limit wraps a query with its own LIMIT", "SELECT id FROM orders LIMIT 3;", "postgres",
+			"SELECT * FROM (\nSELECT id FROM orders LIMIT 3\n) t LIMIT 10", ""},
+		{"oracle fetches first rows", "SELECT id FROM orders", "oracle",
+			"SELECT * FROM (\nSELECT id FROM orders\n) t FETCH FIRST 10 ROWS ONLY", ""},
+		{"SQL Server keeps ORDER BY with OFFSET 0", "SELECT id FROM orders ORDER BY id", "mssql",
+			"SELECT TOP 10 * FROM (\nSELECT id FROM orders ORDER BY id\nOFFSET 0 ROWS\n) t", ""},
+		{"SQL Server keeps an OFFSET of its own", "SELECT id FROM orders ORDER BY id OFFSET 5 ROWS", "mssql",
+			"SELECT TOP 10 * FROM (\nSELECT id FROM orders ORDER BY id OFFSET 5 ROWS\n) t", ""},
+		{"SQL Anywhere uses TOP", "SELECT TOP 3 id FROM orders", "sqlanywhere",
+			"SELECT TOP 10 * FROM (\nSELECT TOP 3 id FROM orders\n) t", ""},
+		{"odbc without pagination is unchanged", "SELECT id FROM orders", "odbc:pagination=none",
+			"SELECT id FROM orders", ""},
+		{"leading comment", "-- open orders\nSELECT id FROM orders", "sqlite",
+			"SELECT * FROM (\n-- open orders\nSELECT id FROM orders\n) t LIMIT 10", ""},
+		{"CTE on SQL Server rejected", "WITH o AS (SELECT id FROM orders) SELECT id FROM o", "mssql", "", "WITH (CTE)"},
+		{"write rejected", "DELETE FROM orders", "sqlite", "", "requires a SELECT"},
+		{"batch rejected", "BEGIN SELECT id FROM orders END", "sqlanywhere", "", "batch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialect, err := core.ParseDialect(tt.dialect, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := buildSampleSQL(tt.sql, dialect, 10)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("buildSampleSQL = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,646 @@
+package service_test
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/data/memory"
+	"dbbridge/internal/service"
+	"dbbridge/internal/testutil"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExecuteByName(t *testing.T) {
+	env := testutil.NewMemEnv(t)
+	conn := env.CreateSQLiteConnection("shop",
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer TEXT, total REAL)`,
+		`INSERT INTO orders VALUES (1, 'acme', 10.5), (2, 'acme', 3), (3, 'globex', 7)`)
+	env.CreateQuery("orders-by-customer", "SELECT id, total FROM orders WHERE customer = {customer} ORDER BY id", conn.ID)
+	env.CreateQuery("order-count", "SELECT COUNT(*) AS n FROM orders", conn.ID)
+	env.CreateQuery("default-customer", "SELECT id FROM orders WHERE customer = {customer:globex}", conn.ID)
+	closed := env.CreateSQLiteConnection("archive")
+	closed.IsActive = false
+	if err := env.Connections.Update(closed); err != nil {
+		t.Fatal(err)
+	}
+	executor := env.Executor()
+
+	tests := []struct {
+		name    string
+		conn    string
+		slug    string
+		params  map[string]interface{}
+		want    string // the rows as fmt %v
+		wantErr string
+	}{
+		{name: "parameter bound", conn: "shop", slug: "orders-by-customer",
+			params: map[string]interface{}{"customer": "acme"}, want: "[map[id:1 total:10.5] map[id:2 total:3]]"},
+		{name: "no parameters", conn: "shop", slug: "order-count", want: "[map[n:3]]"},
+		{name: "default used", conn: "shop", slug: "default-customer", want: "[map[id:3]]"},
+		{name: "default overridden", conn: "shop", slug: "default-customer",
+			params: map[string]interface{}{"customer": "acme"}, want: "[map[id:1] map[id:2]]"},
+		{name: "no rows", conn: "shop", slug: "orders-by-customer",
+			params: map[string]interface{}{"customer": "initech"}, want: "[]"},
+		{name: "missing parameter", conn: "shop", slug: "orders-by-customer", wantErr: "customer"},
+		{name: "unknown connection", conn: "warehouse", slug: "order-count", wantErr: "connection"},
+		{name: "inactive connection", conn: "archive", slug: "order-count", wantErr: "connection is inactive"},
+		{name: "unknown query", conn: "shop", slug: "nope", wantErr: "query not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := executor.ExecuteByName(context.Background(), tt.conn, tt.slug, tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%v", result.Data); got != tt.want {
+				t.Errorf("rows = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteAudited(t *testing.T) {
+	env := testutil.NewMemEnv(t)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER PRIMARY KEY)`)
+	q := env.CreateQuery("orders", "SELECT id FROM orders WHERE id > {after}", conn.ID)
+	executor := env.Executor()
+
+	tests := []struct {
+		name       string
+		params     map[string]interface{}
+		wantStatus string
+		wantParams string
+	}{
+		{"success", map[string]interface{}{"after": 0}, "SUCCESS", `{"after":0}`},
+		{"error", nil, "ERROR", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor.ExecuteByName(context.Background(), "shop", "orders", tt.params)
+			logs, _ := env.Audit.GetRecent(1)
+			if len(logs) != 1 {
+				t.Fatalf("%d audit entries", len(logs))
+			}
+			got := logs[0]
+			if got.Status != tt.wantStatus || got.Params != tt.wantParams || got.QueryID != q.ID || got.ConnectionID != conn.ID {
+				t.Errorf("audit entry = %+v", got)
+			}
+		})
+	}
+	if all := env.Audit.(*memory.Audit).Logs(); len(all) != len(tests) {
+		t.Errorf("%d audit entries, want %d", len(all), len(tests))
+	}
+}
+
+func TestConnectionParams(t *testing.T) {
+	env := testutil.NewSQLiteEnv(t)
+	conn := env.CreateSQLiteConnection("erp",
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, company_id INTEGER, region TEXT)`,
+		`INSERT INTO orders VALUES (1, 3, 'US'), (2, 3, 'EU'), (3, 7, 'US'), (4, 7, 'EU')`)
+	env.CreateQuery("orders", "SELECT id FROM orders WHERE company_id = {company_id} AND region = {region:US} ORDER BY id", conn.ID)
+	executor := env.Executor()
+
+	tests := []struct {
+		name          string
+		defaultParams string
+		params        map[string]interface{}
+		want          string // the rows as fmt %v
+		wantWarning   bool
+		wantErr       string
+	}{
+		{name: "request and query default", params: map[string]interface{}{"company_id": 7}, want: "[map[id:3]]"},
+		{name: "no connection default", wantErr: "company_id"},
+		{name: "connection default fills the gap", defaultParams: `{"defaults": {"company_id": 3}}`,
+			want: "[map[id:1]]"},
+		{name: "request beats connection default", defaultParams: `{"defaults": {"company_id": 3}}`,
+			params: map[string]interface{}{"company_id": 7}, want: "[map[id:3]]"},
+		{name: "query default beats connection default", defaultParams: `{"defaults": {"company_id": 3, "region": "EU"}}`,
+			want: "[map[id:1]]"},
+		{name: "request beats query default", defaultParams: `{"defaults": {"company_id": 3}}`,
+			params: map[string]interface{}{"region": "EU"}, want: "[map[id:2]]"},
+		{name: "forced without a request value", defaultParams: `{"forced": {"company_id": 7}}`,
+			want: "[map[id:3]]"},
+		{name: "forced beats request", defaultParams: `{"forced": {"company_id": 7}}`,
+			params: map[string]interface{}{"company_id": 3}, want: "[map[id:3]]", wantWarning: true},
+		{name: "forced beats query default", defaultParams: `{"forced": {"company_id": 3, "region": "EU"}}`,
+			want: "[map[id:2]]"},
+		{name: "forced and default", defaultParams: `{"defaults": {"region": "EU"}, "forced": {"company_id": 3}}`,
+			params: map[string]interface{}{"company_id": 7, "region": "EU"}, want: "[map[id:2]]", wantWarning: true},
+		{name: "invalid default params", defaultParams: `{"defaults": {"page": 2}}`, wantErr: "cannot be a parameter name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn.DefaultParams = tt.defaultParams
+			if err := env.Connections.Update(conn); err != nil {
+				t.Fatal(err)
+			}
+			result, err := executor.ExecuteByName(context.Background(), "erp", "orders", tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%v", result.Data); got != tt.want {
+				t.Errorf("rows = %s, want %s", got, tt.want)
+			}
+			if got := slices.Contains(result.Warnings, service.WarningForcedParams); got != tt.wantWarning {
+				t.Errorf("warnings = %v, want forced_params %v", result.Warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestRenamedQuerySlugAlias(t *testing.T) {
+	envs := []struct {
+		name string
+		new  func(testing.TB) *testutil.Env
+	}{
+		{"memory", testutil.NewMemEnv},
+		{"sqlite", testutil.NewSQLiteEnv},
+	}
+	for _, e := range envs {
+		t.Run(e.name, func(t *testing.T) {
+			env := e.new(t)
+			conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER PRIMARY KEY)`)
+			q := env.CreateQuery("orders", "SELECT COUNT(*) AS n FROM orders", conn.ID)
+			for _, slug := range []string{"order-list", "all-orders"} {
+				q.Slug = slug
+				if err := env.Queries.Update(q); err != nil {
+					t.Fatal(err)
+				}
+			}
+			aliases, err := env.Queries.ListAliases(q.ID)
+			if err != nil || len(aliases) != 2 || aliases[0].Slug != "orders" || aliases[1].Slug != "order-list" {
+				t.Fatalf("aliases = %+v, %v; want orders and order-list", aliases, err)
+			}
+
+			executor := env.Executor()
+			result, err := executor.ExecuteByName(context.Background(), "shop", "orders", nil)
+			if err != nil || !slices.Contains(result.Warnings, service.WarningDeprecated) {
+				t.Fatalf("old slug: %+v, %v; want a deprecated warning", result, err)
+			}
+			l, err := executor.Lifecycle("orders", time.Now())
+			if err != nil || l == nil || l.SupersededBy != "all-orders" || l.DeprecatedAt == nil {
+				t.Errorf("old slug lifecycle = %+v, %v", l, err)
+			}
+			if l, _ := executor.Lifecycle("all-orders", time.Now()); l != nil {
+				t.Errorf("current slug lifecycle = %+v, want nil", l)
+			}
+
+			// Renaming back drops the alias; retired aliases stop resolving
+			q.Slug = "orders"
+			if err := env.Queries.Update(q); err != nil {
+				t.Fatal(err)
+			}
+			if err := env.Queries.DeleteAlias("order-list"); err != nil {
+				t.Fatal(err)
+			}
+			if aliases, _ := env.Queries.ListAliases(q.ID); len(aliases) != 1 || aliases[0].Slug != "all-orders" {
+				t.Errorf("aliases = %+v, want all-orders", aliases)
+			}
+			if _, err := env.Queries.GetBySlug("order-list"); err == nil {
+				t.Error("retired alias still resolves")
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	env := testutil.NewMemEnv(t)
+	conn := env.CreateSQLiteConnection("shop",
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer TEXT)`,
+		`INSERT INTO orders VALUES (1, 'acme'), (2, 'acme'), (3, 'globex')`)
+	env.CreateQuery("orders-by-customer", "SELECT id FROM orders WHERE customer = {customer}", conn.ID)
+	env.CreateQuery("delete-order", "DELETE FROM orders WHERE id = {id}", conn.ID)
+	executor := env.Executor()
+	last := func() *core.AuditLog {
+		t.Helper()
+		logs, err := env.Audit.GetRecent(1)
+		if err != nil || len(logs) != 1 {
+			t.Fatalf("audit = %v, %v", logs, err)
+		}
+		return &logs[0]
+	}
+
+	if _, err := executor.ExecuteByName(context.Background(), "shop", "orders-by-customer", map[string]interface{}{"customer": "acme"}); err != nil {
+		t.Fatal(err)
+	}
+	original := last()
+	ctx := context.WithValue(context.Background(), core.ContextKeyUserID, int64(7))
+	replay, err := executor.Replay(ctx, original, false)
+	if err != nil || replay.Error != "" || replay.Rows != 2 || replay.Write {
+		t.Fatalf("replay = %+v, %v; want 2 rows", replay, err)
+	}
+	if entry := last(); entry.Mode != "replay" || entry.Target != fmt.Sprintf("replay of #%d", original.ID) || entry.UserID != 7 ||
+		entry.Params != original.Params || entry.ConnectionID != conn.ID {
+		t.Errorf("replay audit = %+v", entry)
+	}
+
+	if _, err := executor.ExecuteByName(context.Background(), "shop", "delete-order", map[string]interface{}{"id": 3}); err != nil {
+		t.Fatal(err)
+	}
+	write := last()
+	if _, err := executor.Replay(ctx, write, false); !errors.Is(err, service.ErrReplayUnconfirmed) {
+		t.Errorf("unconfirmed write replay: %v", err)
+	}
+	if replay, err := executor.Replay(ctx, write, true); err != nil || replay.Error != "" || !replay.Write {
+		t.Errorf("confirmed write replay = %+v, %v", replay, err)
+	}
+
+	event := &core.AuditLog{ID: 99, EventType: core.EventQueryDelete, QueryID: original.QueryID}
+	if _, err := executor.Replay(ctx, event, true); err == nil {
+		t.Error("an admin event was replayed")
+	}
+}
+
+func TestExecuteSample(t *testing.T) {
+	env := testutil.NewMemEnv(t)
+	var values []string
+	for i := 1; i <= 30; i++ {
+		values = append(values, fmt.Sprintf("(%d)", i))
+	}
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER PRIMARY KEY)`,
+		`INSERT INTO orders VALUES `+strings.Join(values, ", "))
+	executor := env.Executor()
+	ctx := service.WithSample(context.Background(), service.SampleRows)
+
+	tests := []struct {
+		name   string
+		sql    string
+		params map[string]interface{}
+		want   int
+	}{
+		{"wrapped", "SELECT id FROM orders ORDER BY id", nil, service.SampleRows},
+		{"own LIMIT below the sample", "SELECT id FROM orders ORDER BY id LIMIT 4", nil, 4},
+		{"paginated ignores the caller's page size", "SELECT id FROM orders ORDER BY id {pagination}",
+			map[string]interface{}{"page": 2, "per_page": 25}, service.SampleRows},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := executor.ExecuteSQL(ctx, conn.ID, tt.sql, tt.params, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Data) != tt.want {
+				t.Errorf("%d rows, want %d", len(result.Data), tt.want)
+			}
+			if first := fmt.Sprint(result.Data[0]["id"]); first != "1" {
+				t.Errorf("first id = %s, want 1", first)
+			}
+			logs, _ := env.Audit.GetRecent(1)
+			if len(logs) != 1 || logs[0].Mode != "sample" {
+				t.Errorf("audit entry = %+v, want mode sample", logs)
+			}
+		})
+	}
+}
+
+func TestEmbedTokens(t *testing.T) {
+	env := testutil.NewSQLiteEnv(t)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT)`,
+		`INSERT INTO orders (status) VALUES ('open'), ('open'), ('open'), ('paid')`)
+	other := env.CreateSQLiteConnection("archive")
+	q := env.CreateQuery("open-orders", "SELECT id FROM orders WHERE status = {status}", conn.ID)
+	write := env.CreateQuery("close-orders", "UPDATE orders SET status = 'closed'", conn.ID)
+	embeds := service.NewEmbedService(env.Embeds, env.Executor(), testutil.Key)
+
+	opts := service.EmbedOptions{QueryID: q.ID, ConnectionID: conn.ID, Params: map[string]interface{}{"status": "open"},
+		RowCap: 2, TTL: time.Hour}
+	token, created, err := embeds.Create(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, o := range map[string]service.EmbedOptions{
+		"write query":          {QueryID: write.ID, ConnectionID: conn.ID, TTL: time.Hour},
+		"other connection":     {QueryID: q.ID, ConnectionID: other.ID, TTL: time.Hour},
+		"row cap too high":     {QueryID: q.ID, ConnectionID: conn.ID, RowCap: service.MaxEmbedRowCap + 1, TTL: time.Hour},
+		"expiry beyond a year": {QueryID: q.ID, ConnectionID: conn.ID, TTL: service.MaxEmbedTTL + time.Hour},
+	} {
+		if _, _, err := embeds.Create(o); err == nil {
+			t.Errorf("%s: token created", name)
+		}
+	}
+
+	got, err := embeds.Resolve(token)
+	if err != nil || got.ID != created.ID {
+		t.Fatalf("Resolve = %+v, %v", got, err)
+	}
+	id, _, _ := strings.Cut(token, ".")
+	for _, bad := range []string{token + "x", id + ".AAAA", "99." + strings.SplitN(token, ".", 2)[1], "junk"} {
+		if _, err := embeds.Resolve(bad); !errors.Is(err, service.ErrEmbedNotFound) {
+			t.Errorf("Resolve(%q) = %v, want not found", bad, err)
+		}
+	}
+
+	result, err := embeds.Run(context.Background(), got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Data) != 2 {
+		t.Errorf("%d rows, want the row cap of 2", len(result.Data))
+	}
+	logs, _ := env.Audit.GetRecent(1)
+	want := fmt.Sprintf("embed token #%d", created.ID)
+	if len(logs) != 1 || logs[0].Mode != "embed" || logs[0].Target != want {
+		t.Errorf("audit entry = %+v, want mode embed for %s", logs, want)
+	}
+	if used, _ := embeds.Get(created.ID); used.LastUsedAt == nil {
+		t.Error("last use not recorded")
+	}
+
+	if err := embeds.Revoke(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := embeds.Resolve(token); !errors.Is(err, service.ErrEmbedRevoked) {
+		t.Errorf("Resolve of a revoked token = %v", err)
+	}
+}
+
+func TestEmbedTokenQueryEdited(t *testing.T) {
+	env := testutil.NewSQLiteEnv(t)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT)`,
+		`INSERT INTO orders (status) VALUES ('open')`)
+	other := env.CreateSQLiteConnection("archive")
+	q := env.CreateQuery("open-orders", "SELECT id FROM orders", conn.ID)
+	embeds := service.NewEmbedService(env.Embeds, env.Executor(), testutil.Key)
+	_, token, err := embeds.Create(service.EmbedOptions{QueryID: q.ID, ConnectionID: conn.ID, TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, edit := range map[string]func(q *core.SavedQuery){
+		"now writes":         func(q *core.SavedQuery) { q.SQLText = "UPDATE orders SET status = 'closed'" },
+		"connection removed": func(q *core.SavedQuery) { q.AllowedConnectionIDs = []int64{other.ID} },
+	} {
+		edited := *q
+		edit(&edited)
+		if err := env.Queries.Update(&edited); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := embeds.Run(context.Background(), token); err == nil {
+			t.Errorf("%s: token still runs the query", name)
+		}
+		logs, _ := env.Audit.GetRecent(1)
+		if len(logs) != 1 || logs[0].Mode != "embed" || logs[0].Status == "SUCCESS" {
+			t.Errorf("%s: audit entry = %+v, want a refused embed run", name, logs)
+		}
+		if err := env.Queries.Update(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var status string
+	rows, _ := env.Executor().ExecuteSQL(context.Background(), conn.ID, "SELECT status FROM orders", nil, 0)
+	if rows != nil && len(rows.Data) == 1 {
+		status = fmt.Sprint(rows.Data[0]["status"])
+	}
+	if status != "open" {
+		t.Errorf("status = %q, want the order left open", status)
+	}
+}
+
+func TestConnectRefetchesRotatedVaultSecrets(t *testing.T) {
+	env := testutil.NewMemEnv(t)
+	seed := env.CreateSQLiteConnection("seed", `CREATE TABLE t (v TEXT)`, `INSERT INTO t VALUES ('ok')`)
+	path, err := env.Crypto.Decrypt(seed.ConnectionStringEnc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first read returns a value the driver rejects, as a secret cached
+	// before a rotation would be; later reads return the rotated one
+	var reads atomic.Int32
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := "sqlite"
+		if reads.Add(1) == 1 {
+			format = "rotated-away"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"data":     map[string]interface{}{"format": format},
+			"metadata": map[string]interface{}{"version": reads.Load()},
+		}})
+	}))
+	defer vault.Close()
+
+	conn := env.CreateConnection("erp", "sqlite", path+"?_time_format=vault:secret/data/db#format")
+	executor := env.Executor()
+	executor.SetSecretResolver(service.NewSecretResolver(service.VaultConfig{Addr: vault.URL, Token: "root", CacheTTL: time.Hour}))
+	for i := 1; i <= 2; i++ {
+		result, err := executor.ExecuteSQL(context.Background(), conn.ID, "SELECT v FROM t", nil, 0)
+		if err != nil {
+			t.Fatalf("run %d = %v, want the open retried with the fresh secret", i, err)
+		}
+		if v := fmt.Sprint(result.Data[0]["v"]); v != "ok" {
+			t.Errorf("run %d = %s", i, v)
+		}
+	}
+	if n := reads.Load(); n != 2 {
+		t.Errorf("%d Vault reads, want the stale one and one refetch, cached since", n)
+	}
+}
+
+func TestSchemaDrift(t *testing.T) {
+	env := testutil.NewMemEnv(t)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER PRIMARY KEY, total REAL, note TEXT)`,
+		`INSERT INTO orders (total, note) VALUES (9.5, 'first'), (12, NULL)`)
+	q := env.CreateQuery("orders", "SELECT id, total, note FROM orders ORDER BY id", conn.ID)
+	executor := env.Executor()
+
+	result, err := executor.ExecuteSQL(service.WithSample(context.Background(), service.SampleRows), conn.ID, q.SQLText, nil, q.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := service.NewResponseSchema(result, conn.ID, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(schema.Names()); got != "[id total note]" {
+		t.Errorf("columns = %s", got)
+	}
+	if p := schema.Properties()["total"].(map[string]interface{}); p["type"] != "number" {
+		t.Errorf("total = %v, want a number", p)
+	}
+	encoded, _ := schema.Encode()
+	env.Queries.UpdateResponseSchema(q.ID, encoded)
+
+	drift := func(sqlText string) (bool, *service.ResponseSchema) {
+		t.Helper()
+		stored, _ := env.Queries.GetByID(q.ID)
+		stored.SQLText = sqlText
+		env.Queries.Update(stored)
+		result, err := executor.Execute(context.Background(), conn.ID, "orders", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, _ = env.Queries.GetByID(q.ID)
+		schema, _ := service.ParseResponseSchema(stored.ResponseSchema)
+		return slices.Contains(result.Warnings, service.WarningSchemaDrift), schema
+	}
+	if warned, schema := drift(q.SQLText); warned || schema.DriftAt != nil {
+		t.Errorf("matching columns: warning %v, drift %v", warned, schema.DriftAt)
+	}
+	if warned, schema := drift("SELECT id, note FROM orders ORDER BY id"); !warned || schema.DriftAt == nil ||
+		fmt.Sprint(schema.DriftColumns) != "[id note]" {
+		t.Errorf("dropped column: warning %v, drift %v %v", warned, schema.DriftAt, schema.DriftColumns)
+	}
+	if warned, schema := drift(q.SQLText); warned || schema.DriftAt != nil {
+		t.Errorf("columns restored: warning %v, drift %v", warned, schema.DriftAt)
+	}
+}
+
+func TestGuardrails(t *testing.T) {
+	env := testutil.NewMemEnv(t)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER PRIMARY KEY)`,
+		`INSERT INTO orders VALUES (1), (2), (3), (4), (5)`)
+	executor := env.Executor()
+	ctx := service.WithGuardrails(context.Background(), service.Guardrails{MaxRows: 3, Timeout: time.Second})
+
+	result, err := executor.ExecuteSQL(ctx, conn.ID, "SELECT id FROM orders ORDER BY id", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Data) != 3 || !result.Meta.Truncated {
+		t.Errorf("%d rows, truncated %v, want 3 truncated", len(result.Data), result.Meta.Truncated)
+	}
+
+	for _, sqlText := range []string{"DELETE FROM orders", "WITH x AS (SELECT 1) UPDATE orders SET id = id"} {
+		if _, err := executor.ExecuteSQL(ctx, conn.ID, sqlText, nil, 0); !errors.Is(err, service.ErrProtectedWrite) {
+			t.Errorf("%q = %v, want ErrProtectedWrite", sqlText, err)
+		}
+	}
+	logs, _ := env.Audit.GetRecent(1)
+	if len(logs) != 1 || logs[0].Status != "ERROR" {
+		t.Errorf("audit entry = %+v, want an ERROR run", logs)
+	}
+	result, _ = executor.ExecuteSQL(context.Background(), conn.ID, "SELECT COUNT(*) AS n FROM orders", nil, 0)
+	if n := fmt.Sprint(result.Data[0]["n"]); n != "5" {
+		t.Errorf("%s orders left, want 5", n)
+	}
+
+	// AllowWrite lets writes through, but keeps the row cap
+	ctx = service.WithGuardrails(context.Background(), service.Guardrails{MaxRows: 3, Timeout: time.Second, AllowWrite: true})
+	if _, err := executor.ExecuteSQL(ctx, conn.ID, "DELETE FROM orders WHERE id = 5", nil, 0); err != nil {
+		t.Fatalf("write allowed: %v", err)
+	}
+	result, err = executor.ExecuteSQL(ctx, conn.ID, "SELECT id FROM orders ORDER BY id", nil, 0)
+	if err != nil || len(result.Data) != 3 {
+		t.Errorf("read with writes allowed: %v, want 3 rows", err)
+	}
+}
+
+func TestHealthQuery(t *testing.T) {
+	env := testutil.NewMemEnv(t)
+	conn := env.CreateSQLiteConnection("erp", `CREATE TABLE sync_status (updated_at TEXT)`,
+		`INSERT INTO sync_status VALUES ('2020-01-01 00:00:00')`)
+	conn.HealthQuery, conn.HealthRule = "SELECT max(updated_at) FROM sync_status", "newer_than 15"
+	env.Connections.Update(conn)
+	monitor := service.NewHealthMonitor(env.Connections, env.Executor(), nil)
+
+	monitor.CheckAll(context.Background())
+	h := monitor.States()[conn.ID]
+	if h.State != service.HealthDegraded || !strings.Contains(h.Reason, "2020-01-01") {
+		t.Errorf("stale sync = %+v, want degraded", h)
+	}
+	logs, _ := env.Audit.GetRecent(1)
+	if len(logs) != 1 || logs[0].Mode != "healthcheck" {
+		t.Errorf("audit entry = %+v, want mode healthcheck", logs)
+	}
+	if counts, _ := monitor.Summary(); counts[service.HealthDegraded] != 1 || counts[service.HealthDown] != 0 {
+		t.Errorf("summary = %v", counts)
+	}
+
+	conn.HealthQuery = "SELECT datetime('now') AS synced"
+	env.Connections.Update(conn)
+	monitor.CheckAll(context.Background())
+	if h := monitor.States()[conn.ID]; h.State != service.HealthUp || h.Reason != "" {
+		t.Errorf("fresh sync = %+v, want up", h)
+	}
+
+	conn.HealthQuery = "SELECT missing FROM sync_status"
+	env.Connections.Update(conn)
+	monitor.CheckAll(context.Background())
+	if h := monitor.States()[conn.ID]; h.State != service.HealthDegraded {
+		t.Errorf("failing health query = %+v, want degraded", h)
+	}
+
+	conn.HealthQuery = ""
+	env.Connections.Update(conn)
+	monitor.CheckAll(context.Background())
+	if _, ok := monitor.States()[conn.ID]; ok {
+		t.Error("a connection no longer checked keeps its state")
+	}
+}
+
+func TestChaos(t *testing.T) {
+	env := testutil.NewMemEnv(t)
+	conn := env.CreateSQLiteConnection("erp", `CREATE TABLE orders (id INTEGER PRIMARY KEY)`)
+	conn.ShowOnStatusPage = true
+	env.Connections.Update(conn)
+	other := env.CreateSQLiteConnection("crm")
+	executor := env.Executor()
+	chaos := service.NewChaos()
+	executor.SetChaos(chaos)
+	monitor := service.NewHealthMonitor(env.Connections, executor, nil)
+
+	if err := chaos.Set(service.ChaosFault{ConnectionID: conn.ID, ErrorProbability: 1.5}); err == nil {
+		t.Error("error probability 1.5 accepted")
+	}
+
+	// Failed pings take the connection down until they run out
+	chaos.Set(service.ChaosFault{ConnectionID: conn.ID, FailPings: 2})
+	for i, want := range []string{service.HealthDown, service.HealthDown, service.HealthUp} {
+		monitor.CheckAll(context.Background())
+		if h := monitor.States()[conn.ID]; h.State != want {
+			t.Errorf("check %d = %+v, want %s", i+1, h, want)
+		}
+	}
+	if faults := chaos.Faults(); len(faults) != 1 || faults[0].FailPings != 0 {
+		t.Errorf("faults = %+v, want no pings left to fail", faults)
+	}
+
+	chaos.Set(service.ChaosFault{ConnectionID: conn.ID, ErrorProbability: 1})
+	if _, err := executor.ExecuteSQL(context.Background(), conn.ID, "SELECT id FROM orders", nil, 0); !errors.Is(err, service.ErrInjectedFault) {
+		t.Errorf("query = %v, want an injected fault", err)
+	}
+	logs, _ := env.Audit.GetRecent(1)
+	if len(logs) != 1 || logs[0].Status != "ERROR" {
+		t.Errorf("audit entry = %+v, want an ERROR run", logs)
+	}
+	if _, err := executor.ExecuteSQL(context.Background(), other.ID, "SELECT 1", nil, 0); err != nil {
+		t.Errorf("other connection = %v, want no fault", err)
+	}
+
+	// Latency beyond the timeout times the execution out
+	chaos.Set(service.ChaosFault{ConnectionID: conn.ID, LatencyMs: 200})
+	ctx := service.WithGuardrails(context.Background(), service.Guardrails{Timeout: 50 * time.Millisecond})
+	var dbErr *service.DBError
+	if _, err := executor.ExecuteSQL(ctx, conn.ID, "SELECT id FROM orders", nil, 0); !errors.As(err, &dbErr) || dbErr.Code != core.ErrClassTimeout {
+		t.Errorf("slow connection = %v, want a timeout", err)
+	}
+
+	chaos.Set(service.ChaosFault{ConnectionID: conn.ID})
+	if faults := chaos.Faults(); len(faults) != 0 {
+		t.Errorf("faults = %+v, want none after clearing", faults)
+	}
+	if _, err := executor.ExecuteSQL(context.Background(), conn.ID, "SELECT id FROM orders", nil, 0); err != nil {
+		t.Errorf("query after clearing = %v", err)
+	}
+}
@@ -0,0 +1,394 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Export job statuses
+const (
+	ExportQueued  = "queued"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+)
+
+// exportSweepInterval is how often Run deletes expired exports
+const exportSweepInterval = time.Minute
+
+var (
+	// ErrExportNotFound is an export that does not exist or has expired
+	ErrExportNotFound = errors.New("export not found")
+	// ErrExportNotReady is an export that has not finished writing its file
+	ErrExportNotReady = errors.New("export is not done")
+	// ErrExportFailed is an export that stopped without a file
+	ErrExportFailed = errors.New("export failed")
+)
+
+// ExportSpaceError is an export refused or stopped because the export files
+// would exceed the EXPORT_MAX_MB setting
+type ExportSpaceError struct {
+	LimitMB int64
+}
+
+func (e *ExportSpaceError) Error() string {
+	return fmt.Sprintf("export disk usage limit of %d MB reached, retry once older exports expire", e.LimitMB)
+}
+
+// ExportEncoder writes the rows of an export in one format. Close flushes
+// whatever it buffers, without closing the underlying writer.
+type ExportEncoder interface {
+	RowWriter
+	Close() error
+}
+
+// ExportJob is one background export of a query's full result to a gzipped
+// file
+type ExportJob struct {
+	ID         string     `json:"id"`
+	Connection string     `json:"connection"`
+	Query      string     `json:"query"`
+	Format     string     `json:"format"`
+	Status     string     `json:"status"`
+	Rows       int64      `json:"rows"`
+	Bytes      int64      `json:"bytes"` // compressed, so far
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	// ApiKeyID is the key that started the export, the only one that may
+	// download it besides admins
+	ApiKeyID int64 `json:"-"`
+
+	path   string
+	cancel context.CancelFunc
+}
+
+// FileName is the name downloads of the export are saved as
+func (j *ExportJob) FileName() string {
+	return j.Query + "." + j.Format + ".gz"
+}
+
+// exportFileName matches the files of exports in the export directory
+var exportFileName = regexp.MustCompile(`^export-[0-9a-f]{32}\.[a-z0-9]+\.gz(\.part)?$`)
+
+// ExportService runs exports in the background, a few at a time, and deletes
+// their files once they expire. Jobs are kept in memory; files left by a
+// previous run are deleted by Run.
+type ExportService struct {
+	executor  *QueryExecutor
+	dir       string
+	slots     chan struct{}
+	retention func() time.Duration
+	maxBytes  func() int64
+	timeout   func() time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*ExportJob
+	used int64 // bytes of all export files
+	wg   sync.WaitGroup
+}
+
+// NewExportService runs up to workers exports at once, writing them to dir.
+// retention, maxBytes and timeout are read when used so settings changes
+// apply to the next export.
+func NewExportService(executor *QueryExecutor, dir string, workers int, retention func() time.Duration, maxBytes func() int64, timeout func() time.Duration) *ExportService {
+	return &ExportService{
+		executor:  executor,
+		dir:       dir,
+		slots:     make(chan struct{}, max(workers, 1)),
+		retention: retention,
+		maxBytes:  maxBytes,
+		timeout:   timeout,
+		jobs:      map[string]*ExportJob{},
+	}
+}
+
+// Start queues an export of a query on the connection named connName, in
+// the format newEncoder writes. The export runs with ctx's values (API key,
+// scopes) but not its cancellation. It fails with an ExportSpaceError when
+// the export files already use up EXPORT_MAX_MB.
+func (s *ExportService) Start(ctx context.Context, connName, querySlug string, params map[string]interface{}, format string, newEncoder func(io.Writer) ExportEncoder) (*ExportJob, error) {
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return nil, fmt.Errorf("export directory: %w", err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	apiKeyID, _ := ctx.Value(core.ContextKeyApiKeyID).(int64)
+	job := &ExportJob{
+		ID:         hex.EncodeToString(id),
+		Connection: connName,
+		Query:      querySlug,
+		Format:     format,
+		Status:     ExportQueued,
+		CreatedAt:  time.Now(),
+		ApiKeyID:   apiKeyID,
+	}
+	job.path = filepath.Join(s.dir, "export-"+job.ID+"."+format+".gz")
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	job.cancel = cancel
+
+	s.mu.Lock()
+	if limit := s.maxBytes(); s.used >= limit {
+		s.mu.Unlock()
+		cancel()
+		return nil, &ExportSpaceError{LimitMB: limit >> 20}
+	}
+	s.jobs[job.ID] = job
+	snapshot := *job
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go s.run(jobCtx, job, params, newEncoder)
+	return &snapshot, nil
+}
+
+// run waits for a free slot, writes the export and records how it ended
+func (s *ExportService) run(ctx context.Context, job *ExportJob, params map[string]interface{}, newEncoder func(io.Writer) ExportEncoder) {
+	defer s.wg.Done()
+	defer job.cancel()
+	var err error
+	select {
+	case s.slots <- struct{}{}:
+		s.update(job, func(j *ExportJob) { j.Status = ExportRunning })
+		err = s.write(ctx, job, params, newEncoder)
+		<-s.slots
+	case <-ctx.Done():
+		err = ErrExecutionCancelled
+	}
+
+	now := time.Now()
+	s.update(job, func(j *ExportJob) {
+		j.FinishedAt = &now
+		j.Status = ExportDone
+		if err != nil {
+			j.Status = ExportFailed
+			j.Error = err.Error()
+			s.used -= j.Bytes
+			j.Bytes = 0
+		}
+	})
+	if err != nil {
+		logger.Error.Printf("Export %s of %s/%s failed: %v", job.ID, job.Connection, job.Query, err)
+	}
+}
+
+// write runs the query into a .part file, renamed to the job's path once the
+// export is complete
+func (s *ExportService) write(ctx context.Context, job *ExportJob, params map[string]interface{}, newEncoder func(io.Writer) ExportEncoder) error {
+	part := job.path + ".part"
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(&exportFileWriter{f: f, svc: s, job: job})
+	enc := newEncoder(gz)
+	_, err = s.executor.ExecuteByName(WithRowWriter(ctx, &exportRowCounter{enc: enc, svc: s, job: job}, s.timeout()),
+		job.Connection, job.Query, params)
+	if err == nil {
+		err = enc.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(part, job.path)
+	}
+	if err != nil {
+		os.Remove(part)
+	}
+	return err
+}
+
+// exportFileWriter writes an export file, counting its bytes against
+// EXPORT_MAX_MB
+type exportFileWriter struct {
+	f   *os.File
+	svc *ExportService
+	job *ExportJob
+}
+
+func (w *exportFileWriter) Write(p []byte) (int, error) {
+	s := w.svc
+	s.mu.Lock()
+	if limit := s.maxBytes(); s.used+int64(len(p)) > limit {
+		s.mu.Unlock()
+		return 0, &ExportSpaceError{LimitMB: limit >> 20}
+	}
+	s.used += int64(len(p))
+	w.job.Bytes += int64(len(p))
+	s.mu.Unlock()
+	return w.f.Write(p)
+}
+
+// exportRowCounter passes rows on to the encoder, counting them
+type exportRowCounter struct {
+	enc ExportEncoder
+	svc *ExportService
+	job *ExportJob
+}
+
+func (c *exportRowCounter) WriteHeader(columns, keys []string) error {
+	return c.enc.WriteHeader(columns, keys)
+}
+
+func (c *exportRowCounter) WriteRow(row map[string]interface{}) error {
+	if err := c.enc.WriteRow(row); err != nil {
+		return err
+	}
+	c.svc.update(c.job, func(j *ExportJob) { j.Rows++ })
+	return nil
+}
+
+func (s *ExportService) update(job *ExportJob, fn func(j *ExportJob)) {
+	s.mu.Lock()
+	fn(job)
+	s.mu.Unlock()
+}
+
+// Get returns a copy of the export with the given id
+func (s *ExportService) Get(id string) (*ExportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrExportNotFound
+	}
+	return s.snapshot(job), nil
+}
+
+// List returns copies of all exports, newest first
+func (s *ExportService) List() []*ExportJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]*ExportJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, s.snapshot(job))
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].CreatedAt.After(jobs[k].CreatedAt) })
+	return jobs
+}
+
+// snapshot copies job with its expiry under the current retention; s.mu must
+// be held
+func (s *ExportService) snapshot(job *ExportJob) *ExportJob {
+	c := *job
+	if c.FinishedAt != nil {
+		expires := c.FinishedAt.Add(s.retention())
+		c.ExpiresAt = &expires
+	}
+	return &c
+}
+
+// Open returns the file of a finished export and a copy of its job; the
+// caller closes the file. It fails with ErrExportNotReady while the export
+// is queued or running and with ErrExportFailed once it has failed.
+func (s *ExportService) Open(id string) (*os.File, *ExportJob, error) {
+	job, err := s.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch job.Status {
+	case ExportDone:
+	case ExportFailed:
+		return nil, job, fmt.Errorf("%w: %s", ErrExportFailed, job.Error)
+	default:
+		return nil, job, ErrExportNotReady
+	}
+	f, err := os.Open(job.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrExportNotFound
+	}
+	return f, job, err
+}
+
+// Run deletes the files of a previous run, then expired exports every
+// exportSweepInterval, until ctx is cancelled
+func (s *ExportService) Run(ctx context.Context) {
+	s.removeStrayFiles()
+	ticker := time.NewTicker(exportSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sweep(time.Now())
+		}
+	}
+}
+
+// Sweep deletes the exports that have expired at now, with their files
+func (s *ExportService) Sweep(now time.Time) {
+	retention := s.retention()
+	s.mu.Lock()
+	var expired []*ExportJob
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && !now.Before(job.FinishedAt.Add(retention)) {
+			delete(s.jobs, id)
+			s.used -= job.Bytes
+			expired = append(expired, job)
+		}
+	}
+	s.mu.Unlock()
+	for _, job := range expired {
+		if err := os.Remove(job.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Error.Printf("Export cleanup: %v", err)
+		}
+	}
+	if len(expired) > 0 {
+		logger.Info.Printf("Export cleanup: %d expired exports deleted", len(expired))
+	}
+}
+
+// removeStrayFiles deletes export files no job knows of, left by a previous
+// run whose jobs were lost with it
+func (s *ExportService) removeStrayFiles() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return // no exports yet
+	}
+	s.mu.Lock()
+	known := map[string]bool{}
+	for _, job := range s.jobs {
+		known[filepath.Base(job.path)] = true
+		known[filepath.Base(job.path)+".part"] = true
+	}
+	s.mu.Unlock()
+	for _, e := range entries {
+		if e.IsDir() || !exportFileName.MatchString(e.Name()) || known[e.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, e.Name())); err != nil {
+			logger.Error.Printf("Export cleanup: %v", err)
+		}
+	}
+}
+
+// Close cancels the running and queued exports and waits for them to stop
+func (s *ExportService) Close() {
+	s.mu.Lock()
+	for _, job := range s.jobs {
+		job.cancel()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
@@ -0,0 +1,103 @@
+package service_test
+
+import (
+	"context"
+	"dbbridge/internal/service"
+	"dbbridge/internal/testutil"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lineEncoder writes each row's id on a line
+type lineEncoder struct{ w io.Writer }
+
+func (e lineEncoder) WriteHeader(columns, keys []string) error { return nil }
+func (e lineEncoder) WriteRow(row map[string]interface{}) error {
+	_, err := fmt.Fprintln(e.w, row["id"])
+	return err
+}
+func (e lineEncoder) Close() error { return nil }
+
+func newLineEncoder(w io.Writer) service.ExportEncoder { return lineEncoder{w} }
+
+func waitExport(t *testing.T, s *service.ExportService, id string) *service.ExportJob {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		job, err := s.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == service.ExportDone || job.Status == service.ExportFailed {
+			return job
+		}
+	}
+	t.Fatal("export did not finish")
+	return nil
+}
+
+func TestExportService(t *testing.T) {
+	env := testutil.NewMemEnv(t)
+	conn := env.CreateSQLiteConnection("shop",
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY)`,
+		`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 5000) INSERT INTO orders SELECT i FROM n`)
+	env.CreateQuery("orders", "SELECT id FROM orders ORDER BY id", conn.ID)
+
+	dir := t.TempDir()
+	stray := filepath.Join(dir, "export-"+strings.Repeat("ab", 16)+".csv.gz")
+	os.WriteFile(stray, nil, 0o600)
+	retention, maxBytes := time.Hour, int64(1<<20)
+	s := service.NewExportService(env.Executor(), dir, 1,
+		func() time.Duration { return retention }, func() int64 { return maxBytes }, func() time.Duration { return time.Minute })
+	t.Cleanup(s.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Run(ctx) // only removes the files of a previous run
+	if _, err := os.Stat(stray); !os.IsNotExist(err) {
+		t.Errorf("stray export file kept: %v", err)
+	}
+
+	job, err := s.Start(context.Background(), "shop", "orders", nil, "csv", newLineEncoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job = waitExport(t, s, job.ID); job.Status != service.ExportDone || job.Rows != 5000 || job.ExpiresAt == nil {
+		t.Fatalf("export = %+v", job)
+	}
+	f, _, err := s.Open(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Expired exports are deleted with their files
+	s.Sweep(time.Now().Add(2 * time.Hour))
+	if _, err := s.Get(job.ID); !errors.Is(err, service.ErrExportNotFound) {
+		t.Errorf("expired export: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("files left after expiry: %v", entries)
+	}
+
+	// Over the disk cap an export fails and leaves no file behind
+	maxBytes = 64
+	job, err = s.Start(context.Background(), "shop", "orders", nil, "csv", newLineEncoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitExport(t, s, job.ID)
+	if job.Status != service.ExportFailed || !strings.Contains(job.Error, "disk usage limit") {
+		t.Errorf("capped export = %+v", job)
+	}
+	if _, _, err := s.Open(job.ID); !errors.Is(err, service.ErrExportFailed) {
+		t.Errorf("open failed export: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("files left after a failed export: %v", entries)
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"sync"
+	"sync/atomic"
+)
+
+// Generation counts the changes of saved queries and connections, the
+// objects the API docs are built from. The repositories returned by
+// TrackQueries and TrackConnections bump it on every successful write.
+type Generation struct {
+	n        atomic.Int64
+	mu       sync.Mutex
+	watchers []func()
+}
+
+// Current returns the number of changes so far
+func (g *Generation) Current() int64 {
+	return g.n.Load()
+}
+
+// Bump records a change and calls the watchers
+func (g *Generation) Bump() {
+	g.n.Add(1)
+	g.mu.Lock()
+	watchers := g.watchers
+	g.mu.Unlock()
+	for _, fn := range watchers {
+		fn()
+	}
+}
+
+// Watch calls fn after every change. fn runs on the writer's goroutine, so
+// it must return quickly.
+func (g *Generation) Watch(fn func()) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.watchers = append(g.watchers, fn)
+}
+
+// bump records a change when a write succeeded
+func (g *Generation) bump(err error) error {
+	if err == nil {
+		g.Bump()
+	}
+	return err
+}
+
+type trackedQueries struct {
+	core.QueryRepository
+	g *Generation
+}
+
+// TrackQueries returns repo bumping g on every successful write
+func TrackQueries(repo core.QueryRepository, g *Generation) core.QueryRepository {
+	return &trackedQueries{QueryRepository: repo, g: g}
+}
+
+func (r *trackedQueries) Create(q *core.SavedQuery) error {
+	return r.g.bump(r.QueryRepository.Create(q))
+}
+
+func (r *trackedQueries) Update(q *core.SavedQuery) error {
+	return r.g.bump(r.QueryRepository.Update(q))
+}
+
+func (r *trackedQueries) UpdateExample(id int64, example string) error {
+	return r.g.bump(r.QueryRepository.UpdateExample(id, example))
+}
+
+func (r *trackedQueries) UpdateResponseSchema(id int64, schema string) error {
+	return r.g.bump(r.QueryRepository.UpdateResponseSchema(id, schema))
+}
+
+func (r *trackedQueries) Delete(id int64) error {
+	return r.g.bump(r.QueryRepository.Delete(id))
+}
+
+func (r *trackedQueries) DeleteAlias(slug string) error {
+	return r.g.bump(r.QueryRepository.DeleteAlias(slug))
+}
+
+type trackedConnections struct {
+	core.ConnectionRepository
+	g *Generation
+}
+
+// TrackConnections returns repo bumping g on every successful write
+func TrackConnections(repo core.ConnectionRepository, g *Generation) core.ConnectionRepository {
+	return &trackedConnections{ConnectionRepository: repo, g: g}
+}
+
+func (r *trackedConnections) Create(c *core.DBConnection) error {
+	return r.g.bump(r.ConnectionRepository.Create(c))
+}
+
+func (r *trackedConnections) Update(c *core.DBConnection) error {
+	return r.g.bump(r.ConnectionRepository.Update(c))
+}
+
+func (r *trackedConnections) Delete(id int64) error {
+	return r.g.bump(r.ConnectionRepository.Delete(id))
+}
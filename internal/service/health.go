@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+// healthCheckInterval is how often the health monitor checks connections
+const healthCheckInterval = time.Minute
+
+// healthQueryTimeout bounds a connection's health query, well within
+// healthCheckInterval
+const healthQueryTimeout = 30 * time.Second
+
+// Health states of a connection
+const (
+	HealthUnknown  = "unknown" // not checked yet
+	HealthUp       = "up"
+	HealthDegraded = "degraded" // reachable, but its health query fails or breaks its rule
+	HealthDown     = "down"
+	HealthPaused   = "paused" // inactive, or blocked by maintenance mode
+)
+
+// ConnectionHealth is the last check of a connection. It only names the
+// connection: it is shown on the public status page.
+type ConnectionHealth struct {
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	CheckedAt *time.Time `json:"checked_at"` // nil until the first check
+	LatencyMs int64      `json:"latency_ms,omitempty"`
+	Reason    string     `json:"-"` // why it is down or degraded, for admins only
+}
+
+type healthCheckKey struct{}
+
+// withHealthCheck marks executions under ctx as health queries, audited with
+// mode "healthcheck" and left out of the usage statistics
+func withHealthCheck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, healthCheckKey{}, true)
+}
+
+// HealthMonitor checks the connections shown on the status page or having a
+// health query every healthCheckInterval and keeps their last state in
+// memory. A connection that answers its ping is then up, unless its health
+// query fails or breaks its rule (see HealthRule), which makes it degraded.
+// Check errors are logged, never published.
+type HealthMonitor struct {
+	connRepo core.ConnectionRepository
+	executor *QueryExecutor
+	settings *SettingsService // maintenance mode, nil = never
+	mailer   *Mailer          // nil = no notifications
+
+	mu     sync.RWMutex
+	states map[int64]ConnectionHealth
+}
+
+func NewHealthMonitor(connRepo core.ConnectionRepository, executor *QueryExecutor, settings *SettingsService) *HealthMonitor {
+	return &HealthMonitor{connRepo: connRepo, executor: executor, settings: settings, states: make(map[int64]ConnectionHealth)}
+}
+
+// SetMailer notifies connections going down or degraded, and recovering
+func (m *HealthMonitor) SetMailer(mailer *Mailer) {
+	m.mailer = mailer
+}
+
+// Run checks the connections at once and then every healthCheckInterval,
+// until ctx is cancelled
+func (m *HealthMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		m.CheckAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll checks every active connection shown on the status page or
+// having a health query
+func (m *HealthMonitor) CheckAll(ctx context.Context) {
+	conns, err := m.connRepo.GetAll()
+	if err != nil {
+		logger.Error.Printf("Health check: %v", err)
+		return
+	}
+	for _, c := range conns {
+		if !c.ShowOnStatusPage && c.HealthQuery == "" {
+			m.mu.Lock()
+			delete(m.states, c.ID) // no longer checked
+			m.mu.Unlock()
+			continue
+		}
+		if !c.IsActive || m.blocked(c.Name) {
+			continue
+		}
+		h := m.check(ctx, &c)
+		if ctx.Err() != nil {
+			return
+		}
+		m.mu.Lock()
+		prev, checked := m.states[c.ID]
+		m.states[c.ID] = h
+		m.mu.Unlock()
+		if h.State != prev.State && (checked || h.State != HealthUp) {
+			m.notify(h)
+		}
+	}
+}
+
+// check pings a connection and runs its health query
+func (m *HealthMonitor) check(ctx context.Context, c *core.DBConnection) ConnectionHealth {
+	start := time.Now()
+	err := m.executor.CheckConnection(ctx, c.ID)
+	now := time.Now()
+	h := ConnectionHealth{Name: c.Name, State: HealthUp, CheckedAt: &now, LatencyMs: now.Sub(start).Milliseconds()}
+	if err != nil {
+		logger.Info.Printf("Health check of connection %s failed: %v", c.Name, err)
+		h.State, h.LatencyMs, h.Reason = HealthDown, 0, ErrorDetail(err)
+		return h
+	}
+	if c.HealthQuery == "" {
+		return h
+	}
+
+	rule, err := ParseHealthRule(c.HealthRule)
+	if err == nil {
+		// Health queries only read, and only their first row matters
+		qctx := WithGuardrails(withHealthCheck(ctx), Guardrails{MaxRows: 1, Timeout: healthQueryTimeout})
+		var result *ExecutionResult
+		if result, err = m.executor.ExecuteSQL(qctx, c.ID, c.HealthQuery, nil, 0); err == nil {
+			err = rule.Check(result, time.Now())
+		}
+	}
+	if err != nil {
+		logger.Info.Printf("Health query of connection %s: %v", c.Name, err)
+		h.State, h.Reason = HealthDegraded, ErrorDetail(err)
+	}
+	return h
+}
+
+// notify mails a connection's new state
+func (m *HealthMonitor) notify(h ConnectionHealth) {
+	if m.mailer == nil {
+		return
+	}
+	switch h.State {
+	case HealthDown:
+		m.mailer.Notify(MailEventConnectionDown, map[string]interface{}{"Connection": h.Name, "Error": h.Reason})
+	case HealthDegraded:
+		m.mailer.Notify(MailEventConnectionDegraded, map[string]interface{}{"Connection": h.Name, "Reason": h.Reason})
+	case HealthUp:
+		m.mailer.Notify(MailEventConnectionUp, map[string]interface{}{"Connection": h.Name})
+	}
+}
+
+func (m *HealthMonitor) blocked(connName string) bool {
+	return m.settings != nil && m.settings.Maintenance().Blocks(connName)
+}
+
+// Status lists the connections shown on the status page, by name, with
+// their last check
+func (m *HealthMonitor) Status() ([]ConnectionHealth, error) {
+	conns, err := m.connRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := []ConnectionHealth{}
+	for _, c := range conns {
+		if !c.ShowOnStatusPage {
+			continue
+		}
+		h, ok := m.states[c.ID]
+		if !ok {
+			h = ConnectionHealth{State: HealthUnknown}
+		}
+		h.Name = c.Name
+		if !c.IsActive || m.blocked(c.Name) {
+			h.State, h.LatencyMs = HealthPaused, 0
+		}
+		list = append(list, h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// States returns the last check of the connections the monitor checks, by
+// connection id, reasons included: for admin pages only
+func (m *HealthMonitor) States() map[int64]ConnectionHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	states := make(map[int64]ConnectionHealth, len(m.states))
+	for id, h := range m.states {
+		states[id] = h
+	}
+	return states
+}
+
+// Summary counts the active connections checked by state, without naming
+// them
+func (m *HealthMonitor) Summary() (map[string]int, error) {
+	conns, err := m.connRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := map[string]int{HealthUp: 0, HealthDegraded: 0, HealthDown: 0}
+	for _, c := range conns {
+		if h, ok := m.states[c.ID]; ok && c.IsActive && !m.blocked(c.Name) {
+			counts[h.State]++
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of health rules, see HealthRule
+const (
+	HealthRuleNonEmpty  = "non_empty"  // at least one row
+	HealthRuleNewerThan = "newer_than" // the first value is a time at most Value minutes old
+	HealthRuleAtLeast   = "at_least"   // the first value is a number of at least Value
+	HealthRuleAtMost    = "at_most"    // the first value is a number of at most Value
+)
+
+// healthTimeLayouts are the text forms of times a health query may return.
+// Text without a zone is read as UTC.
+var healthTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	time.DateOnly,
+}
+
+// HealthRule is what a connection's health query must return for the
+// connection to be up rather than degraded. It is stored as its kind,
+// followed by its value for the kinds that have one:
+//
+//	non_empty
+//	newer_than 15
+//	at_most 500
+//
+// The first value is the first column of the first row.
+type HealthRule struct {
+	Kind  string
+	Value float64
+}
+
+// ParseHealthRule reads a connection's health rule. Empty is non_empty.
+func ParseHealthRule(s string) (HealthRule, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return HealthRule{Kind: HealthRuleNonEmpty}, nil
+	}
+	rule := HealthRule{Kind: fields[0]}
+	switch rule.Kind {
+	case HealthRuleNonEmpty:
+		if len(fields) > 1 {
+			return rule, fmt.Errorf("invalid health rule: %s takes no value", rule.Kind)
+		}
+		return rule, nil
+	case HealthRuleNewerThan, HealthRuleAtLeast, HealthRuleAtMost:
+	default:
+		return rule, fmt.Errorf("invalid health rule: unknown kind %q", rule.Kind)
+	}
+	if len(fields) != 2 {
+		return rule, fmt.Errorf("invalid health rule: %s needs one value", rule.Kind)
+	}
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return rule, fmt.Errorf("invalid health rule: %q is not a number", fields[1])
+	}
+	if rule.Kind == HealthRuleNewerThan && v <= 0 {
+		return rule, fmt.Errorf("invalid health rule: %s needs a positive number of minutes", rule.Kind)
+	}
+	rule.Value = v
+	return rule, nil
+}
+
+func (r HealthRule) String() string {
+	if r.Kind == HealthRuleNonEmpty {
+		return r.Kind
+	}
+	return r.Kind + " " + strconv.FormatFloat(r.Value, 'f', -1, 64)
+}
+
+// Check returns why result breaks the rule at now, nil when it meets it
+func (r HealthRule) Check(result *ExecutionResult, now time.Time) error {
+	if len(result.Data) == 0 {
+		return fmt.Errorf("the health query returned no rows")
+	}
+	if r.Kind == HealthRuleNonEmpty {
+		return nil
+	}
+	var v interface{}
+	if keys := result.Meta.RowKeys(); len(keys) > 0 {
+		v = result.Data[0][keys[0]]
+	}
+	if v == nil {
+		return fmt.Errorf("the health query returned NULL")
+	}
+
+	if r.Kind == HealthRuleNewerThan {
+		t, ok := healthTime(v)
+		if !ok {
+			return fmt.Errorf("the health query returned %v, not a time", v)
+		}
+		limit := time.Duration(r.Value * float64(time.Minute))
+		if age := now.Sub(t); age > limit {
+			return fmt.Errorf("the latest time %s is %s old, more than %s", t.UTC().Format(time.RFC3339), age.Round(time.Second), limit)
+		}
+		return nil
+	}
+	n, ok := healthNumber(v)
+	if !ok {
+		return fmt.Errorf("the health query returned %v, not a number", v)
+	}
+	if r.Kind == HealthRuleAtLeast && n < r.Value {
+		return fmt.Errorf("the health query returned %v, less than %v", n, r.Value)
+	}
+	if r.Kind == HealthRuleAtMost && n > r.Value {
+		return fmt.Errorf("the health query returned %v, more than %v", n, r.Value)
+	}
+	return nil
+}
+
+// healthTime reads a value returned by a health query as a time
+func healthTime(v interface{}) (time.Time, bool) {
+	var s string
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return time.Time{}, false
+	}
+	for _, layout := range healthTimeLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// healthNumber reads a value returned by a health query as a number
+func healthNumber(v interface{}) (float64, bool) {
+	var s string
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return n, err == nil
+}
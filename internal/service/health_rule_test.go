@@ -0,0 +1,63 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseHealthRule(t *testing.T) {
+	for _, s := range []string{"", "non_empty", "newer_than 15", "at_least 0.5", "at_most -3"} {
+		rule, err := ParseHealthRule(s)
+		if err != nil {
+			t.Errorf("ParseHealthRule(%q) = %v", s, err)
+			continue
+		}
+		want := s
+		if s == "" {
+			want = HealthRuleNonEmpty
+		}
+		if rule.String() != want {
+			t.Errorf("ParseHealthRule(%q).String() = %q", s, rule.String())
+		}
+	}
+	for _, s := range []string{"newer_than", "newer_than 0", "at_most x", "non_empty 3", "fresh 5", "at_least 1 2"} {
+		if _, err := ParseHealthRule(s); err == nil {
+			t.Errorf("ParseHealthRule(%q) accepted", s)
+		}
+	}
+}
+
+func TestHealthRuleCheck(t *testing.T) {
+	now := time.Date(2026, 5, 6, 12, 0, 0, 0, time.UTC)
+	result := func(v interface{}) *ExecutionResult {
+		return &ExecutionResult{Data: []map[string]interface{}{{"v": v, "other": 0}}, Meta: MetaInfo{Columns: []string{"v", "other"}}}
+	}
+	tests := []struct {
+		rule   string
+		result *ExecutionResult
+		ok     bool
+	}{
+		{"non_empty", result(nil), true},
+		{"non_empty", &ExecutionResult{}, false},
+		{"newer_than 15", result(now.Add(-10 * time.Minute)), true},
+		{"newer_than 15", result(now.Add(-20 * time.Minute)), false},
+		{"newer_than 15", result("2026-05-06 11:50:00"), true},
+		{"newer_than 15", result([]byte("2026-05-06T13:40:00+02:00")), false},
+		{"newer_than 15", result("yesterday"), false},
+		{"newer_than 15", result(nil), false},
+		{"at_least 100", result(int64(150)), true},
+		{"at_least 100", result("99.5"), false},
+		{"at_most 5", result(3.5), true},
+		{"at_most 5", result(int64(6)), false},
+		{"at_most 5", result(true), false},
+	}
+	for _, tt := range tests {
+		rule, err := ParseHealthRule(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rule.Check(tt.result, now); (err == nil) != tt.ok {
+			t.Errorf("%s on %v = %v, want ok %v", tt.rule, tt.result.Data, err, tt.ok)
+		}
+	}
+}
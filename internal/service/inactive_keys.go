@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"time"
+)
+
+const inactiveKeyInterval = 24 * time.Hour
+
+// InactiveKeyJanitor disables the API keys not used for a number of days,
+// counted from their core.ApiKey.LastActivity. Each disabled key is audited
+// and the recipients of email notifications get the list; admins re-enable
+// keys from the API keys page.
+type InactiveKeyJanitor struct {
+	repo      core.ApiKeyRepository
+	auditRepo core.AuditRepository
+	mailer    *Mailer     // nil = no notification
+	enabled   func() bool // read at every tick
+	days      func() int
+}
+
+func NewInactiveKeyJanitor(repo core.ApiKeyRepository, auditRepo core.AuditRepository, enabled func() bool, days func() int) *InactiveKeyJanitor {
+	return &InactiveKeyJanitor{repo: repo, auditRepo: auditRepo, enabled: enabled, days: days}
+}
+
+// SetMailer sends the list of disabled keys as the api_keys_disabled
+// notification
+func (j *InactiveKeyJanitor) SetMailer(m *Mailer) {
+	j.mailer = m
+}
+
+// Disable disables the active keys last active before the threshold ahead
+// of now and returns them
+func (j *InactiveKeyJanitor) Disable(now time.Time) ([]core.ApiKey, error) {
+	keys, err := j.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	days := j.days()
+	cutoff := now.AddDate(0, 0, -days)
+	auditor := NewAdminAuditor(j.auditRepo)
+	var disabled []core.ApiKey
+	for _, k := range keys {
+		if !k.IsActive || !k.LastActivity().Before(cutoff) {
+			continue
+		}
+		if err = j.repo.DisableInactive(k.ID); err != nil {
+			break
+		}
+		auditor.Record(AdminEvent{Type: core.EventAPIKeyAutoDisable, Target: "api key " + k.KeyPrefix + "...",
+			Changes: AuditChanges{"is_active": {Old: true, New: false}}})
+		disabled = append(disabled, k)
+	}
+	if len(disabled) > 0 && j.mailer != nil {
+		list := make([]map[string]interface{}, len(disabled))
+		for i, k := range disabled {
+			list[i] = map[string]interface{}{
+				"KeyPrefix":    k.KeyPrefix,
+				"Description":  k.Description,
+				"LastActivity": k.LastActivity().Format("2006-01-02"),
+			}
+		}
+		j.mailer.Notify(MailEventApiKeysDisabled, map[string]interface{}{"Count": len(disabled), "Days": days, "Keys": list})
+	}
+	return disabled, err
+}
+
+// Run disables inactive keys now and then every inactiveKeyInterval while
+// enabled, until ctx is cancelled
+func (j *InactiveKeyJanitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(inactiveKeyInterval)
+	defer ticker.Stop()
+	for {
+		if j.enabled() {
+			disabled, err := j.Disable(time.Now())
+			if err != nil {
+				logger.Error.Printf("Inactive API keys: %v", err)
+			}
+			if len(disabled) > 0 {
+				logger.Info.Printf("Inactive API keys: disabled %d keys unused for %d days", len(disabled), j.days())
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/data/memory"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInactiveKeyJanitor(t *testing.T) {
+	now := time.Now()
+	daysAgo := func(d int) *time.Time {
+		t := now.AddDate(0, 0, -d)
+		return &t
+	}
+	repo := &memory.APIKeys{}
+	for _, k := range []core.ApiKey{
+		{KeyPrefix: "recent01", CreatedAt: *daysAgo(200), LastUsedAt: daysAgo(3), IsActive: true},
+		{KeyPrefix: "unused01", Description: "old batch job", CreatedAt: *daysAgo(120), IsActive: true},
+		{KeyPrefix: "unused02", CreatedAt: *daysAgo(300), LastUsedAt: daysAgo(95), IsActive: true},
+		{KeyPrefix: "newkey01", CreatedAt: *daysAgo(10), IsActive: true},
+		{KeyPrefix: "revoked1", CreatedAt: *daysAgo(300), IsActive: false},
+		{KeyPrefix: "reenabl1", CreatedAt: *daysAgo(300), ReenabledAt: daysAgo(20), IsActive: true},
+	} {
+		repo.Create(&k)
+	}
+	audit := &memory.Audit{}
+	mailer := NewMailer(MailerConfig{Host: "smtp.invalid", To: []string{"security@example.com"}})
+	j := NewInactiveKeyJanitor(repo, audit, func() bool { return true }, func() int { return 90 })
+	j.SetMailer(mailer)
+
+	disabled, err := j.Disable(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prefixes []string
+	for _, k := range disabled {
+		prefixes = append(prefixes, k.KeyPrefix)
+	}
+	if got := strings.Join(prefixes, ","); got != "unused02,unused01" {
+		t.Fatalf("disabled %s, want the two keys unused for 90 days", got)
+	}
+
+	keys, _ := repo.List()
+	for _, k := range keys {
+		want := k.KeyPrefix == "unused01" || k.KeyPrefix == "unused02"
+		if k.AutoDisabled() != want {
+			t.Errorf("%s: auto-disabled = %v", k.KeyPrefix, k.AutoDisabled())
+		}
+		if k.KeyPrefix == "revoked1" && k.DisabledReason != "" {
+			t.Errorf("revoked key marked %q", k.DisabledReason)
+		}
+	}
+	if logs := audit.Logs(); len(logs) != 2 || logs[0].EventType != core.EventAPIKeyAutoDisable {
+		t.Errorf("audit = %+v, want one auto_disable per key", logs)
+	}
+	if len(mailer.queue) != 1 {
+		t.Fatalf("queued %d notifications, want 1", len(mailer.queue))
+	}
+	msg := <-mailer.queue
+	if !strings.Contains(msg.subject, "2 unused API keys") || !strings.Contains(msg.body, "unused01... (old batch job)") {
+		t.Errorf("notification %q: %q", msg.subject, msg.body)
+	}
+
+	// Re-enabling restarts the inactivity clock
+	id := disabled[1].ID
+	if err := repo.Reenable(id); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := j.Disable(now); len(again) != 0 {
+		t.Errorf("disabled %+v again right after re-enabling", again)
+	}
+	if again, _ := j.Disable(now.AddDate(0, 0, 91)); len(again) != 4 {
+		t.Errorf("91 days later disabled %d keys, want every active key", len(again))
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"fmt"
+	"time"
+)
+
+// WarningDeprecated flags an execution of a deprecated query
+const WarningDeprecated = "deprecated"
+
+// SunsetError is an execution of a query past its sunset date
+type SunsetError struct {
+	Slug         string
+	SunsetAt     time.Time
+	SupersededBy string // slug of the replacement, "" for none
+	Message      string // the query's sunset message, "" for the default
+}
+
+func (e *SunsetError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	msg := fmt.Sprintf("query %s was retired on %s", e.Slug, e.SunsetAt.Format(time.DateOnly))
+	if e.SupersededBy != "" {
+		msg += "; use " + e.SupersededBy + " instead"
+	}
+	return msg
+}
+
+// QueryLifecycle is the deprecation of a saved query, as announced to API
+// consumers
+type QueryLifecycle struct {
+	State        string // core.LifecycleDeprecated or core.LifecycleSunset
+	DeprecatedAt *time.Time
+	SunsetAt     *time.Time
+	SupersededBy string
+}
+
+// Lifecycle returns the deprecation of the saved query querySlug at now, nil
+// while it is current. An old slug of a renamed query is deprecated since the
+// rename and superseded by the current slug, unless SLUG_ALIAS_DEPRECATION is
+// off.
+func (e *QueryExecutor) Lifecycle(querySlug string, now time.Time) (*QueryLifecycle, error) {
+	q, err := e.queryRepo.GetBySlug(querySlug)
+	if err != nil {
+		return nil, fmt.Errorf("query not found: %w", err)
+	}
+	l := &QueryLifecycle{State: q.Lifecycle(now), DeprecatedAt: q.DeprecatedAt, SunsetAt: q.SunsetAt, SupersededBy: q.SupersededBy}
+	if e.aliasDeprecated(q, querySlug) {
+		if l.State == core.LifecycleCurrent {
+			l.State, l.DeprecatedAt = core.LifecycleDeprecated, e.aliasCreatedAt(q.ID, querySlug)
+		}
+		if l.SupersededBy == "" {
+			l.SupersededBy = q.Slug
+		}
+	}
+	if l.State == core.LifecycleCurrent {
+		return nil, nil
+	}
+	return l, nil
+}
+
+// aliasDeprecated reports a query q reached by one of its old slugs, with
+// SLUG_ALIAS_DEPRECATION on
+func (e *QueryExecutor) aliasDeprecated(q *core.SavedQuery, querySlug string) bool {
+	return q.Slug != querySlug && (e.settings == nil || e.settings.Get("SLUG_ALIAS_DEPRECATION") != "false")
+}
+
+// aliasCreatedAt returns when the query queryID was renamed away from slug,
+// nil if unknown
+func (e *QueryExecutor) aliasCreatedAt(queryID int64, slug string) *time.Time {
+	aliases, _ := e.queryRepo.ListAliases(queryID)
+	for _, a := range aliases {
+		if a.Slug == slug {
+			return &a.CreatedAt
+		}
+	}
+	return nil
+}
+
+// checkSunset refuses q once its sunset date has passed. Admin test runs
+// by SQL are not checked.
+func checkSunset(q *core.SavedQuery, now time.Time) error {
+	if q.Lifecycle(now) != core.LifecycleSunset {
+		return nil
+	}
+	return &SunsetError{Slug: q.Slug, SunsetAt: *q.SunsetAt, SupersededBy: q.SupersededBy, Message: q.SunsetMessage}
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"dbbridge/internal/i18n"
+	"dbbridge/internal/logger"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// MailEvent identifies a kind of notification. Throttling is applied per
+// event and connection, see Notify.
+type MailEvent string
+
+const (
+	MailEventConnectionDown     MailEvent = "connection_down"
+	MailEventConnectionUp       MailEvent = "connection_up"
+	MailEventConnectionDegraded MailEvent = "connection_degraded"
+	MailEventApiKeysDisabled    MailEvent = "api_keys_disabled"
+	MailEventWarnDigest         MailEvent = "warn_digest"
+	mailEventTest               MailEvent = "test"
+)
+
+const (
+	mailQueueSize = 100
+	mailTimeout   = 15 * time.Second
+)
+
+// mailRetryDelays are the waits before the 2nd, 3rd and 4th delivery attempt
+var mailRetryDelays = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute}
+
+type mailTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+func newMailTemplate(subject, body string) mailTemplate {
+	return mailTemplate{
+		subject: template.Must(template.New("subject").Parse(subject)),
+		body:    template.Must(template.New("body").Parse(body)),
+	}
+}
+
+// mailEvents lists the events with a message, the catalog keys being
+// mail.<event>.subject and mail.<event>.body
+var mailEvents = []MailEvent{
+	MailEventConnectionDown, MailEventConnectionUp, MailEventConnectionDegraded,
+	MailEventApiKeysDisabled, MailEventWarnDigest, mailEventTest,
+}
+
+// mailTemplates render the data passed to Notify, per locale. Every message
+// also gets .Host and .Time.
+var mailTemplates = loadMailTemplates()
+
+func loadMailTemplates() map[string]map[MailEvent]mailTemplate {
+	templates := make(map[string]map[MailEvent]mailTemplate)
+	for _, locale := range i18n.Locales() {
+		templates[locale] = make(map[MailEvent]mailTemplate, len(mailEvents))
+		for _, event := range mailEvents {
+			key := "mail." + string(event)
+			templates[locale][event] = newMailTemplate(i18n.T(locale, key+".subject"), i18n.T(locale, key+".body"))
+		}
+	}
+	return templates
+}
+
+// MailerConfig is the SMTP setup, swapped on config reload
+type MailerConfig struct {
+	Host     string
+	Port     int
+	TLSMode  string // starttls, tls or none
+	Username string
+	Password string
+	From     string
+	To       []string
+	Throttle time.Duration
+	Locale   string // language of the messages, see i18n
+}
+
+// Enabled reports whether notifications can be sent
+func (c MailerConfig) Enabled() bool {
+	return c.Host != "" && len(c.To) > 0
+}
+
+type mailMessage struct {
+	event   MailEvent
+	to      []string
+	subject string
+	body    string
+}
+
+// Mailer sends templated notification emails in the background with retries.
+// Events of the same type about the same connection within the throttle
+// window are suppressed so a flapping connection cannot flood the operators'
+// inboxes, while an outage of another connection is still reported.
+type Mailer struct {
+	config   atomic.Pointer[MailerConfig]
+	queue    chan mailMessage
+	hostname string
+
+	mu         sync.Mutex
+	lastSent   map[string]time.Time // by throttleKey
+	suppressed map[string]int
+}
+
+func NewMailer(cfg MailerConfig) *Mailer {
+	hostname, _ := os.Hostname()
+	m := &Mailer{
+		queue:      make(chan mailMessage, mailQueueSize),
+		hostname:   hostname,
+		lastSent:   make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+	m.Configure(cfg)
+	return m
+}
+
+// Configure replaces the SMTP setup, used at startup and on config reload
+func (m *Mailer) Configure(cfg MailerConfig) {
+	m.config.Store(&cfg)
+}
+
+func (m *Mailer) Config() MailerConfig {
+	return *m.config.Load()
+}
+
+// Notify queues a notification for the configured recipients. It never blocks:
+// when notifications are disabled, throttled or the queue is full the event is
+// skipped. Events with a "Connection" in data are throttled per connection.
+func (m *Mailer) Notify(event MailEvent, data map[string]interface{}) {
+	cfg := m.Config()
+	if !cfg.Enabled() {
+		return
+	}
+
+	key := throttleKey(event, data)
+	m.mu.Lock()
+	if last, ok := m.lastSent[key]; ok && time.Since(last) < cfg.Throttle {
+		m.suppressed[key]++
+		m.mu.Unlock()
+		return
+	}
+	m.lastSent[key] = time.Now()
+	suppressed := m.suppressed[key]
+	m.suppressed[key] = 0
+	m.mu.Unlock()
+
+	msg, err := m.render(cfg.Locale, event, data, cfg.To)
+	if err != nil {
+		logger.Error.Printf("Mailer: failed to render %s notification: %v", event, err)
+		return
+	}
+	if suppressed > 0 {
+		msg.body += "\n" + i18n.T(cfg.Locale, "mail.suppressed", suppressed) + "\n"
+	}
+
+	select {
+	case m.queue <- msg:
+	default:
+		logger.Error.Printf("Mailer: queue full, dropping %s notification", event)
+	}
+}
+
+func throttleKey(event MailEvent, data map[string]interface{}) string {
+	if conn, ok := data["Connection"]; ok {
+		return fmt.Sprintf("%s:%v", event, conn)
+	}
+	return string(event)
+}
+
+// SendTest sends a test email synchronously (no throttle, no retries) so the
+// settings page can show the SMTP error directly
+func (m *Mailer) SendTest(to []string) error {
+	cfg := m.Config()
+	if cfg.Host == "" {
+		return errors.New("SMTP_HOST is not configured")
+	}
+	if len(to) == 0 {
+		return errors.New("no recipient given")
+	}
+	msg, err := m.render(cfg.Locale, mailEventTest, nil, to)
+	if err != nil {
+		return err
+	}
+	return m.send(cfg, msg)
+}
+
+// Run delivers queued notifications until ctx is cancelled
+func (m *Mailer) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-m.queue:
+			m.deliver(ctx, msg)
+		}
+	}
+}
+
+func (m *Mailer) deliver(ctx context.Context, msg mailMessage) {
+	for attempt := 0; ; attempt++ {
+		// Re-read the config so a fix applied via reload is used by the retry
+		err := m.send(m.Config(), msg)
+		if err == nil {
+			return
+		}
+		if attempt >= len(mailRetryDelays) {
+			logger.Error.Printf("Mailer: giving up on %s notification after %d attempts: %v", msg.event, attempt+1, err)
+			return
+		}
+		logger.Error.Printf("Mailer: %s notification failed, retrying in %s: %v", msg.event, mailRetryDelays[attempt], err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(mailRetryDelays[attempt]):
+		}
+	}
+}
+
+func (m *Mailer) render(locale string, event MailEvent, data map[string]interface{}, to []string) (mailMessage, error) {
+	if i18n.Normalize(locale) == "" {
+		locale = i18n.DefaultLocale
+	}
+	tmpl, ok := mailTemplates[i18n.Normalize(locale)][event]
+	if !ok {
+		return mailMessage{}, fmt.Errorf("no template for event %q", event)
+	}
+
+	vars := map[string]interface{}{
+		"Host": m.hostname,
+		"Time": time.Now().Format("2006-01-02 15:04:05 MST"),
+	}
+	for k, v := range data {
+		vars[k] = v
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, vars); err != nil {
+		return mailMessage{}, err
+	}
+	if err := tmpl.body.Execute(&body, vars); err != nil {
+		return mailMessage{}, err
+	}
+	return mailMessage{event: event, to: to, subject: subject.String(), body: body.String()}, nil
+}
+
+func (m *Mailer) send(cfg MailerConfig, msg mailMessage) error {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	dialer := &net.Dialer{Timeout: mailTimeout}
+
+	var conn net.Conn
+	var err error
+	if cfg.TLSMode == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: cfg.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(mailTimeout))
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if cfg.TLSMode == "starttls" {
+		if err := c.StartTLS(&tls.Config{ServerName: cfg.Host}); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	if err := c.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, rcpt := range msg.to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMessage(cfg.From, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// buildMessage formats a plain text RFC 5322 message
+func buildMessage(from string, msg mailMessage) []byte {
+	id := make([]byte, 12)
+	rand.Read(id)
+	domain := "dbbridge.local"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mimeHeader(msg.subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// mimeHeader encodes non-ASCII header values and strips line breaks
+func mimeHeader(s string) string {
+	s = strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+	for _, r := range s {
+		if r > 127 {
+			return mime.QEncoding.Encode("utf-8", s)
+		}
+	}
+	return s
+}
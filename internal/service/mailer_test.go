@@ -0,0 +1,36 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMailer_ThrottlesPerEventAndConnection(t *testing.T) {
+	m := NewMailer(MailerConfig{Host: "smtp.invalid", To: []string{"ops@example.com"}, Throttle: time.Hour})
+
+	data := map[string]interface{}{"Connection": "erp", "Error": "timeout"}
+	m.Notify(MailEventConnectionDown, data)
+	m.Notify(MailEventConnectionDown, data)                                                            // throttled
+	m.Notify(MailEventConnectionUp, data)                                                              // different type, not throttled
+	m.Notify(MailEventConnectionDown, map[string]interface{}{"Connection": "crm", "Error": "refused"}) // another connection
+
+	if got := len(m.queue); got != 3 {
+		t.Fatalf("queued %d messages, want 3", got)
+	}
+	msg := <-m.queue
+	if msg.subject != "[DbBridge] Connection erp is DOWN" {
+		t.Errorf("subject = %q", msg.subject)
+	}
+	if !strings.Contains(msg.body, "Error: timeout") {
+		t.Errorf("body missing error: %q", msg.body)
+	}
+}
+
+func TestMailer_DisabledWithoutRecipients(t *testing.T) {
+	m := NewMailer(MailerConfig{Host: "smtp.invalid"})
+	m.Notify(MailEventWarnDigest, nil)
+	if got := len(m.queue); got != 0 {
+		t.Errorf("queued %d messages while disabled, want 0", got)
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MaintenanceState is the maintenance switch as stored in the runtime
+// settings, so it survives restarts and is shared by all instances
+type MaintenanceState struct {
+	Active      bool
+	Message     string
+	RetryAfter  int      // seconds, sent as Retry-After
+	Connections []string // connection names, empty = all
+}
+
+// Maintenance returns the current maintenance state
+func (s *SettingsService) Maintenance() MaintenanceState {
+	return MaintenanceState{
+		Active:      s.Get("MAINTENANCE_MODE") == "true",
+		Message:     s.Get("MAINTENANCE_MESSAGE"),
+		RetryAfter:  s.Int("MAINTENANCE_RETRY_AFTER"),
+		Connections: s.List("MAINTENANCE_CONNECTIONS"),
+	}
+}
+
+// SetMaintenance switches maintenance mode on or off, audited like any other
+// settings change
+func (s *SettingsService) SetMaintenance(userID int64, on bool) error {
+	return s.Update(userID, []SettingChange{{Key: "MAINTENANCE_MODE", Value: strconv.FormatBool(on)}})
+}
+
+// Blocks reports whether executions on connection connName are refused
+func (m MaintenanceState) Blocks(connName string) bool {
+	if !m.Active {
+		return false
+	}
+	if len(m.Connections) == 0 {
+		return true
+	}
+	for _, c := range m.Connections {
+		if strings.EqualFold(c, connName) {
+			return true
+		}
+	}
+	return false
+}
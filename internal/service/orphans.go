@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const orphanCleanupInterval = 7 * 24 * time.Hour
+
+// OrphanJanitor reports and cleans rows left pointing at deleted users,
+// queries, connections and API keys by deletes that did not cascade
+type OrphanJanitor struct {
+	repo      core.OrphanRepository
+	auditRepo core.AuditRepository
+	enabled   func() bool // the weekly cleanup, read at every tick
+}
+
+func NewOrphanJanitor(repo core.OrphanRepository, auditRepo core.AuditRepository, enabled func() bool) *OrphanJanitor {
+	return &OrphanJanitor{repo: repo, auditRepo: auditRepo, enabled: enabled}
+}
+
+// Report counts the orphaned rows of each category
+func (j *OrphanJanitor) Report() ([]core.OrphanCount, error) {
+	return j.repo.CountOrphans()
+}
+
+// Clean fixes the orphaned rows, or with dryRun only reports what it would
+// fix. A cleanup that changed rows is audited as an admin event of userID, 0
+// for the weekly task.
+func (j *OrphanJanitor) Clean(userID int64, dryRun bool) ([]core.OrphanCount, error) {
+	counts, err := j.repo.CleanOrphans(dryRun)
+	if err != nil || dryRun {
+		return counts, err
+	}
+	changes := AuditChanges{}
+	for _, c := range counts {
+		if c.Count > 0 {
+			changes[c.Category] = FieldChange{Old: c.Count, New: 0}
+		}
+	}
+	if len(changes) > 0 {
+		NewAdminAuditor(j.auditRepo).Record(AdminEvent{Type: core.EventOrphanCleanup, UserID: userID, Target: "orphaned rows", Changes: changes})
+	}
+	return counts, nil
+}
+
+// Run cleans the orphaned rows every orphanCleanupInterval while enabled,
+// until ctx is cancelled
+func (j *OrphanJanitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(orphanCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !j.enabled() {
+				continue
+			}
+			counts, err := j.Clean(0, false)
+			if err != nil {
+				logger.Error.Printf("Orphan cleanup: %v", err)
+				continue
+			}
+			logger.Info.Printf("Orphan cleanup: %s", OrphanSummary(counts))
+		}
+	}
+}
+
+// OrphanSummary describes the result of a cleanup in one line
+func OrphanSummary(counts []core.OrphanCount) string {
+	var parts []string
+	for _, c := range counts {
+		if c.Count > 0 {
+			parts = append(parts, strconv.FormatInt(c.Count, 10)+" "+strings.ToLower(c.Description[:1])+c.Description[1:]+" "+c.Action)
+		}
+	}
+	if len(parts) == 0 {
+		return "nothing to clean"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/data"
+	"path/filepath"
+	"testing"
+)
+
+func TestOrphanJanitorClean(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, stmt := range []string{
+		`INSERT INTO users (id, username, password_hash) VALUES (1, 'admin', 'x')`,
+		`INSERT INTO api_keys (id, user_id, key_prefix, key_hash) VALUES (1, 1, 'a', 'h1'), (2, 99, 'b', 'h2')`,
+		`INSERT INTO connections (id, name, driver, connection_string_enc) VALUES (1, 'main', 'sqlite', 'x')`,
+		`INSERT INTO queries (id, slug, sql_text) VALUES (1, 'orders', 'SELECT 1')`,
+		`INSERT INTO query_connections (query_id, connection_id) VALUES (1, 1), (1, 7), (8, 1)`,
+		`INSERT INTO audit_logs (user_id, connection_id, query_id, api_key_id, status) VALUES
+			(1, 1, 1, 1, 'SUCCESS'), (1, 7, 8, 2, 'SUCCESS'), (1, 0, 0, NULL, 'ADMIN')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	audit := &memAuditRepo{cursors: map[string]int64{}}
+	janitor := NewOrphanJanitor(data.NewOrphanRepo(db), audit, func() bool { return true })
+	want := map[string]int64{"api_keys": 1, "query_connections": 2, "audit_queries": 1, "audit_connections": 1, "audit_api_keys": 0}
+	counts, err := janitor.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range counts {
+		if c.Count != want[c.Category] {
+			t.Errorf("count %s = %d, want %d", c.Category, c.Count, want[c.Category])
+		}
+	}
+
+	// Cleaning also clears the audit references of the API key it deletes
+	want["audit_api_keys"] = 1
+	for _, dryRun := range []bool{true, false} {
+		counts, err := janitor.Clean(1, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range counts {
+			if c.Count != want[c.Category] {
+				t.Errorf("dry run %v: cleaned %s = %d, want %d", dryRun, c.Category, c.Count, want[c.Category])
+			}
+		}
+		var keys int
+		db.QueryRow(`SELECT COUNT(*) FROM api_keys`).Scan(&keys)
+		if wantKeys := map[bool]int{true: 2, false: 1}[dryRun]; keys != wantKeys {
+			t.Errorf("dry run %v: %d API keys left, want %d", dryRun, keys, wantKeys)
+		}
+	}
+
+	if len(audit.logs) != 1 || audit.logs[0].EventType != core.EventOrphanCleanup {
+		t.Errorf("audit = %+v, want one cleanup event for the real run", audit.logs)
+	}
+
+	counts, _ = janitor.Report()
+	for _, c := range counts {
+		if c.Count != 0 {
+			t.Errorf("%s left after cleaning: %d", c.Category, c.Count)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package service
+
+import (
+	"bytes"
+	"dbbridge/internal/core"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// paramTypes are the parameter types a params_config may declare, named like
+// their JSON schema types
+var paramTypes = map[string]bool{"string": true, "integer": true, "number": true, "boolean": true, "array": true}
+
+// Parameter sources besides the JSON body, see ParamConfig.In
+const (
+	ParamInQuery  = "query"
+	ParamInHeader = "header"
+	ParamInPath   = "path"
+)
+
+// reservedQueryParams are URL query parameters the API reads itself
+var reservedQueryParams = []string{"count_only", "format", "snapshot", "chunk_size"}
+
+// reservedHeaders are request headers the API reads itself
+var reservedHeaders = []string{"X-Api-Key", "Idempotency-Key", "Content-Type", "Accept", "Authorization"}
+
+// ParamConfig documents one parameter of a saved query for API consumers. In
+// a query's params_config it is keyed by parameter name, or given as just the
+// type:
+//
+//	{"customer_id": {"type": "integer", "description": "Customer number", "example": 1042}, "status": "string"}
+//
+// In takes the parameter from elsewhere than the JSON body: the URL query
+// ("query"), the request header named by Header ("header"), or an extra
+// segment after the endpoint, /api/{connection}/{query}/{value} ("path",
+// one parameter at most). Those take precedence over the body.
+type ParamConfig struct {
+	Type        string      `json:"type,omitempty"`
+	Required    *bool       `json:"required,omitempty"` // nil = required unless the SQL has a default
+	Default     string      `json:"default,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Example     interface{} `json:"example,omitempty"` // any JSON value, shown in example requests
+	In          string      `json:"in,omitempty"`      // "" or "body", or a ParamIn* constant
+	Header      string      `json:"header,omitempty"`  // with In "header"
+}
+
+// ParseParamsConfig parses and checks a query's params_config. An empty
+// string means no documentation and returns nil.
+func ParseParamsConfig(s string) (map[string]ParamConfig, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, fmt.Errorf("invalid params config: %w", err)
+	}
+	cfg := make(map[string]ParamConfig, len(raw))
+	for name, v := range raw {
+		var p ParamConfig
+		if err := json.Unmarshal(v, &p.Type); err != nil {
+			dec := json.NewDecoder(bytes.NewReader(v))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&p); err != nil {
+				return nil, fmt.Errorf("invalid params config for %s: %w", name, err)
+			}
+		}
+		if p.Type != "" && !paramTypes[p.Type] {
+			return nil, fmt.Errorf("invalid params config for %s: unknown type %q (use string, integer, number, boolean or array)", name, p.Type)
+		}
+		if err := checkParamSource(name, &p); err != nil {
+			return nil, fmt.Errorf("invalid params config for %s: %w", name, err)
+		}
+		cfg[name] = p
+	}
+	var path []string
+	for name, p := range cfg {
+		if p.In == ParamInPath {
+			path = append(path, name)
+		}
+	}
+	if len(path) > 1 {
+		sort.Strings(path)
+		return nil, fmt.Errorf("invalid params config: only one parameter can be in the path, not %s", strings.Join(path, ", "))
+	}
+	return cfg, nil
+}
+
+// checkParamSource checks the source of parameter name and normalizes it:
+// "body" becomes "" and the header name canonical
+func checkParamSource(name string, p *ParamConfig) error {
+	switch p.In {
+	case "", "body":
+		p.In = ""
+	case ParamInQuery:
+		if slices.Contains(reservedQueryParams, name) {
+			return fmt.Errorf("%s is a URL query parameter of the API itself", name)
+		}
+	case ParamInHeader:
+		if !reHeaderName.MatchString(p.Header) {
+			return fmt.Errorf(`"in": "header" needs the header name in "header"`)
+		}
+		p.Header = http.CanonicalHeaderKey(p.Header)
+		if slices.Contains(reservedHeaders, p.Header) {
+			return fmt.Errorf("the %s header is read by the API itself", p.Header)
+		}
+	case ParamInPath:
+	default:
+		return fmt.Errorf(`unknown "in" %q (use body, query, header or path)`, p.In)
+	}
+	if p.Header != "" && p.In != ParamInHeader {
+		return fmt.Errorf(`"header" only applies with "in": "header"`)
+	}
+	return nil
+}
+
+var reHeaderName = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// Value converts the text of a parameter taken from the URL or a header to
+// the declared type; arrays are comma separated. Text that does not parse is
+// kept as is, for the database to reject.
+func (p ParamConfig) Value(text string) interface{} {
+	switch p.Type {
+	case "integer":
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(text); err == nil {
+			return b
+		}
+	case "array":
+		var items []interface{}
+		for _, item := range strings.Split(text, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+		return items
+	}
+	return text
+}
+
+// ParamDoc is a request parameter of a saved query as documented to API
+// consumers
+type ParamDoc struct {
+	Name         string      `json:"name"`
+	Type         string      `json:"type"`
+	Required     bool        `json:"required"`
+	Default      string      `json:"default,omitempty"`
+	Description  string      `json:"description,omitempty"`
+	Example      interface{} `json:"example,omitempty"`
+	Undocumented bool        `json:"undocumented,omitempty"` // in the SQL but not in params_config
+	In           string      `json:"in,omitempty"`           // "" for the body, see ParamConfig
+	Header       string      `json:"header,omitempty"`
+}
+
+// likeDescriptions describe parameters with a like modifier, which take
+// plain text
+var likeDescriptions = map[string]string{
+	core.LikeContains:   "Text to search for anywhere in the value",
+	core.LikeStartsWith: "Text the value starts with",
+	core.LikeEndsWith:   "Text the value ends with",
+}
+
+var (
+	rePaginationParams = regexp.MustCompile(`(?i)\{\s*pagination(?::\s*(\d*)\s*:\s*(\d*)\s*)?\}`)
+	reOrderByDefault   = regexp.MustCompile(`(?i)\{\s*order_by\s*:\s*(\w*)(?:\([^)]*\))?(?::\s*(asc|desc))?`)
+)
+
+// QueryParams lists the request parameters of q: those in its SQL in
+// order of appearance (identifier parameters last), then the pagination and sorting parameters its
+// variables enable, described by its params_config where it has an entry
+func QueryParams(q *core.SavedQuery) []ParamDoc {
+	parser := core.NewSQLParser()
+	res := parser.Parse(q.SQLText, nil)
+	cfg, _ := ParseParamsConfig(q.ParamsConfig)
+
+	var params []ParamDoc
+	seen := make(map[string]bool)
+	add := func(p ParamDoc, fromSQL bool) {
+		if seen[p.Name] {
+			return
+		}
+		seen[p.Name] = true
+		c, ok := cfg[p.Name]
+		p.Undocumented = fromSQL && !ok
+		if ok {
+			if c.Type != "" {
+				p.Type = c.Type
+			}
+			if c.Required != nil {
+				p.Required = *c.Required
+			}
+			if c.Default != "" {
+				p.Default = c.Default
+			}
+			if c.Description != "" {
+				p.Description = c.Description
+			}
+			p.Example = c.Example
+			p.In, p.Header = c.In, c.Header
+		}
+		params = append(params, p)
+	}
+
+	for _, name := range res.ParamNames {
+		if strings.HasPrefix(name, core.KeyParamPrefix) {
+			continue // bound from the API key, see KeyParams
+		}
+		def, hasDefault := res.Defaults[name]
+		if macro, ok := def.(core.DateMacro); ok && string(macro) == name {
+			continue // a date macro placeholder, not a request parameter
+		}
+		p := ParamDoc{Name: name, Type: "string", Required: !hasDefault, Description: likeDescriptions[res.LikeParams[name]]}
+		if hasDefault && def == nil {
+			p.Default = core.NullDefault
+		} else if hasDefault {
+			p.Default = fmt.Sprint(def)
+		}
+		add(p, true)
+	}
+	// Parameters with a raw SQL default are left out of ParamNames when unset
+	raw := make([]string, 0, len(res.RawDefaults))
+	for name := range res.RawDefaults {
+		raw = append(raw, name)
+	}
+	sort.Strings(raw)
+	for _, name := range raw {
+		add(ParamDoc{Name: name, Type: "string", Default: res.RawDefaults[name]}, true)
+	}
+	for _, ip := range parser.IdentParams(q.SQLText) {
+		p := ParamDoc{Name: ip.Name, Type: "string", Required: true, Description: "One of: " + strings.Join(ip.Allowed, ", ")}
+		if len(ip.Allowed) > 0 {
+			p.Example = ip.Allowed[0]
+		}
+		add(p, true)
+	}
+
+	if m := rePaginationParams.FindStringSubmatch(q.SQLText); m != nil {
+		page, perPage := "1", "50"
+		if m[1] != "" {
+			page = m[1]
+		}
+		if m[2] != "" {
+			perPage = m[2]
+		}
+		add(ParamDoc{Name: "page", Type: "integer", Default: page, Description: "Page number"}, false)
+		add(ParamDoc{Name: "per_page", Type: "integer", Default: perPage, Description: "Rows per page"}, false)
+	}
+	if m := reOrderByDefault.FindStringSubmatch(q.SQLText); m != nil {
+		direction := strings.ToLower(m[2])
+		if direction == "" {
+			direction = "asc"
+		}
+		add(ParamDoc{Name: "order_by", Type: "string", Default: m[1], Description: "Column to sort by"}, false)
+		add(ParamDoc{Name: "order_direction", Type: "string", Default: direction, Description: "asc or desc"}, false)
+	}
+	return params
+}
+
+// Sample returns a value for p in an example request body: its configured
+// example, its default, or a placeholder of its type
+func (p ParamDoc) Sample() interface{} {
+	if p.Example != nil {
+		return p.Example
+	}
+	if p.Default != "" {
+		return p.DefaultValue()
+	}
+	switch p.Type {
+	case "integer":
+		return 1
+	case "number":
+		return 1.5
+	case "boolean":
+		return true
+	case "array":
+		return []interface{}{1, 2}
+	}
+	return "value"
+}
+
+// DefaultValue returns the default as a value of p's type where it parses
+// as one, e.g. 20 rather than "20" for an integer, and nil for NullDefault
+func (p ParamDoc) DefaultValue() interface{} {
+	if strings.EqualFold(p.Default, core.NullDefault) {
+		return nil
+	}
+	switch p.Type {
+	case "integer", "number", "boolean", "array":
+		var v interface{}
+		if json.Unmarshal([]byte(p.Default), &v) == nil {
+			return v
+		}
+	}
+	return p.Default
+}
+
+// ExampleBody returns an example request body with a value for each body
+// parameter
+func ExampleBody(params []ParamDoc) map[string]interface{} {
+	body := make(map[string]interface{}, len(params))
+	for _, p := range params {
+		if p.In == "" {
+			body[p.Name] = p.Sample()
+		}
+	}
+	return body
+}
+
+// ExampleParams returns a value for each parameter, whatever its source, for
+// running an example request in-process
+func ExampleParams(params []ParamDoc) map[string]interface{} {
+	values := make(map[string]interface{}, len(params))
+	for _, p := range params {
+		values[p.Name] = p.Sample()
+	}
+	return values
+}
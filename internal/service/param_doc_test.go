@@ -0,0 +1,78 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"reflect"
+	"testing"
+)
+
+func TestQueryParams(t *testing.T) {
+	q := &core.SavedQuery{
+		SQLText: `SELECT {pagination::20} {select}id, name{endselect} FROM customers
+WHERE region = {region} AND status = {status:active} AND id IN ({ids}) AND owner = {owner} AND closed = {closed:null}
+{order_by:name(id,name):desc}`,
+		ParamsConfig: `{"region": {"type": "string", "description": "Sales region", "example": "north"}, "ids": "array", "status": {"required": true}}`,
+	}
+	got := QueryParams(q)
+	want := []ParamDoc{
+		{Name: "region", Type: "string", Required: true, Description: "Sales region", Example: "north"},
+		{Name: "status", Type: "string", Required: true, Default: "active"},
+		{Name: "ids", Type: "array", Required: true},
+		{Name: "owner", Type: "string", Required: true, Undocumented: true},
+		{Name: "closed", Type: "string", Default: "null", Undocumented: true},
+		{Name: "page", Type: "integer", Default: "1", Description: "Page number"},
+		{Name: "per_page", Type: "integer", Default: "20", Description: "Rows per page"},
+		{Name: "order_by", Type: "string", Default: "name", Description: "Column to sort by"},
+		{Name: "order_direction", Type: "string", Default: "desc", Description: "asc or desc"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("QueryParams() = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("param %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	body := ExampleBody(got)
+	if closed, ok := body["closed"]; !ok || closed != nil {
+		t.Errorf("ExampleBody() closed = %v, want null", closed)
+	}
+	if body["status"] != "active" || body["per_page"] != float64(20) || body["region"] != "north" || body["owner"] != "value" {
+		t.Errorf("ExampleBody() = %v", body)
+	}
+}
+
+func TestParseParamsConfig(t *testing.T) {
+	for _, bad := range []string{
+		`[1, 2]`,
+		`{"id": "int"}`,
+		`{"id": {"type": "integer", "format": "int64"}}`,
+		`{"id": {"in": "cookie"}}`,
+		`{"id": {"in": "header"}}`,
+		`{"id": {"header": "X-Id"}}`,
+		`{"id": {"in": "header", "header": "X-API-Key"}}`,
+		`{"format": {"in": "query"}}`,
+		`{"id": {"in": "path"}, "code": {"in": "path"}}`,
+	} {
+		if _, err := ParseParamsConfig(bad); err == nil {
+			t.Errorf("ParseParamsConfig(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestParamSources(t *testing.T) {
+	cfg, err := ParseParamsConfig(`{"id": {"type": "integer", "in": "path"}, "tenant": {"in": "header", "header": "x-tenant"}, "tags": {"type": "array", "in": "query"}, "note": {"in": "body"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg["tenant"].Header != "X-Tenant" || cfg["note"].In != "" {
+		t.Errorf("sources not normalized: %+v", cfg)
+	}
+	if v := cfg["id"].Value("42"); v != int64(42) {
+		t.Errorf("path id = %#v, want 42", v)
+	}
+	if v := cfg["tags"].Value("a,b"); !reflect.DeepEqual(v, []interface{}{"a", "b"}) {
+		t.Errorf("query tags = %#v, want [a b]", v)
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes user passwords in one scheme. Every hash of a scheme
+// starts with its Prefix, which tells stored hashes apart.
+type PasswordHasher interface {
+	Prefix() string
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash, a hash of the scheme
+	Verify(hash, password string) bool
+	// Outdated reports a hash of the scheme made with other parameters
+	Outdated(hash string) bool
+}
+
+// Argon2idParams are the cost parameters of Argon2id hashes
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultArgon2idParams follow the second recommendation of RFC 9106 with
+// a smaller memory
+var DefaultArgon2idParams = Argon2idParams{Memory: 64 * 1024, Iterations: 3, Parallelism: 2}
+
+const (
+	argon2idPrefix  = "$argon2id$"
+	argon2idSaltLen = 16
+	argon2idKeyLen  = 32
+)
+
+// Argon2idHasher encodes hashes in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$salt$hash
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+func (h *Argon2idHasher) Prefix() string { return argon2idPrefix }
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2idSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := h.params
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2idKeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(hash, password string) bool {
+	p, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false
+	}
+	got := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(got, key) == 1
+}
+
+func (h *Argon2idHasher) Outdated(hash string) bool {
+	p, _, _, err := parseArgon2id(hash)
+	return err != nil || p != h.params
+}
+
+func parseArgon2id(hash string) (p Argon2idParams, salt, key []byte, err error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, errors.New("not an argon2id hash")
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, err
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, err
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, err
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, nil, nil, err
+	}
+	return p, salt, key, nil
+}
+
+// BcryptHasher verifies the bcrypt hashes of passwords set before Argon2id
+type BcryptHasher struct {
+	Cost int
+}
+
+// Prefix is common to the $2a$, $2b$ and $2y$ variants
+func (h BcryptHasher) Prefix() string { return "$2" }
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h BcryptHasher) Verify(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+func (h BcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// maskedValue replaces sensitive values in recorded examples
+const maskedValue = "********"
+
+// maxExampleString bounds the length of text values in recorded examples
+const maxExampleString = 200
+
+// reSensitiveName matches parameter and column names whose values are never
+// recorded in examples
+var reSensitiveName = regexp.MustCompile(`(?i)pass(word|wd)?|secret|token|api_?key|private|credential|ssn|iban|card|cvv|pin$|salary|email|phone|birth`)
+
+// QueryExample is a saved query's canonical example: the parameters and the
+// first response data of a successful admin test run, sanitized, embedded in
+// the OpenAPI spec
+type QueryExample struct {
+	Params     map[string]interface{} `json:"params"`
+	Data       interface{}            `json:"data"` // the response's data, shaped like the API returns it
+	RecordedAt time.Time              `json:"recorded_at"`
+	RecordedBy string                 `json:"recorded_by,omitempty"`
+}
+
+// NewQueryExample sanitizes a test run for storing as a query's example:
+// values of sensitive-looking parameters and columns are masked and long
+// text is cut
+func NewQueryExample(params map[string]interface{}, data interface{}, recordedBy string) *QueryExample {
+	masked, _ := sanitizeExample(params).(map[string]interface{})
+	if masked == nil {
+		masked = map[string]interface{}{}
+	}
+	return &QueryExample{
+		Params:     masked,
+		Data:       sanitizeExample(data),
+		RecordedAt: time.Now().UTC(),
+		RecordedBy: recordedBy,
+	}
+}
+
+// sanitizeExample copies v with the values under sensitive keys masked
+func sanitizeExample(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, val := range x {
+			if val != nil && reSensitiveName.MatchString(k) {
+				out[k] = maskedValue
+				continue
+			}
+			out[k] = sanitizeExample(val)
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]interface{}, len(x))
+		for i, row := range x {
+			out[i] = sanitizeExample(row)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, val := range x {
+			out[i] = sanitizeExample(val)
+		}
+		return out
+	case []byte:
+		return sanitizeExample(string(x))
+	case string:
+		if r := []rune(x); len(r) > maxExampleString {
+			return string(r[:maxExampleString]) + "..."
+		}
+		return x
+	}
+	return v
+}
+
+// Encode writes the example for SavedQuery.Example
+func (e *QueryExample) Encode() (string, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("invalid example: %w", err)
+	}
+	return string(b), nil
+}
+
+// ParseQueryExample reads SavedQuery.Example, nil when there is none
+func ParseQueryExample(s string) (*QueryExample, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var e QueryExample
+	if err := json.Unmarshal([]byte(s), &e); err != nil {
+		return nil, fmt.Errorf("invalid example: %w", err)
+	}
+	return &e, nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewQueryExampleMasksSensitiveValues(t *testing.T) {
+	params := map[string]interface{}{"customer_id": 7, "api_key": "abc123", "note": nil}
+	data := []map[string]interface{}{
+		{"id": int64(7), "Email": "ann@example.com", "bio": strings.Repeat("x", 500)},
+	}
+	ex := NewQueryExample(params, data, "admin")
+
+	if ex.Params["customer_id"] != 7 || ex.Params["api_key"] != maskedValue || ex.Params["note"] != nil {
+		t.Errorf("params = %v", ex.Params)
+	}
+	rows, ok := ex.Data.([]interface{})
+	if !ok || len(rows) != 1 {
+		t.Fatalf("data = %#v", ex.Data)
+	}
+	row := rows[0].(map[string]interface{})
+	if row["Email"] != maskedValue || row["id"] != int64(7) {
+		t.Errorf("row = %v", row)
+	}
+	if bio := row["bio"].(string); len(bio) != maxExampleString+3 {
+		t.Errorf("long text kept at %d characters", len(bio))
+	}
+	if data[0]["Email"] != "ann@example.com" {
+		t.Error("the result rows were changed")
+	}
+
+	encoded, err := ex.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ParseQueryExample(encoded)
+	if err != nil || back.RecordedBy != "admin" || back.Params["api_key"] != maskedValue {
+		t.Errorf("round trip = %+v, %v", back, err)
+	}
+	if ex, err := ParseQueryExample(""); ex != nil || err != nil {
+		t.Errorf("empty example = %v, %v", ex, err)
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultImpactWindow and MaxImpactWindow bound each side of a query impact
+	DefaultImpactWindow = 24 * time.Hour
+	MaxImpactWindow     = 30 * 24 * time.Hour
+
+	// minImpactExecutions is how many executions each side needs before
+	// their error rates and percentiles are worth comparing
+	minImpactExecutions = 20
+)
+
+// QueryImpact compares a query's executions in the window before a change,
+// normally its last edit, with those in the window after it
+type QueryImpact struct {
+	QueryID  int64        `json:"query_id"`
+	Boundary time.Time    `json:"boundary"`
+	Window   string       `json:"window"`
+	Before   ImpactWindow `json:"before"`
+	After    ImpactWindow `json:"after"`
+	// Enough is false when either side has too few executions to compare,
+	// e.g. for a rarely called query or right after the change
+	Enough          bool    `json:"enough_data"`
+	MinExecutions   int64   `json:"min_executions"`
+	ErrorRateChange float64 `json:"error_rate_change"` // after minus before, in percentage points
+	P50ChangeMs     int64   `json:"p50_change_ms"`
+	P95ChangeMs     int64   `json:"p95_change_ms"`
+}
+
+// ImpactWindow is one side of a QueryImpact
+type ImpactWindow struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	core.ExecutionStats
+	ErrorRate float64 `json:"error_rate"` // percent of the executions
+}
+
+// ParseImpactWindow reads the ?window= of a query impact, e.g. "24h";
+// empty is DefaultImpactWindow
+func ParseImpactWindow(s string) (time.Duration, error) {
+	if s == "" {
+		return DefaultImpactWindow, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Hour || d > MaxImpactWindow {
+		return 0, fmt.Errorf("window must be a duration from 1h to %s, e.g. 24h", formatWindow(MaxImpactWindow))
+	}
+	return d, nil
+}
+
+// QueryImpact compares the executions of queryID in the window before
+// boundary with those in the window after it, up to now
+func (s *UsageStats) QueryImpact(queryID int64, boundary time.Time, window time.Duration, now time.Time) (*QueryImpact, error) {
+	impact := &QueryImpact{QueryID: queryID, Boundary: boundary, Window: formatWindow(window), MinExecutions: minImpactExecutions}
+	var err error
+	if impact.Before, err = s.impactWindow(queryID, boundary.Add(-window), boundary); err != nil {
+		return nil, err
+	}
+	end := boundary.Add(window)
+	if end.After(now) {
+		end = now
+	}
+	if impact.After, err = s.impactWindow(queryID, boundary, end); err != nil {
+		return nil, err
+	}
+
+	impact.Enough = impact.Before.Executions >= minImpactExecutions && impact.After.Executions >= minImpactExecutions
+	if impact.Enough {
+		impact.ErrorRateChange = math.Round((impact.After.ErrorRate-impact.Before.ErrorRate)*100) / 100
+		impact.P50ChangeMs = impact.After.P50Ms - impact.Before.P50Ms
+		impact.P95ChangeMs = impact.After.P95Ms - impact.Before.P95Ms
+	}
+	return impact, nil
+}
+
+func (s *UsageStats) impactWindow(queryID int64, from, to time.Time) (ImpactWindow, error) {
+	w := ImpactWindow{From: from, To: to}
+	if !to.After(from) {
+		return w, nil
+	}
+	stats, err := s.repo.QueryStats(queryID, from, to)
+	if err != nil {
+		return w, err
+	}
+	w.ExecutionStats = stats
+	if stats.Executions > 0 {
+		w.ErrorRate = math.Round(float64(stats.Errors)/float64(stats.Executions)*10000) / 100
+	}
+	return w, nil
+}
+
+// formatWindow writes d as ParseImpactWindow reads it, without zero minutes
+// and seconds: "24h" rather than "24h0m0s"
+func formatWindow(d time.Duration) string {
+	s := strings.TrimSuffix(d.String(), "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
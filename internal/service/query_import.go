@@ -0,0 +1,495 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ImportItem is an endpoint read from an OpenAPI spec or Postman collection,
+// to become a draft saved query
+type ImportItem struct {
+	Source      string // "GET /customers/{id}", for the import report
+	Slug        string
+	Description string
+	SQLText     string // from the operation's x-sql extension, else empty
+	Params      map[string]ParamConfig
+}
+
+// Import outcomes of an ImportItem
+const (
+	ImportCreated  = "created"
+	ImportUpdated  = "updated"  // an inactive query of the slug was refreshed
+	ImportConflict = "conflict" // an active query has the slug and was left alone
+	ImportFailed   = "failed"
+)
+
+// ImportResult reports what importing an ImportItem did
+type ImportResult struct {
+	Item    ImportItem
+	Status  string
+	Message string
+	Query   *core.SavedQuery // the query saved, nil on conflict or failure
+	Before  *core.SavedQuery // the query as it was, for ImportUpdated
+}
+
+// openAPIMethods are the operations of an OpenAPI path item, in report order
+var openAPIMethods = []string{"get", "post", "put", "patch", "delete"}
+
+// ParseImport reads the endpoints of a JSON OpenAPI 3 / Swagger 2 document or
+// Postman v2 collection. Slugs are made from the paths and are unique within
+// the file.
+func ParseImport(raw []byte) ([]ImportItem, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("not a JSON OpenAPI spec or Postman collection: %w", err)
+	}
+	var items []ImportItem
+	var err error
+	switch {
+	case doc["openapi"] != nil || doc["swagger"] != nil:
+		items, err = parseOpenAPI(raw)
+	case doc["info"] != nil && doc["item"] != nil:
+		items, err = parsePostman(raw)
+	default:
+		return nil, errors.New("not an OpenAPI spec (no openapi or swagger field) or Postman collection (no info and item)")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Endpoints sharing a path get their method appended, later ones a number
+	seen := map[string]bool{}
+	for i := range items {
+		slug := items[i].Slug
+		if seen[slug] {
+			method, _, _ := strings.Cut(items[i].Source, " ")
+			slug = core.Slugify(slug + "-" + method)
+		}
+		for n := 2; seen[slug]; n++ {
+			slug = fmt.Sprintf("%s-%d", items[i].Slug, n)
+		}
+		seen[slug] = true
+		items[i].Slug = slug
+	}
+	return items, nil
+}
+
+// importSlug makes a slug of an endpoint path: /customers/{id}/orders
+// becomes customers-id-orders
+func importSlug(path string) string {
+	return core.Slugify(strings.NewReplacer("/", "-", "_", "-", ".", "-", ":", "-").Replace(path))
+}
+
+type openAPISchema struct {
+	Ref         string                    `json:"$ref"`
+	Type        interface{}               `json:"type"` // a string, or a list in OpenAPI 3.1
+	Description string                    `json:"description"`
+	Default     interface{}               `json:"default"`
+	Example     interface{}               `json:"example"`
+	Properties  map[string]*openAPISchema `json:"properties"`
+	Required    []string                  `json:"required"`
+}
+
+type openAPIParameter struct {
+	Ref         string         `json:"$ref"`
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description"`
+	Required    bool           `json:"required"`
+	Schema      *openAPISchema `json:"schema"`
+	Type        string         `json:"type"` // Swagger 2 keeps the type on the parameter
+	Example     interface{}    `json:"example"`
+}
+
+type openAPIOperation struct {
+	OperationID string             `json:"operationId"`
+	Summary     string             `json:"summary"`
+	Description string             `json:"description"`
+	Parameters  []openAPIParameter `json:"parameters"`
+	RequestBody *struct {
+		Ref     string `json:"$ref"`
+		Content map[string]struct {
+			Schema *openAPISchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	SQL string `json:"x-sql"`
+}
+
+type openAPIDoc struct {
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+	// Components are OpenAPI 3's, Definitions Swagger 2's
+	Components struct {
+		Schemas    map[string]*openAPISchema   `json:"schemas"`
+		Parameters map[string]openAPIParameter `json:"parameters"`
+	} `json:"components"`
+	Definitions map[string]*openAPISchema   `json:"definitions"`
+	Parameters  map[string]openAPIParameter `json:"parameters"`
+}
+
+func parseOpenAPI(raw []byte) ([]ImportItem, error) {
+	var doc openAPIDoc
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+
+	var items []ImportItem
+	for _, path := range slices.Sorted(maps.Keys(doc.Paths)) {
+		// Parameters of the path item apply to all its operations
+		var shared []openAPIParameter
+		if rawParams, ok := doc.Paths[path]["parameters"]; ok {
+			json.Unmarshal(rawParams, &shared)
+		}
+		for _, method := range openAPIMethods {
+			rawOp, ok := doc.Paths[path][method]
+			if !ok {
+				continue
+			}
+			var op openAPIOperation
+			if err := json.Unmarshal(rawOp, &op); err != nil {
+				return nil, fmt.Errorf("invalid OpenAPI operation %s %s: %w", strings.ToUpper(method), path, err)
+			}
+			item := ImportItem{
+				Source:      strings.ToUpper(method) + " " + path,
+				Slug:        importSlug(path),
+				Description: firstNonEmpty(op.Summary, op.Description, op.OperationID),
+				SQLText:     op.SQL,
+				Params:      map[string]ParamConfig{},
+			}
+			for _, p := range slices.Concat(shared, op.Parameters) {
+				p = doc.parameter(p)
+				if p.Name == "" || (p.In != "path" && p.In != "query" && p.In != "body") {
+					continue
+				}
+				if p.In == "body" {
+					// Swagger 2 describes the request body as a parameter
+					doc.addProperties(item.Params, p.Schema)
+					continue
+				}
+				cfg := ParamConfig{Type: p.Type, Description: p.Description, Example: p.Example}
+				if s := doc.schema(p.Schema); s != nil {
+					cfg.Type = schemaType(s)
+					if cfg.Example == nil {
+						cfg.Example = s.Example
+					}
+					if s.Default != nil {
+						cfg.Default = fmt.Sprint(s.Default)
+					}
+				}
+				cfg.Type = importType(cfg.Type)
+				required := p.Required
+				cfg.Required = &required
+				item.Params[p.Name] = cfg
+			}
+			if op.RequestBody != nil {
+				for _, ct := range slices.Sorted(maps.Keys(op.RequestBody.Content)) {
+					if strings.Contains(ct, "json") || strings.Contains(ct, "form") {
+						doc.addProperties(item.Params, op.RequestBody.Content[ct].Schema)
+						break
+					}
+				}
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// refName returns the name a local $ref points to, such as Customer for
+// #/components/schemas/Customer
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func (d *openAPIDoc) parameter(p openAPIParameter) openAPIParameter {
+	if p.Ref == "" {
+		return p
+	}
+	if rp, ok := d.Components.Parameters[refName(p.Ref)]; ok {
+		return rp
+	}
+	return d.Parameters[refName(p.Ref)]
+}
+
+// schema resolves a $ref schema; references may chain but not loop
+func (d *openAPIDoc) schema(s *openAPISchema) *openAPISchema {
+	for i := 0; s != nil && s.Ref != "" && i < 10; i++ {
+		name := refName(s.Ref)
+		if def, ok := d.Components.Schemas[name]; ok {
+			s = def
+		} else {
+			s = d.Definitions[name]
+		}
+	}
+	return s
+}
+
+// addProperties documents the top-level properties of a request body schema
+// as parameters
+func (d *openAPIDoc) addProperties(params map[string]ParamConfig, body *openAPISchema) {
+	body = d.schema(body)
+	if body == nil {
+		return
+	}
+	for name, prop := range body.Properties {
+		prop = d.schema(prop)
+		if prop == nil {
+			continue
+		}
+		required := slices.Contains(body.Required, name)
+		cfg := ParamConfig{Type: importType(schemaType(prop)), Description: prop.Description, Example: prop.Example, Required: &required}
+		if prop.Default != nil {
+			cfg.Default = fmt.Sprint(prop.Default)
+		}
+		params[name] = cfg
+	}
+}
+
+// schemaType returns a schema's type, the first non-null one of an OpenAPI
+// 3.1 type list
+func schemaType(s *openAPISchema) string {
+	switch t := s.Type.(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, v := range t {
+			if name, ok := v.(string); ok && name != "null" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// importType maps a JSON schema type to a params_config type; objects and
+// unknown types are left untyped
+func importType(t string) string {
+	if paramTypes[t] {
+		return t
+	}
+	return ""
+}
+
+type postmanItem struct {
+	Name    string        `json:"name"`
+	Item    []postmanItem `json:"item"` // a folder
+	Request *struct {
+		Method      string          `json:"method"`
+		Description json.RawMessage `json:"description"` // a string or {content}
+		URL         json.RawMessage `json:"url"`         // a string or an object
+		Body        *struct {
+			Mode       string        `json:"mode"`
+			Raw        string        `json:"raw"`
+			URLEncoded []postmanPair `json:"urlencoded"`
+			FormData   []postmanPair `json:"formdata"`
+		} `json:"body"`
+	} `json:"request"`
+}
+
+type postmanPair struct {
+	Key         string          `json:"key"`
+	Value       string          `json:"value"`
+	Description json.RawMessage `json:"description"`
+	Disabled    bool            `json:"disabled"`
+}
+
+type postmanURL struct {
+	Raw      string        `json:"raw"`
+	Path     []string      `json:"path"`
+	Query    []postmanPair `json:"query"`
+	Variable []postmanPair `json:"variable"`
+}
+
+func parsePostman(raw []byte) ([]ImportItem, error) {
+	var collection struct {
+		Item []postmanItem `json:"item"`
+	}
+	if err := json.Unmarshal(raw, &collection); err != nil {
+		return nil, fmt.Errorf("invalid Postman collection: %w", err)
+	}
+	var items []ImportItem
+	var walk func(list []postmanItem)
+	walk = func(list []postmanItem) {
+		for _, it := range list {
+			if it.Request == nil {
+				walk(it.Item)
+				continue
+			}
+			items = append(items, postmanRequest(it))
+		}
+	}
+	walk(collection.Item)
+	return items, nil
+}
+
+func postmanRequest(it postmanItem) ImportItem {
+	req := it.Request
+	var u postmanURL
+	if err := json.Unmarshal(req.URL, &u.Raw); err != nil {
+		json.Unmarshal(req.URL, &u)
+	}
+	path := "/" + strings.Join(u.Path, "/")
+	if len(u.Path) == 0 {
+		path = postmanPath(u.Raw)
+	}
+	method := strings.ToUpper(firstNonEmpty(req.Method, "GET"))
+	item := ImportItem{
+		Source:      method + " " + path,
+		Slug:        importSlug(path),
+		Description: firstNonEmpty(it.Name, postmanText(req.Description)),
+		Params:      map[string]ParamConfig{},
+	}
+
+	required := true
+	// Path variables (:id) are required, query parameters optional
+	for _, seg := range strings.Split(path, "/") {
+		if strings.HasPrefix(seg, ":") {
+			item.Params[seg[1:]] = ParamConfig{Required: &required}
+		}
+	}
+	for _, v := range u.Variable {
+		item.Params[v.Key] = postmanParam(v, true)
+	}
+	for _, q := range u.Query {
+		if !q.Disabled && q.Key != "" {
+			item.Params[q.Key] = postmanParam(q, false)
+		}
+	}
+	if req.Body != nil {
+		switch req.Body.Mode {
+		case "raw":
+			var body map[string]interface{}
+			if json.Unmarshal([]byte(req.Body.Raw), &body) == nil {
+				for name, v := range body {
+					optional := false
+					item.Params[name] = ParamConfig{Type: jsonValueType(v), Example: v, Required: &optional}
+				}
+			}
+		case "urlencoded", "formdata":
+			for _, p := range append(req.Body.URLEncoded, req.Body.FormData...) {
+				if !p.Disabled && p.Key != "" {
+					item.Params[p.Key] = postmanParam(p, false)
+				}
+			}
+		}
+	}
+	return item
+}
+
+// postmanPath returns the path of a raw Postman URL such as
+// {{baseUrl}}/customers/:id?active=true
+func postmanPath(raw string) string {
+	raw, _, _ = strings.Cut(raw, "?")
+	if i := strings.Index(raw, "://"); i >= 0 {
+		raw = raw[i+3:]
+	}
+	if i := strings.Index(raw, "/"); i >= 0 {
+		return raw[i:]
+	}
+	return "/"
+}
+
+func postmanParam(p postmanPair, required bool) ParamConfig {
+	cfg := ParamConfig{Description: postmanText(p.Description), Required: &required}
+	if p.Value != "" && !strings.HasPrefix(p.Value, "{{") {
+		cfg.Example = p.Value
+	}
+	return cfg
+}
+
+// postmanText reads a Postman description, a string or {"content": ...}
+func postmanText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var d struct {
+		Content string `json:"content"`
+	}
+	json.Unmarshal(raw, &d)
+	return d.Content
+}
+
+// jsonValueType returns the params_config type of an example JSON value
+func jsonValueType(v interface{}) string {
+	switch x := v.(type) {
+	case bool:
+		return "boolean"
+	case float64:
+		if x == float64(int64(x)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	}
+	return ""
+}
+
+// ImportQueries saves items as inactive draft queries without connections.
+// An inactive query of the same slug is refreshed, keeping its SQL unless the
+// item has some; an active one is never touched and reported as a conflict.
+func ImportQueries(repo core.QueryRepository, items []ImportItem, updatedBy string) []ImportResult {
+	results := make([]ImportResult, 0, len(items))
+	for _, item := range items {
+		res := ImportResult{Item: item}
+		params, err := json.Marshal(item.Params)
+		if err != nil || len(item.Params) == 0 {
+			params = nil
+		}
+
+		existing, err := repo.GetBySlug(item.Slug)
+		switch {
+		case err == nil && existing.Slug != item.Slug:
+			res.Status = ImportConflict
+			res.Message = "this slug is an old slug of query " + existing.Slug
+		case err == nil && existing.IsActive:
+			res.Status = ImportConflict
+			res.Message = "an active query has this slug"
+		case err == nil:
+			before := *existing
+			existing.Description = item.Description
+			existing.ParamsConfig = string(params)
+			if item.SQLText != "" {
+				existing.SQLText = item.SQLText
+			}
+			existing.UpdatedBy = updatedBy
+			if err := repo.Update(existing); err != nil {
+				res.Status, res.Message = ImportFailed, err.Error()
+			} else {
+				res.Status, res.Query, res.Before = ImportUpdated, existing, &before
+			}
+		default:
+			q := &core.SavedQuery{
+				Slug:         item.Slug,
+				Description:  item.Description,
+				SQLText:      item.SQLText,
+				ParamsConfig: string(params),
+				ResultMode:   core.NormalizeResultMode(""),
+				UpdatedBy:    updatedBy,
+			}
+			if err := repo.Create(q); err != nil {
+				res.Status, res.Message = ImportFailed, err.Error()
+			} else {
+				res.Status, res.Query = ImportCreated, q
+			}
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/data"
+	"path/filepath"
+	"testing"
+)
+
+const importOpenAPI = `{
+  "openapi": "3.0.3",
+  "paths": {
+    "/customers/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+      "get": {"summary": "Customer by id", "x-sql": "SELECT * FROM customers WHERE id = :id"},
+      "put": {
+        "summary": "Update a customer",
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Customer"}}}}
+      }
+    },
+    "/orders": {
+      "get": {"operationId": "listOrders", "parameters": [{"$ref": "#/components/parameters/Status"}]}
+    }
+  },
+  "components": {
+    "schemas": {
+      "Customer": {"type": "object", "required": ["name"], "properties": {
+        "name": {"type": "string", "description": "Full name"},
+        "address": {"type": "object"}
+      }}
+    },
+    "parameters": {"Status": {"name": "status", "in": "query", "schema": {"type": "string", "default": "open"}}}
+  }
+}`
+
+const importPostman = `{
+  "info": {"name": "Legacy API", "schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"},
+  "item": [{
+    "name": "Orders",
+    "item": [{
+      "name": "Order lines",
+      "request": {
+        "method": "POST",
+        "url": {"raw": "{{baseUrl}}/orders/:order_id/lines?limit=10", "path": ["orders", ":order_id", "lines"],
+          "query": [{"key": "limit", "value": "10"}]},
+        "body": {"mode": "raw", "raw": "{\"sku\": \"A-1\", \"qty\": 2, \"gift\": false}"}
+      }
+    }]
+  }]
+}`
+
+func TestParseImportOpenAPI(t *testing.T) {
+	items, err := ParseImport([]byte(importOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("got %d items, want 3: %+v", len(items), items)
+	}
+	get, put, orders := items[0], items[1], items[2]
+	if get.Slug != "customers-id" || get.SQLText == "" || get.Params["id"].Type != "integer" || !*get.Params["id"].Required {
+		t.Errorf("GET /customers/{id} = %+v", get)
+	}
+	// The second endpoint of a path gets its method in the slug
+	if put.Slug != "customers-id-put" {
+		t.Errorf("PUT slug = %q", put.Slug)
+	}
+	if p := put.Params["name"]; p.Type != "string" || !*p.Required || p.Description != "Full name" {
+		t.Errorf("body property name = %+v", p)
+	}
+	if p := put.Params["address"]; p.Type != "" || *p.Required {
+		t.Errorf("object property address = %+v, want untyped and optional", p)
+	}
+	if orders.Description != "listOrders" || orders.Params["status"].Default != "open" {
+		t.Errorf("GET /orders = %+v", orders)
+	}
+}
+
+func TestParseImportPostman(t *testing.T) {
+	items, err := ParseImport([]byte(importPostman))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	it := items[0]
+	if it.Slug != "orders-order-id-lines" || it.Description != "Order lines" {
+		t.Errorf("item = %+v", it)
+	}
+	for name, typ := range map[string]string{"order_id": "", "limit": "", "sku": "string", "qty": "integer", "gift": "boolean"} {
+		p, ok := it.Params[name]
+		if !ok || p.Type != typ {
+			t.Errorf("param %s = %+v, want type %q", name, p, typ)
+		}
+	}
+	if !*it.Params["order_id"].Required || *it.Params["limit"].Required {
+		t.Errorf("path variables are required and query parameters optional: %+v", it.Params)
+	}
+
+	if _, err := ParseImport([]byte(`{"name": "x"}`)); err == nil {
+		t.Error("unknown document parsed")
+	}
+}
+
+func TestImportQueriesKeepsActiveQueries(t *testing.T) {
+	db, err := data.OpenDB(filepath.Join(t.TempDir(), "dbbridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	repo := data.NewQueryRepo(db)
+	active := &core.SavedQuery{Slug: "customers-id", SQLText: "SELECT 1", IsActive: true}
+	draft := &core.SavedQuery{Slug: "orders", SQLText: "SELECT 2"}
+	for _, q := range []*core.SavedQuery{active, draft} {
+		if err := repo.Create(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := ParseImport([]byte(importOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := ImportQueries(repo, items, "admin")
+	want := []string{ImportConflict, ImportCreated, ImportUpdated}
+	for i, res := range results {
+		if res.Status != want[i] {
+			t.Errorf("%s: %s (%s), want %s", res.Item.Source, res.Status, res.Message, want[i])
+		}
+	}
+
+	if q, _ := repo.GetBySlug("customers-id"); q.SQLText != "SELECT 1" || q.ParamsConfig != "" {
+		t.Errorf("active query changed: %+v", q)
+	}
+	if q, _ := repo.GetBySlug("orders"); q.SQLText != "SELECT 2" || q.Description != "listOrders" || q.IsActive {
+		t.Errorf("draft = %+v, want its SQL kept and the description refreshed", q)
+	}
+	if q, _ := repo.GetBySlug("customers-id-put"); q == nil || q.IsActive || q.ParamsConfig == "" {
+		t.Errorf("new draft = %+v, want inactive with params", q)
+	}
+}
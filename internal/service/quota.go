@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"sync"
+	"time"
+)
+
+const (
+	// quotaFlushInterval is how often Run writes the counted requests and
+	// reloads the day, which also picks up those of other instances
+	quotaFlushInterval = 10 * time.Second
+	// quotaDaysKept is how many past days of usage Run keeps
+	quotaDaysKept = 31
+
+	quotaDayLayout = "2006-01-02"
+)
+
+type quotaKey struct {
+	day      string
+	apiKeyID int64
+}
+
+// DailyQuota caps the API requests of each key per day, a day running from
+// midnight to midnight in the quota time zone. Requests are counted in
+// memory and written in batches by Run; Load reads the day back, so a
+// restart keeps what was used before it. Unlike the rate limiters' token
+// buckets, which stay in memory, the counts survive restarts.
+type DailyQuota struct {
+	repo  core.QuotaRepository
+	limit func() int    // 0 = unlimited
+	zone  func() string // IANA name, empty = server time zone
+
+	mu       sync.Mutex
+	day      string
+	counts   map[int64]int64 // requests of the day per key, written or not
+	pending  map[quotaKey]int64
+	zoneName string
+	loc      *time.Location
+}
+
+func NewDailyQuota(repo core.QuotaRepository, limit func() int, zone func() string) *DailyQuota {
+	return &DailyQuota{
+		repo:    repo,
+		limit:   limit,
+		zone:    zone,
+		counts:  make(map[int64]int64),
+		pending: make(map[quotaKey]int64),
+		loc:     time.Local,
+	}
+}
+
+// Take counts a request of apiKeyID at now, unless the key has used up the
+// day's quota: then it returns false and how long until the day ends
+func (q *DailyQuota) Take(apiKeyID int64, now time.Time) (ok bool, retryAfter time.Duration) {
+	limit := q.limit()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t := now.In(q.location())
+	if day := t.Format(quotaDayLayout); day != q.day {
+		q.day = day
+		q.counts = make(map[int64]int64)
+	}
+	if limit > 0 && q.counts[apiKeyID] >= int64(limit) {
+		y, m, d := t.Date()
+		return false, time.Date(y, m, d+1, 0, 0, 0, 0, t.Location()).Sub(t)
+	}
+	q.counts[apiKeyID]++
+	q.pending[quotaKey{q.day, apiKeyID}]++
+	return true, 0
+}
+
+// location resolves the quota time zone, loading it again only when the
+// setting changed. q.mu is held.
+func (q *DailyQuota) location() *time.Location {
+	name := q.zone()
+	if name == q.zoneName {
+		return q.loc
+	}
+	loc := time.Local
+	if name != "" {
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil {
+			// Validated when saved
+			logger.Error.Printf("Quota time zone %q: %v, using server time", name, err)
+			loc = time.Local
+		}
+	}
+	q.zoneName, q.loc = name, loc
+	return loc
+}
+
+// Load reads the requests of the day of now from the repository, adding
+// those counted but not written yet
+func (q *DailyQuota) Load(now time.Time) error {
+	q.mu.Lock()
+	day := now.In(q.location()).Format(quotaDayLayout)
+	q.mu.Unlock()
+	counts, err := q.repo.Day(day)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for k, n := range q.pending {
+		if k.day == day {
+			counts[k.apiKeyID] += n
+		}
+	}
+	q.day, q.counts = day, counts
+	return nil
+}
+
+// Flush writes the requests counted since the last flush. On failure they
+// are kept for the next one.
+func (q *DailyQuota) Flush() error {
+	q.mu.Lock()
+	batch := q.pending
+	q.pending = make(map[quotaKey]int64)
+	q.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	usage := make([]core.QuotaUsage, 0, len(batch))
+	for k, n := range batch {
+		usage = append(usage, core.QuotaUsage{ApiKeyID: k.apiKeyID, Day: k.day, Requests: n})
+	}
+	if err := q.repo.Add(usage); err != nil {
+		q.mu.Lock()
+		for k, n := range batch {
+			q.pending[k] += n
+		}
+		q.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run flushes and reloads the day every quotaFlushInterval, and deletes
+// the days past quotaDaysKept, until ctx is cancelled
+func (q *DailyQuota) Run(ctx context.Context) {
+	ticker := time.NewTicker(quotaFlushInterval)
+	defer ticker.Stop()
+	var pruned string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := q.Flush(); err != nil {
+			logger.Error.Printf("Failed to write API quota usage: %v", err)
+			continue
+		}
+		now := time.Now()
+		if err := q.Load(now); err != nil {
+			logger.Error.Printf("Failed to load API quota usage: %v", err)
+		}
+		if day := now.Format(quotaDayLayout); day != pruned {
+			if err := q.repo.DeleteBefore(now.AddDate(0, 0, -quotaDaysKept).Format(quotaDayLayout)); err != nil {
+				logger.Error.Printf("Failed to delete old API quota usage: %v", err)
+			} else {
+				pruned = day
+			}
+		}
+	}
+}
+
+// Close writes what is still counted, for graceful shutdown
+func (q *DailyQuota) Close() {
+	if err := q.Flush(); err != nil {
+		logger.Error.Printf("Failed to write API quota usage: %v", err)
+	}
+}
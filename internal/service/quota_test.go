@@ -0,0 +1,91 @@
+package service
+
+import (
+	"dbbridge/internal/data/memory"
+	"testing"
+	"time"
+)
+
+func TestDailyQuotaRestartMidDay(t *testing.T) {
+	repo := &memory.Quota{}
+	limit := func() int { return 3 }
+	zone := func() string { return "Asia/Jakarta" }
+	jakarta, _ := time.LoadLocation("Asia/Jakarta")
+	now := time.Date(2026, 3, 10, 14, 0, 0, 0, jakarta)
+
+	q := NewDailyQuota(repo, limit, zone)
+	for i := 0; i < 2; i++ {
+		if ok, _ := q.Take(1, now); !ok {
+			t.Fatalf("request %d refused", i+1)
+		}
+	}
+	q.Close()
+
+	// A new process reads the day back and has one request left
+	q = NewDailyQuota(repo, limit, zone)
+	if err := q.Load(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := q.Take(1, now.Add(time.Hour)); !ok {
+		t.Fatal("third request refused after restart")
+	}
+	ok, retryAfter := q.Take(1, now.Add(time.Hour))
+	if ok {
+		t.Fatal("fourth request allowed after restart")
+	}
+	if retryAfter != 9*time.Hour {
+		t.Errorf("retry after = %v, want 9h until midnight in Jakarta", retryAfter)
+	}
+	if ok, _ := q.Take(2, now.Add(time.Hour)); !ok {
+		t.Error("another key was refused")
+	}
+
+	// Requests not flushed yet count too when the day is reloaded
+	if err := q.Load(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := q.Take(1, now.Add(time.Hour)); ok {
+		t.Error("reload forgot the unflushed request")
+	}
+}
+
+func TestDailyQuotaMidnightRollover(t *testing.T) {
+	repo := &memory.Quota{}
+	q := NewDailyQuota(repo, func() int { return 1 }, func() string { return "Asia/Jakarta" })
+
+	// 16:59 UTC is 23:59 in Jakarta (UTC+7), 17:00 UTC the next day there
+	before := time.Date(2026, 3, 10, 16, 59, 0, 0, time.UTC)
+	if ok, _ := q.Take(1, before); !ok {
+		t.Fatal("first request refused")
+	}
+	ok, retryAfter := q.Take(1, before)
+	if ok || retryAfter != time.Minute {
+		t.Fatalf("second request = %v, retry after %v; want refused for a minute", ok, retryAfter)
+	}
+	after := before.Add(time.Minute)
+	if ok, _ := q.Take(1, after); !ok {
+		t.Fatal("request refused after midnight in Jakarta")
+	}
+	q.Close()
+
+	days := map[string]int64{}
+	for _, day := range []string{"2026-03-10", "2026-03-11"} {
+		counts, _ := repo.Day(day)
+		days[day] = counts[1]
+	}
+	if days["2026-03-10"] != 1 || days["2026-03-11"] != 1 {
+		t.Errorf("stored days = %v, want one request on each", days)
+	}
+
+	// A restart after midnight starts from the new day's count only
+	q = NewDailyQuota(repo, func() int { return 2 }, func() string { return "Asia/Jakarta" })
+	if err := q.Load(after); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := q.Take(1, after); !ok {
+		t.Error("second request of the new day refused")
+	}
+	if ok, _ := q.Take(1, after); ok {
+		t.Error("third request of the new day allowed")
+	}
+}
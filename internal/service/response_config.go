@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ResponseConfig customizes the HTTP response of a saved query's successful
+// executions: static headers to set, and the status to answer instead of 200
+// with an empty array when it returns no rows, e.g.
+//
+//	{"headers": {"Content-Disposition": "attachment; filename=\"orders.json\""}, "empty_status": 204}
+type ResponseConfig struct {
+	Headers     map[string]string `json:"headers"`
+	EmptyStatus int               `json:"empty_status"` // 204 or 404, 0 = the result mode decides
+}
+
+// forbiddenResponseHeaders can't be set by a response config: hop-by-hop
+// headers, which only concern a single connection, and headers the server
+// computes itself (the content type follows ?format)
+var forbiddenResponseHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Length":      true,
+	"Content-Type":        true,
+}
+
+// ParseResponseConfig parses and checks a query's response config. An empty
+// string means no customization and returns nil.
+func ParseResponseConfig(s string) (*ResponseConfig, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var cfg ResponseConfig
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid response config: %w", err)
+	}
+	switch cfg.EmptyStatus {
+	case 0, http.StatusNoContent, http.StatusNotFound:
+	default:
+		return nil, fmt.Errorf("invalid response config: \"empty_status\" must be 204 or 404, not %d", cfg.EmptyStatus)
+	}
+	for name, value := range cfg.Headers {
+		if !isHeaderToken(name) {
+			return nil, fmt.Errorf("invalid response config: %q is not a valid header name", name)
+		}
+		canonical := http.CanonicalHeaderKey(name)
+		if forbiddenResponseHeaders[canonical] {
+			return nil, fmt.Errorf("invalid response config: header %s can't be set by a query", canonical)
+		}
+		if strings.HasPrefix(canonical, "X-Dbbridge-") {
+			return nil, fmt.Errorf("invalid response config: X-DbBridge- headers are set by DbBridge")
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return nil, fmt.Errorf("invalid response config: the value of header %s contains a line break", canonical)
+		}
+	}
+	return &cfg, nil
+}
+
+// isHeaderToken reports whether s is a valid HTTP header name (RFC 9110 token)
+func isHeaderToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseResponseConfig(t *testing.T) {
+	cfg, err := ParseResponseConfig(`{"headers": {"Content-Disposition": "attachment", "X-Vendor-Id": "42"}, "empty_status": 204}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.EmptyStatus != 204 || cfg.Headers["X-Vendor-Id"] != "42" {
+		t.Errorf("config = %+v", cfg)
+	}
+	if cfg, err := ParseResponseConfig("  "); cfg != nil || err != nil {
+		t.Errorf("empty config = %v, %v, want nil", cfg, err)
+	}
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{`{"empty_status": 200}`, "must be 204 or 404"},
+		{`{"headers": {"Bad Name": "x"}}`, "not a valid header name"},
+		{`{"headers": {"transfer-encoding": "chunked"}}`, "Transfer-Encoding can't be set"},
+		{`{"headers": {"Connection": "close"}}`, "Connection can't be set"},
+		{`{"headers": {"X-DbBridge-Rows": "1"}}`, "set by DbBridge"},
+		{`{"headers": {"X-Vendor": "a\r\nSet-Cookie: b"}}`, "line break"},
+		{`{"status": 204}`, "unknown field"},
+	}
+	for _, tt := range tests {
+		_, err := ParseResponseConfig(tt.config)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseResponseConfig(%s) error = %v, want %q", tt.config, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"database/sql"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WarningSchemaDrift flags an execution whose columns differ from the
+// query's captured response schema
+const WarningSchemaDrift = "schema_drift"
+
+var (
+	reIntegerType = regexp.MustCompile(`^(UNSIGNED )?(TINY|SMALL|MEDIUM|BIG)?INT(EGER)?[248]?( UNSIGNED)?$|^(SMALL|BIG)?SERIAL[248]?$`)
+	reNumberType  = regexp.MustCompile(`^(DECIMAL|NUMERIC|NUMBER|FLOAT[48]?|DOUBLE( PRECISION)?|REAL|(SMALL)?MONEY|BINARY_(FLOAT|DOUBLE))$`)
+	reBoolType    = regexp.MustCompile(`^(BOOL|BOOLEAN|BIT)$`)
+	reTimeType    = regexp.MustCompile(`^(DATE|DATETIME[2]?|SMALLDATETIME|DATETIMEOFFSET|TIMESTAMP(TZ)?|TIME(TZ)?)$`)
+	reStringType  = regexp.MustCompile(`CHAR|TEXT|CLOB|STRING|UUID|UNIQUEIDENTIFIER|JSON|XML|ENUM`)
+)
+
+// ResponseColumn is a column of a query's result as documented in the
+// OpenAPI spec
+type ResponseColumn struct {
+	Name     string `json:"name"`               // the row key
+	Type     string `json:"type,omitempty"`     // JSON schema type (integer, number, boolean or string), empty when unknown
+	Format   string `json:"format,omitempty"`   // date-time for date and time columns
+	DBType   string `json:"db_type,omitempty"`  // the driver's type name
+	Nullable *bool  `json:"nullable,omitempty"` // nil when the driver does not say
+}
+
+// ResponseSchema is the response columns of a saved query captured from a
+// sample run, documented in place of a generic row object. It is
+// best-effort: the types come from the driver's column types, or from the
+// values the run returned where those are known, and another connection or
+// other parameters may return other types. An execution returning other
+// columns marks the schema drifted until it is captured again.
+type ResponseSchema struct {
+	Columns      []ResponseColumn `json:"columns"`
+	ConnectionID int64            `json:"connection_id"`
+	CapturedAt   time.Time        `json:"captured_at"`
+	CapturedBy   string           `json:"captured_by,omitempty"`
+	DriftAt      *time.Time       `json:"drift_at,omitempty"`      // first execution with other columns, nil = none
+	DriftColumns []string         `json:"drift_columns,omitempty"` // the columns it returned
+}
+
+// responseColumn describes a column from its driver column type
+func responseColumn(key string, ct *sql.ColumnType) ResponseColumn {
+	c := ResponseColumn{Name: key}
+	if ct == nil {
+		return c
+	}
+	c.DBType = strings.ToUpper(strings.TrimSpace(ct.DatabaseTypeName()))
+	if nullable, ok := ct.Nullable(); ok {
+		c.Nullable = &nullable
+	}
+	c.Type, c.Format = dbTypeSchema(c.DBType)
+	return c
+}
+
+// dbTypeSchema returns the JSON schema type and format of a driver type
+// name, "" when it is not known
+func dbTypeSchema(dbType string) (string, string) {
+	switch base, _, _ := strings.Cut(dbType, "("); {
+	case reIntegerType.MatchString(base):
+		return "integer", ""
+	case reNumberType.MatchString(base):
+		return "number", ""
+	case reBoolType.MatchString(base):
+		return "boolean", ""
+	case reTimeType.MatchString(base):
+		return "string", "date-time"
+	case reStringType.MatchString(base):
+		return "string", ""
+	}
+	return "", ""
+}
+
+// valueType returns the JSON schema type and format a result value is
+// answered as, "" for NULL and values of no simple type
+func valueType(v interface{}) (string, string) {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "integer", ""
+	case float32, float64, json.Number:
+		return "number", ""
+	case bool:
+		return "boolean", ""
+	case time.Time:
+		return "string", "date-time"
+	case string, []byte:
+		return "string", ""
+	}
+	return "", ""
+}
+
+// NewResponseSchema captures the response schema of a run of a query on a
+// connection. A column's first non-NULL value overrides its driver type, as
+// drivers answer some types (e.g. decimals) as text.
+func NewResponseSchema(result *ExecutionResult, connectionID int64, capturedBy string) (*ResponseSchema, error) {
+	if len(result.ColumnTypes) == 0 {
+		return nil, fmt.Errorf("the run returned no columns")
+	}
+	s := &ResponseSchema{
+		Columns:      slices.Clone(result.ColumnTypes),
+		ConnectionID: connectionID,
+		CapturedAt:   time.Now().UTC(),
+		CapturedBy:   capturedBy,
+	}
+	for i := range s.Columns {
+		c := &s.Columns[i]
+		for _, row := range result.Data {
+			if typ, format := valueType(row[c.Name]); typ != "" {
+				if typ != c.Type {
+					c.Type, c.Format = typ, format
+				} else if format != "" {
+					c.Format = format
+				}
+				break
+			}
+		}
+	}
+	return s, nil
+}
+
+// Encode writes the schema for SavedQuery.ResponseSchema
+func (s *ResponseSchema) Encode() (string, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid response schema: %w", err)
+	}
+	return string(b), nil
+}
+
+// ParseResponseSchema reads SavedQuery.ResponseSchema, nil when there is none
+func ParseResponseSchema(s string) (*ResponseSchema, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var rs ResponseSchema
+	if err := json.Unmarshal([]byte(s), &rs); err != nil {
+		return nil, fmt.Errorf("invalid response schema: %w", err)
+	}
+	return &rs, nil
+}
+
+// Names returns the captured row keys, in column order
+func (s *ResponseSchema) Names() []string {
+	names := make([]string, len(s.Columns))
+	for i, c := range s.Columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// Properties returns the JSON schema of each column by row key
+func (s *ResponseSchema) Properties() map[string]interface{} {
+	props := make(map[string]interface{}, len(s.Columns))
+	for _, c := range s.Columns {
+		prop := map[string]interface{}{}
+		if c.Type != "" {
+			prop["type"] = c.Type
+		}
+		if c.Format != "" {
+			prop["format"] = c.Format
+		}
+		if c.Nullable == nil || *c.Nullable {
+			prop["nullable"] = true
+		}
+		if c.DBType != "" {
+			prop["description"] = "Database type " + c.DBType
+		}
+		props[c.Name] = prop
+	}
+	return props
+}
+
+// checkSchemaDrift compares the columns of an execution of q with its
+// captured response schema and reports whether they differ. The schema's
+// drift mark is stored when the columns start or stop differing, so the
+// query list flags the query for a new capture.
+func (e *QueryExecutor) checkSchemaDrift(q *core.SavedQuery, result *ExecutionResult) bool {
+	schema, _ := ParseResponseSchema(q.ResponseSchema)
+	keys := result.Meta.RowKeys()
+	if schema == nil || len(keys) == 0 {
+		return false
+	}
+	drifted := !slices.Equal(schema.Names(), keys)
+	if drifted == (schema.DriftAt != nil) {
+		return drifted
+	}
+	schema.DriftAt, schema.DriftColumns = nil, nil
+	if drifted {
+		now := time.Now().UTC()
+		schema.DriftAt, schema.DriftColumns = &now, keys
+	}
+	encoded, err := schema.Encode()
+	if err == nil {
+		err = e.queryRepo.UpdateResponseSchema(q.ID, encoded)
+	}
+	if err != nil {
+		logger.Error.Printf("Failed to store the schema drift of query %s: %v", q.Slug, err)
+	}
+	return drifted
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNewResponseSchema(t *testing.T) {
+	result := &ExecutionResult{
+		Data: []map[string]interface{}{
+			{"id": int64(1), "total": nil, "price": "12.50", "paid_at": time.Now(), "note": nil},
+			{"id": int64(2), "total": json.Number("3.5"), "price": "7.00", "paid_at": nil, "note": nil},
+		},
+		ColumnTypes: []ResponseColumn{
+			{Name: "id", Type: "integer", DBType: "INTEGER"},
+			{Name: "total", DBType: ""},
+			{Name: "price", Type: "number", DBType: "DECIMAL"},
+			{Name: "paid_at", Type: "string", DBType: "TEXT"},
+			{Name: "note", Type: "string", DBType: "VARCHAR"},
+		},
+	}
+	schema, err := NewResponseSchema(result, 3, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"id":      "integer",
+		"total":   "number", // untyped expression, typed by its value
+		"price":   "string", // decimals answered as text
+		"paid_at": "string date-time",
+		"note":    "string", // only NULLs: the driver type
+	}
+	for _, c := range schema.Columns {
+		got := c.Type
+		if c.Format != "" {
+			got += " " + c.Format
+		}
+		if got != want[c.Name] {
+			t.Errorf("%s = %q, want %q", c.Name, got, want[c.Name])
+		}
+	}
+
+	encoded, err := schema.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ParseResponseSchema(encoded)
+	if err != nil || back.ConnectionID != 3 || len(back.Names()) != 5 {
+		t.Errorf("round trip = %+v, %v", back, err)
+	}
+	if rs, err := ParseResponseSchema(""); rs != nil || err != nil {
+		t.Errorf("empty schema = %v, %v", rs, err)
+	}
+}
+
+func TestResponseColumnTypes(t *testing.T) {
+	for dbType, want := range map[string]string{
+		"BIGINT":           "integer",
+		"INT4":             "integer",
+		"UNSIGNED INT":     "integer",
+		"NUMERIC(10,2)":    "number",
+		"DOUBLE PRECISION": "number",
+		"BIT":              "boolean",
+		"TIMESTAMPTZ":      "string",
+		"NVARCHAR":         "string",
+		"UNIQUEIDENTIFIER": "string",
+		"POINT":            "",
+		"INTERVAL":         "",
+	} {
+		if got, _ := dbTypeSchema(dbType); got != want {
+			t.Errorf("%s = %q, want %q", dbType, got, want)
+		}
+	}
+}
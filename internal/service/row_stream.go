@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// RowWriter receives the rows of a streamed execution, see WithRowWriter
+type RowWriter interface {
+	// WriteHeader gets the column names and the row keys (see
+	// MetaInfo.RowKeys) before the first row
+	WriteHeader(columns, keys []string) error
+	WriteRow(row map[string]interface{}) error
+}
+
+type rowStreamKey struct{}
+
+type rowStream struct {
+	w       RowWriter
+	timeout time.Duration
+}
+
+// WithRowWriter makes executions on ctx hand each row to w as it is read
+// instead of collecting them, so the result's Data stays empty. Streamed
+// executions are not capped by MAX_ROWS and time out after timeout instead of
+// the query timeout.
+func WithRowWriter(ctx context.Context, w RowWriter, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, rowStreamKey{}, &rowStream{w: w, timeout: timeout})
+}
+
+func rowStreamFrom(ctx context.Context) *rowStream {
+	s, _ := ctx.Value(rowStreamKey{}).(*rowStream)
+	return s
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The allowed schemas of a connection are a guard against queries reaching
+// schemas the connection's login can see but DbBridge should not expose. The
+// table references are found by a heuristic (core.SchemaRefs), so this is
+// defense in depth on top of database grants, never a replacement for them.
+
+var reSchemaEntry = regexp.MustCompile(`^[\w$#@]+(\.[\w$#@]+)*$`)
+
+// ParseAllowedSchemas reads a connection's allowed schemas: names separated by
+// commas or whitespace, "catalog.schema" for three-part table names. An empty
+// list allows every schema.
+func ParseAllowedSchemas(s string) ([]string, error) {
+	var schemas []string
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t' }) {
+		if !reSchemaEntry.MatchString(entry) {
+			return nil, fmt.Errorf("invalid schema name %q", entry)
+		}
+		schemas = append(schemas, entry)
+	}
+	return schemas, nil
+}
+
+// SchemaError rejects SQL that references schemas outside a connection's
+// allowed list
+type SchemaError struct {
+	Connection string
+	Schemas    []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("query references schema %s, which connection %s does not allow", strings.Join(e.Schemas, ", "), e.Connection)
+}
+
+// CheckSchemas returns a *SchemaError when sqlText references a schema
+// outside conn's allowed schemas. Unqualified table names are allowed: they
+// resolve to the login's default schema. Names compare case-insensitively.
+func CheckSchemas(conn *core.DBConnection, sqlText string) error {
+	allowed, _ := ParseAllowedSchemas(conn.AllowedSchemas)
+	if len(allowed) == 0 {
+		return nil
+	}
+	var denied []string
+	for _, ref := range core.SchemaRefs(sqlText) {
+		ok := false
+		for _, a := range allowed {
+			ok = ok || strings.EqualFold(ref, a)
+		}
+		if !ok {
+			denied = append(denied, ref)
+		}
+	}
+	if len(denied) > 0 {
+		return &SchemaError{Connection: conn.Name, Schemas: denied}
+	}
+	return nil
+}
+
+// checkSchemas applies CheckSchemas unless the saved query queryID has its
+// schema check acknowledged away; ad-hoc SQL is always checked
+func (e *QueryExecutor) checkSchemas(conn *core.DBConnection, sqlText string, queryID int64) error {
+	if strings.TrimSpace(conn.AllowedSchemas) == "" {
+		return nil
+	}
+	if queryID != 0 {
+		q, err := e.queryRepo.GetByID(queryID)
+		if err != nil {
+			return fmt.Errorf("query not found: %w", err)
+		}
+		if q.SkipSchemaCheck {
+			return nil
+		}
+	}
+	return CheckSchemas(conn, sqlText)
+}
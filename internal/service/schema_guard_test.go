@@ -0,0 +1,40 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseAllowedSchemas(t *testing.T) {
+	got, err := ParseAllowedSchemas("sales, reporting\nerp.dbo")
+	if err != nil || !reflect.DeepEqual(got, []string{"sales", "reporting", "erp.dbo"}) {
+		t.Errorf("ParseAllowedSchemas() = %q, %v", got, err)
+	}
+	if _, err := ParseAllowedSchemas("sales; DROP"); err == nil {
+		t.Error("ParseAllowedSchemas() accepted an invalid name")
+	}
+}
+
+func TestCheckSchemas(t *testing.T) {
+	conn := &core.DBConnection{Name: "erp", AllowedSchemas: "sales, erp.dbo"}
+	for _, sql := range []string{
+		"SELECT * FROM orders",
+		"SELECT * FROM SALES.orders JOIN erp.dbo.items ON 1 = 1",
+	} {
+		if err := CheckSchemas(conn, sql); err != nil {
+			t.Errorf("CheckSchemas(%q) = %v", sql, err)
+		}
+	}
+
+	err := CheckSchemas(conn, "SELECT * FROM sales.orders JOIN hr.employees ON 1 = 1")
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || !reflect.DeepEqual(schemaErr.Schemas, []string{"hr"}) {
+		t.Errorf("CheckSchemas() = %v, want a SchemaError for hr", err)
+	}
+
+	if err := CheckSchemas(&core.DBConnection{}, "SELECT * FROM hr.employees"); err != nil {
+		t.Errorf("CheckSchemas() without allowed schemas = %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"strings"
+)
+
+// defaultSessionTag is the SESSION_TAG_TEMPLATE used without settings
+const defaultSessionTag = "dbbridge/{query}/{key}"
+
+// sessionTagKey carries the session tag of an execution to openDB
+type sessionTagKey struct{}
+
+// withSessionTag labels the database sessions opened with ctx for an
+// execution of saved query queryID, from the SESSION_TAG_TEMPLATE setting:
+// {query} is the query's slug and {key} the calling API key's prefix, "-"
+// when there is none. An empty template or "off" tags nothing.
+func (e *QueryExecutor) withSessionTag(ctx context.Context, queryID int64) context.Context {
+	template := defaultSessionTag
+	if e.settings != nil {
+		template = e.settings.Get("SESSION_TAG_TEMPLATE")
+	}
+	if template = strings.TrimSpace(template); template == "" || template == "off" {
+		return ctx
+	}
+	slug, key := "-", "-"
+	if queryID != 0 {
+		if q, err := e.queryRepo.GetByID(queryID); err == nil {
+			slug = q.Slug
+		}
+	}
+	if prefix, _ := ctx.Value(core.ContextKeyApiKeyPrefix).(string); prefix != "" {
+		key = prefix
+	}
+	tag := strings.NewReplacer("{query}", slug, "{key}", key).Replace(template)
+	return context.WithValue(ctx, sessionTagKey{}, core.SanitizeSessionTag(tag))
+}
+
+// tagSession applies the session tag in ctx to a connection string for
+// dialects that support it (see core.SessionTagger), returning the setup
+// statements to run on each new session
+func tagSession(ctx context.Context, dsn string, dialect core.Dialect) (string, []string) {
+	tag, _ := ctx.Value(sessionTagKey{}).(string)
+	tagger, ok := dialect.(core.SessionTagger)
+	if tag == "" || !ok {
+		return dsn, nil
+	}
+	return tagger.SessionTag(dsn, tag)
+}
+
+// openWithSetup opens a database whose connections run setup statements as
+// soon as they are made, so every session of the pool gets them
+func openWithSetup(driverName, dsn string, setup []string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil || len(setup) == 0 {
+		return db, err
+	}
+	drv := db.Driver()
+	db.Close()
+
+	var connector driver.Connector = dsnConnector{dsn: dsn, driver: drv}
+	if dc, ok := drv.(driver.DriverContext); ok {
+		if connector, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+	return sql.OpenDB(setupConnector{Connector: connector, setup: setup}), nil
+}
+
+// dsnConnector is a driver.Connector for drivers without their own
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.driver }
+
+// setupConnector runs its statements on every new connection. A statement
+// that fails is logged: tagging a session must not fail the query.
+type setupConnector struct {
+	driver.Connector
+	setup []string
+}
+
+func (c setupConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range c.setup {
+		if err := execOnConn(ctx, conn, stmt); err != nil {
+			logger.Info.Printf("Session setup %q failed: %v", stmt, err)
+		}
+	}
+	return conn, nil
+}
+
+func execOnConn(ctx context.Context, conn driver.Conn, stmt string) error {
+	if ex, ok := conn.(driver.ExecerContext); ok {
+		_, err := ex.ExecContext(ctx, stmt, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+	prepared, err := conn.Prepare(stmt)
+	if err != nil {
+		return err
+	}
+	defer prepared.Close()
+	_, err = prepared.Exec(nil)
+	return err
+}
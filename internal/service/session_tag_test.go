@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenWithSetup(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "tagged.db")
+	db, err := openWithSetup("sqlite", dsn, []string{"CREATE TEMP TABLE session_tag (tag TEXT)", "INSERT INTO session_tag VALUES ('dbbridge/orders/ab12')"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Temp tables live in one session: every connection of the pool ran the setup
+	db.SetMaxIdleConns(0)
+	for i := 0; i < 3; i++ {
+		var tag string
+		if err := db.QueryRow("SELECT tag FROM session_tag").Scan(&tag); err != nil || tag != "dbbridge/orders/ab12" {
+			t.Fatalf("connection %d: %q, %v", i, tag, err)
+		}
+	}
+}
+
+func TestWithSessionTag(t *testing.T) {
+	e := &QueryExecutor{}
+	ctx := context.WithValue(context.Background(), core.ContextKeyApiKeyPrefix, "ab12cd34")
+	dsn, _ := tagSession(e.withSessionTag(ctx, 0), "host=db", core.PostgresDialect{})
+	if dsn != "host=db application_name=dbbridge/-/ab12cd34" {
+		t.Errorf("tagged dsn = %q", dsn)
+	}
+	if dsn, setup := tagSession(context.Background(), "host=db", core.PostgresDialect{}); dsn != "host=db" || setup != nil {
+		t.Errorf("untagged execution: %q, %q", dsn, setup)
+	}
+}
@@ -0,0 +1,405 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"dbbridge/internal/i18n"
+	"dbbridge/internal/logger"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// settingsCacheTTL bounds how long a change made by another instance takes to show up
+const settingsCacheTTL = 5 * time.Second
+
+type SettingType string
+
+const (
+	SettingInt    SettingType = "int"
+	SettingString SettingType = "string"
+	SettingEmails SettingType = "emails"
+	SettingSecret SettingType = "secret"
+	// SettingDrivers is a comma separated list of core.Drivers, empty = all
+	SettingDrivers SettingType = "drivers"
+	// SettingTimezone is an IANA time zone name, empty = server time zone
+	SettingTimezone SettingType = "timezone"
+)
+
+// SettingDef describes a runtime setting. Key is the environment variable
+// that provides its default.
+type SettingDef struct {
+	Key     string
+	Group   string
+	Label   string
+	Help    string
+	Type    SettingType
+	Min     int
+	Max     int
+	Options []string // allowed values for string settings, empty = any
+}
+
+// settingDefs lists the settings editable on the admin page, in display order
+var settingDefs = []SettingDef{
+	{Key: "QUERY_TIMEOUT_SECONDS", Group: "Execution", Label: "Query timeout (seconds)", Type: SettingInt, Min: 1, Max: 3600,
+		Help: "Applies to the connection check and the query itself."},
+	{Key: "MAX_ROWS", Group: "Execution", Label: "Max rows per result", Type: SettingInt, Min: 0, Max: 10000000,
+		Help: "Rows beyond this are not returned and the result is marked truncated. 0 = unlimited."},
+	{Key: "WARN_DURATION_MS", Group: "Execution", Label: "Warn above duration (ms)", Type: SettingInt, Min: 0, Max: 3600000,
+		Help: "Slower executions still succeed but get a slow_query warning and a WARN audit status. Queries can set their own. 0 = off."},
+	{Key: "WARN_ROWS", Group: "Execution", Label: "Warn above rows", Type: SettingInt, Min: 0, Max: 10000000,
+		Help: "Like the duration warning, for results with more rows (many_rows). 0 = off."},
+	{Key: "BUNDLE_MAX_MB", Group: "Execution", Label: "Max bundle size (MB)", Type: SettingInt, Min: 1, Max: 10240,
+		Help: "Zip bundles stop adding results past this size; the rest become error files."},
+	{Key: "SESSION_TAG_TEMPLATE", Group: "Execution", Label: "Database session tag", Type: SettingString,
+		Help: "Labels the database sessions of executions for DBAs: {query} is the query slug, {key} the API key prefix. PostgreSQL, SQL Server, MySQL, Oracle and Snowflake. off = no tag."},
+	{Key: "IDEMPOTENCY_TTL_HOURS", Group: "Execution", Label: "Idempotency key lifetime (hours)", Type: SettingInt, Min: 1, Max: 720,
+		Help: "Retries of write queries with the same Idempotency-Key get the stored response for this long."},
+	{Key: "EXPORT_RETENTION_HOURS", Group: "Execution", Label: "Export file lifetime (hours)", Type: SettingInt, Min: 1, Max: 720,
+		Help: "Background export files are deleted this long after they finish."},
+	{Key: "EXPORT_MAX_MB", Group: "Execution", Label: "Max export disk usage (MB)", Type: SettingInt, Min: 1, Max: 1048576,
+		Help: "All export files together; exports fail once they would exceed it."},
+	{Key: "EXPORT_TIMEOUT_MINUTES", Group: "Execution", Label: "Export timeout (minutes)", Type: SettingInt, Min: 1, Max: 1440,
+		Help: "Background exports run this long instead of the query timeout."},
+	{Key: "SNAPSHOT_MAX_ROWS", Group: "Execution", Label: "Max snapshot rows", Type: SettingInt, Min: 1, Max: 10000000,
+		Help: "Snapshot paging keeps the whole result in memory; larger results are refused."},
+	{Key: "SNAPSHOT_IDLE_MINUTES", Group: "Execution", Label: "Snapshot idle timeout (minutes)", Type: SettingInt, Min: 1, Max: 1440,
+		Help: "Snapshots not read for this long expire; clients then restart paging."},
+	{Key: "SNAPSHOT_MAX_PER_KEY", Group: "Execution", Label: "Max open snapshots per API key", Type: SettingInt, Min: 1, Max: 1000,
+		Help: "An API key opening more snapshots than this before its others expire gets 429."},
+	{Key: "SNAPSHOT_MAX_OPEN", Group: "Execution", Label: "Max open snapshots", Type: SettingInt, Min: 1, Max: 10000,
+		Help: "All API keys together; further snapshots are refused with 503 until others expire. Each holds up to the max snapshot rows in memory."},
+	{Key: "PROTECTED_MAX_ROWS", Group: "Execution", Label: "Max rows of test runs on protected connections", Type: SettingInt, Min: 1, Max: 100000,
+		Help: "Admin test runs on a connection marked protected stop after this many rows, whatever the query or MAX_ROWS allow."},
+	{Key: "PROTECTED_TIMEOUT_SECONDS", Group: "Execution", Label: "Timeout of test runs on protected connections (seconds)", Type: SettingInt, Min: 1, Max: 3600,
+		Help: "Admin test runs on a protected connection time out after this, or the query timeout if shorter."},
+	{Key: "SLUG_ALIAS_DEPRECATION", Group: "Execution", Label: "Deprecate old query slugs", Type: SettingString, Options: []string{"true", "false"},
+		Help: "Renamed queries still answer on their old slugs until the alias is retired. On, those responses carry Deprecation and Link headers pointing at the new slug and a deprecated warning."},
+
+	{Key: "SUPPORTED_DRIVERS", Group: "Drivers", Label: "Drivers for new connections", Type: SettingDrivers,
+		Help: "Comma-separated driver names: postgres, mysql, sqlserver, sqlite, oracle, snowflake, odbc. Empty = all. Others are left out of the connection form and refused on save."},
+	{Key: "DISABLED_DRIVER_CONNECTIONS", Group: "Drivers", Label: "Connections on other drivers", Type: SettingString, Options: []string{"run", "block"},
+		Help: "Saved connections on a driver no longer listed above keep running (run) or fail every execution (block)."},
+
+	{Key: "API_RATE_LIMIT", Group: "Rate Limits", Label: "API requests per minute", Type: SettingInt, Min: 1, Max: 1000000},
+	{Key: "API_RATE_BURST", Group: "Rate Limits", Label: "API burst", Type: SettingInt, Min: 1, Max: 1000000},
+	{Key: "ADMIN_RATE_LIMIT", Group: "Rate Limits", Label: "Admin requests per minute", Type: SettingInt, Min: 1, Max: 1000000},
+	{Key: "ADMIN_RATE_BURST", Group: "Rate Limits", Label: "Admin burst", Type: SettingInt, Min: 1, Max: 1000000},
+	{Key: "LOGIN_RATE_LIMIT", Group: "Rate Limits", Label: "Login attempts per minute", Type: SettingInt, Min: 1, Max: 1000},
+	{Key: "LOGIN_RATE_BURST", Group: "Rate Limits", Label: "Login burst", Type: SettingInt, Min: 1, Max: 1000},
+	{Key: "EMBED_RATE_LIMIT", Group: "Rate Limits", Label: "Embed views per minute", Type: SettingInt, Min: 1, Max: 100000,
+		Help: "Per embed token, across every page showing it."},
+	{Key: "EMBED_RATE_BURST", Group: "Rate Limits", Label: "Embed burst", Type: SettingInt, Min: 1, Max: 100000},
+	{Key: "API_DAILY_QUOTA", Group: "Rate Limits", Label: "API requests per key and day", Type: SettingInt, Min: 0, Max: 1000000000,
+		Help: "Keys past it get 429 until the day ends. Counts survive restarts. 0 = unlimited."},
+	{Key: "QUOTA_TIMEZONE", Group: "Rate Limits", Label: "Quota time zone", Type: SettingTimezone,
+		Help: "Where quota days start at midnight, e.g. Asia/Jakarta. Empty = server time zone."},
+
+	{Key: "AUDIT_RETENTION_ROWS", Group: "Audit", Label: "Audit log entries kept", Type: SettingInt, Min: 100, Max: 10000000,
+		Help: "Older entries are deleted as new ones are written."},
+	{Key: "ACCESS_EVENT_RETENTION_HOURS", Group: "Audit", Label: "Access events kept (hours)", Type: SettingInt, Min: 1, Max: 8760,
+		Help: "Rejected and failed API requests (see Logs, Access events) are deleted after this long."},
+	{Key: "DEBUG_CAPTURE", Group: "Audit", Label: "Debug capture", Type: SettingString, Options: []string{"true", "false"},
+		Help: "Queries with debug capture store the final SQL and argument types of each execution with its audit entry. Off turns capture off for every query."},
+	{Key: "AUDIT_REPLAY_WRITES", Group: "Audit", Label: "Replay queries that write", Type: SettingString, Options: []string{"true", "false"},
+		Help: "Audit entries of query executions can be replayed. On, queries that write can be replayed too, after a confirmation."},
+
+	{Key: "SMTP_HOST", Group: "Email Notifications", Label: "SMTP host", Type: SettingString},
+	{Key: "SMTP_PORT", Group: "Email Notifications", Label: "SMTP port", Type: SettingInt, Min: 1, Max: 65535},
+	{Key: "SMTP_TLS", Group: "Email Notifications", Label: "TLS mode", Type: SettingString, Options: []string{"starttls", "tls", "none"}},
+	{Key: "SMTP_USERNAME", Group: "Email Notifications", Label: "SMTP username", Type: SettingString},
+	{Key: "SMTP_PASSWORD", Group: "Email Notifications", Label: "SMTP password", Type: SettingSecret},
+	{Key: "SMTP_FROM", Group: "Email Notifications", Label: "From address", Type: SettingEmails},
+	{Key: "NOTIFY_EMAIL_TO", Group: "Email Notifications", Label: "Recipients", Type: SettingEmails,
+		Help: "Comma-separated."},
+	{Key: "NOTIFY_THROTTLE_MINUTES", Group: "Email Notifications", Label: "Throttle (minutes per event type and connection)", Type: SettingInt, Min: 0, Max: 10080},
+
+	{Key: "DEFAULT_LOCALE", Group: "Language", Label: "Default language", Type: SettingString, Options: i18n.Locales(),
+		Help: "Admin UI language for users who have not picked one in My Profile, and the language of email notifications."},
+
+	{Key: "MAINTENANCE_MODE", Group: "Maintenance", Label: "Maintenance mode", Type: SettingString, Options: []string{"false", "true"},
+		Help: "While on, API executions answer 503. Docs and the admin UI keep working."},
+	{Key: "MAINTENANCE_MESSAGE", Group: "Maintenance", Label: "Message", Type: SettingString},
+	{Key: "MAINTENANCE_RETRY_AFTER", Group: "Maintenance", Label: "Retry-After (seconds)", Type: SettingInt, Min: 1, Max: 86400},
+	{Key: "MAINTENANCE_CONNECTIONS", Group: "Maintenance", Label: "Connections", Type: SettingString,
+		Help: "Comma-separated connection names to put in maintenance. Empty = all connections."},
+	{Key: "ORPHAN_CLEANUP", Group: "Maintenance", Label: "Weekly orphan cleanup", Type: SettingString, Options: []string{"false", "true"},
+		Help: "Removes rows left pointing at deleted users, queries, connections and API keys once a week. See Orphaned Data."},
+	{Key: "INACTIVE_KEY_DISABLE", Group: "Maintenance", Label: "Disable unused API keys", Type: SettingString, Options: []string{"false", "true"},
+		Help: "Once a day, API keys not used for the days below are disabled and the recipients of email notifications get the list. Admins can re-enable them on the API Keys page."},
+	{Key: "INACTIVE_KEY_DAYS", Group: "Maintenance", Label: "Unused API key threshold (days)", Type: SettingInt, Min: 1, Max: 3650,
+		Help: "Counted from a key's last use, creation or re-enabling, whichever is latest."},
+}
+
+// SettingsService resolves runtime settings: a value stored in the database
+// wins, otherwise the env-derived default from fallback is used. Stored values
+// are cached for settingsCacheTTL; secrets are stored encrypted.
+type SettingsService struct {
+	repo      core.SettingsRepository
+	auditRepo core.AuditRepository
+	cryptoSvc *EncryptionService
+	fallback  func(key string) string
+
+	mu       sync.Mutex
+	cache    map[string]string
+	loadedAt time.Time
+	hooks    []func()
+}
+
+func NewSettingsService(repo core.SettingsRepository, auditRepo core.AuditRepository, cryptoSvc *EncryptionService, fallback func(key string) string) *SettingsService {
+	return &SettingsService{
+		repo:      repo,
+		auditRepo: auditRepo,
+		cryptoSvc: cryptoSvc,
+		fallback:  fallback,
+	}
+}
+
+// Defs returns the editable settings in display order
+func (s *SettingsService) Defs() []SettingDef {
+	return settingDefs
+}
+
+func findSettingDef(key string) (SettingDef, bool) {
+	for _, d := range settingDefs {
+		if d.Key == key {
+			return d, true
+		}
+	}
+	return SettingDef{}, false
+}
+
+// OnChange registers a function called after settings change, either through
+// Update or when a refresh picks up a change made by another instance
+func (s *SettingsService) OnChange(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, fn)
+}
+
+// overrides returns the cached database values, refreshing them when stale
+func (s *SettingsService) overrides() map[string]string {
+	s.mu.Lock()
+	if s.cache != nil && time.Since(s.loadedAt) < settingsCacheTTL {
+		cache := s.cache
+		s.mu.Unlock()
+		return cache
+	}
+
+	fresh, err := s.repo.GetAll()
+	if err != nil {
+		// Keep serving the last known values rather than silently reverting to env
+		logger.Error.Printf("Failed to load settings: %v", err)
+		if s.cache == nil {
+			s.cache = map[string]string{}
+		}
+		s.loadedAt = time.Now()
+		cache := s.cache
+		s.mu.Unlock()
+		return cache
+	}
+
+	changed := s.cache != nil && !equalSettings(s.cache, fresh)
+	s.cache = fresh
+	s.loadedAt = time.Now()
+	hooks := s.hooks
+	s.mu.Unlock()
+
+	if changed {
+		for _, fn := range hooks {
+			fn()
+		}
+	}
+	return fresh
+}
+
+func equalSettings(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// IsOverridden reports whether key has a value stored in the database
+func (s *SettingsService) IsOverridden(key string) bool {
+	_, ok := s.overrides()[key]
+	return ok
+}
+
+// Get returns the effective value of key
+func (s *SettingsService) Get(key string) string {
+	if v, ok := s.overrides()[key]; ok {
+		if def, _ := findSettingDef(key); def.Type == SettingSecret {
+			plain, err := s.cryptoSvc.Decrypt(v)
+			if err != nil {
+				logger.Error.Printf("Failed to decrypt setting %s, using default: %v", key, err)
+				return s.fallback(key)
+			}
+			return plain
+		}
+		return v
+	}
+	return s.fallback(key)
+}
+
+// Default returns the env-derived value of key, ignoring any override
+func (s *SettingsService) Default(key string) string {
+	return s.fallback(key)
+}
+
+func (s *SettingsService) Int(key string) int {
+	v, _ := strconv.Atoi(s.Get(key))
+	return v
+}
+
+// List splits a comma separated setting, dropping empty entries
+func (s *SettingsService) List(key string) []string {
+	var list []string
+	for _, v := range strings.Split(s.Get(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// Validate checks a value against the setting's definition
+func (d SettingDef) Validate(value string) error {
+	switch d.Type {
+	case SettingInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", d.Label, value)
+		}
+		if n < d.Min || n > d.Max {
+			return fmt.Errorf("%s: must be between %d and %d", d.Label, d.Min, d.Max)
+		}
+	case SettingEmails:
+		for _, addr := range strings.Split(value, ",") {
+			if _, err := mail.ParseAddress(strings.TrimSpace(addr)); err != nil {
+				return fmt.Errorf("%s: %q is not an email address", d.Label, strings.TrimSpace(addr))
+			}
+		}
+	case SettingDrivers:
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" && !core.KnownDriver(name) {
+				return fmt.Errorf("%s: %q is not one of %s", d.Label, name, strings.Join(core.Drivers(), ", "))
+			}
+		}
+	case SettingTimezone:
+		if _, err := time.LoadLocation(value); err != nil {
+			return fmt.Errorf("%s: %q is not a time zone", d.Label, value)
+		}
+	case SettingString:
+		if len(d.Options) > 0 {
+			for _, o := range d.Options {
+				if value == o {
+					return nil
+				}
+			}
+			return fmt.Errorf("%s: must be one of %s", d.Label, strings.Join(d.Options, ", "))
+		}
+	}
+	return nil
+}
+
+// SettingChange is one requested edit. Reset removes the override so the env
+// default applies again.
+type SettingChange struct {
+	Key   string
+	Value string
+	Reset bool
+}
+
+// Update validates all changes first and applies none if any is invalid.
+// Each applied change is audit-logged with its old and new value (secrets redacted).
+func (s *SettingsService) Update(userID int64, changes []SettingChange) error {
+	for _, c := range changes {
+		def, ok := findSettingDef(c.Key)
+		if !ok {
+			return fmt.Errorf("unknown setting %q", c.Key)
+		}
+		if !c.Reset {
+			if err := def.Validate(c.Value); err != nil {
+				return err
+			}
+		}
+	}
+
+	applied := 0
+	for _, c := range changes {
+		def, _ := findSettingDef(c.Key)
+		old := s.Get(c.Key)
+		wasOverridden := s.IsOverridden(c.Key)
+
+		var err error
+		switch {
+		case c.Reset && !wasOverridden:
+			continue
+		case c.Reset:
+			err = s.repo.Delete(c.Key)
+		case c.Value == old:
+			continue
+		case def.Type == SettingSecret:
+			var enc string
+			if enc, err = s.cryptoSvc.Encrypt(c.Value); err == nil {
+				err = s.repo.Set(c.Key, enc)
+			}
+		default:
+			err = s.repo.Set(c.Key, c.Value)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save %s: %w", def.Label, err)
+		}
+		applied++
+
+		s.invalidate()
+		s.audit(userID, def, old, s.Get(c.Key), c.Reset)
+	}
+
+	if applied > 0 {
+		s.mu.Lock()
+		hooks := s.hooks
+		s.mu.Unlock()
+		for _, fn := range hooks {
+			fn()
+		}
+	}
+	return nil
+}
+
+func (s *SettingsService) invalidate() {
+	s.mu.Lock()
+	s.cache = nil
+	s.mu.Unlock()
+}
+
+func (s *SettingsService) audit(userID int64, def SettingDef, oldValue, newValue string, reset bool) {
+	if def.Type == SettingSecret {
+		oldValue, newValue = redact(oldValue), redact(newValue)
+	}
+	change := FieldChange{Old: oldValue, New: newValue}
+	if reset {
+		change.New = "(default) " + newValue
+	}
+	NewAdminAuditor(s.auditRepo).Record(AdminEvent{
+		Type:    core.EventSettingsUpdate,
+		UserID:  userID,
+		Target:  "setting " + def.Key,
+		Changes: AuditChanges{"value": change},
+	})
+}
+
+func redact(v string) string {
+	if v == "" {
+		return ""
+	}
+	return "********"
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type memSettingsRepo map[string]string
+
+func (r memSettingsRepo) GetAll() (map[string]string, error) {
+	out := make(map[string]string, len(r))
+	for k, v := range r {
+		out[k] = v
+	}
+	return out, nil
+}
+func (r memSettingsRepo) Set(key, value string) error { r[key] = value; return nil }
+func (r memSettingsRepo) Delete(key string) error     { delete(r, key); return nil }
+
+func newTestSettings(t *testing.T) (*SettingsService, memSettingsRepo, *memAuditRepo) {
+	t.Helper()
+	crypto, err := NewEncryptionService(strings.Repeat("k", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := memSettingsRepo{}
+	audit := &memAuditRepo{cursors: map[string]int64{}}
+	env := map[string]string{"MAX_ROWS": "0", "SMTP_PASSWORD": "from-env"}
+	return NewSettingsService(repo, audit, crypto, func(key string) string { return env[key] }), repo, audit
+}
+
+func TestSettingsService_OverrideAndReset(t *testing.T) {
+	s, _, audit := newTestSettings(t)
+	changed := 0
+	s.OnChange(func() { changed++ })
+
+	if err := s.Update(1, []SettingChange{{Key: "MAX_ROWS", Value: "500"}}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got := s.Int("MAX_ROWS"); got != 500 {
+		t.Errorf("MAX_ROWS = %d, want 500", got)
+	}
+	if err := s.Update(1, []SettingChange{{Key: "MAX_ROWS", Reset: true}}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got := s.Get("MAX_ROWS"); got != "0" {
+		t.Errorf("MAX_ROWS after reset = %q, want env default 0", got)
+	}
+
+	if changed != 2 {
+		t.Errorf("OnChange called %d times, want 2", changed)
+	}
+	if len(audit.logs) != 2 || !strings.Contains(audit.logs[0].Params, `"new":"500"`) {
+		t.Errorf("audit logs = %+v, want two entries with old/new values", audit.logs)
+	}
+}
+
+func TestSettingsService_RejectsInvalidBatch(t *testing.T) {
+	s, repo, _ := newTestSettings(t)
+	err := s.Update(1, []SettingChange{
+		{Key: "MAX_ROWS", Value: "10"},
+		{Key: "QUERY_TIMEOUT_SECONDS", Value: "0"},
+	})
+	if err == nil {
+		t.Fatal("Update() accepted a timeout of 0")
+	}
+	if len(repo) != 0 {
+		t.Errorf("valid change applied despite invalid one in the same batch: %v", repo)
+	}
+}
+
+func TestSettingsService_SecretsEncryptedAndRedacted(t *testing.T) {
+	s, repo, audit := newTestSettings(t)
+	if err := s.Update(1, []SettingChange{{Key: "SMTP_PASSWORD", Value: "hunter2"}}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if repo["SMTP_PASSWORD"] == "hunter2" {
+		t.Error("secret stored in plain text")
+	}
+	if got := s.Get("SMTP_PASSWORD"); got != "hunter2" {
+		t.Errorf("Get() = %q, want decrypted value", got)
+	}
+	if p := audit.logs[0].Params; strings.Contains(p, "hunter2") || strings.Contains(p, "from-env") {
+		t.Errorf("audit entry leaks secret: %s", p)
+	}
+}
+
+func TestSettingsService_Maintenance(t *testing.T) {
+	s, repo, audit := newTestSettings(t)
+	if s.Maintenance().Blocks("erp") {
+		t.Fatal("maintenance active by default")
+	}
+
+	if err := s.SetMaintenance(1, true); err != nil {
+		t.Fatalf("SetMaintenance() error = %v", err)
+	}
+	if repo["MAINTENANCE_MODE"] != "true" || len(audit.logs) != 1 {
+		t.Errorf("stored %q with %d audit entries", repo["MAINTENANCE_MODE"], len(audit.logs))
+	}
+	if !s.Maintenance().Blocks("erp") {
+		t.Error("maintenance without connections does not block erp")
+	}
+
+	if err := s.Update(1, []SettingChange{{Key: "MAINTENANCE_CONNECTIONS", Value: "ERP, warehouse"}}); err != nil {
+		t.Fatal(err)
+	}
+	m := s.Maintenance()
+	if !m.Blocks("erp") || !m.Blocks("warehouse") || m.Blocks("crm") {
+		t.Errorf("scoped maintenance %+v blocks the wrong connections", m)
+	}
+
+	s.SetMaintenance(1, false)
+	if s.Maintenance().Blocks("erp") {
+		t.Error("maintenance still active after switching it off")
+	}
+}
+
+func TestDriverRegistry(t *testing.T) {
+	s, _, _ := newTestSettings(t)
+	drivers := NewDriverRegistry(s)
+	if !drivers.Enabled("odbc") || drivers.CheckRun("odbc") != nil {
+		t.Error("drivers not all enabled without SUPPORTED_DRIVERS")
+	}
+	if err := s.Update(1, []SettingChange{{Key: "SUPPORTED_DRIVERS", Value: "sqlite, PostgreSQL, db2"}}); err == nil {
+		t.Error("unknown driver db2 accepted")
+	}
+	if err := s.Update(1, []SettingChange{{Key: "SUPPORTED_DRIVERS", Value: "sqlite, PostgreSQL"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !drivers.Enabled("postgres") || !drivers.Enabled("sqlite3") || drivers.Enabled("odbc") {
+		t.Error("enabled drivers do not follow SUPPORTED_DRIVERS")
+	}
+	for _, o := range drivers.Options() {
+		if o.Enabled != (o.Driver == "sqlite" || o.Driver == "postgres") {
+			t.Errorf("preset %s enabled = %v", o.Key, o.Enabled)
+		}
+	}
+	if err := drivers.CheckRun("odbc"); err != nil {
+		t.Errorf("disabled driver refused to run by default: %v", err)
+	}
+	if err := s.Update(1, []SettingChange{{Key: "DISABLED_DRIVER_CONNECTIONS", Value: "block"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := drivers.CheckRun("odbc"); !errors.Is(err, ErrDriverDisabled) {
+		t.Errorf("CheckRun(odbc) = %v, want ErrDriverDisabled", err)
+	}
+	if err := drivers.CheckRun("sqlite"); err != nil {
+		t.Errorf("CheckRun(sqlite) = %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ShapeConfig folds flat joined rows into nested JSON. Rows sharing the Key
+// columns become one parent object holding every column not listed in a child
+// group; each child group becomes an array of objects on the parent, e.g.
+//
+//	{"key": ["order_id"], "children": {"lines": ["line_no", "sku", "qty"]}}
+type ShapeConfig struct {
+	Key      []string            `json:"key"`
+	Children map[string][]string `json:"children"`
+}
+
+// ParseShapeConfig parses and checks a query's shaping config. An empty string
+// means no shaping and returns nil.
+func ParseShapeConfig(s string) (*ShapeConfig, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var cfg ShapeConfig
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid shaping config: %w", err)
+	}
+	if len(cfg.Key) == 0 {
+		return nil, fmt.Errorf("invalid shaping config: \"key\" needs at least one column")
+	}
+	if len(cfg.Children) == 0 {
+		return nil, fmt.Errorf("invalid shaping config: \"children\" needs at least one group")
+	}
+
+	seen := make(map[string]string)
+	for _, k := range cfg.Key {
+		seen[strings.ToLower(k)] = "key"
+	}
+	for name, cols := range cfg.Children {
+		if name == "" || len(cols) == 0 {
+			return nil, fmt.Errorf("invalid shaping config: child group %q needs a name and at least one column", name)
+		}
+		for _, c := range cols {
+			if other, dup := seen[strings.ToLower(c)]; dup {
+				return nil, fmt.Errorf("invalid shaping config: column %q is in both %s and %s", c, other, name)
+			}
+			seen[strings.ToLower(c)] = name
+		}
+	}
+	return &cfg, nil
+}
+
+// Apply folds rows into parents in order of first appearance. NULL key values
+// group together like GROUP BY does. A child whose columns are all NULL (the
+// unmatched side of a LEFT JOIN) is left out, so a parent without children
+// gets an empty array. Configured columns missing from the result are
+// reported, since the query and its config are edited separately.
+func (cfg *ShapeConfig) Apply(rows []map[string]interface{}, columns []string) ([]map[string]interface{}, error) {
+	present := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		present[c] = true
+	}
+	var missing []string
+	for _, c := range cfg.Key {
+		if !present[c] {
+			missing = append(missing, c)
+		}
+	}
+	childOf := make(map[string]string)
+	for name, cols := range cfg.Children {
+		if present[name] {
+			return nil, fmt.Errorf("shaping: child group %q has the same name as a result column", name)
+		}
+		for _, c := range cols {
+			if !present[c] {
+				missing = append(missing, c)
+			}
+			childOf[c] = name
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("shaping: columns %s are not in the query result (available: %s)",
+			strings.Join(missing, ", "), strings.Join(columns, ", "))
+	}
+
+	shaped := []map[string]interface{}{}
+	parents := make(map[string]map[string]interface{})
+
+	for _, row := range rows {
+		key, err := shapeKey(row, cfg.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		parent, ok := parents[key]
+		if !ok {
+			parent = make(map[string]interface{}, len(columns)-len(childOf)+len(cfg.Children))
+			for _, c := range columns {
+				if _, isChild := childOf[c]; !isChild {
+					parent[c] = row[c]
+				}
+			}
+			for name := range cfg.Children {
+				parent[name] = []map[string]interface{}{}
+			}
+			parents[key] = parent
+			shaped = append(shaped, parent)
+		}
+
+		for name, cols := range cfg.Children {
+			child := make(map[string]interface{}, len(cols))
+			allNull := true
+			for _, c := range cols {
+				child[c] = row[c]
+				if row[c] != nil {
+					allNull = false
+				}
+			}
+			if !allNull {
+				parent[name] = append(parent[name].([]map[string]interface{}), child)
+			}
+		}
+	}
+	return shaped, nil
+}
+
+// shapeKey encodes the key columns of row, keeping NULL apart from ""
+func shapeKey(row map[string]interface{}, key []string) (string, error) {
+	values := make([]interface{}, len(key))
+	for i, k := range key {
+		values[i] = row[k]
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("shaping: key %v: %w", key, err)
+	}
+	return string(b), nil
+}
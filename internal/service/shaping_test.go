@@ -0,0 +1,77 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseShapeConfig(t *testing.T) {
+	if cfg, err := ParseShapeConfig("  "); cfg != nil || err != nil {
+		t.Errorf("empty config = %v, %v, want nil, nil", cfg, err)
+	}
+
+	invalid := map[string]string{
+		"bad json":        `{"key": [`,
+		"no key":          `{"children": {"lines": ["sku"]}}`,
+		"no children":     `{"key": ["id"]}`,
+		"empty group":     `{"key": ["id"], "children": {"lines": []}}`,
+		"key in child":    `{"key": ["id"], "children": {"lines": ["id", "sku"]}}`,
+		"unknown field":   `{"key": ["id"], "children": {"lines": ["sku"]}, "nest": true}`,
+		"column in twice": `{"key": ["id"], "children": {"a": ["sku"], "b": ["SKU"]}}`,
+	}
+	for name, s := range invalid {
+		if _, err := ParseShapeConfig(s); err == nil {
+			t.Errorf("%s: ParseShapeConfig(%s) error = nil", name, s)
+		}
+	}
+}
+
+func TestShapeConfigApply(t *testing.T) {
+	cfg, err := ParseShapeConfig(`{"key": ["order_id"], "children": {"lines": ["line_no", "sku"]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := []string{"order_id", "customer", "line_no", "sku"}
+	rows := []map[string]interface{}{
+		{"order_id": int64(2), "customer": "bob", "line_no": int64(1), "sku": "A"},
+		{"order_id": int64(1), "customer": "ann", "line_no": int64(1), "sku": "B"},
+		{"order_id": int64(2), "customer": "bob", "line_no": int64(2), "sku": "C"},
+		{"order_id": int64(3), "customer": "cid", "line_no": nil, "sku": nil}, // order without lines
+		{"order_id": nil, "customer": "x", "line_no": int64(1), "sku": "D"},
+		{"order_id": nil, "customer": "x", "line_no": int64(2), "sku": "E"},
+	}
+
+	shaped, err := cfg.Apply(rows, columns)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	if len(shaped) != 4 {
+		t.Fatalf("len(shaped) = %d, want 4", len(shaped))
+	}
+	wantOrder := []interface{}{int64(2), int64(1), int64(3), nil}
+	wantLines := []int{2, 1, 0, 2}
+	for i, parent := range shaped {
+		if parent["order_id"] != wantOrder[i] {
+			t.Errorf("parent %d order_id = %v, want %v (first appearance order)", i, parent["order_id"], wantOrder[i])
+		}
+		lines := parent["lines"].([]map[string]interface{})
+		if len(lines) != wantLines[i] {
+			t.Errorf("parent %d has %d lines, want %d", i, len(lines), wantLines[i])
+		}
+		if _, ok := parent["sku"]; ok {
+			t.Errorf("parent %d keeps child column sku", i)
+		}
+	}
+	if shaped[0]["lines"].([]map[string]interface{})[1]["sku"] != "C" {
+		t.Errorf("child order not preserved: %v", shaped[0]["lines"])
+	}
+}
+
+func TestShapeConfigApplyMissingColumns(t *testing.T) {
+	cfg, _ := ParseShapeConfig(`{"key": ["order_id"], "children": {"lines": ["line_no", "qty"]}}`)
+	_, err := cfg.Apply(nil, []string{"order_id", "line_no"})
+	if err == nil || !strings.Contains(err.Error(), "qty") || !strings.Contains(err.Error(), "available: order_id, line_no") {
+		t.Errorf("Apply() error = %v, want missing qty with available columns", err)
+	}
+}
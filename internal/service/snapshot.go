@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"dbbridge/internal/core"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshotSweepInterval is how often Run drops idle snapshots
+const snapshotSweepInterval = time.Minute
+
+// ErrSnapshotExpired is a paging token whose snapshot has expired, never
+// existed or belongs to another API key; the client restarts paging
+var ErrSnapshotExpired = errors.New("snapshot expired, restart paging without a token")
+
+// SnapshotTooLargeError is a result with more rows than a snapshot may hold
+type SnapshotTooLargeError struct {
+	MaxRows int
+}
+
+func (e *SnapshotTooLargeError) Error() string {
+	return fmt.Sprintf("result has more than %d rows, the snapshot limit (SNAPSHOT_MAX_ROWS)", e.MaxRows)
+}
+
+// SnapshotLimitError is a snapshot refused because too many are open: those
+// of the API key when PerKey, otherwise those of every key
+type SnapshotLimitError struct {
+	Limit  int
+	PerKey bool
+}
+
+func (e *SnapshotLimitError) Error() string {
+	if e.PerKey {
+		return fmt.Sprintf("this API key has %d snapshots open, the limit (SNAPSHOT_MAX_PER_KEY); page through or let one expire first", e.Limit)
+	}
+	return fmt.Sprintf("%d snapshots are open, the limit (SNAPSHOT_MAX_OPEN); retry later", e.Limit)
+}
+
+// snapshot is the materialized result of one execution, read in chunks
+type snapshot struct {
+	id        string
+	apiKeyID  int64
+	columns   []string
+	keys      []string // nil unless columns repeat
+	rows      []map[string]interface{}
+	chunkSize int
+	lastUsed  time.Time
+}
+
+// SnapshotPage is one chunk of a snapshot
+type SnapshotPage struct {
+	Data      []map[string]interface{}
+	Columns   []string
+	Keys      []string // the row keys when columns repeat, see MetaInfo.Keys
+	Offset    int      // of the first row in Data
+	Total     int
+	NextToken string // "" on the last chunk
+	ExpiresAt time.Time
+}
+
+// SnapshotStore runs queries into in-memory snapshots so that clients page
+// through a stable result: rows inserted or deleted between pages cause no
+// duplicates or gaps. Each page is addressed by its own token, so a retried
+// request gets the same page again. Snapshots are dropped once they have been
+// idle too long, and the number open, per API key and in all, is capped so
+// that the rows held in memory are bounded.
+type SnapshotStore struct {
+	executor *QueryExecutor
+	maxRows  func() int
+	idle     func() time.Duration
+	timeout  func() time.Duration
+	perKey   func() int // 0 = unlimited
+	total    func() int // 0 = unlimited
+
+	mu        sync.Mutex
+	snapshots map[string]*snapshot
+	opening   map[int64]int // executions under way per API key, counted as open
+}
+
+// NewSnapshotStore caps snapshots at maxRows rows and expires them after
+// idle; executions run for up to timeout. All are read when used.
+func NewSnapshotStore(executor *QueryExecutor, maxRows func() int, idle, timeout func() time.Duration) *SnapshotStore {
+	return &SnapshotStore{
+		executor:  executor,
+		maxRows:   maxRows,
+		idle:      idle,
+		timeout:   timeout,
+		perKey:    func() int { return 0 },
+		total:     func() int { return 0 },
+		snapshots: map[string]*snapshot{},
+		opening:   map[int64]int{},
+	}
+}
+
+// SetLimits caps the snapshots open per API key and in all. Both are read
+// when a snapshot is opened.
+func (s *SnapshotStore) SetLimits(perKey, total func() int) {
+	s.perKey = perKey
+	s.total = total
+}
+
+// Open runs a query on the connection named connName into a new snapshot for
+// ctx's API key and returns its first chunk of chunkSize rows
+func (s *SnapshotStore) Open(ctx context.Context, connName, querySlug string, params map[string]interface{}, chunkSize int) (*SnapshotPage, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	apiKeyID, _ := ctx.Value(core.ContextKeyApiKeyID).(int64)
+	if err := s.reserve(apiKeyID); err != nil {
+		return nil, err
+	}
+	snap := &snapshot{id: hex.EncodeToString(id), apiKeyID: apiKeyID, chunkSize: max(chunkSize, 1)}
+	w := &snapshotWriter{snap: snap, maxRows: s.maxRows()}
+	_, err := s.executor.ExecuteByName(WithRowWriter(ctx, w, s.timeout()), connName, querySlug, params)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opening[apiKeyID]--; s.opening[apiKeyID] == 0 {
+		delete(s.opening, apiKeyID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	snap.lastUsed = time.Now()
+	s.snapshots[snap.id] = snap
+	return s.page(snap, 0), nil
+}
+
+// reserve counts a snapshot of apiKeyID as opening, unless that would exceed
+// a limit. Expired snapshots not swept yet do not count.
+func (s *SnapshotStore) reserve(apiKeyID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	open, own := 0, s.opening[apiKeyID]
+	for _, n := range s.opening {
+		open += n
+	}
+	for _, snap := range s.snapshots {
+		if s.expired(snap) {
+			continue
+		}
+		open++
+		if snap.apiKeyID == apiKeyID {
+			own++
+		}
+	}
+	if limit := s.perKey(); limit > 0 && own >= limit {
+		return &SnapshotLimitError{Limit: limit, PerKey: true}
+	}
+	if limit := s.total(); limit > 0 && open >= limit {
+		return &SnapshotLimitError{Limit: limit}
+	}
+	s.opening[apiKeyID]++
+	return nil
+}
+
+// snapshotWriter collects the rows of a snapshot up to maxRows
+type snapshotWriter struct {
+	snap    *snapshot
+	maxRows int
+}
+
+func (w *snapshotWriter) WriteHeader(columns, keys []string) error {
+	w.snap.columns = columns
+	if _, dup := dedupeColumns(columns); dup {
+		w.snap.keys = keys
+	}
+	return nil
+}
+
+func (w *snapshotWriter) WriteRow(row map[string]interface{}) error {
+	if w.maxRows > 0 && len(w.snap.rows) >= w.maxRows {
+		return &SnapshotTooLargeError{MaxRows: w.maxRows}
+	}
+	w.snap.rows = append(w.snap.rows, row)
+	return nil
+}
+
+// Page returns the chunk a token from an earlier page points to. Tokens of
+// other API keys fail like expired ones.
+func (s *SnapshotStore) Page(ctx context.Context, token string) (*SnapshotPage, error) {
+	id, offsetStr, _ := strings.Cut(token, ".")
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil || offset < 0 {
+		return nil, ErrSnapshotExpired
+	}
+	apiKeyID, _ := ctx.Value(core.ContextKeyApiKeyID).(int64)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.snapshots[id]
+	if !ok || snap.apiKeyID != apiKeyID || offset > len(snap.rows) || s.expired(snap) {
+		return nil, ErrSnapshotExpired
+	}
+	snap.lastUsed = time.Now()
+	return s.page(snap, offset), nil
+}
+
+// page cuts the chunk at offset; s.mu must be held
+func (s *SnapshotStore) page(snap *snapshot, offset int) *SnapshotPage {
+	end := min(offset+snap.chunkSize, len(snap.rows))
+	p := &SnapshotPage{
+		Data:      snap.rows[offset:end],
+		Columns:   snap.columns,
+		Keys:      snap.keys,
+		Offset:    offset,
+		Total:     len(snap.rows),
+		ExpiresAt: snap.lastUsed.Add(s.idle()),
+	}
+	if end < len(snap.rows) {
+		p.NextToken = snap.id + "." + strconv.Itoa(end)
+	}
+	return p
+}
+
+// expired reports a snapshot idle for too long; s.mu must be held
+func (s *SnapshotStore) expired(snap *snapshot) bool {
+	return !time.Now().Before(snap.lastUsed.Add(s.idle()))
+}
+
+// Run drops expired snapshots every snapshotSweepInterval until ctx is
+// cancelled
+func (s *SnapshotStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(snapshotSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sweep()
+		}
+	}
+}
+
+// Sweep drops the snapshots that have expired
+func (s *SnapshotStore) Sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, snap := range s.snapshots {
+		if s.expired(snap) {
+			delete(s.snapshots, id)
+		}
+	}
+}
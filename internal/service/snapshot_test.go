@@ -0,0 +1,117 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"dbbridge/internal/core"
+	"dbbridge/internal/service"
+	"dbbridge/internal/testutil"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	env := testutil.NewMemEnv(t)
+	conn := env.CreateSQLiteConnection("shop",
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY)`,
+		`INSERT INTO orders VALUES (1), (2), (3), (4), (5)`)
+	env.CreateQuery("orders", "SELECT id FROM orders ORDER BY id", conn.ID)
+	maxRows, idle := 100, time.Hour
+	store := service.NewSnapshotStore(env.Executor(), func() int { return maxRows },
+		func() time.Duration { return idle }, func() time.Duration { return time.Minute })
+	ctx := context.WithValue(context.Background(), core.ContextKeyApiKeyID, int64(1))
+
+	page, err := store.Open(ctx, "shop", "orders", nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(page.Data); got != "[map[id:1] map[id:2]]" || page.Total != 5 || page.NextToken == "" {
+		t.Fatalf("first page = %s, total %d, next %q", got, page.Total, page.NextToken)
+	}
+
+	// Rows inserted after the snapshot was taken are not paged
+	path, _ := env.Crypto.Decrypt(conn.ConnectionStringEnc)
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO orders VALUES (0)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	second, err := store.Page(ctx, page.NextToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retried, err := store.Page(ctx, page.NextToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(second.Data); got != "[map[id:3] map[id:4]]" || fmt.Sprint(retried.Data) != got || second.Offset != 2 {
+		t.Errorf("second page = %s at %d, retried %v", got, second.Offset, retried.Data)
+	}
+	last, err := store.Page(ctx, second.NextToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(last.Data); got != "[map[id:5]]" || last.NextToken != "" {
+		t.Errorf("last page = %s, next %q", got, last.NextToken)
+	}
+
+	otherKey := context.WithValue(context.Background(), core.ContextKeyApiKeyID, int64(2))
+	if _, err := store.Page(otherKey, page.NextToken); !errors.Is(err, service.ErrSnapshotExpired) {
+		t.Errorf("other key: %v, want ErrSnapshotExpired", err)
+	}
+	if _, err := store.Page(ctx, "nope.0"); !errors.Is(err, service.ErrSnapshotExpired) {
+		t.Errorf("unknown token: %v, want ErrSnapshotExpired", err)
+	}
+
+	idle = 0
+	if _, err := store.Page(ctx, page.NextToken); !errors.Is(err, service.ErrSnapshotExpired) {
+		t.Errorf("idle snapshot: %v, want ErrSnapshotExpired", err)
+	}
+
+	maxRows = 3
+	var tooLarge *service.SnapshotTooLargeError
+	if _, err := store.Open(ctx, "shop", "orders", nil, 2); !errors.As(err, &tooLarge) {
+		t.Errorf("over the row cap: %v, want SnapshotTooLargeError", err)
+	}
+}
+
+func TestSnapshotLimits(t *testing.T) {
+	env := testutil.NewMemEnv(t)
+	conn := env.CreateSQLiteConnection("shop", `CREATE TABLE orders (id INTEGER PRIMARY KEY)`, `INSERT INTO orders VALUES (1)`)
+	env.CreateQuery("orders", "SELECT id FROM orders", conn.ID)
+	idle := time.Hour
+	store := service.NewSnapshotStore(env.Executor(), func() int { return 100 },
+		func() time.Duration { return idle }, func() time.Duration { return time.Minute })
+	store.SetLimits(func() int { return 2 }, func() int { return 3 })
+	key := func(id int64) context.Context {
+		return context.WithValue(context.Background(), core.ContextKeyApiKeyID, id)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := store.Open(key(1), "shop", "orders", nil, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var limit *service.SnapshotLimitError
+	if _, err := store.Open(key(1), "shop", "orders", nil, 10); !errors.As(err, &limit) || !limit.PerKey {
+		t.Fatalf("third snapshot of a key = %v, want the per-key limit", err)
+	}
+	if _, err := store.Open(key(2), "shop", "orders", nil, 10); err != nil {
+		t.Fatalf("another key = %v", err)
+	}
+	if _, err := store.Open(key(3), "shop", "orders", nil, 10); !errors.As(err, &limit) || limit.PerKey {
+		t.Fatalf("snapshot over the total = %v, want the global limit", err)
+	}
+
+	// Expired snapshots free their places before they are swept
+	idle = 0
+	if _, err := store.Open(key(1), "shop", "orders", nil, 10); err != nil {
+		t.Errorf("after expiry = %v", err)
+	}
+}
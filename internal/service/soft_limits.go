@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WarnStatus is the audit status of an execution that succeeded over a soft limit
+const WarnStatus = "WARN"
+
+// Warnings added to the response of an execution over a soft limit
+const (
+	WarningSlowQuery = "slow_query"
+	WarningManyRows  = "many_rows"
+)
+
+// SoftLimits are the warning thresholds of an execution, 0 = none
+type SoftLimits struct {
+	DurationMs int
+	Rows       int
+}
+
+// softLimits returns the thresholds of saved query queryID: its own where set,
+// the WARN_DURATION_MS and WARN_ROWS settings otherwise
+func (e *QueryExecutor) softLimits(queryID int64) SoftLimits {
+	var limits SoftLimits
+	if e.settings != nil {
+		limits = SoftLimits{DurationMs: e.settings.Int("WARN_DURATION_MS"), Rows: e.settings.Int("WARN_ROWS")}
+	}
+	if queryID == 0 {
+		return limits
+	}
+	if q, err := e.queryRepo.GetByID(queryID); err == nil {
+		if q.WarnDurationMs > 0 {
+			limits.DurationMs = q.WarnDurationMs
+		}
+		if q.WarnRows > 0 {
+			limits.Rows = q.WarnRows
+		}
+	}
+	return limits
+}
+
+// Check returns the warnings of an execution that took elapsed and returned
+// rows, and a description of them for the audit log
+func (l SoftLimits) Check(elapsed time.Duration, rows int) (warnings []string, detail string) {
+	var details []string
+	if ms := elapsed.Milliseconds(); l.DurationMs > 0 && ms > int64(l.DurationMs) {
+		warnings = append(warnings, WarningSlowQuery)
+		details = append(details, fmt.Sprintf("%s: took %dms, warning threshold %dms", WarningSlowQuery, ms, l.DurationMs))
+	}
+	if l.Rows > 0 && rows > l.Rows {
+		warnings = append(warnings, WarningManyRows)
+		details = append(details, fmt.Sprintf("%s: returned %d rows, warning threshold %d", WarningManyRows, rows, l.Rows))
+	}
+	return warnings, strings.Join(details, "; ")
+}
+
+const (
+	warnDigestInterval  = 24 * time.Hour
+	warnDigestCursorKey = "warn_digest"
+	warnDigestBatch     = 500
+)
+
+// WarnDigest emails a daily summary of the executions audited as WARN, so
+// soft limit breaches reach operators without an email per execution. Its
+// position in the audit log is kept like an audit forwarder's.
+type WarnDigest struct {
+	repo   core.AuditRepository
+	mailer *Mailer
+}
+
+func NewWarnDigest(repo core.AuditRepository, mailer *Mailer) *WarnDigest {
+	return &WarnDigest{repo: repo, mailer: mailer}
+}
+
+// Run sends a digest every warnDigestInterval until ctx is cancelled
+func (d *WarnDigest) Run(ctx context.Context) {
+	ticker := time.NewTicker(warnDigestInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.send(); err != nil {
+				logger.Error.Printf("Warning digest: %v", err)
+			}
+		}
+	}
+}
+
+// warnDigestLine is one query's entry in the digest
+type warnDigestLine struct {
+	Query         string
+	Count         int
+	MaxDurationMs int64
+	Last          string
+}
+
+// send mails the WARN entries recorded since the previous digest, if any
+func (d *WarnDigest) send() error {
+	cursor, err := d.repo.GetForwardCursor(warnDigestCursorKey)
+	if err != nil {
+		return err
+	}
+	byQuery := make(map[string]*warnDigestLine)
+	total := 0
+	for {
+		logs, err := d.repo.ListAfter(cursor, warnDigestBatch)
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			break
+		}
+		for _, l := range logs {
+			if l.Status != WarnStatus {
+				continue
+			}
+			name := l.QuerySlug
+			if name == "" {
+				name = "ad-hoc SQL"
+			}
+			name += " on " + l.ConnectionName
+			line, ok := byQuery[name]
+			if !ok {
+				line = &warnDigestLine{Query: name}
+				byQuery[name] = line
+			}
+			line.Count++
+			line.MaxDurationMs = max(line.MaxDurationMs, l.DurationMs)
+			line.Last = l.ErrorMessage
+			total++
+		}
+		cursor = logs[len(logs)-1].ID
+	}
+	if err := d.repo.SetForwardCursor(warnDigestCursorKey, cursor); err != nil {
+		return err
+	}
+	if total == 0 {
+		return nil
+	}
+
+	lines := make([]*warnDigestLine, 0, len(byQuery))
+	for _, line := range byQuery {
+		lines = append(lines, line)
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Count > lines[j].Count })
+	d.mailer.Notify(MailEventWarnDigest, map[string]interface{}{"Count": total, "Queries": lines})
+	return nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"dbbridge/internal/core"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSoftLimitsCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  SoftLimits
+		elapsed time.Duration
+		rows    int
+		want    []string
+	}{
+		{"off", SoftLimits{}, time.Hour, 1e6, nil},
+		{"under", SoftLimits{DurationMs: 500, Rows: 100}, 500 * time.Millisecond, 100, nil},
+		{"slow", SoftLimits{DurationMs: 500}, 501 * time.Millisecond, 0, []string{WarningSlowQuery}},
+		{"both", SoftLimits{DurationMs: 500, Rows: 100}, time.Second, 101, []string{WarningSlowQuery, WarningManyRows}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, detail := tt.limits.Check(tt.elapsed, tt.rows)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+			if (detail != "") != (len(tt.want) > 0) {
+				t.Errorf("detail = %q", detail)
+			}
+		})
+	}
+}
+
+func TestWarnDigest(t *testing.T) {
+	repo := &memAuditRepo{cursors: map[string]int64{}}
+	repo.Create(&core.AuditLog{Status: WarnStatus, QuerySlug: "orders", ConnectionName: "erp", DurationMs: 900, ErrorMessage: "slow_query: took 900ms"})
+	repo.Create(&core.AuditLog{Status: "SUCCESS", QuerySlug: "orders", ConnectionName: "erp"})
+	repo.Create(&core.AuditLog{Status: WarnStatus, QuerySlug: "orders", ConnectionName: "erp", DurationMs: 1200})
+	m := NewMailer(MailerConfig{Host: "smtp.invalid", To: []string{"ops@example.com"}})
+	d := NewWarnDigest(repo, m)
+
+	if err := d.send(); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.queue) != 1 {
+		t.Fatalf("queued %d emails, want 1", len(m.queue))
+	}
+	msg := <-m.queue
+	if !strings.Contains(msg.subject, "2 executions") || !strings.Contains(msg.body, "orders on erp: 2 times, slowest 1200ms") {
+		t.Errorf("digest = %q\n%s", msg.subject, msg.body)
+	}
+
+	// Entries already digested are not sent again
+	if err := d.send(); err != nil || len(m.queue) != 0 {
+		t.Errorf("second send() = %v with %d queued", err, len(m.queue))
+	}
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sqliteHeader starts every SQLite 3 database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// SQLiteCreateFlag is the connection string option that lets a sqlite
+// connection create its file; without it a missing file is an error rather
+// than a new empty database
+const SQLiteCreateFlag = "create_if_missing"
+
+// Why a sqlite connection cannot open its file
+var (
+	ErrSQLiteFileMissing  = errors.New("database file does not exist")
+	ErrSQLiteNotDatabase  = errors.New("file is not a SQLite database")
+	ErrSQLiteOutsideBase  = errors.New("database file is outside SQLITE_BASE_DIR")
+	ErrSQLiteNotPlainFile = errors.New("database path is not a regular file")
+)
+
+// SQLiteFileError is a sqlite connection whose file fails the checks of its
+// SQLiteFilePolicy; Err is one of the ErrSQLite... values
+type SQLiteFileError struct {
+	Path string
+	Err  error
+}
+
+func (e *SQLiteFileError) Error() string {
+	switch e.Err {
+	case ErrSQLiteFileMissing:
+		return fmt.Sprintf("%s: %v (add %s=true to the connection string to create it)", e.Path, e.Err, SQLiteCreateFlag)
+	case ErrSQLiteOutsideBase:
+		return fmt.Sprintf("%v: %s", e.Err, e.Path)
+	}
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *SQLiteFileError) Unwrap() error { return e.Err }
+
+// IsSQLiteDriver reports whether driver opens SQLite files
+func IsSQLiteDriver(driver string) bool {
+	return driver == "sqlite" || driver == "sqlite3"
+}
+
+// SQLiteFilePolicy restricts what sqlite connections may open. BaseDir, when
+// set, is the only directory tree their files may live in, so connection
+// strings cannot be used to probe the server's filesystem. ReadOnly opens
+// every file with mode=ro.
+type SQLiteFilePolicy struct {
+	BaseDir  string
+	ReadOnly bool
+}
+
+// SQLiteFile is the database file a sqlite connection string points at
+type SQLiteFile struct {
+	Path     string     // absolute; empty for in-memory databases
+	Options  url.Values // URI and driver options, without create_if_missing
+	Create   bool       // create_if_missing=true
+	ReadOnly bool       // mode=ro
+}
+
+// ParseSQLiteDSN reads a sqlite connection string: a path or a file: URI,
+// either with ?options. Relative paths are taken from the working directory.
+func ParseSQLiteDSN(connStr string) (*SQLiteFile, error) {
+	connStr = strings.TrimSpace(connStr)
+	rawPath, query, _ := strings.Cut(connStr, "?")
+	options, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sqlite connection string options: %w", err)
+	}
+	f := &SQLiteFile{Options: options, ReadOnly: options.Get("mode") == "ro"}
+	if create := options.Get(SQLiteCreateFlag); create != "" {
+		f.Create = create == "true" || create == "1"
+		options.Del(SQLiteCreateFlag)
+	}
+
+	if rest, ok := strings.CutPrefix(rawPath, "file:"); ok {
+		// file:///abs/path and file://localhost/abs/path carry an authority
+		if after, ok := strings.CutPrefix(rest, "//"); ok {
+			host, path, _ := strings.Cut(after, "/")
+			if host != "" && host != "localhost" {
+				return nil, fmt.Errorf("invalid sqlite connection string: remote host %q in file URI", host)
+			}
+			rest = "/" + path
+		}
+		if rawPath, err = url.PathUnescape(rest); err != nil {
+			return nil, fmt.Errorf("invalid sqlite connection string: %w", err)
+		}
+	}
+	if rawPath == "" || rawPath == ":memory:" || options.Get("mode") == "memory" {
+		return f, nil
+	}
+	if f.Path, err = filepath.Abs(rawPath); err != nil {
+		return nil, fmt.Errorf("invalid sqlite database path: %w", err)
+	}
+	return f, nil
+}
+
+// DSN writes the file back as a file: URI for the driver
+func (f *SQLiteFile) DSN() string {
+	path := f.Path
+	if path == "" {
+		path = ":memory:"
+	}
+	escaped := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(filepath.ToSlash(path))
+	if len(f.Options) == 0 {
+		return "file:" + escaped
+	}
+	return "file:" + escaped + "?" + f.Options.Encode()
+}
+
+// Apply checks a sqlite connection string against the policy and returns the
+// DSN to open it with. The file must exist (unless create_if_missing=true)
+// and be a SQLite database; with ReadOnly it is opened with mode=ro and never
+// created.
+func (p SQLiteFilePolicy) Apply(connStr string) (string, error) {
+	f, err := ParseSQLiteDSN(connStr)
+	if err != nil {
+		return "", err
+	}
+	if p.ReadOnly {
+		f.Options.Set("mode", "ro")
+		f.ReadOnly, f.Create = true, false
+	}
+	if f.Path == "" {
+		return f.DSN(), nil
+	}
+
+	if p.BaseDir != "" {
+		if err := checkInsideDir(p.BaseDir, f.Path); err != nil {
+			return "", err
+		}
+	}
+	info, err := os.Stat(f.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if !f.Create {
+			return "", &SQLiteFileError{Path: f.Path, Err: ErrSQLiteFileMissing}
+		}
+		// mode=rwc lets the driver create it
+		if f.Options.Get("mode") == "" {
+			f.Options.Set("mode", "rwc")
+		}
+		return f.DSN(), nil
+	case err != nil:
+		return "", fmt.Errorf("%s: %w", f.Path, err)
+	case !info.Mode().IsRegular():
+		return "", &SQLiteFileError{Path: f.Path, Err: ErrSQLiteNotPlainFile}
+	}
+	if err := checkSQLiteHeader(f.Path); err != nil {
+		return "", err
+	}
+	// An existing file is opened as is; rwc would only matter for a missing one
+	if f.Options.Get("mode") == "" {
+		f.Options.Set("mode", "rw")
+	}
+	return f.DSN(), nil
+}
+
+// checkInsideDir reports ErrSQLiteOutsideBase unless path, with symlinks
+// resolved, lies within baseDir
+func checkInsideDir(baseDir, path string) error {
+	base, err := filepath.Abs(baseDir)
+	if err == nil {
+		base, err = filepath.EvalSymlinks(base)
+	}
+	if err != nil {
+		return fmt.Errorf("SQLITE_BASE_DIR: %w", err)
+	}
+	// A file not created yet is checked by its directory
+	resolved, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if resolved, err = filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+			resolved = filepath.Join(resolved, filepath.Base(path))
+		} else if errors.Is(err, os.ErrNotExist) {
+			resolved, err = filepath.Clean(path), nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	rel, err := filepath.Rel(base, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return &SQLiteFileError{Path: path, Err: ErrSQLiteOutsideBase}
+	}
+	return nil
+}
+
+// checkSQLiteHeader reports ErrSQLiteNotDatabase for a file that does not
+// start with the SQLite header. An empty file is a valid, empty database.
+func checkSQLiteHeader(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer file.Close()
+	header := make([]byte, len(sqliteHeader))
+	n, err := io.ReadFull(file, header)
+	if n == 0 && err == io.EOF {
+		return nil
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if !bytes.Equal(header[:n], sqliteHeader) {
+		return &SQLiteFileError{Path: path, Err: ErrSQLiteNotDatabase}
+	}
+	return nil
+}
+
+// SQLiteFileInfo is what the connection page shows about a sqlite file
+type SQLiteFileInfo struct {
+	Path     string
+	Size     int64
+	Modified time.Time
+	ReadOnly bool
+	Err      error // set when the file cannot be opened under the policy
+}
+
+// Stat describes the file a sqlite connection string points at, nil for
+// in-memory databases and unparsable strings
+func (p SQLiteFilePolicy) Stat(connStr string) *SQLiteFileInfo {
+	f, err := ParseSQLiteDSN(connStr)
+	if err != nil || f.Path == "" {
+		return nil
+	}
+	info := &SQLiteFileInfo{Path: f.Path, ReadOnly: f.ReadOnly || p.ReadOnly}
+	if _, info.Err = p.Apply(connStr); info.Err != nil {
+		return info
+	}
+	if st, err := os.Stat(f.Path); err == nil {
+		info.Size, info.Modified = st.Size(), st.ModTime()
+	}
+	return info
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSQLiteDSN(t *testing.T) {
+	for connStr, want := range map[string]string{
+		"/data/app.db":                         "/data/app.db",
+		"file:/data/app.db?cache=shared":       "/data/app.db",
+		"file:///data/my%20app.db":             "/data/my app.db",
+		"file://localhost/data/app.db?mode=ro": "/data/app.db",
+		":memory:":                             "",
+	} {
+		f, err := ParseSQLiteDSN(connStr)
+		if err != nil {
+			t.Errorf("%s: %v", connStr, err)
+			continue
+		}
+		if f.Path != filepath.FromSlash(want) && !(want != "" && strings.HasSuffix(f.Path, filepath.FromSlash(want))) {
+			t.Errorf("%s: path %q, want %q", connStr, f.Path, want)
+		}
+	}
+	if _, err := ParseSQLiteDSN("file://fileserver/share/app.db"); err == nil {
+		t.Error("remote file URI accepted")
+	}
+	f, _ := ParseSQLiteDSN("app.db?create_if_missing=true&_pragma=foreign_keys(1)")
+	if !f.Create || f.Options.Has(SQLiteCreateFlag) || f.Options.Get("_pragma") != "foreign_keys(1)" {
+		t.Errorf("options = %v, create = %v", f.Options, f.Create)
+	}
+}
+
+func TestSQLiteFilePolicy(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "app.db")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE t (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	textPath := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(textPath, []byte("not a database at all"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.db")
+
+	open := SQLiteFilePolicy{}
+	if dsn, err := open.Apply(dbPath); err != nil || !strings.Contains(dsn, "mode=rw") {
+		t.Errorf("existing file: %q, %v", dsn, err)
+	}
+	if _, err := open.Apply(missing); !errors.Is(err, ErrSQLiteFileMissing) {
+		t.Errorf("missing file: %v", err)
+	}
+	if _, err := open.Apply(textPath); !errors.Is(err, ErrSQLiteNotDatabase) {
+		t.Errorf("text file: %v", err)
+	}
+	if dsn, err := open.Apply(missing + "?create_if_missing=true"); err != nil || !strings.Contains(dsn, "mode=rwc") {
+		t.Errorf("create_if_missing: %q, %v", dsn, err)
+	}
+
+	readOnly := SQLiteFilePolicy{ReadOnly: true}
+	if _, err := readOnly.Apply(missing + "?create_if_missing=true"); !errors.Is(err, ErrSQLiteFileMissing) {
+		t.Errorf("read-only policy created a file: %v", err)
+	}
+	dsn, err := readOnly.Apply(dbPath)
+	if err != nil || !strings.Contains(dsn, "mode=ro") {
+		t.Fatalf("read-only: %q, %v", dsn, err)
+	}
+	db, err = sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("INSERT INTO t VALUES (1)"); err == nil {
+		t.Error("write through a mode=ro connection succeeded")
+	}
+
+	based := SQLiteFilePolicy{BaseDir: dir}
+	if _, err := based.Apply(dbPath); err != nil {
+		t.Errorf("file inside the base dir: %v", err)
+	}
+	for _, outside := range []string{filepath.Join(dir, "..", "other.db"), "/etc/passwd"} {
+		if _, err := based.Apply(outside); !errors.Is(err, ErrSQLiteOutsideBase) {
+			t.Errorf("%s: %v, want outside the base dir", outside, err)
+		}
+	}
+	link := filepath.Join(dir, "link.db")
+	if err := os.Symlink("/etc/passwd", link); err == nil {
+		if _, err := based.Apply(link); !errors.Is(err, ErrSQLiteOutsideBase) {
+			t.Errorf("symlink out of the base dir: %v", err)
+		}
+	}
+
+	if info := open.Stat(dbPath); info == nil || info.Err != nil || info.Size == 0 {
+		t.Errorf("Stat = %+v", info)
+	}
+}
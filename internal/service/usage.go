@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"dbbridge/internal/core"
+	"dbbridge/internal/logger"
+	"math"
+	"time"
+)
+
+const (
+	// MaxHeatmapWeeks bounds the range of a usage heatmap
+	MaxHeatmapWeeks = 52
+
+	usageRollupInterval = time.Hour
+	// usageRollupGrace leaves an hour to the audit log for a while after it
+	// ends, so entries still queued in the audit writer are rolled up with it
+	usageRollupGrace = 5 * time.Minute
+)
+
+// UsageStats reports when connections are busiest, from hourly counts that
+// Run rolls up from the audit log
+type UsageStats struct {
+	repo core.UsageRepository
+}
+
+func NewUsageStats(repo core.UsageRepository) *UsageStats {
+	return &UsageStats{repo: repo}
+}
+
+// UsageHeatmap is the executions on a connection by weekday and hour of the
+// server's time zone, Monday first, with the totals of each day of the range
+type UsageHeatmap struct {
+	ConnectionID  int64          `json:"connection_id"`
+	Weeks         int            `json:"weeks"`
+	From          time.Time      `json:"from"`
+	To            time.Time      `json:"to"`
+	Executions    [7][24]int64   `json:"executions"`
+	AvgDurationMs [7][24]float64 `json:"avg_duration_ms"`
+	Days          []UsageDay     `json:"days"`
+	Total         int64          `json:"total"`
+	durations     [7][24]int64   // totals, for the averages
+	busiest       int64          // the largest cell, for Level
+}
+
+// UsageDay is the executions on one day
+type UsageDay struct {
+	Date          string  `json:"date"`
+	Executions    int64   `json:"executions"`
+	AvgDurationMs float64 `json:"avg_duration_ms"`
+}
+
+// Heatmap aggregates the usage of connectionID over the weeks*7 days up to
+// now, today included. weeks is capped at MaxHeatmapWeeks.
+func (s *UsageStats) Heatmap(connectionID int64, weeks int, now time.Time) (*UsageHeatmap, error) {
+	weeks = min(max(weeks, 1), MaxHeatmapWeeks)
+	now = now.In(time.Local)
+	from := time.Date(now.Year(), now.Month(), now.Day()-weeks*7+1, 0, 0, 0, 0, time.Local)
+	hours, err := s.repo.Hourly(connectionID, from, now)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &UsageHeatmap{ConnectionID: connectionID, Weeks: weeks, From: from, To: now}
+	dayIndex := map[string]int{}
+	for d := from; !d.After(now); d = d.AddDate(0, 0, 1) {
+		dayIndex[d.Format(time.DateOnly)] = len(h.Days)
+		h.Days = append(h.Days, UsageDay{Date: d.Format(time.DateOnly)})
+	}
+	dayDurations := make([]int64, len(h.Days))
+	for _, u := range hours {
+		wd, hr := (int(u.Hour.Weekday())+6)%7, u.Hour.Hour()
+		h.Executions[wd][hr] += u.Executions
+		h.durations[wd][hr] += u.DurationMs
+		h.Total += u.Executions
+		if i, ok := dayIndex[u.Hour.Format(time.DateOnly)]; ok {
+			h.Days[i].Executions += u.Executions
+			dayDurations[i] += u.DurationMs
+		}
+	}
+	for wd := range h.Executions {
+		for hr, n := range h.Executions[wd] {
+			h.AvgDurationMs[wd][hr] = average(h.durations[wd][hr], n)
+			h.busiest = max(h.busiest, n)
+		}
+	}
+	for i := range h.Days {
+		h.Days[i].AvgDurationMs = average(dayDurations[i], h.Days[i].Executions)
+	}
+	return h, nil
+}
+
+// Level grades the cell of weekday (0 = Monday) and hour from 0, no
+// executions, to 4, the busiest hour, for shading the heatmap
+func (h *UsageHeatmap) Level(weekday, hour int) int {
+	n := h.Executions[weekday][hour]
+	if n == 0 {
+		return 0
+	}
+	return int(math.Ceil(4 * float64(n) / float64(h.busiest)))
+}
+
+func average(totalMs, n int64) float64 {
+	if n == 0 {
+		return 0
+	}
+	return math.Round(float64(totalMs)/float64(n)*10) / 10
+}
+
+// Rollup rolls up the audit log up to the last hour that ended
+// usageRollupGrace before now
+func (s *UsageStats) Rollup(now time.Time) error {
+	now = now.Add(-usageRollupGrace).In(time.Local)
+	until := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, time.Local)
+	_, err := s.repo.Rollup(until)
+	return err
+}
+
+// Run rolls up every usageRollupInterval until ctx is cancelled
+func (s *UsageStats) Run(ctx context.Context) {
+	ticker := time.NewTicker(usageRollupInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.Rollup(time.Now()); err != nil {
+			logger.Error.Printf("Usage rollup: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
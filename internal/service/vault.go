@@ -0,0 +1,243 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const vaultTimeout = 10 * time.Second
+
+// reVaultRef matches vault:<path>#<field>, e.g. vault:secret/data/db/prod#password
+var reVaultRef = regexp.MustCompile(`vault:([A-Za-z0-9_./-]+)#([A-Za-z0-9_.-]+)`)
+
+// HasSecretRefs reports whether a connection string references Vault secrets
+func HasSecretRefs(connStr string) bool {
+	return reVaultRef.MatchString(connStr)
+}
+
+// SecretError is a failure to resolve a vault: reference. It is audited as
+// SECRET_ERROR, apart from database errors.
+type SecretError struct {
+	Ref string
+	Err error
+}
+
+func (e *SecretError) Error() string {
+	return fmt.Sprintf("secret resolution failed for %s: %v", e.Ref, e.Err)
+}
+
+func (e *SecretError) Unwrap() error { return e.Err }
+
+// errVaultForbidden is Vault refusing the token, which an AppRole login renews
+var errVaultForbidden = errors.New("vault denied access (403)")
+
+// VaultConfig configures the Vault client; see config.Config
+type VaultConfig struct {
+	Addr      string
+	Token     string
+	RoleID    string
+	SecretID  string
+	Namespace string
+	CacheTTL  time.Duration
+}
+
+type cachedSecret struct {
+	fields  map[string]interface{}
+	expires time.Time
+}
+
+// SecretResolver replaces vault: references in connection strings with
+// secrets read from Vault's HTTP API (KV v1 or v2). Secrets are cached in
+// memory for CacheTTL. A nil resolver means Vault is not configured.
+type SecretResolver struct {
+	cfg    VaultConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	token string // VAULT_TOKEN, or the last AppRole login token
+	cache map[string]cachedSecret
+}
+
+func NewSecretResolver(cfg VaultConfig) *SecretResolver {
+	return &SecretResolver{
+		cfg:    cfg,
+		client: &http.Client{Timeout: vaultTimeout},
+		token:  cfg.Token,
+		cache:  make(map[string]cachedSecret),
+	}
+}
+
+type freshSecretsKey struct{}
+
+// withFreshSecrets makes Resolve skip the cache, e.g. after the database
+// rejected credentials that may have been rotated
+func withFreshSecrets(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshSecretsKey{}, true)
+}
+
+// Resolve replaces every vault:path#field reference in connStr. Strings
+// without references are returned unchanged, even without a resolver.
+func (r *SecretResolver) Resolve(ctx context.Context, connStr string) (string, error) {
+	if !HasSecretRefs(connStr) {
+		return connStr, nil
+	}
+	fresh, _ := ctx.Value(freshSecretsKey{}).(bool)
+
+	var resolveErr error
+	resolved := reVaultRef.ReplaceAllStringFunc(connStr, func(ref string) string {
+		if resolveErr != nil {
+			return ref
+		}
+		m := reVaultRef.FindStringSubmatch(ref)
+		if r == nil {
+			resolveErr = &SecretError{Ref: ref, Err: errors.New("Vault is not configured (set VAULT_ADDR)")}
+			return ref
+		}
+		value, err := r.field(ctx, m[1], m[2], fresh)
+		if err != nil {
+			resolveErr = &SecretError{Ref: ref, Err: err}
+			return ref
+		}
+		return value
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	return resolved, nil
+}
+
+func (r *SecretResolver) field(ctx context.Context, path, field string, fresh bool) (string, error) {
+	fields, err := r.secret(ctx, path, fresh)
+	if err != nil {
+		return "", err
+	}
+	value, ok := fields[field]
+	if !ok || value == nil {
+		return "", fmt.Errorf("field %q not found in secret %s", field, path)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// secret returns the fields of the secret at path, from the cache when allowed
+func (r *SecretResolver) secret(ctx context.Context, path string, fresh bool) (map[string]interface{}, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[path]
+	r.mu.Unlock()
+	if ok && !fresh && time.Now().Before(cached.expires) {
+		return cached.fields, nil
+	}
+
+	fields, err := r.read(ctx, path)
+	if errors.Is(err, errVaultForbidden) && r.cfg.RoleID != "" {
+		// The AppRole token expired; log in again once
+		if err = r.login(ctx); err == nil {
+			fields, err = r.read(ctx, path)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if r.cfg.CacheTTL > 0 {
+		r.mu.Lock()
+		r.cache[path] = cachedSecret{fields: fields, expires: time.Now().Add(r.cfg.CacheTTL)}
+		r.mu.Unlock()
+	}
+	return fields, nil
+}
+
+func (r *SecretResolver) read(ctx context.Context, path string) (map[string]interface{}, error) {
+	r.mu.Lock()
+	token := r.token
+	r.mu.Unlock()
+	if token == "" && r.cfg.RoleID != "" {
+		if err := r.login(ctx); err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		token = r.token
+		r.mu.Unlock()
+	}
+
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := r.do(ctx, http.MethodGet, "/v1/"+strings.TrimPrefix(path, "/"), token, nil, &resp); err != nil {
+		return nil, err
+	}
+	// KV v2 nests the secret under data.data next to data.metadata
+	if inner, ok := resp.Data["data"].(map[string]interface{}); ok {
+		if _, v2 := resp.Data["metadata"]; v2 {
+			return inner, nil
+		}
+	}
+	return resp.Data, nil
+}
+
+// login exchanges the AppRole credentials for a token
+func (r *SecretResolver) login(ctx context.Context) error {
+	body, _ := json.Marshal(map[string]string{"role_id": r.cfg.RoleID, "secret_id": r.cfg.SecretID})
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := r.do(ctx, http.MethodPost, "/v1/auth/approle/login", "", body, &resp); err != nil {
+		return fmt.Errorf("approle login: %w", err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return errors.New("approle login returned no token")
+	}
+	r.mu.Lock()
+	r.token = resp.Auth.ClientToken
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *SecretResolver) do(ctx context.Context, method, path, token string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, r.cfg.Addr+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if r.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.cfg.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		return errVaultForbidden
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("no secret at %s", path)
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("vault returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid vault response: %w", err)
+	}
+	return nil
+}
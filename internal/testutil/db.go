@@ -0,0 +1,35 @@
+// Package testutil is the scaffolding shared by the tests of the other
+// packages: an in-memory metadata database, fixtures on the SQLite or
+// in-memory repositories and a test server wired like cmd/dbbridge. It
+// imports api and service, so tests using it live in external _test packages.
+package testutil
+
+import (
+	"database/sql"
+	"dbbridge/internal/data"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+var dbSeq atomic.Int64
+
+// OpenDB opens a migrated metadata database in memory, closed when the test
+// ends. Each call gets its own database.
+func OpenDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	// A named shared-cache database: every connection of the pool sees the
+	// same data, unlike plain :memory:
+	db, err := data.OpenDB(MemoryDSN(fmt.Sprintf("dbbridge-%d", dbSeq.Add(1))))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+// MemoryDSN is the sqlite driver DSN of the in-memory database name. It lives
+// while a connection to it is open.
+func MemoryDSN(name string) string {
+	return "file:" + name + "?mode=memory&cache=shared&_pragma=busy_timeout(5000)"
+}
@@ -0,0 +1,158 @@
+package testutil
+
+import (
+	"database/sql"
+	"dbbridge/internal/core"
+	"dbbridge/internal/data"
+	"dbbridge/internal/data/memory"
+	"dbbridge/internal/service"
+	"path/filepath"
+	"testing"
+)
+
+// Key is the DBBRIDGE_KEY of test environments: it encrypts connection
+// strings and signs session cookies
+const Key = "0123456789abcdef0123456789abcdef"
+
+// TestArgon2idParams are the cheapest Argon2id parameters, which Env's
+// AuthService hashes passwords with
+var TestArgon2idParams = service.Argon2idParams{Memory: 8, Iterations: 1, Parallelism: 1}
+
+// Env is the metadata of a test: repositories, the services on top of them
+// and fixture helpers. Fixtures fail the test on error.
+type Env struct {
+	DB          *sql.DB // nil for NewMemEnv
+	Users       core.UserRepository
+	APIKeys     core.ApiKeyRepository
+	Connections core.ConnectionRepository
+	Queries     core.QueryRepository
+	Audit       core.AuditRepository
+	Settings    core.SettingsRepository
+	Details     core.ExecutionDetailRepository
+	Access      core.AccessEventRepository
+	Usage       core.UsageRepository      // nil for NewMemEnv
+	Embeds      core.EmbedTokenRepository // nil for NewMemEnv
+	Quota       core.QuotaRepository      // nil for NewMemEnv
+
+	// DocsGeneration counts the writes of Connections and Queries, like the
+	// server's repositories do for the API docs cache
+	DocsGeneration *service.Generation
+
+	Crypto *service.EncryptionService
+	Auth   *service.AuthService
+
+	tb testing.TB
+}
+
+// NewMemEnv is an Env on the repositories of package memory
+func NewMemEnv(tb testing.TB) *Env {
+	tb.Helper()
+	return newEnv(tb, nil, &memory.Users{}, &memory.APIKeys{}, &memory.Connections{}, &memory.Queries{},
+		&memory.Audit{}, &memory.Settings{}, &memory.Details{}, &memory.AccessEvents{})
+}
+
+// NewSQLiteEnv is an Env on the SQLite repositories of an in-memory
+// metadata database
+func NewSQLiteEnv(tb testing.TB) *Env {
+	tb.Helper()
+	db := OpenDB(tb)
+	audit := data.NewAuditRepo(db)
+	audit.SetRetention(func() int { return 10_000_000 })
+	env := newEnv(tb, db, data.NewUserRepo(db), data.NewApiKeyRepo(db), data.NewConnectionRepo(db), data.NewQueryRepo(db),
+		audit, data.NewSettingsRepo(db), data.NewExecutionDetailRepo(db), data.NewAccessEventRepo(db))
+	env.Usage = data.NewUsageRepo(db)
+	env.Embeds = data.NewEmbedTokenRepo(db)
+	env.Quota = data.NewQuotaRepo(db)
+	return env
+}
+
+func newEnv(tb testing.TB, db *sql.DB, users core.UserRepository, keys core.ApiKeyRepository, conns core.ConnectionRepository,
+	queries core.QueryRepository, audit core.AuditRepository, settings core.SettingsRepository, details core.ExecutionDetailRepository,
+	access core.AccessEventRepository) *Env {
+	crypto, err := service.NewEncryptionService(Key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	generation := &service.Generation{}
+	auth := service.NewAuthService(users, keys)
+	auth.SetPasswordHasher(service.NewArgon2idHasher(TestArgon2idParams))
+	return &Env{DB: db, Users: users, APIKeys: keys, Connections: service.TrackConnections(conns, generation),
+		Queries: service.TrackQueries(queries, generation), Audit: audit, Settings: settings, Details: details, Access: access,
+		Crypto: crypto, Auth: auth, DocsGeneration: generation, tb: tb}
+}
+
+// Executor is a query executor on the Env's repositories, writing its audit
+// entries synchronously
+func (e *Env) Executor() *service.QueryExecutor {
+	executor := service.NewQueryExecutor(e.Connections, e.Queries, e.Audit, e.Crypto, nil)
+	executor.SetDetailRepo(e.Details)
+	return executor
+}
+
+// CreateUser adds a user with password
+func (e *Env) CreateUser(username, password string) *core.User {
+	e.tb.Helper()
+	hash, err := e.Auth.HashPassword(password)
+	if err != nil {
+		e.tb.Fatal(err)
+	}
+	user, err := e.Users.CreateUser(username, hash)
+	if err != nil {
+		e.tb.Fatalf("create user %s: %v", username, err)
+	}
+	return user
+}
+
+// CreateAPIKey issues a key for userID and returns it with its plain value
+func (e *Env) CreateAPIKey(userID int64) (string, *core.ApiKey) {
+	e.tb.Helper()
+	plain, key, err := e.Auth.GenerateApiKey(userID, "test key")
+	if err != nil {
+		e.tb.Fatal(err)
+	}
+	return plain, key
+}
+
+// CreateConnection adds an active connection with an encrypted connection
+// string
+func (e *Env) CreateConnection(name, driver, connStr string) *core.DBConnection {
+	e.tb.Helper()
+	enc, err := e.Crypto.Encrypt(connStr)
+	if err != nil {
+		e.tb.Fatal(err)
+	}
+	conn := &core.DBConnection{Name: name, Driver: driver, ConnectionStringEnc: enc, IsActive: true}
+	if err := e.Connections.Create(conn); err != nil {
+		e.tb.Fatalf("create connection %s: %v", name, err)
+	}
+	return conn
+}
+
+// CreateSQLiteConnection adds a connection to a new SQLite database file in
+// the test's temporary directory, set up by the setup statements
+func (e *Env) CreateSQLiteConnection(name string, setup ...string) *core.DBConnection {
+	e.tb.Helper()
+	path := filepath.Join(e.tb.TempDir(), name+".db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		e.tb.Fatal(err)
+	}
+	defer db.Close()
+	// Connections only open files that are SQLite databases already
+	for _, stmt := range append([]string{"PRAGMA user_version = 1"}, setup...) {
+		if _, err := db.Exec(stmt); err != nil {
+			e.tb.Fatalf("setup of %s: %v", name, err)
+		}
+	}
+	return e.CreateConnection(name, "sqlite", path)
+}
+
+// CreateQuery adds an active query on the given connections
+func (e *Env) CreateQuery(slug, sqlText string, connIDs ...int64) *core.SavedQuery {
+	e.tb.Helper()
+	q := &core.SavedQuery{Slug: slug, SQLText: sqlText, IsActive: true, AllowedConnectionIDs: connIDs}
+	if err := e.Queries.Create(q); err != nil {
+		e.tb.Fatalf("create query %s: %v", slug, err)
+	}
+	return q
+}
@@ -0,0 +1,216 @@
+package testutil
+
+import (
+	"dbbridge/internal/api"
+	"dbbridge/internal/config"
+	"dbbridge/internal/service"
+	"embed"
+	"io/fs"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// templateFiles is a minimal admin template set: the layout shows the page
+// name, the signed-in user, flash messages and a page's "Error", and login
+// and setup pages have their forms. Other standalone pages are not included.
+//
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+// Config is the configuration of test servers: the production defaults of
+// the settings handlers read, and SQLite as the only driver
+func Config() *config.Config {
+	return &config.Config{
+		DbBridgeKey:               Key,
+		SupportedDrivers:          []string{"sqlite"},
+		QueryTimeout:              30,
+		AuditRetentionRows:        1000,
+		AccessEventHours:          72,
+		BundleMaxMB:               100,
+		IdempotencyTTLHours:       24,
+		ExportRetentionHours:      24,
+		ExportMaxMB:               10240,
+		ExportTimeoutMinutes:      120,
+		SnapshotMaxRows:           100000,
+		SnapshotIdleMinutes:       10,
+		SnapshotMaxPerKey:         3,
+		SnapshotMaxOpen:           20,
+		ProtectedMaxRows:          100,
+		ProtectedTimeoutSeconds:   5,
+		DebugCapture:              true,
+		ReplayWrites:              true,
+		SlugAliasDeprecation:      true,
+		DisabledDriverConnections: "run",
+		DefaultLocale:             "en",
+		InactiveKeyDays:           90,
+		Argon2MemoryKB:            64 * 1024,
+		Argon2Iterations:          3,
+		Argon2Parallelism:         2,
+	}
+}
+
+// TestServer serves the public, admin and API routes of cmd/dbbridge on an
+// Env, without rate limits and background jobs. Exports are written to a
+// temporary directory and never expire. Access events are written in the
+// background; Access.Close writes the queued ones.
+type TestServer struct {
+	*httptest.Server
+	Env      *Env
+	Executor *service.QueryExecutor
+	Settings *service.SettingsService
+	Exports  *service.ExportService
+	Access   *service.AccessLog
+	Quota    *service.DailyQuota // nil unless Env.Quota is set; Close writes the counts
+}
+
+// NewTestServer starts a server on a new NewSQLiteEnv, stopped when the
+// test ends
+func NewTestServer(tb testing.TB) *TestServer {
+	tb.Helper()
+	return NewTestServerEnv(tb, NewSQLiteEnv(tb))
+}
+
+// NewTestServerEnv starts a server on env, stopped when the test ends
+func NewTestServerEnv(tb testing.TB, env *Env) *TestServer {
+	tb.Helper()
+	cfgStore := config.NewStore(Config())
+	settings := service.NewSettingsService(env.Settings, env.Audit, env.Crypto, func(key string) string {
+		return cfgStore.Get().Setting(key)
+	})
+	templates, err := fs.Sub(templateFiles, "templates")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	webHandler := api.NewWebHandler(templates, env.Connections, env.Queries, env.Audit, env.Users, env.APIKeys, env.Auth, env.Crypto, cfgStore, settings)
+	webHandler.SetDetailRepo(env.Details)
+	if env.Usage != nil {
+		webHandler.SetUsageStats(service.NewUsageStats(env.Usage))
+	}
+	authHandler := api.NewAuthHandler(env.Auth, Key, webHandler.GetTemplates())
+	authHandler.SetAuditor(service.NewAdminAuditor(env.Audit))
+
+	executor := service.NewQueryExecutor(env.Connections, env.Queries, env.Audit, env.Crypto, settings)
+	executor.SetDetailRepo(env.Details)
+	docHandler := api.NewDocHandler(env.Queries, env.Connections, cfgStore)
+	docHandler.SetTemplates(webHandler.GetTemplates())
+	docHandler.SetGeneration(env.DocsGeneration)
+	webHandler.SetDocs(docHandler)
+	apiHandler := api.NewHandler(executor, docHandler, env.Auth, env.Audit, cfgStore)
+	apiHandler.SetSettings(settings)
+	exports := service.NewExportService(executor, tb.TempDir(), 2,
+		func() time.Duration { return time.Duration(settings.Int("EXPORT_RETENTION_HOURS")) * time.Hour },
+		func() int64 { return int64(settings.Int("EXPORT_MAX_MB")) << 20 },
+		func() time.Duration { return time.Duration(settings.Int("EXPORT_TIMEOUT_MINUTES")) * time.Minute })
+	apiHandler.SetExports(exports, authHandler.SessionUserID)
+	snapshots := service.NewSnapshotStore(executor,
+		func() int { return settings.Int("SNAPSHOT_MAX_ROWS") },
+		func() time.Duration { return time.Duration(settings.Int("SNAPSHOT_IDLE_MINUTES")) * time.Minute },
+		func() time.Duration { return time.Duration(settings.Int("QUERY_TIMEOUT_SECONDS")) * time.Second })
+	snapshots.SetLimits(func() int { return settings.Int("SNAPSHOT_MAX_PER_KEY") },
+		func() int { return settings.Int("SNAPSHOT_MAX_OPEN") })
+	apiHandler.SetSnapshots(snapshots)
+
+	var quota *service.DailyQuota
+	if env.Quota != nil {
+		quota = service.NewDailyQuota(env.Quota,
+			func() int { return settings.Int("API_DAILY_QUOTA") },
+			func() string { return settings.Get("QUOTA_TIMEZONE") })
+		apiHandler.SetQuota(quota)
+	}
+
+	var embedHandler *api.EmbedHandler
+	if env.Embeds != nil {
+		embeds := service.NewEmbedService(env.Embeds, executor, Key)
+		webHandler.SetEmbeds(embeds)
+		embedHandler = api.NewEmbedHandler(embeds, webHandler.GetTemplates(), nil)
+	}
+
+	accessLog := service.NewAccessLog(env.Access, 100,
+		func() time.Duration { return time.Duration(settings.Int("ACCESS_EVENT_RETENTION_HOURS")) * time.Hour })
+
+	r := chi.NewRouter()
+	r.Get("/", authHandler.Root)
+	r.Get("/setup", authHandler.SetupPage)
+	r.Post("/setup", authHandler.DoSetup)
+	r.Get("/login", authHandler.LoginPage)
+	r.Post("/login", authHandler.DoLogin)
+	r.Get("/logout", authHandler.Logout)
+	if embedHandler != nil {
+		embedHandler.RegisterRoutes(r)
+	}
+	r.Group(func(r chi.Router) {
+		r.Use(authHandler.AdminMiddleware)
+		webHandler.RegisterRoutes(r)
+		api.NewExportHandler(exports).RegisterRoutes(r)
+		api.NewAccessEventsHandler(webHandler.GetTemplates(), env.Access, accessLog).RegisterRoutes(r)
+	})
+	r.Route("/api", func(r chi.Router) {
+		r.Use(api.AccessEventMiddleware(accessLog))
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(apiHandler.AdminAPIMiddleware(authHandler.SessionUserID))
+			webHandler.RegisterAdminAPIRoutes(r)
+		})
+		r.Mount("/", apiHandler.Routes())
+	})
+
+	srv := httptest.NewServer(r)
+	tb.Cleanup(srv.Close)
+	tb.Cleanup(exports.Close)
+	tb.Cleanup(accessLog.Close)
+	return &TestServer{Server: srv, Env: env, Executor: executor, Settings: settings, Exports: exports, Access: accessLog, Quota: quota}
+}
+
+// Client is an HTTP client of the server with its own cookies. It does not
+// follow redirects, so tests see them.
+func (s *TestServer) Client() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// SignIn signs username in through the login form and returns the client
+// carrying the session
+func (s *TestServer) SignIn(tb testing.TB, username, password string) *http.Client {
+	tb.Helper()
+	client := s.Client()
+	resp, err := client.PostForm(s.URL+"/login", url.Values{"username": {username}, "password": {password}})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/admin" {
+		tb.Fatalf("sign in as %s: %d -> %q", username, resp.StatusCode, resp.Header.Get("Location"))
+	}
+	return client
+}
+
+// CallAPI posts a JSON body to an /api path with an API key, "" for none
+func (s *TestServer) CallAPI(tb testing.TB, apiKey, path, body string) *http.Response {
+	tb.Helper()
+	req, err := http.NewRequest("POST", s.URL+path, strings.NewReader(body))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
@@ -0,0 +1,198 @@
+// Package bridge runs dbbridge queries from other Go programs, with the
+// parser and executor the HTTP server uses: {param} placeholders, defaults,
+// {select} blocks, pagination and ordering, dialects and result mapping.
+//
+// Databases are the caller's *sql.DB values, attached under a connection
+// name; the executor never opens or closes them. Saved queries live in a
+// QueryRepository, in memory unless WithQueries gives another one, such as
+// the repository of a dbbridge metadata database.
+//
+// This package and the types it names are the supported API of the module.
+// It keeps backward compatibility within a major version; an incompatible
+// change comes with a new major version and import path, as Go's semantic
+// import versioning requires. Everything under internal/ may change at any
+// time.
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"dbbridge/internal/core"
+	"dbbridge/internal/data/memory"
+	"dbbridge/internal/service"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type (
+	// Result is the outcome of an execution: rows as maps keyed by column,
+	// metadata such as columns and pages, and soft-limit warnings
+	Result = service.ExecutionResult
+	// Meta is the metadata of a Result
+	Meta = service.MetaInfo
+	// ParseResult is SQL with its placeholders replaced by ?, the parameter
+	// names in binding order, their defaults and likely mistakes
+	ParseResult = core.ParseResult
+	// Query is a saved query
+	Query = core.SavedQuery
+	// Connection is a named database connection
+	Connection = core.DBConnection
+	// AuditLog is the audit entry of an execution
+	AuditLog = core.AuditLog
+
+	ConnectionRepository = core.ConnectionRepository
+	QueryRepository      = core.QueryRepository
+	AuditRepository      = core.AuditRepository
+)
+
+// Option configures an Executor, see New
+type Option func(*options)
+
+type options struct {
+	key         string
+	connections ConnectionRepository
+	queries     QueryRepository
+	audit       AuditRepository
+	dialects    map[string]string // dialect spec by connection name
+}
+
+// WithKey sets the DBBRIDGE_KEY (32 characters or more) that decrypts the
+// connection strings of the connection repository, so connections that are
+// not attached are opened from them. Without it only attached connections run.
+func WithKey(key string) Option {
+	return func(o *options) { o.key = key }
+}
+
+// WithConnections keeps connections in r instead of in memory
+func WithConnections(r ConnectionRepository) Option {
+	return func(o *options) { o.connections = r }
+}
+
+// WithQueries reads saved queries from r instead of from memory
+func WithQueries(r QueryRepository) Option {
+	return func(o *options) { o.queries = r }
+}
+
+// WithAudit writes an audit entry for every execution to r. Without it
+// executions are not audited.
+func WithAudit(r AuditRepository) Option {
+	return func(o *options) { o.audit = r }
+}
+
+// WithDialect sets the dialect of the connection Attach creates under
+// connection instead of detecting it from the driver: one of sqlite,
+// postgres, mysql, mssql, oracle, snowflake, sqlanywhere or odbc with
+// options, e.g. "odbc:pagination=offset_fetch,quote=brackets".
+func WithDialect(connection, spec string) Option {
+	return func(o *options) {
+		if o.dialects == nil {
+			o.dialects = make(map[string]string)
+		}
+		o.dialects[connection] = spec
+	}
+}
+
+// Executor executes SQL and saved queries on attached databases. It is safe
+// for concurrent use.
+type Executor struct {
+	exec        *service.QueryExecutor
+	connections ConnectionRepository
+	queries     QueryRepository
+	dialects    map[string]string
+}
+
+// New returns an Executor configured by opts
+func New(opts ...Option) (*Executor, error) {
+	o := options{connections: &memory.Connections{}, queries: &memory.Queries{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.key == "" {
+		// Nothing is encrypted with a key nobody knows, so only attached
+		// connections can run
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		o.key = hex.EncodeToString(b)
+	}
+	crypto, err := service.NewEncryptionService(o.key)
+	if err != nil {
+		return nil, err
+	}
+	for name, spec := range o.dialects {
+		if _, err := core.ParseDialect(spec, ""); err != nil {
+			return nil, fmt.Errorf("connection %s: %w", name, err)
+		}
+	}
+
+	exec := service.NewQueryExecutor(o.connections, o.queries, o.audit, crypto, nil)
+	return &Executor{exec: exec, connections: o.connections, queries: o.queries, dialects: o.dialects}, nil
+}
+
+// Attach makes db the database of the connection name, creating the
+// connection with driver (the database/sql driver name, e.g. "sqlite" or
+// "postgres") when the repository has none by that name. The caller keeps
+// ownership of db and closes it after Detach.
+func (x *Executor) Attach(name, driver string, db *sql.DB) error {
+	conn, err := x.connections.GetByName(name)
+	if errors.Is(err, sql.ErrNoRows) {
+		conn = &Connection{Name: name, Driver: core.DriverName(driver), Dialect: x.dialects[name], IsActive: true}
+		err = x.connections.Create(conn)
+	}
+	if err != nil {
+		return fmt.Errorf("connection %s: %w", name, err)
+	}
+	x.exec.AttachDB(conn.ID, db)
+	return nil
+}
+
+// Detach stops executions on the connection name from using the database
+// attached to it
+func (x *Executor) Detach(name string) error {
+	conn, err := x.connections.GetByName(name)
+	if err != nil {
+		return fmt.Errorf("connection %s: %w", name, err)
+	}
+	x.exec.DetachDB(conn.ID)
+	return nil
+}
+
+// AddQuery saves sqlText as the active query slug. Like the query editor it
+// does not refuse SQL that Validate warns about.
+func (x *Executor) AddQuery(slug, sqlText string) error {
+	return x.queries.Create(&Query{Slug: slug, SQLText: sqlText, IsActive: true})
+}
+
+// Execute runs the saved query slug on connection with params, which are
+// bound by name to its {param} placeholders
+func (x *Executor) Execute(ctx context.Context, connection, slug string, params map[string]interface{}) (*Result, error) {
+	return x.exec.ExecuteByName(ctx, connection, slug, params)
+}
+
+// ExecuteSQL runs sqlText, which may use every placeholder a saved query can,
+// on connection with params
+func (x *Executor) ExecuteSQL(ctx context.Context, connection, sqlText string, params map[string]interface{}) (*Result, error) {
+	conn, err := x.connections.GetByName(connection)
+	if err != nil {
+		return nil, fmt.Errorf("connection not found: %w", err)
+	}
+	return x.exec.ExecuteSQL(ctx, conn.ID, sqlText, params, 0)
+}
+
+// Parse parses sqlText without values, as the query editor does, and reports
+// likely mistakes in its Warnings
+func Parse(sqlText string) *ParseResult {
+	return core.NewSQLParser().ParseWithWarnings(sqlText)
+}
+
+// Validate returns an error listing the warnings of Parse, nil for none
+func Validate(sqlText string) error {
+	if res := Parse(sqlText); len(res.Warnings) > 0 {
+		return errors.New(strings.Join(res.Warnings, "; "))
+	}
+	return nil
+}
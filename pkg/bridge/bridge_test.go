@@ -0,0 +1,110 @@
+package bridge_test
+
+import (
+	"context"
+	"database/sql"
+	"dbbridge/pkg/bridge"
+	"fmt"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func openShop(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection of :memory: is a database of its own
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range []string{
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer TEXT)`,
+		`INSERT INTO orders VALUES (1, 'acme'), (2, 'globex'), (3, 'acme')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestExecutor(t *testing.T) {
+	db := openShop(t)
+	x, err := bridge.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Attach("shop", "sqlite", db); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.AddQuery("by-customer", "SELECT id FROM orders WHERE customer = {customer:acme} ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		run     func() (*bridge.Result, error)
+		want    string // the rows as fmt %v
+		wantErr string
+	}{
+		{"saved query with default", func() (*bridge.Result, error) {
+			return x.Execute(context.Background(), "shop", "by-customer", nil)
+		}, "[map[id:1] map[id:3]]", ""},
+		{"saved query with param", func() (*bridge.Result, error) {
+			return x.Execute(context.Background(), "shop", "by-customer", map[string]interface{}{"customer": "globex"})
+		}, "[map[id:2]]", ""},
+		{"sql", func() (*bridge.Result, error) {
+			return x.ExecuteSQL(context.Background(), "shop", "SELECT COUNT(*) AS n FROM orders WHERE id IN ({ids})",
+				map[string]interface{}{"ids": []interface{}{1, 2}})
+		}, "[map[n:2]]", ""},
+		{"unknown connection", func() (*bridge.Result, error) {
+			return x.ExecuteSQL(context.Background(), "warehouse", "SELECT 1", nil)
+		}, "", "connection not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.run()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%v", result.Data); got != tt.want {
+				t.Errorf("rows = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// The caller's database stays open across executions and after Detach
+	if err := x.Detach("shop"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Errorf("attached database closed: %v", err)
+	}
+	if _, err := x.Execute(context.Background(), "shop", "by-customer", nil); err == nil {
+		t.Error("executed on a detached connection")
+	}
+}
+
+func TestNewRejectsUnknownDialect(t *testing.T) {
+	if _, err := bridge.New(bridge.WithDialect("shop", "dbase")); err == nil {
+		t.Error("New accepted dialect dbase")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := bridge.Validate("SELECT * FROM t WHERE id = {id}"); err != nil {
+		t.Error(err)
+	}
+	if err := bridge.Validate("SELECT * FROM t WHERE id = :id"); err == nil {
+		t.Error("no warning for a :name placeholder")
+	}
+}